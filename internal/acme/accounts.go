@@ -0,0 +1,214 @@
+// Package acme reads and writes the ACME accounts of haloyd. Each account is an email with a private key,
+// registered with every CA the key is used with. The files live in the accounts directory of the certificate
+// storage: <email>.key holds the PEM encoded key and <email>.json the registrations, with the email sanitized.
+package acme
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+const (
+	// AccountsDir is the directory of the accounts in the certificate storage.
+	AccountsDir = "accounts"
+
+	keyExt     = ".key"
+	accountExt = ".json"
+
+	// ExportVersion is the format version of exported accounts.
+	ExportVersion = 1
+
+	LetsEncryptProduction = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// CAName returns a short name for the CA at caDirURL, or the URL for other CAs.
+func CAName(caDirURL string) string {
+	switch caDirURL {
+	case LetsEncryptProduction:
+		return "production"
+	case LetsEncryptStaging:
+		return "staging"
+	default:
+		return caDirURL
+	}
+}
+
+// Registration is an account registered with a CA.
+type Registration struct {
+	// URI identifies the account at the CA.
+	URI string `json:"uri"`
+	// Status is the account status reported by the CA, e.g. "valid" or "deactivated".
+	Status       string    `json:"status"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// Account is an ACME account in the accounts directory.
+type Account struct {
+	Email string `json:"email"`
+	// Registrations by CA directory URL.
+	Registrations map[string]Registration `json:"registrations,omitempty"`
+	// Key is the PEM encoded account key. It's only set on exported accounts.
+	Key string `json:"key,omitempty"`
+}
+
+// Export is the file format of 'haloyadm acme accounts export'.
+type Export struct {
+	Version  int       `json:"version"`
+	Accounts []Account `json:"accounts"`
+}
+
+// KeyPath returns the path of the account key of email.
+func KeyPath(dir, email string) string {
+	return filepath.Join(dir, helpers.SanitizeString(email)+keyExt)
+}
+
+func accountPath(dir, email string) string {
+	return filepath.Join(dir, helpers.SanitizeString(email)+accountExt)
+}
+
+// LoadAccount returns the account of email. Accounts of keys created before registrations were
+// recorded have no registrations until haloyd registers them again.
+func LoadAccount(dir, email string) (Account, error) {
+	account := Account{Email: email}
+	data, err := os.ReadFile(accountPath(dir, email))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return account, nil
+		}
+		return account, fmt.Errorf("failed to read account of %s: %w", email, err)
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return account, fmt.Errorf("failed to parse account of %s: %w", email, err)
+	}
+	return account, nil
+}
+
+// SaveRegistration records the registration of the account of email with the CA at caDirURL.
+func SaveRegistration(dir, email, caDirURL string, registration Registration) error {
+	account, err := LoadAccount(dir, email)
+	if err != nil {
+		return err
+	}
+	if account.Registrations == nil {
+		account.Registrations = make(map[string]Registration)
+	}
+	account.Email = email
+	account.Registrations[caDirURL] = registration
+	return saveAccount(dir, account)
+}
+
+func saveAccount(dir string, account Account) error {
+	account.Key = ""
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode account of %s: %w", account.Email, err)
+	}
+	if err := os.WriteFile(accountPath(dir, account.Email), data, constants.ModeFileSecret); err != nil {
+		return fmt.Errorf("failed to save account of %s: %w", account.Email, err)
+	}
+	return nil
+}
+
+// ListAccounts returns the accounts with a key in dir, sorted by email. Keys without a recorded account
+// are listed with the file name as email, the email can't be recovered from the sanitized name.
+func ListAccounts(dir string) ([]Account, error) {
+	keyFiles, err := filepath.Glob(filepath.Join(dir, "*"+keyExt))
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]Account, 0, len(keyFiles))
+	for _, keyFile := range keyFiles {
+		name := strings.TrimSuffix(filepath.Base(keyFile), keyExt)
+		account := Account{Email: name}
+		data, err := os.ReadFile(filepath.Join(dir, name+accountExt))
+		if err == nil {
+			if err := json.Unmarshal(data, &account); err != nil {
+				return nil, fmt.Errorf("failed to parse account %s: %w", name, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read account %s: %w", name, err)
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Email < accounts[j].Email
+	})
+	return accounts, nil
+}
+
+// ExportAccounts returns the accounts in dir with their keys. All accounts are exported when emails is empty.
+func ExportAccounts(dir string, emails []string) (Export, error) {
+	accounts, err := ListAccounts(dir)
+	if err != nil {
+		return Export{}, err
+	}
+
+	export := Export{Version: ExportVersion, Accounts: []Account{}}
+	for _, account := range accounts {
+		if len(emails) > 0 && !slices.ContainsFunc(emails, func(email string) bool { return strings.EqualFold(email, account.Email) }) {
+			continue
+		}
+		key, err := os.ReadFile(KeyPath(dir, account.Email))
+		if err != nil {
+			return Export{}, fmt.Errorf("failed to read account key of %s: %w", account.Email, err)
+		}
+		account.Key = string(key)
+		export.Accounts = append(export.Accounts, account)
+	}
+	for _, email := range emails {
+		if !slices.ContainsFunc(export.Accounts, func(account Account) bool { return strings.EqualFold(account.Email, email) }) {
+			return Export{}, fmt.Errorf("no account found for %s", email)
+		}
+	}
+	return export, nil
+}
+
+// ImportAccounts writes the exported accounts to dir. An account whose key differs from the existing key
+// of the email is rejected unless overwrite is set, the existing key would be lost.
+func ImportAccounts(dir string, export Export, overwrite bool) ([]string, error) {
+	if export.Version != ExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d, expected %d", export.Version, ExportVersion)
+	}
+
+	for _, account := range export.Accounts {
+		if account.Email == "" {
+			return nil, errors.New("account without email in export")
+		}
+		block, _ := pem.Decode([]byte(account.Key))
+		if block == nil {
+			return nil, fmt.Errorf("account key of %s is not PEM encoded", account.Email)
+		}
+		existing, err := os.ReadFile(KeyPath(dir, account.Email))
+		if err == nil && string(existing) != account.Key && !overwrite {
+			return nil, fmt.Errorf("a different key for %s already exists, use --overwrite to replace it", account.Email)
+		}
+	}
+
+	if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+		return nil, fmt.Errorf("failed to create accounts directory: %w", err)
+	}
+	imported := make([]string, 0, len(export.Accounts))
+	for _, account := range export.Accounts {
+		if err := os.WriteFile(KeyPath(dir, account.Email), []byte(account.Key), constants.ModeFileSecret); err != nil {
+			return imported, fmt.Errorf("failed to write account key of %s: %w", account.Email, err)
+		}
+		if err := saveAccount(dir, account); err != nil {
+			return imported, err
+		}
+		imported = append(imported, account.Email)
+	}
+	return imported, nil
+}
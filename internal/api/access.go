@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+// apiAccess holds the CORS origins, the trusted proxies, the app tokens, the protected apps and the OIDC sign-in of
+// the API.
+type apiAccess struct {
+	config         config.APIConfig
+	trustedProxies []netip.Prefix
+}
+
+// SetAccess sets the origins allowed to call the API from a browser, the proxies whose X-Forwarded-For header
+// is trusted, the app tokens, the protected apps and the OIDC sign-in.
+func (s *APIServer) SetAccess(apiConfig config.APIConfig) {
+	s.access.Store(&apiAccess{
+		config:         apiConfig,
+		trustedProxies: apiConfig.TrustedProxyPrefixes(),
+	})
+	s.setOIDC(apiConfig.OIDC)
+}
+
+// corsMiddleware adds the CORS headers to requests to /v1 endpoints from allowed origins, and answers
+// preflight requests before they're rate limited.
+func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, "/v1/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		access := s.access.Load()
+		allowed := access != nil && access.config.AllowsOrigin(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", constants.HeaderCorrelationID+", Retry-After")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			// Without the allow headers the browser rejects the request of a disallowed origin.
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID, "+constants.HeaderCorrelationID)
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client. haloyd is reached through HAProxy, which adds the address it
+// received the request from to X-Forwarded-For. The header is only read on connections from the proxy
+// container or a trusted proxy, and addresses added by trusted proxies in front of HAProxy are skipped.
+// Other peers, also on private networks, could set any address in the header.
+func (s *APIServer) clientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if !peer.IsValid() {
+		return r.RemoteAddr
+	}
+
+	var trustedProxies []netip.Prefix
+	if access := s.access.Load(); access != nil {
+		trustedProxies = access.trustedProxies
+	}
+	trusted := func(addr netip.Addr) bool {
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !trusted(peer) && !s.proxyAddresses.contains(peer) {
+		return peer.String()
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for address := range strings.SplitSeq(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(address))
+		}
+	}
+
+	client := peer
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(forwarded[i])
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		// The address HAProxy added is the client, unless it's one of the proxies in front of HAProxy.
+		if !trusted(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// proxyLookupInterval is how long the addresses of the proxy containers are cached. A recreated container
+// may get another address.
+const proxyLookupInterval = 30 * time.Second
+
+// proxyAddresses resolves the addresses of the proxy containers on the haloy network.
+type proxyAddresses struct {
+	mutex      sync.Mutex
+	addrs      []netip.Addr
+	resolvedAt time.Time
+	// lookup resolves a container name, net.DefaultResolver.LookupNetIP when nil.
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// contains reports whether addr belongs to the HAProxy or Caddy container.
+func (p *proxyAddresses) contains(addr netip.Addr) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Since(p.resolvedAt) > proxyLookupInterval {
+		lookup := p.lookup
+		if lookup == nil {
+			lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+				return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		// Only the container of the configured backend exists. When neither resolves, e.g. while the
+		// container is recreated, the previous addresses are kept.
+		var resolved []netip.Addr
+		found := false
+		for _, name := range []string{constants.HAProxyContainerName, constants.CaddyContainerName} {
+			addrs, err := lookup(ctx, name)
+			if err != nil {
+				continue
+			}
+			found = true
+			for _, a := range addrs {
+				resolved = append(resolved, a.Unmap())
+			}
+		}
+		if found {
+			p.addrs = resolved
+		}
+		p.resolvedAt = time.Now()
+	}
+	return slices.Contains(p.addrs, addr)
+}
+
+// remoteIP returns the address of the connection of r.
+func remoteIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+func TestClientIP(t *testing.T) {
+	s := NewServer(testAPIToken, logging.NewLogBroker(), events.NewBroker(), slog.LevelInfo)
+	s.SetAccess(config.APIConfig{TrustedProxies: []string{"173.245.48.0/20"}})
+	s.proxyAddresses.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		if host == constants.HAProxyContainerName {
+			return []netip.Addr{netip.MustParseAddr("172.18.0.2")}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		expected  string
+	}{
+		{name: "HAProxy", peer: "172.18.0.2", forwarded: []string{"198.51.100.7"}, expected: "198.51.100.7"},
+		{name: "HAProxy without header", peer: "172.18.0.2", expected: "172.18.0.2"},
+		{name: "spoofed header from private peer", peer: "172.18.0.9", forwarded: []string{"198.51.100.7"}, expected: "172.18.0.9"},
+		{name: "spoofed header from loopback", peer: "127.0.0.1", forwarded: []string{"198.51.100.7"}, expected: "127.0.0.1"},
+		{name: "spoofed header from public peer", peer: "203.0.113.10", forwarded: []string{"198.51.100.7"}, expected: "203.0.113.10"},
+		{name: "trusted proxy in front of HAProxy", peer: "172.18.0.2", forwarded: []string{"198.51.100.7, 173.245.48.1"}, expected: "198.51.100.7"},
+		{name: "spoofed address before the client", peer: "172.18.0.2", forwarded: []string{"10.0.0.1", "198.51.100.7"}, expected: "198.51.100.7"},
+		{name: "trusted proxy as peer", peer: "173.245.48.1", forwarded: []string{"198.51.100.7"}, expected: "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/version", nil)
+			r.RemoteAddr = tt.peer + ":40000"
+			for _, header := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if got := s.clientIP(r); got != tt.expected {
+				t.Errorf("clientIP() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+)
+
+type appTokenContextKey struct{}
+
+func withAppToken(ctx context.Context, token config.AppToken) context.Context {
+	return context.WithValue(ctx, appTokenContextKey{}, token)
+}
+
+// appTokenFromContext returns the app token a request was authenticated with. Requests with the API token
+// have none and can manage every app.
+func appTokenFromContext(ctx context.Context) (config.AppToken, bool) {
+	token, ok := ctx.Value(appTokenContextKey{}).(config.AppToken)
+	return token, ok
+}
+
+// findAppToken returns the app token of the haloyd config that token belongs to, or an app token for the apps
+// an OIDC user can manage.
+func (s *APIServer) findAppToken(token string) (config.AppToken, bool) {
+	access := s.access.Load()
+	if access == nil {
+		return config.AppToken{}, false
+	}
+	for _, appToken := range access.config.AppTokens {
+		if appToken.Matches(token) {
+			return appToken, true
+		}
+	}
+	if identity, ok := s.oidcIdentity(token); ok && len(identity.grant.Apps) > 0 {
+		return config.AppToken{Name: oidcTokenName(identity.subject), Apps: identity.grant.Apps}, true
+	}
+	return config.AppToken{}, false
+}
+
+// appAllowed reports whether the token of the request can manage the app.
+func appAllowed(r *http.Request, appName string) bool {
+	token, ok := appTokenFromContext(r.Context())
+	return !ok || token.AllowsApp(appName)
+}
+
+// authorizeApp writes a 403 response and returns false when the token of the request can't manage the app.
+func authorizeApp(w http.ResponseWriter, r *http.Request, appName string) bool {
+	if appAllowed(r, appName) {
+		return true
+	}
+	token, _ := appTokenFromContext(r.Context())
+	writeError(w, http.StatusForbidden, apitypes.ErrCodeForbidden,
+		fmt.Sprintf("Token '%s' can't manage app '%s'", token.Name, appName),
+		map[string]any{"token": token.Name, "app": appName})
+	return false
+}
+
+// authorizeTarget is authorizeApp for the apps a target config changes: the app itself and the app it
+// mirrors requests to with shadow_to.
+func authorizeTarget(w http.ResponseWriter, r *http.Request, targetConfig config.TargetConfig) bool {
+	if !authorizeApp(w, r, targetConfig.Name) {
+		return false
+	}
+	return targetConfig.ShadowTo == nil || authorizeApp(w, r, targetConfig.ShadowTo.App)
+}
+
+// authorizeDeployment is authorizeApp for the app of a deployment. App tokens get a 404 response for
+// deployments whose app can't be found, so they can't read the logs of other apps by guessing IDs.
+func (s *APIServer) authorizeDeployment(w http.ResponseWriter, r *http.Request, deploymentID string) bool {
+	if _, ok := appTokenFromContext(r.Context()); !ok {
+		return true
+	}
+	appName, err := s.deploymentAppName(deploymentID)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Failed to look up deployment: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if appName == "" {
+		httpError(w, fmt.Sprintf("Deployment %s not found", deploymentID), http.StatusNotFound)
+		return false
+	}
+	return authorizeApp(w, r, appName)
+}
+
+// deploymentAppName returns the app of a deployment, or an empty name when it isn't found. Deployments that
+// are pending, queued or running are looked up in memory, the others in storage.
+func (s *APIServer) deploymentAppName(deploymentID string) (string, error) {
+	s.pendingMutex.Lock()
+	pending, ok := s.pending[deploymentID]
+	s.pendingMutex.Unlock()
+	if ok {
+		return pending.request.TargetConfig.Name, nil
+	}
+
+	s.activeMutex.Lock()
+	appName, ok := s.activeApps[deploymentID]
+	s.activeMutex.Unlock()
+	if ok {
+		return appName, nil
+	}
+
+	// Entries of a finished deployment may not be stored yet.
+	for _, entry := range s.logBroker.DeploymentLogs(deploymentID) {
+		if entry.AppName != "" {
+			return entry.AppName, nil
+		}
+	}
+	return deploy.DeploymentAppName(deploymentID)
+}
+
+// setActiveApp records the app of a queued or running deployment, an empty name removes it.
+func (s *APIServer) setActiveApp(deploymentID, appName string) {
+	s.activeMutex.Lock()
+	defer s.activeMutex.Unlock()
+	if appName == "" {
+		delete(s.activeApps, deploymentID)
+		return
+	}
+	s.activeApps[deploymentID] = appName
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+const (
+	testAPIToken = "api-token"
+	testAppToken = "shop-token"
+)
+
+// newTestServer returns a server with an app token for the shop apps and its data in a temporary directory.
+func newTestServer(t *testing.T) *APIServer {
+	t.Helper()
+	dataDir := t.TempDir()
+	t.Setenv(constants.EnvVarDataDir, dataDir)
+	if err := os.MkdirAll(filepath.Join(dataDir, constants.DBDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := storage.New()
+	if err != nil {
+		t.Fatalf("storage.New() error = %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	s := NewServer(testAPIToken, logging.NewLogBroker(), events.NewBroker(), slog.LevelInfo)
+	s.proxyAddresses.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		return nil, fmt.Errorf("no such host")
+	}
+	s.SetAccess(config.APIConfig{
+		AppTokens: []config.AppToken{{Name: "ci-shop", TokenHash: config.HashAPIToken(testAppToken), Apps: []string{"shop-*"}}},
+	})
+	return s
+}
+
+func serve(s *APIServer, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.RemoteAddr = "203.0.113.10:40000"
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestDeploymentLogsAuthorization(t *testing.T) {
+	s := newTestServer(t)
+
+	// A finished deployment of another app, and one that is still running.
+	db, err := storage.New()
+	if err != nil {
+		t.Fatalf("storage.New() error = %v", err)
+	}
+	rawAppConfig, _ := json.Marshal(config.AppConfig{})
+	if err := db.SaveDeployment(storage.Deployment{ID: "20250101120000", AppName: "blog", RawAppConfig: rawAppConfig, DeployedImage: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("SaveDeployment() error = %v", err)
+	}
+	db.Close()
+	s.setActiveApp("20250101130000", "blog")
+	s.setActiveApp("20250101140000", "shop-web")
+
+	paths := []string{"/logs", "/logs/history", "/logs/download"}
+	tests := []struct {
+		name         string
+		deploymentID string
+		token        string
+		forbidden    bool
+		status       int
+	}{
+		{name: "stored deployment of another app", deploymentID: "20250101120000", token: testAppToken, forbidden: true},
+		{name: "running deployment of another app", deploymentID: "20250101130000", token: testAppToken, forbidden: true},
+		{name: "unknown deployment", deploymentID: "20250101150000", token: testAppToken, status: http.StatusNotFound},
+		{name: "API token", deploymentID: "20250101120000", token: testAPIToken},
+	}
+
+	for _, tt := range tests {
+		for _, path := range paths {
+			t.Run(tt.name+path, func(t *testing.T) {
+				if path == "/logs" && !tt.forbidden && tt.status == 0 {
+					t.Skip("streams until the deployment completes")
+				}
+				w := serve(s, http.MethodGet, "/v1/deploy/"+tt.deploymentID+path, tt.token, "")
+				switch {
+				case tt.forbidden && w.Code != http.StatusForbidden:
+					t.Errorf("status = %d, expected %d", w.Code, http.StatusForbidden)
+				case tt.status != 0 && w.Code != tt.status:
+					t.Errorf("status = %d, expected %d", w.Code, tt.status)
+				case !tt.forbidden && w.Code == http.StatusForbidden:
+					t.Errorf("status = %d, expected access", w.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestDeploymentLogsOwnApp(t *testing.T) {
+	s := newTestServer(t)
+	s.setActiveApp("20250101140000", "shop-web")
+
+	w := serve(s, http.MethodGet, "/v1/deploy/20250101140000/logs/history", testAppToken, "")
+	// The deployment has no logs yet, but the token may read them.
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestImageUploadsRequireAPIToken(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, path := range []string{"/v1/images/upload", "/v1/images/layers", "/v1/images/uploads", "/v1/images/uploads/abc/complete"} {
+		if w := serve(s, http.MethodPost, path, testAppToken, ""); w.Code != http.StatusForbidden {
+			t.Errorf("POST %s status = %d, expected %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+	if w := serve(s, http.MethodPatch, "/v1/images/uploads/abc", testAppToken, ""); w.Code != http.StatusForbidden {
+		t.Errorf("PATCH status = %d, expected %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestRelatedAppsAuthorization(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{
+			name: "shadow_to another app",
+			path: "/v1/deploy",
+			body: `{"targetConfig":{"name":"shop-web","image":{"repository":"shop"},"shadowTo":{"app":"blog"}}}`,
+		},
+		{
+			name: "shadow_to another app in dry run",
+			path: "/v1/deploy/dry-run",
+			body: `{"targetConfig":{"name":"shop-web","image":{"repository":"shop"},"shadowTo":{"app":"blog"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(s, http.MethodPost, tt.path, testAppToken, tt.body); w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, expected %d: %s", w.Code, http.StatusForbidden, w.Body.String())
+			}
+		})
+	}
+}
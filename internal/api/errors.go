@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+)
+
+// writeError writes an apitypes.ErrorResponse with the status and code.
+func writeError(w http.ResponseWriter, status int, code, message string, details map[string]any) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	encodeJSON(w, status, apitypes.ErrorResponse{Code: code, Message: message, Details: details})
+}
+
+// httpError replaces http.Error in the handlers, it writes an apitypes.ErrorResponse with the generic code of the status.
+func httpError(w http.ResponseWriter, message string, status int) {
+	writeError(w, status, errorCode(status), message, nil)
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return apitypes.ErrCodeBadRequest
+	case http.StatusUnauthorized:
+		return apitypes.ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return apitypes.ErrCodeForbidden
+	case http.StatusNotFound:
+		return apitypes.ErrCodeNotFound
+	case http.StatusConflict:
+		return apitypes.ErrCodeConflict
+	case http.StatusPreconditionFailed:
+		return apitypes.ErrCodePreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return apitypes.ErrCodeTooLarge
+	case http.StatusTooManyRequests:
+		return apitypes.ErrCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return apitypes.ErrCodeUnavailable
+	default:
+		if status < http.StatusInternalServerError {
+			return apitypes.ErrCodeBadRequest
+		}
+		return apitypes.ErrCodeInternal
+	}
+}
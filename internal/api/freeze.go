@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+// SetDeployConfig sets the freeze windows deploy requests are checked against.
+func (s *APIServer) SetDeployConfig(deployConfig config.DeployConfig) {
+	s.deployConfig.Store(&deployConfig)
+}
+
+// activeFreeze returns the freeze window deployments are in now and when it ends.
+func (s *APIServer) activeFreeze() (config.FreezeWindow, time.Time, bool) {
+	deployConfig := s.deployConfig.Load()
+	if deployConfig == nil {
+		return config.FreezeWindow{}, time.Time{}, false
+	}
+	return deployConfig.ActiveFreeze(time.Now())
+}
+
+// checkFreeze rejects or queues a deployment during a freeze window. It returns false when the
+// response has been written and the deployment must not start.
+func (s *APIServer) checkFreeze(w http.ResponseWriter, r *http.Request, req apitypes.DeployRequest) bool {
+	queuedUntil, ok := s.holdForFreeze(w, r, req)
+	if queuedUntil != nil {
+		encodeJSON(w, http.StatusAccepted, apitypes.DeployResponse{DeploymentID: req.DeploymentID, QueuedUntil: queuedUntil})
+		return false
+	}
+	return ok
+}
+
+// holdForFreeze queues a deployment during a freeze window and returns the end of the window, or writes the
+// error response and returns false when freeze windows reject deployments.
+func (s *APIServer) holdForFreeze(w http.ResponseWriter, r *http.Request, req apitypes.DeployRequest) (*time.Time, bool) {
+	window, until, frozen := s.activeFreeze()
+	if !frozen {
+		return nil, true
+	}
+
+	if req.IgnoreFreeze {
+		logging.NewLogger(s.logLevel, s.logBroker).Warn("Deploying during a freeze window, the freeze was ignored",
+			"app", req.TargetConfig.Name, "deploymentID", req.DeploymentID, "window", window.DisplayName())
+		return nil, true
+	}
+
+	if s.queuesFrozenDeployments() {
+		s.queueDeployment(r.Clone(context.WithoutCancel(r.Context())), req, until)
+		return &until, true
+	}
+
+	writeError(w, http.StatusConflict, apitypes.ErrCodeDeployFrozen,
+		fmt.Sprintf("Deployments are frozen by '%s' until %s, use --ignore-freeze to deploy anyway", window.DisplayName(), until.UTC().Format(time.RFC3339)),
+		map[string]any{"window": window.DisplayName(), "until": until.UTC()})
+	return nil, false
+}
+
+func (s *APIServer) queuesFrozenDeployments() bool {
+	deployConfig := s.deployConfig.Load()
+	return deployConfig != nil && deployConfig.FreezeAction == config.FreezeActionQueue
+}
+
+// queueDeployment starts the deployment when the freeze window ends. Queued deployments are kept in
+// memory and lost when haloyd restarts.
+func (s *APIServer) queueDeployment(r *http.Request, req apitypes.DeployRequest, until time.Time) {
+	s.setActiveApp(req.DeploymentID, req.TargetConfig.Name)
+	s.eventBroker.Publish(events.Event{
+		Type:         events.TypeDeploymentQueued,
+		AppName:      req.TargetConfig.Name,
+		DeploymentID: req.DeploymentID,
+		Data:         map[string]any{"until": until},
+	})
+
+	time.AfterFunc(time.Until(until), func() {
+		// The windows may have changed with a config reload in the meantime.
+		if _, next, frozen := s.activeFreeze(); frozen {
+			s.queueDeployment(r, req, next)
+			return
+		}
+		if !s.runDeployment(r, req) {
+			logging.NewLogger(s.logLevel, s.logBroker).Warn("Dropped queued deployment, haloyd is shutting down",
+				"app", req.TargetConfig.Name, "deploymentID", req.DeploymentID)
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/docker/docker/client"
+)
+
+var (
+	// Header and cookie names and values are written to the HAProxy config, so they're limited to characters
+	// that need no quoting.
+	abTestNameRegex  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	abTestValueRegex = regexp.MustCompile(`^[A-Za-z0-9._~:/+=-]+$`)
+	abTestTagRegex   = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// handleStartABTest starts a variant deployment of an app with another image tag and routes the requests of the
+// app that match a header, a cookie or a percentage to it. A running A/B test of the app is replaced.
+func (s *APIServer) handleStartABTest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		var req apitypes.ABTestRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validateABTestRequest(req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.usesCaddy() {
+			httpError(w, "A/B tests are not supported with the caddy proxy backend of the server", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		paused, err := deploy.PausedApp(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if paused != nil {
+			httpError(w, "App is paused, use 'haloy resume' to start it", http.StatusConflict)
+			return
+		}
+
+		currentID, spec, err := currentSpec(ctx, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if currentID == "" {
+			httpError(w, fmt.Sprintf("No containers found for %s", appName), http.StatusNotFound)
+			return
+		}
+		if spec == nil {
+			httpError(w, fmt.Sprintf("Deployment %s was made before deployment specs were stored, deploy the app again to A/B test it", currentID),
+				http.StatusConflict)
+			return
+		}
+		if spec.Image == nil || spec.Image.IsDigestReference() {
+			httpError(w, "The image of the app is pinned by digest, so it has no tags to A/B test", http.StatusConflict)
+			return
+		}
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		// The variant of a running test keeps serving until the new one is healthy.
+		running, err := deploy.ABTest(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var runningID string
+		if running != nil {
+			runningID = running.VariantDeploymentID
+		}
+		removeABVariants(cli, logger, appName, runningID)
+
+		image := *spec.Image
+		image.Tag = req.Tag
+		spec.Image = &image
+		deploymentID := string(helpers.NewDeploymentID())
+
+		logger.Info("Starting A/B test variant", "app", appName, "deployment_id", deploymentID, "image", image.ImageRef())
+		results, err := deploy.StartABVariant(ctx, cli, logger, deploymentID, *spec)
+		if err == nil {
+			for _, result := range results {
+				if err = docker.HealthCheckContainer(ctx, cli, logger, result.ID); err != nil {
+					err = fmt.Errorf("replica %d is not healthy: %w", result.ReplicaID, err)
+					break
+				}
+			}
+		}
+		if err != nil {
+			removeABVariants(cli, logger, appName, runningID)
+			httpError(w, fmt.Sprintf("Failed to start the variant: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		test := storage.ABTest{
+			AppName:             appName,
+			VariantDeploymentID: deploymentID,
+			VariantImage:        image.ImageRef(),
+			HeaderName:          req.HeaderName,
+			HeaderValue:         req.HeaderValue,
+			CookieName:          req.CookieName,
+			CookieValue:         req.CookieValue,
+			Percentage:          req.Percentage,
+			StartedAt:           time.Now(),
+		}
+		if err := deploy.StartABTest(test); err != nil {
+			removeABVariants(cli, logger, appName, runningID)
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("Started A/B test", "app", appName, "deployment_id", deploymentID, "image", test.VariantImage)
+		if err := s.updateRouting(ctx); err != nil {
+			httpError(w, fmt.Sprintf("A/B test saved but HAProxy was not updated: %v", err), http.StatusInternalServerError)
+			return
+		}
+		// The variant of the replaced test is removed once requests are routed to the new one.
+		removeABVariants(cli, logger, appName, deploymentID)
+
+		encodeJSON(w, http.StatusOK, apitypes.ABTestResponse{
+			Message:      fmt.Sprintf("Routing matching requests to %s", test.VariantImage),
+			DeploymentID: deploymentID,
+		})
+	}
+}
+
+// handleStopABTest routes all requests of an app to the app again and removes the variant deployment.
+func (s *APIServer) handleStopABTest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		test, err := deploy.ABTest(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if test == nil {
+			httpError(w, "No A/B test is running for the app", http.StatusConflict)
+			return
+		}
+		if err := deploy.StopABTest(appName); err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Stopped A/B test", "app", appName, "deployment_id", test.VariantDeploymentID, "image", test.VariantImage)
+		if err := s.updateRouting(ctx); err != nil {
+			httpError(w, fmt.Sprintf("A/B test removed but HAProxy was not updated: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+		removeABVariants(cli, logger, appName, "")
+
+		encodeJSON(w, http.StatusOK, apitypes.ABTestResponse{
+			Message:      fmt.Sprintf("Stopped routing requests to %s", test.VariantImage),
+			DeploymentID: test.VariantDeploymentID,
+		})
+	}
+}
+
+// removeABVariants removes the variant deployments of an app except the one of keepDeploymentID. Failures are
+// logged, the containers are removed again by the next A/B test or stop of the app.
+func removeABVariants(cli *client.Client, logger *slog.Logger, appName, keepDeploymentID string) {
+	// Also run when the request was canceled, the containers would otherwise be left behind.
+	ctx, cancel := context.WithTimeout(context.Background(), defaultContextTimeout)
+	defer cancel()
+	if _, err := docker.RemoveABVariantContainers(ctx, cli, logger, appName, keepDeploymentID); err != nil {
+		logger.Warn("Failed to remove A/B test variant", "app", appName, "error", err)
+	}
+}
+
+func validateABTestRequest(req apitypes.ABTestRequest) error {
+	if req.Tag == "" {
+		return fmt.Errorf("tag is required")
+	}
+	if !abTestTagRegex.MatchString(req.Tag) {
+		return fmt.Errorf("invalid tag '%s'", req.Tag)
+	}
+	if req.HeaderName == "" && req.CookieName == "" && req.Percentage == 0 {
+		return fmt.Errorf("a header, a cookie or a percentage is required")
+	}
+
+	matches := []struct {
+		kind, name, value string
+	}{
+		{"header", req.HeaderName, req.HeaderValue},
+		{"cookie", req.CookieName, req.CookieValue},
+	}
+	for _, match := range matches {
+		if match.name == "" {
+			if match.value != "" {
+				return fmt.Errorf("%s value requires a %s name", match.kind, match.kind)
+			}
+			continue
+		}
+		if !abTestNameRegex.MatchString(match.name) {
+			return fmt.Errorf("invalid %s name '%s'", match.kind, match.name)
+		}
+		if !abTestValueRegex.MatchString(match.value) {
+			return fmt.Errorf("invalid %s value '%s', expected letters, digits and ._~:/+=-", match.kind, match.value)
+		}
+	}
+
+	if req.Percentage < 0 || req.Percentage > 100 {
+		return fmt.Errorf("percentage must be between 0 and 100")
+	}
+	return nil
+}
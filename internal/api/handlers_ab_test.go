@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/config"
+)
+
+func TestCaddyBackendRejectsHAProxyFeatures(t *testing.T) {
+	s := newTestServer(t)
+	s.SetProxyBackend(config.ProxyBackendCaddy)
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "A/B test",
+			path:    "/v1/ab/start/shop-web",
+			body:    `{"tag":"v2","percentage":10}`,
+			wantErr: "A/B tests are not supported",
+		},
+		{
+			name:    "deploy with shadow_to",
+			path:    "/v1/deploy",
+			body:    `{"targetConfig":{"name":"shop-web","server":"localhost","image":{"repository":"shop"},"shadowTo":{"app":"shop-v2"}}}`,
+			wantErr: "is not supported with the caddy proxy backend",
+		},
+		{
+			name:    "dry run with connection limits",
+			path:    "/v1/deploy/dry-run",
+			body:    `{"targetConfig":{"name":"shop-web","server":"localhost","image":{"repository":"shop"},"connections":{"max":10}}}`,
+			wantErr: "is not supported with the caddy proxy backend",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, http.MethodPost, tt.path, testAPIToken, tt.body)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantErr) {
+				t.Errorf("status = %d, expected %d with %q: %s", w.Code, http.StatusBadRequest, tt.wantErr, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// Destructive operations on protected apps that wait for the confirmation of a second token.
+const (
+	actionRollback = "rollback"
+	actionRemove   = "remove"
+)
+
+// stopActionRequest is the stored request of an actionRemove.
+type stopActionRequest struct {
+	RemoveContainers bool `json:"removeContainers"`
+}
+
+// protection returns the protected apps of the haloyd config.
+func (s *APIServer) protection() config.APIProtection {
+	access := s.access.Load()
+	if access == nil {
+		return config.APIProtection{}
+	}
+	return access.config.Protection
+}
+
+// protects reports whether destructive operations on the app wait for a confirmation.
+func (s *APIServer) protects(appName string) bool {
+	return s.protection().Protects(appName)
+}
+
+// holdAction stores a destructive operation until another token confirms it with 'haloy confirm'. The
+// operation is stored in the database, so it can still be confirmed after haloyd restarts.
+func (s *APIServer) holdAction(r *http.Request, action, appName, description string, request any) (*apitypes.PendingAction, error) {
+	encodedRequest, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", action, err)
+	}
+	payload, err := json.Marshal(pendingActionPayload{Description: description, Request: encodedRequest})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", action, err)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	now := time.Now()
+	if _, err := db.DeleteExpiredPendingActions(now); err != nil {
+		return nil, err
+	}
+	pending := storage.PendingAction{
+		ID:          helpers.NewDeploymentID().String(),
+		Action:      action,
+		AppName:     appName,
+		Request:     payload,
+		RequestedBy: s.requesterKey(r),
+		RequestedAt: now,
+		ExpiresAt:   now.Add(s.protection().ExpiryDuration()),
+	}
+	if err := db.SavePendingAction(pending); err != nil {
+		return nil, fmt.Errorf("failed to save pending action: %w", err)
+	}
+
+	logger := logging.NewLogger(s.logLevel, s.logBroker)
+	logger.Info("Protected operation waits for confirmation", "app", appName, "action", action, "action_id", pending.ID,
+		"client_ip", s.clientIP(r))
+	s.eventBroker.Publish(events.Event{
+		Type:    events.TypeActionPending,
+		AppName: appName,
+		Data:    map[string]any{"actionID": pending.ID, "action": action, "expiresAt": pending.ExpiresAt},
+	})
+
+	result, err := toPendingAction(pending)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// requesterKey identifies the token of the request, a session counts as the API token it was created with and
+// OIDC users are identified by their subject, so another user can confirm.
+func (s *APIServer) requesterKey(r *http.Request) string {
+	token := bearerToken(r)
+	if identity, ok := s.oidcIdentity(token); ok {
+		return oidcTokenName(identity.subject)
+	}
+	return tokenKey(s.resolveToken(token))
+}
+
+// pendingActionPayload is the stored request of a pending action.
+type pendingActionPayload struct {
+	Description string          `json:"description"`
+	Request     json.RawMessage `json:"request"`
+}
+
+func toPendingAction(action storage.PendingAction) (apitypes.PendingAction, error) {
+	var payload pendingActionPayload
+	if err := json.Unmarshal(action.Request, &payload); err != nil {
+		return apitypes.PendingAction{}, fmt.Errorf("failed to decode pending action %s: %w", action.ID, err)
+	}
+	return apitypes.PendingAction{
+		ActionID:    action.ID,
+		Action:      action.Action,
+		AppName:     action.AppName,
+		Description: payload.Description,
+		RequestedAt: action.RequestedAt,
+		ExpiresAt:   action.ExpiresAt,
+	}, nil
+}
+
+func (s *APIServer) handlePendingActions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db, err := storage.New()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		actions, err := db.GetPendingActions(time.Now())
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := apitypes.PendingActionsResponse{Actions: make([]apitypes.PendingAction, 0, len(actions))}
+		for _, action := range actions {
+			if !appAllowed(r, action.AppName) {
+				continue
+			}
+			pending, err := toPendingAction(action)
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			response.Actions = append(response.Actions, pending)
+		}
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
+
+func (s *APIServer) handleConfirmAction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actionID := r.PathValue("actionID")
+
+		db, err := storage.New()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		action, err := db.GetPendingAction(actionID)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if action == nil || !time.Now().Before(action.ExpiresAt) {
+			httpError(w, "No pending action with ID "+actionID, http.StatusNotFound)
+			return
+		}
+		if !authorizeApp(w, r, action.AppName) {
+			return
+		}
+		if s.requesterKey(r) == action.RequestedBy {
+			writeError(w, http.StatusForbidden, apitypes.ErrCodeForbidden,
+				"The action must be confirmed with another token than the one that requested it", nil)
+			return
+		}
+
+		var payload pendingActionPayload
+		if err := json.Unmarshal(action.Request, &payload); err != nil {
+			httpError(w, fmt.Sprintf("Failed to decode pending action: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Only the confirmation that removes the action runs it.
+		deleted, err := db.DeletePendingAction(actionID)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			httpError(w, "No pending action with ID "+actionID, http.StatusNotFound)
+			return
+		}
+
+		var response apitypes.ConfirmActionResponse
+		switch action.Action {
+		case actionRollback:
+			var req apitypes.RollbackRequest
+			if err := json.Unmarshal(payload.Request, &req); err != nil {
+				httpError(w, fmt.Sprintf("Failed to decode rollback request: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if !s.startRollback(r, req) {
+				// Put it back, so it can be confirmed again once haloyd is up.
+				if err := db.SavePendingAction(*action); err != nil {
+					httpError(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				httpError(w, "haloyd is shutting down, try again shortly", http.StatusServiceUnavailable)
+				return
+			}
+			response = apitypes.ConfirmActionResponse{
+				Message:      fmt.Sprintf("Rollback of %s started", action.AppName),
+				DeploymentID: req.NewDeploymentID,
+			}
+		case actionRemove:
+			var req stopActionRequest
+			if err := json.Unmarshal(payload.Request, &req); err != nil {
+				httpError(w, fmt.Sprintf("Failed to decode stop request: %v", err), http.StatusInternalServerError)
+				return
+			}
+			s.stopApp(action.AppName, req.RemoveContainers)
+			response = apitypes.ConfirmActionResponse{
+				Message: fmt.Sprintf("Stop operation of %s started. Use 'haloy logs' to monitor progress.", action.AppName),
+			}
+		default:
+			httpError(w, fmt.Sprintf("Unknown action '%s'", action.Action), http.StatusInternalServerError)
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Protected operation confirmed", "app", action.AppName, "action", action.Action, "action_id", actionID,
+			"client_ip", s.clientIP(r))
+		s.eventBroker.Publish(events.Event{
+			Type:         events.TypeActionConfirmed,
+			AppName:      action.AppName,
+			DeploymentID: response.DeploymentID,
+			Data:         map[string]any{"actionID": actionID, "action": action.Action},
+		})
+		encodeJSON(w, http.StatusAccepted, response)
+	}
+}
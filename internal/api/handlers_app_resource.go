@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+// The resource endpoints on /v1/apps/{appName} let tools like Terraform or Pulumi manage apps declaratively:
+// PUT deploys the full desired config unless the app already runs it, GET returns the config in a canonical
+// form that only changes when the desired config changes, and DELETE removes the app. All of them can be
+// repeated safely.
+
+// canonicalAppConfig returns the config of an app as returned by the resource endpoints, and its revision.
+// Secret values are redacted and the settings that only matter to the client that deployed it are dropped,
+// so a config deployed with 'haloy deploy' and the same config sent to PUT have the same revision.
+func canonicalAppConfig(targetConfig config.TargetConfig) (config.TargetConfig, string, error) {
+	canonical, err := targetConfig.Redacted()
+	if err != nil {
+		return config.TargetConfig{}, "", err
+	}
+	canonical.Server = ""
+	canonical.APIToken = nil
+	canonical.Extends = ""
+	canonical.ImageKey = ""
+	canonical.EnvFile = nil
+	canonical.TargetName = ""
+	canonical.Annotations = nil
+	canonical.Format = ""
+	// The autoscaler changes the replicas of the deployment, they're not part of the desired config.
+	if canonical.Autoscale != nil {
+		canonical.Replicas = nil
+	}
+
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return config.TargetConfig{}, "", fmt.Errorf("failed to encode app config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return canonical, hex.EncodeToString(sum[:8]), nil
+}
+
+// appResource returns the state of an app, or nil when it has no containers.
+func appResource(ctx context.Context, appName string) (*apitypes.AppResource, error) {
+	cli, err := docker.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	containerList, err := docker.GetAppContainers(ctx, cli, true, appName)
+	if err != nil {
+		return nil, err
+	}
+	if len(containerList) == 0 {
+		return nil, nil
+	}
+	status, err := getResponse(containerList)
+	if err != nil {
+		return nil, err
+	}
+	paused, err := deploy.PausedApp(appName)
+	if err != nil {
+		return nil, err
+	}
+	if paused != nil {
+		status.State = "paused"
+	}
+
+	resource := &apitypes.AppResource{
+		Name:         appName,
+		DeploymentID: status.DeploymentID,
+		State:        status.State,
+	}
+	spec, err := deploy.LoadSpec(status.DeploymentID)
+	if err != nil {
+		return nil, err
+	}
+	// Deployments made before specs were stored have no config, PUT deploys them again.
+	if spec != nil {
+		resource.Config, resource.Revision, err = canonicalAppConfig(*spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resource, nil
+}
+
+// checkIfMatch writes a 412 response and returns false when the If-Match header of the request doesn't match the
+// revision of the app, so a client only changes the app it read.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current *apitypes.AppResource) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+	if current != nil && (ifMatch == "*" || ifMatch == etag(current.Revision)) {
+		return true
+	}
+	httpError(w, "The app changed since it was read, read it again", http.StatusPreconditionFailed)
+	return false
+}
+
+func etag(revision string) string {
+	return `"` + revision + `"`
+}
+
+func (s *APIServer) handleGetApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		resource, err := appResource(ctx, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if resource == nil {
+			httpError(w, fmt.Sprintf("App '%s' not found", appName), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("ETag", etag(resource.Revision))
+		encodeJSON(w, http.StatusOK, resource)
+	}
+}
+
+// handlePutApp deploys the desired config of an app, unless the app already runs it.
+func (s *APIServer) handlePutApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+
+		var req apitypes.PutAppRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		targetConfig, err := s.resourceTargetConfig(appName, req.Config)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, apitypes.ErrCodeInvalidConfig, fmt.Sprintf("Invalid app configuration: %v", err), nil)
+			return
+		}
+		if !authorizeTarget(w, r, targetConfig) {
+			return
+		}
+		canonical, revision, err := canonicalAppConfig(targetConfig)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		current, err := appResource(ctx, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !checkIfMatch(w, r, current) {
+			return
+		}
+		if current != nil && current.Revision == revision && current.State == "running" {
+			w.Header().Set("ETag", etag(revision))
+			encodeJSON(w, http.StatusOK, apitypes.PutAppResponse{App: *current})
+			return
+		}
+
+		deployReq := apitypes.DeployRequest{
+			DeploymentID:      helpers.NewDeploymentID().String(),
+			TargetConfig:      targetConfig,
+			RollbackAppConfig: req.Config,
+			IgnoreFreeze:      req.IgnoreFreeze,
+		}
+		response := apitypes.PutAppResponse{
+			App: apitypes.AppResource{
+				Name:         appName,
+				Revision:     revision,
+				DeploymentID: deployReq.DeploymentID,
+				State:        "deploying",
+				Config:       canonical,
+			},
+			Changed: true,
+		}
+
+		if !checkDomainConflict(ctx, w, targetConfig) {
+			return
+		}
+		if targetConfig.RequireApproval {
+			s.addPendingDeployment(deployReq)
+			response.App.State = "pending"
+			response.Pending = true
+		} else {
+			queuedUntil, ok := s.holdForFreeze(w, r, deployReq)
+			if !ok {
+				return
+			}
+			if queuedUntil != nil {
+				response.App.State = "queued"
+				response.QueuedUntil = queuedUntil
+			} else if !s.runDeployment(r, deployReq) {
+				httpError(w, "haloyd is shutting down, try again shortly", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		w.Header().Set("ETag", etag(revision))
+		encodeJSON(w, http.StatusAccepted, response)
+	}
+}
+
+// resourceTargetConfig resolves the config sent to PUT like the CLI does before deploying. Settings that need
+// the machine of the CLI, like building images, env files and hooks, aren't supported.
+func (s *APIServer) resourceTargetConfig(appName string, appConfig config.AppConfig) (config.TargetConfig, error) {
+	if len(appConfig.Targets) > 0 {
+		return config.TargetConfig{}, fmt.Errorf("targets aren't supported, put each app separately")
+	}
+	if appConfig.Name == "" {
+		appConfig.Name = appName
+	}
+	if appConfig.Name != appName {
+		return config.TargetConfig{}, fmt.Errorf("name '%s' doesn't match the app '%s' of the URL", appConfig.Name, appName)
+	}
+	if len(appConfig.EnvFile) > 0 {
+		return config.TargetConfig{}, fmt.Errorf("envFile isn't supported, send the variables in env")
+	}
+	if len(appConfig.PreDeploy) > 0 || len(appConfig.PostDeploy) > 0 || len(appConfig.GlobalPreDeploy) > 0 || len(appConfig.GlobalPostDeploy) > 0 {
+		return config.TargetConfig{}, fmt.Errorf("deploy hooks aren't supported, they run on the machine of the CLI")
+	}
+	// The server is where the CLI sends the deployment, it's this server.
+	if appConfig.Server == "" {
+		appConfig.Server = "localhost"
+		if access := s.access.Load(); access != nil && access.config.Domain != "" {
+			appConfig.Server = access.config.Domain
+		}
+	}
+	// The request is already authenticated, the token of the config isn't used.
+	appConfig.APIToken = nil
+	appConfig.Format = "json"
+
+	targets, err := appconfigloader.ExtractTargets(appConfig)
+	if err != nil {
+		return config.TargetConfig{}, err
+	}
+	targetConfig := targets[appName]
+	if targetConfig.Image != nil && targetConfig.Image.ShouldBuild() {
+		return config.TargetConfig{}, fmt.Errorf("building images isn't supported, push the image to a registry and reference it")
+	}
+	if targetConfig.HasUnresolvedValues() {
+		return config.TargetConfig{}, fmt.Errorf("values from the environment or secret providers must be resolved by the client")
+	}
+	if targetConfig.HasMaskedValues() {
+		return config.TargetConfig{}, fmt.Errorf("the config has masked values from 'haloy export', replace them with the values")
+	}
+	if backend := s.proxyBackend.Load(); backend != nil {
+		if err := targetConfig.ValidateProxyBackend(*backend, appConfig.Format); err != nil {
+			return config.TargetConfig{}, err
+		}
+	}
+	return targetConfig, nil
+}
+
+// handleDeleteApp stops an app and removes its containers. Deleting an app without containers succeeds.
+func (s *APIServer) handleDeleteApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		current, err := appResource(ctx, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if current == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !checkIfMatch(w, r, current) {
+			return
+		}
+
+		if s.protects(appName) {
+			action, err := s.holdAction(r, actionRemove, appName, fmt.Sprintf("Delete %s and remove its containers", appName),
+				stopActionRequest{RemoveContainers: true})
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			encodeJSON(w, http.StatusAccepted, apitypes.StopAppResponse{
+				Message:       fmt.Sprintf("Deleting %s needs the confirmation of a second token", appName),
+				PendingAction: action,
+			})
+			return
+		}
+
+		s.stopApp(appName, true)
+		encodeJSON(w, http.StatusAccepted, apitypes.StopAppResponse{
+			Message: fmt.Sprintf("Deleting %s. Use 'haloy logs' to monitor progress.", appName),
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+type pendingDeployment struct {
+	request     apitypes.DeployRequest
+	requestedAt time.Time
+}
+
+// EnableApprovals sets the token that approves deployments of targets with require_approval.
+// Without it, the API token can approve deployments as well.
+func (s *APIServer) EnableApprovals(approveToken string) {
+	s.approveToken = approveToken
+}
+
+// addPendingDeployment holds a deployment until it's approved or rejected.
+func (s *APIServer) addPendingDeployment(req apitypes.DeployRequest) {
+	s.pendingMutex.Lock()
+	s.pending[req.DeploymentID] = pendingDeployment{request: req, requestedAt: time.Now()}
+	s.pendingMutex.Unlock()
+
+	s.eventBroker.Publish(events.Event{
+		Type:         events.TypeDeploymentPending,
+		AppName:      req.TargetConfig.Name,
+		DeploymentID: req.DeploymentID,
+	})
+}
+
+// takePendingDeployment removes a pending deployment and returns it.
+func (s *APIServer) takePendingDeployment(deploymentID string) (pendingDeployment, bool) {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	pending, ok := s.pending[deploymentID]
+	delete(s.pending, deploymentID)
+	return pending, ok
+}
+
+func (s *APIServer) handlePendingDeployments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.pendingMutex.Lock()
+		response := apitypes.PendingDeploymentsResponse{Deployments: make([]apitypes.PendingDeployment, 0, len(s.pending))}
+		for deploymentID, pending := range s.pending {
+			image := ""
+			if pending.request.TargetConfig.Image != nil {
+				image = pending.request.TargetConfig.Image.ImageRef()
+			}
+			response.Deployments = append(response.Deployments, apitypes.PendingDeployment{
+				DeploymentID: deploymentID,
+				AppName:      pending.request.TargetConfig.Name,
+				TargetName:   pending.request.TargetConfig.TargetName,
+				Image:        image,
+				RequestedAt:  pending.requestedAt,
+			})
+		}
+		s.pendingMutex.Unlock()
+
+		slices.SortFunc(response.Deployments, func(a, b apitypes.PendingDeployment) int {
+			return helpers.CompareDeploymentIDs(a.DeploymentID, b.DeploymentID)
+		})
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
+
+func (s *APIServer) handleApproveDeployment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deploymentID := r.PathValue("deploymentID")
+		pending, ok := s.takePendingDeployment(deploymentID)
+		if !ok {
+			httpError(w, "No pending deployment with ID "+deploymentID, http.StatusNotFound)
+			return
+		}
+
+		if r.URL.Query().Get("ignore-freeze") == "true" {
+			pending.request.IgnoreFreeze = true
+		}
+
+		// Put it back when the deployment doesn't start, so it can be approved again.
+		restore := func() {
+			s.pendingMutex.Lock()
+			s.pending[deploymentID] = pending
+			s.pendingMutex.Unlock()
+		}
+
+		if !s.checkFreeze(w, r, pending.request) {
+			if !s.queuesFrozenDeployments() {
+				restore()
+			} else {
+				s.publishApproved(pending.request)
+			}
+			return
+		}
+
+		if !s.runDeployment(r, pending.request) {
+			restore()
+			httpError(w, "haloyd is shutting down, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+
+		s.publishApproved(pending.request)
+		encodeJSON(w, http.StatusAccepted, apitypes.DeployResponse{DeploymentID: deploymentID})
+	}
+}
+
+func (s *APIServer) publishApproved(req apitypes.DeployRequest) {
+	s.eventBroker.Publish(events.Event{
+		Type:         events.TypeDeploymentApproved,
+		AppName:      req.TargetConfig.Name,
+		DeploymentID: req.DeploymentID,
+	})
+}
+
+func (s *APIServer) handleRejectDeployment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deploymentID := r.PathValue("deploymentID")
+		pending, ok := s.takePendingDeployment(deploymentID)
+		if !ok {
+			httpError(w, "No pending deployment with ID "+deploymentID, http.StatusNotFound)
+			return
+		}
+
+		s.eventBroker.Publish(events.Event{
+			Type:         events.TypeDeploymentRejected,
+			AppName:      pending.request.TargetConfig.Name,
+			DeploymentID: deploymentID,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/docker/docker/api/types/container"
+)
+
+// handleApps lists all apps with containers on the server and the status of their latest deployment.
+func (s *APIServer) handleApps() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		containerList, err := docker.GetAppContainers(ctx, cli, true, "")
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		containersByApp := make(map[string][]container.Summary)
+		for _, c := range containerList {
+			appName := c.Labels[config.LabelAppName]
+			containersByApp[appName] = append(containersByApp[appName], c)
+		}
+
+		pausedApps, err := deploy.PausedApps()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := apitypes.AppsResponse{Apps: []apitypes.AppSummary{}}
+		for appName, containers := range containersByApp {
+			if !appAllowed(r, appName) {
+				continue
+			}
+			status, err := getResponse(containers)
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if _, ok := pausedApps[appName]; ok {
+				status.State = "paused"
+			}
+			response.Apps = append(response.Apps, apitypes.AppSummary{
+				Name:         appName,
+				State:        status.State,
+				DeploymentID: status.DeploymentID,
+				Replicas:     len(status.ContainerIDs),
+				Domains:      status.Domains,
+				Labels:       appLabels(containers, status.DeploymentID),
+			})
+		}
+		sort.Slice(response.Apps, func(i, j int) bool {
+			return response.Apps[i].Name < response.Apps[j].Name
+		})
+
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
+
+// appLabels returns the labels from the app config of the containers of a deployment. Containers deployed
+// before the keys were recorded return all their labels except the ones set by haloy.
+func appLabels(containers []container.Summary, deploymentID string) map[string]string {
+	for _, c := range containers {
+		if c.Labels[config.LabelDeploymentID] != deploymentID {
+			continue
+		}
+		labels := make(map[string]string)
+		var keys []string
+		if err := json.Unmarshal([]byte(c.Labels[config.LabelAppLabelKeys]), &keys); err == nil {
+			for _, key := range keys {
+				labels[key] = c.Labels[key]
+			}
+			return labels
+		}
+		for key, value := range c.Labels {
+			if !strings.HasPrefix(key, config.LabelPrefix) {
+				labels[key] = value
+			}
+		}
+		return labels
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/certstore"
+)
+
+// SystemDomainsFunc returns the certificate state of the domains served by haloyd itself, e.g. the API domain.
+type SystemDomainsFunc func() []apitypes.SystemDomainStatus
+
+// SetSystemDomains enables the system domain status in the certificates response.
+func (s *APIServer) SetSystemDomains(systemDomains SystemDomainsFunc) {
+	s.systemDomains.Store(&systemDomains)
+}
+
+// SetCertStore sets the store of the certificates listed in the certificates response.
+func (s *APIServer) SetCertStore(store certstore.CertStore) {
+	s.certStore.Store(&store)
+}
+
+// handleCertificates lists the certificates managed by haloyd and when they expire, and the renewal state of
+// the system domains.
+func (s *APIServer) handleCertificates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var store certstore.CertStore
+		var names []string
+		if loaded := s.certStore.Load(); loaded != nil {
+			store = *loaded
+			var err error
+			if names, err = store.List(); err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		response := apitypes.CertificatesResponse{
+			Certificates:  []apitypes.CertificateStatus{},
+			SystemDomains: []apitypes.SystemDomainStatus{},
+		}
+		if systemDomains := s.systemDomains.Load(); systemDomains != nil {
+			response.SystemDomains = (*systemDomains)()
+		}
+		for _, name := range names {
+			if !strings.HasSuffix(name, ".pem") {
+				continue
+			}
+			data, err := store.Get(name)
+			if err != nil {
+				continue
+			}
+			cert, err := readCertificate(data)
+			if err != nil {
+				continue
+			}
+			response.Certificates = append(response.Certificates, apitypes.CertificateStatus{
+				Domain:   strings.TrimSuffix(name, ".pem"),
+				DNSNames: cert.DNSNames,
+				Issuer:   cert.Issuer.CommonName,
+				NotAfter: cert.NotAfter,
+			})
+		}
+		sort.Slice(response.Certificates, func(i, j int) bool {
+			return response.Certificates[i].Domain < response.Certificates[j].Domain
+		})
+
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
+
+// readCertificate returns the first certificate in combined key and certificate PEM data.
+func readCertificate(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no certificate found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
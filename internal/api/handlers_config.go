@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+)
+
+// handleDeployedConfig returns the resolved config of the current deployment of an app. Secret values
+// are redacted, the CLI compares them by redacting its own values the same way.
+func (s *APIServer) handleDeployedConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		containerList, err := docker.GetAppContainers(ctx, cli, true, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(containerList) == 0 {
+			httpError(w, "No containers found for the specified app", http.StatusNotFound)
+			return
+		}
+
+		status, err := getResponse(containerList)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		spec, err := deploy.LoadSpec(status.DeploymentID)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if spec == nil {
+			httpError(w, fmt.Sprintf("No config stored for deployment %s, redeploy the app to store it", status.DeploymentID), http.StatusNotFound)
+			return
+		}
+
+		redacted, err := spec.Redacted()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		encodeJSON(w, http.StatusOK, apitypes.DeployedConfigResponse{
+			DeploymentID: status.DeploymentID,
+			TargetConfig: redacted,
+		})
+	}
+}
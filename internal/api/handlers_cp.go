@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	// maxCopySize limits the size of archives copied to and from containers.
+	maxCopySize = 512 << 20
+	// copyTimeout is long enough to copy an archive of maxCopySize over a slow connection.
+	copyTimeout = 30 * time.Minute
+)
+
+// handleCopyFromContainer streams a tar archive of a file or directory in a running replica.
+func (s *APIServer) handleCopyFromContainer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName, containerPath, replica, ok := parseCopyRequest(w, r)
+		if !ok {
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+
+		ctx, cancel := context.WithTimeout(r.Context(), copyTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, "Failed to create Docker client", http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		target, err := docker.GetReplicaContainer(ctx, cli, appName, replica)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		reader, stat, err := cli.CopyFromContainer(ctx, target.ID, containerPath)
+		if err != nil {
+			httpError(w, fmt.Sprintf("Failed to copy from container: %v", err), http.StatusNotFound)
+			return
+		}
+		defer reader.Close()
+
+		// The stat size is only known up front for regular files, directories are limited while streaming.
+		if stat.Size > maxCopySize {
+			httpError(w, fmt.Sprintf("%s is %d bytes, which exceeds the limit of %d bytes", containerPath, stat.Size, maxCopySize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.WriteHeader(http.StatusOK)
+		written, err := io.Copy(w, io.LimitReader(reader, maxCopySize))
+
+		logger.Info("Copied from container",
+			"app", appName,
+			"container_id", helpers.SafeIDPrefix(target.ID),
+			"path", containerPath,
+			"bytes", written,
+			"client_ip", s.clientIP(r))
+		if err != nil {
+			logger.Warn("Copy from container was interrupted", "app", appName, "path", containerPath, "error", err)
+		} else if written == maxCopySize {
+			logger.Warn("Copy from container was truncated at the size limit", "app", appName, "path", containerPath, "limit", maxCopySize)
+		}
+	}
+}
+
+// handleCopyToContainer extracts an uploaded tar archive into a directory in a running replica.
+func (s *APIServer) handleCopyToContainer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName, containerPath, replica, ok := parseCopyRequest(w, r)
+		if !ok {
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+
+		ctx, cancel := context.WithTimeout(r.Context(), copyTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, "Failed to create Docker client", http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		target, err := docker.GetReplicaContainer(ctx, cli, appName, replica)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		body := &countingReader{reader: http.MaxBytesReader(w, r.Body, maxCopySize)}
+		if err := cli.CopyToContainer(ctx, target.ID, containerPath, body, container.CopyToContainerOptions{}); err != nil {
+			httpError(w, fmt.Sprintf("Failed to copy to container: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("Copied to container",
+			"app", appName,
+			"container_id", helpers.SafeIDPrefix(target.ID),
+			"path", containerPath,
+			"bytes", body.count,
+			"client_ip", s.clientIP(r))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func parseCopyRequest(w http.ResponseWriter, r *http.Request) (appName, containerPath string, replica int, ok bool) {
+	appName = r.PathValue("appName")
+	if appName == "" {
+		httpError(w, "App name is required", http.StatusBadRequest)
+		return "", "", 0, false
+	}
+
+	containerPath = r.URL.Query().Get("path")
+	if !path.IsAbs(containerPath) {
+		httpError(w, "An absolute container path is required", http.StatusBadRequest)
+		return "", "", 0, false
+	}
+
+	replica = 1
+	if value := r.URL.Query().Get("replica"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			httpError(w, "Replica must be a positive number", http.StatusBadRequest)
+			return "", "", 0, false
+		}
+		replica = parsed
+	}
+
+	return appName, containerPath, replica, true
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/embed"
+)
+
+// EnableDashboard serves the embedded web UI on /dashboard/. The UI is static and
+// loads all data from the token protected API, so it doesn't require authentication itself.
+func (s *APIServer) EnableDashboard() error {
+	dashboardFS, err := fs.Sub(embed.DashboardFS, "dashboard")
+	if err != nil {
+		return fmt.Errorf("failed to load dashboard files: %w", err)
+	}
+
+	fileServer := http.StripPrefix("/dashboard/", http.FileServerFS(dashboardFS))
+	s.router.Handle("GET /dashboard/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		fileServer.ServeHTTP(w, r)
+	}))
+	s.router.Handle("GET /dashboard", http.RedirectHandler("/dashboard/", http.StatusMovedPermanently))
+
+	return nil
+}
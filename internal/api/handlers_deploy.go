@@ -2,13 +2,23 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/deploy"
 	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/tracing"
 )
 
 // handleDeploy returns an http.HandlerFunc for deploying an app.
@@ -17,41 +27,265 @@ func (s *APIServer) handleDeploy() http.HandlerFunc {
 		var req apitypes.DeployRequest
 
 		if err := decodeJSON(r.Body, &req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-
-		if req.DeploymentID == "" {
-			http.Error(w, "Deployment ID is required", http.StatusBadRequest)
+		if !authorizeTarget(w, r, req.TargetConfig) {
+			return
+		}
+		if !resolveImportedSecrets(w, r, &req.TargetConfig) {
 			return
 		}
 
+		// IDs are assigned here, so deployment IDs on the server always sort by creation time.
+		req.DeploymentID = helpers.NewDeploymentID().String()
+
 		if err := req.TargetConfig.Validate(req.TargetConfig.Format); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid app configuration: %v", err), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, apitypes.ErrCodeInvalidConfig, fmt.Sprintf("Invalid app configuration: %v", err), nil)
+			return
+		}
+		if !s.checkProxyBackend(w, req.TargetConfig) {
+			return
+		}
+
+		if !checkDomainConflict(r.Context(), w, req.TargetConfig) {
 			return
 		}
 
-		deploymentLogger := logging.NewDeploymentLogger(req.DeploymentID, s.logLevel, s.logBroker)
+		if req.TargetConfig.RequireApproval {
+			s.addPendingDeployment(req)
+			encodeJSON(w, http.StatusAccepted, apitypes.DeployResponse{DeploymentID: req.DeploymentID, Pending: true})
+			return
+		}
 
-		go func() {
-			ctx := context.Background()
-			ctx, cancel := context.WithTimeout(ctx, defaultContextTimeout)
-			defer cancel()
+		if !s.checkFreeze(w, r, req) {
+			return
+		}
 
-			cli, err := docker.NewClient(ctx)
-			if err != nil {
-				deploymentLogger.Error("Failed to create Docker client", "error", err)
+		if !s.runDeployment(r, req) {
+			httpError(w, "haloyd is shutting down, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+
+		encodeJSON(w, http.StatusAccepted, apitypes.DeployResponse{DeploymentID: req.DeploymentID})
+	}
+}
+
+// runDeployment deploys the app in the background. It returns false when the server is draining.
+func (s *APIServer) runDeployment(r *http.Request, req apitypes.DeployRequest) bool {
+	if !s.startDeployment() {
+		return false
+	}
+	s.setActiveApp(req.DeploymentID, req.TargetConfig.Name)
+
+	logging.SetCorrelationID(req.DeploymentID, logging.CorrelationIDFromContext(r.Context()))
+	deploymentLogger := logging.NewDeploymentLogger(req.DeploymentID, s.logLevel, s.logBroker)
+	deploymentCtx := tracing.StartDeployment(r, req.DeploymentID, req.TargetConfig.Name)
+
+	startedEvent := events.Event{
+		Type:         events.TypeDeploymentStarted,
+		AppName:      req.TargetConfig.Name,
+		DeploymentID: req.DeploymentID,
+	}
+	if len(req.TargetConfig.Annotations) > 0 || len(req.TargetConfig.Labels) > 0 {
+		startedEvent.Data = map[string]any{}
+		if len(req.TargetConfig.Annotations) > 0 {
+			startedEvent.Data["annotations"] = req.TargetConfig.Annotations
+		}
+		if len(req.TargetConfig.Labels) > 0 {
+			startedEvent.Data["labels"] = req.TargetConfig.Labels
+		}
+	}
+	s.eventBroker.Publish(startedEvent)
+
+	go func() {
+		defer s.deployments.Done()
+		defer s.setActiveApp(req.DeploymentID, "")
+		ctx, cancel := context.WithTimeout(deploymentCtx, defaultContextTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			deploymentLogger.Error("Failed to create Docker client", "error", err)
+			return
+		}
+		defer cli.Close()
+
+		if err := deploy.DeployApp(ctx, cli, req.DeploymentID, req.TargetConfig, req.RollbackAppConfig, deploymentLogger); err != nil {
+			logging.LogDeploymentFailed(deploymentLogger, req.DeploymentID, req.TargetConfig.Name, "Deployment failed", err)
+			tracing.EndDeployment(req.DeploymentID, err)
+			s.eventBroker.Publish(events.Event{
+				Type:         events.TypeDeploymentFailed,
+				AppName:      req.TargetConfig.Name,
+				DeploymentID: req.DeploymentID,
+				Data:         map[string]any{"error": err.Error()},
+			})
+			return
+		}
+	}()
+
+	return true
+}
+
+// checkDomainConflict writes an ERR_DOMAIN_CONFLICT error and returns false when a running container of
+// another app serves one of the domains of targetConfig, HAProxy would route the domain to either app.
+func checkDomainConflict(ctx context.Context, w http.ResponseWriter, targetConfig config.TargetConfig) bool {
+	if len(targetConfig.Domains) == 0 {
+		return true
+	}
+
+	cli, err := docker.NewClient(ctx)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Failed to create Docker client: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	defer cli.Close()
+
+	containers, err := docker.GetAppContainers(ctx, cli, false, "")
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	wanted := make(map[string]bool)
+	for _, domain := range targetConfig.Domains {
+		wanted[strings.ToLower(domain.Canonical)] = true
+		for _, alias := range domain.Aliases {
+			wanted[strings.ToLower(alias)] = true
+		}
+	}
+
+	for _, c := range containers {
+		labels, err := config.ParseContainerLabels(c.Labels)
+		if err != nil || labels.AppName == targetConfig.Name {
+			continue
+		}
+		for _, domain := range labels.Domains {
+			for _, name := range append([]string{domain.Canonical}, domain.Aliases...) {
+				if wanted[strings.ToLower(name)] {
+					writeError(w, http.StatusConflict, apitypes.ErrCodeDomainConflict,
+						fmt.Sprintf("Domain %s is already served by app '%s'", name, labels.AppName),
+						map[string]any{"domain": name, "app": labels.AppName})
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// handleDeployDryRun checks a deployment without changing anything: the image is pulled and checked,
+// and the container spec and the HAProxy config changes are returned. No containers are created.
+func (s *APIServer) handleDeployDryRun() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req apitypes.DeployRequest
+
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !authorizeTarget(w, r, req.TargetConfig) {
+			return
+		}
+		if !resolveImportedSecrets(w, r, &req.TargetConfig) {
+			return
+		}
+
+		// IDs are assigned here, so deployment IDs on the server always sort by creation time.
+		req.DeploymentID = helpers.NewDeploymentID().String()
+
+		targetConfig := req.TargetConfig
+		if err := targetConfig.Validate(targetConfig.Format); err != nil {
+			writeError(w, http.StatusBadRequest, apitypes.ErrCodeInvalidConfig, fmt.Sprintf("Invalid app configuration: %v", err), nil)
+			return
+		}
+		if !s.checkProxyBackend(w, targetConfig) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, fmt.Sprintf("Failed to create Docker client: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		if !checkDomainConflict(ctx, w, targetConfig) {
+			return
+		}
+
+		imageRef := targetConfig.Image.ImageRef()
+		if err := docker.EnsureImageUpToDate(ctx, cli, slog.New(slog.DiscardHandler), *targetConfig.Image); err != nil {
+			httpError(w, fmt.Sprintf("Image check failed: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := docker.CheckImagePlatformCompatibility(ctx, cli, imageRef); err != nil {
+			var mismatch *docker.PlatformMismatchError
+			if errors.As(err, &mismatch) {
+				writeError(w, http.StatusBadRequest, apitypes.ErrCodeImagePlatformMismatch, fmt.Sprintf("Image check failed: %v", err),
+					map[string]any{"imagePlatform": mismatch.ImagePlatform, "hostPlatform": mismatch.HostPlatform})
 				return
 			}
-			defer cli.Close()
+			httpError(w, fmt.Sprintf("Image check failed: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		spec, err := docker.BuildAppContainerSpec(req.DeploymentID, targetConfig)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		replicas := 1
+		if targetConfig.Replicas != nil {
+			replicas = *targetConfig.Replicas
+		}
+		response := apitypes.DryRunResponse{Image: imageRef}
+		for i := range replicas {
+			env := make([]string, 0, len(spec.Env)+1)
+			for _, envVar := range spec.Env {
+				name, _, _ := strings.Cut(envVar, "=")
+				env = append(env, name)
+			}
+			env = append(env, constants.EnvVarReplicaID)
+
+			response.Containers = append(response.Containers, apitypes.DryRunContainer{
+				Name:       docker.AppContainerName(targetConfig.Name, req.DeploymentID, i+1, replicas),
+				Labels:     spec.Labels,
+				Env:        env,
+				Network:    string(spec.HostConfig.NetworkMode),
+				Networks:   targetConfig.Networks,
+				Volumes:    spec.HostConfig.Binds,
+				DNS:        spec.HostConfig.DNS,
+				DNSSearch:  spec.HostConfig.DNSSearch,
+				ExtraHosts: spec.HostConfig.ExtraHosts,
+			})
+		}
+
+		if targetConfig.DeploymentStrategy == config.DeploymentStrategyReplace {
+			response.Warnings = append(response.Warnings, fmt.Sprintf("The running containers of %s are stopped before the new ones start", targetConfig.Name))
+		}
 
-			if err := deploy.DeployApp(ctx, cli, req.DeploymentID, req.TargetConfig, req.RollbackAppConfig, deploymentLogger); err != nil {
-				logging.LogDeploymentFailed(deploymentLogger, req.DeploymentID, req.TargetConfig.Name, "Deployment failed", err)
+		if preview := s.haproxyPreview.Load(); preview != nil {
+			labels, err := config.ParseContainerLabels(spec.Labels)
+			if err != nil {
+				httpError(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-		}()
+			current, next, err := (*preview)(labels, replicas)
+			if err != nil {
+				httpError(w, fmt.Sprintf("Failed to render HAProxy config: %v", err), http.StatusInternalServerError)
+				return
+			}
+			response.HAProxyDiff = helpers.UnifiedDiff("haproxy.cfg", "haproxy.cfg (after deploy)", current, next)
+		} else {
+			response.Warnings = append(response.Warnings, "HAProxy config preview is not available yet, haloyd is starting")
+		}
 
-		w.WriteHeader(http.StatusAccepted)
+		encodeJSON(w, http.StatusOK, response)
 	}
 }
 
@@ -60,17 +294,20 @@ func (s *APIServer) handleDeploymentLogs() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		deploymentID := r.PathValue("deploymentID")
 		if deploymentID == "" {
-			http.Error(w, "deployment ID is required", http.StatusBadRequest)
+			httpError(w, "deployment ID is required", http.StatusBadRequest)
+			return
+		}
+		if !s.authorizeDeployment(w, r, deploymentID) {
 			return
 		}
 
-		// Subscribe to logs for this deployment ID
+		// Subscribe to logs for this deployment ID, a reconnecting client gets the entries it missed.
 		// Don't pass request context - use background context with manual cleanup
-		logChan := s.logBroker.SubscribeDeployment(deploymentID)
+		logChan, subscriberID := s.logBroker.SubscribeDeployment(deploymentID, lastEventID(r))
 
 		streamConfig := sseStreamConfig{
 			logChan: logChan,
-			cleanup: func() { s.logBroker.UnsubscribeDeployment(deploymentID) },
+			cleanup: func() { s.logBroker.UnsubscribeDeployment(deploymentID, subscriberID) },
 			shouldTerminate: func(logEntry logging.LogEntry) bool {
 				return logEntry.IsDeploymentComplete || logEntry.IsDeploymentFailed
 			},
@@ -79,3 +316,117 @@ func (s *APIServer) handleDeploymentLogs() http.HandlerFunc {
 		streamSSELogs(w, r, streamConfig)
 	}
 }
+
+// handleDeploymentLogHistory returns the stored logs of a deployment, also after it finished.
+func (s *APIServer) handleDeploymentLogHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deploymentID := r.PathValue("deploymentID")
+		if deploymentID == "" {
+			httpError(w, "deployment ID is required", http.StatusBadRequest)
+			return
+		}
+		if !s.authorizeDeployment(w, r, deploymentID) {
+			return
+		}
+
+		entries, ok := s.deploymentLogEntries(w, deploymentID)
+		if !ok {
+			return
+		}
+
+		encodeJSON(w, http.StatusOK, apitypes.DeploymentLogsResponse{DeploymentID: deploymentID, Entries: entries})
+	}
+}
+
+// handleDeploymentLogDownload returns the full log of a deployment as a file. The format query parameter
+// selects "text" (default), "ndjson" with one entry per line, or "json" with an array of entries.
+func (s *APIServer) handleDeploymentLogDownload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deploymentID := r.PathValue("deploymentID")
+		if deploymentID == "" {
+			httpError(w, "deployment ID is required", http.StatusBadRequest)
+			return
+		}
+		if !s.authorizeDeployment(w, r, deploymentID) {
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = apitypes.LogFormatText
+		}
+		ext, contentType, ok := logFileType(format)
+		if !ok {
+			httpError(w, fmt.Sprintf("Invalid format '%s', must be %s, %s or %s", format, apitypes.LogFormatText, apitypes.LogFormatNDJSON, apitypes.LogFormatJSON), http.StatusBadRequest)
+			return
+		}
+
+		entries, ok := s.deploymentLogEntries(w, deploymentID)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, deploymentID, ext))
+		switch format {
+		case apitypes.LogFormatJSON:
+			json.NewEncoder(w).Encode(entries)
+		case apitypes.LogFormatNDJSON:
+			encoder := json.NewEncoder(w)
+			for _, entry := range entries {
+				if err := encoder.Encode(entry); err != nil {
+					return
+				}
+			}
+		default:
+			for _, entry := range entries {
+				if _, err := fmt.Fprintln(w, entry.String()); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func logFileType(format string) (ext, contentType string, ok bool) {
+	switch format {
+	case apitypes.LogFormatText:
+		return ".log", "text/plain; charset=utf-8", true
+	case apitypes.LogFormatNDJSON:
+		return ".ndjson", "application/x-ndjson", true
+	case apitypes.LogFormatJSON:
+		return ".json", "application/json", true
+	default:
+		return "", "", false
+	}
+}
+
+// deploymentLogEntries returns the stored logs of a deployment together with the buffered entries that
+// aren't stored yet, ordered as they were logged. It writes an error response and returns false when
+// there are none.
+func (s *APIServer) deploymentLogEntries(w http.ResponseWriter, deploymentID string) ([]logging.LogEntry, bool) {
+	entries, err := deploy.DeploymentLogs(deploymentID)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Failed to get deployment logs: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	stored := make(map[uint64]bool, len(entries))
+	for _, entry := range entries {
+		stored[entry.Seq] = true
+	}
+	for _, entry := range s.logBroker.DeploymentLogs(deploymentID) {
+		if !stored[entry.Seq] {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		httpError(w, fmt.Sprintf("No logs found for deployment %s, it may not exist or its logs were pruned", deploymentID), http.StatusNotFound)
+		return nil, false
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+	return entries, true
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+const maxDeployHookBody = 1 << 20
+
+// deployHookEvent is what a webhook asks for. When deploy is false, ignored says why.
+type deployHookEvent struct {
+	deploy      bool
+	tag         string
+	ignored     string
+	annotations map[string]string
+}
+
+// handleDeployHook redeploys an app with the deploy_webhook of its current deployment, e.g. on a push to
+// a branch or when an image tag is pushed. The webhook is authenticated by its signature instead of a token.
+func (s *APIServer) handleDeployHook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDeployHookBody))
+		if err != nil {
+			httpError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		currentID, spec, err := currentSpec(ctx, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if spec == nil || spec.DeployWebhook == nil || spec.Image == nil {
+			httpError(w, fmt.Sprintf("App '%s' has no deploy webhook", appName), http.StatusNotFound)
+			return
+		}
+		hook := spec.DeployWebhook
+
+		if !verifyDeployHook(r, hook, body) {
+			s.authFailed(r)
+			httpError(w, "Invalid webhook signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event deployHookEvent
+		switch hook.Provider {
+		case config.DeployWebhookGitHub:
+			event, err = githubHookEvent(r, hook, spec.Image, body)
+		case config.DeployWebhookGitLab:
+			event, err = gitlabHookEvent(r, hook, spec.Image, body)
+		default:
+			event, err = registryHookEvent(hook, spec.Image, body)
+		}
+		if err != nil {
+			httpError(w, fmt.Sprintf("Invalid webhook payload: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !event.deploy {
+			encodeJSON(w, http.StatusOK, apitypes.DeployHookResponse{Message: event.ignored})
+			return
+		}
+
+		req := redeployRequest(currentID, *spec, event.tag, event.annotations)
+		response := apitypes.DeployHookResponse{
+			Message:      fmt.Sprintf("Deploying %s", appName),
+			DeploymentID: req.DeploymentID,
+			Image:        req.TargetConfig.Image.ImageRef(),
+		}
+		if spec.RequireApproval {
+			s.addPendingDeployment(req)
+			response.Message = fmt.Sprintf("The deployment of %s waits for approval", appName)
+			response.Pending = true
+		} else {
+			queuedUntil, ok := s.holdForFreeze(w, r, req)
+			if !ok {
+				return
+			}
+			if queuedUntil != nil {
+				response.Message = fmt.Sprintf("Deployments are frozen, %s is deployed when the freeze ends", appName)
+				response.QueuedUntil = queuedUntil
+			} else if !s.runDeployment(r, req) {
+				httpError(w, "haloyd is shutting down, try again shortly", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		logging.NewLogger(s.logLevel, s.logBroker).Info("Deploy webhook received",
+			"app", appName, "provider", hook.Provider, "image", response.Image, "deploymentID", req.DeploymentID)
+		encodeJSON(w, http.StatusAccepted, response)
+	}
+}
+
+// currentSpec returns the ID and the stored spec of the current deployment of an app. The spec is nil when
+// the app has no containers or its deployment has no stored spec.
+func currentSpec(ctx context.Context, appName string) (string, *config.TargetConfig, error) {
+	cli, err := docker.NewClient(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer cli.Close()
+
+	containerList, err := docker.GetAppContainers(ctx, cli, true, appName)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(containerList) == 0 {
+		return "", nil, nil
+	}
+	status, err := getResponse(containerList)
+	if err != nil {
+		return "", nil, err
+	}
+	spec, err := deploy.LoadSpec(status.DeploymentID)
+	if err != nil {
+		return "", nil, err
+	}
+	return status.DeploymentID, spec, nil
+}
+
+// redeployRequest deploys the config of the current deployment again with another image tag. The app config
+// stored in the deployment history is updated the same way, so a rollback to the new deployment keeps the tag.
+func redeployRequest(currentID string, spec config.TargetConfig, tag string, annotations map[string]string) apitypes.DeployRequest {
+	image := *spec.Image
+	image.Tag = tag
+	spec.Image = &image
+	spec.Annotations = annotations
+
+	rawAppConfig, err := deploy.LoadAppConfigHistory(currentID)
+	if err != nil {
+		// Apps deployed without history are deployed from the resolved spec.
+		rawAppConfig = config.AppConfig{TargetConfig: spec}
+	}
+	if rawAppConfig.Image != nil {
+		rawImage := *rawAppConfig.Image
+		rawImage.Tag = tag
+		rawAppConfig.Image = &rawImage
+	}
+	rawAppConfig.Annotations = annotations
+
+	return apitypes.DeployRequest{
+		DeploymentID:      helpers.NewDeploymentID().String(),
+		TargetConfig:      spec,
+		RollbackAppConfig: rawAppConfig,
+	}
+}
+
+// verifyDeployHook checks the HMAC-SHA256 signature of GitHub and registry webhooks in the X-Hub-Signature-256
+// header, and the secret token of GitLab webhooks.
+func verifyDeployHook(r *http.Request, hook *config.DeployWebhook, body []byte) bool {
+	if hook.Secret.Value == "" {
+		return false
+	}
+	if hook.Provider == config.DeployWebhookGitLab {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(hook.Secret.Value)) == 1
+	}
+
+	signature, found := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !found {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(hook.Secret.Value))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+type githubPackage struct {
+	Name           string `json:"name"`
+	PackageVersion struct {
+		ContainerMetadata struct {
+			Tag struct {
+				Name string `json:"name"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+type githubHookPayload struct {
+	Ref     string `json:"ref"`
+	After   string `json:"after"`
+	Deleted bool   `json:"deleted"`
+	Action  string `json:"action"`
+	// Package is set on package events and RegistryPackage on registry_package events, both are sent when
+	// an image is pushed to the GitHub Container Registry.
+	Package         *githubPackage `json:"package"`
+	RegistryPackage *githubPackage `json:"registry_package"`
+}
+
+func githubHookEvent(r *http.Request, hook *config.DeployWebhook, image *config.Image, body []byte) (deployHookEvent, error) {
+	eventType := r.Header.Get("X-GitHub-Event")
+	if eventType == "ping" {
+		return deployHookEvent{ignored: "pong"}, nil
+	}
+
+	var payload githubHookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return deployHookEvent{}, err
+	}
+
+	switch eventType {
+	case "push":
+		if payload.Deleted {
+			return deployHookEvent{ignored: fmt.Sprintf("%s was deleted", payload.Ref)}, nil
+		}
+		return refHookEvent(hook, image, payload.Ref, payload.After), nil
+	case "package", "registry_package":
+		pkg := payload.Package
+		if pkg == nil {
+			pkg = payload.RegistryPackage
+		}
+		if pkg == nil || payload.Action != "published" {
+			return deployHookEvent{ignored: fmt.Sprintf("Ignored %s event with action '%s'", eventType, payload.Action)}, nil
+		}
+		return imageTagHookEvent(hook, image, pkg.Name, pkg.PackageVersion.ContainerMetadata.Tag.Name), nil
+	default:
+		return deployHookEvent{ignored: fmt.Sprintf("Ignored %s event", eventType)}, nil
+	}
+}
+
+type gitlabHookPayload struct {
+	Ref         string `json:"ref"`
+	CheckoutSHA string `json:"checkout_sha"`
+}
+
+func gitlabHookEvent(r *http.Request, hook *config.DeployWebhook, image *config.Image, body []byte) (deployHookEvent, error) {
+	eventType := r.Header.Get("X-Gitlab-Event")
+	if eventType != "Push Hook" && eventType != "Tag Push Hook" {
+		return deployHookEvent{ignored: fmt.Sprintf("Ignored %s event", eventType)}, nil
+	}
+
+	var payload gitlabHookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return deployHookEvent{}, err
+	}
+	// GitLab sends no checkout SHA when a branch or tag is deleted.
+	if payload.CheckoutSHA == "" {
+		return deployHookEvent{ignored: fmt.Sprintf("%s was deleted", payload.Ref)}, nil
+	}
+	return refHookEvent(hook, image, payload.Ref, payload.CheckoutSHA), nil
+}
+
+// refHookEvent deploys the current image tag on a push to the branch of the webhook, and git tags matching its
+// tags as the image tag.
+func refHookEvent(hook *config.DeployWebhook, image *config.Image, ref, commit string) deployHookEvent {
+	annotations := map[string]string{"webhook": hook.Provider}
+	if commit != "" {
+		annotations["git.commit"] = commit
+	}
+
+	if branch, found := strings.CutPrefix(ref, "refs/heads/"); found {
+		if hook.Branch == "" || branch != hook.Branch {
+			return deployHookEvent{ignored: fmt.Sprintf("Push to branch %s doesn't deploy the app", branch)}
+		}
+		annotations["git.branch"] = branch
+		return deployHookEvent{deploy: true, tag: image.Tag, annotations: annotations}
+	}
+	if tag, found := strings.CutPrefix(ref, "refs/tags/"); found {
+		if !hook.MatchesTag(tag) {
+			return deployHookEvent{ignored: fmt.Sprintf("Tag %s doesn't match '%s'", tag, hook.Tags)}
+		}
+		return deployHookEvent{deploy: true, tag: tag, annotations: annotations}
+	}
+	return deployHookEvent{ignored: fmt.Sprintf("Ignored push to %s", ref)}
+}
+
+type registryHookPayload struct {
+	// Events are sent by registries implementing the notifications of the Distribution registry.
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+	} `json:"events"`
+	// PushData and Repository are sent by Docker Hub.
+	PushData *struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository *struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+}
+
+func registryHookEvent(hook *config.DeployWebhook, image *config.Image, body []byte) (deployHookEvent, error) {
+	var payload registryHookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return deployHookEvent{}, err
+	}
+
+	if payload.PushData != nil && payload.Repository != nil {
+		return imageTagHookEvent(hook, image, payload.Repository.RepoName, payload.PushData.Tag), nil
+	}
+	event := deployHookEvent{ignored: "No image push in the event"}
+	for _, notification := range payload.Events {
+		if notification.Action != "push" || notification.Target.Tag == "" {
+			continue
+		}
+		// The last matching push wins when a notification has several.
+		if candidate := imageTagHookEvent(hook, image, notification.Target.Repository, notification.Target.Tag); candidate.deploy || !event.deploy {
+			event = candidate
+		}
+	}
+	return event, nil
+}
+
+// imageTagHookEvent deploys a tag pushed to the repository of the app when it matches the tags of the webhook.
+func imageTagHookEvent(hook *config.DeployWebhook, image *config.Image, repository, tag string) deployHookEvent {
+	if !sameRepository(image.Repository, repository) {
+		return deployHookEvent{ignored: fmt.Sprintf("%s isn't the image of the app", repository)}
+	}
+	if !hook.MatchesTag(tag) {
+		return deployHookEvent{ignored: fmt.Sprintf("Tag %s doesn't match '%s'", tag, hook.Tags)}
+	}
+	return deployHookEvent{deploy: true, tag: tag, annotations: map[string]string{"webhook": hook.Provider}}
+}
+
+// sameRepository reports whether a repository named by a webhook, which may leave out the registry and the
+// owner, is the repository of the image, e.g. "app" or "org/app" for "ghcr.io/org/app".
+func sameRepository(imageRepository, repository string) bool {
+	imageRepository = strings.TrimPrefix(strings.TrimPrefix(imageRepository, "docker.io/"), "library/")
+	repository = strings.TrimPrefix(repository, "library/")
+	if repository == "" {
+		return false
+	}
+	return imageRepository == repository || strings.HasSuffix(imageRepository, "/"+repository)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/config"
+)
+
+func TestVerifyDeployHook(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	sign := func(secret string, body []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		secret   string
+		headers  map[string]string
+		expected bool
+	}{
+		{name: "github valid", provider: config.DeployWebhookGitHub, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": sign(secret, body)}, expected: true},
+		{name: "github wrong secret", provider: config.DeployWebhookGitHub, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": sign("other", body)}},
+		{name: "github other body", provider: config.DeployWebhookGitHub, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": sign(secret, []byte(`{"ref":"refs/heads/dev"}`))}},
+		{name: "github not hex", provider: config.DeployWebhookGitHub, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=zz"}},
+		{name: "github without prefix", provider: config.DeployWebhookGitHub, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": strings.TrimPrefix(sign(secret, body), "sha256=")}},
+		{name: "github missing signature", provider: config.DeployWebhookGitHub, secret: secret},
+		{name: "github with gitlab token", provider: config.DeployWebhookGitHub, secret: secret,
+			headers: map[string]string{"X-Gitlab-Token": secret}},
+		{name: "gitlab valid", provider: config.DeployWebhookGitLab, secret: secret,
+			headers: map[string]string{"X-Gitlab-Token": secret}, expected: true},
+		{name: "gitlab wrong token", provider: config.DeployWebhookGitLab, secret: secret,
+			headers: map[string]string{"X-Gitlab-Token": "other"}},
+		{name: "gitlab missing token", provider: config.DeployWebhookGitLab, secret: secret},
+		{name: "gitlab with signature", provider: config.DeployWebhookGitLab, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": sign(secret, body)}},
+		{name: "registry valid", provider: config.DeployWebhookRegistry, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": sign(secret, body)}, expected: true},
+		{name: "registry wrong secret", provider: config.DeployWebhookRegistry, secret: secret,
+			headers: map[string]string{"X-Hub-Signature-256": sign("other", body)}},
+		{name: "registry missing signature", provider: config.DeployWebhookRegistry, secret: secret},
+		{name: "registry with gitlab token", provider: config.DeployWebhookRegistry, secret: secret,
+			headers: map[string]string{"X-Gitlab-Token": secret}},
+		{name: "empty secret", provider: config.DeployWebhookGitLab, headers: map[string]string{"X-Gitlab-Token": ""}},
+		{name: "empty secret signed", provider: config.DeployWebhookGitHub,
+			headers: map[string]string{"X-Hub-Signature-256": sign("", body)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/hooks/deploy/shop-web", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			hook := &config.DeployWebhook{Provider: tt.provider, Secret: config.ValueSource{Value: tt.secret}}
+			if result := verifyDeployHook(r, hook, body); result != tt.expected {
+				t.Errorf("verifyDeployHook() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/events"
+)
+
+// handleEvents streams structured server events as Server-Sent Events.
+// Events can be filtered with the comma-separated "type" and the "app" query parameters.
+func (s *APIServer) handleEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := events.Filter{AppName: r.URL.Query().Get("app")}
+		if types := r.URL.Query().Get("type"); types != "" {
+			filter.Types = strings.Split(types, ",")
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			httpError(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		eventChan, subscriberID := s.eventBroker.Subscribe()
+		defer s.eventBroker.Unsubscribe(subscriberID)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		keepaliveTicker := time.NewTicker(30 * time.Second)
+		defer keepaliveTicker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-keepaliveTicker.C:
+				if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+					return
+				}
+				flusher.Flush()
+
+			case event, ok := <-eventChan:
+				if !ok {
+					return
+				}
+				if !filter.Match(event) {
+					continue
+				}
+
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
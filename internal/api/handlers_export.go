@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+)
+
+// handleExport returns the app config of the current deployment of an app. The config stored in the
+// deployment history keeps references to secret providers, literal secret values are masked unless
+// the values query parameter is true. Apps deployed without history are exported from the resolved
+// deployment spec.
+func (s *APIServer) handleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+		includeValues := r.URL.Query().Get("values") == "true"
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		containerList, err := docker.GetAppContainers(ctx, cli, true, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(containerList) == 0 {
+			httpError(w, "No containers found for the specified app", http.StatusNotFound)
+			return
+		}
+
+		status, err := getResponse(containerList)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := apitypes.ExportResponse{DeploymentID: status.DeploymentID}
+		if appConfig, err := deploy.LoadAppConfigHistory(status.DeploymentID); err == nil {
+			response.AppConfig = appConfig
+		} else {
+			spec, err := deploy.LoadSpec(status.DeploymentID)
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if spec == nil {
+				httpError(w, "No config stored for the current deployment, redeploy the app to store it", http.StatusNotFound)
+				return
+			}
+			response.AppConfig = config.AppConfig{TargetConfig: *spec}
+			response.Resolved = true
+		}
+
+		if !includeValues {
+			masked, err := response.AppConfig.TargetConfig.Masked()
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			response.AppConfig.TargetConfig = masked
+		}
+		response.AppConfig.Annotations = nil
+
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+// HAProxyStatsFunc returns the current metrics of all HAProxy backends by backend name.
+type HAProxyStatsFunc func(ctx context.Context) (map[string]apitypes.HAProxyBackendStats, error)
+
+// SetHAProxyStats enables the parsed HAProxy stats of /v1/haproxy/stats?format=json and of the app status.
+func (s *APIServer) SetHAProxyStats(stats HAProxyStatsFunc) {
+	s.haproxyStats.Store(&stats)
+}
+
+// EnableHAProxyStatsPage proxies the HAProxy stats page on /v1/haproxy/stats. The password is the one the
+// stats frontend of HAProxy was configured with.
+func (s *APIServer) EnableHAProxyStatsPage(password string) {
+	target := &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(constants.HAProxyContainerName, constants.HAProxyStatsPagePort),
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		// Replaces the API token, which must not reach HAProxy.
+		r.SetBasicAuth(constants.HAProxyStatsPageUser, password)
+	}
+	s.haproxyStatsPage = proxy
+}
+
+// handleHAProxyStats serves the HAProxy stats page, or the metrics of all backends and their servers
+// with ?format=json. The JSON variant is available without proxy.stats.
+func (s *APIServer) handleHAProxyStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "json" {
+			if s.haproxyStatsPage == nil {
+				httpError(w, "The HAProxy stats page is disabled, enable it with proxy.stats in the haloyd config", http.StatusNotFound)
+				return
+			}
+			s.haproxyStatsPage.ServeHTTP(w, r)
+			return
+		}
+
+		stats := s.haproxyStats.Load()
+		if stats == nil {
+			httpError(w, "HAProxy stats are not available yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		backends, err := (*stats)(ctx)
+		if err != nil {
+			httpError(w, fmt.Sprintf("Failed to read HAProxy stats: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		response := apitypes.HAProxyStatsResponse{
+			Backends: slices.SortedFunc(maps.Values(backends), func(a, b apitypes.HAProxyBackendStats) int {
+				return strings.Compare(a.Name, b.Name)
+			}),
+		}
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
@@ -1,18 +1,49 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/constants"
 )
 
-// handleHealth returns a simple health check endpoint
+// readinessTimeout bounds the checks of a /readyz request.
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheckFunc returns an error while the part of haloyd it checks isn't ready.
+type ReadinessCheckFunc func(ctx context.Context) error
+
+type readinessCheck struct {
+	name  string
+	check ReadinessCheckFunc
+}
+
+// AddReadinessCheck adds a check to /readyz, name identifies it in the response. The Docker connection is
+// always checked.
+func (s *APIServer) AddReadinessCheck(name string, check ReadinessCheckFunc) {
+	s.readinessMutex.Lock()
+	defer s.readinessMutex.Unlock()
+	s.readinessChecks = append(s.readinessChecks, readinessCheck{name: name, check: check})
+}
+
+// isHealthPath reports whether path is a health endpoint. They're polled, so requests to them aren't logged.
+func isHealthPath(path string) bool {
+	return path == "/health" || path == "/livez" || path == "/readyz"
+}
+
+// handleHealth returns a simple health check endpoint. The status is degraded while the Docker daemon is
+// unreachable, haloyd itself still answers so it isn't reported as down.
 func (s *APIServer) handleHealth() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		status := "ok"
+		if !s.dockerConnection().Connected {
+			status = "degraded"
+		}
 		response := apitypes.HealthResponse{
-			Status:  "ok",
+			Status:  status,
 			Service: "haloyd",
 			Version: constants.Version,
 		}
@@ -21,8 +52,62 @@ func (s *APIServer) handleHealth() http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			httpError(w, "Failed to encode response", http.StatusInternalServerError)
 			return
 		}
 	}
 }
+
+// handleLiveness reports that the haloyd process is up and serving requests.
+func (s *APIServer) handleLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encodeJSON(w, http.StatusOK, apitypes.HealthResponse{
+			Status:  "ok",
+			Service: "haloyd",
+			Version: constants.Version,
+		})
+	}
+}
+
+// handleReadiness reports whether haloyd can handle deployments, with status 503 while a check fails.
+func (s *APIServer) handleReadiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		docker := apitypes.ReadinessCheck{Name: "docker", Ready: true}
+		if status := s.dockerConnection(); !status.Connected {
+			docker.Ready = false
+			docker.Error = "the Docker daemon is unreachable"
+			if status.Error != "" {
+				docker.Error += ": " + status.Error
+			}
+		}
+		response := apitypes.ReadinessResponse{
+			Status:  "ready",
+			Version: constants.Version,
+			Checks:  []apitypes.ReadinessCheck{docker},
+		}
+
+		s.readinessMutex.Lock()
+		checks := s.readinessChecks
+		s.readinessMutex.Unlock()
+		for _, c := range checks {
+			result := apitypes.ReadinessCheck{Name: c.name, Ready: true}
+			if err := c.check(ctx); err != nil {
+				result.Ready = false
+				result.Error = err.Error()
+			}
+			response.Checks = append(response.Checks, result)
+		}
+
+		status := http.StatusOK
+		for _, check := range response.Checks {
+			if !check.Ready {
+				response.Status = "not_ready"
+				status = http.StatusServiceUnavailable
+			}
+		}
+		encodeJSON(w, status, response)
+	}
+}
@@ -2,42 +2,54 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/logging"
 )
 
-// handleImageUpload handles uploading Docker image tar files
+// handleImageUpload handles uploading Docker image tar files in a single multipart request.
+// Kept for older clients, current clients use the resumable upload endpoints.
 func (s *APIServer) handleImageUpload() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Parse multipart form (32MB max memory)
 		if err := r.ParseMultipartForm(32 << 20); err != nil {
-			http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+			httpError(w, "Failed to parse multipart form", http.StatusBadRequest)
 			return
 		}
 
 		file, header, err := r.FormFile("image")
 		if err != nil {
-			http.Error(w, "Missing 'image' file in form data", http.StatusBadRequest)
+			httpError(w, "Missing 'image' file in form data", http.StatusBadRequest)
 			return
 		}
 		defer file.Close()
 
 		// Validate file extension
 		if !strings.HasSuffix(header.Filename, ".tar") {
-			http.Error(w, "File must be a .tar archive", http.StatusBadRequest)
+			httpError(w, "File must be a .tar archive", http.StatusBadRequest)
 			return
 		}
 
 		// Create temporary file, we defer delete it
 		tempFile, err := os.CreateTemp("", "haloy-image-*.tar")
 		if err != nil {
-			http.Error(w, "Failed to create temporary file", http.StatusInternalServerError)
+			httpError(w, "Failed to create temporary file", http.StatusInternalServerError)
 			return
 		}
 		defer func() {
@@ -48,7 +60,7 @@ func (s *APIServer) handleImageUpload() http.HandlerFunc {
 		// Copy uploaded data to temp file
 		_, err = io.Copy(tempFile, file)
 		if err != nil {
-			http.Error(w, "Failed to save uploaded file", http.StatusInternalServerError)
+			httpError(w, "Failed to save uploaded file", http.StatusInternalServerError)
 			return
 		}
 
@@ -57,13 +69,13 @@ func (s *APIServer) handleImageUpload() http.HandlerFunc {
 
 		cli, err := docker.NewClient(ctx)
 		if err != nil {
-			http.Error(w, "Failed to create Docker client", http.StatusInternalServerError)
+			httpError(w, "Failed to create Docker client", http.StatusInternalServerError)
 			return
 		}
 		defer cli.Close()
 
 		if err := docker.LoadImageFromTar(ctx, cli, tempFile.Name()); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to load image: %v", err), http.StatusInternalServerError)
+			httpError(w, fmt.Sprintf("Failed to load image: %v", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -73,8 +85,401 @@ func (s *APIServer) handleImageUpload() http.HandlerFunc {
 		}
 
 		if err := encodeJSON(w, http.StatusAccepted, response); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			httpError(w, "Failed to encode response", http.StatusInternalServerError)
 			return
 		}
 	}
 }
+
+const (
+	// maxUploadChunkSize limits the size of a single chunk of a resumable image upload.
+	maxUploadChunkSize = 64 << 20
+	// maxUploadSize limits the size of the image archive of a resumable upload.
+	maxUploadSize = 20 << 30
+	// staleUploadAge is how long an unfinished upload is kept so it can be resumed.
+	staleUploadAge = 24 * time.Hour
+	// imageLoadTimeout bounds digest verification and loading of large images.
+	imageLoadTimeout = 10 * time.Minute
+)
+
+var (
+	uploadLocksMutex sync.Mutex
+	uploadLocks      = make(map[string]*uploadLockEntry)
+)
+
+type uploadLockEntry struct {
+	sync.Mutex
+	// refs is the number of requests holding or waiting for the lock.
+	refs int
+}
+
+// lockUpload serializes requests for the same upload and returns the function that releases the lock.
+// The lock is removed once no request holds or waits for it, so completed and abandoned uploads don't
+// leave locks behind.
+func lockUpload(uploadID string) (unlock func()) {
+	uploadLocksMutex.Lock()
+	lock, ok := uploadLocks[uploadID]
+	if !ok {
+		lock = &uploadLockEntry{}
+		uploadLocks[uploadID] = lock
+	}
+	lock.refs++
+	uploadLocksMutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		uploadLocksMutex.Lock()
+		defer uploadLocksMutex.Unlock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(uploadLocks, uploadID)
+		}
+	}
+}
+
+// handleImageUploadStart starts a resumable image upload. The upload ID is derived from the digest
+// of the archive, so starting an upload of an archive that was partially sent resumes it.
+func (s *APIServer) handleImageUploadStart() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req apitypes.ImageUploadRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		uploadID, ok := strings.CutPrefix(req.Digest, "sha256:")
+		if !ok || !isUploadID(uploadID) {
+			httpError(w, "Digest must be a sha256 digest, e.g. sha256:<hex>", http.StatusBadRequest)
+			return
+		}
+		if req.ImageRef == "" {
+			httpError(w, "Image reference is required", http.StatusBadRequest)
+			return
+		}
+		if req.Size <= 0 {
+			httpError(w, "Size must be greater than zero", http.StatusBadRequest)
+			return
+		}
+		if req.Size > maxUploadSize {
+			httpError(w, fmt.Sprintf("Image archive of %d bytes exceeds the maximum upload size of %d bytes", req.Size, int64(maxUploadSize)), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		uploadsDir, err := uploadsDir()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		removeStaleUploads(uploadsDir)
+
+		unlock := lockUpload(uploadID)
+		defer unlock()
+
+		partPath, metaPath := uploadPaths(uploadsDir, uploadID)
+		var existing apitypes.ImageUploadRequest
+		if data, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(data, &existing) == nil && existing == req {
+			offset, err := uploadOffset(partPath)
+			if err == nil && offset <= req.Size {
+				if !checkUploadSpace(w, uploadsDir, req.Size-offset) {
+					return
+				}
+				encodeJSON(w, http.StatusOK, apitypes.ImageUploadStatusResponse{UploadID: uploadID, Offset: offset, Size: req.Size})
+				return
+			}
+		}
+
+		// Start from scratch if there is no matching upload to resume.
+		if !checkUploadSpace(w, uploadsDir, req.Size) {
+			return
+		}
+		data, err := json.Marshal(req)
+		if err != nil {
+			httpError(w, "Failed to encode upload metadata", http.StatusInternalServerError)
+			return
+		}
+		if err := os.WriteFile(metaPath, data, constants.ModeFileDefault); err != nil {
+			httpError(w, "Failed to save upload metadata", http.StatusInternalServerError)
+			return
+		}
+		if err := os.WriteFile(partPath, nil, constants.ModeFileDefault); err != nil {
+			httpError(w, "Failed to create upload file", http.StatusInternalServerError)
+			return
+		}
+
+		encodeJSON(w, http.StatusCreated, apitypes.ImageUploadStatusResponse{UploadID: uploadID, Offset: 0, Size: req.Size})
+	}
+}
+
+// handleImageUploadChunk appends a chunk to an upload. The Upload-Offset header must match the bytes
+// received so far, otherwise the current offset is returned with 409 Conflict so the client can resume.
+func (s *APIServer) handleImageUploadChunk() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uploadID := r.PathValue("uploadID")
+		if !isUploadID(uploadID) {
+			httpError(w, "Invalid upload ID", http.StatusBadRequest)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			httpError(w, "Upload-Offset header must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+
+		uploadsDir, err := uploadsDir()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		unlock := lockUpload(uploadID)
+		defer unlock()
+
+		partPath, metaPath := uploadPaths(uploadsDir, uploadID)
+		req, err := readUploadMeta(metaPath)
+		if err != nil {
+			httpError(w, "Upload not found", http.StatusNotFound)
+			return
+		}
+		current, err := uploadOffset(partPath)
+		if err != nil {
+			httpError(w, "Upload not found", http.StatusNotFound)
+			return
+		}
+
+		status := apitypes.ImageUploadStatusResponse{UploadID: uploadID, Offset: current, Size: req.Size}
+		if offset != current {
+			encodeJSON(w, http.StatusConflict, status)
+			return
+		}
+
+		file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, constants.ModeFileDefault)
+		if err != nil {
+			httpError(w, "Failed to open upload file", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		// Never accept more than the announced size. A partially received chunk is kept, the client resumes from the returned offset.
+		remaining := req.Size - current
+		written, err := io.Copy(file, io.LimitReader(http.MaxBytesReader(w, r.Body, maxUploadChunkSize), remaining))
+		status.Offset += written
+		if err != nil {
+			httpError(w, fmt.Sprintf("Failed to receive chunk: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		encodeJSON(w, http.StatusOK, status)
+	}
+}
+
+// handleImageUploadComplete verifies the digest of a finished upload, loads the image and checks
+// that the loaded image matches the image on the client.
+func (s *APIServer) handleImageUploadComplete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uploadID := r.PathValue("uploadID")
+		if !isUploadID(uploadID) {
+			httpError(w, "Invalid upload ID", http.StatusBadRequest)
+			return
+		}
+
+		uploadsDir, err := uploadsDir()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		unlock := lockUpload(uploadID)
+		defer unlock()
+
+		partPath, metaPath := uploadPaths(uploadsDir, uploadID)
+		req, err := readUploadMeta(metaPath)
+		if err != nil {
+			httpError(w, "Upload not found", http.StatusNotFound)
+			return
+		}
+		offset, err := uploadOffset(partPath)
+		if err != nil {
+			httpError(w, "Upload not found", http.StatusNotFound)
+			return
+		}
+		if offset != req.Size {
+			httpError(w, fmt.Sprintf("Upload is incomplete: received %d of %d bytes", offset, req.Size), http.StatusConflict)
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+
+		// The upload is removed whether or not it could be loaded, a corrupt archive can't be resumed.
+		defer func() {
+			os.Remove(partPath)
+			os.Remove(metaPath)
+		}()
+
+		file, err := os.Open(partPath)
+		if err != nil {
+			httpError(w, "Failed to open upload file", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			httpError(w, "Failed to read upload file", http.StatusInternalServerError)
+			return
+		}
+		if digest := hex.EncodeToString(hash.Sum(nil)); digest != uploadID {
+			httpError(w, fmt.Sprintf("Digest mismatch: expected sha256:%s, got sha256:%s", uploadID, digest), http.StatusUnprocessableEntity)
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			httpError(w, "Failed to read upload file", http.StatusInternalServerError)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), imageLoadTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, "Failed to create Docker client", http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		if _, err := docker.LoadImage(ctx, cli, file); err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if req.ImageID != "" {
+			loaded, err := cli.ImageInspect(ctx, req.ImageRef)
+			if err != nil {
+				httpError(w, fmt.Sprintf("Failed to inspect loaded image %s: %v", req.ImageRef, err), http.StatusInternalServerError)
+				return
+			}
+			if loaded.ID != req.ImageID {
+				httpError(w, fmt.Sprintf("Loaded image %s has ID %s, expected %s", req.ImageRef, loaded.ID, req.ImageID), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		logger.Info("Image uploaded", "image", req.ImageRef, "bytes", req.Size, "client_ip", s.clientIP(r))
+
+		response := apitypes.ImageUploadResponse{
+			Success: true,
+			Message: fmt.Sprintf("Image %s loaded successfully", req.ImageRef),
+		}
+		if err := encodeJSON(w, http.StatusOK, response); err != nil {
+			httpError(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// handleImageLayers reports how many leading layers of an image the server already has, so the
+// client can leave them out of the uploaded archive.
+func (s *APIServer) handleImageLayers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req apitypes.ImageLayersRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, "Failed to create Docker client", http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		present, err := docker.PresentLayers(ctx, cli, req.DiffIDs)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := encodeJSON(w, http.StatusOK, apitypes.ImageLayersResponse{PresentLayers: present}); err != nil {
+			httpError(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func uploadsDir() (string, error) {
+	dataDir, err := config.DataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get data directory: %w", err)
+	}
+	dir := filepath.Join(dataDir, constants.UploadsDir)
+	if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+		return "", fmt.Errorf("failed to create uploads directory: %w", err)
+	}
+	return dir, nil
+}
+
+func uploadPaths(uploadsDir, uploadID string) (partPath, metaPath string) {
+	return filepath.Join(uploadsDir, uploadID+".part"), filepath.Join(uploadsDir, uploadID+".json")
+}
+
+func uploadOffset(partPath string) (int64, error) {
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func readUploadMeta(metaPath string) (apitypes.ImageUploadRequest, error) {
+	var req apitypes.ImageUploadRequest
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return req, err
+	}
+	err = json.Unmarshal(data, &req)
+	return req, err
+}
+
+// isUploadID reports whether id is a hex encoded sha256 digest, which also keeps it safe to use in file paths.
+func isUploadID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// checkUploadSpace rejects an upload when the uploads directory doesn't have room for the bytes still to
+// be received. It returns false when the response has been written.
+func checkUploadSpace(w http.ResponseWriter, uploadsDir string, needed int64) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(uploadsDir, &stat); err != nil {
+		httpError(w, fmt.Sprintf("Failed to check free disk space: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if free := uint64(stat.Bavail) * uint64(stat.Bsize); uint64(needed) > free {
+		httpError(w, fmt.Sprintf("Not enough disk space for the upload: %d bytes needed, %d bytes free", needed, free), http.StatusInsufficientStorage)
+		return false
+	}
+	return true
+}
+
+// removeStaleUploads deletes uploads that haven't received data for staleUploadAge.
+func removeStaleUploads(uploadsDir string) {
+	entries, err := os.ReadDir(uploadsDir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-staleUploadAge)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(uploadsDir, entry.Name()))
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestImageUploadStart(t *testing.T) {
+	s := newTestServer(t)
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name   string
+		size   int64
+		status int
+	}{
+		{name: "empty archive", size: 0, status: http.StatusBadRequest},
+		{name: "larger than the maximum upload size", size: maxUploadSize + 1, status: http.StatusRequestEntityTooLarge},
+		{name: "small archive", size: 1024, status: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"imageRef":"shop:v2","size":%d,"digest":"%s"}`, tt.size, digest)
+			if w := serve(s, http.MethodPost, "/v1/images/uploads", testAPIToken, body); w.Code != tt.status {
+				t.Errorf("status = %d, expected %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	uploadLocksMutex.Lock()
+	defer uploadLocksMutex.Unlock()
+	if len(uploadLocks) != 0 {
+		t.Errorf("upload locks are kept after the requests: %v", uploadLocks)
+	}
+}
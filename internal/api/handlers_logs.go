@@ -6,7 +6,7 @@ import (
 
 func (s *APIServer) handleLogs() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logChan, subscriberID := s.logBroker.SubscribeGeneral()
+		logChan, subscriberID := s.logBroker.SubscribeGeneral(lastEventID(r))
 
 		streamConfig := sseStreamConfig{
 			logChan: logChan,
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+const (
+	// oidcLoginTimeout is how long a sign-in waits for the callback of the provider.
+	oidcLoginTimeout = 10 * time.Minute
+	// oidcMaxLogins bounds the sign-ins waiting for their callback.
+	oidcMaxLogins    = 1000
+	oidcCallbackPath = "/v1/oidc/callback"
+	dashboardPath    = "/dashboard/"
+)
+
+// oidcLogin is a sign-in waiting for the callback of the provider.
+type oidcLogin struct {
+	redirectURI  string
+	codeVerifier string
+	nonce        string
+	expiresAt    time.Time
+}
+
+// oidcRedirectURI checks where the ID token is sent after sign-in: the dashboard, or the loopback address the
+// CLI listens on for 'haloy login --sso'.
+func oidcRedirectURI(redirectURI string) (string, error) {
+	if redirectURI == "" {
+		return dashboardPath, nil
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme != "http" || u.Port() == "" {
+		return "", fmt.Errorf("invalid redirect_uri '%s', must be a loopback address like http://127.0.0.1:8765/callback", redirectURI)
+	}
+	if host := u.Hostname(); host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return "", fmt.Errorf("invalid redirect_uri '%s', must be a loopback address like http://127.0.0.1:8765/callback", redirectURI)
+		}
+	}
+	return u.String(), nil
+}
+
+// randomString returns a random URL safe string for the state, nonce and code verifier of a sign-in.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// oidcCallbackURL returns the redirect URI registered with the provider.
+func (s *APIServer) oidcCallbackURL() (string, error) {
+	access := s.access.Load()
+	if access == nil || access.config.Domain == "" {
+		return "", fmt.Errorf("api.oidc requires api.domain")
+	}
+	return "https://" + access.config.Domain + oidcCallbackPath, nil
+}
+
+func (s *APIServer) handleOIDCInfo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := s.oidc.Load()
+		if provider == nil {
+			httpError(w, "OIDC sign-in is not configured", http.StatusNotFound)
+			return
+		}
+		encodeJSON(w, http.StatusOK, apitypes.OIDCInfoResponse{Issuer: provider.config.Issuer})
+	}
+}
+
+// handleOIDCLogin redirects to the provider to sign in, with PKCE and a nonce.
+func (s *APIServer) handleOIDCLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := s.oidc.Load()
+		if provider == nil {
+			httpError(w, "OIDC sign-in is not configured", http.StatusNotFound)
+			return
+		}
+		redirectURI, err := oidcRedirectURI(r.URL.Query().Get("redirect_uri"))
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		callbackURL, err := s.oidcCallbackURL()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), oidcRequestTimeout)
+		defer cancel()
+		discovery, err := provider.getDiscovery(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		state, err := randomString()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nonce, err := randomString()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		codeVerifier, err := randomString()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !provider.addLogin(state, oidcLogin{
+			redirectURI:  redirectURI,
+			codeVerifier: codeVerifier,
+			nonce:        nonce,
+			expiresAt:    time.Now().Add(oidcLoginTimeout),
+		}) {
+			httpError(w, "Too many sign-ins in progress, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+
+		challenge := sha256.Sum256([]byte(codeVerifier))
+		query := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {provider.config.ClientID},
+			"redirect_uri":          {callbackURL},
+			"scope":                 {strings.Join(append([]string{"openid", "profile", "email"}, provider.config.Scopes...), " ")},
+			"state":                 {state},
+			"nonce":                 {nonce},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+		}
+		authURL := discovery.AuthorizationEndpoint
+		if strings.Contains(authURL, "?") {
+			authURL += "&" + query.Encode()
+		} else {
+			authURL += "?" + query.Encode()
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// handleOIDCCallback exchanges the code of the provider for an ID token and hands it to the dashboard in the URL
+// fragment, or to the CLI on its loopback address.
+func (s *APIServer) handleOIDCCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := s.oidc.Load()
+		if provider == nil {
+			httpError(w, "OIDC sign-in is not configured", http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		login, ok := provider.takeLogin(query.Get("state"))
+		if !ok {
+			httpError(w, "Unknown or expired sign-in, start it again", http.StatusBadRequest)
+			return
+		}
+		if errorCode := query.Get("error"); errorCode != "" {
+			httpError(w, fmt.Sprintf("Sign-in failed: %s %s", errorCode, query.Get("error_description")), http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), oidcRequestTimeout)
+		defer cancel()
+		idToken, err := s.exchangeOIDCCode(ctx, provider, query.Get("code"), login.codeVerifier)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		identity, err := provider.verify(idToken)
+		if err != nil {
+			httpError(w, fmt.Sprintf("Invalid ID token: %v", err), http.StatusUnauthorized)
+			return
+		}
+		if identity.nonce != login.nonce {
+			httpError(w, "Invalid ID token: nonce mismatch", http.StatusUnauthorized)
+			return
+		}
+		if identity.grant.Empty() {
+			writeError(w, http.StatusForbidden, apitypes.ErrCodeForbidden,
+				"None of your groups are mapped to a scope in api.oidc of this server", nil)
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Signed in with OIDC", "subject", identity.subject, "client_ip", s.clientIP(r))
+
+		w.Header().Set("Cache-Control", "no-store")
+		if login.redirectURI == dashboardPath {
+			// The fragment isn't sent to servers or kept in referrers.
+			http.Redirect(w, r, dashboardPath+"#token="+url.QueryEscape(idToken), http.StatusFound)
+			return
+		}
+		target, _ := url.Parse(login.redirectURI)
+		targetQuery := target.Query()
+		targetQuery.Set("token", idToken)
+		target.RawQuery = targetQuery.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+}
+
+// exchangeOIDCCode returns the ID token of an authorization code.
+func (s *APIServer) exchangeOIDCCode(ctx context.Context, provider *oidcProvider, code, codeVerifier string) (string, error) {
+	if code == "" {
+		return "", fmt.Errorf("the provider didn't return an authorization code")
+	}
+	discovery, err := provider.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	callbackURL, err := s.oidcCallbackURL()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {callbackURL},
+		"client_id":     {provider.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if provider.clientSecret != "" {
+		form.Set("client_secret", provider.clientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange the authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("failed to decode the token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to exchange the authorization code: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IDToken == "" {
+		return "", fmt.Errorf("the token response has no id_token, is the openid scope allowed for the client?")
+	}
+	return tokenResponse.IDToken, nil
+}
+
+// addLogin stores a sign-in until its callback, it returns false when too many sign-ins are in progress.
+func (p *oidcProvider) addLogin(state string, login oidcLogin) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	for s, l := range p.logins {
+		if !now.Before(l.expiresAt) {
+			delete(p.logins, s)
+		}
+	}
+	if len(p.logins) >= oidcMaxLogins {
+		return false
+	}
+	p.logins[state] = login
+	return true
+}
+
+// takeLogin removes a sign-in and returns it, unless it expired.
+func (p *oidcProvider) takeLogin(state string) (oidcLogin, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	login, ok := p.logins[state]
+	delete(p.logins, state)
+	return login, ok && time.Now().Before(login.expiresAt)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+// handlePauseApp stops the containers of an app and keeps its domains routed to a maintenance page until
+// it's resumed.
+func (s *APIServer) handlePauseApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		paused, err := deploy.PausedApp(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if paused != nil {
+			httpError(w, fmt.Sprintf("App is already paused, deployment %s", paused.DeploymentID), http.StatusConflict)
+			return
+		}
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		containerList, err := docker.GetAppContainers(ctx, cli, true, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(containerList) == 0 {
+			httpError(w, "No containers found for the specified app", http.StatusNotFound)
+			return
+		}
+
+		status, err := getResponse(containerList)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var labels map[string]string
+		for _, c := range containerList {
+			if c.Labels[config.LabelDeploymentID] == status.DeploymentID {
+				labels = c.Labels
+				break
+			}
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Pausing app", "app", appName, "deployment_id", status.DeploymentID)
+		stoppedIDs, err := deploy.PauseApp(ctx, cli, logger, appName, status.DeploymentID, labels)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Successfully paused app", "app", appName, "stopped_count", len(stoppedIDs))
+
+		encodeJSON(w, http.StatusOK, apitypes.PauseAppResponse{
+			Message:      fmt.Sprintf("Paused, stopped %d container(s)", len(stoppedIDs)),
+			DeploymentID: status.DeploymentID,
+			ContainerIDs: stoppedIDs,
+		})
+	}
+}
+
+// handleResumeApp starts the containers of a paused app again.
+func (s *APIServer) handleResumeApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		paused, err := deploy.PausedApp(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if paused == nil {
+			httpError(w, "App is not paused", http.StatusConflict)
+			return
+		}
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Resuming app", "app", appName, "deployment_id", paused.DeploymentID)
+		startedIDs, err := deploy.ResumeApp(ctx, cli, logger, *paused)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Successfully resumed app", "app", appName, "started_count", len(startedIDs))
+
+		encodeJSON(w, http.StatusOK, apitypes.PauseAppResponse{
+			Message:      fmt.Sprintf("Resumed, started %d container(s)", len(startedIDs)),
+			DeploymentID: paused.DeploymentID,
+			ContainerIDs: startedIDs,
+		})
+	}
+}
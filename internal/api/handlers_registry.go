@@ -0,0 +1,20 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/registry"
+)
+
+// EnableRegistry serves the embedded image registry on /v2/, storing images in root. The registry
+// authenticates requests with the API token itself, as docker login sends it as basic auth. Its requests
+// are rate limited like the /v1 endpoints, and invalid credentials count towards the lockout.
+func (s *APIServer) EnableRegistry(root string) error {
+	reg, err := registry.New(root, s.apiToken, s.authFailed, logging.NewLogger(s.logLevel, s.logBroker))
+	if err != nil {
+		return fmt.Errorf("failed to create registry: %w", err)
+	}
+	s.router.Handle("/v2/", reg)
+	return nil
+}
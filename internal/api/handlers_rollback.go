@@ -8,63 +8,118 @@ import (
 	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/deploy"
 	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func (s *APIServer) handleRollback() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req apitypes.RollbackRequest
 		if err := decodeJSON(r.Body, &req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
 		appConfig := req.NewTargetConfig
-
-		if req.TargetDeploymentID == "" {
-			http.Error(w, "Target deployment ID is required", http.StatusBadRequest)
+		if !authorizeTarget(w, r, appConfig) {
 			return
 		}
-		if req.NewDeploymentID == "" {
-			http.Error(w, "New deployment ID is required", http.StatusBadRequest)
+
+		if req.TargetDeploymentID == "" {
+			httpError(w, "Target deployment ID is required", http.StatusBadRequest)
 			return
 		}
+		req.NewDeploymentID = helpers.NewDeploymentID().String()
 
 		if err := appConfig.Validate(appConfig.Format); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid app configuration: %v", err), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, apitypes.ErrCodeInvalidConfig, fmt.Sprintf("Invalid app configuration: %v", err), nil)
 			return
 		}
 
-		deploymentLogger := logging.NewDeploymentLogger(req.NewDeploymentID, s.logLevel, s.logBroker)
-
-		go func() {
-			ctx := context.Background()
-			ctx, cancel := context.WithTimeout(ctx, defaultContextTimeout)
-			defer cancel()
-
-			cli, err := docker.NewClient(ctx)
+		if s.protects(appConfig.Name) {
+			action, err := s.holdAction(r, actionRollback, appConfig.Name,
+				fmt.Sprintf("Roll back %s to deployment %s", appConfig.Name, req.TargetDeploymentID), req)
 			if err != nil {
-				deploymentLogger.Error("Failed to create Docker client", "error", err)
+				httpError(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			defer cli.Close()
+			encodeJSON(w, http.StatusAccepted, apitypes.RollbackResponse{PendingAction: action})
+			return
+		}
 
-			if err := deploy.RollbackApp(ctx, cli, appConfig, req.TargetDeploymentID, req.NewDeploymentID, deploymentLogger); err != nil {
-				deploymentLogger.Error("Deployment failed", "app", appConfig.Name, "error", err)
-				return
-			}
-			deploymentLogger.Info("Rollback initiated", "app", appConfig.Name, "deploymentID", req.NewDeploymentID)
-		}()
+		if !s.startRollback(r, req) {
+			httpError(w, "haloyd is shutting down, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+
+		encodeJSON(w, http.StatusAccepted, apitypes.RollbackResponse{DeploymentID: req.NewDeploymentID})
+	}
+}
 
-		w.WriteHeader(http.StatusAccepted)
+// startRollback rolls the app back in the background, it returns false when haloyd is shutting down.
+func (s *APIServer) startRollback(r *http.Request, req apitypes.RollbackRequest) bool {
+	appConfig := req.NewTargetConfig
+	if !s.startDeployment() {
+		return false
 	}
+	s.setActiveApp(req.NewDeploymentID, appConfig.Name)
+
+	logging.SetCorrelationID(req.NewDeploymentID, logging.CorrelationIDFromContext(r.Context()))
+	deploymentLogger := logging.NewDeploymentLogger(req.NewDeploymentID, s.logLevel, s.logBroker)
+	deploymentCtx := tracing.StartDeployment(r, req.NewDeploymentID, appConfig.Name,
+		attribute.String("haloy.rollback_from", req.TargetDeploymentID))
+
+	s.eventBroker.Publish(events.Event{
+		Type:         events.TypeDeploymentStarted,
+		AppName:      appConfig.Name,
+		DeploymentID: req.NewDeploymentID,
+		Data:         map[string]any{"rollbackFrom": req.TargetDeploymentID},
+	})
+	s.eventBroker.Publish(events.Event{
+		Type:         events.TypeDeploymentRollback,
+		AppName:      appConfig.Name,
+		DeploymentID: req.NewDeploymentID,
+		Data:         map[string]any{"rollbackFrom": req.TargetDeploymentID},
+	})
+
+	go func() {
+		defer s.deployments.Done()
+		defer s.setActiveApp(req.NewDeploymentID, "")
+		ctx, cancel := context.WithTimeout(deploymentCtx, defaultContextTimeout)
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			deploymentLogger.Error("Failed to create Docker client", "error", err)
+			return
+		}
+		defer cli.Close()
+
+		if err := deploy.RollbackApp(ctx, cli, appConfig, req.TargetDeploymentID, req.NewDeploymentID, deploymentLogger); err != nil {
+			deploymentLogger.Error("Deployment failed", "app", appConfig.Name, "error", err)
+			tracing.EndDeployment(req.NewDeploymentID, err)
+			s.eventBroker.Publish(events.Event{
+				Type:         events.TypeDeploymentFailed,
+				AppName:      appConfig.Name,
+				DeploymentID: req.NewDeploymentID,
+				Data:         map[string]any{"error": err.Error()},
+			})
+			return
+		}
+		deploymentLogger.Info("Rollback initiated", "app", appConfig.Name, "deploymentID", req.NewDeploymentID)
+	}()
+
+	return true
 }
 
 func (s *APIServer) handleRollbackTargets() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		appName := r.PathValue("appName")
 		if appName == "" {
-			http.Error(w, "App name is required", http.StatusBadRequest)
+			httpError(w, "App name is required", http.StatusBadRequest)
 			return
 		}
 
@@ -74,14 +129,14 @@ func (s *APIServer) handleRollbackTargets() http.HandlerFunc {
 
 		cli, err := docker.NewClient(ctx)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		defer cli.Close()
 
 		targets, err := deploy.GetRollbackTargets(ctx, cli, appName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/docker/docker/api/types/container"
+)
+
+// maxScaleReplicas bounds the replicas an app can be scaled to, so a typo doesn't start hundreds of containers.
+const maxScaleReplicas = 50
+
+// handleScaleApp adds or removes replicas of the current deployment of an app without deploying it again. The
+// replica count is stored in the deployment spec, so the reconciler keeps it until the next deployment.
+func (s *APIServer) handleScaleApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		var req apitypes.ScaleRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Replicas < 1 || req.Replicas > maxScaleReplicas {
+			httpError(w, fmt.Sprintf("Replicas must be between 1 and %d", maxScaleReplicas), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		paused, err := deploy.PausedApp(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if paused != nil {
+			httpError(w, "App is paused, use 'haloy resume' to start it", http.StatusConflict)
+			return
+		}
+		deploying, err := deploy.AppDeploying(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if deploying {
+			httpError(w, fmt.Sprintf("A deployment of %s is in progress, try again when it has finished", appName), http.StatusConflict)
+			return
+		}
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		containerList, err := docker.GetAppContainers(ctx, cli, false, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(containerList) == 0 {
+			httpError(w, "No running containers found for the specified app", http.StatusNotFound)
+			return
+		}
+		status, err := getResponse(containerList)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		spec, err := deploy.LoadSpec(status.DeploymentID)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if spec == nil {
+			httpError(w, fmt.Sprintf("Deployment %s was made before deployment specs were stored, deploy the app again to scale it", status.DeploymentID),
+				http.StatusConflict)
+			return
+		}
+		if spec.Autoscale != nil {
+			httpError(w, fmt.Sprintf("%s is autoscaled between %d and %d replicas, change autoscale in its config instead",
+				appName, *spec.Autoscale.Min, *spec.Autoscale.Max), http.StatusConflict)
+			return
+		}
+
+		var replicas []container.Summary
+		for _, c := range containerList {
+			if c.Labels[config.LabelDeploymentID] == status.DeploymentID {
+				replicas = append(replicas, c)
+			}
+		}
+		previous := len(replicas)
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Scaling app", "app", appName, "deployment_id", status.DeploymentID, "from", previous, "to", req.Replicas)
+		scaled, err := deploy.ScaleReplicas(ctx, cli, logger, status.DeploymentID, replicas, req.Replicas)
+		if scaled != previous {
+			s.eventBroker.Publish(events.Event{
+				Type:         events.TypeAppScaled,
+				AppName:      appName,
+				DeploymentID: status.DeploymentID,
+				Data:         map[string]any{"from": previous, "to": scaled},
+			})
+		}
+		if err != nil {
+			httpError(w, fmt.Sprintf("Scaled to %d of %d replicas: %v", scaled, req.Replicas, err), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Successfully scaled app", "app", appName, "replicas", scaled)
+
+		encodeJSON(w, http.StatusOK, apitypes.ScaleResponse{
+			Message:      fmt.Sprintf("Scaled %s from %d to %d replica(s)", appName, previous, scaled),
+			DeploymentID: status.DeploymentID,
+			Previous:     previous,
+			Replicas:     scaled,
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+func TestScaleAppRejected(t *testing.T) {
+	s := newTestServer(t)
+
+	db, err := storage.New()
+	if err != nil {
+		t.Fatalf("storage.New() error = %v", err)
+	}
+	if err := db.SavePausedApp(storage.PausedApp{AppName: "shop-paused", DeploymentID: "20250101120000", Labels: json.RawMessage(`{}`), PausedAt: time.Now()}); err != nil {
+		t.Fatalf("SavePausedApp() error = %v", err)
+	}
+	db.Close()
+
+	tests := []struct {
+		name   string
+		app    string
+		token  string
+		body   string
+		status int
+	}{
+		{name: "no replicas", app: "shop-web", token: testAPIToken, body: `{"replicas":0}`, status: http.StatusBadRequest},
+		{name: "too many replicas", app: "shop-web", token: testAPIToken, body: `{"replicas":51}`, status: http.StatusBadRequest},
+		{name: "invalid body", app: "shop-web", token: testAPIToken, body: `{"replicas":"two"}`, status: http.StatusBadRequest},
+		{name: "paused app", app: "shop-paused", token: testAPIToken, body: `{"replicas":2}`, status: http.StatusConflict},
+		{name: "app token of another app", app: "blog", token: testAppToken, body: `{"replicas":2}`, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(s, http.MethodPost, "/v1/scale/"+tt.app, tt.token, tt.body); w.Code != tt.status {
+				t.Errorf("status = %d, expected %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/serverkey"
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// handleSecrets lists the secret provider references used by the deployments in the history, which
+// apps use them and when they were last used. Only the references are read, from the raw app configs.
+func (s *APIServer) handleSecrets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deployments, err := deploy.Deployments()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// App tokens only see the secrets of their apps.
+		deployments = slices.DeleteFunc(deployments, func(d storage.Deployment) bool {
+			return !appAllowed(r, d.AppName)
+		})
+
+		secrets, err := secretUsage(deployments)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		imported, err := importedSecrets()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := apitypes.SecretsResponse{Secrets: secrets}
+		for _, name := range slices.Sorted(maps.Keys(imported)) {
+			if importedSecretAllowed(r, imported[name]) {
+				response.Imported = append(response.Imported, name)
+			}
+		}
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
+
+// secretUsage walks the deployments oldest first. A secret is unused since the deployment that dropped it
+// from the last app that used it.
+func secretUsage(deployments []storage.Deployment) ([]apitypes.SecretUsage, error) {
+	latestDeployment := make(map[string]string)
+	for _, deployment := range deployments {
+		latestDeployment[deployment.AppName] = deployment.ID
+	}
+
+	usage := make(map[string]*apitypes.SecretUsage)
+	dropped := make(map[string]time.Time)
+	previousRefs := make(map[string]map[string]bool)
+	for _, deployment := range deployments {
+		var rawAppConfig config.AppConfig
+		if err := json.Unmarshal(deployment.RawAppConfig, &rawAppConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse app config of deployment %s: %w", deployment.ID, err)
+		}
+		deployedAt, _ := helpers.GetTimestampFromDeploymentID(deployment.ID)
+
+		refs := make(map[string]bool)
+		for _, name := range rawAppConfig.TargetConfig.SecretReferences() {
+			refs[name] = true
+			secret, ok := usage[name]
+			if !ok {
+				secret = &apitypes.SecretUsage{Name: name}
+				usage[name] = secret
+			}
+			secret.Consumers = append(secret.Consumers, apitypes.SecretConsumer{
+				App:          deployment.AppName,
+				DeploymentID: deployment.ID,
+				Current:      latestDeployment[deployment.AppName] == deployment.ID,
+			})
+			if deployedAt.After(secret.LastUsed) {
+				secret.LastUsed = deployedAt
+			}
+		}
+
+		for name := range previousRefs[deployment.AppName] {
+			if !refs[name] && deployedAt.After(dropped[name]) {
+				dropped[name] = deployedAt
+			}
+		}
+		previousRefs[deployment.AppName] = refs
+	}
+
+	secrets := make([]apitypes.SecretUsage, 0, len(usage))
+	for name, secret := range usage {
+		inUse := false
+		for _, consumer := range secret.Consumers {
+			inUse = inUse || consumer.Current
+		}
+		if !inUse {
+			unusedSince := secret.LastUsed
+			if droppedAt, ok := dropped[name]; ok {
+				unusedSince = droppedAt
+			}
+			secret.UnusedSince = &unusedSince
+		}
+		secrets = append(secrets, *secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets, nil
+}
+
+// handleSecretsRecipient returns the age recipient of the server, 'haloy secrets import' encrypts the
+// secrets it sends to it.
+func (s *APIServer) handleSecretsRecipient() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, err := serverkey.Identity()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		encodeJSON(w, http.StatusOK, apitypes.SecretsRecipientResponse{Recipient: identity.Recipient().String()})
+	}
+}
+
+// handleExportSecrets returns the values of the secrets used by the current deployments of the apps and of the
+// secrets imported to the server, for 'haloy secrets import' on another server.
+func (s *APIServer) handleExportSecrets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secrets, err := exportSecrets()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		encodeJSON(w, http.StatusOK, apitypes.SecretsExportResponse{Secrets: secrets})
+	}
+}
+
+// handleImportSecrets stores secrets exported from another server. The values must be encrypted to the
+// recipient of this server, they're stored as they are.
+func (s *APIServer) handleImportSecrets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req apitypes.SecretsImportRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Secrets) == 0 {
+			httpError(w, "No secrets to import", http.StatusBadRequest)
+			return
+		}
+
+		importedAt := time.Now()
+		secrets := make([]storage.Secret, 0, len(req.Secrets))
+		for _, secret := range req.Secrets {
+			if secret.Name == "" {
+				httpError(w, "Secret name is required", http.StatusBadRequest)
+				return
+			}
+			value, err := serverkey.Dearmor(secret.Value)
+			if err == nil {
+				_, err = serverkey.Open(value)
+			}
+			if err != nil {
+				httpError(w, fmt.Sprintf("Secret %s isn't encrypted to the recipient of this server: %v", secret.Name, err), http.StatusBadRequest)
+				return
+			}
+			apps, err := json.Marshal(slices.Sorted(slices.Values(secret.Apps)))
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			secrets = append(secrets, storage.Secret{Name: secret.Name, Value: value, Apps: apps, ImportedAt: importedAt})
+		}
+
+		db, err := storage.New()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		if err := db.SaveSecrets(secrets); err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		encodeJSON(w, http.StatusOK, apitypes.SecretsImportResponse{Imported: len(secrets)})
+	}
+}
+
+// exportSecrets pairs the secret provider references of the current deployment of each app with the values of
+// its resolved spec. Values of deployments replace imported values of the same secret.
+func exportSecrets() ([]apitypes.ExportedSecret, error) {
+	exported, err := importedSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := deploy.Deployments()
+	if err != nil {
+		return nil, err
+	}
+	latestDeployment := make(map[string]storage.Deployment)
+	for _, deployment := range deployments {
+		latestDeployment[deployment.AppName] = deployment
+	}
+
+	for _, appName := range slices.Sorted(maps.Keys(latestDeployment)) {
+		deployment := latestDeployment[appName]
+		// Apps deployed before specs were stored have no resolved values.
+		spec, err := deploy.LoadSpec(deployment.ID)
+		if err != nil {
+			return nil, err
+		}
+		if spec == nil {
+			continue
+		}
+		var rawAppConfig config.AppConfig
+		if err := json.Unmarshal(deployment.RawAppConfig, &rawAppConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse app config of deployment %s: %w", deployment.ID, err)
+		}
+		values, err := rawAppConfig.TargetConfig.SecretValues(*spec)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, value := range values {
+			secret := exported[name]
+			secret.Name = name
+			secret.Value = value
+			if !slices.Contains(secret.Apps, appName) {
+				secret.Apps = append(secret.Apps, appName)
+			}
+			exported[name] = secret
+		}
+	}
+
+	secrets := make([]apitypes.ExportedSecret, 0, len(exported))
+	for _, name := range slices.Sorted(maps.Keys(exported)) {
+		secret := exported[name]
+		slices.Sort(secret.Apps)
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// importedSecrets returns the secrets imported to the server by name, with their values decrypted.
+func importedSecrets() (map[string]apitypes.ExportedSecret, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	stored, err := db.GetSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]apitypes.ExportedSecret, len(stored))
+	for _, secret := range stored {
+		value, err := serverkey.Open(secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", secret.Name, err)
+		}
+		var apps []string
+		if err := json.Unmarshal(secret.Apps, &apps); err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", secret.Name, err)
+		}
+		secrets[secret.Name] = apitypes.ExportedSecret{Name: secret.Name, Value: string(value), Apps: apps}
+	}
+	return secrets, nil
+}
+
+// importedSecretAllowed reports whether the token of the request can use an imported secret: the API token can
+// use every secret, app tokens only the secrets of their apps.
+func importedSecretAllowed(r *http.Request, secret apitypes.ExportedSecret) bool {
+	if _, isAppToken := appTokenFromContext(r.Context()); !isAppToken {
+		return true
+	}
+	return slices.ContainsFunc(secret.Apps, func(app string) bool {
+		return appAllowed(r, app)
+	})
+}
+
+// resolveImportedSecrets resolves the secret provider references the client left unresolved from the secrets
+// imported to the server. It writes a 400 response and returns false when a value isn't resolved.
+func resolveImportedSecrets(w http.ResponseWriter, r *http.Request, targetConfig *config.TargetConfig) bool {
+	if !targetConfig.HasUnresolvedValues() {
+		return true
+	}
+
+	imported, err := importedSecrets()
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	// App tokens can only deploy a secret to the apps it was imported for, not read it with another app.
+	_, isAppToken := appTokenFromContext(r.Context())
+	missing := targetConfig.ResolveSecretReferences(func(reference string) (string, bool) {
+		secret, ok := imported[reference]
+		if !ok || (isAppToken && !slices.Contains(secret.Apps, targetConfig.Name)) {
+			return "", false
+		}
+		return secret.Value, true
+	})
+	if len(missing) > 0 {
+		writeError(w, http.StatusBadRequest, apitypes.ErrCodeInvalidConfig,
+			fmt.Sprintf("Secrets %s aren't resolved and weren't imported to the server for %s", strings.Join(missing, ", "), targetConfig.Name), nil)
+		return false
+	}
+	if targetConfig.HasUnresolvedValues() {
+		writeError(w, http.StatusBadRequest, apitypes.ErrCodeInvalidConfig, "Values from the environment must be resolved by the client", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/serverkey"
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+func secretEnv(reference string) config.TargetConfig {
+	return config.TargetConfig{
+		Env: []config.EnvVar{
+			{Name: "DB_PASSWORD", ValueSource: config.ValueSource{From: &config.SourceReference{Secret: reference}}},
+		},
+	}
+}
+
+func importTestSecret(t *testing.T, s *APIServer, secret apitypes.ExportedSecret) {
+	t.Helper()
+	w := serve(s, http.MethodGet, "/v1/secrets/recipient", testAPIToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /v1/secrets/recipient = %d: %s", w.Code, w.Body.String())
+	}
+	var recipient apitypes.SecretsRecipientResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &recipient); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := serverkey.EncryptTo(recipient.Recipient, secret.Value)
+	if err != nil {
+		t.Fatalf("EncryptTo() error = %v", err)
+	}
+	secret.Value = encrypted
+	body, _ := json.Marshal(apitypes.SecretsImportRequest{Secrets: []apitypes.ExportedSecret{secret}})
+	if w := serve(s, http.MethodPost, "/v1/secrets/import", testAPIToken, string(body)); w.Code != http.StatusOK {
+		t.Fatalf("POST /v1/secrets/import = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestImportSecrets(t *testing.T) {
+	s := newTestServer(t)
+
+	plain, _ := json.Marshal(apitypes.SecretsImportRequest{Secrets: []apitypes.ExportedSecret{{Name: "onepassword:shop.db-password", Value: "hunter2"}}})
+	if w := serve(s, http.MethodPost, "/v1/secrets/import", testAPIToken, string(plain)); w.Code != http.StatusBadRequest {
+		t.Errorf("importing a plain text value = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := serve(s, http.MethodPost, "/v1/secrets/import", testAppToken, string(plain)); w.Code != http.StatusUnauthorized && w.Code != http.StatusForbidden {
+		t.Errorf("importing with an app token = %d, want it rejected", w.Code)
+	}
+
+	importTestSecret(t, s, apitypes.ExportedSecret{Name: "onepassword:shop.db-password", Value: "hunter2", Apps: []string{"shop-web"}})
+
+	db, err := storage.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.GetSecrets()
+	db.Close()
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("GetSecrets() = %v, %v, want one secret", stored, err)
+	}
+	if strings.Contains(string(stored[0].Value), "hunter2") {
+		t.Errorf("imported secret is stored in plain text")
+	}
+
+	w := serve(s, http.MethodGet, "/v1/secrets", testAppToken, "")
+	var secrets apitypes.SecretsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &secrets); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Imported) != 1 || secrets.Imported[0] != "onepassword:shop.db-password" {
+		t.Errorf("GET /v1/secrets imported = %v, want the imported secret", secrets.Imported)
+	}
+}
+
+func TestExportSecrets(t *testing.T) {
+	s := newTestServer(t)
+	importTestSecret(t, s, apitypes.ExportedSecret{Name: "onepassword:shop.db-password", Value: "old", Apps: []string{"shop-api"}})
+
+	// The current deployment of shop-web uses the same secret with a newer value.
+	rawTargetConfig := secretEnv("onepassword:shop.db-password")
+	rawTargetConfig.Name = "shop-web"
+	rawAppConfig, _ := json.Marshal(config.AppConfig{TargetConfig: rawTargetConfig})
+	resolved := secretEnv("")
+	resolved.Name = "shop-web"
+	resolved.Env[0].ValueSource = config.ValueSource{Value: "new"}
+	targetConfig, _ := json.Marshal(resolved)
+
+	db, err := storage.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveDeployment(storage.Deployment{ID: "20250101120000", AppName: "shop-web", RawAppConfig: rawAppConfig, DeployedImage: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("SaveDeployment() error = %v", err)
+	}
+	checkpoint := storage.DeploymentCheckpoint{DeploymentID: "20250101120000", AppName: "shop-web", Step: "done", TargetConfig: targetConfig, RawAppConfig: rawAppConfig, UpdatedAt: time.Now()}
+	if err := db.SaveCheckpoint(checkpoint); err != nil {
+		t.Fatalf("SaveCheckpoint() error = %v", err)
+	}
+	if err := db.CompleteCheckpoint("20250101120000"); err != nil {
+		t.Fatalf("CompleteCheckpoint() error = %v", err)
+	}
+	db.Close()
+
+	if w := serve(s, http.MethodGet, "/v1/secrets/export", testAppToken, ""); w.Code == http.StatusOK {
+		t.Errorf("exporting with an app token succeeded")
+	}
+	w := serve(s, http.MethodGet, "/v1/secrets/export", testAPIToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /v1/secrets/export = %d: %s", w.Code, w.Body.String())
+	}
+	var export apitypes.SecretsExportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	want := apitypes.ExportedSecret{Name: "onepassword:shop.db-password", Value: "new", Apps: []string{"shop-api", "shop-web"}}
+	if len(export.Secrets) != 1 || export.Secrets[0].Value != want.Value || strings.Join(export.Secrets[0].Apps, ",") != strings.Join(want.Apps, ",") {
+		t.Errorf("GET /v1/secrets/export = %+v, want %+v", export.Secrets, want)
+	}
+}
+
+func TestResolveImportedSecrets(t *testing.T) {
+	s := newTestServer(t)
+	importTestSecret(t, s, apitypes.ExportedSecret{Name: "onepassword:shop.db-password", Value: "hunter2", Apps: []string{"shop-web"}})
+
+	appToken := config.AppToken{Name: "ci-shop", Apps: []string{"shop-*"}}
+	tests := []struct {
+		name      string
+		app       string
+		reference string
+		appToken  bool
+		wantValue string
+	}{
+		{name: "API token", app: "shop-api", reference: "onepassword:shop.db-password", wantValue: "hunter2"},
+		{name: "app token of the app", app: "shop-web", reference: "onepassword:shop.db-password", appToken: true, wantValue: "hunter2"},
+		{name: "app token of another app", app: "shop-api", reference: "onepassword:shop.db-password", appToken: true},
+		{name: "not imported", app: "shop-web", reference: "onepassword:shop.api-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetConfig := secretEnv(tt.reference)
+			targetConfig.Name = tt.app
+			r := httptest.NewRequest(http.MethodPost, "/v1/deploy", nil)
+			if tt.appToken {
+				r = r.WithContext(withAppToken(r.Context(), appToken))
+			}
+			w := httptest.NewRecorder()
+
+			ok := resolveImportedSecrets(w, r, &targetConfig)
+			if ok != (tt.wantValue != "") {
+				t.Fatalf("resolveImportedSecrets() = %v: %s", ok, w.Body.String())
+			}
+			if ok && (targetConfig.Env[0].Value != tt.wantValue || targetConfig.Env[0].From != nil) {
+				t.Errorf("resolved env = %+v, want value %s", targetConfig.Env[0].ValueSource, tt.wantValue)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+// The public addresses rarely change, so they are cached instead of asking the external service on every deploy.
+const serverIPCacheDuration = 10 * time.Minute
+
+func (s *APIServer) handleServerIP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.serverIPMutex.Lock()
+		defer s.serverIPMutex.Unlock()
+
+		if time.Since(s.serverIPFetchedAt) > serverIPCacheDuration {
+			var response apitypes.ServerIPResponse
+			if ip, err := helpers.GetExternalIP(); err == nil {
+				response.IPv4 = ip.String()
+			}
+			if ip, err := helpers.GetExternalIPv6(); err == nil {
+				response.IPv6 = ip.String()
+			}
+			if response.IPv4 == "" && response.IPv6 == "" {
+				httpError(w, "Failed to determine the public IP address of the server", http.StatusBadGateway)
+				return
+			}
+			s.serverIP = response
+			s.serverIPFetchedAt = time.Now()
+		}
+
+		encodeJSON(w, http.StatusOK, s.serverIP)
+	}
+}
@@ -3,11 +3,14 @@ package api
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 
 	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/deploy"
 	"github.com/ameistad/haloy/internal/docker"
 	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/docker/docker/api/types/container"
@@ -17,7 +20,7 @@ func (s *APIServer) handleAppStatus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		appName := r.PathValue("appName")
 		if appName == "" {
-			http.Error(w, "App name is required", http.StatusBadRequest)
+			httpError(w, "App name is required", http.StatusBadRequest)
 			return
 		}
 
@@ -27,28 +30,53 @@ func (s *APIServer) handleAppStatus() http.HandlerFunc {
 
 		cli, err := docker.NewClient(ctx)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		defer cli.Close()
 
 		containerList, err := docker.GetAppContainers(ctx, cli, true, appName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		if len(containerList) == 0 {
-			http.Error(w, "No containers found for the specified app", http.StatusNotFound)
+			httpError(w, "No containers found for the specified app", http.StatusNotFound)
 			return
 		}
 
 		response, err := getResponse(containerList)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			httpError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		// Stopped containers of a paused app are reported as paused, not exited.
+		if paused, err := deploy.PausedApp(appName); err == nil && paused != nil {
+			response.State = "paused"
+		}
+
+		// Annotations aren't container labels, they're stored with the deployment spec.
+		if spec, err := deploy.LoadSpec(response.DeploymentID); err == nil && spec != nil {
+			response.Annotations = spec.Annotations
+		}
+
+		// The app's backend is named after the app. Traffic is left out when HAProxy can't be reached.
+		if stats := s.haproxyStats.Load(); stats != nil {
+			if backends, err := (*stats)(ctx); err == nil {
+				if backend, ok := backends[appName]; ok {
+					response.Traffic = &backend
+				}
+			}
+		}
+
+		if response.ImageID != "" {
+			if imageInfo, err := cli.ImageInspect(ctx, response.ImageID); err == nil {
+				response.RepoDigests = imageInfo.RepoDigests
+			}
+		}
+
 		encodeJSON(w, http.StatusOK, response)
 	}
 }
@@ -63,6 +91,10 @@ func getResponse(containers []container.Summary) (apitypes.AppStatusResponse, er
 		containerIDs []string
 		states       []string
 		domains      []config.Domain
+		addresses    []string
+		exposure     config.Exposure
+		networkAlias string
+		imageID      string
 	}
 
 	deploymentMap := make(map[string]*deploymentData)
@@ -87,9 +119,22 @@ func getResponse(containers []container.Summary) (apitypes.AppStatusResponse, er
 		deploymentMap[labels.DeploymentID].containerIDs = append(deploymentMap[labels.DeploymentID].containerIDs, c.ID)
 		deploymentMap[labels.DeploymentID].states = append(deploymentMap[labels.DeploymentID].states, strings.ToLower(c.State))
 		deploymentMap[labels.DeploymentID].domains = append(deploymentMap[labels.DeploymentID].domains, labels.Domains...)
+		deploymentMap[labels.DeploymentID].exposure = labels.Exposure
+		deploymentMap[labels.DeploymentID].imageID = c.ImageID
+		if c.HostConfig.NetworkMode == constants.DockerNetwork {
+			deploymentMap[labels.DeploymentID].networkAlias = docker.AppNetworkAlias(labels.AppName)
+		}
+		if len(c.Names) > 0 {
+			port := labels.Port.String()
+			if port == "" {
+				port = constants.DefaultContainerPort
+			}
+			address := net.JoinHostPort(strings.TrimPrefix(c.Names[0], "/"), port)
+			deploymentMap[labels.DeploymentID].addresses = append(deploymentMap[labels.DeploymentID].addresses, address)
+		}
 
 		// Track latest deployment
-		if labels.DeploymentID > latestDeploymentID {
+		if helpers.CompareDeploymentIDs(labels.DeploymentID, latestDeploymentID) > 0 {
 			latestDeploymentID = labels.DeploymentID
 		}
 	}
@@ -109,6 +154,10 @@ func getResponse(containers []container.Summary) (apitypes.AppStatusResponse, er
 		DeploymentID: latestDeploymentID,
 		ContainerIDs: latestDeployment.containerIDs,
 		Domains:      latestDeployment.domains,
+		Exposure:     latestDeployment.exposure,
+		NetworkAlias: latestDeployment.networkAlias,
+		Addresses:    latestDeployment.addresses,
+		ImageID:      latestDeployment.imageID,
 	}, nil
 }
 
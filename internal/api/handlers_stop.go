@@ -2,9 +2,11 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/deploy"
 	"github.com/ameistad/haloy/internal/docker"
 	"github.com/ameistad/haloy/internal/logging"
 )
@@ -13,49 +15,137 @@ func (s *APIServer) handleStopApp() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		appName := r.PathValue("appName")
 		if appName == "" {
-			http.Error(w, "App name is required", http.StatusBadRequest)
+			httpError(w, "App name is required", http.StatusBadRequest)
 			return
 		}
 
 		removeContainers := r.URL.Query().Get("remove-containers") == "true"
 
-		logger := logging.NewLogger(s.logLevel, s.logBroker)
-
-		go func() {
-			ctx := context.Background()
-			cli, err := docker.NewClient(ctx)
+		if removeContainers && s.protects(appName) {
+			action, err := s.holdAction(r, actionRemove, appName, fmt.Sprintf("Stop %s and remove its containers", appName),
+				stopActionRequest{RemoveContainers: true})
 			if err != nil {
-				logger.Error("Failed to create Docker client for stop operation", "app", appName, "error", err)
+				httpError(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			defer cli.Close()
+			encodeJSON(w, http.StatusAccepted, apitypes.StopAppResponse{
+				Message:       fmt.Sprintf("Removing the containers of %s needs the confirmation of a second token", appName),
+				PendingAction: action,
+			})
+			return
+		}
+
+		s.stopApp(appName, removeContainers)
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		response := apitypes.StopAppResponse{
+			Message: "Stop operation started. Use 'haloy logs' to monitor progress.",
+		}
+
+		if err := encodeJSON(w, http.StatusAccepted, response); err != nil {
+			logger.Error("Failed to write response", "error", err)
+		}
+	}
+}
+
+// stopApp stops the containers and sidecars of an app in the background, and removes them with removeContainers.
+func (s *APIServer) stopApp(appName string, removeContainers bool) {
+	logger := logging.NewLogger(s.logLevel, s.logBroker)
+
+	go func() {
+		ctx := context.Background()
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			logger.Error("Failed to create Docker client for stop operation", "app", appName, "error", err)
+			return
+		}
+		defer cli.Close()
+
+		logger.Info("Stopping containers", "app", appName)
+		stoppedIDs, err := docker.StopContainers(ctx, cli, logger, appName, "")
+		if err != nil {
+			logger.Error("Failed to stop containers", "app", appName, "error", err)
+			return
+		}
 
-			logger.Info("Stopping containers", "app", appName)
-			stoppedIDs, err := docker.StopContainers(ctx, cli, logger, appName, "")
+		if _, err := docker.StopSidecars(ctx, cli, logger, appName, ""); err != nil {
+			logger.Error("Failed to stop sidecars", "app", appName, "error", err)
+			return
+		}
+
+		if removeContainers {
+			logger.Info("Removing containers", "app", appName)
+			removedIDs, err := docker.RemoveContainers(ctx, cli, logger, appName, "")
 			if err != nil {
-				logger.Error("Failed to stop containers", "app", appName, "error", err)
+				logger.Error("Failed to remove containers", "app", appName, "error", err)
 				return
 			}
-
-			if removeContainers {
-				logger.Info("Removing containers", "app", appName)
-				removedIDs, err := docker.RemoveContainers(ctx, cli, logger, appName, "")
-				if err != nil {
-					logger.Error("Failed to remove containers", "app", appName, "error", err)
-					return
-				}
-				logger.Info("Successfully removed containers", "app", appName, "removed_count", len(removedIDs), "container_ids", removedIDs)
+			if _, err := docker.RemoveSidecars(ctx, cli, logger, appName, ""); err != nil {
+				logger.Error("Failed to remove sidecars", "app", appName, "error", err)
+				return
 			}
+			// The A/B test ends with the app, its variant deployment would otherwise be left running.
+			if _, err := docker.RemoveABVariantContainers(ctx, cli, logger, appName, ""); err != nil {
+				logger.Warn("Failed to remove A/B test variant", "app", appName, "error", err)
+			}
+			if err := deploy.StopABTest(appName); err != nil {
+				logger.Warn("Failed to stop A/B test", "app", appName, "error", err)
+			}
+			// A paused app without containers can't be resumed, its domains stop serving the maintenance page.
+			if err := deploy.ClearPausedApp(appName); err != nil {
+				logger.Warn("Failed to clear paused state", "app", appName, "error", err)
+			}
+			logger.Info("Successfully removed containers", "app", appName, "removed_count", len(removedIDs), "container_ids", removedIDs)
+		}
 
-			logger.Info("Successfully stopped containers", "app", appName, "stopped_count", len(stoppedIDs), "container_ids", stoppedIDs)
-		}()
+		logger.Info("Successfully stopped containers", "app", appName, "stopped_count", len(stoppedIDs), "container_ids", stoppedIDs)
+	}()
+}
 
-		response := apitypes.StopAppResponse{
-			Message: "Stop operation started. Use 'haloy logs' to monitor progress.",
+func (s *APIServer) handleRestartApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			httpError(w, "App name is required", http.StatusBadRequest)
+			return
 		}
 
-		if err := encodeJSON(w, http.StatusAccepted, response); err != nil {
-			logger.Error("Failed to write response", "error", err)
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		paused, err := deploy.PausedApp(appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if paused != nil {
+			httpError(w, "App is paused, use 'haloy resume' to start it", http.StatusConflict)
+			return
 		}
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Restarting containers", "app", appName)
+		restartedIDs, err := docker.RestartContainers(ctx, cli, logger, appName)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(restartedIDs) == 0 {
+			httpError(w, "No containers found for the specified app", http.StatusNotFound)
+			return
+		}
+		logger.Info("Successfully restarted containers", "app", appName, "restarted_count", len(restartedIDs))
+
+		encodeJSON(w, http.StatusOK, apitypes.RestartAppResponse{
+			Message:      fmt.Sprintf("Restarted %d container(s)", len(restartedIDs)),
+			ContainerIDs: restartedIDs,
+		})
 	}
 }
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+// DockerStatusFunc returns the connection state of haloyd to the Docker daemon.
+type DockerStatusFunc func() apitypes.DockerStatus
+
+// SetDockerStatus enables the Docker connection state in the system and health responses.
+func (s *APIServer) SetDockerStatus(dockerStatus DockerStatusFunc) {
+	s.dockerStatus.Store(&dockerStatus)
+}
+
+// dockerConnection returns the Docker connection state, reported as connected until haloyd sets it.
+func (s *APIServer) dockerConnection() apitypes.DockerStatus {
+	if dockerStatus := s.dockerStatus.Load(); dockerStatus != nil {
+		return (*dockerStatus)()
+	}
+	return apitypes.DockerStatus{Connected: true}
+}
+
+// handleSystem returns the state of haloyd itself, e.g. whether the Docker daemon is reachable.
+func (s *APIServer) handleSystem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := s.logBroker.Stats()
+		encodeJSON(w, http.StatusOK, apitypes.SystemResponse{
+			Version: constants.Version,
+			Arch:    runtime.GOARCH,
+			Docker:  s.dockerConnection(),
+			LogStreams: apitypes.LogStreamStatus{
+				Subscribers:    stats.Subscribers,
+				DroppedEntries: stats.DroppedEntries,
+			},
+		})
+	}
+}
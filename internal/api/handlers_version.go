@@ -1,17 +1,28 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/storage"
 )
 
 func (s *APIServer) handleVersion() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		schemaVersion, err := deploy.SchemaVersion()
+		if err != nil {
+			httpError(w, fmt.Sprintf("Failed to get database schema version: %v", err), http.StatusInternalServerError)
+			return
+		}
+
 		response := apitypes.VersionResponse{
-			Version:        constants.Version,
-			HAProxyVersion: constants.HAProxyVersion,
+			Version:             constants.Version,
+			HAProxyVersion:      constants.HAProxyVersion,
+			SchemaVersion:       schemaVersion,
+			LatestSchemaVersion: storage.LatestSchemaVersion(),
 		}
 
 		encodeJSON(w, http.StatusOK, response)
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ImageUpdate is a new image of an app, found in its registry by the image watcher of haloyd.
+type ImageUpdate struct {
+	AppName string
+	Tag     string
+	// Annotations describe the update in the deployment history.
+	Annotations map[string]string
+	// RequireApproval holds the deployment for approval, also when the target doesn't require it.
+	RequireApproval bool
+}
+
+// ImageUpdateResult is the deployment of an image update. State is "deploying", "pending" when it waits for
+// approval or "queued" when it waits for the end of a freeze window.
+type ImageUpdateResult struct {
+	DeploymentID string
+	State        string
+	QueuedUntil  *time.Time
+}
+
+// DeployImageUpdate deploys the current deployment of an app again with the tag of the update, like a deploy
+// webhook does. It waits for approval and freeze windows like other deployments. During a freeze window that
+// rejects deployments an error is returned, the watcher finds the update again after the window.
+func (s *APIServer) DeployImageUpdate(ctx context.Context, update ImageUpdate) (ImageUpdateResult, error) {
+	currentID, spec, err := currentSpec(ctx, update.AppName)
+	if err != nil {
+		return ImageUpdateResult{}, err
+	}
+	if spec == nil || spec.Image == nil {
+		return ImageUpdateResult{}, fmt.Errorf("app '%s' has no deployment to update", update.AppName)
+	}
+
+	req := redeployRequest(currentID, *spec, update.Tag, update.Annotations)
+	result := ImageUpdateResult{DeploymentID: req.DeploymentID, State: "deploying"}
+	if spec.RequireApproval || update.RequireApproval {
+		s.addPendingDeployment(req)
+		result.State = "pending"
+		return result, nil
+	}
+
+	// The watcher has no client request, the request only carries the context of the deployment.
+	r, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodPost, "/", nil)
+	if err != nil {
+		return ImageUpdateResult{}, err
+	}
+	if window, until, frozen := s.activeFreeze(); frozen {
+		if !s.queuesFrozenDeployments() {
+			return ImageUpdateResult{}, fmt.Errorf("deployments are frozen by '%s' until %s", window.DisplayName(), until.UTC().Format(time.RFC3339))
+		}
+		s.queueDeployment(r, req, until)
+		result.State = "queued"
+		result.QueuedUntil = &until
+		return result, nil
+	}
+	if !s.runDeployment(r, req) {
+		return ImageUpdateResult{}, fmt.Errorf("haloyd is shutting down")
+	}
+	return result, nil
+}
@@ -2,35 +2,161 @@ package api
 
 import (
 	"crypto/subtle"
+	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/logging"
 )
 
+// correlationMiddleware passes the correlation ID sent by the client on in the request context, or creates
+// one. The ID is returned in the response and logged with the request and the deployments it starts.
+func (s *APIServer) correlationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID := r.Header.Get(constants.HeaderCorrelationID)
+		if !logging.IsValidCorrelationID(correlationID) {
+			correlationID = logging.NewCorrelationID()
+		}
+		w.Header().Set(constants.HeaderCorrelationID, correlationID)
+		if !isHealthPath(r.URL.Path) {
+			logging.NewLogger(s.logLevel, s.logBroker).Debug("API request",
+				"method", r.Method, "path", r.URL.Path, "client_ip", s.clientIP(r), logging.AttrCorrelationID, correlationID)
+		}
+		next.ServeHTTP(w, r.WithContext(logging.WithCorrelationID(r.Context(), correlationID)))
+	})
+}
+
 func (s *APIServer) bearerTokenAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.tokenAuthMiddleware(next, func() []string { return []string{s.apiToken} })
+}
+
+// approveTokenAuthMiddleware only accepts the approve token, or the API token when no approve token is set.
+func (s *APIServer) approveTokenAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.tokenAuthMiddleware(next, func() []string { return []string{s.approveTokenOrDefault()} })
+}
+
+// anyTokenAuthMiddleware accepts both the API token and the approve token.
+func (s *APIServer) anyTokenAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.tokenAuthMiddleware(next, func() []string { return []string{s.apiToken, s.approveTokenOrDefault()} })
+}
+
+func (s *APIServer) approveTokenOrDefault() string {
+	if s.approveToken != "" {
+		return s.approveToken
+	}
+	return s.apiToken
+}
+
+// tokenAuthMiddleware checks the bearer token against validTokens, which is called per request. Session tokens
+// and OIDC ID tokens act as the token they resolve to, see resolveToken. Requests with an invalid token count towards the lockout of their client IP, see
+// rateLimitMiddleware.
+func (s *APIServer) tokenAuthMiddleware(next http.HandlerFunc, validTokens func() []string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+		token, ok := requestToken(w, r)
+		if !ok {
+			return
+		}
+		token = s.resolveToken(token)
+
+		for _, validToken := range validTokens() {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(validToken)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if appToken, found := s.findAppToken(token); found {
+			writeError(w, http.StatusForbidden, apitypes.ErrCodeForbidden,
+				fmt.Sprintf("Token '%s' is restricted to apps and can't use this endpoint", appToken.Name),
+				map[string]any{"token": appToken.Name})
 			return
 		}
+		s.authFailed(r)
+		httpError(w, "Invalid token", http.StatusUnauthorized)
+	}
+}
 
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Invalid authorization format. Expected 'Bearer <token>'", http.StatusUnauthorized)
+// appTokenAuthMiddleware accepts the API token and the app tokens. An app token is only accepted for the apps it
+// can manage: the app in the path is checked here, handlers check the app of the request body with authorizeApp.
+func (s *APIServer) appTokenAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := requestToken(w, r)
+		if !ok {
 			return
 		}
+		token = s.resolveToken(token)
 
-		// Extract the token
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == "" {
-			http.Error(w, "Empty token", http.StatusUnauthorized)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) == 1 {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		if subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) != 1 {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		appToken, found := s.findAppToken(token)
+		if !found {
+			s.authFailed(r)
+			httpError(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
+		r = r.WithContext(withAppToken(r.Context(), appToken))
+		if appName := r.PathValue("appName"); appName != "" && !authorizeApp(w, r, appName) {
+			return
+		}
 		next.ServeHTTP(w, r)
 	}
 }
+
+// confirmTokenAuthMiddleware accepts the tokens of appTokenAuthMiddleware and the approve token, so approvers
+// can confirm protected operations as the second token.
+func (s *APIServer) confirmTokenAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	appAuth := s.appTokenAuthMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.resolveToken(bearerToken(r))
+		if s.approveToken != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.approveToken)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		appAuth(w, r)
+	}
+}
+
+// resolveToken returns the token a request acts as: the API token for session tokens and the ID tokens of OIDC
+// users with the admin scope, the approve token for OIDC users with the approve scope, and any other token
+// unchanged. OIDC users with the apps scope act as an app token, see findAppToken.
+func (s *APIServer) resolveToken(token string) string {
+	if s.validSession(token) {
+		return s.apiToken
+	}
+	if identity, ok := s.oidcIdentity(token); ok {
+		switch {
+		case identity.grant.Admin:
+			return s.apiToken
+		case identity.grant.Approve && s.approveToken != "":
+			return s.approveToken
+		}
+	}
+	return token
+}
+
+// requestToken returns the bearer token of the request, or writes an error response.
+func requestToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		httpError(w, "Authorization header required", http.StatusUnauthorized)
+		return "", false
+	}
+
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		httpError(w, "Invalid authorization format. Expected 'Bearer <token>'", http.StatusUnauthorized)
+		return "", false
+	}
+
+	// Extract the token
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == "" {
+		httpError(w, "Empty token", http.StatusUnauthorized)
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	oidcRequestTimeout = 10 * time.Second
+	// oidcKeysRefreshInterval limits how often the signing keys are fetched again for an unknown key ID.
+	oidcKeysRefreshInterval = time.Minute
+	// oidcMaxVerified bounds the cache of verified ID tokens.
+	oidcMaxVerified = 1000
+)
+
+var oidcSignatureAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384, jose.ES512, jose.PS256, jose.EdDSA}
+
+// oidcDiscovery holds the endpoints of the discovery document of the provider.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcIdentity is a user signed in with a verified ID token.
+type oidcIdentity struct {
+	subject   string
+	nonce     string
+	grant     config.OIDCGrant
+	expiresAt time.Time
+}
+
+// oidcProvider verifies the ID tokens of the issuer of api.oidc and runs the sign-in of the dashboard and the CLI.
+type oidcProvider struct {
+	config       config.APIOIDC
+	clientSecret string
+	client       *http.Client
+
+	mutex         sync.Mutex
+	discovery     *oidcDiscovery
+	keys          jose.JSONWebKeySet
+	keysFetchedAt time.Time
+	// Verified ID tokens by token key, so the signature is only checked once per token.
+	verified map[string]oidcIdentity
+	// Sign-ins waiting for the callback of the provider, by state.
+	logins map[string]oidcLogin
+}
+
+func newOIDCProvider(oidcConfig config.APIOIDC, clientSecret string) *oidcProvider {
+	return &oidcProvider{
+		config:       oidcConfig,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: oidcRequestTimeout},
+		verified:     make(map[string]oidcIdentity),
+		logins:       make(map[string]oidcLogin),
+	}
+}
+
+// setOIDC replaces the OIDC provider when api.oidc changed, an unchanged provider keeps its keys and sign-ins.
+func (s *APIServer) setOIDC(oidcConfig config.APIOIDC) {
+	if !oidcConfig.Enabled() {
+		s.oidc.Store(nil)
+		return
+	}
+	if current := s.oidc.Load(); current != nil && reflect.DeepEqual(current.config, oidcConfig) {
+		return
+	}
+	s.oidc.Store(newOIDCProvider(oidcConfig, os.Getenv(constants.EnvVarOIDCClientSecret)))
+}
+
+// oidcIdentity returns the user of an ID token of the configured issuer.
+func (s *APIServer) oidcIdentity(token string) (oidcIdentity, bool) {
+	provider := s.oidc.Load()
+	// ID tokens are JWTs, the other tokens never have three parts.
+	if provider == nil || strings.Count(token, ".") != 2 {
+		return oidcIdentity{}, false
+	}
+	identity, err := provider.verify(token)
+	if err != nil {
+		return oidcIdentity{}, false
+	}
+	return identity, true
+}
+
+// oidcTokenName names an OIDC user in responses and logs, like the name of an app token.
+func oidcTokenName(subject string) string {
+	return "oidc:" + subject
+}
+
+// getDiscovery returns the discovery document of the issuer, it's fetched once.
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mutex.Lock()
+	discovery := p.discovery
+	p.mutex.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var fetched oidcDiscovery
+	if err := p.getJSON(ctx, discoveryURL, &fetched); err != nil {
+		return nil, fmt.Errorf("failed to read OIDC discovery document: %w", err)
+	}
+	if fetched.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery document is for issuer '%s', expected '%s'", fetched.Issuer, p.config.Issuer)
+	}
+	if fetched.JWKSURI == "" || fetched.AuthorizationEndpoint == "" || fetched.TokenEndpoint == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	p.mutex.Lock()
+	p.discovery = &fetched
+	p.mutex.Unlock()
+	return &fetched, nil
+}
+
+// signingKey returns the key the provider signed a token with. The keys are fetched again for an unknown key ID,
+// so rotated keys are picked up.
+func (p *oidcProvider) signingKey(ctx context.Context, keyID string) (*jose.JSONWebKey, error) {
+	p.mutex.Lock()
+	key := findSigningKey(p.keys, keyID)
+	fresh := time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval
+	p.mutex.Unlock()
+	if key != nil {
+		return key, nil
+	}
+	if fresh {
+		return nil, fmt.Errorf("unknown signing key '%s'", keyID)
+	}
+
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var keys jose.JSONWebKeySet
+	if err := p.getJSON(ctx, discovery.JWKSURI, &keys); err != nil {
+		return nil, fmt.Errorf("failed to read OIDC signing keys: %w", err)
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mutex.Unlock()
+
+	if key := findSigningKey(keys, keyID); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key '%s'", keyID)
+}
+
+func findSigningKey(keys jose.JSONWebKeySet, keyID string) *jose.JSONWebKey {
+	if keyID == "" {
+		// Without a key ID the token can only be verified when the provider has a single key.
+		if len(keys.Keys) == 1 {
+			return &keys.Keys[0]
+		}
+		return nil
+	}
+	if found := keys.Key(keyID); len(found) > 0 {
+		return &found[0]
+	}
+	return nil
+}
+
+// verify checks the signature, issuer, audience and expiry of an ID token and maps the groups of the user to
+// their access.
+func (p *oidcProvider) verify(token string) (oidcIdentity, error) {
+	key := tokenKey(token)
+	now := time.Now()
+	p.mutex.Lock()
+	if identity, ok := p.verified[key]; ok && now.Before(identity.expiresAt) {
+		p.mutex.Unlock()
+		return identity, nil
+	}
+	p.mutex.Unlock()
+
+	parsed, err := jwt.ParseSigned(token, oidcSignatureAlgorithms)
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+	if len(parsed.Headers) != 1 {
+		return oidcIdentity{}, errors.New("ID token must have a single signature")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcRequestTimeout)
+	defer cancel()
+	signingKey, err := p.signingKey(ctx, parsed.Headers[0].KeyID)
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+
+	var claims jwt.Claims
+	var extra map[string]any
+	if err := parsed.Claims(signingKey, &claims, &extra); err != nil {
+		return oidcIdentity{}, err
+	}
+	if claims.Expiry == nil || claims.Subject == "" {
+		return oidcIdentity{}, errors.New("ID token is missing the exp or sub claim")
+	}
+	expected := jwt.Expected{Issuer: p.config.Issuer, AnyAudience: jwt.Audience{p.config.ClientID}, Time: now}
+	if err := claims.ValidateWithLeeway(expected, time.Minute); err != nil {
+		return oidcIdentity{}, err
+	}
+
+	nonce, _ := extra["nonce"].(string)
+	identity := oidcIdentity{
+		subject:   claims.Subject,
+		nonce:     nonce,
+		grant:     p.config.Grant(claimStrings(extra[p.config.GroupsClaimName()])),
+		expiresAt: claims.Expiry.Time(),
+	}
+
+	p.mutex.Lock()
+	if len(p.verified) >= oidcMaxVerified {
+		for k, v := range p.verified {
+			if !now.Before(v.expiresAt) {
+				delete(p.verified, k)
+			}
+		}
+		if len(p.verified) >= oidcMaxVerified {
+			p.verified = make(map[string]oidcIdentity)
+		}
+	}
+	p.verified[key] = identity
+	p.mutex.Unlock()
+	return identity, nil
+}
+
+// claimStrings returns a claim that is a string or a list of strings.
+func claimStrings(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
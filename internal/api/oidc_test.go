@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const testClientID = "haloy"
+
+// newTestIssuer serves the discovery document and signing keys of a provider that signs with key.
+func newTestIssuer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			JWKSURI:               server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	return server
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, claims jwt.Claims) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Claims(map[string]any{"groups": []string{"ops"}}).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestOIDCVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := newTestIssuer(t, key)
+	provider := newOIDCProvider(config.APIOIDC{
+		Issuer:   issuer.URL,
+		ClientID: testClientID,
+		Groups:   []config.OIDCGroupScope{{Group: "ops", Scope: "admin"}},
+	}, "")
+
+	now := time.Now()
+	valid := jwt.Claims{
+		Issuer:   issuer.URL,
+		Subject:  "alice",
+		Audience: jwt.Audience{testClientID},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+	with := func(change func(c *jwt.Claims)) jwt.Claims {
+		c := valid
+		change(&c)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: signIDToken(t, key, valid)},
+		{name: "expired", token: signIDToken(t, key, with(func(c *jwt.Claims) {
+			c.Expiry = jwt.NewNumericDate(now.Add(-time.Hour))
+		})), wantErr: true},
+		{name: "wrong audience", token: signIDToken(t, key, with(func(c *jwt.Claims) {
+			c.Audience = jwt.Audience{"other-client"}
+		})), wantErr: true},
+		{name: "wrong issuer", token: signIDToken(t, key, with(func(c *jwt.Claims) {
+			c.Issuer = "https://evil.example.com"
+		})), wantErr: true},
+		{name: "missing expiry", token: signIDToken(t, key, with(func(c *jwt.Claims) {
+			c.Expiry = nil
+		})), wantErr: true},
+		{name: "signed by another key", token: signIDToken(t, otherKey, valid), wantErr: true},
+		{name: "not a JWT", token: "a.b.c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := provider.verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (identity.subject != "alice" || !identity.grant.Admin) {
+				t.Errorf("verify() = %+v, expected subject alice with admin access", identity)
+			}
+		})
+	}
+}
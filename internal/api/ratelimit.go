@@ -0,0 +1,218 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+// rateLimitPruneInterval is how often idle request buckets and expired lockouts are removed.
+const rateLimitPruneInterval = time.Minute
+
+// apiLimiter limits the requests per client IP and per token with token buckets, and locks out client IPs
+// after repeated authentication failures.
+type apiLimiter struct {
+	mutex     sync.Mutex
+	config    config.APIRateLimit
+	buckets   map[string]*requestBucket // "ip:<ip>" or "token:<hash>" -> bucket
+	failures  map[string]*authFailures  // client IP -> failures
+	lastPrune time.Time
+}
+
+type requestBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type authFailures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+func newAPILimiter() *apiLimiter {
+	return &apiLimiter{
+		buckets:  make(map[string]*requestBucket),
+		failures: make(map[string]*authFailures),
+	}
+}
+
+// SetRateLimit sets the request limits and the lockout after failed authentications. Current buckets and
+// lockouts are kept.
+func (s *APIServer) SetRateLimit(rateLimit config.APIRateLimit) {
+	s.limiter.mutex.Lock()
+	defer s.limiter.mutex.Unlock()
+	s.limiter.config = rateLimit
+}
+
+// allow takes a request from the bucket of key. It returns 0 when the request is allowed, otherwise how
+// long until the next request is.
+func (l *apiLimiter) allow(key string, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.prune(now)
+
+	limit := float64(l.config.RequestLimit())
+	perSecond := limit / 60
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &requestBucket{tokens: limit, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = min(limit, bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+}
+
+// lockedFor returns how long the client IP is still locked out, or 0.
+func (l *apiLimiter) lockedFor(ip string, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if f, exists := l.failures[ip]; exists && now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// authFailed counts a failed authentication of the client IP. It returns the failures counted and, when the
+// IP is locked out by this failure, until when. Failures count within the lockout duration of the first one.
+// Successful authentications don't reset them, so a valid token with few rights, like an app token, can't
+// be used to keep guessing other tokens.
+func (l *apiLimiter) authFailed(ip string, now time.Time) (int, time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lockout := l.config.LockoutDuration()
+	f, exists := l.failures[ip]
+	if !exists || now.Sub(f.first) > lockout {
+		f = &authFailures{first: now}
+		l.failures[ip] = f
+	}
+	f.count++
+	if f.count < l.config.FailureThreshold() {
+		return f.count, time.Time{}
+	}
+
+	count := f.count
+	// The failures are counted again from zero once the lockout ends.
+	f.count = 0
+	f.first = now
+	f.lockedUntil = now.Add(lockout)
+	return count, f.lockedUntil
+}
+
+// prune removes buckets that are full again and failures that no longer count. Callers hold the mutex.
+func (l *apiLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	// A bucket refills completely within a minute.
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+	lockout := l.config.LockoutDuration()
+	for ip, f := range l.failures {
+		if now.After(f.lockedUntil) && now.Sub(f.first) > lockout {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// rateLimitMiddleware rejects requests to the /v1 endpoints and the /v2 registry from locked out client IPs,
+// and requests beyond the limit per client IP and per token.
+func (s *APIServer) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") && !strings.HasPrefix(r.URL.Path, "/v2/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		ip := s.clientIP(r)
+		if retryAfter := s.limiter.lockedFor(ip, now); retryAfter > 0 {
+			rateLimited(w, "Too many failed authentications, try again later", retryAfter)
+			return
+		}
+		if retryAfter := s.limiter.allow("ip:"+ip, now); retryAfter > 0 {
+			rateLimited(w, "Too many requests from this address", retryAfter)
+			return
+		}
+		token := bearerToken(r)
+		if _, password, ok := r.BasicAuth(); ok {
+			// docker login sends the token to the registry as the password.
+			token = password
+		}
+		if token != "" {
+			if retryAfter := s.limiter.allow("token:"+tokenKey(token), now); retryAfter > 0 {
+				rateLimited(w, "Too many requests with this token", retryAfter)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authFailed counts a failed authentication of the request, and logs and publishes an api.lockout event when
+// its client IP gets locked out.
+func (s *APIServer) authFailed(r *http.Request) {
+	ip := s.clientIP(r)
+	failures, lockedUntil := s.limiter.authFailed(ip, time.Now())
+	if lockedUntil.IsZero() {
+		return
+	}
+
+	logging.NewLogger(s.logLevel, s.logBroker).Warn("Locked out client after failed authentications",
+		"ip", ip, "failures", failures, "until", lockedUntil.Format(time.RFC3339))
+	s.eventBroker.Publish(events.Event{
+		Type: events.TypeAPILockout,
+		Data: map[string]any{
+			"ip":       ip,
+			"failures": failures,
+			"until":    lockedUntil,
+		},
+	})
+}
+
+// rateLimited writes a 429 response with the seconds until the client can retry in the Retry-After header.
+func rateLimited(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, http.StatusTooManyRequests, apitypes.ErrCodeRateLimited, message, map[string]any{"retryAfter": seconds})
+}
+
+// bearerToken returns the token of the Authorization header, or an empty string.
+func bearerToken(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return token
+}
+
+// tokenKey identifies a token in the rate limits without keeping the token itself in memory.
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
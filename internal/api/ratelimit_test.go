@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+)
+
+func TestAPILimiterAllow(t *testing.T) {
+	l := newAPILimiter()
+	l.config = config.APIRateLimit{RequestsPerMinute: 60}
+	now := time.Now()
+
+	for i := range 60 {
+		if retryAfter := l.allow("ip:198.51.100.7", now); retryAfter != 0 {
+			t.Fatalf("request %d limited, retry after %s", i+1, retryAfter)
+		}
+	}
+	retryAfter := l.allow("ip:198.51.100.7", now)
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("allow() after the limit = %s, expected up to a second", retryAfter)
+	}
+	if retryAfter := l.allow("ip:198.51.100.8", now); retryAfter != 0 {
+		t.Errorf("allow() of another key = %s, expected 0", retryAfter)
+	}
+	// One request per second at 60 a minute.
+	if retryAfter := l.allow("ip:198.51.100.7", now.Add(time.Second)); retryAfter != 0 {
+		t.Errorf("allow() after a second = %s, expected 0", retryAfter)
+	}
+}
+
+func TestAPILimiterLockout(t *testing.T) {
+	l := newAPILimiter()
+	l.config = config.APIRateLimit{AuthFailures: 3, Lockout: "10m"}
+	now := time.Now()
+	ip := "198.51.100.7"
+
+	for i := range 2 {
+		if count, lockedUntil := l.authFailed(ip, now); count != i+1 || !lockedUntil.IsZero() {
+			t.Fatalf("authFailed() = %d, %v, expected %d and no lockout", count, lockedUntil, i+1)
+		}
+	}
+	if _, lockedUntil := l.authFailed(ip, now); !lockedUntil.Equal(now.Add(10 * time.Minute)) {
+		t.Fatalf("authFailed() locked until %v, expected %v", lockedUntil, now.Add(10*time.Minute))
+	}
+	if lockedFor := l.lockedFor(ip, now.Add(time.Minute)); lockedFor != 9*time.Minute {
+		t.Errorf("lockedFor() = %s, expected 9m", lockedFor)
+	}
+	if lockedFor := l.lockedFor("198.51.100.8", now); lockedFor != 0 {
+		t.Errorf("lockedFor() of another IP = %s, expected 0", lockedFor)
+	}
+	if lockedFor := l.lockedFor(ip, now.Add(10*time.Minute)); lockedFor != 0 {
+		t.Errorf("lockedFor() after the lockout = %s, expected 0", lockedFor)
+	}
+}
+
+func TestAPILimiterFailuresExpire(t *testing.T) {
+	l := newAPILimiter()
+	l.config = config.APIRateLimit{AuthFailures: 3, Lockout: "10m"}
+	now := time.Now()
+	ip := "198.51.100.7"
+
+	l.authFailed(ip, now)
+	l.authFailed(ip, now)
+	// Failures older than the lockout duration no longer count.
+	if count, lockedUntil := l.authFailed(ip, now.Add(11*time.Minute)); count != 1 || !lockedUntil.IsZero() {
+		t.Errorf("authFailed() = %d, %v, expected 1 and no lockout", count, lockedUntil)
+	}
+}
+
+func TestLockoutNotResetByAppToken(t *testing.T) {
+	s := newTestServer(t)
+	s.SetRateLimit(config.APIRateLimit{AuthFailures: 3, Lockout: "10m"})
+	handler := s.rateLimitMiddleware(s.router)
+
+	request := func(token string) int {
+		r, _ := http.NewRequest(http.MethodGet, "/v1/secrets", nil)
+		r.RemoteAddr = "203.0.113.10:40000"
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Guesses of the API token with a valid app token in between still add up to a lockout.
+	for i := range 3 {
+		if code := request("guess"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d status = %d, expected %d", i+1, code, http.StatusUnauthorized)
+		}
+		if i < 2 {
+			if code := request(testAppToken); code != http.StatusOK {
+				t.Fatalf("app token status = %d, expected %d", code, http.StatusOK)
+			}
+		}
+	}
+	if code := request(testAPIToken); code != http.StatusTooManyRequests {
+		t.Errorf("status after lockout = %d, expected %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRegistryLockout(t *testing.T) {
+	s := newTestServer(t)
+	s.SetRateLimit(config.APIRateLimit{AuthFailures: 3, Lockout: "10m"})
+	if err := s.EnableRegistry(t.TempDir()); err != nil {
+		t.Fatalf("EnableRegistry() error = %v", err)
+	}
+	handler := s.rateLimitMiddleware(s.router)
+
+	request := func(password string) int {
+		r, _ := http.NewRequest(http.MethodGet, "/v2/", nil)
+		r.RemoteAddr = "203.0.113.10:40000"
+		if password != "" {
+			r.SetBasicAuth("haloy", password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// The challenge request of docker login has no credentials and isn't a failure.
+	for range 5 {
+		if code := request(""); code != http.StatusUnauthorized {
+			t.Fatalf("status without credentials = %d, expected %d", code, http.StatusUnauthorized)
+		}
+	}
+	if code := request(testAPIToken); code != http.StatusOK {
+		t.Fatalf("status with the API token = %d, expected %d", code, http.StatusOK)
+	}
+	for i := range 3 {
+		if code := request("guess"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d status = %d, expected %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+	if code := request(testAPIToken); code != http.StatusTooManyRequests {
+		t.Errorf("status after lockout = %d, expected %d", code, http.StatusTooManyRequests)
+	}
+}
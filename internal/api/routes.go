@@ -2,15 +2,59 @@ package api
 
 func (s *APIServer) setupRoutes() {
 	authMiddleware := s.bearerTokenAuthMiddleware
+	// Endpoints app tokens can use, limited to their apps.
+	appAuthMiddleware := s.appTokenAuthMiddleware
 
 	s.router.Handle("GET /health", s.handleHealth())
-	s.router.Handle("POST /v1/deploy", authMiddleware(s.handleDeploy()))
-	s.router.Handle("GET /v1/deploy/{deploymentID}/logs", authMiddleware(s.handleDeploymentLogs()))
+	s.router.Handle("GET /livez", s.handleLiveness())
+	s.router.Handle("GET /readyz", s.handleReadiness())
+	s.router.Handle("GET /v1/actions", s.confirmTokenAuthMiddleware(s.handlePendingActions()))
+	s.router.Handle("POST /v1/actions/{actionID}/confirm", s.confirmTokenAuthMiddleware(s.handleConfirmAction()))
+	s.router.Handle("POST /v1/ab/start/{appName}", appAuthMiddleware(s.handleStartABTest()))
+	s.router.Handle("POST /v1/ab/stop/{appName}", appAuthMiddleware(s.handleStopABTest()))
+	s.router.Handle("GET /v1/apps", appAuthMiddleware(s.handleApps()))
+	s.router.Handle("GET /v1/apps/{appName}", appAuthMiddleware(s.handleGetApp()))
+	s.router.Handle("PUT /v1/apps/{appName}", appAuthMiddleware(s.handlePutApp()))
+	s.router.Handle("DELETE /v1/apps/{appName}", appAuthMiddleware(s.handleDeleteApp()))
+	s.router.Handle("GET /v1/certificates", authMiddleware(s.handleCertificates()))
+	s.router.Handle("GET /v1/config/{appName}", appAuthMiddleware(s.handleDeployedConfig()))
+	s.router.Handle("GET /v1/cp/{appName}", appAuthMiddleware(s.handleCopyFromContainer()))
+	s.router.Handle("PUT /v1/cp/{appName}", appAuthMiddleware(s.handleCopyToContainer()))
+	s.router.Handle("POST /v1/deploy", appAuthMiddleware(s.handleDeploy()))
+	s.router.Handle("POST /v1/deploy/dry-run", appAuthMiddleware(s.handleDeployDryRun()))
+	s.router.Handle("GET /v1/deploy/{deploymentID}/logs", appAuthMiddleware(s.handleDeploymentLogs()))
+	s.router.Handle("GET /v1/deploy/{deploymentID}/logs/history", appAuthMiddleware(s.handleDeploymentLogHistory()))
+	s.router.Handle("GET /v1/deploy/{deploymentID}/logs/download", appAuthMiddleware(s.handleDeploymentLogDownload()))
+	s.router.Handle("GET /v1/deploy/pending", s.anyTokenAuthMiddleware(s.handlePendingDeployments()))
+	s.router.Handle("POST /v1/deploy/{deploymentID}/approve", s.approveTokenAuthMiddleware(s.handleApproveDeployment()))
+	s.router.Handle("POST /v1/deploy/{deploymentID}/reject", s.approveTokenAuthMiddleware(s.handleRejectDeployment()))
+	s.router.Handle("GET /v1/export/{appName}", appAuthMiddleware(s.handleExport()))
+	s.router.Handle("GET /v1/haproxy/stats", authMiddleware(s.handleHAProxyStats()))
+	s.router.Handle("POST /v1/hooks/deploy/{appName}", s.handleDeployHook())
 	s.router.Handle("POST /v1/images/upload", authMiddleware(s.handleImageUpload()))
+	s.router.Handle("POST /v1/images/layers", authMiddleware(s.handleImageLayers()))
+	s.router.Handle("POST /v1/images/uploads", authMiddleware(s.handleImageUploadStart()))
+	s.router.Handle("PATCH /v1/images/uploads/{uploadID}", authMiddleware(s.handleImageUploadChunk()))
+	s.router.Handle("POST /v1/images/uploads/{uploadID}/complete", authMiddleware(s.handleImageUploadComplete()))
+	s.router.Handle("GET /v1/events", authMiddleware(s.handleEvents()))
 	s.router.Handle("GET /v1/logs", authMiddleware(s.handleLogs()))
-	s.router.Handle("GET /v1/rollback/{appName}", authMiddleware(s.handleRollbackTargets()))
-	s.router.Handle("POST /v1/rollback", authMiddleware(s.handleRollback()))
-	s.router.Handle("GET /v1/status/{appName}", authMiddleware(s.handleAppStatus()))
-	s.router.Handle("POST /v1/stop/{appName}", authMiddleware(s.handleStopApp()))
+	s.router.Handle("GET /v1/oidc", s.handleOIDCInfo())
+	s.router.Handle("GET /v1/oidc/login", s.handleOIDCLogin())
+	s.router.Handle("GET /v1/oidc/callback", s.handleOIDCCallback())
+	s.router.Handle("POST /v1/pause/{appName}", appAuthMiddleware(s.handlePauseApp()))
+	s.router.Handle("POST /v1/restart/{appName}", appAuthMiddleware(s.handleRestartApp()))
+	s.router.Handle("POST /v1/resume/{appName}", appAuthMiddleware(s.handleResumeApp()))
+	s.router.Handle("GET /v1/rollback/{appName}", appAuthMiddleware(s.handleRollbackTargets()))
+	s.router.Handle("POST /v1/rollback", appAuthMiddleware(s.handleRollback()))
+	s.router.Handle("POST /v1/scale/{appName}", appAuthMiddleware(s.handleScaleApp()))
+	s.router.Handle("GET /v1/secrets", appAuthMiddleware(s.handleSecrets()))
+	s.router.Handle("GET /v1/secrets/export", authMiddleware(s.handleExportSecrets()))
+	s.router.Handle("POST /v1/secrets/import", authMiddleware(s.handleImportSecrets()))
+	s.router.Handle("GET /v1/secrets/recipient", authMiddleware(s.handleSecretsRecipient()))
+	s.router.Handle("GET /v1/server/ip", appAuthMiddleware(s.handleServerIP()))
+	s.router.Handle("POST /v1/sessions", authMiddleware(s.handleCreateSession()))
+	s.router.Handle("GET /v1/status/{appName}", appAuthMiddleware(s.handleAppStatus()))
+	s.router.Handle("POST /v1/stop/{appName}", appAuthMiddleware(s.handleStopApp()))
+	s.router.Handle("GET /v1/system", appAuthMiddleware(s.handleSystem()))
 	s.router.Handle("GET /v1/version", s.handleVersion())
 }
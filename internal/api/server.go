@@ -1,33 +1,178 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/certstore"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
 	"github.com/ameistad/haloy/internal/logging"
 )
 
 // Server holds dependencies for the API handlers.
 type APIServer struct {
-	router    *http.ServeMux
-	logBroker logging.StreamPublisher
-	logLevel  slog.Level
-	apiToken  string
+	router      *http.ServeMux
+	logBroker   logging.StreamPublisher
+	eventBroker *events.Broker
+	logLevel    slog.Level
+	apiToken    string
+	// approveToken approves deployments of targets with require_approval, see EnableApprovals.
+	approveToken string
+
+	// Deployments running in the background, tracked so shutdown can wait for them.
+	deployments sync.WaitGroup
+	draining    atomic.Bool
+
+	// Deployments waiting for approval, by deployment ID. They're kept in memory and lost when haloyd restarts.
+	pendingMutex sync.Mutex
+	pending      map[string]pendingDeployment
+	// Apps of deployments that are queued or running, by deployment ID, until the deployment is stored.
+	activeMutex sync.Mutex
+	activeApps  map[string]string
+
+	// CORS origins and trusted proxies, see SetAccess.
+	access atomic.Pointer[apiAccess]
+	// Addresses of the proxy containers, whose X-Forwarded-For header is trusted.
+	proxyAddresses proxyAddresses
+	// Verifies the ID tokens of OIDC users, set by SetAccess when api.oidc is configured.
+	oidc atomic.Pointer[oidcProvider]
+	// Request limits and lockouts of client IPs, see SetRateLimit.
+	limiter *apiLimiter
+
+	// Freeze windows of the haloyd config, replaced when the config is reloaded.
+	deployConfig atomic.Pointer[config.DeployConfig]
+	// Proxy backend of the server, see SetProxyBackend.
+	proxyBackend atomic.Pointer[string]
+
+	// Renders the HAProxy config for dry-run deployments, set by haloyd once HAProxy is managed.
+	haproxyPreview atomic.Pointer[HAProxyPreviewFunc]
+	// Applies routing changes that aren't caused by containers, set by haloyd.
+	routingUpdate atomic.Pointer[RoutingUpdateFunc]
+	// Reads the HAProxy backend metrics, set by haloyd once HAProxy is managed.
+	haproxyStats atomic.Pointer[HAProxyStatsFunc]
+	// Reads the certificate state of the system domains, set by haloyd.
+	systemDomains atomic.Pointer[SystemDomainsFunc]
+	// Certificates listed by /v1/certificates, set by haloyd.
+	certStore atomic.Pointer[certstore.CertStore]
+	// Checks of /readyz besides the Docker connection, added by haloyd.
+	readinessMutex  sync.Mutex
+	readinessChecks []readinessCheck
+	// Reads the connection state of the Docker daemon, set by haloyd.
+	dockerStatus atomic.Pointer[DockerStatusFunc]
+	// Proxies the HAProxy stats page, see EnableHAProxyStatsPage.
+	haproxyStatsPage http.Handler
+
+	// Cached public addresses of the server, see handleServerIP.
+	serverIPMutex     sync.Mutex
+	serverIP          apitypes.ServerIPResponse
+	serverIPFetchedAt time.Time
 }
 
-func NewServer(apiToken string, logBroker logging.StreamPublisher, logLevel slog.Level) *APIServer {
+func NewServer(apiToken string, logBroker logging.StreamPublisher, eventBroker *events.Broker, logLevel slog.Level) *APIServer {
 	s := &APIServer{
-		router:    http.NewServeMux(),
-		logBroker: logBroker,
-		logLevel:  logLevel,
+		router:      http.NewServeMux(),
+		logBroker:   logBroker,
+		eventBroker: eventBroker,
+		logLevel:    logLevel,
 
-		apiToken: apiToken,
+		apiToken:   apiToken,
+		pending:    make(map[string]pendingDeployment),
+		activeApps: make(map[string]string),
+		limiter:    newAPILimiter(),
 	}
 	s.setupRoutes()
 	return s
 }
 
+// HAProxyPreviewFunc returns the current HAProxy config and the config with the deployment of the app in
+// labels replaced by the given number of replicas.
+type HAProxyPreviewFunc func(labels *config.ContainerLabels, replicas int) (current, preview string, err error)
+
+// SetHAProxyPreview enables the HAProxy diff of dry-run deployments.
+func (s *APIServer) SetHAProxyPreview(preview HAProxyPreviewFunc) {
+	s.haproxyPreview.Store(&preview)
+}
+
+// RoutingUpdateFunc rebuilds the deployments and applies them to HAProxy.
+type RoutingUpdateFunc func(ctx context.Context) error
+
+// SetRoutingUpdate lets handlers apply routing state, like A/B tests, without waiting for the periodic refresh.
+func (s *APIServer) SetRoutingUpdate(update RoutingUpdateFunc) {
+	s.routingUpdate.Store(&update)
+}
+
+// updateRouting applies the current routing state to HAProxy. It does nothing until haloyd has set the update.
+func (s *APIServer) updateRouting(ctx context.Context) error {
+	update := s.routingUpdate.Load()
+	if update == nil {
+		return nil
+	}
+	return (*update)(ctx)
+}
+
+// SetProxyBackend sets the proxy backend of the server. Deployments and A/B tests that need features the
+// backend doesn't support are rejected.
+func (s *APIServer) SetProxyBackend(backend string) {
+	s.proxyBackend.Store(&backend)
+}
+
+// usesCaddy reports whether the server runs the caddy proxy backend instead of HAProxy.
+func (s *APIServer) usesCaddy() bool {
+	backend := s.proxyBackend.Load()
+	return backend != nil && *backend == config.ProxyBackendCaddy
+}
+
+// checkProxyBackend rejects a deployment that uses settings the proxy backend doesn't support. It returns
+// false when the response has been written.
+func (s *APIServer) checkProxyBackend(w http.ResponseWriter, targetConfig config.TargetConfig) bool {
+	backend := s.proxyBackend.Load()
+	if backend == nil {
+		return true
+	}
+	if err := targetConfig.ValidateProxyBackend(*backend, targetConfig.Format); err != nil {
+		writeError(w, http.StatusBadRequest, apitypes.ErrCodeInvalidConfig, fmt.Sprintf("Invalid app configuration: %v", err), nil)
+		return false
+	}
+	return true
+}
+
 // ListenAndServe starts the HTTP server.
 func (s *APIServer) ListenAndServe(addr string) error {
-	return http.ListenAndServe(addr, s.router)
+	return http.ListenAndServe(addr, s.correlationMiddleware(s.corsMiddleware(s.rateLimitMiddleware(s.router))))
+}
+
+// startDeployment registers a background deployment. It returns false once the server is draining,
+// in which case the deployment must be rejected.
+func (s *APIServer) startDeployment() bool {
+	if s.draining.Load() {
+		return false
+	}
+	s.deployments.Add(1)
+	return true
+}
+
+// Drain stops accepting deployments and waits until the running ones have created their containers
+// or ctx is done. Deployments still running are resumed from their checkpoint when haloyd starts again.
+func (s *APIServer) Drain(ctx context.Context) error {
+	s.draining.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		s.deployments.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
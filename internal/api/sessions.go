@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+const (
+	// sessionTokenPrefix marks session tokens, so they're told apart from the API token without checking them.
+	sessionTokenPrefix = "hs_"
+	defaultSessionTTL  = time.Hour
+	maxSessionTTL      = 24 * time.Hour
+)
+
+// sessionKey signs the session tokens. It's derived from the API token, so generating a new API token ends all
+// sessions.
+func (s *APIServer) sessionKey() []byte {
+	key := sha256.Sum256([]byte("haloy session\x00" + s.apiToken))
+	return key[:]
+}
+
+// newSessionToken returns a token that acts as the API token until expiresAt. Session tokens aren't stored, the
+// expiry is signed into the token.
+func (s *APIServer) newSessionToken(expiresAt time.Time) (string, error) {
+	payload := make([]byte, 8+16)
+	binary.BigEndian.PutUint64(payload, uint64(expiresAt.Unix()))
+	if _, err := rand.Read(payload[8:]); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	mac := hmac.New(sha256.New, s.sessionKey())
+	mac.Write(payload)
+	return sessionTokenPrefix + base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// validSession reports whether token is a session token of this server that hasn't expired.
+func (s *APIServer) validSession(token string) bool {
+	signed, found := strings.CutPrefix(token, sessionTokenPrefix)
+	if !found {
+		return false
+	}
+	encodedPayload, encodedMAC, found := strings.Cut(signed, ".")
+	if !found {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) < 8 {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, s.sessionKey())
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return false
+	}
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	return time.Now().Before(expiresAt)
+}
+
+// resolveSession returns the API token for a valid session token, and any other token unchanged.
+func (s *APIServer) resolveSession(token string) string {
+	if s.validSession(token) {
+		return s.apiToken
+	}
+	return token
+}
+
+// handleCreateSession exchanges the API token for a session token, so the CLI doesn't have to keep the API
+// token on developer machines. Sessions can't be extended with a session token.
+func (s *APIServer) handleCreateSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if _, isOIDC := s.oidcIdentity(token); isOIDC || strings.HasPrefix(token, sessionTokenPrefix) {
+			writeError(w, http.StatusForbidden, apitypes.ErrCodeForbidden,
+				"Sessions can only be created with the API token, log in again", nil)
+			return
+		}
+
+		var req apitypes.SessionRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl := defaultSessionTTL
+		if req.TTL != "" {
+			parsed, err := time.ParseDuration(req.TTL)
+			if err != nil || parsed <= 0 || parsed > maxSessionTTL {
+				httpError(w, fmt.Sprintf("Invalid session TTL '%s', must be a positive duration up to %s", req.TTL, maxSessionTTL),
+					http.StatusBadRequest)
+				return
+			}
+			ttl = parsed
+		}
+
+		expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+		token, err := s.newSessionToken(expiresAt)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		logger.Info("Created API session", "expires_at", expiresAt, "client_ip", s.clientIP(r))
+		encodeJSON(w, http.StatusCreated, apitypes.SessionResponse{Token: token, ExpiresAt: expiresAt})
+	}
+}
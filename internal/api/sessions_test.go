@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+func TestValidSession(t *testing.T) {
+	s := NewServer(testAPIToken, logging.NewLogBroker(), events.NewBroker(), slog.LevelInfo)
+	other := NewServer("other-api-token", logging.NewLogBroker(), events.NewBroker(), slog.LevelInfo)
+
+	newToken := func(s *APIServer, expiresAt time.Time) string {
+		token, err := s.newSessionToken(expiresAt)
+		if err != nil {
+			t.Fatalf("newSessionToken() error = %v", err)
+		}
+		return token
+	}
+	valid := newToken(s, time.Now().Add(time.Hour))
+
+	// flip changes the last byte of an encoded part of the token.
+	flip := func(encoded string) string {
+		raw, _ := base64.RawURLEncoding.DecodeString(encoded)
+		raw[len(raw)-1] ^= 1
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	payload, signature, _ := strings.Cut(strings.TrimPrefix(valid, sessionTokenPrefix), ".")
+	tampered := sessionTokenPrefix + flip(payload) + "." + signature
+
+	tests := []struct {
+		name     string
+		token    string
+		expected bool
+	}{
+		{name: "valid", token: valid, expected: true},
+		{name: "expired", token: newToken(s, time.Now().Add(-time.Second)), expected: false},
+		{name: "tampered payload", token: tampered, expected: false},
+		{name: "tampered signature", token: sessionTokenPrefix + payload + "." + flip(signature), expected: false},
+		{name: "signed by another server", token: newToken(other, time.Now().Add(time.Hour)), expected: false},
+		{name: "missing prefix", token: strings.TrimPrefix(valid, sessionTokenPrefix), expected: false},
+		{name: "missing signature", token: sessionTokenPrefix + payload, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := s.validSession(tt.token); result != tt.expected {
+				t.Errorf("validSession() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+
+	if resolved := s.resolveSession(valid); resolved != testAPIToken {
+		t.Errorf("resolveSession() = %q, expected the API token", resolved)
+	}
+	if resolved := s.resolveSession(tampered); resolved != tampered {
+		t.Errorf("resolveSession() = %q, expected the token unchanged", resolved)
+	}
+}
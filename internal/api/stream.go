@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/ameistad/haloy/internal/logging"
@@ -20,7 +21,6 @@ func streamSSELogs(w http.ResponseWriter, r *http.Request, config sseStreamConfi
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("X-Accel-Buffering", "no")
 	w.Header().Set("X-Buffering", "no")
 	w.Header().Set("Transfer-Encoding", "chunked")
@@ -29,7 +29,7 @@ func streamSSELogs(w http.ResponseWriter, r *http.Request, config sseStreamConfi
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		httpError(w, "streaming not supported", http.StatusInternalServerError)
 		return
 	}
 
@@ -72,14 +72,23 @@ func streamSSELogs(w http.ResponseWriter, r *http.Request, config sseStreamConfi
 	}
 }
 
-// writeSSEMessage writes a log entry as Server-Sent Event
+// lastEventID returns the Last-Event-ID header sent by a client resuming a log stream, or 0.
+func lastEventID(r *http.Request) uint64 {
+	id, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// writeSSEMessage writes a log entry as Server-Sent Event, with its sequence number as event ID.
 func writeSSEMessage(w http.ResponseWriter, entry logging.LogEntry) error {
 	data, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal log entry: %w", err)
 	}
 
-	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", entry.Seq, data)
 	if err != nil {
 		return fmt.Errorf("failed to write SSE data: %w", err)
 	}
@@ -6,17 +6,20 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
 )
 
 // APIClient handles communication with the haloy API
@@ -48,22 +51,62 @@ func NewWithTimeout(url, token string, timeout time.Duration) (*APIClient, error
 	return cli, nil
 }
 
-func (c *APIClient) setAuthHeader(req *http.Request) {
+// CorrelationID returns the ID sent with every API request of this process, so the requests of a command
+// can be found in the haloyd logs. HALOY_CORRELATION_ID overrides it, e.g. with the ID of a CI run.
+var CorrelationID = sync.OnceValue(func() string {
+	if correlationID := os.Getenv(constants.EnvVarCorrelationID); logging.IsValidCorrelationID(correlationID) {
+		return correlationID
+	}
+	return logging.NewCorrelationID()
+})
+
+func (c *APIClient) setHeaders(req *http.Request) {
 	if c.apiToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.apiToken)
 	}
+	req.Header.Set(constants.HeaderCorrelationID, CorrelationID())
+	// Pass on a W3C trace context, e.g. set by a CI pipeline, so deployments join the caller's trace.
+	if traceParent := os.Getenv(constants.EnvVarTraceParent); traceParent != "" {
+		req.Header.Set("traceparent", traceParent)
+	}
 }
 
+// HealthCheck checks that haloyd is ready to handle changes: connected to Docker, with its storage open and the
+// proxy config applied. Servers without the readiness endpoint are checked with /health.
 func (c *APIClient) HealthCheck(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/health", nil)
+	resp, err := c.probe(ctx, "/readyz")
 	if err != nil {
-		return fmt.Errorf("failed to create health check request: %w", err)
+		return err
 	}
+	defer resp.Body.Close()
 
-	// Health endpoint doesn't require auth
-	resp, err := c.client.Do(req)
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		var readiness apitypes.ReadinessResponse
+		if err := json.NewDecoder(resp.Body).Decode(&readiness); err == nil {
+			var notReady []string
+			for _, check := range readiness.Checks {
+				if !check.Ready {
+					notReady = append(notReady, fmt.Sprintf("%s: %s", check.Name, check.Error))
+				}
+			}
+			if len(notReady) > 0 {
+				return fmt.Errorf("server is not ready (%s)", strings.Join(notReady, ", "))
+			}
+		}
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// LivenessCheck checks that the haloyd process is up, it succeeds while haloyd isn't ready yet, e.g. to read
+// its logs or status.
+func (c *APIClient) LivenessCheck(ctx context.Context) error {
+	resp, err := c.probe(ctx, "/livez")
 	if err != nil {
-		return fmt.Errorf("server not reachable: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -74,8 +117,32 @@ func (c *APIClient) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// probe requests a health endpoint, falling back to /health on servers that don't have it.
+func (c *APIClient) probe(ctx context.Context, path string) (*http.Response, error) {
+	resp, err := c.probeOnce(ctx, path)
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		return resp, err
+	}
+	resp.Body.Close()
+	return c.probeOnce(ctx, "/health")
+}
+
+func (c *APIClient) probeOnce(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create health check request: %w", err)
+	}
+
+	// Health endpoints don't require auth
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("server not reachable: %w", err)
+	}
+	return resp, nil
+}
+
 func (c *APIClient) Get(ctx context.Context, path string, v any) error {
-	if err := c.HealthCheck(ctx); err != nil {
+	if err := c.LivenessCheck(ctx); err != nil {
 		return fmt.Errorf("server not available at %s: %w", c.baseURL, err)
 	}
 
@@ -84,7 +151,7 @@ func (c *APIClient) Get(ctx context.Context, path string, v any) error {
 	if err != nil {
 		return fmt.Errorf("failed to create GET request: %w", err)
 	}
-	c.setAuthHeader(req)
+	c.setHeaders(req)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -93,10 +160,7 @@ func (c *APIClient) Get(ctx context.Context, path string, v any) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		if resp.StatusCode == http.StatusUnauthorized {
-			return fmt.Errorf("authentication failed - check your %s", constants.EnvVarAPIToken)
-		}
-		return fmt.Errorf("GET request failed with status %d", resp.StatusCode)
+		return responseError(resp, "GET request")
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
@@ -132,7 +196,7 @@ func (c *APIClient) Post(ctx context.Context, path string, request, response any
 	if request != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
-	c.setAuthHeader(req)
+	c.setHeaders(req)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -141,23 +205,12 @@ func (c *APIClient) Post(ctx context.Context, path string, request, response any
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return fmt.Errorf("POST request failed with status %d (unable to read error details: %v)", resp.StatusCode, readErr)
-		}
-
-		errorMessage := strings.TrimSpace(string(bodyBytes))
-		if errorMessage == "" {
-			errorMessage = "no error details provided"
-		}
-		if resp.StatusCode == http.StatusUnauthorized {
-			return fmt.Errorf("authentication failed - check your %s", constants.EnvVarAPIToken)
-		}
-		return fmt.Errorf("POST request failed with status %d: %s", resp.StatusCode, errorMessage)
+		return responseError(resp, "POST request")
 	}
 
+	// Older servers answer some requests without a body.
 	if response != nil {
-		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil && !errors.Is(err, io.EOF) {
 			return fmt.Errorf("failed to decode response: %w", err)
 		}
 	}
@@ -165,43 +218,80 @@ func (c *APIClient) Post(ctx context.Context, path string, request, response any
 	return nil
 }
 
-// PostFile uploads a file using multipart form data
-func (c *APIClient) PostFile(ctx context.Context, path, fieldName, filePath string) error {
-	if err := c.HealthCheck(ctx); err != nil {
-		return fmt.Errorf("server not available at %s: %w", c.baseURL, err)
+// ErrOffsetMismatch is returned by UploadChunk when the server expects a chunk at a different
+// offset. The response then holds the upload status with the server's offset.
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+// UploadChunk sends a chunk of a resumable upload starting at offset and decodes the upload status into response.
+func (c *APIClient) UploadChunk(ctx context.Context, path string, offset int64, chunk io.Reader, response any) error {
+	url := fmt.Sprintf("%s/v1/%s", c.baseURL, path)
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, chunk)
+	if err != nil {
+		return fmt.Errorf("failed to create PATCH request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.setHeaders(req)
 
-	file, err := os.Open(filePath)
+	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return fmt.Errorf("failed to send request: %w", err)
 	}
-	defer file.Close()
+	defer resp.Body.Close()
 
-	// Create multipart form
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusConflict {
+		return responseError(resp, "chunk upload")
+	}
 
-	part, err := writer.CreateFormFile(fieldName, filepath.Base(filePath))
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return ErrOffsetMismatch
+	}
+
+	return nil
+}
+
+// Download returns the raw response body of a GET request. The caller must close it.
+func (c *APIClient) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := c.LivenessCheck(ctx); err != nil {
+		return nil, fmt.Errorf("server not available at %s: %w", c.baseURL, err)
+	}
+
+	url := fmt.Sprintf("%s/v1/%s", c.baseURL, path)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create form file: %w", err)
+		return nil, fmt.Errorf("failed to create GET request: %w", err)
 	}
+	c.setHeaders(req)
 
-	if _, err := io.Copy(part, file); err != nil {
-		return fmt.Errorf("failed to copy file data: %w", err)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp, "download")
 	}
 
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close multipart writer: %w", err)
+	return resp.Body, nil
+}
+
+// Upload sends body as the raw request body of a PUT request.
+func (c *APIClient) Upload(ctx context.Context, path, contentType string, body io.Reader) error {
+	if err := c.HealthCheck(ctx); err != nil {
+		return fmt.Errorf("server not available at %s: %w", c.baseURL, err)
 	}
 
 	url := fmt.Sprintf("%s/v1/%s", c.baseURL, path)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, &requestBody)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create PUT request: %w", err)
 	}
-
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	c.setAuthHeader(req)
+	req.Header.Set("Content-Type", contentType)
+	c.setHeaders(req)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -210,25 +300,84 @@ func (c *APIClient) PostFile(ctx context.Context, path, fieldName, filePath stri
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			return fmt.Errorf("file upload failed with status %d (unable to read error details: %v)", resp.StatusCode, readErr)
-		}
+		return responseError(resp, "upload")
+	}
 
-		errorMessage := strings.TrimSpace(string(bodyBytes))
-		if errorMessage == "" {
-			errorMessage = "no error details provided"
-		}
-		if resp.StatusCode == http.StatusUnauthorized {
-			return fmt.Errorf("authentication failed - check your %s", constants.EnvVarAPIToken)
+	return nil
+}
+
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int
+	// Code is one of the apitypes.ErrCode constants. Servers from before error codes answer with
+	// plain text, the code is then derived from the status.
+	Code    string
+	Message string
+	Details map[string]any
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Detail returns the string detail key of the error, or "" when it isn't set.
+func (e *APIError) Detail(key string) string {
+	value, _ := e.Details[key].(string)
+	return value
+}
+
+// responseError returns the *APIError of an error response.
+func responseError(resp *http.Response, operation string) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	bodyBytes, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		apiErr.Message = fmt.Sprintf("%s failed with status %d (unable to read error details: %v)", operation, resp.StatusCode, readErr)
+	} else {
+		var errorResponse apitypes.ErrorResponse
+		if json.Unmarshal(bodyBytes, &errorResponse) == nil && errorResponse.Code != "" {
+			apiErr.Code = errorResponse.Code
+			apiErr.Message = errorResponse.Message
+			apiErr.Details = errorResponse.Details
+		} else if message := strings.TrimSpace(string(bodyBytes)); message != "" {
+			apiErr.Message = message
+		} else {
+			apiErr.Message = fmt.Sprintf("%s failed with status %d", operation, resp.StatusCode)
 		}
-		return fmt.Errorf("file upload failed with status %d: %s", resp.StatusCode, errorMessage)
 	}
 
-	return nil
+	if apiErr.Code == "" {
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			apiErr.Code = apitypes.ErrCodeUnauthorized
+		case http.StatusNotFound:
+			apiErr.Code = apitypes.ErrCodeNotFound
+		case http.StatusConflict:
+			apiErr.Code = apitypes.ErrCodeConflict
+		default:
+			if resp.StatusCode >= http.StatusInternalServerError {
+				apiErr.Code = apitypes.ErrCodeInternal
+			} else {
+				apiErr.Code = apitypes.ErrCodeBadRequest
+			}
+		}
+	}
+	if apiErr.Code == apitypes.ErrCodeUnauthorized {
+		apiErr.Message = fmt.Sprintf("authentication failed - check your %s", constants.EnvVarAPIToken)
+	}
+	return apiErr
 }
 
-// Generic streaming method that handles any SSE endpoint
+const (
+	// streamRetries is how often Stream reconnects without receiving anything in between.
+	streamRetries     = 5
+	streamRetryDelay  = time.Second
+	streamMaxRetryGap = 15 * time.Second
+)
+
+// Stream reads an SSE endpoint and calls handler with the data of every event until handler returns true.
+// When the connection drops, Stream reconnects with backoff. Endpoints that send event IDs get the last
+// ID as Last-Event-ID, so the server replays the events that were missed instead of starting over.
 func (c *APIClient) Stream(ctx context.Context, path string, handler func(data string) bool) error {
 	// Create transport that forces HTTP/1.1 to avoid HTTP/2 stream cancellation
 	streamingTransport := &http.Transport{
@@ -239,35 +388,77 @@ func (c *APIClient) Stream(ctx context.Context, path string, handler func(data s
 	}
 	streamingClient := &http.Client{Timeout: 0, Transport: streamingTransport}
 
+	var lastEventID string
+	delay := streamRetryDelay
+	for attempt := 0; ; attempt++ {
+		received, stopped, err := c.streamOnce(ctx, streamingClient, path, &lastEventID, handler)
+		if stopped || ctx.Err() != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		// Streams without event IDs can't be resumed, they end like before when the server closes them.
+		if err == nil && lastEventID == "" {
+			return nil
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError {
+			return err
+		}
+
+		if received {
+			attempt = 0
+			delay = streamRetryDelay
+		}
+		if attempt >= streamRetries {
+			if err == nil {
+				err = errors.New("connection closed")
+			}
+			return fmt.Errorf("stream interrupted, gave up after %d reconnect attempts: %w", streamRetries, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, streamMaxRetryGap)
+	}
+}
+
+// streamOnce reads the stream until it ends. It reports whether an event was received and whether
+// handler stopped the stream.
+func (c *APIClient) streamOnce(ctx context.Context, client *http.Client, path string, lastEventID *string, handler func(data string) bool) (received, stopped bool, err error) {
 	url := fmt.Sprintf("%s/v1/%s", c.baseURL, path)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create SSE request: %w", err)
+		return false, true, fmt.Errorf("failed to create SSE request: %w", err)
 	}
 
 	req.Header.Set("Accept", "text/event-stream")
 	req.Header.Set("Cache-Control", "no-cache")
 	req.Header.Set("Connection", "keep-alive")
-	c.setAuthHeader(req)
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+	c.setHeaders(req)
 
-	resp, err := streamingClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to connect to stream: %w", err)
+		return false, false, fmt.Errorf("failed to connect to stream: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusUnauthorized {
-			return fmt.Errorf("authentication failed for stream - check your %s", constants.EnvVarAPIToken)
-		}
-		return fmt.Errorf("stream returned status %d", resp.StatusCode)
+		return false, false, responseError(resp, "stream")
 	}
 
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return received, true, ctx.Err()
 		default:
 		}
 
@@ -278,22 +469,28 @@ func (c *APIClient) Stream(ctx context.Context, path string, handler func(data s
 			continue
 		}
 
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			*lastEventID = id
+			continue
+		}
+
 		// Parse SSE data lines
 		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			received = true
 
 			// Call the handler function to process the data
 			shouldStop := handler(data)
 
 			// If handler returns true, stop streaming
 			if shouldStop {
-				return nil
+				return received, true, nil
 			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading stream: %w", err)
+		return received, false, fmt.Errorf("error reading stream: %w", err)
 	}
 
-	return nil
+	return received, false, nil
 }
@@ -1,27 +1,176 @@
 package apitypes
 
 import (
+	"time"
+
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/deploytypes"
+	"github.com/ameistad/haloy/internal/logging"
 )
 
 type HealthResponse struct {
+	// Status is "ok", or "degraded" while haloyd has lost the connection to the Docker daemon.
 	Status  string `json:"status"`
 	Version string `json:"version,omitempty"`
 	Service string `json:"service"`
 }
 
+// ReadinessResponse is returned by /readyz, with status 503 while a check fails.
+type ReadinessResponse struct {
+	// Status is "ready" or "not_ready".
+	Status  string           `json:"status"`
+	Version string           `json:"version,omitempty"`
+	Checks  []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessCheck is the state of a part of haloyd that deployments depend on, e.g. the Docker connection.
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// DockerStatus is the connection state of haloyd to the Docker daemon.
+type DockerStatus struct {
+	Connected bool `json:"connected"`
+	// Since is when the connection was last established or lost.
+	Since *time.Time `json:"since,omitempty"`
+	// Error is the error that ended the connection, set while disconnected.
+	Error string `json:"error,omitempty"`
+}
+
+// SystemResponse is the state of haloyd itself.
+type SystemResponse struct {
+	Version string `json:"version"`
+	// Arch is the architecture of the server, e.g. amd64. The CLI builds images for it.
+	Arch   string       `json:"arch,omitempty"`
+	Docker DockerStatus `json:"docker"`
+	// LogStreams are the counters of the log streams clients follow, e.g. with haloy logs.
+	LogStreams LogStreamStatus `json:"logStreams"`
+}
+
+// LogStreamStatus are the counters of the log streams of haloyd.
+type LogStreamStatus struct {
+	Subscribers int `json:"subscribers"`
+	// DroppedEntries is the number of log entries dropped for clients that read slower than logs are written,
+	// since haloyd started.
+	DroppedEntries uint64 `json:"droppedEntries"`
+}
+
 type DeployRequest struct {
+	// DeploymentID is assigned by haloyd and returned in the DeployResponse, IDs sent by clients are ignored.
 	DeploymentID string              `json:"deploymentID"`
 	TargetConfig config.TargetConfig `json:"targetConfig"`
 	// AppConfig without resolved secrets and with target extracted. Saved on server for rollbacks
 	RollbackAppConfig config.AppConfig `json:"rollbackAppConfig"`
+	// IgnoreFreeze deploys during a freeze window of the server.
+	IgnoreFreeze bool `json:"ignoreFreeze,omitempty"`
+}
+
+type DeployResponse struct {
+	DeploymentID string `json:"deploymentID"`
+	// Pending is true when the target requires approval and the deployment waits for 'haloy approve'.
+	Pending bool `json:"pending,omitempty"`
+	// QueuedUntil is set when the deployment waits for the end of a freeze window.
+	QueuedUntil *time.Time `json:"queuedUntil,omitempty"`
+}
+
+// DeployHookResponse is returned to the webhooks on /v1/hooks/deploy/{appName}. DeploymentID is empty when
+// the event doesn't deploy the app, Message says why.
+type DeployHookResponse struct {
+	Message      string `json:"message"`
+	DeploymentID string `json:"deploymentID,omitempty"`
+	Image        string `json:"image,omitempty"`
+	Pending      bool   `json:"pending,omitempty"`
+	// QueuedUntil is set when the deployment waits for the end of a freeze window.
+	QueuedUntil *time.Time `json:"queuedUntil,omitempty"`
+}
+
+// PendingDeployment is a deployment waiting for approval.
+type PendingDeployment struct {
+	DeploymentID string    `json:"deploymentID"`
+	AppName      string    `json:"appName"`
+	TargetName   string    `json:"targetName,omitempty"`
+	Image        string    `json:"image"`
+	RequestedAt  time.Time `json:"requestedAt"`
+}
+
+type PendingDeploymentsResponse struct {
+	Deployments []PendingDeployment `json:"deployments"`
+}
+
+// SessionRequest exchanges the API token for a session token with 'haloy login'.
+type SessionRequest struct {
+	// TTL is how long the session is valid, e.g. "8h". Defaults to 1h, at most 24h.
+	TTL string `json:"ttl,omitempty"`
+}
+
+type SessionResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// OIDCInfoResponse is returned by /v1/oidc when users can sign in with an OIDC provider.
+type OIDCInfoResponse struct {
+	Issuer string `json:"issuer"`
+}
+
+// PendingAction is a destructive operation on a protected app waiting for the confirmation of a second token.
+type PendingAction struct {
+	ActionID string `json:"actionID"`
+	// Action is "rollback" or "remove".
+	Action      string    `json:"action"`
+	AppName     string    `json:"appName"`
+	Description string    `json:"description"`
+	RequestedAt time.Time `json:"requestedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type PendingActionsResponse struct {
+	Actions []PendingAction `json:"actions"`
+}
+
+type ConfirmActionResponse struct {
+	Message string `json:"message"`
+	// DeploymentID is the deployment started by a confirmed rollback.
+	DeploymentID string `json:"deploymentID,omitempty"`
+}
+
+// DryRunResponse describes what a deployment would change, without changing anything on the server.
+type DryRunResponse struct {
+	Image      string            `json:"image"`
+	Containers []DryRunContainer `json:"containers"`
+	// HAProxyDiff is a unified diff of the HAProxy config, empty when routing doesn't change.
+	HAProxyDiff string   `json:"haproxyDiff,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// DryRunContainer is the spec of a container the deployment would create.
+type DryRunContainer struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	// Env holds the variable names only, values may be secrets.
+	Env        []string `json:"env"`
+	Network    string   `json:"network"`
+	Networks   []string `json:"networks,omitempty"`
+	Volumes    []string `json:"volumes,omitempty"`
+	DNS        []string `json:"dns,omitempty"`
+	DNSSearch  []string `json:"dnsSearch,omitempty"`
+	ExtraHosts []string `json:"extraHosts,omitempty"`
 }
 
 type RollbackRequest struct {
-	TargetDeploymentID string              `json:"targetDeploymentID"`
-	NewDeploymentID    string              `json:"newDeploymentID"`
-	NewTargetConfig    config.TargetConfig `json:"newTargetConfig"`
+	TargetDeploymentID string `json:"targetDeploymentID"`
+	// NewDeploymentID is assigned by haloyd and returned in the RollbackResponse, IDs sent by clients are ignored.
+	NewDeploymentID string              `json:"newDeploymentID"`
+	NewTargetConfig config.TargetConfig `json:"newTargetConfig"`
+}
+
+type RollbackResponse struct {
+	// DeploymentID is the ID of the deployment the rollback creates, empty while it waits for confirmation.
+	DeploymentID string `json:"deploymentID,omitempty"`
+	// PendingAction is set when the app is protected and the rollback waits for 'haloy confirm'.
+	PendingAction *PendingAction `json:"pendingAction,omitempty"`
 }
 
 type RollbackTargetsResponse struct {
@@ -33,10 +182,82 @@ type AppStatusResponse struct {
 	DeploymentID string          `json:"deploymentId"`
 	ContainerIDs []string        `json:"containerIds"`
 	Domains      []config.Domain `json:"domains"`
+	Exposure     config.Exposure `json:"exposure,omitempty"`
+	// NetworkAlias is the stable hostname of the app on the haloy network, empty for apps on a custom network.
+	NetworkAlias string `json:"networkAlias,omitempty"`
+	// Addresses are the host:port addresses of the containers on the haloy network.
+	Addresses []string `json:"addresses,omitempty"`
+	// Annotations of the current deployment, e.g. the git commit it was made from.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ImageID is the ID of the image the current deployment runs. RepoDigests are its registry digests,
+	// which are empty for images that were uploaded to the server.
+	ImageID     string   `json:"imageId,omitempty"`
+	RepoDigests []string `json:"repoDigests,omitempty"`
+	// Traffic is the HAProxy backend of the app, empty when the stats can't be read.
+	Traffic *HAProxyBackendStats `json:"traffic,omitempty"`
+}
+
+// DeployedConfigResponse is the resolved config of the current deployment of an app, with secret values redacted.
+type DeployedConfigResponse struct {
+	DeploymentID string              `json:"deploymentId"`
+	TargetConfig config.TargetConfig `json:"targetConfig"`
+}
+
+// ExportResponse is the app config of the current deployment of an app.
+type ExportResponse struct {
+	DeploymentID string           `json:"deploymentId"`
+	AppConfig    config.AppConfig `json:"appConfig"`
+	// Resolved is true when the app was deployed without history and the config was exported from
+	// the resolved deployment spec, which has no references to secret providers.
+	Resolved bool `json:"resolved,omitempty"`
 }
 
 type StopAppResponse struct {
 	Message string `json:"message,omitempty"`
+	// PendingAction is set when the app is protected and removing its containers waits for 'haloy confirm'.
+	PendingAction *PendingAction `json:"pendingAction,omitempty"`
+}
+
+type RestartAppResponse struct {
+	Message      string   `json:"message,omitempty"`
+	ContainerIDs []string `json:"containerIds,omitempty"`
+}
+
+// PauseAppResponse is returned when an app is paused or resumed.
+type PauseAppResponse struct {
+	Message      string   `json:"message,omitempty"`
+	DeploymentID string   `json:"deploymentId"`
+	ContainerIDs []string `json:"containerIds,omitempty"`
+}
+
+// ScaleRequest sets the number of replicas of the current deployment of an app.
+type ScaleRequest struct {
+	Replicas int `json:"replicas"`
+}
+
+// ScaleResponse is returned when an app is scaled.
+type ScaleResponse struct {
+	Message      string `json:"message,omitempty"`
+	DeploymentID string `json:"deploymentId"`
+	Previous     int    `json:"previous"`
+	Replicas     int    `json:"replicas"`
+}
+
+// ABTestRequest starts an A/B test. A variant deployment of the app runs the image with Tag, and requests to the
+// app that match the header, the cookie or the percentage are routed to it. At least one of them is required.
+type ABTestRequest struct {
+	Tag         string `json:"tag"`
+	HeaderName  string `json:"headerName,omitempty"`
+	HeaderValue string `json:"headerValue,omitempty"`
+	CookieName  string `json:"cookieName,omitempty"`
+	CookieValue string `json:"cookieValue,omitempty"`
+	Percentage  int    `json:"percentage,omitempty"`
+}
+
+// ABTestResponse is returned when an A/B test is started or stopped.
+type ABTestResponse struct {
+	Message      string `json:"message,omitempty"`
+	DeploymentID string `json:"deploymentId,omitempty"` // The variant deployment
 }
 
 type ImageUploadResponse struct {
@@ -44,7 +265,224 @@ type ImageUploadResponse struct {
 	Message string `json:"message"`
 }
 
+// ImageUploadRequest starts an image upload, or resumes it if an upload of the same archive exists.
+type ImageUploadRequest struct {
+	ImageRef string `json:"imageRef"`
+	ImageID  string `json:"imageID"` // Image ID on the client, compared with the loaded image
+	Size     int64  `json:"size"`
+	Digest   string `json:"digest"` // sha256 digest of the archive, e.g. sha256:<hex>
+}
+
+type ImageUploadStatusResponse struct {
+	UploadID string `json:"uploadID"`
+	Offset   int64  `json:"offset"` // Bytes received so far, the next chunk must start here
+	Size     int64  `json:"size"`
+}
+
+type ImageLayersRequest struct {
+	DiffIDs []string `json:"diffIDs"` // Layer diff IDs of the image, base layer first
+}
+
+type ImageLayersResponse struct {
+	PresentLayers int `json:"presentLayers"` // Number of leading layers the server already has
+}
+
+// ServerIPResponse holds the public addresses of the server, empty when it has none of that type.
+type ServerIPResponse struct {
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
 type VersionResponse struct {
 	Version        string `json:"haloyd"`
 	HAProxyVersion string `json:"haproxy"`
+	// SchemaVersion is the applied database schema version, LatestSchemaVersion the one haloyd supports.
+	SchemaVersion       int `json:"schemaVersion,omitempty"`
+	LatestSchemaVersion int `json:"latestSchemaVersion,omitempty"`
+}
+
+type AppSummary struct {
+	Name         string          `json:"name"`
+	State        string          `json:"state"`
+	DeploymentID string          `json:"deploymentId"`
+	Replicas     int             `json:"replicas"`
+	Domains      []config.Domain `json:"domains"`
+	// Labels are the labels of the app containers from the config, selectors match against them.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type AppsResponse struct {
+	Apps []AppSummary `json:"apps"`
+}
+
+// AppResource is the state of an app on /v1/apps/{appName}, for tools like Terraform that manage apps
+// declaratively.
+type AppResource struct {
+	Name string `json:"name"`
+	// Revision is a hash of Config, it only changes when the desired config of the app changes.
+	Revision     string `json:"revision"`
+	DeploymentID string `json:"deploymentID"`
+	State        string `json:"state"`
+	// Config is the resolved config with default values applied and secret values redacted, see
+	// config.RedactValue.
+	Config config.TargetConfig `json:"config"`
+}
+
+// PutAppRequest is the full desired config of an app. The config has the format of a haloy config file
+// without targets, and values from the environment and secret providers already resolved.
+type PutAppRequest struct {
+	Config       config.AppConfig `json:"config"`
+	IgnoreFreeze bool             `json:"ignoreFreeze,omitempty"`
+}
+
+type PutAppResponse struct {
+	App AppResource `json:"app"`
+	// Changed is false when the app already runs the config and no deployment was started.
+	Changed bool `json:"changed"`
+	// Pending is true when the app requires approval and the deployment waits for 'haloy approve'.
+	Pending bool `json:"pending,omitempty"`
+	// QueuedUntil is set when the deployment waits for the end of a freeze window.
+	QueuedUntil *time.Time `json:"queuedUntil,omitempty"`
+}
+
+// SecretUsage is a secret provider reference, e.g. onepassword:prod.db-password, and the deployments
+// in the history that use it.
+type SecretUsage struct {
+	Name      string           `json:"name"`
+	Consumers []SecretConsumer `json:"consumers"`
+	// LastUsed is the time of the latest deployment that used the secret.
+	LastUsed time.Time `json:"lastUsed"`
+	// UnusedSince is when the last app stopped using the secret, nil while the current deployment of an app uses it.
+	UnusedSince *time.Time `json:"unusedSince,omitempty"`
+}
+
+type SecretConsumer struct {
+	App          string `json:"app"`
+	DeploymentID string `json:"deploymentId"`
+	// Current is set when the deployment is the latest deployment of the app.
+	Current bool `json:"current"`
+}
+
+type SecretsResponse struct {
+	Secrets []SecretUsage `json:"secrets"`
+	// Imported are the names of the secrets imported with 'haloy secrets import', which deployments can leave
+	// unresolved.
+	Imported []string `json:"imported,omitempty"`
+}
+
+// ExportedSecret is the value of a secret provider reference. Values are plain text in exports, and age
+// encrypted to the recipient of the server in imports.
+type ExportedSecret struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Apps that use the secret, app tokens can only deploy it to them.
+	Apps []string `json:"apps"`
+}
+
+type SecretsExportResponse struct {
+	Secrets []ExportedSecret `json:"secrets"`
+}
+
+type SecretsImportRequest struct {
+	Secrets []ExportedSecret `json:"secrets"`
+}
+
+type SecretsImportResponse struct {
+	Imported int `json:"imported"`
+}
+
+// SecretsRecipientResponse is the age recipient secrets are encrypted to when they're imported to the server.
+type SecretsRecipientResponse struct {
+	Recipient string `json:"recipient"`
+}
+
+type CertificateStatus struct {
+	Domain   string    `json:"domain"`
+	DNSNames []string  `json:"dnsNames"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// SystemDomainStatus is the certificate state of a domain served by haloyd itself, e.g. the API domain.
+type SystemDomainStatus struct {
+	Role   string `json:"role"`
+	Domain string `json:"domain"`
+	// Status is "pending" until the first attempt, then "valid" or "failed".
+	Status      string     `json:"status"`
+	LastAttempt *time.Time `json:"lastAttempt,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	NotAfter    *time.Time `json:"notAfter,omitempty"`
+}
+
+type CertificatesResponse struct {
+	Certificates  []CertificateStatus  `json:"certificates"`
+	SystemDomains []SystemDomainStatus `json:"systemDomains"`
+}
+
+// HAProxyBackendStats are the current metrics of an HAProxy backend. The backend of an app is named after the app.
+type HAProxyBackendStats struct {
+	Name            string `json:"name"`
+	Status          string `json:"status"`
+	CurrentSessions int    `json:"currentSessions"` // Concurrent sessions (scur)
+	SessionRate     int    `json:"sessionRate"`     // New sessions in the last second (rate)
+	QueuedRequests  int    `json:"queuedRequests"`  // Requests waiting for a free connection (qcur)
+	TotalSessions   int    `json:"totalSessions"`   // Sessions since HAProxy was last reloaded (stot)
+	Responses5xx    int    `json:"responses5xx"`    // HTTP responses with a 5xx status (hrsp_5xx)
+
+	Servers []HAProxyServerStats `json:"servers,omitempty"`
+}
+
+// HAProxyServerStats are the current metrics of a server in a backend, one per replica for apps.
+type HAProxyServerStats struct {
+	Name            string `json:"name"`
+	Address         string `json:"address,omitempty"`
+	Status          string `json:"status"`
+	CheckStatus     string `json:"checkStatus,omitempty"`
+	CurrentSessions int    `json:"currentSessions"`
+	SessionRate     int    `json:"sessionRate"`
+	QueuedRequests  int    `json:"queuedRequests"`
+	MaxConnections  int    `json:"maxConnections,omitempty"` // Connection limit of the server (slim), 0 without a limit
+}
+
+type HAProxyStatsResponse struct {
+	Backends []HAProxyBackendStats `json:"backends"`
+}
+
+// Formats of GET /v1/deploy/{deploymentID}/logs/download.
+const (
+	LogFormatText   = "text"
+	LogFormatNDJSON = "ndjson"
+	LogFormatJSON   = "json"
+)
+
+// DeploymentLogsResponse holds the stored log entries of a deployment.
+type DeploymentLogsResponse struct {
+	DeploymentID string             `json:"deploymentID"`
+	Entries      []logging.LogEntry `json:"entries"`
+}
+
+// Error codes of ErrorResponse. Clients match on the code, the message is meant for humans and may change.
+const (
+	ErrCodeBadRequest            = "ERR_BAD_REQUEST"
+	ErrCodeInvalidConfig         = "ERR_INVALID_CONFIG"
+	ErrCodeUnauthorized          = "ERR_UNAUTHORIZED"
+	ErrCodeForbidden             = "ERR_FORBIDDEN"
+	ErrCodeNotFound              = "ERR_NOT_FOUND"
+	ErrCodeConflict              = "ERR_CONFLICT"
+	ErrCodeDomainConflict        = "ERR_DOMAIN_CONFLICT"
+	ErrCodeImagePlatformMismatch = "ERR_IMAGE_PLATFORM_MISMATCH"
+	ErrCodeDeployFrozen          = "ERR_DEPLOY_FROZEN"
+	ErrCodePreconditionFailed    = "ERR_PRECONDITION_FAILED"
+	ErrCodeTooLarge              = "ERR_TOO_LARGE"
+	ErrCodeRateLimited           = "ERR_RATE_LIMITED"
+	ErrCodeUnavailable           = "ERR_UNAVAILABLE"
+	ErrCodeInternal              = "ERR_INTERNAL"
+)
+
+// ErrorResponse is the body of every API error response.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details holds code specific fields, e.g. the conflicting domain and app of ERR_DOMAIN_CONFLICT.
+	Details map[string]any `json:"details,omitempty"`
 }
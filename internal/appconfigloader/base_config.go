@@ -0,0 +1,76 @@
+package appconfigloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const (
+	// haloyDirName is the directory that holds the configs of a monorepo.
+	haloyDirName = "haloy"
+	// appsDirName is the directory, next to the base config, that holds one config per app.
+	appsDirName = "apps"
+)
+
+var supportedBaseNames = []string{"base.json", "base.yaml", "base.yml", "base.toml"}
+
+// findBaseConfig returns the shared base config for an app config in a monorepo layout,
+// where app configs live in apps/ and the base config sits next to that directory:
+//
+//	haloy/base.yaml
+//	haloy/apps/api.yaml
+//	haloy/apps/web.yaml
+//
+// An empty path is returned when the config file isn't part of such a layout.
+func findBaseConfig(configFile string) (string, error) {
+	appsDir := filepath.Dir(configFile)
+	if filepath.Base(appsDir) != appsDirName {
+		return "", nil
+	}
+
+	rootDir := filepath.Dir(appsDir)
+	var found []string
+	for _, name := range supportedBaseNames {
+		path := filepath.Join(rootDir, name)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("found multiple base configs in %s, keep only one: %v", rootDir, found)
+	}
+}
+
+// resolveAppShorthand resolves an app reference like "apps/api" to a config file. The reference
+// is tried as given and inside the haloy directory, with each of the supported extensions.
+func resolveAppShorthand(path string) (string, bool) {
+	for _, dir := range []string{path, filepath.Join(haloyDirName, path)} {
+		for _, ext := range supportedExtensions {
+			candidate, err := filepath.Abs(dir + ext)
+			if err != nil {
+				continue
+			}
+			if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+				return candidate, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isBaseConfig reports whether the file is the base config of a monorepo layout.
+func isBaseConfig(file string) bool {
+	if !slices.Contains(supportedBaseNames, filepath.Base(file)) {
+		return false
+	}
+	stat, err := os.Stat(filepath.Join(filepath.Dir(file), appsDirName))
+	return err == nil && stat.IsDir()
+}
@@ -0,0 +1,176 @@
+package appconfigloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+	}
+}
+
+func TestLoadRawAppConfig_BaseConfig(t *testing.T) {
+	root := t.TempDir()
+	writeConfigFiles(t, root, map[string]string{
+		"haloy/base.yaml":     "server: haloy.example.com\nacme_email: ops@example.com\nsecret_providers:\n  onepassword:\n    prod:\n      vault: production\n",
+		"haloy/apps/api.yaml": "name: api\nserver: api.example.com\nimage:\n  repository: ghcr.io/example/api\nsecret_providers:\n  onepassword:\n    api:\n      vault: api\n",
+		"haloy/apps/web.yaml": "name: web\nimage:\n  repository: ghcr.io/example/web\n",
+	})
+
+	api, _, err := LoadRawAppConfig(filepath.Join(root, "haloy/apps/api.yaml"))
+	if err != nil {
+		t.Fatalf("LoadRawAppConfig() unexpected error = %v", err)
+	}
+	if api.Server != "api.example.com" {
+		t.Errorf("app config should override base, got server = %s", api.Server)
+	}
+	if api.ACMEEmail != "ops@example.com" {
+		t.Errorf("acme email should be inherited from base, got %s", api.ACMEEmail)
+	}
+	if api.SecretProviders == nil || len(api.SecretProviders.OnePassword) != 2 {
+		t.Errorf("secret providers should be merged with base, got %+v", api.SecretProviders)
+	}
+
+	web, _, err := LoadRawAppConfig(filepath.Join(root, "haloy/apps/web.yaml"))
+	if err != nil {
+		t.Fatalf("LoadRawAppConfig() unexpected error = %v", err)
+	}
+	if web.Server != "haloy.example.com" {
+		t.Errorf("server should be inherited from base, got %s", web.Server)
+	}
+}
+
+func TestLoadRawAppConfig_BaseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		errMsg string
+	}{
+		{
+			name: "different format",
+			files: map[string]string{
+				"haloy/base.json":     `{"server": "haloy.example.com"}`,
+				"haloy/apps/api.yaml": "name: api\n",
+			},
+			errMsg: "must use the same format",
+		},
+		{
+			name: "multiple base configs",
+			files: map[string]string{
+				"haloy/base.yaml":     "server: haloy.example.com\n",
+				"haloy/base.yml":      "server: haloy.example.com\n",
+				"haloy/apps/api.yaml": "name: api\n",
+			},
+			errMsg: "multiple base configs",
+		},
+		{
+			name: "unknown field in base",
+			files: map[string]string{
+				"haloy/base.yaml":     "servr: haloy.example.com\n",
+				"haloy/apps/api.yaml": "name: api\n",
+			},
+			errMsg: "servr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeConfigFiles(t, root, tt.files)
+
+			_, _, err := LoadRawAppConfig(filepath.Join(root, "haloy/apps/api.yaml"))
+			if err == nil {
+				t.Fatalf("LoadRawAppConfig() expected error containing %q", tt.errMsg)
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("LoadRawAppConfig() error = %v, want it to contain %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestFindConfigFile_AppShorthand(t *testing.T) {
+	root := t.TempDir()
+	writeConfigFiles(t, root, map[string]string{
+		"haloy/base.yaml":     "server: haloy.example.com\n",
+		"haloy/apps/api.yaml": "name: api\n",
+	})
+	t.Chdir(root)
+
+	configFile, err := FindConfigFile("apps/api")
+	if err != nil {
+		t.Fatalf("FindConfigFile() unexpected error = %v", err)
+	}
+	// The temp dir may be behind a symlink, e.g. on macOS.
+	got, _ := filepath.EvalSymlinks(configFile)
+	want, _ := filepath.EvalSymlinks(filepath.Join(root, "haloy/apps/api.yaml"))
+	if got != want {
+		t.Errorf("FindConfigFile() = %s, want %s", got, want)
+	}
+
+	if _, err := FindConfigFile("apps/missing"); err == nil {
+		t.Error("FindConfigFile() expected error for a missing app")
+	}
+}
+
+func TestFindConfigFiles(t *testing.T) {
+	root := t.TempDir()
+	writeConfigFiles(t, root, map[string]string{
+		"haloy/base.yaml":        "server: haloy.example.com\n",
+		"haloy/apps/web.yaml":    "name: web\n",
+		"haloy/apps/api.yaml":    "name: api\n",
+		"haloy/apps/README.md":   "# Apps\n",
+		"haloy/.drafts/new.yaml": "name: new\n",
+	})
+
+	relative := func(files []string) string {
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i], _ = filepath.Rel(root, file)
+		}
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		recursive bool
+		want      string
+		errMsg    string
+	}{
+		{name: "directory", path: "haloy/apps", want: "haloy/apps/api.yaml,haloy/apps/web.yaml"},
+		{name: "recursive skips base and hidden directories", path: "haloy", recursive: true, want: "haloy/apps/api.yaml,haloy/apps/web.yaml"},
+		{name: "file", path: "haloy/apps/web.yaml", want: "haloy/apps/web.yaml"},
+		{name: "no config files", path: "haloy", errMsg: "no config files found"},
+		{name: "missing path", path: "missing", errMsg: "path does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := FindConfigFiles(filepath.Join(root, tt.path), tt.recursive)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("FindConfigFiles() error = %v, expected to contain %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindConfigFiles() unexpected error = %v", err)
+			}
+			if got := relative(files); got != tt.want {
+				t.Errorf("FindConfigFiles() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
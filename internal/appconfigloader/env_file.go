@@ -0,0 +1,127 @@
+package appconfigloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/joho/godotenv"
+)
+
+const (
+	envFileSecretPrefix = "${secret:"
+	envFileEnvPrefix    = "${env:"
+)
+
+// expandEnvFiles loads the env files of the base config and each target into their Env lists.
+// Paths are relative to baseDir. The EnvFile fields are cleared so the files are only read once
+// and the stored raw config used for rollbacks doesn't depend on files on the client.
+func expandEnvFiles(appConfig *config.AppConfig, baseDir string) error {
+	if err := expandTargetEnvFiles(&appConfig.TargetConfig, baseDir, appConfig.Format); err != nil {
+		return err
+	}
+
+	for targetName, target := range appConfig.Targets {
+		if target == nil {
+			continue
+		}
+		if err := expandTargetEnvFiles(target, baseDir, appConfig.Format); err != nil {
+			return fmt.Errorf("target '%s': %w", targetName, err)
+		}
+	}
+
+	return nil
+}
+
+// expandTargetEnvFiles merges the variables from the env files with the explicit env entries.
+// Later files override earlier ones and explicit env entries override values from any file.
+func expandTargetEnvFiles(tc *config.TargetConfig, baseDir, format string) error {
+	if len(tc.EnvFile) == 0 {
+		return nil
+	}
+
+	var fileEnv []config.EnvVar
+	for _, envFile := range tc.EnvFile {
+		if strings.TrimSpace(envFile) == "" {
+			return fmt.Errorf("%s contains an empty path", config.GetFieldNameForFormat(config.TargetConfig{}, "EnvFile", format))
+		}
+
+		path := envFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		vars, err := readEnvFile(path)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range vars {
+			fileEnv = slices.DeleteFunc(fileEnv, func(existing config.EnvVar) bool { return existing.Name == ev.Name })
+			fileEnv = append(fileEnv, ev)
+		}
+	}
+
+	env := make([]config.EnvVar, 0, len(fileEnv)+len(tc.Env))
+	for _, ev := range fileEnv {
+		overridden := slices.ContainsFunc(tc.Env, func(explicit config.EnvVar) bool { return explicit.Name == ev.Name })
+		if !overridden {
+			env = append(env, ev)
+		}
+	}
+	tc.Env = append(env, tc.Env...)
+	tc.EnvFile = nil
+
+	return nil
+}
+
+// readEnvFile parses a dotenv file and returns its variables sorted by name.
+func readEnvFile(path string) ([]config.EnvVar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer f.Close()
+
+	values, err := godotenv.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse env file %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	vars := make([]config.EnvVar, 0, len(names))
+	for _, name := range names {
+		ev := config.EnvVar{
+			Name:        name,
+			ValueSource: parseEnvFileValue(values[name]),
+		}
+		if err := ev.Validate(""); err != nil {
+			return nil, fmt.Errorf("invalid env file %s: %w", path, err)
+		}
+		vars = append(vars, ev)
+	}
+
+	return vars, nil
+}
+
+// parseEnvFileValue turns a value from an env file into a ValueSource. Values written as
+// ${secret:provider:source.key} or ${env:NAME} become references resolved like 'from' blocks.
+func parseEnvFileValue(value string) config.ValueSource {
+	if strings.HasSuffix(value, "}") {
+		if ref, ok := strings.CutPrefix(value, envFileSecretPrefix); ok {
+			return config.ValueSource{From: &config.SourceReference{Secret: strings.TrimSuffix(ref, "}")}}
+		}
+		if ref, ok := strings.CutPrefix(value, envFileEnvPrefix); ok {
+			return config.ValueSource{From: &config.SourceReference{Env: strings.TrimSuffix(ref, "}")}}
+		}
+	}
+	return config.ValueSource{Value: value}
+}
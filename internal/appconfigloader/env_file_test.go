@@ -0,0 +1,83 @@
+package appconfigloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/config"
+)
+
+func TestExpandEnvFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		".env":            "DATABASE_URL=postgres://localhost:5432/myapp\nDEBUG=true\nAPI_KEY='${secret:onepassword:api-keys.secret-key}'\n",
+		".env.production": "DEBUG=false\nVERSION=${env:APP_VERSION}\n",
+		".env.invalid":    "EMPTY=\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write env file: %v", err)
+		}
+	}
+
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			EnvFile: []string{".env", ".env.production"},
+			Env: []config.EnvVar{
+				{Name: "DATABASE_URL", ValueSource: config.ValueSource{Value: "postgres://db:5432/production"}},
+			},
+		},
+		Targets: map[string]*config.TargetConfig{
+			"staging": {EnvFile: []string{filepath.Join(tempDir, ".env")}},
+		},
+		Format: "yaml",
+	}
+
+	if err := expandEnvFiles(&appConfig, tempDir); err != nil {
+		t.Fatalf("expandEnvFiles() unexpected error = %v", err)
+	}
+
+	if appConfig.EnvFile != nil {
+		t.Errorf("expandEnvFiles() EnvFile = %v, want nil", appConfig.EnvFile)
+	}
+
+	env := make(map[string]config.ValueSource)
+	for _, ev := range appConfig.Env {
+		if _, exists := env[ev.Name]; exists {
+			t.Errorf("expandEnvFiles() duplicate env var %s", ev.Name)
+		}
+		env[ev.Name] = ev.ValueSource
+	}
+
+	if len(env) != 4 {
+		t.Errorf("expandEnvFiles() got %d env vars, want 4", len(env))
+	}
+	if env["DATABASE_URL"].Value != "postgres://db:5432/production" {
+		t.Errorf("explicit env should override env file, got DATABASE_URL = %s", env["DATABASE_URL"].Value)
+	}
+	if env["DEBUG"].Value != "false" {
+		t.Errorf("later env file should override earlier, got DEBUG = %s", env["DEBUG"].Value)
+	}
+	if from := env["API_KEY"].From; from == nil || from.Secret != "onepassword:api-keys.secret-key" {
+		t.Errorf("expected API_KEY to be a secret reference, got %+v", env["API_KEY"])
+	}
+	if from := env["VERSION"].From; from == nil || from.Env != "APP_VERSION" {
+		t.Errorf("expected VERSION to be an env reference, got %+v", env["VERSION"])
+	}
+
+	if len(appConfig.Targets["staging"].Env) != 3 {
+		t.Errorf("expandEnvFiles() got %d env vars for target, want 3", len(appConfig.Targets["staging"].Env))
+	}
+
+	missing := config.AppConfig{TargetConfig: config.TargetConfig{EnvFile: []string{".env.missing"}}}
+	if err := expandEnvFiles(&missing, tempDir); err == nil {
+		t.Errorf("expandEnvFiles() expected error for missing env file")
+	}
+
+	invalid := config.AppConfig{TargetConfig: config.TargetConfig{EnvFile: []string{".env.invalid"}}}
+	if err := expandEnvFiles(&invalid, tempDir); err == nil {
+		t.Errorf("expandEnvFiles() expected error for empty value")
+	}
+}
@@ -1,9 +1,11 @@
 package appconfigloader
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -12,9 +14,9 @@ import (
 
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/ui"
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/jinzhu/copier"
-	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
 )
 
@@ -38,6 +40,8 @@ func Load(
 		}
 
 		if len(targets) > 0 {
+			// Selected targets can extend targets that aren't selected.
+			rawAppConfig.DefinedTargets = rawAppConfig.Targets
 
 			filteredTargets := make(map[string]*config.TargetConfig)
 			for _, targetName := range targets {
@@ -108,6 +112,10 @@ func MergeImage(targetConfig config.TargetConfig, images map[string]*config.Imag
 }
 
 func MergeToTarget(appConfig config.AppConfig, targetConfig config.TargetConfig, targetName string) (config.TargetConfig, error) {
+	if appConfig.Extends != "" {
+		return config.TargetConfig{}, errors.New("extends can only be set on targets")
+	}
+
 	var tc config.TargetConfig
 	if err := copier.Copy(&tc, &targetConfig); err != nil {
 		return config.TargetConfig{}, fmt.Errorf("failed to deep copy target config for merging: %w", err)
@@ -123,63 +131,257 @@ func MergeToTarget(appConfig config.AppConfig, targetConfig config.TargetConfig,
 		}
 	}
 
-	mergedImage, err := MergeImage(targetConfig, appConfig.Images, appConfig.Image)
+	// The targets it extends come first, nearest first, then the top level.
+	ancestors, err := extendedTargets(appConfig, targetConfig, targetName)
+	if err != nil {
+		return config.TargetConfig{}, err
+	}
+	for _, ancestor := range ancestors {
+		switch {
+		case tc.Image == nil && tc.ImageKey == "":
+			if ancestor.Image != nil {
+				image := *ancestor.Image
+				tc.Image = &image
+			}
+			tc.ImageKey = ancestor.ImageKey
+		case tc.Image != nil && ancestor.Image != nil:
+			// Only fails without an image, so the error can't happen here.
+			tc.Image, _ = MergeImage(tc, nil, ancestor.Image)
+		}
+		inheritTargetFields(&tc, ancestor)
+	}
+	tc.Extends = ""
+
+	mergedImage, err := MergeImage(tc, appConfig.Images, appConfig.Image)
 	if err != nil {
 		return config.TargetConfig{}, fmt.Errorf("failed to resolve image for target '%s': %w", targetName, err)
 	}
 	tc.Image = mergedImage
 
+	inheritTargetFields(&tc, &appConfig.TargetConfig)
+
+	// Scoping and overrides are resolved here so the merged target only carries its final env list.
+	tc.Env = applyEnvOverrides(scopeEnv(tc.Env, targetName), tc.EnvOverrides)
+	tc.EnvOverrides = nil
+
+	normalizeTargetConfig(&tc)
+
+	return tc, nil
+}
+
+// extendedTargets returns the chain of targets the target extends, nearest first.
+func extendedTargets(appConfig config.AppConfig, targetConfig config.TargetConfig, targetName string) ([]*config.TargetConfig, error) {
+	targets := appConfig.DefinedTargets
+	if targets == nil {
+		targets = appConfig.Targets
+	}
+
+	var chain []*config.TargetConfig
+	visited := []string{targetName}
+	for name := targetConfig.Extends; name != ""; {
+		if slices.Contains(visited, name) {
+			return nil, fmt.Errorf("target '%s' has a cycle in extends: %s", targetName, strings.Join(append(visited, name), " -> "))
+		}
+		parent, ok := targets[name]
+		if !ok || parent == nil {
+			return nil, fmt.Errorf("target '%s' extends unknown target '%s'", visited[len(visited)-1], name)
+		}
+		chain = append(chain, parent)
+		visited = append(visited, name)
+		name = parent.Extends
+	}
+	return chain, nil
+}
+
+// inheritTargetFields sets the fields of tc that aren't set from the parent, which is the
+// top level of the config or a target tc extends. The name and image are merged separately.
+func inheritTargetFields(tc *config.TargetConfig, parent *config.TargetConfig) {
 	if tc.Server == "" {
-		tc.Server = appConfig.Server
+		tc.Server = parent.Server
 	}
 
 	if tc.APIToken == nil {
-		tc.APIToken = appConfig.APIToken
+		tc.APIToken = parent.APIToken
+	}
+
+	if tc.Exposure == "" {
+		tc.Exposure = parent.Exposure
 	}
 
-	if tc.Domains == nil {
-		tc.Domains = appConfig.Domains
+	// Internal targets don't inherit the domains of public ones.
+	if tc.Domains == nil && tc.Exposure != config.ExposureInternal {
+		tc.Domains = parent.Domains
 	}
 
 	if tc.ACMEEmail == "" {
-		tc.ACMEEmail = appConfig.ACMEEmail
+		tc.ACMEEmail = parent.ACMEEmail
+	}
+
+	if !tc.ACMEStaging {
+		tc.ACMEStaging = parent.ACMEStaging
+	}
+
+	if !tc.RequireApproval {
+		tc.RequireApproval = parent.RequireApproval
+	}
+
+	if tc.Annotations == nil {
+		tc.Annotations = parent.Annotations
 	}
 
 	if tc.Env == nil {
-		tc.Env = appConfig.Env
+		tc.Env = parent.Env
+	}
+
+	if tc.EnvOverrides == nil {
+		tc.EnvOverrides = parent.EnvOverrides
+	}
+
+	if tc.EnvSchema == nil {
+		tc.EnvSchema = parent.EnvSchema
 	}
 
 	if tc.HealthCheckPath == "" {
-		tc.HealthCheckPath = appConfig.HealthCheckPath
+		tc.HealthCheckPath = parent.HealthCheckPath
+	}
+
+	if tc.HealthCheck == nil {
+		tc.HealthCheck = parent.HealthCheck
+	}
+
+	if tc.Warmup == nil {
+		tc.Warmup = parent.Warmup
+	}
+
+	if tc.Connections == nil {
+		tc.Connections = parent.Connections
+	}
+
+	if tc.Autoscale == nil {
+		tc.Autoscale = parent.Autoscale
+	}
+
+	if tc.ShadowTo == nil {
+		tc.ShadowTo = parent.ShadowTo
+	}
+
+	if tc.DeployWebhook == nil {
+		tc.DeployWebhook = parent.DeployWebhook
+	}
+
+	if tc.ImageWatch == nil {
+		tc.ImageWatch = parent.ImageWatch
+	}
+
+	if tc.Sidecars == nil {
+		tc.Sidecars = parent.Sidecars
+	}
+
+	if tc.InitContainers == nil {
+		tc.InitContainers = parent.InitContainers
+	}
+
+	if tc.Logging == nil {
+		tc.Logging = parent.Logging
+	}
+
+	if tc.Labels == nil {
+		tc.Labels = parent.Labels
 	}
 
 	if tc.Port == "" {
-		tc.Port = appConfig.Port
+		tc.Port = parent.Port
 	}
 
 	if tc.Replicas == nil {
-		tc.Replicas = appConfig.Replicas
+		tc.Replicas = parent.Replicas
 	}
 
 	if tc.Network == "" {
-		tc.Network = appConfig.Network
+		tc.Network = parent.Network
+	}
+
+	if tc.Networks == nil {
+		tc.Networks = parent.Networks
+	}
+
+	if tc.Frontend == "" {
+		tc.Frontend = parent.Frontend
+	}
+
+	if tc.ExternalLBTarget == "" {
+		tc.ExternalLBTarget = parent.ExternalLBTarget
+	}
+
+	if tc.DNS == nil {
+		tc.DNS = parent.DNS
+	}
+
+	if tc.DNSSearch == nil {
+		tc.DNSSearch = parent.DNSSearch
+	}
+
+	if tc.ExtraHosts == nil {
+		tc.ExtraHosts = parent.ExtraHosts
 	}
 
 	if tc.Volumes == nil {
-		tc.Volumes = appConfig.Volumes
+		tc.Volumes = parent.Volumes
 	}
 
 	if tc.PreDeploy == nil {
-		tc.PreDeploy = appConfig.PreDeploy
+		tc.PreDeploy = parent.PreDeploy
 	}
 
 	if tc.PostDeploy == nil {
-		tc.PostDeploy = appConfig.PostDeploy
+		tc.PostDeploy = parent.PostDeploy
 	}
+}
 
-	normalizeTargetConfig(&tc)
+// scopeEnv returns the env vars that apply to the target. Scoping only applies to named targets
+// and is removed from the returned vars, so merging an already merged target is a no-op.
+func scopeEnv(env []config.EnvVar, targetName string) []config.EnvVar {
+	if env == nil {
+		return nil
+	}
 
-	return tc, nil
+	scoped := make([]config.EnvVar, 0, len(env))
+	for _, ev := range env {
+		if len(ev.Targets) > 0 && targetName != "" && !slices.Contains(ev.Targets, targetName) {
+			continue
+		}
+		ev.Targets = nil
+		scoped = append(scoped, ev)
+	}
+	return scoped
+}
+
+// applyEnvOverrides replaces the value of existing env vars and appends the ones that don't exist yet.
+func applyEnvOverrides(env []config.EnvVar, overrides map[string]*config.ValueSource) []config.EnvVar {
+	if len(overrides) == 0 {
+		return env
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		// A nil override results in an empty value which fails validation of the merged target.
+		var override config.ValueSource
+		if overrides[name] != nil {
+			override = *overrides[name]
+		}
+		i := slices.IndexFunc(env, func(ev config.EnvVar) bool { return ev.Name == name })
+		if i >= 0 {
+			env[i].ValueSource = override
+		} else {
+			env = append(env, config.EnvVar{Name: name, ValueSource: override})
+		}
+	}
+	return env
 }
 
 // normalizeTargetConfig applies default values to a target config
@@ -206,6 +408,10 @@ func normalizeTargetConfig(tc *config.TargetConfig) {
 
 	if tc.Replicas == nil {
 		defaultReplicas := constants.DefaultReplicas
+		// Autoscaled apps start at the lower bound.
+		if tc.Autoscale != nil && tc.Autoscale.Min != nil {
+			defaultReplicas = *tc.Autoscale.Min
+		}
 		tc.Replicas = &defaultReplicas
 	}
 }
@@ -229,7 +435,7 @@ func ExtractTargets(appConfig config.AppConfig) (map[string]config.TargetConfig,
 			}
 
 			if err := mergedTargetConfig.Validate(appConfig.Format); err != nil {
-				return nil, fmt.Errorf("validation failed for target '%s': %w", targetName, err)
+				return nil, fmt.Errorf("%svalidation failed for target '%s': %w", locationPrefix(appConfig.TargetLocations[targetName]), targetName, err)
 			}
 			extractedTargetConfigs[targetName] = mergedTargetConfig
 		}
@@ -239,7 +445,7 @@ func ExtractTargets(appConfig config.AppConfig) (map[string]config.TargetConfig,
 			return nil, fmt.Errorf("failed to merge config: %w", err)
 		}
 		if err := mergedSingleTargetConfig.Validate(appConfig.Format); err != nil {
-			return nil, fmt.Errorf("config invalid: %w", err)
+			return nil, fmt.Errorf("%sconfig invalid: %w", locationPrefix(appConfig.Source), err)
 		}
 		extractedTargetConfigs[appConfig.Name] = mergedSingleTargetConfig
 	}
@@ -263,15 +469,28 @@ func LoadRawAppConfig(configPath string) (config.AppConfig, string, error) {
 		return config.AppConfig{}, "", err
 	}
 
-	k := koanf.New(".")
-	if err := k.Load(file.Provider(configFile), parser); err != nil {
-		return config.AppConfig{}, "", fmt.Errorf("failed to load config file: %w", err)
+	baseFile, err := findBaseConfig(configFile)
+	if err != nil {
+		return config.AppConfig{}, "", err
 	}
 
-	configKeys := k.Keys()
-	appConfigType := reflect.TypeOf(config.AppConfig{})
-
-	if err := config.CheckUnknownFields(appConfigType, configKeys, format); err != nil {
+	targetLocations := make(map[string]string)
+	k := koanf.New(".")
+	if baseFile != "" {
+		// The app config is loaded on top of the base, so maps are merged key by key
+		// and any other value set by the app replaces the one from the base.
+		baseFormat, err := config.GetConfigFormat(baseFile)
+		if err != nil {
+			return config.AppConfig{}, "", err
+		}
+		if baseFormat != format {
+			return config.AppConfig{}, "", fmt.Errorf("base config %s must use the same format as %s", filepath.Base(baseFile), filepath.Base(configFile))
+		}
+		if err := loadConfigLayer(k, baseFile, format, parser, targetLocations); err != nil {
+			return config.AppConfig{}, "", err
+		}
+	}
+	if err := loadConfigLayer(k, configFile, format, parser, targetLocations); err != nil {
 		return config.AppConfig{}, "", err
 	}
 
@@ -293,9 +512,76 @@ func LoadRawAppConfig(configPath string) (config.AppConfig, string, error) {
 		return config.AppConfig{}, "", fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	appConfig.Format = format
+	appConfig.Source = sourceLocation(configFile, 0, 0)
+	appConfig.TargetLocations = targetLocations
+	if err := expandEnvFiles(&appConfig, filepath.Dir(configFile)); err != nil {
+		return config.AppConfig{}, "", err
+	}
+
 	return appConfig, format, nil
 }
 
+// loadConfigLayer loads a config file on top of the values already in k. Deprecated fields
+// are moved to the fields that replaced them, with a warning pointing at the file and line,
+// and unknown fields are reported with their position. The location of each target is
+// added to targetLocations.
+func loadConfigLayer(k *koanf.Koanf, configFile, format string, parser koanf.Parser, targetLocations map[string]string) error {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
+	}
+	raw, err := parser.Unmarshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to load config file %s: %w", sourceLocation(configFile, 0, 0), err)
+	}
+
+	deprecations, err := migrateRaw(raw, content, configFile, format)
+	if err != nil {
+		return err
+	}
+	for _, deprecation := range deprecations {
+		ui.Warn("%s, run 'haloy config migrate' to update the config", deprecation)
+	}
+
+	layer := koanf.New(".")
+	if err := layer.Load(mapProvider(raw), nil); err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
+	}
+	if err := config.CheckUnknownFields(reflect.TypeOf(config.AppConfig{}), layer.Keys(), format); err != nil {
+		var unknownErr *config.UnknownFieldsError
+		if !errors.As(err, &unknownErr) {
+			return err
+		}
+		type positioned struct {
+			line, column int
+			message      string
+		}
+		fields := make([]positioned, len(unknownErr.Fields))
+		for i, field := range unknownErr.Fields {
+			line, column := keyPosition(content, strings.Split(field.Key, "."), format)
+			fields[i] = positioned{line, column, fmt.Sprintf("%s: %s", sourceLocation(configFile, line, column), field)}
+		}
+		slices.SortStableFunc(fields, func(a, b positioned) int {
+			return cmp.Or(a.line-b.line, a.column-b.column)
+		})
+		lines := make([]string, len(fields))
+		for i, field := range fields {
+			lines[i] = field.message
+		}
+		return errors.New(strings.Join(lines, "\n"))
+	}
+
+	if targets, ok := raw["targets"].(map[string]any); ok {
+		for name := range targets {
+			line, column := keyPosition(content, []string{"targets", name}, format)
+			targetLocations[name] = sourceLocation(configFile, line, column)
+		}
+	}
+
+	return k.Merge(layer)
+}
+
 var (
 	supportedExtensions  = []string{".json", ".yaml", ".yml", ".toml"}
 	supportedConfigNames = []string{"haloy.json", "haloy.yaml", "haloy.yml", "haloy.toml"}
@@ -306,6 +592,7 @@ var (
 // - Full path to a config file
 // - Directory containing a haloy config file
 // - Relative paths
+// - App references like "apps/api", resolved to apps/api.yaml or haloy/apps/api.yaml
 func FindConfigFile(path string) (string, error) {
 	// If no path provided, use current directory
 	if path == "" {
@@ -321,6 +608,9 @@ func FindConfigFile(path string) (string, error) {
 	// Check if the path exists
 	stat, err := os.Stat(absPath)
 	if err != nil {
+		if resolved, ok := resolveAppShorthand(path); ok {
+			return resolved, nil
+		}
 		return "", fmt.Errorf("path does not exist: %s", absPath)
 	}
 
@@ -352,3 +642,48 @@ func FindConfigFile(path string) (string, error) {
 	return "", fmt.Errorf("no haloy config file found in directory %s (looking for: %s)",
 		dirName, strings.Join(supportedConfigNames, ", "))
 }
+
+// FindConfigFiles returns the config file at path, or the config files in the directory at path sorted
+// by name. Subdirectories are only searched when recursive is set, hidden ones never. Base configs of
+// monorepo layouts are skipped, they're loaded with the app configs in apps/ next to them.
+func FindConfigFiles(path string, recursive bool) ([]string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	stat, err := os.Stat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("path does not exist: %s", absPath)
+	}
+	if !stat.IsDir() {
+		configFile, err := FindConfigFile(absPath)
+		if err != nil {
+			return nil, err
+		}
+		return []string{configFile}, nil
+	}
+
+	var configFiles []string
+	err = filepath.WalkDir(absPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != absPath && (!recursive || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if slices.Contains(supportedExtensions, filepath.Ext(path)) && !isBaseConfig(path) {
+			configFiles = append(configFiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", absPath, err)
+	}
+	if len(configFiles) == 0 {
+		return nil, fmt.Errorf("no config files found in %s (must be .json, .yaml, .yml, or .toml)", absPath)
+	}
+	return configFiles, nil
+}
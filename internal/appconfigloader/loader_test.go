@@ -490,3 +490,263 @@ func TestExtractTargets(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeToTarget_EnvScopingAndOverrides(t *testing.T) {
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			Name:  "myapp",
+			Image: &config.Image{Repository: "nginx", Tag: "latest"},
+			Env: []config.EnvVar{
+				{Name: "LOG_LEVEL", ValueSource: config.ValueSource{Value: "info"}},
+				{Name: "SENTRY_DSN", ValueSource: config.ValueSource{Value: "https://sentry.example.com"}, Targets: []string{"prod"}},
+				{Name: "DEBUG", ValueSource: config.ValueSource{Value: "true"}, Targets: []string{"staging", "dev"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		targetConfig config.TargetConfig
+		targetName   string
+		expectedEnv  map[string]string
+	}{
+		{
+			name:        "scoped to prod",
+			targetName:  "prod",
+			expectedEnv: map[string]string{"LOG_LEVEL": "info", "SENTRY_DSN": "https://sentry.example.com"},
+		},
+		{
+			name: "scoped to staging with overrides",
+			targetConfig: config.TargetConfig{
+				EnvOverrides: map[string]*config.ValueSource{
+					"LOG_LEVEL": {Value: "debug"},
+					"FEATURE_X": {Value: "enabled"},
+				},
+			},
+			targetName:  "staging",
+			expectedEnv: map[string]string{"LOG_LEVEL": "debug", "DEBUG": "true", "FEATURE_X": "enabled"},
+		},
+		{
+			name:        "single target ignores scoping",
+			targetName:  "",
+			expectedEnv: map[string]string{"LOG_LEVEL": "info", "SENTRY_DSN": "https://sentry.example.com", "DEBUG": "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := MergeToTarget(appConfig, tt.targetConfig, tt.targetName)
+			if err != nil {
+				t.Fatalf("MergeToTarget() unexpected error = %v", err)
+			}
+			if result.EnvOverrides != nil {
+				t.Errorf("MergeToTarget() EnvOverrides = %v, expected nil", result.EnvOverrides)
+			}
+			if len(result.Env) != len(tt.expectedEnv) {
+				t.Errorf("MergeToTarget() env count = %d, expected %d", len(result.Env), len(tt.expectedEnv))
+			}
+			for _, ev := range result.Env {
+				if ev.Targets != nil {
+					t.Errorf("MergeToTarget() env %s still has targets %v", ev.Name, ev.Targets)
+				}
+				if expected, ok := tt.expectedEnv[ev.Name]; !ok || ev.Value != expected {
+					t.Errorf("MergeToTarget() env %s = %s, expected %s", ev.Name, ev.Value, expected)
+				}
+			}
+		})
+	}
+
+	if appConfig.Env[0].Value != "info" || len(appConfig.Env[1].Targets) != 1 {
+		t.Errorf("MergeToTarget() modified the base env")
+	}
+}
+
+func TestMergeToTarget_InternalExposure(t *testing.T) {
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			Name:    "myapp",
+			Image:   &config.Image{Repository: "nginx", Tag: "latest"},
+			Domains: []config.Domain{{Canonical: "example.com"}},
+		},
+	}
+
+	public, err := MergeToTarget(appConfig, config.TargetConfig{}, "web")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if len(public.Domains) != 1 {
+		t.Errorf("MergeToTarget() public target Domains = %v, expected the base domains", public.Domains)
+	}
+
+	internal, err := MergeToTarget(appConfig, config.TargetConfig{Exposure: config.ExposureInternal}, "worker")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if len(internal.Domains) != 0 {
+		t.Errorf("MergeToTarget() internal target Domains = %v, expected none", internal.Domains)
+	}
+}
+
+func TestMergeToTarget_Annotations(t *testing.T) {
+	// Rollbacks merge the stored app config, which holds the annotations of the deployment.
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			Name:        "myapp",
+			Image:       &config.Image{Repository: "nginx", Tag: "latest"},
+			Annotations: map[string]string{"git.commit": "abc123"},
+		},
+	}
+
+	result, err := MergeToTarget(appConfig, config.TargetConfig{}, "prod")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if result.Annotations["git.commit"] != "abc123" {
+		t.Errorf("MergeToTarget() Annotations = %v, expected the base annotations", result.Annotations)
+	}
+}
+
+func TestMergeToTarget_AutoscaleReplicas(t *testing.T) {
+	minReplicas, maxReplicas := 2, 6
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			Name:      "myapp",
+			Image:     &config.Image{Repository: "nginx", Tag: "latest"},
+			Autoscale: &config.Autoscale{Min: &minReplicas, Max: &maxReplicas},
+		},
+	}
+
+	result, err := MergeToTarget(appConfig, config.TargetConfig{}, "prod")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if result.Autoscale == nil {
+		t.Fatalf("MergeToTarget() Autoscale should be inherited from the base")
+	}
+	if result.Replicas == nil || *result.Replicas != minReplicas {
+		t.Errorf("MergeToTarget() Replicas = %v, expected autoscale.min (%d)", result.Replicas, minReplicas)
+	}
+}
+
+func TestMergeToTarget_Extends(t *testing.T) {
+	prodReplicas := 3
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			Name:      "myapp",
+			Image:     &config.Image{Repository: "ghcr.io/example/app", Tag: "latest"},
+			ACMEEmail: "ops@example.com",
+			Port:      "3000",
+		},
+		Targets: map[string]*config.TargetConfig{
+			"production": {
+				Server:   "prod.haloy.com",
+				Image:    &config.Image{Tag: "v1.2.3"},
+				Replicas: &prodReplicas,
+				Env:      []config.EnvVar{{Name: "NODE_ENV", ValueSource: config.ValueSource{Value: "production"}}},
+			},
+			"canary": {
+				Name:    "myapp-canary",
+				Extends: "production",
+				Image:   &config.Image{Tag: "v1.3.0-rc1"},
+			},
+			"canary-eu": {
+				Name:    "myapp-canary-eu",
+				Extends: "canary",
+				Server:  "eu.haloy.com",
+			},
+		},
+	}
+
+	canary, err := MergeToTarget(appConfig, *appConfig.Targets["canary"], "canary")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if canary.Name != "myapp-canary" {
+		t.Errorf("Name = %s, the name should not be inherited from the extended target", canary.Name)
+	}
+	if canary.Image.Repository != "ghcr.io/example/app" || canary.Image.Tag != "v1.3.0-rc1" {
+		t.Errorf("Image = %s:%s, want ghcr.io/example/app:v1.3.0-rc1", canary.Image.Repository, canary.Image.Tag)
+	}
+	if canary.Server != "prod.haloy.com" {
+		t.Errorf("Server = %s, want it inherited from production", canary.Server)
+	}
+	if canary.Replicas == nil || *canary.Replicas != prodReplicas {
+		t.Errorf("Replicas = %v, want it inherited from production", canary.Replicas)
+	}
+	if len(canary.Env) != 1 || canary.Env[0].Value != "production" {
+		t.Errorf("Env = %v, want it inherited from production", canary.Env)
+	}
+	if canary.ACMEEmail != "ops@example.com" || canary.Port != "3000" {
+		t.Errorf("top level fields should still be inherited, got acme email %q and port %q", canary.ACMEEmail, canary.Port)
+	}
+	if canary.Extends != "" {
+		t.Errorf("Extends = %s, the merged target should not carry it", canary.Extends)
+	}
+
+	canaryEU, err := MergeToTarget(appConfig, *appConfig.Targets["canary-eu"], "canary-eu")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if canaryEU.Server != "eu.haloy.com" || canaryEU.Image.Tag != "v1.3.0-rc1" || *canaryEU.Replicas != prodReplicas {
+		t.Errorf("chained extends not resolved, got server %s, tag %s, replicas %d", canaryEU.Server, canaryEU.Image.Tag, *canaryEU.Replicas)
+	}
+
+	// Selecting only the canary keeps the targets it extends available.
+	selected := appConfig
+	selected.DefinedTargets = appConfig.Targets
+	selected.Targets = map[string]*config.TargetConfig{"canary": appConfig.Targets["canary"]}
+	if _, err := MergeToTarget(selected, *selected.Targets["canary"], "canary"); err != nil {
+		t.Errorf("MergeToTarget() with a selected target unexpected error = %v", err)
+	}
+}
+
+func TestMergeToTarget_ExtendsErrors(t *testing.T) {
+	image := &config.Image{Repository: "nginx"}
+	tests := []struct {
+		name    string
+		targets map[string]*config.TargetConfig
+		base    config.TargetConfig
+		target  string
+		errMsg  string
+	}{
+		{
+			name:    "unknown target",
+			targets: map[string]*config.TargetConfig{"canary": {Extends: "production"}},
+			target:  "canary",
+			errMsg:  "target 'canary' extends unknown target 'production'",
+		},
+		{
+			name:    "self",
+			targets: map[string]*config.TargetConfig{"canary": {Extends: "canary"}},
+			target:  "canary",
+			errMsg:  "canary -> canary",
+		},
+		{
+			name: "cycle",
+			targets: map[string]*config.TargetConfig{
+				"a": {Extends: "b"},
+				"b": {Extends: "c"},
+				"c": {Extends: "a"},
+			},
+			target: "a",
+			errMsg: "target 'a' has a cycle in extends: a -> b -> c -> a",
+		},
+		{
+			name:    "top level",
+			base:    config.TargetConfig{Extends: "production"},
+			targets: map[string]*config.TargetConfig{"production": {}},
+			target:  "production",
+			errMsg:  "extends can only be set on targets",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.base.Image = image
+			appConfig := config.AppConfig{TargetConfig: tt.base, Targets: tt.targets}
+			_, err := MergeToTarget(appConfig, *tt.targets[tt.target], tt.target)
+			if err == nil || !helpers.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("MergeToTarget() error = %v, want it to contain %q", err, tt.errMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package appconfigloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Deprecation is a deprecated field found in a config file.
+type Deprecation struct {
+	File string
+	// Line and Column are the position of the field in the file, 0 when it couldn't be found.
+	Line   int
+	Column int
+	From   string
+	To     string
+}
+
+func (d Deprecation) String() string {
+	return fmt.Sprintf("%s: '%s' is deprecated, use '%s' instead", d.location(), d.From, d.To)
+}
+
+// MigratedFile is a config file with its deprecated fields moved to the current fields.
+type MigratedFile struct {
+	Path         string
+	Original     []byte
+	Migrated     []byte
+	Deprecations []Deprecation
+}
+
+// MigrateConfig migrates the config file at configPath and the base config it's layered on.
+// Files are only read, the caller decides whether to write the migrated content.
+func MigrateConfig(configPath string) ([]MigratedFile, error) {
+	configFile, err := FindConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	baseFile, err := findBaseConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{configFile}
+	if baseFile != "" {
+		files = append([]string{baseFile}, files...)
+	}
+
+	var migrated []MigratedFile
+	for _, file := range files {
+		format, err := config.GetConfigFormat(file)
+		if err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		var result []byte
+		var deprecations []Deprecation
+		if format == "yaml" {
+			result, deprecations, err = migrateYAML(content, file)
+		} else {
+			result, deprecations, err = migrateMarshaled(content, file, format)
+		}
+		if err != nil {
+			return nil, err
+		}
+		migrated = append(migrated, MigratedFile{
+			Path:         file,
+			Original:     content,
+			Migrated:     result,
+			Deprecations: deprecations,
+		})
+	}
+	return migrated, nil
+}
+
+// migrateScopes returns the paths of the sections migrations apply to: the top level of
+// the config and, for target fields, every entry of targets.
+func migrateScopes(targetNames []string) [][]string {
+	scopes := [][]string{nil}
+	for _, name := range targetNames {
+		scopes = append(scopes, []string{"targets", name})
+	}
+	return scopes
+}
+
+// migrateRaw moves the deprecated fields of a parsed config to the current fields.
+func migrateRaw(raw map[string]any, content []byte, file, format string) ([]Deprecation, error) {
+	var targetNames []string
+	if targets, ok := raw["targets"].(map[string]any); ok {
+		targetNames = slices.Sorted(maps.Keys(targets))
+	}
+
+	var deprecations []Deprecation
+	for _, migration := range config.AppConfigMigrations {
+		for _, scope := range migrateScopes(targetNames) {
+			if len(scope) > 0 && !migration.Target {
+				continue
+			}
+			section, ok := lookupPath(raw, scope)
+			if !ok {
+				continue
+			}
+			sectionMap, ok := section.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			deprecation, found, err := newDeprecation(migration, scope, content, file, format, func(path []string) bool {
+				_, ok := lookupPath(sectionMap, path)
+				return ok
+			})
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				continue
+			}
+
+			value := removePath(sectionMap, migration.FromPath(format))
+			setPath(sectionMap, migration.ToPath(format), value)
+			deprecations = append(deprecations, deprecation)
+		}
+	}
+	sortDeprecations(deprecations)
+	return deprecations, nil
+}
+
+func sortDeprecations(deprecations []Deprecation) {
+	slices.SortStableFunc(deprecations, func(a, b Deprecation) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+}
+
+// newDeprecation reports whether the deprecated field of the migration is set in the scope,
+// and fails when the field that replaced it is set as well.
+func newDeprecation(migration config.FieldMigration, scope []string, content []byte, file, format string, exists func([]string) bool) (Deprecation, bool, error) {
+	from := migration.FromPath(format)
+	to := migration.ToPath(format)
+	if !exists(from) {
+		return Deprecation{}, false, nil
+	}
+
+	fromPath := append(slices.Clone(scope), from...)
+	line, column := keyPosition(content, fromPath, format)
+	deprecation := Deprecation{
+		File:   file,
+		Line:   line,
+		Column: column,
+		From:   strings.Join(fromPath, "."),
+		To:     strings.Join(append(slices.Clone(scope), to...), "."),
+	}
+	if exists(to) {
+		return Deprecation{}, false, fmt.Errorf("%s: both '%s' and the deprecated '%s' are set, remove '%s'",
+			deprecation.location(), deprecation.To, deprecation.From, deprecation.From)
+	}
+	return deprecation, true, nil
+}
+
+func (d Deprecation) location() string {
+	return sourceLocation(d.File, d.Line, d.Column)
+}
+
+func lookupPath(m map[string]any, path []string) (any, bool) {
+	var current any = m
+	for _, key := range path {
+		section, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = section[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// removePath removes the value at path and any section it leaves empty.
+func removePath(m map[string]any, path []string) any {
+	if len(path) == 1 {
+		value := m[path[0]]
+		delete(m, path[0])
+		return value
+	}
+	section, ok := m[path[0]].(map[string]any)
+	if !ok {
+		return nil
+	}
+	value := removePath(section, path[1:])
+	if len(section) == 0 {
+		delete(m, path[0])
+	}
+	return value
+}
+
+func setPath(m map[string]any, path []string, value any) {
+	for _, key := range path[:len(path)-1] {
+		section, ok := m[key].(map[string]any)
+		if !ok {
+			section = make(map[string]any)
+			m[key] = section
+		}
+		m = section
+	}
+	m[path[len(path)-1]] = value
+}
+
+// migrateMarshaled migrates json and toml configs by parsing and marshaling them again,
+// which keeps the values but not the layout of the file.
+func migrateMarshaled(content []byte, file, format string) ([]byte, []Deprecation, error) {
+	parser, err := config.GetConfigParser(format)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := parser.Unmarshal(content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	deprecations, err := migrateRaw(raw, content, file, format)
+	if err != nil || len(deprecations) == 0 {
+		return content, deprecations, err
+	}
+
+	var migrated []byte
+	if format == "json" {
+		if migrated, err = json.MarshalIndent(raw, "", "  "); err == nil {
+			migrated = append(migrated, '\n')
+		}
+	} else {
+		migrated, err = parser.Marshal(raw)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write migrated config: %w", err)
+	}
+	return migrated, deprecations, nil
+}
+
+// migrateYAML migrates yaml configs on the document tree, so comments and the order
+// of the fields are kept.
+func migrateYAML(content []byte, file string) ([]byte, []Deprecation, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return content, nil, nil
+	}
+	root := doc.Content[0]
+
+	var targetNames []string
+	if _, targets := yamlLookup(root, []string{"targets"}); targets != nil && targets.Kind == yaml.MappingNode {
+		for i := 0; i < len(targets.Content); i += 2 {
+			targetNames = append(targetNames, targets.Content[i].Value)
+		}
+		slices.Sort(targetNames)
+	}
+
+	var deprecations []Deprecation
+	// Migrations run in reverse so fields moved out of the same section keep their order.
+	for _, migration := range slices.Backward(config.AppConfigMigrations) {
+		for _, scope := range migrateScopes(targetNames) {
+			if len(scope) > 0 && !migration.Target {
+				continue
+			}
+			section := root
+			if len(scope) > 0 {
+				if _, section = yamlLookup(root, scope); section == nil || section.Kind != yaml.MappingNode {
+					continue
+				}
+			}
+
+			deprecation, found, err := newDeprecation(migration, scope, content, file, "yaml", func(path []string) bool {
+				_, value := yamlLookup(section, path)
+				return value != nil
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			if !found {
+				continue
+			}
+
+			// The field takes the place of the deprecated one when it stays in the same section.
+			from, to := migration.FromPath("yaml"), migration.ToPath("yaml")
+			index := yamlIndex(section, from[0])
+			key, value := yamlRemove(section, from)
+			key.Value = to[len(to)-1]
+			if len(to) == 1 {
+				if yamlIndex(section, from[0]) >= 0 {
+					index += 2
+				}
+				section.Content = slices.Insert(section.Content, index, key, value)
+			} else {
+				yamlSet(section, to, key, value)
+			}
+			deprecations = append(deprecations, deprecation)
+		}
+	}
+	if len(deprecations) == 0 {
+		return content, nil, nil
+	}
+	sortDeprecations(deprecations)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to write migrated config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write migrated config: %w", err)
+	}
+	return buf.Bytes(), deprecations, nil
+}
+
+// yamlLookup returns the key and value nodes at path in a mapping node.
+func yamlLookup(node *yaml.Node, path []string) (*yaml.Node, *yaml.Node) {
+	var key *yaml.Node
+	for _, name := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				key, next = node.Content[i], node.Content[i+1]
+				break
+			}
+		}
+		node = next
+	}
+	if node == nil {
+		return nil, nil
+	}
+	return key, node
+}
+
+// yamlIndex returns the index of the key in a mapping node, or -1.
+func yamlIndex(node *yaml.Node, name string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlRemove removes the field at path and any section it leaves empty.
+func yamlRemove(node *yaml.Node, path []string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != path[0] {
+			continue
+		}
+		key, value := node.Content[i], node.Content[i+1]
+		if len(path) == 1 {
+			node.Content = slices.Delete(node.Content, i, i+2)
+			return key, value
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		removedKey, removedValue := yamlRemove(value, path[1:])
+		if len(value.Content) == 0 {
+			node.Content = slices.Delete(node.Content, i, i+2)
+		}
+		return removedKey, removedValue
+	}
+	return nil, nil
+}
+
+// yamlSet adds the field at path, creating the sections leading to it.
+func yamlSet(node *yaml.Node, path []string, key, value *yaml.Node) {
+	for _, name := range path[:len(path)-1] {
+		_, section := yamlLookup(node, []string{name})
+		if section == nil {
+			section = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, section)
+		}
+		node = section
+	}
+	node.Content = append(node.Content, key, value)
+}
+
+// mapProvider is a koanf provider for a config that has already been parsed.
+type mapProvider map[string]any
+
+func (p mapProvider) ReadBytes() ([]byte, error) {
+	return nil, errors.New("mapProvider does not support ReadBytes")
+}
+
+func (p mapProvider) Read() (map[string]any, error) {
+	return p, nil
+}
@@ -0,0 +1,119 @@
+package appconfigloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadRawAppConfig_DeprecatedFields(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "haloy.yaml")
+	content := "name: my-app\nmanager: haloy.example.com\nacme:\n  email: ops@example.com\nimage:\n  repository: ghcr.io/example/app\ntargets:\n  production:\n    healthcheck_path: /up\n"
+	if err := os.WriteFile(configFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	appConfig, _, err := LoadRawAppConfig(configFile)
+	if err != nil {
+		t.Fatalf("LoadRawAppConfig() unexpected error = %v", err)
+	}
+	if appConfig.Server != "haloy.example.com" {
+		t.Errorf("Server = %s, want haloy.example.com", appConfig.Server)
+	}
+	if appConfig.ACMEEmail != "ops@example.com" {
+		t.Errorf("ACMEEmail = %s, want ops@example.com", appConfig.ACMEEmail)
+	}
+	if appConfig.Targets["production"].HealthCheckPath != "/up" {
+		t.Errorf("HealthCheckPath = %s, want /up", appConfig.Targets["production"].HealthCheckPath)
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		content      string
+		wantContent  []string
+		deprecations []string
+		errMsg       string
+	}{
+		{
+			name:         "yaml keeps comments and order",
+			file:         "haloy.yaml",
+			content:      "# app\nname: my-app\nmanager: haloy.example.com # server\nacme:\n  email: ops@example.com\n  staging: true\nport: 8080\n",
+			wantContent:  []string{"# app\nname: my-app\nserver: haloy.example.com # server\nacme_email: ops@example.com\nacme_staging: true\nport: 8080\n"},
+			deprecations: []string{"haloy.yaml:3:1: 'manager' is deprecated, use 'server'", "haloy.yaml:5:3: 'acme.email'", "haloy.yaml:6:3: 'acme.staging'"},
+		},
+		{
+			name:         "yaml target fields",
+			file:         "haloy.yaml",
+			content:      "name: my-app\ntargets:\n  production:\n    manager_token:\n      value: secret\n",
+			wantContent:  []string{"    api_token:\n      value: secret\n"},
+			deprecations: []string{"haloy.yaml:4:5: 'targets.production.manager_token' is deprecated, use 'targets.production.api_token'"},
+		},
+		{
+			name:         "json",
+			file:         "haloy.json",
+			content:      "{\n  \"name\": \"my-app\",\n  \"acme\": {\"email\": \"ops@example.com\"}\n}\n",
+			wantContent:  []string{`"acmeEmail": "ops@example.com"`},
+			deprecations: []string{"haloy.json:3:12: 'acme.email' is deprecated, use 'acmeEmail'"},
+		},
+		{
+			name:         "toml",
+			file:         "haloy.toml",
+			content:      "name = \"my-app\"\n\n[targets.production]\nhealthcheck_path = \"/up\"\n",
+			wantContent:  []string{`health_check_path = "/up"`},
+			deprecations: []string{"haloy.toml:4:1: 'targets.production.healthcheck_path'"},
+		},
+		{
+			name:        "no deprecated fields",
+			file:        "haloy.yaml",
+			content:     "name: my-app # unchanged\n",
+			wantContent: []string{"name: my-app # unchanged\n"},
+		},
+		{
+			name:    "deprecated and current field",
+			file:    "haloy.yaml",
+			content: "name: my-app\nserver: a.example.com\nmanager: b.example.com\n",
+			errMsg:  "both 'server' and the deprecated 'manager' are set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(configFile, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			files, err := MigrateConfig(configFile)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("MigrateConfig() error = %v, want it to contain %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MigrateConfig() unexpected error = %v", err)
+			}
+			if len(files) != 1 {
+				t.Fatalf("MigrateConfig() returned %d files, want 1", len(files))
+			}
+
+			for _, want := range tt.wantContent {
+				if !strings.Contains(string(files[0].Migrated), want) {
+					t.Errorf("migrated config:\n%s\nwant it to contain:\n%s", files[0].Migrated, want)
+				}
+			}
+			if len(files[0].Deprecations) != len(tt.deprecations) {
+				t.Fatalf("got %d deprecations, want %d: %v", len(files[0].Deprecations), len(tt.deprecations), files[0].Deprecations)
+			}
+			for i, want := range tt.deprecations {
+				if got := files[0].Deprecations[i].String(); !strings.Contains(got, want) {
+					t.Errorf("deprecation %d = %s, want it to contain %q", i, got, want)
+				}
+			}
+		})
+	}
+}
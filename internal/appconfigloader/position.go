@@ -0,0 +1,71 @@
+package appconfigloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// keyPosition finds the line and column of the field at path by looking for each key of
+// the path after the line of the previous one. It returns 0, 0 when the field isn't found.
+func keyPosition(content []byte, path []string, format string) (int, int) {
+	lines := strings.Split(string(content), "\n")
+	line, column := 0, 0
+	for _, key := range path {
+		pattern := keyPattern(key, format)
+		found := false
+		for i := line; i < len(lines); i++ {
+			if match := pattern.FindStringSubmatchIndex(lines[i]); match != nil {
+				line, column, found = i, match[2], true
+				break
+			}
+		}
+		if !found {
+			return 0, 0
+		}
+	}
+	return line + 1, column + 1
+}
+
+// keyPattern matches a key in the format, with the key itself as the first group.
+func keyPattern(key, format string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(key)
+	switch format {
+	case "json":
+		return regexp.MustCompile(`("` + quoted + `")\s*:`)
+	case "toml":
+		// Matches keys, dotted keys and table headers, e.g. [targets.production].
+		return regexp.MustCompile(`^\s*\[*\s*(?:[\w"-]+\.)*("?` + quoted + `"?)\s*(?:=|\]|\.)`)
+	default:
+		return regexp.MustCompile(`^\s*(?:-\s+)?(["']?` + quoted + `["']?)\s*:`)
+	}
+}
+
+// sourceLocation formats a position in a config file for messages, e.g. haloy.yaml:14:3.
+// The file is shown relative to the working directory when it's below it.
+func sourceLocation(file string, line, column int) string {
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+	}
+	switch {
+	case line == 0:
+		return file
+	case column == 0:
+		return fmt.Sprintf("%s:%d", file, line)
+	default:
+		return fmt.Sprintf("%s:%d:%d", file, line, column)
+	}
+}
+
+// locationPrefix returns the location followed by a colon, to prefix an error message,
+// or an empty string for an unknown location.
+func locationPrefix(location string) string {
+	if location == "" {
+		return ""
+	}
+	return location + ": "
+}
@@ -0,0 +1,103 @@
+package appconfigloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyPosition(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		content    string
+		path       []string
+		wantLine   int
+		wantColumn int
+	}{
+		{
+			name:       "yaml nested",
+			format:     "yaml",
+			content:    "name: app\nimage:\n  repository: app\n  tag: latest\n",
+			path:       []string{"image", "tag"},
+			wantLine:   4,
+			wantColumn: 3,
+		},
+		{
+			name:       "yaml skips values",
+			format:     "yaml",
+			content:    "name: server\nserver: haloy.example.com\n",
+			path:       []string{"server"},
+			wantLine:   2,
+			wantColumn: 1,
+		},
+		{
+			name:       "json",
+			format:     "json",
+			content:    "{\n  \"name\": \"app\",\n  \"targets\": {\n    \"production\": {\"replicas\": 2}\n  }\n}\n",
+			path:       []string{"targets", "production", "replicas"},
+			wantLine:   4,
+			wantColumn: 20,
+		},
+		{
+			name:       "toml table",
+			format:     "toml",
+			content:    "name = \"app\"\n\n[targets.production]\nreplicas = 2\n",
+			path:       []string{"targets", "production", "replicas"},
+			wantLine:   4,
+			wantColumn: 1,
+		},
+		{
+			name:    "missing",
+			format:  "yaml",
+			content: "name: app\n",
+			path:    []string{"server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, column := keyPosition([]byte(tt.content), tt.path, tt.format)
+			if line != tt.wantLine || column != tt.wantColumn {
+				t.Errorf("keyPosition() = %d:%d, want %d:%d", line, column, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
+
+func TestLoadRawAppConfig_UnknownFieldPositions(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	content := "name: my-app\nimage:\n  repository: ghcr.io/example/app\n  tagg: latest\nheath_check_path: /up\n"
+	if err := os.WriteFile(filepath.Join(dir, "haloy.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	_, _, err := LoadRawAppConfig(".")
+	if err == nil {
+		t.Fatal("LoadRawAppConfig() expected an error for unknown fields")
+	}
+	want := "haloy.yaml:4:3: unknown field 'image.tagg' (did you mean 'tag'?)\n" +
+		"haloy.yaml:5:1: unknown field 'heath_check_path' (did you mean 'health_check_path'?)"
+	if err.Error() != want {
+		t.Errorf("LoadRawAppConfig() error =\n%v\nwant\n%s", err, want)
+	}
+}
+
+func TestExtractTargets_ErrorLocation(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	content := "name: my-app\nserver: haloy.example.com\nimage:\n  repository: ghcr.io/example/app\ntargets:\n  production:\n    deployment_strategy: instant\n"
+	if err := os.WriteFile(filepath.Join(dir, "haloy.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	appConfig, _, err := LoadRawAppConfig(".")
+	if err != nil {
+		t.Fatalf("LoadRawAppConfig() unexpected error = %v", err)
+	}
+	_, err = ExtractTargets(appConfig)
+	if err == nil || !strings.HasPrefix(err.Error(), "haloy.yaml:6:3: validation failed for target 'production'") {
+		t.Errorf("ExtractTargets() error = %v, want it to start with the target location", err)
+	}
+}
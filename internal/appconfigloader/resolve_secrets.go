@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/ameistad/haloy/internal/config"
@@ -11,12 +12,24 @@ import (
 )
 
 func ResolveSecrets(ctx context.Context, appConfig config.AppConfig) (config.AppConfig, error) {
+	return ResolveSecretsExcept(ctx, appConfig, nil)
+}
+
+// ResolveSecretsExcept is ResolveSecrets for a server with imported secrets: the secret provider references in
+// imported are left unresolved and the server resolves them. Values the client uses itself are always resolved.
+func ResolveSecretsExcept(ctx context.Context, appConfig config.AppConfig, imported map[string]bool) (config.AppConfig, error) {
 	var resolvedConfig config.AppConfig
 	if err := copier.Copy(&resolvedConfig, &appConfig); err != nil {
 		return config.AppConfig{}, fmt.Errorf("failed to copy config for resolution: %w", err)
 	}
 
 	allSources := gatherValueSources(&resolvedConfig)
+	if len(imported) > 0 {
+		clientSources := clientValueSources(&resolvedConfig)
+		allSources = slices.DeleteFunc(allSources, func(vs *config.ValueSource) bool {
+			return vs.From != nil && imported[vs.From.Secret] && !clientSources[vs]
+		})
+	}
 	if len(allSources) == 0 {
 		return resolvedConfig, nil
 	}
@@ -46,10 +59,20 @@ func gatherValueSources(appConfig *config.AppConfig) []*config.ValueSource {
 		sources = append(sources, appConfig.APIToken)
 	}
 
+	if appConfig.DeployWebhook != nil {
+		sources = append(sources, &appConfig.DeployWebhook.Secret)
+	}
+
 	for i := range appConfig.Env {
 		sources = append(sources, &appConfig.Env[i].ValueSource)
 	}
 
+	for _, vs := range appConfig.EnvOverrides {
+		if vs != nil {
+			sources = append(sources, vs)
+		}
+	}
+
 	if appConfig.Image != nil {
 		sources = append(sources, gatherImageValueSources(appConfig.Image)...)
 	}
@@ -58,10 +81,69 @@ func gatherValueSources(appConfig *config.AppConfig) []*config.ValueSource {
 		sources = append(sources, gatherImageValueSources(image)...)
 	}
 
+	for i := range appConfig.Sidecars {
+		sources = append(sources, gatherSidecarValueSources(&appConfig.Sidecars[i])...)
+	}
+
+	for i := range appConfig.InitContainers {
+		sources = append(sources, gatherInitContainerValueSources(&appConfig.InitContainers[i])...)
+	}
+
 	for _, targetConfig := range appConfig.Targets {
 		sources = append(sources, gatherTargetValueSources(targetConfig)...)
 	}
 
+	// Targets that aren't selected are resolved when a selected target extends them.
+	gathered := make(map[*config.TargetConfig]bool)
+	for _, targetConfig := range appConfig.Targets {
+		gathered[targetConfig] = true
+	}
+	for name, targetConfig := range appConfig.Targets {
+		// Errors are reported when the targets are merged.
+		ancestors, _ := extendedTargets(*appConfig, *targetConfig, name)
+		for _, ancestor := range ancestors {
+			if !gathered[ancestor] {
+				gathered[ancestor] = true
+				sources = append(sources, gatherTargetValueSources(ancestor)...)
+			}
+		}
+	}
+
+	return sources
+}
+
+// clientValueSources returns the values the client uses itself: API tokens, and the registry credentials and
+// build arguments of images.
+func clientValueSources(appConfig *config.AppConfig) map[*config.ValueSource]bool {
+	sources := make(map[*config.ValueSource]bool)
+	addImage := func(image *config.Image) {
+		if image == nil {
+			return
+		}
+		for _, vs := range gatherImageValueSources(image) {
+			sources[vs] = true
+		}
+	}
+	addTarget := func(tc *config.TargetConfig) {
+		if tc.APIToken != nil {
+			sources[tc.APIToken] = true
+		}
+		addImage(tc.Image)
+		for i := range tc.Sidecars {
+			addImage(tc.Sidecars[i].Image)
+		}
+		for i := range tc.InitContainers {
+			addImage(tc.InitContainers[i].Image)
+		}
+	}
+
+	addTarget(&appConfig.TargetConfig)
+	for _, image := range appConfig.Images {
+		addImage(image)
+	}
+	for _, targetConfig := range appConfig.Targets {
+		addTarget(targetConfig)
+	}
 	return sources
 }
 
@@ -89,14 +171,60 @@ func gatherTargetValueSources(tc *config.TargetConfig) []*config.ValueSource {
 		sources = append(sources, tc.APIToken)
 	}
 
+	if tc.DeployWebhook != nil {
+		sources = append(sources, &tc.DeployWebhook.Secret)
+	}
+
 	for i := range tc.Env {
 		sources = append(sources, &tc.Env[i].ValueSource)
 	}
 
+	for _, vs := range tc.EnvOverrides {
+		if vs != nil {
+			sources = append(sources, vs)
+		}
+	}
+
 	if tc.Image != nil {
 		sources = append(sources, gatherImageValueSources(tc.Image)...)
 	}
 
+	for i := range tc.Sidecars {
+		sources = append(sources, gatherSidecarValueSources(&tc.Sidecars[i])...)
+	}
+
+	for i := range tc.InitContainers {
+		sources = append(sources, gatherInitContainerValueSources(&tc.InitContainers[i])...)
+	}
+
+	return sources
+}
+
+func gatherSidecarValueSources(sidecar *config.Sidecar) []*config.ValueSource {
+	var sources []*config.ValueSource
+
+	for i := range sidecar.Env {
+		sources = append(sources, &sidecar.Env[i].ValueSource)
+	}
+
+	if sidecar.Image != nil {
+		sources = append(sources, gatherImageValueSources(sidecar.Image)...)
+	}
+
+	return sources
+}
+
+func gatherInitContainerValueSources(initContainer *config.InitContainer) []*config.ValueSource {
+	var sources []*config.ValueSource
+
+	for i := range initContainer.Env {
+		sources = append(sources, &initContainer.Env[i].ValueSource)
+	}
+
+	if initContainer.Image != nil {
+		sources = append(sources, gatherImageValueSources(initContainer.Image)...)
+	}
+
 	return sources
 }
 
@@ -0,0 +1,34 @@
+// Package certstore persists the certificates issued by haloyd. HAProxy loads the certificates from the files in
+// the certificate directory, so every store keeps those files up to date.
+package certstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned by CertStore.Get for certificates that aren't stored.
+var ErrNotFound = errors.New("certificate not found")
+
+// CertStore stores certificates by file name, e.g. "example.com.pem" for the combined key and certificate chain
+// of example.com. Implementations are safe for concurrent use, and a Put is either stored completely or not at all.
+type CertStore interface {
+	// Get returns the data of a certificate, or ErrNotFound.
+	Get(name string) ([]byte, error)
+	// Put stores a certificate, replacing the certificate with the same name.
+	Put(name string, data []byte) error
+	// List returns the names of all certificates, sorted.
+	List() ([]string, error)
+	// Delete removes a certificate. Deleting a certificate that isn't stored is not an error.
+	Delete(name string) error
+}
+
+// validateName rejects names that aren't a plain file name. Names starting with a dot are reserved for
+// temporary files, which HAProxy skips when it loads the certificate directory.
+func validateName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid certificate name '%s'", name)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package certstore
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// DBStore stores certificates in the haloyd database, which is the source of truth, and mirrors them to the
+// certificate directory for HAProxy.
+type DBStore struct {
+	db    *storage.DB
+	files *FileStore
+	mutex sync.Mutex
+}
+
+// NewDBStore returns a store backed by db that mirrors the certificates to dir. Certificates that are only in dir,
+// e.g. after switching from the file store, are imported, and the files are brought in line with the database.
+func NewDBStore(db *storage.DB, dir string) (*DBStore, error) {
+	files, err := NewFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &DBStore{db: db, files: files}
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *DBStore) Get(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	data, err := s.db.GetCertificate(name)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *DBStore) Put(name string, data []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.db.SaveCertificate(name, data); err != nil {
+		return fmt.Errorf("failed to save certificate '%s': %w", name, err)
+	}
+	return s.files.Put(name, data)
+}
+
+func (s *DBStore) List() ([]string, error) {
+	return s.db.GetCertificateNames()
+}
+
+func (s *DBStore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.db.DeleteCertificate(name); err != nil {
+		return fmt.Errorf("failed to delete certificate '%s': %w", name, err)
+	}
+	return s.files.Delete(name)
+}
+
+// Sync imports the certificate files that aren't in the database and rewrites the files that differ from it.
+func (s *DBStore) Sync() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fileNames, err := s.files.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range fileNames {
+		stored, err := s.db.GetCertificate(name)
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			continue
+		}
+		data, err := s.files.Get(name)
+		if err != nil {
+			return err
+		}
+		if err := s.db.SaveCertificate(name, data); err != nil {
+			return fmt.Errorf("failed to import certificate '%s': %w", name, err)
+		}
+	}
+
+	names, err := s.db.GetCertificateNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := s.db.GetCertificate(name)
+		if err != nil {
+			return err
+		}
+		current, err := s.files.Get(name)
+		if err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := s.files.Put(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package certstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+// FileStore stores certificates as files in a directory.
+type FileStore struct {
+	dir   string
+	mutex sync.RWMutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Get(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read certificate '%s': %w", name, err)
+	}
+	return data, nil
+}
+
+// Put writes the certificate to a temporary file, syncs it to disk and renames it into place, so HAProxy
+// and a crash never see a partly written certificate.
+func (s *FileStore) Put(name string, data []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, "."+name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary certificate file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if err := tmp.Chmod(constants.ModeFileSecret); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set certificate file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write certificate '%s': %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync certificate '%s': %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write certificate '%s': %w", name, err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to replace certificate '%s': %w", name, err)
+	}
+	return s.syncDir()
+}
+
+func (s *FileStore) List() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		// The directory also holds the ACME accounts and leftover temporary files.
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *FileStore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove certificate '%s': %w", name, err)
+	}
+	return s.syncDir()
+}
+
+// syncDir persists renames and removals in the directory.
+func (s *FileStore) syncDir() error {
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to open certificate directory: %w", err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync certificate directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// CORSAllowAllOrigins in api.cors_origins allows requests from every origin.
+const CORSAllowAllOrigins = "*"
+
+// validateAccess validates the CORS origins and trusted proxies of the API.
+func (a APIConfig) validateAccess() error {
+	for _, origin := range a.CORSOrigins {
+		if origin == CORSAllowAllOrigins {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+			return fmt.Errorf("invalid api.cors_origins '%s', must be '*' or an origin like 'https://ui.example.com'", origin)
+		}
+	}
+	for _, proxy := range a.TrustedProxies {
+		if _, err := parseTrustedProxy(proxy); err != nil {
+			return fmt.Errorf("invalid api.trusted_proxies '%s', must be an IP address or a CIDR range", proxy)
+		}
+	}
+	return nil
+}
+
+// AllowsOrigin reports whether browsers on origin may call the API.
+func (a APIConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range a.CORSOrigins {
+		if allowed == CORSAllowAllOrigins || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedProxyPrefixes returns the trusted proxies as prefixes, a single address is a prefix of its full length.
+// Call Validate first, invalid entries are skipped.
+func (a APIConfig) TrustedProxyPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, proxy := range a.TrustedProxies {
+		if prefix, err := parseTrustedProxy(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func parseTrustedProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	DefaultOIDCGroupsClaim = "groups"
+
+	// OIDCScopeAdmin grants the access of the API token.
+	OIDCScopeAdmin = "admin"
+	// OIDCScopeApprove grants the access of the approve token.
+	OIDCScopeApprove = "approve"
+	// OIDCScopeApps grants the access of an app token for the apps of the group.
+	OIDCScopeApps = "apps"
+)
+
+// APIOIDC lets users sign in to the dashboard and the CLI with an OpenID Connect provider, e.g. GitHub through
+// Dex, Google or Authentik. haloyd accepts the ID tokens of the issuer as bearer tokens and grants the scopes
+// mapped to the groups of the user. The API token and app tokens keep working, e.g. for CI.
+type APIOIDC struct {
+	// Issuer is the URL of the provider, its discovery document is read from
+	// <issuer>/.well-known/openid-configuration.
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty" toml:"issuer,omitempty"`
+	// ClientID is the client registered for haloyd, ID tokens must be issued to it.
+	ClientID string `json:"clientId,omitempty" yaml:"client_id,omitempty" toml:"client_id,omitempty"`
+	// GroupsClaim is the claim of the ID token that lists the groups of the user. Defaults to "groups".
+	GroupsClaim string `json:"groupsClaim,omitempty" yaml:"groups_claim,omitempty" toml:"groups_claim,omitempty"`
+	// Scopes are requested at sign-in besides "openid profile email", e.g. "groups" for Dex.
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty" toml:"scopes,omitempty"`
+	// Groups map the groups of users to scopes. Users without a mapped group can't use the API.
+	Groups []OIDCGroupScope `json:"groups,omitempty" yaml:"groups,omitempty" toml:"groups,omitempty"`
+}
+
+// OIDCGroupScope grants the members of a group a scope.
+type OIDCGroupScope struct {
+	Group string `json:"group" yaml:"group" toml:"group"`
+	// Scope is "admin", "approve" or "apps".
+	Scope string `json:"scope" yaml:"scope" toml:"scope"`
+	// Apps are the app names the group can manage with the "apps" scope, with * and ? wildcards.
+	Apps []string `json:"apps,omitempty" yaml:"apps,omitempty" toml:"apps,omitempty"`
+}
+
+// OIDCGrant is the access the groups of a user grant.
+type OIDCGrant struct {
+	Admin   bool
+	Approve bool
+	Apps    []string
+}
+
+// Empty reports whether the grant gives no access at all.
+func (g OIDCGrant) Empty() bool {
+	return !g.Admin && !g.Approve && len(g.Apps) == 0
+}
+
+// Enabled reports whether OIDC sign-in is configured.
+func (o APIOIDC) Enabled() bool {
+	return o.Issuer != ""
+}
+
+func (o APIOIDC) Validate() error {
+	if !o.Enabled() {
+		if o.ClientID != "" || len(o.Groups) > 0 {
+			return fmt.Errorf("api.oidc: issuer is required")
+		}
+		return nil
+	}
+
+	u, err := url.Parse(o.Issuer)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("api.oidc: invalid issuer '%s', must be an https URL", o.Issuer)
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("api.oidc: client_id is required")
+	}
+	if len(o.Groups) == 0 {
+		return fmt.Errorf("api.oidc: groups must map at least one group to a scope")
+	}
+	for _, g := range o.Groups {
+		if strings.TrimSpace(g.Group) == "" {
+			return fmt.Errorf("api.oidc: groups must have a group name")
+		}
+		switch g.Scope {
+		case OIDCScopeAdmin, OIDCScopeApprove:
+			if len(g.Apps) > 0 {
+				return fmt.Errorf("api.oidc: apps of group '%s' are only used with the 'apps' scope", g.Group)
+			}
+		case OIDCScopeApps:
+			if len(g.Apps) == 0 {
+				return fmt.Errorf("api.oidc: group '%s' must list the apps of its 'apps' scope", g.Group)
+			}
+			for _, pattern := range g.Apps {
+				if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+					return fmt.Errorf("api.oidc: invalid app pattern '%s' of group '%s'", pattern, g.Group)
+				}
+			}
+		default:
+			return fmt.Errorf("api.oidc: invalid scope '%s' of group '%s', must be 'admin', 'approve' or 'apps'", g.Scope, g.Group)
+		}
+	}
+	return nil
+}
+
+// GroupsClaimName returns the claim that lists the groups of the user.
+func (o APIOIDC) GroupsClaimName() string {
+	if o.GroupsClaim == "" {
+		return DefaultOIDCGroupsClaim
+	}
+	return o.GroupsClaim
+}
+
+// Grant returns the access of a user in groups.
+func (o APIOIDC) Grant(groups []string) OIDCGrant {
+	var grant OIDCGrant
+	for _, g := range o.Groups {
+		if !slices.Contains(groups, g.Group) {
+			continue
+		}
+		switch g.Scope {
+		case OIDCScopeAdmin:
+			grant.Admin = true
+		case OIDCScopeApprove:
+			grant.Approve = true
+		case OIDCScopeApps:
+			grant.Apps = append(grant.Apps, g.Apps...)
+		}
+	}
+	return grant
+}
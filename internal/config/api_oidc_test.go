@@ -0,0 +1,130 @@
+package config
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestAPIOIDC_Validate(t *testing.T) {
+	adminGroup := []OIDCGroupScope{{Group: "ops", Scope: OIDCScopeAdmin}}
+	tests := []struct {
+		name        string
+		oidc        APIOIDC
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name: "disabled",
+			oidc: APIOIDC{},
+		},
+		{
+			name: "all scopes",
+			oidc: APIOIDC{
+				Issuer:   "https://auth.example.com",
+				ClientID: "haloy",
+				Groups: []OIDCGroupScope{
+					{Group: "ops", Scope: OIDCScopeAdmin},
+					{Group: "leads", Scope: OIDCScopeApprove},
+					{Group: "shop-devs", Scope: OIDCScopeApps, Apps: []string{"shop-*"}},
+				},
+			},
+		},
+		{
+			name:        "client id without issuer",
+			oidc:        APIOIDC{ClientID: "haloy"},
+			expectError: true,
+			errMsg:      "issuer is required",
+		},
+		{
+			name:        "http issuer",
+			oidc:        APIOIDC{Issuer: "http://auth.example.com", ClientID: "haloy", Groups: adminGroup},
+			expectError: true,
+			errMsg:      "must be an https URL",
+		},
+		{
+			name:        "missing client id",
+			oidc:        APIOIDC{Issuer: "https://auth.example.com", Groups: adminGroup},
+			expectError: true,
+			errMsg:      "client_id is required",
+		},
+		{
+			name:        "missing groups",
+			oidc:        APIOIDC{Issuer: "https://auth.example.com", ClientID: "haloy"},
+			expectError: true,
+			errMsg:      "at least one group",
+		},
+		{
+			name: "invalid scope",
+			oidc: APIOIDC{Issuer: "https://auth.example.com", ClientID: "haloy",
+				Groups: []OIDCGroupScope{{Group: "ops", Scope: "root"}}},
+			expectError: true,
+			errMsg:      "invalid scope 'root'",
+		},
+		{
+			name: "apps scope without apps",
+			oidc: APIOIDC{Issuer: "https://auth.example.com", ClientID: "haloy",
+				Groups: []OIDCGroupScope{{Group: "devs", Scope: OIDCScopeApps}}},
+			expectError: true,
+			errMsg:      "must list the apps",
+		},
+		{
+			name: "apps with admin scope",
+			oidc: APIOIDC{Issuer: "https://auth.example.com", ClientID: "haloy",
+				Groups: []OIDCGroupScope{{Group: "ops", Scope: OIDCScopeAdmin, Apps: []string{"shop"}}}},
+			expectError: true,
+			errMsg:      "only used with the 'apps' scope",
+		},
+		{
+			name: "invalid app pattern",
+			oidc: APIOIDC{Issuer: "https://auth.example.com", ClientID: "haloy",
+				Groups: []OIDCGroupScope{{Group: "devs", Scope: OIDCScopeApps, Apps: []string{"shop-["}}}},
+			expectError: true,
+			errMsg:      "invalid app pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.oidc.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIOIDC_Grant(t *testing.T) {
+	oidc := APIOIDC{
+		Groups: []OIDCGroupScope{
+			{Group: "ops", Scope: OIDCScopeAdmin},
+			{Group: "leads", Scope: OIDCScopeApprove},
+			{Group: "shop-devs", Scope: OIDCScopeApps, Apps: []string{"shop-*"}},
+			{Group: "blog-devs", Scope: OIDCScopeApps, Apps: []string{"blog"}},
+		},
+	}
+
+	if grant := oidc.Grant([]string{"marketing"}); !grant.Empty() {
+		t.Errorf("Grant() of unmapped group = %+v, expected empty", grant)
+	}
+	if grant := oidc.Grant([]string{"ops"}); !grant.Admin || grant.Approve || len(grant.Apps) > 0 {
+		t.Errorf("Grant() of ops = %+v, expected admin only", grant)
+	}
+	grant := oidc.Grant([]string{"leads", "shop-devs", "blog-devs"})
+	if grant.Admin || !grant.Approve || !slices.Equal(grant.Apps, []string{"shop-*", "blog"}) {
+		t.Errorf("Grant() of leads and devs = %+v, expected approve and apps shop-*, blog", grant)
+	}
+
+	if got := oidc.GroupsClaimName(); got != DefaultOIDCGroupsClaim {
+		t.Errorf("GroupsClaimName() = %q, expected %q", got, DefaultOIDCGroupsClaim)
+	}
+}
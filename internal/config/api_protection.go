@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+const DefaultProtectionExpiry = time.Hour
+
+// APIProtection holds destructive operations on protected apps until a second token confirms them with
+// 'haloy confirm', so a single leaked or mistyped token can't take an app down. Protected operations are
+// rollbacks and removing the containers with 'haloy stop --remove-containers'.
+type APIProtection struct {
+	// Apps are the protected app names, with * and ? wildcards, e.g. "shop-*".
+	Apps []string `json:"apps,omitempty" yaml:"apps,omitempty" toml:"apps,omitempty"`
+	// Expiry is how long an operation waits for its confirmation, e.g. "30m". Defaults to 1h.
+	Expiry string `json:"expiry,omitempty" yaml:"expiry,omitempty" toml:"expiry,omitempty"`
+}
+
+func (p APIProtection) Validate() error {
+	for _, pattern := range p.Apps {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("api.protection: invalid app pattern '%s'", pattern)
+		}
+	}
+	if p.Expiry != "" {
+		expiry, err := time.ParseDuration(p.Expiry)
+		if err != nil || expiry <= 0 {
+			return fmt.Errorf("api.protection: invalid expiry '%s', must be a positive duration like '1h'", p.Expiry)
+		}
+	}
+	return nil
+}
+
+// Protects reports whether destructive operations on the app need a confirmation.
+func (p APIProtection) Protects(appName string) bool {
+	for _, pattern := range p.Apps {
+		if matched, _ := path.Match(pattern, appName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpiryDuration returns how long an operation waits for its confirmation. Call Validate first.
+func (p APIProtection) ExpiryDuration() time.Duration {
+	expiry, err := time.ParseDuration(p.Expiry)
+	if err != nil || expiry <= 0 {
+		return DefaultProtectionExpiry
+	}
+	return expiry
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestAPIProtection_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		protection  APIProtection
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:       "disabled",
+			protection: APIProtection{},
+		},
+		{
+			name:       "apps and expiry",
+			protection: APIProtection{Apps: []string{"shop", "billing-*"}, Expiry: "30m"},
+		},
+		{
+			name:        "invalid pattern",
+			protection:  APIProtection{Apps: []string{"shop-["}},
+			expectError: true,
+			errMsg:      "invalid app pattern",
+		},
+		{
+			name:        "empty pattern",
+			protection:  APIProtection{Apps: []string{" "}},
+			expectError: true,
+			errMsg:      "invalid app pattern",
+		},
+		{
+			name:        "invalid expiry",
+			protection:  APIProtection{Apps: []string{"shop"}, Expiry: "-1h"},
+			expectError: true,
+			errMsg:      "invalid expiry",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.protection.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIProtection_Protects(t *testing.T) {
+	protection := APIProtection{Apps: []string{"shop", "billing-*"}}
+	tests := map[string]bool{
+		"shop":        true,
+		"billing-api": true,
+		"shop-web":    false,
+		"blog":        false,
+	}
+	for appName, expected := range tests {
+		if got := protection.Protects(appName); got != expected {
+			t.Errorf("Protects(%q) = %v, expected %v", appName, got, expected)
+		}
+	}
+
+	if got := (APIProtection{}).ExpiryDuration(); got != DefaultProtectionExpiry {
+		t.Errorf("ExpiryDuration() = %v, expected %v", got, DefaultProtectionExpiry)
+	}
+	if got := (APIProtection{Expiry: "30m"}).ExpiryDuration(); got != 30*time.Minute {
+		t.Errorf("ExpiryDuration() = %v, expected %v", got, 30*time.Minute)
+	}
+}
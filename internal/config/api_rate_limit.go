@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultAPIRequestsPerMinute = 600
+	DefaultAPIAuthFailures      = 10
+	DefaultAPILockout           = 15 * time.Minute
+)
+
+// APIRateLimit limits the requests to the API per client IP and per token, and locks out client IPs after
+// repeated authentication failures, e.g. while a token is brute-forced.
+type APIRateLimit struct {
+	// RequestsPerMinute is the number of requests allowed per client IP, and per token, in a minute. Defaults to 600.
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty" yaml:"requests_per_minute,omitempty" toml:"requests_per_minute,omitempty"`
+	// AuthFailures is the number of failed authentications within Lockout after which a client IP is locked out.
+	// Defaults to 10.
+	AuthFailures int `json:"authFailures,omitempty" yaml:"auth_failures,omitempty" toml:"auth_failures,omitempty"`
+	// Lockout is how long a client IP is locked out, e.g. "1h". Defaults to 15m.
+	Lockout string `json:"lockout,omitempty" yaml:"lockout,omitempty" toml:"lockout,omitempty"`
+}
+
+func (r APIRateLimit) Validate() error {
+	if r.RequestsPerMinute < 0 {
+		return fmt.Errorf("api.rate_limit: requests_per_minute must be positive, got %d", r.RequestsPerMinute)
+	}
+	if r.AuthFailures < 0 {
+		return fmt.Errorf("api.rate_limit: auth_failures must be positive, got %d", r.AuthFailures)
+	}
+	if r.Lockout != "" {
+		lockout, err := time.ParseDuration(r.Lockout)
+		if err != nil || lockout <= 0 {
+			return fmt.Errorf("api.rate_limit: invalid lockout '%s', must be a positive duration like '15m'", r.Lockout)
+		}
+	}
+	return nil
+}
+
+// RequestLimit returns the number of requests allowed per client IP and per token in a minute.
+func (r APIRateLimit) RequestLimit() int {
+	if r.RequestsPerMinute == 0 {
+		return DefaultAPIRequestsPerMinute
+	}
+	return r.RequestsPerMinute
+}
+
+// FailureThreshold returns the number of failed authentications after which a client IP is locked out.
+func (r APIRateLimit) FailureThreshold() int {
+	if r.AuthFailures == 0 {
+		return DefaultAPIAuthFailures
+	}
+	return r.AuthFailures
+}
+
+// LockoutDuration returns how long a client IP is locked out. Call Validate first.
+func (r APIRateLimit) LockoutDuration() time.Duration {
+	lockout, err := time.ParseDuration(r.Lockout)
+	if err != nil || lockout <= 0 {
+		return DefaultAPILockout
+	}
+	return lockout
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestAPIRateLimit_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		rateLimit   APIRateLimit
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:      "defaults",
+			rateLimit: APIRateLimit{},
+		},
+		{
+			name:      "custom limits",
+			rateLimit: APIRateLimit{RequestsPerMinute: 120, AuthFailures: 5, Lockout: "1h"},
+		},
+		{
+			name:        "negative requests per minute",
+			rateLimit:   APIRateLimit{RequestsPerMinute: -1},
+			expectError: true,
+			errMsg:      "requests_per_minute must be positive",
+		},
+		{
+			name:        "negative auth failures",
+			rateLimit:   APIRateLimit{AuthFailures: -1},
+			expectError: true,
+			errMsg:      "auth_failures must be positive",
+		},
+		{
+			name:        "invalid lockout",
+			rateLimit:   APIRateLimit{Lockout: "15"},
+			expectError: true,
+			errMsg:      "invalid lockout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rateLimit.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIRateLimit_Defaults(t *testing.T) {
+	rateLimit := APIRateLimit{}
+	if got := rateLimit.RequestLimit(); got != DefaultAPIRequestsPerMinute {
+		t.Errorf("RequestLimit() = %d, want %d", got, DefaultAPIRequestsPerMinute)
+	}
+	if got := rateLimit.FailureThreshold(); got != DefaultAPIAuthFailures {
+		t.Errorf("FailureThreshold() = %d, want %d", got, DefaultAPIAuthFailures)
+	}
+	if got := rateLimit.LockoutDuration(); got != DefaultAPILockout {
+		t.Errorf("LockoutDuration() = %v, want %v", got, DefaultAPILockout)
+	}
+
+	rateLimit = APIRateLimit{RequestsPerMinute: 60, AuthFailures: 3, Lockout: "1h"}
+	if got := rateLimit.RequestLimit(); got != 60 {
+		t.Errorf("RequestLimit() = %d, want 60", got)
+	}
+	if got := rateLimit.FailureThreshold(); got != 3 {
+		t.Errorf("FailureThreshold() = %d, want 3", got)
+	}
+	if got := rateLimit.LockoutDuration(); got != time.Hour {
+		t.Errorf("LockoutDuration() = %v, want %v", got, time.Hour)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/go-viper/mapstructure/v2"
@@ -21,6 +22,12 @@ type AppConfig struct {
 	// Non config fields. Not read from the config file and populated on load.
 	TargetName string `json:"-" yaml:"-" toml:"-"`
 	Format     string `json:"-" yaml:"-" toml:"-"`
+	// Source is the config file and TargetLocations the file, line and column of each target,
+	// used to point errors at the config.
+	Source          string            `json:"-" yaml:"-" toml:"-"`
+	TargetLocations map[string]string `json:"-" yaml:"-" toml:"-"`
+	// DefinedTargets holds all targets of the config when Targets is limited to the selected ones.
+	DefinedTargets map[string]*TargetConfig `json:"-" yaml:"-" toml:"-"`
 }
 
 type TargetConfig struct {
@@ -28,6 +35,8 @@ type TargetConfig struct {
 	// In a multi-target file, if this is omitted, the map key from 'targets' is used.
 	// In a single-deployment file, this is required at the top level.
 	Name string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	// Extends names another target whose settings this target inherits before the top level ones.
+	Extends string `json:"extends,omitempty" yaml:"extends,omitempty" toml:"extends,omitempty"`
 
 	// Image can be defined inline OR reference a named image (ImageKey) from the Images map
 	Image              *Image             `json:"image,omitempty" yaml:"image,omitempty" toml:"image,omitempty"`
@@ -35,21 +44,63 @@ type TargetConfig struct {
 	Server             string             `json:"server,omitempty" yaml:"server,omitempty" toml:"server,omitempty"`
 	APIToken           *ValueSource       `json:"apiToken,omitempty" yaml:"api_token,omitempty" toml:"api_token,omitempty"`
 	DeploymentStrategy DeploymentStrategy `json:"deploymentStrategy,omitempty" yaml:"deployment_strategy,omitempty" toml:"deployment_strategy,omitempty"`
-	Domains            []Domain           `json:"domains,omitempty" yaml:"domains,omitempty" toml:"domains,omitempty"`
-	ACMEEmail          string             `json:"acmeEmail,omitempty" yaml:"acme_email,omitempty" toml:"acme_email,omitempty"`
-	Env                []EnvVar           `json:"env,omitempty" yaml:"env,omitempty" toml:"env,omitempty"`
-	HealthCheckPath    string             `json:"healthCheckPath,omitempty" yaml:"health_check_path,omitempty" toml:"health_check_path,omitempty"`
-	Port               Port               `json:"port,omitempty" yaml:"port,omitempty" toml:"port,omitempty"`
-	Replicas           *int               `json:"replicas,omitempty" yaml:"replicas,omitempty" toml:"replicas,omitempty"`
-	Volumes            []string           `json:"volumes,omitempty" yaml:"volumes,omitempty" toml:"volumes,omitempty"`
-	Network            string             `json:"network,omitempty" yaml:"network,omitempty" toml:"network,omitempty"`
-	PreDeploy          []string           `json:"preDeploy,omitempty" yaml:"pre_deploy,omitempty" toml:"pre_deploy,omitempty"`
-	PostDeploy         []string           `json:"postDeploy,omitempty" yaml:"post_deploy,omitempty" toml:"post_deploy,omitempty"`
+	// RequireApproval holds deployments on the server until they're approved with 'haloy approve'.
+	RequireApproval bool `json:"requireApproval,omitempty" yaml:"require_approval,omitempty" toml:"require_approval,omitempty"`
+	// Exposure is "public" (default) or "internal". Internal apps are only reachable on the haloy network.
+	Exposure  Exposure `json:"exposure,omitempty" yaml:"exposure,omitempty" toml:"exposure,omitempty"`
+	Domains   []Domain `json:"domains,omitempty" yaml:"domains,omitempty" toml:"domains,omitempty"`
+	ACMEEmail string   `json:"acmeEmail,omitempty" yaml:"acme_email,omitempty" toml:"acme_email,omitempty"`
+	// ACMEStaging requests the certificates of the domains from the Let's Encrypt staging CA.
+	ACMEStaging bool     `json:"acmeStaging,omitempty" yaml:"acme_staging,omitempty" toml:"acme_staging,omitempty"`
+	Env         []EnvVar `json:"env,omitempty" yaml:"env,omitempty" toml:"env,omitempty"`
+	// EnvFile lists dotenv files, relative to the config file, that are loaded into Env on the client.
+	EnvFile []string `json:"envFile,omitempty" yaml:"env_file,omitempty" toml:"env_file,omitempty"`
+	// EnvSchema declares the environment variables the app needs, checked before it's deployed.
+	EnvSchema []EnvSchemaVar `json:"envSchema,omitempty" yaml:"env_schema,omitempty" toml:"env_schema,omitempty"`
+	// EnvOverrides replaces or adds individual variables on top of the inherited env list.
+	EnvOverrides    map[string]*ValueSource `json:"envOverrides,omitempty" yaml:"env_overrides,omitempty" toml:"env_overrides,omitempty"`
+	HealthCheckPath string                  `json:"healthCheckPath,omitempty" yaml:"health_check_path,omitempty" toml:"health_check_path,omitempty"`
+	HealthCheck     *HealthCheck            `json:"healthCheck,omitempty" yaml:"health_check,omitempty" toml:"health_check,omitempty"`
+	Warmup          *Warmup                 `json:"warmup,omitempty" yaml:"warmup,omitempty" toml:"warmup,omitempty"`
+	Connections     *Connections            `json:"connections,omitempty" yaml:"connections,omitempty" toml:"connections,omitempty"`
+	ShadowTo        *ShadowTo               `json:"shadowTo,omitempty" yaml:"shadow_to,omitempty" toml:"shadow_to,omitempty"`
+	DeployWebhook   *DeployWebhook          `json:"deployWebhook,omitempty" yaml:"deploy_webhook,omitempty" toml:"deploy_webhook,omitempty"`
+	ImageWatch      *ImageWatch             `json:"imageWatch,omitempty" yaml:"image_watch,omitempty" toml:"image_watch,omitempty"`
+	Sidecars        []Sidecar               `json:"sidecars,omitempty" yaml:"sidecars,omitempty" toml:"sidecars,omitempty"`
+	InitContainers  []InitContainer         `json:"initContainers,omitempty" yaml:"init_containers,omitempty" toml:"init_containers,omitempty"`
+	Logging         *Logging                `json:"logging,omitempty" yaml:"logging,omitempty" toml:"logging,omitempty"`
+	// Labels are added to the app containers. Labels in the dev.haloy namespace are reserved.
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" toml:"labels,omitempty"`
+	Port     Port              `json:"port,omitempty" yaml:"port,omitempty" toml:"port,omitempty"`
+	Replicas *int              `json:"replicas,omitempty" yaml:"replicas,omitempty" toml:"replicas,omitempty"`
+	// Autoscale lets haloyd scale the replicas between bounds, Replicas is then the number a deployment starts with.
+	Autoscale *Autoscale `json:"autoscale,omitempty" yaml:"autoscale,omitempty" toml:"autoscale,omitempty"`
+	Volumes   []string   `json:"volumes,omitempty" yaml:"volumes,omitempty" toml:"volumes,omitempty"`
+	Network   string     `json:"network,omitempty" yaml:"network,omitempty" toml:"network,omitempty"`
+	// Networks are additional user-defined networks the container is attached to alongside the haloy network.
+	Networks []string `json:"networks,omitempty" yaml:"networks,omitempty" toml:"networks,omitempty"`
+	// DNS, DNSSearch and ExtraHosts are passed to Docker for the app, sidecar and init containers,
+	// e.g. to resolve names on a private network without a custom image.
+	DNS        []string `json:"dns,omitempty" yaml:"dns,omitempty" toml:"dns,omitempty"`
+	DNSSearch  []string `json:"dnsSearch,omitempty" yaml:"dns_search,omitempty" toml:"dns_search,omitempty"`
+	ExtraHosts []string `json:"extraHosts,omitempty" yaml:"extra_hosts,omitempty" toml:"extra_hosts,omitempty"`
+	// Frontend serves the domains on an additional proxy frontend defined in the haloyd config
+	// instead of the public HTTP and HTTPS ports.
+	Frontend string `json:"frontend,omitempty" yaml:"frontend,omitempty" toml:"frontend,omitempty"`
+	// ExternalLBTarget is the Cloudflare pool ID or AWS target group ARN the server is registered with
+	// when the app is deployed, see external_lb in the haloyd config.
+	ExternalLBTarget string   `json:"externalLBTarget,omitempty" yaml:"external_lb_target,omitempty" toml:"external_lb_target,omitempty"`
+	PreDeploy        []string `json:"preDeploy,omitempty" yaml:"pre_deploy,omitempty" toml:"pre_deploy,omitempty"`
+	PostDeploy       []string `json:"postDeploy,omitempty" yaml:"post_deploy,omitempty" toml:"post_deploy,omitempty"`
 
 	// TODO: Is this needed in the AppConfig, we added it to TargetConfig?
 	// Non config fields. Not read from the config file and populated on load.
-	TargetName string `json:"-" yaml:"-" toml:"-"`
-	Format     string `json:"-" yaml:"-" toml:"-"`
+	// TargetName is sent to haloyd so it can be exposed to the app containers.
+	TargetName string `json:"targetName,omitempty" yaml:"-" toml:"-"`
+	// Annotations describe the deployment, e.g. the git commit it was made from. They're set by the CLI
+	// at deploy time and stored in the deployment history.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"-" toml:"-"`
+	Format      string            `json:"-" yaml:"-" toml:"-"`
 }
 
 type DeploymentStrategy string
@@ -59,9 +110,44 @@ const (
 	DeploymentStrategyReplace DeploymentStrategy = "replace" // Stop old, start new
 )
 
+type Exposure string
+
+const (
+	ExposurePublic   Exposure = "public"   // Default: routed by HAProxy on the domains of the app
+	ExposureInternal Exposure = "internal" // No routing or certificates, only reachable on the haloy network
+)
+
+const (
+	DomainTLSEnabled  = "enabled"  // Default: certificates are issued and HTTP is redirected to HTTPS
+	DomainTLSDisabled = "disabled" // Served over plain HTTP only, without a certificate or redirect
+)
+
+// Certificate key types. Certificates use KeyTypeRSA2048 unless the domain or the haloyd config sets another.
+const (
+	KeyTypeEC256   = "ec256"
+	KeyTypeEC384   = "ec384"
+	KeyTypeRSA2048 = "rsa2048"
+	KeyTypeRSA4096 = "rsa4096"
+
+	DefaultKeyType = KeyTypeRSA2048
+)
+
+// ValidateKeyType returns an error when keyType isn't empty or one of the supported key types.
+func ValidateKeyType(keyType string) error {
+	switch keyType {
+	case "", KeyTypeEC256, KeyTypeEC384, KeyTypeRSA2048, KeyTypeRSA4096:
+		return nil
+	default:
+		return fmt.Errorf("invalid key type '%s', must be one of %s, %s, %s or %s", keyType, KeyTypeEC256, KeyTypeEC384, KeyTypeRSA2048, KeyTypeRSA4096)
+	}
+}
+
 type Domain struct {
 	Canonical string   `yaml:"domain" json:"domain" toml:"domain"`
 	Aliases   []string `yaml:"aliases,omitempty" json:"aliases,omitempty" toml:"aliases,omitempty"`
+	TLS       string   `yaml:"tls,omitempty" json:"tls,omitempty" toml:"tls,omitempty"`
+	// KeyType overrides certificates.key_type of the haloyd config for the certificate of this domain.
+	KeyType string `yaml:"key_type,omitempty" json:"keyType,omitempty" toml:"key_type,omitempty"`
 }
 
 func (d *Domain) Validate() error {
@@ -69,6 +155,15 @@ func (d *Domain) Validate() error {
 		return err
 	}
 
+	switch d.TLS {
+	case "", DomainTLSEnabled, DomainTLSDisabled:
+	default:
+		return fmt.Errorf("domain '%s': tls must be '%s' or '%s', got '%s'", d.Canonical, DomainTLSEnabled, DomainTLSDisabled, d.TLS)
+	}
+	if err := ValidateKeyType(d.KeyType); err != nil {
+		return fmt.Errorf("domain '%s': %w", d.Canonical, err)
+	}
+
 	for _, alias := range d.Aliases {
 		if err := helpers.IsValidDomain(alias); err != nil {
 			return fmt.Errorf("alias '%s': %w", alias, err)
@@ -77,9 +172,16 @@ func (d *Domain) Validate() error {
 	return nil
 }
 
+// TLSDisabled reports whether the domain is served over plain HTTP only.
+func (d Domain) TLSDisabled() bool {
+	return d.TLS == DomainTLSDisabled
+}
+
 type EnvVar struct {
 	Name        string `json:"name" yaml:"name" toml:"name"`
 	ValueSource `mapstructure:",squash" json:",inline" yaml:",inline" toml:",inline"`
+	// Targets limits the variable to the listed targets. Empty means all targets.
+	Targets []string `json:"targets,omitempty" yaml:"targets,omitempty" toml:"targets,omitempty"`
 }
 
 func (ev *EnvVar) Validate(format string) error {
@@ -92,6 +194,12 @@ func (ev *EnvVar) Validate(format string) error {
 		return fmt.Errorf("environment variable '%s': %w", ev.Name, err)
 	}
 
+	for _, target := range ev.Targets {
+		if strings.TrimSpace(target) == "" {
+			return fmt.Errorf("environment variable '%s': %s cannot contain empty target names", ev.Name, GetFieldNameForFormat(EnvVar{}, "Targets", format))
+		}
+	}
+
 	return nil
 }
 
@@ -219,6 +219,159 @@ func TestTargetConfig_Validate_Comprehensive(t *testing.T) {
 			expectError: true,
 			errMsg:      "must start with a slash",
 		},
+		{
+			name: "duplicate networks",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				Networks: []string{"db", "db"},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "contains duplicate network 'db'",
+		},
+		{
+			name: "haloy network in networks",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				Networks: []string{"haloy-public"},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "already the container's primary network",
+		},
+		{
+			name: "valid dns settings",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				DNS:        []string{"10.0.0.2", "fd00::53"},
+				DNSSearch:  []string{"corp.internal"},
+				ExtraHosts: []string{"db.corp:10.0.0.5", "ipv6.corp:fd00::5", "host.docker.internal:host-gateway"},
+			},
+			format:      "yaml",
+			expectError: false,
+		},
+		{
+			name: "invalid dns server",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				DNS: []string{"dns.example.com"},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "dns entry 'dns.example.com' is not an IP address",
+		},
+		{
+			name: "invalid extra host",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				ExtraHosts: []string{"db.corp"},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "extra_hosts: invalid entry 'db.corp'",
+		},
+		{
+			name: "internal exposure with domains",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				Exposure: ExposureInternal,
+				Domains:  []Domain{{Canonical: "example.com"}},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "domains can't be used with exposure 'internal'",
+		},
+		{
+			name: "invalid exposure",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				Exposure: "private",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "exposure must be 'public' or 'internal'",
+		},
+		{
+			name: "frontend without domains",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				Frontend: "admin",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "frontend requires at least one domain",
+		},
+		{
+			name: "invalid frontend name",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				Domains:  []Domain{{Canonical: "admin.example.com"}},
+				Frontend: "Admin Panel",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "invalid frontend 'Admin Panel'",
+		},
+		{
+			name: "external lb target without domains",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				ExternalLBTarget: "17b5962d775c646f3f9725cbc7a53df4",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "external_lb_target requires at least one domain",
+		},
 		{
 			name: "invalid replicas",
 			target: TargetConfig{
@@ -254,6 +407,37 @@ func TestTargetConfig_Validate_Comprehensive(t *testing.T) {
 	}
 }
 
+func TestTargetConfig_ValidateProxyBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  TargetConfig
+		backend string
+		errMsg  string
+	}{
+		{name: "haproxy supports shadow_to", config: TargetConfig{ShadowTo: &ShadowTo{App: "shop-v2"}}, backend: ProxyBackendHAProxy},
+		{name: "default backend supports frontends", config: TargetConfig{Frontend: "admin"}},
+		{name: "caddy with domains", config: TargetConfig{Domains: []Domain{{Canonical: "example.com"}}}, backend: ProxyBackendCaddy},
+		{name: "caddy with shadow_to", config: TargetConfig{ShadowTo: &ShadowTo{App: "shop-v2"}}, backend: ProxyBackendCaddy, errMsg: "shadow_to is not supported"},
+		{name: "caddy with frontend", config: TargetConfig{Frontend: "admin"}, backend: ProxyBackendCaddy, errMsg: "frontend is not supported"},
+		{name: "caddy with connection limits", config: TargetConfig{Connections: &Connections{}}, backend: ProxyBackendCaddy, errMsg: "connections is not supported"},
+		{name: "caddy with autoscale", config: TargetConfig{Autoscale: &Autoscale{}}, backend: ProxyBackendCaddy, errMsg: "autoscale is not supported"},
+		{name: "caddy with domain key type", config: TargetConfig{Domains: []Domain{{Canonical: "example.com", KeyType: KeyTypeEC256}}}, backend: ProxyBackendCaddy, errMsg: "domain 'example.com': key_type is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.ValidateProxyBackend(tt.backend, "yaml")
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("ValidateProxyBackend() unexpected error = %v", err)
+				}
+			} else if err == nil || !helpers.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("ValidateProxyBackend() error = %v, expected to contain %v", err, tt.errMsg)
+			}
+		})
+	}
+}
+
 func TestDomain_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -304,6 +488,23 @@ func TestDomain_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "domain length must be between 1 and 253 characters",
 		},
+		{
+			name: "valid key type",
+			domain: Domain{
+				Canonical: "example.com",
+				KeyType:   KeyTypeEC384,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid key type",
+			domain: Domain{
+				Canonical: "example.com",
+				KeyType:   "ed25519",
+			},
+			wantErr: true,
+			errMsg:  "domain 'example.com': invalid key type 'ed25519'",
+		},
 	}
 
 	for _, tt := range tests {
@@ -3,11 +3,13 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
 
+	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/helpers"
 )
 
@@ -45,11 +47,28 @@ func (tc *TargetConfig) Validate(format string) error {
 		}
 	}
 
+	switch tc.Exposure {
+	case "", ExposurePublic:
+	case ExposureInternal:
+		if len(tc.Domains) > 0 {
+			return fmt.Errorf("%s can't be used with exposure 'internal', internal apps are not routed publicly", GetFieldNameForFormat(TargetConfig{}, "Domains", format))
+		}
+		if tc.Frontend != "" {
+			return fmt.Errorf("%s can't be used with exposure 'internal'", GetFieldNameForFormat(TargetConfig{}, "Frontend", format))
+		}
+	default:
+		return fmt.Errorf("exposure must be '%s' or '%s', got '%s'", ExposurePublic, ExposureInternal, tc.Exposure)
+	}
+
 	if len(tc.Domains) > 0 {
 		for _, domain := range tc.Domains {
 			if err := domain.Validate(); err != nil {
 				return err
 			}
+			// Additional frontends set TLS for all their domains.
+			if domain.TLSDisabled() && tc.Frontend != "" {
+				return fmt.Errorf("domain '%s': tls can't be set for apps on a %s, use a frontend without tls instead", domain.Canonical, GetFieldNameForFormat(TargetConfig{}, "Frontend", format))
+			}
 		}
 	}
 
@@ -57,6 +76,11 @@ func (tc *TargetConfig) Validate(format string) error {
 		return fmt.Errorf("%s is invalid '%s'; must be a valid email address", GetFieldNameForFormat(TargetConfig{}, "ACMEEmail", format), tc.ACMEEmail)
 	}
 
+	// Checked before the env list, so a variable resolved to an empty value is reported against the schema.
+	if err := validateEnvSchema(tc.EnvSchema, tc.Env, format); err != nil {
+		return err
+	}
+
 	for j, envVar := range tc.Env {
 		if err := envVar.Validate(format); err != nil {
 			return fmt.Errorf("env[%d]: %w", j, err)
@@ -64,30 +88,57 @@ func (tc *TargetConfig) Validate(format string) error {
 	}
 
 	for _, volume := range tc.Volumes {
-		// Expected format: /host/path:/container/path[:options] or volume-name:/container/path[:options]
-		parts := strings.Split(volume, ":")
-		if len(parts) < 2 || len(parts) > 3 {
-			return fmt.Errorf("invalid volume mapping '%s'; expected 'host-path:/container/path[:options]'", volume)
+		if err := validateVolume(volume); err != nil {
+			return err
+		}
+	}
+
+	for i, network := range tc.Networks {
+		networksField := GetFieldNameForFormat(TargetConfig{}, "Networks", format)
+		if strings.TrimSpace(network) == "" {
+			return fmt.Errorf("%s cannot contain an empty network name", networksField)
+		}
+		if network == constants.DockerNetwork || network == tc.Network {
+			return fmt.Errorf("%s entry '%s' is already the container's primary network", networksField, network)
 		}
+		if slices.Contains(tc.Networks[:i], network) {
+			return fmt.Errorf("%s contains duplicate network '%s'", networksField, network)
+		}
+	}
 
-		hostPath := strings.TrimSpace(parts[0])
-		if hostPath == "" {
-			return fmt.Errorf("volume host path cannot be empty in '%s'", volume)
+	for _, server := range tc.DNS {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("%s entry '%s' is not an IP address", GetFieldNameForFormat(TargetConfig{}, "DNS", format), server)
 		}
+	}
 
-		// Check if this is a filesystem bind mount (not a named volume)
-		// Named volumes don't contain path separators and don't start with '.'
-		if strings.Contains(hostPath, "/") || strings.HasPrefix(hostPath, ".") {
-			// This appears to be a filesystem path, require it to be absolute
-			if !filepath.IsAbs(hostPath) {
-				return fmt.Errorf("volume host path '%s' in '%s' must be absolute when using filesystem bind mounts. Relative paths don't work when the daemon runs in a container", hostPath, volume)
-			}
+	for _, domain := range tc.DNSSearch {
+		if domain == "" || strings.ContainsAny(domain, " \t/:") {
+			return fmt.Errorf("%s entry '%s' is not a valid domain", GetFieldNameForFormat(TargetConfig{}, "DNSSearch", format), domain)
+		}
+	}
+
+	for _, extraHost := range tc.ExtraHosts {
+		if err := validateExtraHost(extraHost); err != nil {
+			return fmt.Errorf("%s: %w", GetFieldNameForFormat(TargetConfig{}, "ExtraHosts", format), err)
+		}
+	}
+
+	if tc.Frontend != "" {
+		if !proxyFrontendNameRegex.MatchString(tc.Frontend) {
+			return fmt.Errorf("invalid %s '%s', must be the name of a proxy frontend in the haloyd config", GetFieldNameForFormat(TargetConfig{}, "Frontend", format), tc.Frontend)
+		}
+		if len(tc.Domains) == 0 {
+			return fmt.Errorf("%s requires at least one domain", GetFieldNameForFormat(TargetConfig{}, "Frontend", format))
 		}
+	}
 
-		// Container path must be absolute
-		containerPath := strings.TrimSpace(parts[1])
-		if !filepath.IsAbs(containerPath) {
-			return fmt.Errorf("volume container path '%s' in '%s' is not an absolute path", containerPath, volume)
+	if tc.ExternalLBTarget != "" {
+		if strings.ContainsAny(tc.ExternalLBTarget, " \t") {
+			return fmt.Errorf("invalid %s '%s', must be a Cloudflare pool ID or AWS target group ARN", GetFieldNameForFormat(TargetConfig{}, "ExternalLBTarget", format), tc.ExternalLBTarget)
+		}
+		if len(tc.Domains) == 0 {
+			return fmt.Errorf("%s requires at least one domain", GetFieldNameForFormat(TargetConfig{}, "ExternalLBTarget", format))
 		}
 	}
 
@@ -97,6 +148,90 @@ func (tc *TargetConfig) Validate(format string) error {
 		}
 	}
 
+	if tc.HealthCheck != nil {
+		if err := tc.HealthCheck.Validate(format); err != nil {
+			return err
+		}
+	}
+
+	if tc.Warmup != nil {
+		if err := tc.Warmup.Validate(format); err != nil {
+			return err
+		}
+	}
+
+	if tc.Connections != nil {
+		if err := tc.Connections.Validate(format); err != nil {
+			return err
+		}
+	}
+
+	if tc.Autoscale != nil {
+		if err := tc.Autoscale.Validate(format); err != nil {
+			return err
+		}
+	}
+
+	if tc.ShadowTo != nil {
+		if err := tc.ShadowTo.Validate(tc.Name, format); err != nil {
+			return err
+		}
+	}
+
+	if tc.DeployWebhook != nil {
+		if err := tc.DeployWebhook.Validate(format); err != nil {
+			return err
+		}
+	}
+
+	if tc.ImageWatch != nil {
+		if err := tc.ImageWatch.Validate(format); err != nil {
+			return err
+		}
+		// The watcher deploys tags from the registry, images pinned by digest or uploaded to the server have none.
+		if tc.Image != nil && (tc.Image.IsDigestReference() || (tc.Image.ShouldBuild() && tc.Image.GetEffectivePushStrategy() == BuildPushOptionServer)) {
+			return fmt.Errorf("%s requires an image from a registry, not one pinned by digest or uploaded to the server",
+				GetFieldNameForFormat(TargetConfig{}, "ImageWatch", format))
+		}
+	}
+
+	for i, sidecar := range tc.Sidecars {
+		if err := sidecar.Validate(format); err != nil {
+			return err
+		}
+		for _, other := range tc.Sidecars[:i] {
+			if other.Name == sidecar.Name {
+				return fmt.Errorf("%s contains duplicate name '%s'", GetFieldNameForFormat(TargetConfig{}, "Sidecars", format), sidecar.Name)
+			}
+		}
+	}
+
+	for i, initContainer := range tc.InitContainers {
+		if err := initContainer.Validate(format); err != nil {
+			return err
+		}
+		for _, other := range tc.InitContainers[:i] {
+			if other.Name == initContainer.Name {
+				return fmt.Errorf("%s contains duplicate name '%s'", GetFieldNameForFormat(TargetConfig{}, "InitContainers", format), initContainer.Name)
+			}
+		}
+	}
+
+	if tc.Logging != nil {
+		if err := tc.Logging.Validate(format); err != nil {
+			return err
+		}
+	}
+
+	for key := range tc.Labels {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%s cannot contain an empty key", GetFieldNameForFormat(TargetConfig{}, "Labels", format))
+		}
+		if strings.HasPrefix(key, LabelPrefix) {
+			return fmt.Errorf("%s key '%s' uses the reserved '%s' prefix", GetFieldNameForFormat(TargetConfig{}, "Labels", format), key, LabelPrefix)
+		}
+	}
+
 	if tc.Replicas != nil {
 		if int(*tc.Replicas) < 1 {
 			return errors.New("replicas must be at least 1")
@@ -106,6 +241,50 @@ func (tc *TargetConfig) Validate(format string) error {
 	return nil
 }
 
+// validateVolume checks a volume mapping in the form host-path:/container/path[:options].
+func validateVolume(volume string) error {
+	// Expected format: /host/path:/container/path[:options] or volume-name:/container/path[:options]
+	parts := strings.Split(volume, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid volume mapping '%s'; expected 'host-path:/container/path[:options]'", volume)
+	}
+
+	hostPath := strings.TrimSpace(parts[0])
+	if hostPath == "" {
+		return fmt.Errorf("volume host path cannot be empty in '%s'", volume)
+	}
+
+	// Check if this is a filesystem bind mount (not a named volume)
+	// Named volumes don't contain path separators and don't start with '.'
+	if strings.Contains(hostPath, "/") || strings.HasPrefix(hostPath, ".") {
+		// This appears to be a filesystem path, require it to be absolute
+		if !filepath.IsAbs(hostPath) {
+			return fmt.Errorf("volume host path '%s' in '%s' must be absolute when using filesystem bind mounts. Relative paths don't work when the daemon runs in a container", hostPath, volume)
+		}
+	}
+
+	// Container path must be absolute
+	containerPath := strings.TrimSpace(parts[1])
+	if !filepath.IsAbs(containerPath) {
+		return fmt.Errorf("volume container path '%s' in '%s' is not an absolute path", containerPath, volume)
+	}
+
+	return nil
+}
+
+// validateExtraHost checks an extra hosts entry in the Docker form hostname:IP. The IP may also be
+// "host-gateway", which Docker replaces with the address of the host.
+func validateExtraHost(extraHost string) error {
+	hostname, ip, ok := strings.Cut(extraHost, ":")
+	if !ok || hostname == "" {
+		return fmt.Errorf("invalid entry '%s'; expected 'hostname:IP'", extraHost)
+	}
+	if ip != "host-gateway" && net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid IP '%s' in '%s'; expected an IP address or 'host-gateway'", ip, extraHost)
+	}
+	return nil
+}
+
 func isValidAppName(name string) bool {
 	// Only allow alphanumeric, hyphens, and underscores
 	// Must start with alphanumeric character
@@ -116,3 +295,31 @@ func isValidAppName(name string) bool {
 	}
 	return matched
 }
+
+// ValidateProxyBackend rejects the settings the proxy backend of the server doesn't support. The caddy backend
+// only routes the domains of an app to its replicas: it has no mirroring, additional frontends, connection limits
+// or the HAProxy metrics autoscaling reads, and Caddy picks the key type of the certificates it obtains.
+func (tc *TargetConfig) ValidateProxyBackend(backend, format string) error {
+	if backend != ProxyBackendCaddy {
+		return nil
+	}
+	unsupported := func(field string) error {
+		return fmt.Errorf("%s is not supported with the caddy proxy backend of the server", GetFieldNameForFormat(TargetConfig{}, field, format))
+	}
+	switch {
+	case tc.ShadowTo != nil:
+		return unsupported("ShadowTo")
+	case tc.Frontend != "":
+		return unsupported("Frontend")
+	case tc.Connections != nil:
+		return unsupported("Connections")
+	case tc.Autoscale != nil:
+		return unsupported("Autoscale")
+	}
+	for _, domain := range tc.Domains {
+		if domain.KeyType != "" {
+			return fmt.Errorf("domain '%s': %s is not supported with the caddy proxy backend of the server", domain.Canonical, GetFieldNameForFormat(Domain{}, "KeyType", format))
+		}
+	}
+	return nil
+}
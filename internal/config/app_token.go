@@ -0,0 +1,83 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// appTokenHashPrefix marks the hash algorithm of AppToken.TokenHash.
+const appTokenHashPrefix = "sha256:"
+
+var (
+	appTokenNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	appTokenHashRegex = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+// AppToken is an API token that can only manage the apps matching its patterns, e.g. the token of the CI
+// pipeline of one project. Only the hash of the token is stored in the haloyd config.
+type AppToken struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// TokenHash is "sha256:" followed by the hex SHA-256 hash of the token, see HashAPIToken.
+	TokenHash string `json:"tokenHash" yaml:"token_hash" toml:"token_hash"`
+	// Apps are the app names the token can manage, with * and ? wildcards, e.g. "shop-*".
+	Apps []string `json:"apps" yaml:"apps" toml:"apps"`
+}
+
+// HashAPIToken returns the hash of token stored in AppToken.TokenHash.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return appTokenHashPrefix + hex.EncodeToString(sum[:])
+}
+
+func (t AppToken) Validate() error {
+	if !appTokenNameRegex.MatchString(t.Name) {
+		return fmt.Errorf("invalid api.app_tokens name '%s', must start with a letter or digit and only contain letters, digits, '.', '_' and '-'", t.Name)
+	}
+	if !appTokenHashRegex.MatchString(t.TokenHash) {
+		return fmt.Errorf("invalid api.app_tokens token_hash of '%s', must be 'sha256:' followed by 64 hex digits", t.Name)
+	}
+	if len(t.Apps) == 0 {
+		return fmt.Errorf("api.app_tokens '%s' must list the apps it can manage", t.Name)
+	}
+	for _, pattern := range t.Apps {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("invalid api.app_tokens app pattern '%s' of '%s'", pattern, t.Name)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether token is the token of t.
+func (t AppToken) Matches(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIToken(token)), []byte(t.TokenHash)) == 1
+}
+
+// AllowsApp reports whether the token can manage the app.
+func (t AppToken) AllowsApp(appName string) bool {
+	for _, pattern := range t.Apps {
+		if matched, _ := path.Match(pattern, appName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAppTokens validates the app tokens and checks that their names are unique.
+func validateAppTokens(tokens []AppToken) error {
+	names := make(map[string]bool)
+	for _, token := range tokens {
+		if err := token.Validate(); err != nil {
+			return err
+		}
+		if names[token.Name] {
+			return fmt.Errorf("api.app_tokens name '%s' is used more than once", token.Name)
+		}
+		names[token.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestValidateAppTokens(t *testing.T) {
+	hash := HashAPIToken("secret")
+	tests := []struct {
+		name        string
+		tokens      []AppToken
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:   "valid tokens",
+			tokens: []AppToken{{Name: "ci-shop", TokenHash: hash, Apps: []string{"shop-*", "shop"}}, {Name: "blog", TokenHash: hash, Apps: []string{"blog"}}},
+		},
+		{
+			name:        "invalid name",
+			tokens:      []AppToken{{Name: "ci shop", TokenHash: hash, Apps: []string{"shop"}}},
+			expectError: true,
+			errMsg:      "invalid api.app_tokens name",
+		},
+		{
+			name:        "plain token instead of hash",
+			tokens:      []AppToken{{Name: "ci", TokenHash: "secret", Apps: []string{"shop"}}},
+			expectError: true,
+			errMsg:      "token_hash",
+		},
+		{
+			name:        "no apps",
+			tokens:      []AppToken{{Name: "ci", TokenHash: hash}},
+			expectError: true,
+			errMsg:      "must list the apps",
+		},
+		{
+			name:        "invalid pattern",
+			tokens:      []AppToken{{Name: "ci", TokenHash: hash, Apps: []string{"shop-["}}},
+			expectError: true,
+			errMsg:      "invalid api.app_tokens app pattern",
+		},
+		{
+			name:        "duplicate name",
+			tokens:      []AppToken{{Name: "ci", TokenHash: hash, Apps: []string{"a"}}, {Name: "ci", TokenHash: hash, Apps: []string{"b"}}},
+			expectError: true,
+			errMsg:      "used more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAppTokens(tt.tokens)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("validateAppTokens() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("validateAppTokens() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("validateAppTokens() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAppToken_MatchesAndAllowsApp(t *testing.T) {
+	token := AppToken{Name: "ci-shop", TokenHash: HashAPIToken("secret"), Apps: []string{"shop-*", "admin"}}
+
+	if !token.Matches("secret") {
+		t.Errorf("Matches() = false for the token, expected true")
+	}
+	if token.Matches("other") {
+		t.Errorf("Matches() = true for another token, expected false")
+	}
+
+	tests := map[string]bool{
+		"shop-web":   true,
+		"shop-":      true,
+		"admin":      true,
+		"shop":       false,
+		"admin-test": false,
+		"blog":       false,
+	}
+	for appName, expected := range tests {
+		if got := token.AllowsApp(appName); got != expected {
+			t.Errorf("AllowsApp(%q) = %v, expected %v", appName, got, expected)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultAutoscaleCooldown is the minimum time between scale actions of an app when autoscale.cooldown is not set.
+const DefaultAutoscaleCooldown = 2 * time.Minute
+
+// Autoscale lets haloyd scale the replicas of an app between Min and Max based on the HAProxy metrics
+// of its backend. The app is scaled up when the load per replica is above a target or requests are
+// queued, and down one replica at a time when fewer replicas would stay below the targets.
+type Autoscale struct {
+	Min *int `json:"min,omitempty" yaml:"min,omitempty" toml:"min,omitempty"`
+	Max *int `json:"max,omitempty" yaml:"max,omitempty" toml:"max,omitempty"`
+	// TargetSessions is the number of concurrent sessions per replica to scale for.
+	TargetSessions *int `json:"targetSessions,omitempty" yaml:"target_sessions,omitempty" toml:"target_sessions,omitempty"`
+	// TargetSessionRate is the number of new sessions per second per replica to scale for.
+	TargetSessionRate *int `json:"targetSessionRate,omitempty" yaml:"target_session_rate,omitempty" toml:"target_session_rate,omitempty"`
+	// Cooldown is the minimum time between scale actions, as a Go duration string (default 2m).
+	Cooldown string `json:"cooldown,omitempty" yaml:"cooldown,omitempty" toml:"cooldown,omitempty"`
+}
+
+func (a *Autoscale) Validate(format string) error {
+	autoscaleField := GetFieldNameForFormat(TargetConfig{}, "Autoscale", format)
+	fieldName := func(name string) string {
+		return fmt.Sprintf("%s.%s", autoscaleField, GetFieldNameForFormat(Autoscale{}, name, format))
+	}
+
+	if a.Min == nil || a.Max == nil {
+		return fmt.Errorf("%s and %s are required", fieldName("Min"), fieldName("Max"))
+	}
+	if *a.Min < 1 {
+		return fmt.Errorf("%s must be at least 1", fieldName("Min"))
+	}
+	if *a.Max < *a.Min {
+		return fmt.Errorf("%s must be at least %s", fieldName("Max"), fieldName("Min"))
+	}
+
+	if a.TargetSessions == nil && a.TargetSessionRate == nil {
+		return fmt.Errorf("%s requires %s or %s", autoscaleField,
+			GetFieldNameForFormat(Autoscale{}, "TargetSessions", format), GetFieldNameForFormat(Autoscale{}, "TargetSessionRate", format))
+	}
+	if a.TargetSessions != nil && *a.TargetSessions < 1 {
+		return fmt.Errorf("%s must be at least 1", fieldName("TargetSessions"))
+	}
+	if a.TargetSessionRate != nil && *a.TargetSessionRate < 1 {
+		return fmt.Errorf("%s must be at least 1", fieldName("TargetSessionRate"))
+	}
+
+	if _, err := parseHealthCheckDuration(a.Cooldown); err != nil {
+		return fmt.Errorf("%s is invalid: %w", fieldName("Cooldown"), err)
+	}
+
+	return nil
+}
+
+// CooldownDuration returns the minimum time between scale actions. Call Validate first.
+func (a *Autoscale) CooldownDuration() time.Duration {
+	if d, err := parseHealthCheckDuration(a.Cooldown); err == nil && d > 0 {
+		return d
+	}
+	return DefaultAutoscaleCooldown
+}
+
+// DesiredReplicas returns the number of replicas for the given load of an app with current replicas,
+// within the Min and Max bounds. Call Validate first.
+func (a *Autoscale) DesiredReplicas(current, sessions, sessionRate, queued int) int {
+	// The replicas needed to keep each metric at or below its target.
+	needed := 1
+	if a.TargetSessions != nil {
+		needed = max(needed, ceilDiv(sessions, *a.TargetSessions))
+	}
+	if a.TargetSessionRate != nil {
+		needed = max(needed, ceilDiv(sessionRate, *a.TargetSessionRate))
+	}
+	if queued > 0 {
+		needed = max(needed, current+1)
+	}
+
+	desired := needed
+	if desired < current {
+		// Scale down one replica at a time, the next pass checks the load again.
+		desired = current - 1
+	}
+	return min(max(desired, *a.Min), *a.Max)
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestAutoscale_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoscale   Autoscale
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:        "valid sessions target",
+			autoscale:   Autoscale{Min: helpers.IntPtr(1), Max: helpers.IntPtr(5), TargetSessions: helpers.IntPtr(50), Cooldown: "1m"},
+			expectError: false,
+		},
+		{
+			name:        "valid session rate target",
+			autoscale:   Autoscale{Min: helpers.IntPtr(2), Max: helpers.IntPtr(2), TargetSessionRate: helpers.IntPtr(100)},
+			expectError: false,
+		},
+		{
+			name:        "missing bounds",
+			autoscale:   Autoscale{Max: helpers.IntPtr(5), TargetSessions: helpers.IntPtr(50)},
+			expectError: true,
+			errMsg:      "autoscale.min and autoscale.max are required",
+		},
+		{
+			name:        "zero min",
+			autoscale:   Autoscale{Min: helpers.IntPtr(0), Max: helpers.IntPtr(5), TargetSessions: helpers.IntPtr(50)},
+			expectError: true,
+			errMsg:      "autoscale.min must be at least 1",
+		},
+		{
+			name:        "max below min",
+			autoscale:   Autoscale{Min: helpers.IntPtr(3), Max: helpers.IntPtr(2), TargetSessions: helpers.IntPtr(50)},
+			expectError: true,
+			errMsg:      "autoscale.max must be at least autoscale.min",
+		},
+		{
+			name:        "no target",
+			autoscale:   Autoscale{Min: helpers.IntPtr(1), Max: helpers.IntPtr(5)},
+			expectError: true,
+			errMsg:      "requires target_sessions or target_session_rate",
+		},
+		{
+			name:        "invalid cooldown",
+			autoscale:   Autoscale{Min: helpers.IntPtr(1), Max: helpers.IntPtr(5), TargetSessions: helpers.IntPtr(50), Cooldown: "later"},
+			expectError: true,
+			errMsg:      "autoscale.cooldown is invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.autoscale.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoscale_DesiredReplicas(t *testing.T) {
+	autoscale := Autoscale{Min: helpers.IntPtr(2), Max: helpers.IntPtr(6), TargetSessions: helpers.IntPtr(50), TargetSessionRate: helpers.IntPtr(100)}
+
+	tests := []struct {
+		name        string
+		current     int
+		sessions    int
+		sessionRate int
+		queued      int
+		want        int
+	}{
+		{"load within target", 3, 120, 200, 0, 3},
+		{"scale up for sessions", 2, 210, 0, 0, 5},
+		{"scale up for session rate", 2, 0, 350, 0, 4},
+		{"scale up for queued requests", 3, 100, 100, 10, 4},
+		{"capped at max", 4, 1000, 0, 0, 6},
+		{"scale down one at a time", 5, 10, 10, 0, 4},
+		{"not below min", 2, 0, 0, 0, 2},
+		{"raised to min", 1, 0, 0, 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := autoscale.DesiredReplicas(tt.current, tt.sessions, tt.sessionRate, tt.queued); got != tt.want {
+				t.Errorf("DesiredReplicas() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoscale_CooldownDuration(t *testing.T) {
+	if got := (&Autoscale{}).CooldownDuration(); got != DefaultAutoscaleCooldown {
+		t.Errorf("CooldownDuration() = %v, want %v", got, DefaultAutoscaleCooldown)
+	}
+	if got := (&Autoscale{Cooldown: "30s"}).CooldownDuration(); got != 30*time.Second {
+		t.Errorf("CooldownDuration() = %v, want %v", got, 30*time.Second)
+	}
+}
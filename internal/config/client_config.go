@@ -3,9 +3,12 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/helpers"
@@ -16,12 +19,95 @@ import (
 
 type ClientConfig struct {
 	Servers map[string]ServerConfig `json:"servers" yaml:"servers" toml:"servers"`
+	// BuildAgents are remote Docker hosts, keyed by name, that build images for servers with another
+	// architecture than the local Docker daemon.
+	BuildAgents map[string]BuildAgent `json:"build_agents,omitempty" yaml:"build_agents,omitempty" toml:"build_agents,omitempty"`
 }
 
 type ServerConfig struct {
 	TokenEnv string `json:"token_env" yaml:"token_env" toml:"token_env"`
 }
 
+// BuildAgent is a Docker host images are built on, e.g. ssh://builder@arm64-builder.example.com.
+type BuildAgent struct {
+	Host string `json:"host" yaml:"host" toml:"host"`
+	// Arch is the architecture of the host, amd64 or arm64.
+	Arch string `json:"arch" yaml:"arch" toml:"arch"`
+}
+
+var buildAgentNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// NormalizeArch returns the Docker name of an architecture, e.g. amd64 for x86_64.
+func NormalizeArch(arch string) string {
+	switch arch = strings.ToLower(strings.TrimSpace(arch)); arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64", "arm64/v8":
+		return "arm64"
+	default:
+		return arch
+	}
+}
+
+// PlatformArch returns the architecture of a platform like linux/arm64.
+func PlatformArch(platform string) string {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return NormalizeArch(platform)
+	}
+	return NormalizeArch(parts[1])
+}
+
+func (cc *ClientConfig) AddBuildAgent(name, host, arch string, force bool) error {
+	if !buildAgentNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid build agent name '%s', must be lowercase letters, digits, '-' or '_'", name)
+	}
+	u, err := url.Parse(host)
+	if err != nil || (u.Scheme != "ssh" && u.Scheme != "tcp") || u.Host == "" {
+		return fmt.Errorf("invalid build agent host '%s', must be a Docker host like ssh://user@host or tcp://host:2376", host)
+	}
+	arch = NormalizeArch(arch)
+	if arch != "amd64" && arch != "arm64" {
+		return fmt.Errorf("invalid build agent arch '%s', must be amd64 or arm64", arch)
+	}
+
+	if cc.BuildAgents == nil {
+		cc.BuildAgents = make(map[string]BuildAgent)
+	}
+	if !force {
+		if _, exists := cc.BuildAgents[name]; exists {
+			return fmt.Errorf("build agent %s already exists. Use --force to override", name)
+		}
+	}
+
+	cc.BuildAgents[name] = BuildAgent{Host: host, Arch: arch}
+	return nil
+}
+
+func (cc *ClientConfig) DeleteBuildAgent(name string) error {
+	if _, exists := cc.BuildAgents[name]; !exists {
+		return fmt.Errorf("build agent %s not found", name)
+	}
+	delete(cc.BuildAgents, name)
+	return nil
+}
+
+// BuildAgentForArch returns the first build agent, ordered by name, with the architecture.
+func (cc *ClientConfig) BuildAgentForArch(arch string) (string, BuildAgent, bool) {
+	arch = NormalizeArch(arch)
+	names := make([]string, 0, len(cc.BuildAgents))
+	for name := range cc.BuildAgents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if agent := cc.BuildAgents[name]; NormalizeArch(agent.Arch) == arch {
+			return name, agent, true
+		}
+	}
+	return "", BuildAgent{}, false
+}
+
 func (cc *ClientConfig) AddServer(url, tokenEnv string, force bool) error {
 	normalizedURL, err := helpers.NormalizeServerURL(url)
 	if err != nil {
@@ -110,3 +110,120 @@ func TestClientConfig_ListServers(t *testing.T) {
 		})
 	}
 }
+
+func TestClientConfig_AddBuildAgent(t *testing.T) {
+	tests := []struct {
+		name        string
+		initial     ClientConfig
+		agentName   string
+		host        string
+		arch        string
+		force       bool
+		expectError bool
+		errMsg      string
+		expected    BuildAgent
+	}{
+		{
+			name:      "ssh agent",
+			agentName: "arm-builder",
+			host:      "ssh://builder@arm.example.com",
+			arch:      "arm64",
+			expected:  BuildAgent{Host: "ssh://builder@arm.example.com", Arch: "arm64"},
+		},
+		{
+			name:      "normalizes arch",
+			agentName: "x86",
+			host:      "tcp://10.0.0.5:2376",
+			arch:      "x86_64",
+			expected:  BuildAgent{Host: "tcp://10.0.0.5:2376", Arch: "amd64"},
+		},
+		{
+			name:        "invalid host",
+			agentName:   "arm-builder",
+			host:        "arm.example.com",
+			arch:        "arm64",
+			expectError: true,
+			errMsg:      "invalid build agent host",
+		},
+		{
+			name:        "unsupported arch",
+			agentName:   "riscv",
+			host:        "ssh://builder@riscv.example.com",
+			arch:        "riscv64",
+			expectError: true,
+			errMsg:      "must be amd64 or arm64",
+		},
+		{
+			name:        "invalid name",
+			agentName:   "ARM Builder",
+			host:        "ssh://builder@arm.example.com",
+			arch:        "arm64",
+			expectError: true,
+			errMsg:      "invalid build agent name",
+		},
+		{
+			name: "existing agent without force",
+			initial: ClientConfig{
+				BuildAgents: map[string]BuildAgent{"arm-builder": {Host: "ssh://old.example.com", Arch: "arm64"}},
+			},
+			agentName:   "arm-builder",
+			host:        "ssh://builder@arm.example.com",
+			arch:        "arm64",
+			expectError: true,
+			errMsg:      "already exists",
+		},
+		{
+			name: "existing agent with force",
+			initial: ClientConfig{
+				BuildAgents: map[string]BuildAgent{"arm-builder": {Host: "ssh://old.example.com", Arch: "arm64"}},
+			},
+			agentName: "arm-builder",
+			host:      "ssh://builder@arm.example.com",
+			arch:      "arm64",
+			force:     true,
+			expected:  BuildAgent{Host: "ssh://builder@arm.example.com", Arch: "arm64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.initial
+			err := config.AddBuildAgent(tt.agentName, tt.host, tt.arch, tt.force)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("AddBuildAgent() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("AddBuildAgent() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddBuildAgent() unexpected error = %v", err)
+			}
+			if actual := config.BuildAgents[tt.agentName]; actual != tt.expected {
+				t.Errorf("AddBuildAgent() agent = %+v, expected %+v", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientConfig_BuildAgentForArch(t *testing.T) {
+	config := ClientConfig{
+		BuildAgents: map[string]BuildAgent{
+			"b-arm": {Host: "ssh://b.example.com", Arch: "arm64"},
+			"a-arm": {Host: "ssh://a.example.com", Arch: "arm64"},
+			"x86":   {Host: "ssh://x86.example.com", Arch: "amd64"},
+		},
+	}
+
+	if name, _, ok := config.BuildAgentForArch("aarch64"); !ok || name != "a-arm" {
+		t.Errorf("BuildAgentForArch(aarch64) = %s, %v, expected a-arm", name, ok)
+	}
+	if name, _, ok := config.BuildAgentForArch("amd64"); !ok || name != "x86" {
+		t.Errorf("BuildAgentForArch(amd64) = %s, %v, expected x86", name, ok)
+	}
+	if _, _, ok := config.BuildAgentForArch("s390x"); ok {
+		t.Errorf("BuildAgentForArch(s390x) found an agent, expected none")
+	}
+}
@@ -2,11 +2,14 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"path/filepath"
 	"reflect"
 	"slices"
 	"strings"
 
+	"github.com/ameistad/haloy/internal/helpers"
+
 	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/parsers/toml"
 	"github.com/knadh/koanf/parsers/yaml"
@@ -75,132 +78,120 @@ func GetFieldNameForFormat(v any, fieldName, format string) string {
 	return parts[0]
 }
 
-func CheckUnknownFields(structType reflect.Type, configKeys []string, format string) error {
-	knownFields := getKnownFields(structType, format)
-
-	unknownFields := make([]string, 0)
-	for _, key := range configKeys {
-		if !isValidConfigKey(key, knownFields) {
-			unknownFields = append(unknownFields, key)
-		}
-	}
+// UnknownField is a config key that doesn't match any field.
+type UnknownField struct {
+	// Key is the path of the key up to the first part that isn't a field.
+	Key string
+	// Suggestion is the closest field name in the same section, if any is close.
+	Suggestion string
+}
 
-	if len(unknownFields) > 0 {
-		return fmt.Errorf("unknown config fields found: %v", unknownFields)
+func (f UnknownField) String() string {
+	if f.Suggestion != "" {
+		return fmt.Sprintf("unknown field '%s' (did you mean '%s'?)", f.Key, f.Suggestion)
 	}
+	return fmt.Sprintf("unknown field '%s'", f.Key)
+}
 
-	return nil
+// UnknownFieldsError lists the unknown fields found in a config.
+type UnknownFieldsError struct {
+	Fields []UnknownField
 }
 
-// isValidConfigKey checks if a config key is valid, handling map fields with dynamic keys
-func isValidConfigKey(key string, knownFields []string) bool {
-	// Direct match
-	if slices.Contains(knownFields, key) {
-		return true
+func (e *UnknownFieldsError) Error() string {
+	lines := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		lines[i] = field.String()
 	}
+	return strings.Join(lines, "\n")
+}
 
-	// Check for map field patterns (e.g., "targets.somekey.field")
-	parts := strings.Split(key, ".")
-
-	// Handle targets.{dynamic_key}.{field}
-	if len(parts) >= 3 && parts[0] == "targets" {
-		// For targets.{dynamic_key}.{field}, check if the field part is valid
-		// by looking for a pattern like "targets.{field}" in known fields
-		targetFieldKey := "targets." + strings.Join(parts[2:], ".")
-		return slices.Contains(knownFields, targetFieldKey)
+// CheckUnknownFields checks the config keys against the fields of structType and returns
+// an *UnknownFieldsError for the keys that don't match a field.
+func CheckUnknownFields(structType reflect.Type, configKeys []string, format string) error {
+	var unknownFields []UnknownField
+	for _, key := range configKeys {
+		field, ok := findUnknownField(structType, strings.Split(key, "."), format)
+		if !ok {
+			continue
+		}
+		// Every key below an unknown section is reported once, by the section.
+		if !slices.ContainsFunc(unknownFields, func(f UnknownField) bool { return f.Key == field.Key }) {
+			unknownFields = append(unknownFields, field)
+		}
 	}
 
-	// Handle secret_providers.{provider}.{source_name}.{field}
-	if len(parts) >= 4 && parts[0] == "secret_providers" {
-		// For secret_providers.{provider}.{source_name}.{field}
-		// check if secret_providers.{provider}.{field} exists in known fields
-		providerFieldKey := "secret_providers." + parts[1] + "." + strings.Join(parts[3:], ".")
-		return slices.Contains(knownFields, providerFieldKey)
+	if len(unknownFields) > 0 {
+		return &UnknownFieldsError{Fields: unknownFields}
 	}
 
-	return false
+	return nil
 }
 
-func getKnownFields(structType reflect.Type, format string) []string {
-	var fields []string
-	collectFields(structType, format, "", &fields)
-	return fields
-}
+// findUnknownField follows the parts of a config key through the struct fields. Map fields
+// take any key, and everything below maps and slices of other types than structs is accepted.
+func findUnknownField(structType reflect.Type, parts []string, format string) (UnknownField, bool) {
+	t := indirectType(structType)
+	for i := 0; i < len(parts); i++ {
+		if t.Kind() != reflect.Struct {
+			// A plain value has no fields below it.
+			return UnknownField{Key: strings.Join(parts[:i+1], ".")}, true
+		}
 
-// collectFields recursively collects field names from a struct type
-func collectFields(structType reflect.Type, format string, prefix string, fields *[]string) {
-	if structType.Kind() == reflect.Ptr {
-		structType = structType.Elem()
-	}
-	if structType.Kind() != reflect.Struct {
-		return
+		fieldNames := structFieldNames(t, format)
+		fieldType, ok := fieldNames[parts[i]]
+		if !ok {
+			suggestion, _ := helpers.ClosestMatch(parts[i], slices.Collect(maps.Keys(fieldNames)))
+			return UnknownField{Key: strings.Join(parts[:i+1], "."), Suggestion: suggestion}, true
+		}
+
+		t = indirectType(fieldType)
+		switch t.Kind() {
+		case reflect.Slice, reflect.Map:
+			for t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+				if t.Kind() == reflect.Map {
+					// Skip the map key, e.g. the target name in targets.production.server.
+					i++
+				}
+				t = indirectType(t.Elem())
+			}
+			if t.Kind() != reflect.Struct {
+				return UnknownField{}, false
+			}
+		case reflect.Interface:
+			return UnknownField{}, false
+		}
 	}
+	return UnknownField{}, false
+}
 
+// structFieldNames returns the types of the fields of a struct by their name in the format,
+// with the fields of embedded structs promoted.
+func structFieldNames(structType reflect.Type, format string) map[string]reflect.Type {
+	names := make(map[string]reflect.Type)
 	for i := 0; i < structType.NumField(); i++ {
 		field := structType.Field(i)
 		if !field.IsExported() {
 			continue
 		}
-
-		fieldType := field.Type
-		if fieldType.Kind() == reflect.Ptr {
-			fieldType = fieldType.Elem()
-		}
-
-		// Check for embedding.
-		if field.Anonymous && fieldType.Kind() == reflect.Struct {
-			// If it's an embedded struct, recurse into it with the SAME prefix
-			// to "promote" its fields to the parent's level.
-			collectFields(fieldType, format, prefix, fields)
-			// Then, skip the rest of the loop for this field.
+		if field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct {
+			maps.Copy(names, structFieldNames(indirectType(field.Type), format))
 			continue
 		}
-
-		// If it's NOT an embedded struct, proceed as normal.
 		fieldName := getFieldTagName(field, format)
 		if fieldName == "" || fieldName == "-" {
 			continue
 		}
+		names[fieldName] = field.Type
+	}
+	return names
+}
 
-		fullFieldName := fieldName
-		if prefix != "" {
-			fullFieldName = prefix + "." + fieldName
-		}
-		*fields = append(*fields, fullFieldName)
-
-		// Handle maps with struct values (like Targets map[string]*TargetConfig)
-		if fieldType.Kind() == reflect.Map {
-			valueType := fieldType.Elem()
-			if valueType.Kind() == reflect.Ptr {
-				valueType = valueType.Elem()
-			}
-			if valueType.Kind() == reflect.Struct {
-				// For maps, we need to accept any key, so we use a wildcard approach
-				// by collecting the possible fields that could appear under this map
-				collectFields(valueType, format, fullFieldName, fields)
-			} else if valueType.Kind() == reflect.Map {
-				// Handle nested maps (like SecretProviders -> OnePassword -> map[string]Config)
-				nestedValueType := valueType.Elem()
-				if nestedValueType.Kind() == reflect.Ptr {
-					nestedValueType = nestedValueType.Elem()
-				}
-				if nestedValueType.Kind() == reflect.Struct {
-					collectFields(nestedValueType, format, fullFieldName, fields)
-				}
-			}
-		} else if fieldType.Kind() == reflect.Struct {
-			// Recurse into nested (but not embedded) structs.
-			collectFields(fieldType, format, fullFieldName, fields)
-		} else if fieldType.Kind() == reflect.Slice {
-			elemType := fieldType.Elem()
-			if elemType.Kind() == reflect.Ptr {
-				elemType = elemType.Elem()
-			}
-			if elemType.Kind() == reflect.Struct {
-				collectFields(elemType, format, fullFieldName, fields)
-			}
-		}
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
 	}
+	return t
 }
 
 // getFieldTagName returns the field name for the specified format from struct tags
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -16,6 +18,12 @@ func TestCheckUnknownFields(t *testing.T) {
 		{"valid nested", []string{"env", "env.value", "image.registry", "image.tag"}, false},
 		{"invalid simple", []string{"notHere"}, true},
 		{"invalid nested", []string{"env", "env.unknown", "env.unknown.childunknown"}, true},
+		{"valid target fields", []string{"targets.production.server", "targets.staging.image.tag"}, false},
+		{"invalid target field", []string{"targets.production.servr"}, true},
+		{"valid map of strings", []string{"labels.team", "labels.tier"}, false},
+		{"valid map of structs", []string{"envOverrides.DATABASE_URL.value", "secretProviders.onepassword.production.vault"}, false},
+		{"invalid map of structs", []string{"envOverrides.DATABASE_URL.valu"}, true},
+		{"below a value", []string{"server.host"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -25,3 +33,50 @@ func TestCheckUnknownFields(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckUnknownFieldsSuggestions(t *testing.T) {
+	appConfigType := reflect.TypeOf(AppConfig{})
+	tests := []struct {
+		name   string
+		keys   []string
+		format string
+		want   []UnknownField
+	}{
+		{
+			name:   "json typo",
+			keys:   []string{"heathCheckPath"},
+			format: "json",
+			want:   []UnknownField{{Key: "heathCheckPath", Suggestion: "healthCheckPath"}},
+		},
+		{
+			name:   "yaml typo in target",
+			keys:   []string{"targets.production.acme_emial"},
+			format: "yaml",
+			want:   []UnknownField{{Key: "targets.production.acme_emial", Suggestion: "acme_email"}},
+		},
+		{
+			name:   "unknown section reported once",
+			keys:   []string{"imagee.repository", "imagee.tag"},
+			format: "yaml",
+			want:   []UnknownField{{Key: "imagee", Suggestion: "image"}},
+		},
+		{
+			name:   "no close field",
+			keys:   []string{"completely_unrelated"},
+			format: "yaml",
+			want:   []UnknownField{{Key: "completely_unrelated"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckUnknownFields(appConfigType, tt.keys, tt.format)
+			var unknownErr *UnknownFieldsError
+			if !errors.As(err, &unknownErr) {
+				t.Fatalf("CheckUnknownFields() error = %v, want *UnknownFieldsError", err)
+			}
+			if !slices.Equal(unknownErr.Fields, tt.want) {
+				t.Errorf("CheckUnknownFields() fields = %+v, want %+v", unknownErr.Fields, tt.want)
+			}
+		})
+	}
+}
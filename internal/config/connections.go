@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultQueueTimeout is how long HAProxy queues requests to an app with connection limits when
+// connections.queue_timeout is not set.
+const DefaultQueueTimeout = 30 * time.Second
+
+// Connections limits the concurrent requests HAProxy sends to an app, which protects small apps from overload.
+// Requests above the limit wait in a queue until a connection frees up, or get a 503 when the queue timeout expires.
+type Connections struct {
+	// Max is the number of concurrent connections to the app across all replicas. It's divided between the
+	// running replicas, so the limit of each replica follows the replica count.
+	Max *int `json:"max,omitempty" yaml:"max,omitempty" toml:"max,omitempty"`
+	// MaxPerReplica is the number of concurrent connections to each replica. Takes precedence over Max.
+	MaxPerReplica *int `json:"maxPerReplica,omitempty" yaml:"max_per_replica,omitempty" toml:"max_per_replica,omitempty"`
+	// MaxQueue is the number of requests queued for each replica, unlimited when not set.
+	MaxQueue *int `json:"maxQueue,omitempty" yaml:"max_queue,omitempty" toml:"max_queue,omitempty"`
+	// QueueTimeout is how long a request waits in the queue, as a Go duration string (default 30s).
+	QueueTimeout string `json:"queueTimeout,omitempty" yaml:"queue_timeout,omitempty" toml:"queue_timeout,omitempty"`
+}
+
+func (c *Connections) Validate(format string) error {
+	connectionsField := GetFieldNameForFormat(TargetConfig{}, "Connections", format)
+
+	intFields := []struct {
+		fieldName string
+		value     *int
+	}{
+		{"Max", c.Max},
+		{"MaxPerReplica", c.MaxPerReplica},
+		{"MaxQueue", c.MaxQueue},
+	}
+	for _, field := range intFields {
+		if field.value != nil && *field.value < 1 {
+			return fmt.Errorf("%s.%s must be at least 1", connectionsField, GetFieldNameForFormat(Connections{}, field.fieldName, format))
+		}
+	}
+
+	if _, err := parseHealthCheckDuration(c.QueueTimeout); err != nil {
+		return fmt.Errorf("%s.%s is invalid: %w", connectionsField, GetFieldNameForFormat(Connections{}, "QueueTimeout", format), err)
+	}
+
+	if c.Max == nil && c.MaxPerReplica == nil {
+		return fmt.Errorf("%s requires %s or %s", connectionsField,
+			GetFieldNameForFormat(Connections{}, "Max", format), GetFieldNameForFormat(Connections{}, "MaxPerReplica", format))
+	}
+
+	return nil
+}
+
+// ReplicaMaxConn returns the connection limit of each replica of an app with the given number of running
+// replicas, or 0 if the app has no limit. A limit for the whole app is divided between the replicas,
+// rounded up so the replicas together never allow fewer connections than the limit.
+func (cl *ContainerLabels) ReplicaMaxConn(replicas int) int {
+	if cl.MaxConnectionsPerReplica > 0 {
+		return cl.MaxConnectionsPerReplica
+	}
+	if cl.MaxConnections == 0 {
+		return 0
+	}
+	return ceilDiv(cl.MaxConnections, max(replicas, 1))
+}
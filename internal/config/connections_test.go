@@ -0,0 +1,117 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestConnections_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		connections Connections
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:        "limit for the app",
+			connections: Connections{Max: helpers.IntPtr(200), QueueTimeout: "10s"},
+			expectError: false,
+		},
+		{
+			name:        "limit per replica with queue",
+			connections: Connections{MaxPerReplica: helpers.IntPtr(20), MaxQueue: helpers.IntPtr(100)},
+			expectError: false,
+		},
+		{
+			name:        "no limit",
+			connections: Connections{QueueTimeout: "10s"},
+			expectError: true,
+			errMsg:      "requires max or max_per_replica",
+		},
+		{
+			name:        "zero max",
+			connections: Connections{Max: helpers.IntPtr(0)},
+			expectError: true,
+			errMsg:      "connections.max must be at least 1",
+		},
+		{
+			name:        "zero max queue",
+			connections: Connections{Max: helpers.IntPtr(10), MaxQueue: helpers.IntPtr(0)},
+			expectError: true,
+			errMsg:      "connections.max_queue must be at least 1",
+		},
+		{
+			name:        "invalid queue timeout",
+			connections: Connections{Max: helpers.IntPtr(10), QueueTimeout: "soon"},
+			expectError: true,
+			errMsg:      "queue_timeout is invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.connections.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestContainerLabels_ReplicaMaxConn(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   ContainerLabels
+		replicas int
+		want     int
+	}{
+		{"no limit", ContainerLabels{}, 3, 0},
+		{"limit divided between replicas", ContainerLabels{MaxConnections: 90}, 3, 30},
+		{"rounded up", ContainerLabels{MaxConnections: 100}, 3, 34},
+		{"no running replicas", ContainerLabels{MaxConnections: 100}, 0, 100},
+		{"per replica takes precedence", ContainerLabels{MaxConnections: 100, MaxConnectionsPerReplica: 10}, 3, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.labels.ReplicaMaxConn(tt.replicas); got != tt.want {
+				t.Errorf("ReplicaMaxConn(%d) = %d, want %d", tt.replicas, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerLabels_ConnectionLabelsRoundTrip(t *testing.T) {
+	cl := ContainerLabels{
+		AppName:                  "app",
+		DeploymentID:             "20250101120000",
+		Port:                     "8080",
+		Role:                     AppLabelRole,
+		MaxConnections:           100,
+		MaxConnectionsPerReplica: 20,
+		MaxQueue:                 50,
+		QueueTimeout:             15 * time.Second,
+	}
+
+	parsed, err := ParseContainerLabels(cl.ToLabels())
+	if err != nil {
+		t.Fatalf("ParseContainerLabels() unexpected error = %v", err)
+	}
+	if parsed.MaxConnections != 100 || parsed.MaxConnectionsPerReplica != 20 || parsed.MaxQueue != 50 {
+		t.Errorf("ParseContainerLabels() connection limits = %d/%d/%d, want 100/20/50",
+			parsed.MaxConnections, parsed.MaxConnectionsPerReplica, parsed.MaxQueue)
+	}
+	if parsed.QueueTimeout != 15*time.Second {
+		t.Errorf("ParseContainerLabels() QueueTimeout = %v, want %v", parsed.QueueTimeout, 15*time.Second)
+	}
+}
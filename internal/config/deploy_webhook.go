@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// Providers of deploy webhooks.
+const (
+	DeployWebhookGitHub   = "github"
+	DeployWebhookGitLab   = "gitlab"
+	DeployWebhookRegistry = "registry"
+)
+
+// DeployWebhook lets a webhook redeploy the app on POST /v1/hooks/deploy/{appName}, e.g. on a push to a
+// branch or when an image tag is pushed. GitHub and registry webhooks are verified with an HMAC-SHA256
+// signature of the body made with Secret, GitLab webhooks send Secret as their secret token.
+type DeployWebhook struct {
+	Provider string      `json:"provider" yaml:"provider" toml:"provider"`
+	Secret   ValueSource `json:"secret" yaml:"secret" toml:"secret"`
+	// Branch redeploys the current image tag on pushes to the branch, e.g. to pull a new build of "latest".
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty" toml:"branch,omitempty"`
+	// Tags is a glob, e.g. "v*". Git tags and image tags matching it are deployed as the tag of the image.
+	Tags string `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+}
+
+func (h *DeployWebhook) Validate(format string) error {
+	webhookField := GetFieldNameForFormat(TargetConfig{}, "DeployWebhook", format)
+	fieldName := func(name string) string {
+		return fmt.Sprintf("%s.%s", webhookField, GetFieldNameForFormat(DeployWebhook{}, name, format))
+	}
+
+	switch h.Provider {
+	case DeployWebhookGitHub, DeployWebhookGitLab, DeployWebhookRegistry:
+	case "":
+		return fmt.Errorf("%s is required", fieldName("Provider"))
+	default:
+		return fmt.Errorf("%s '%s' is invalid, must be %s, %s or %s", fieldName("Provider"), h.Provider,
+			DeployWebhookGitHub, DeployWebhookGitLab, DeployWebhookRegistry)
+	}
+
+	if h.Secret.Value == "" && h.Secret.From == nil {
+		return fmt.Errorf("%s is required", fieldName("Secret"))
+	}
+	if h.Secret.From != nil {
+		if err := h.Secret.From.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", fieldName("Secret"), err)
+		}
+	}
+
+	if h.Branch == "" && h.Tags == "" {
+		return fmt.Errorf("%s requires %s or %s", webhookField, GetFieldNameForFormat(DeployWebhook{}, "Branch", format),
+			GetFieldNameForFormat(DeployWebhook{}, "Tags", format))
+	}
+	if h.Branch != "" && h.Provider == DeployWebhookRegistry {
+		return fmt.Errorf("%s is only supported for %s and %s webhooks", fieldName("Branch"), DeployWebhookGitHub, DeployWebhookGitLab)
+	}
+	if _, err := path.Match(h.Tags, ""); err != nil {
+		return fmt.Errorf("%s '%s' is not a valid glob: %w", fieldName("Tags"), h.Tags, err)
+	}
+
+	return nil
+}
+
+// MatchesTag reports whether a git or image tag is deployed by the webhook.
+func (h *DeployWebhook) MatchesTag(tag string) bool {
+	if h.Tags == "" || tag == "" {
+		return false
+	}
+	matched, _ := path.Match(h.Tags, tag)
+	return matched
+}
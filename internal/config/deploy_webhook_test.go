@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestDeployWebhook_Validate(t *testing.T) {
+	secret := ValueSource{From: &SourceReference{Env: "SHOP_WEBHOOK_SECRET"}}
+
+	tests := []struct {
+		name        string
+		webhook     DeployWebhook
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:    "github branch and tags",
+			webhook: DeployWebhook{Provider: DeployWebhookGitHub, Secret: secret, Branch: "main", Tags: "v*"},
+		},
+		{
+			name:    "registry tags",
+			webhook: DeployWebhook{Provider: DeployWebhookRegistry, Secret: ValueSource{Value: "s3cret"}, Tags: "1.*"},
+		},
+		{
+			name:        "missing provider",
+			webhook:     DeployWebhook{Secret: secret, Branch: "main"},
+			expectError: true,
+			errMsg:      "deploy_webhook.provider is required",
+		},
+		{
+			name:        "unknown provider",
+			webhook:     DeployWebhook{Provider: "bitbucket", Secret: secret, Branch: "main"},
+			expectError: true,
+			errMsg:      "'bitbucket' is invalid",
+		},
+		{
+			name:        "missing secret",
+			webhook:     DeployWebhook{Provider: DeployWebhookGitLab, Branch: "main"},
+			expectError: true,
+			errMsg:      "deploy_webhook.secret is required",
+		},
+		{
+			name:        "neither branch nor tags",
+			webhook:     DeployWebhook{Provider: DeployWebhookGitHub, Secret: secret},
+			expectError: true,
+			errMsg:      "requires branch or tags",
+		},
+		{
+			name:        "branch on registry",
+			webhook:     DeployWebhook{Provider: DeployWebhookRegistry, Secret: secret, Branch: "main"},
+			expectError: true,
+			errMsg:      "only supported for github and gitlab",
+		},
+		{
+			name:        "invalid glob",
+			webhook:     DeployWebhook{Provider: DeployWebhookGitHub, Secret: secret, Tags: "v[1"},
+			expectError: true,
+			errMsg:      "not a valid glob",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.webhook.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeployWebhook_MatchesTag(t *testing.T) {
+	webhook := DeployWebhook{Tags: "v*"}
+	if !webhook.MatchesTag("v1.2.3") {
+		t.Error("MatchesTag(v1.2.3) = false, want true")
+	}
+	if webhook.MatchesTag("latest") {
+		t.Error("MatchesTag(latest) = true, want false")
+	}
+	if (&DeployWebhook{Branch: "main"}).MatchesTag("v1.2.3") {
+		t.Error("MatchesTag() without tags = true, want false")
+	}
+}
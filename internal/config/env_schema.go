@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+const (
+	EnvSchemaTypeString = "string"
+	EnvSchemaTypeInt    = "int"
+	EnvSchemaTypeFloat  = "float"
+	EnvSchemaTypeBool   = "bool"
+	EnvSchemaTypeURL    = "url"
+)
+
+// EnvSchemaVar declares an environment variable the app needs. Deployments fail before any container is
+// started when the variable is missing or its value doesn't match the type or pattern.
+type EnvSchemaVar struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Optional allows the variable to be missing, a value that is set is still checked.
+	Optional bool `json:"optional,omitempty" yaml:"optional,omitempty" toml:"optional,omitempty"`
+	// Type is string (default), int, float, bool or url.
+	Type string `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	// Pattern is a regular expression the whole value must match.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty" toml:"pattern,omitempty"`
+}
+
+func (v *EnvSchemaVar) Validate(format string) error {
+	schemaField := GetFieldNameForFormat(TargetConfig{}, "EnvSchema", format)
+
+	if v.Name == "" {
+		return fmt.Errorf("%s: 'name' cannot be empty", schemaField)
+	}
+	switch v.Type {
+	case "", EnvSchemaTypeString, EnvSchemaTypeInt, EnvSchemaTypeFloat, EnvSchemaTypeBool, EnvSchemaTypeURL:
+	default:
+		return fmt.Errorf("%s: invalid type '%s' for '%s', must be one of %s, %s, %s, %s or %s",
+			schemaField, v.Type, v.Name, EnvSchemaTypeString, EnvSchemaTypeInt, EnvSchemaTypeFloat, EnvSchemaTypeBool, EnvSchemaTypeURL)
+	}
+	if v.Pattern != "" {
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			return fmt.Errorf("%s: invalid pattern for '%s': %w", schemaField, v.Name, err)
+		}
+	}
+	return nil
+}
+
+// CheckValue returns an error when value doesn't match the type or pattern of the variable.
+func (v *EnvSchemaVar) CheckValue(value string) error {
+	switch v.Type {
+	case EnvSchemaTypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("environment variable '%s' must be an integer", v.Name)
+		}
+	case EnvSchemaTypeFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("environment variable '%s' must be a number", v.Name)
+		}
+	case EnvSchemaTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("environment variable '%s' must be true or false", v.Name)
+		}
+	case EnvSchemaTypeURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("environment variable '%s' must be a URL with a scheme and host", v.Name)
+		}
+	}
+
+	if v.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + v.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern for environment variable '%s': %w", v.Name, err)
+		}
+		if !pattern.MatchString(value) {
+			// The value is left out of the message, it may be a secret.
+			return fmt.Errorf("environment variable '%s' doesn't match the pattern '%s'", v.Name, v.Pattern)
+		}
+	}
+	return nil
+}
+
+// validateEnvSchema checks the env list of an app against its schema. Values that are still references to
+// env vars or secret providers are only checked for presence, they're checked again once resolved,
+// e.g. by the server before it deploys.
+func validateEnvSchema(schema []EnvSchemaVar, env []EnvVar, format string) error {
+	values := make(map[string]ValueSource, len(env))
+	for _, envVar := range env {
+		values[envVar.Name] = envVar.ValueSource
+	}
+
+	seen := make(map[string]bool, len(schema))
+	for i := range schema {
+		schemaVar := &schema[i]
+		if err := schemaVar.Validate(format); err != nil {
+			return err
+		}
+		if seen[schemaVar.Name] {
+			return fmt.Errorf("%s: duplicate variable '%s'", GetFieldNameForFormat(TargetConfig{}, "EnvSchema", format), schemaVar.Name)
+		}
+		seen[schemaVar.Name] = true
+
+		valueSource, ok := values[schemaVar.Name]
+		if !ok {
+			if schemaVar.Optional {
+				continue
+			}
+			return fmt.Errorf("required environment variable '%s' is not set", schemaVar.Name)
+		}
+		if valueSource.From != nil {
+			continue
+		}
+		if valueSource.Value == "" {
+			if schemaVar.Optional {
+				continue
+			}
+			return fmt.Errorf("required environment variable '%s' is empty", schemaVar.Name)
+		}
+		if err := schemaVar.CheckValue(valueSource.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
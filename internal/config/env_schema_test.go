@@ -0,0 +1,126 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestValidateEnvSchema(t *testing.T) {
+	env := []EnvVar{
+		{Name: "DATABASE_URL", ValueSource: ValueSource{Value: "postgres://db:5432/app"}},
+		{Name: "WORKERS", ValueSource: ValueSource{Value: "4"}},
+		{Name: "DEBUG", ValueSource: ValueSource{Value: "yes"}},
+		{Name: "API_KEY", ValueSource: ValueSource{From: &SourceReference{Secret: "onepassword:api.key"}}},
+		{Name: "REGION", ValueSource: ValueSource{Value: "eu-west-1"}},
+	}
+
+	tests := []struct {
+		name        string
+		schema      []EnvSchemaVar
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name: "valid schema and values",
+			schema: []EnvSchemaVar{
+				{Name: "DATABASE_URL", Type: EnvSchemaTypeURL},
+				{Name: "WORKERS", Type: EnvSchemaTypeInt},
+				{Name: "REGION", Pattern: `[a-z]{2}-[a-z]+-\d`},
+				{Name: "SENTRY_DSN", Optional: true},
+			},
+			expectError: false,
+		},
+		{
+			name:        "unresolved secret is only checked for presence",
+			schema:      []EnvSchemaVar{{Name: "API_KEY", Type: EnvSchemaTypeInt}},
+			expectError: false,
+		},
+		{
+			name:        "missing required variable",
+			schema:      []EnvSchemaVar{{Name: "SENTRY_DSN"}},
+			expectError: true,
+			errMsg:      "required environment variable 'SENTRY_DSN' is not set",
+		},
+		{
+			name:        "invalid int",
+			schema:      []EnvSchemaVar{{Name: "REGION", Type: EnvSchemaTypeInt}},
+			expectError: true,
+			errMsg:      "environment variable 'REGION' must be an integer",
+		},
+		{
+			name:        "invalid bool",
+			schema:      []EnvSchemaVar{{Name: "DEBUG", Type: EnvSchemaTypeBool}},
+			expectError: true,
+			errMsg:      "environment variable 'DEBUG' must be true or false",
+		},
+		{
+			name:        "invalid url",
+			schema:      []EnvSchemaVar{{Name: "WORKERS", Type: EnvSchemaTypeURL}},
+			expectError: true,
+			errMsg:      "environment variable 'WORKERS' must be a URL",
+		},
+		{
+			name:        "pattern must match the whole value",
+			schema:      []EnvSchemaVar{{Name: "REGION", Pattern: `eu`}},
+			expectError: true,
+			errMsg:      "environment variable 'REGION' doesn't match the pattern 'eu'",
+		},
+		{
+			name:        "unknown type",
+			schema:      []EnvSchemaVar{{Name: "WORKERS", Type: "number"}},
+			expectError: true,
+			errMsg:      "env_schema: invalid type 'number' for 'WORKERS'",
+		},
+		{
+			name:        "invalid pattern",
+			schema:      []EnvSchemaVar{{Name: "REGION", Pattern: `[a-z`}},
+			expectError: true,
+			errMsg:      "env_schema: invalid pattern for 'REGION'",
+		},
+		{
+			name:        "missing name",
+			schema:      []EnvSchemaVar{{Type: EnvSchemaTypeInt}},
+			expectError: true,
+			errMsg:      "env_schema: 'name' cannot be empty",
+		},
+		{
+			name:        "duplicate variable",
+			schema:      []EnvSchemaVar{{Name: "WORKERS"}, {Name: "WORKERS"}},
+			expectError: true,
+			errMsg:      "env_schema: duplicate variable 'WORKERS'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnvSchema(tt.schema, env, "yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("validateEnvSchema() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("validateEnvSchema() error = %v, want error containing %v", err, tt.errMsg)
+				}
+			} else if err != nil {
+				t.Errorf("validateEnvSchema() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateEnvSchema_EmptyResolvedValue(t *testing.T) {
+	schema := []EnvSchemaVar{{Name: "API_KEY"}, {Name: "SENTRY_DSN", Optional: true, Type: EnvSchemaTypeURL}}
+	env := []EnvVar{
+		{Name: "API_KEY", ValueSource: ValueSource{Value: "key"}},
+		{Name: "SENTRY_DSN", ValueSource: ValueSource{}},
+	}
+	if err := validateEnvSchema(schema, env, "yaml"); err != nil {
+		t.Errorf("validateEnvSchema() unexpected error for empty optional variable = %v", err)
+	}
+
+	env[0].Value = ""
+	err := validateEnvSchema(schema, env, "yaml")
+	if err == nil || !helpers.Contains(err.Error(), "required environment variable 'API_KEY' is empty") {
+		t.Errorf("validateEnvSchema() error = %v, want empty required variable error", err)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	// EventPublisherNATS publishes events to a NATS server, the subject is the topic followed by the event type.
+	EventPublisherNATS = "nats"
+	// EventPublisherRedis publishes events to a Redis pub/sub channel, the channel is the topic followed by the
+	// event type.
+	EventPublisherRedis = "redis"
+	// EventPublisherKafka produces events to a Kafka topic through a Kafka REST proxy, e.g. the Confluent REST
+	// Proxy or the HTTP proxy of Redpanda.
+	EventPublisherKafka = "kafka"
+
+	DefaultEventPublisherTopic = "haloy.events"
+)
+
+// EventPublisher publishes server events to a message broker, so other systems can subscribe to deployments,
+// certificates and health changes without polling the API. Passwords are read from the environment of the haloyd
+// container, see EventPublisher.PasswordEnvVar.
+type EventPublisher struct {
+	// Type is nats, redis or kafka.
+	Type string `json:"type" yaml:"type" toml:"type"`
+	// URL is the broker: nats://host:4222 or tls://host:4222 for NATS, redis://host:6379/0 or rediss:// for Redis
+	// and the http(s) URL of the REST proxy for Kafka. A username can be set in the URL.
+	URL string `json:"url" yaml:"url" toml:"url"`
+	// Topic is the NATS subject prefix, the Redis channel prefix or the Kafka topic. Defaults to "haloy.events".
+	Topic string `json:"topic,omitempty" yaml:"topic,omitempty" toml:"topic,omitempty"`
+	// Events are event types or prefixes, e.g. "deployment". All events are published when empty.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty" toml:"events,omitempty"`
+	// Apps limits the publisher to the events of these apps, all events when empty. Certificate events belong
+	// to the app serving the domain.
+	Apps []string `json:"apps,omitempty" yaml:"apps,omitempty" toml:"apps,omitempty"`
+}
+
+// TopicName returns the topic, defaulting to DefaultEventPublisherTopic.
+func (p EventPublisher) TopicName() string {
+	if p.Topic == "" {
+		return DefaultEventPublisherTopic
+	}
+	return p.Topic
+}
+
+// PasswordEnvVar returns the environment variable holding the password of the broker, e.g. HALOY_NATS_PASSWORD.
+func (p EventPublisher) PasswordEnvVar() string {
+	return "HALOY_" + strings.ToUpper(p.Type) + "_PASSWORD"
+}
+
+func (p EventPublisher) Validate(index int) error {
+	var schemes []string
+	switch p.Type {
+	case EventPublisherNATS:
+		schemes = []string{"nats", "tls"}
+	case EventPublisherRedis:
+		schemes = []string{"redis", "rediss"}
+	case EventPublisherKafka:
+		schemes = []string{"http", "https"}
+	default:
+		return fmt.Errorf("event_publishers[%d]: invalid type '%s', must be %s, %s or %s",
+			index, p.Type, EventPublisherNATS, EventPublisherRedis, EventPublisherKafka)
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil || u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+		return fmt.Errorf("event_publishers[%d]: invalid url '%s', must start with %s://", index, p.URL, strings.Join(schemes, ":// or "))
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return fmt.Errorf("event_publishers[%d]: the url can't contain a password, set it in %s", index, p.PasswordEnvVar())
+	}
+	if p.Topic != "" && strings.ContainsAny(p.Topic, " \t\r\n*>") {
+		return fmt.Errorf("event_publishers[%d]: invalid topic '%s', can't contain spaces or wildcards", index, p.Topic)
+	}
+	for _, eventType := range p.Events {
+		if eventType == "" || strings.ContainsAny(eventType, " \t,") {
+			return fmt.Errorf("event_publishers[%d]: invalid event '%s', must be an event type like deployment.failed", index, eventType)
+		}
+	}
+	for _, app := range p.Apps {
+		if strings.TrimSpace(app) == "" {
+			return fmt.Errorf("event_publishers[%d]: apps cannot contain an empty name", index)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultExpiryAlertDays     = 14
+	DefaultExpiryAlertFailures = 3
+)
+
+// ExpiryAlert reports certificates whose renewal keeps failing as they get close to expiry, so external
+// alerting catches what the renewal loop can't fix on its own.
+type ExpiryAlert struct {
+	// Days is how close to expiry a certificate has to be to be reported. Defaults to 14.
+	Days int `json:"days,omitempty" yaml:"days,omitempty" toml:"days,omitempty"`
+	// Failures is the number of consecutive failed renewals before a certificate is reported. Defaults to 3.
+	Failures int `json:"failures,omitempty" yaml:"failures,omitempty" toml:"failures,omitempty"`
+	// Webhook receives the cert.expiring events as JSON in a POST request.
+	Webhook string `json:"webhook,omitempty" yaml:"webhook,omitempty" toml:"webhook,omitempty"`
+}
+
+func (a ExpiryAlert) Validate() error {
+	if a.Days < 0 {
+		return fmt.Errorf("certificates.expiry_alert: days must be positive, got %d", a.Days)
+	}
+	if a.Failures < 0 {
+		return fmt.Errorf("certificates.expiry_alert: failures must be positive, got %d", a.Failures)
+	}
+	if a.Webhook != "" {
+		u, err := url.Parse(a.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("certificates.expiry_alert: invalid webhook '%s', must be an http or https URL", a.Webhook)
+		}
+	}
+	return nil
+}
+
+// Threshold returns how close to expiry a certificate is reported.
+func (a ExpiryAlert) Threshold() time.Duration {
+	days := a.Days
+	if days == 0 {
+		days = DefaultExpiryAlertDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// FailureThreshold returns the number of consecutive failed renewals before a certificate is reported.
+func (a ExpiryAlert) FailureThreshold() int {
+	if a.Failures == 0 {
+		return DefaultExpiryAlertFailures
+	}
+	return a.Failures
+}
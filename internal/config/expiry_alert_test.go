@@ -0,0 +1,79 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestExpiryAlert_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		alert       ExpiryAlert
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:  "defaults",
+			alert: ExpiryAlert{},
+		},
+		{
+			name:  "with webhook",
+			alert: ExpiryAlert{Days: 7, Failures: 2, Webhook: "https://alerts.example.com/haloy"},
+		},
+		{
+			name:        "negative days",
+			alert:       ExpiryAlert{Days: -1},
+			expectError: true,
+			errMsg:      "days must be positive",
+		},
+		{
+			name:        "negative failures",
+			alert:       ExpiryAlert{Failures: -3},
+			expectError: true,
+			errMsg:      "failures must be positive",
+		},
+		{
+			name:        "webhook without scheme",
+			alert:       ExpiryAlert{Webhook: "alerts.example.com/haloy"},
+			expectError: true,
+			errMsg:      "invalid webhook",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.alert.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestExpiryAlert_Defaults(t *testing.T) {
+	alert := ExpiryAlert{}
+	if got := alert.Threshold(); got != DefaultExpiryAlertDays*24*time.Hour {
+		t.Errorf("Threshold() = %v, want %v", got, DefaultExpiryAlertDays*24*time.Hour)
+	}
+	if got := alert.FailureThreshold(); got != DefaultExpiryAlertFailures {
+		t.Errorf("FailureThreshold() = %d, want %d", got, DefaultExpiryAlertFailures)
+	}
+
+	alert = ExpiryAlert{Days: 5, Failures: 1}
+	if got := alert.Threshold(); got != 5*24*time.Hour {
+		t.Errorf("Threshold() = %v, want %v", got, 5*24*time.Hour)
+	}
+	if got := alert.FailureThreshold(); got != 1 {
+		t.Errorf("FailureThreshold() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+const (
+	// ExternalLBProviderCloudflare adds the server as an origin to Cloudflare Load Balancing pools.
+	ExternalLBProviderCloudflare = "cloudflare"
+	// ExternalLBProviderAWS registers the server as a target in AWS Application Load Balancer target groups.
+	ExternalLBProviderAWS = "aws"
+)
+
+var awsInstanceIDRegex = regexp.MustCompile(`^i-[0-9a-f]{8,17}$`)
+
+// ExternalLBConfig registers the server with an external load balancer when apps with an external_lb_target
+// are deployed, and deregisters it when they're removed. It's meant for setups where TLS terminates at
+// the load balancer, which then forwards plain HTTP to the proxy.
+// Credentials are read from the environment of the haloyd container.
+type ExternalLBConfig struct {
+	// Provider is cloudflare or aws. Registration is disabled when empty.
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty" toml:"provider,omitempty"`
+	// Address is what the load balancer connects to: the public IP or hostname of the server for Cloudflare,
+	// the private IP, or the instance ID for target groups of type instance, for AWS.
+	Address string `json:"address,omitempty" yaml:"address,omitempty" toml:"address,omitempty"`
+	// Port is the port the load balancer connects to. Defaults to the HTTP port of the proxy.
+	Port int `json:"port,omitempty" yaml:"port,omitempty" toml:"port,omitempty"`
+	// AccountID is the Cloudflare account the pools belong to.
+	AccountID string `json:"accountID,omitempty" yaml:"account_id,omitempty" toml:"account_id,omitempty"`
+}
+
+// Enabled reports whether a provider is configured.
+func (c ExternalLBConfig) Enabled() bool {
+	return c.Provider != ""
+}
+
+func (c ExternalLBConfig) Validate() error {
+	switch c.Provider {
+	case "":
+		return nil
+	case ExternalLBProviderCloudflare:
+		if c.AccountID == "" {
+			return fmt.Errorf("external_lb.account_id is required with the %s provider", c.Provider)
+		}
+	case ExternalLBProviderAWS:
+		if c.AccountID != "" {
+			return fmt.Errorf("external_lb.account_id is only used with the %s provider", ExternalLBProviderCloudflare)
+		}
+	default:
+		return fmt.Errorf("invalid external_lb.provider '%s', must be %s or %s", c.Provider, ExternalLBProviderCloudflare, ExternalLBProviderAWS)
+	}
+
+	if c.Address == "" {
+		return fmt.Errorf("external_lb.address is required")
+	}
+	if c.Provider == ExternalLBProviderAWS && net.ParseIP(c.Address) == nil && !awsInstanceIDRegex.MatchString(c.Address) {
+		return fmt.Errorf("invalid external_lb.address '%s', must be an IP address or EC2 instance ID", c.Address)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid external_lb.port %d, must be between 1 and 65535", c.Port)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestExternalLBConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		lb          ExternalLBConfig
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name: "disabled",
+			lb:   ExternalLBConfig{},
+		},
+		{
+			name: "cloudflare",
+			lb:   ExternalLBConfig{Provider: ExternalLBProviderCloudflare, Address: "203.0.113.10", AccountID: "023e105f4ecef8ad9ca31a8372d0c353"},
+		},
+		{
+			name: "aws with ip and port",
+			lb:   ExternalLBConfig{Provider: ExternalLBProviderAWS, Address: "10.0.1.15", Port: 8080},
+		},
+		{
+			name: "aws with instance id",
+			lb:   ExternalLBConfig{Provider: ExternalLBProviderAWS, Address: "i-0abcd1234ef567890"},
+		},
+		{
+			name:        "unknown provider",
+			lb:          ExternalLBConfig{Provider: "gcp", Address: "10.0.1.15"},
+			expectError: true,
+			errMsg:      "invalid external_lb.provider",
+		},
+		{
+			name:        "cloudflare without account",
+			lb:          ExternalLBConfig{Provider: ExternalLBProviderCloudflare, Address: "203.0.113.10"},
+			expectError: true,
+			errMsg:      "account_id is required",
+		},
+		{
+			name:        "missing address",
+			lb:          ExternalLBConfig{Provider: ExternalLBProviderAWS},
+			expectError: true,
+			errMsg:      "address is required",
+		},
+		{
+			name:        "aws with hostname",
+			lb:          ExternalLBConfig{Provider: ExternalLBProviderAWS, Address: "app.example.com"},
+			expectError: true,
+			errMsg:      "must be an IP address or EC2 instance ID",
+		},
+		{
+			name:        "invalid port",
+			lb:          ExternalLBConfig{Provider: ExternalLBProviderAWS, Address: "10.0.1.15", Port: 70000},
+			expectError: true,
+			errMsg:      "invalid external_lb.port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.lb.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
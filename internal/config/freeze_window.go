@@ -0,0 +1,274 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FreezeWindow is a period in which deployments are not allowed. It's either a cron expression for the
+// start of the window with a duration, or a weekly schedule of days with a start and end time.
+type FreezeWindow struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	// Cron is a five field expression (minute hour day-of-month month day-of-week) for the start of the window.
+	Cron string `json:"cron,omitempty" yaml:"cron,omitempty" toml:"cron,omitempty"`
+	// Duration is how long the window lasts after each start of Cron, e.g. "6h".
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty" toml:"duration,omitempty"`
+	// Days are the days of the week of a weekly window, e.g. ["fri", "sat", "sun"].
+	Days []string `json:"days,omitempty" yaml:"days,omitempty" toml:"days,omitempty"`
+	// Start and End are the times of day of a weekly window as "HH:MM". An end before the start spans midnight.
+	Start string `json:"start,omitempty" yaml:"start,omitempty" toml:"start,omitempty"`
+	End   string `json:"end,omitempty" yaml:"end,omitempty" toml:"end,omitempty"`
+	// Timezone is the IANA time zone of the schedule, e.g. "Europe/Oslo". Defaults to UTC.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty" toml:"timezone,omitempty"`
+}
+
+const (
+	FreezeActionReject = "reject"
+	FreezeActionQueue  = "queue"
+
+	// maxFreezeWindowDuration bounds how far back a window start is searched for.
+	maxFreezeWindowDuration = 7 * 24 * time.Hour
+)
+
+var weekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// DisplayName returns the name of the window, or its schedule when it has no name.
+func (w FreezeWindow) DisplayName() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	if w.Cron != "" {
+		return fmt.Sprintf("%s for %s", w.Cron, w.Duration)
+	}
+	return fmt.Sprintf("%s %s-%s", strings.Join(w.Days, ","), w.Start, w.End)
+}
+
+func (w FreezeWindow) Validate() error {
+	_, err := w.schedule()
+	return err
+}
+
+// Active reports whether t is inside the window and when the window ends.
+func (w FreezeWindow) Active(t time.Time) (time.Time, bool) {
+	schedule, err := w.schedule()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// The most recent start within the duration gives the latest end.
+	t = t.Truncate(time.Minute)
+	for start := t; t.Sub(start) < schedule.duration; start = start.Add(-time.Minute) {
+		if schedule.cron.matches(start.In(schedule.location)) {
+			return start.Add(schedule.duration), true
+		}
+	}
+	return time.Time{}, false
+}
+
+type freezeSchedule struct {
+	cron     cronSchedule
+	duration time.Duration
+	location *time.Location
+}
+
+// schedule converts the window to a cron schedule with a duration, weekly windows start at Start on each of Days.
+func (w FreezeWindow) schedule() (freezeSchedule, error) {
+	var schedule freezeSchedule
+
+	schedule.location = time.UTC
+	if w.Timezone != "" {
+		location, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return schedule, fmt.Errorf("freeze window '%s': invalid timezone '%s'", w.DisplayName(), w.Timezone)
+		}
+		schedule.location = location
+	}
+
+	expression := w.Cron
+	switch {
+	case w.Cron != "" && (len(w.Days) > 0 || w.Start != "" || w.End != ""):
+		return schedule, fmt.Errorf("freeze window '%s': use either cron and duration, or days, start and end", w.DisplayName())
+	case w.Cron != "":
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration <= 0 {
+			return schedule, fmt.Errorf("freeze window '%s': invalid duration '%s', e.g. \"6h\"", w.DisplayName(), w.Duration)
+		}
+		schedule.duration = duration
+	case len(w.Days) > 0:
+		for _, day := range w.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return schedule, fmt.Errorf("freeze window '%s': invalid day '%s', must be one of mon, tue, wed, thu, fri, sat or sun", w.DisplayName(), day)
+			}
+		}
+		start, err := parseTimeOfDay(w.Start)
+		if err != nil {
+			return schedule, fmt.Errorf("freeze window '%s': invalid start: %w", w.DisplayName(), err)
+		}
+		end, err := parseTimeOfDay(w.End)
+		if err != nil {
+			return schedule, fmt.Errorf("freeze window '%s': invalid end: %w", w.DisplayName(), err)
+		}
+		schedule.duration = end - start
+		if schedule.duration <= 0 {
+			schedule.duration += 24 * time.Hour
+		}
+		expression = fmt.Sprintf("%d %d * * %s", int(start.Minutes())%60, int(start.Hours()), strings.Join(w.Days, ","))
+	default:
+		return schedule, fmt.Errorf("freeze window '%s': cron or days is required", w.DisplayName())
+	}
+
+	if schedule.duration > maxFreezeWindowDuration {
+		return schedule, fmt.Errorf("freeze window '%s': duration can't be longer than 7 days", w.DisplayName())
+	}
+
+	cron, err := parseCron(expression)
+	if err != nil {
+		return schedule, fmt.Errorf("freeze window '%s': %w", w.DisplayName(), err)
+	}
+	schedule.cron = cron
+	return schedule, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time as HH:MM", value)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// cronSchedule holds the allowed values of each cron field as a bit set.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// Restricting both days follows cron: a time matches when either day field matches.
+	dayOfMonthAny, dayOfWeekAny bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7, names: weekdays},
+}
+
+func parseCron(expression string) (cronSchedule, error) {
+	var schedule cronSchedule
+
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return schedule, fmt.Errorf("invalid cron expression '%s', expected 5 fields: minute hour day-of-month month day-of-week", expression)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		parsed, err := cronFields[i].parse(field)
+		if err != nil {
+			return schedule, fmt.Errorf("invalid cron expression '%s': %w", expression, err)
+		}
+		bits[i] = parsed
+	}
+
+	// Sunday is both 0 and 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	schedule.minute, schedule.hour, schedule.dayOfMonth, schedule.month, schedule.dayOfWeek = bits[0], bits[1], bits[2], bits[3], bits[4]
+	schedule.dayOfMonthAny = fields[2] == "*"
+	schedule.dayOfWeekAny = fields[4] == "*"
+	return schedule, nil
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step '%s' in %s", stepPart, f.name)
+			}
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = f.value(lowPart); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(highPart); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid range '%s' in %s", rangePart, f.name)
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(value string) (int, error) {
+	if number, ok := f.names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < f.min || number > f.max {
+		return 0, fmt.Errorf("invalid %s '%s', must be between %d and %d", f.name, value, f.min, f.max)
+	}
+	return number, nil
+}
+
+func (s cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := s.dayOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := s.dayOfWeek&(1<<int(t.Weekday())) != 0
+	if s.dayOfMonthAny || s.dayOfWeekAny {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// ActiveFreeze returns the freeze window t is in and when deployments are allowed again,
+// which is after the end of any windows that overlap it.
+func (d DeployConfig) ActiveFreeze(t time.Time) (FreezeWindow, time.Time, bool) {
+	var active FreezeWindow
+	until := t
+	frozen := false
+	for range 100 {
+		extended := false
+		for _, window := range d.FreezeWindows {
+			if end, ok := window.Active(until); ok && end.After(until) {
+				if !frozen {
+					active = window
+				}
+				frozen, extended, until = true, true, end
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return active, until, frozen
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFreezeWindow_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  FreezeWindow
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:   "valid cron window",
+			window: FreezeWindow{Cron: "0 18 * * fri", Duration: "62h"},
+		},
+		{
+			name:   "valid weekly window",
+			window: FreezeWindow{Days: []string{"sat", "sun"}, Start: "00:00", End: "00:00", Timezone: "Europe/Oslo"},
+		},
+		{
+			name:    "cron without duration",
+			window:  FreezeWindow{Cron: "0 18 * * fri"},
+			wantErr: true,
+			errMsg:  "invalid duration",
+		},
+		{
+			name:    "cron with days",
+			window:  FreezeWindow{Cron: "0 18 * * fri", Duration: "1h", Days: []string{"mon"}},
+			wantErr: true,
+			errMsg:  "use either cron and duration",
+		},
+		{
+			name:    "invalid cron field count",
+			window:  FreezeWindow{Cron: "0 18 * *", Duration: "1h"},
+			wantErr: true,
+			errMsg:  "expected 5 fields",
+		},
+		{
+			name:    "cron value out of range",
+			window:  FreezeWindow{Cron: "0 24 * * *", Duration: "1h"},
+			wantErr: true,
+			errMsg:  "invalid hour '24'",
+		},
+		{
+			name:    "invalid day",
+			window:  FreezeWindow{Days: []string{"friday"}, Start: "18:00", End: "23:00"},
+			wantErr: true,
+			errMsg:  "invalid day 'friday'",
+		},
+		{
+			name:    "invalid start time",
+			window:  FreezeWindow{Days: []string{"fri"}, Start: "6pm", End: "23:00"},
+			wantErr: true,
+			errMsg:  "invalid start",
+		},
+		{
+			name:    "invalid timezone",
+			window:  FreezeWindow{Days: []string{"fri"}, Start: "18:00", End: "23:00", Timezone: "Mars/Olympus"},
+			wantErr: true,
+			errMsg:  "invalid timezone",
+		},
+		{
+			name:    "duration longer than a week",
+			window:  FreezeWindow{Cron: "0 0 1 * *", Duration: "200h"},
+			wantErr: true,
+			errMsg:  "can't be longer than 7 days",
+		},
+		{
+			name:    "no schedule",
+			window:  FreezeWindow{Name: "empty"},
+			wantErr: true,
+			errMsg:  "cron or days is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.window.Validate()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Validate() expected error containing %q, got nil", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %q, want it to contain %q", err.Error(), tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Validate() unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFreezeWindow_Active(t *testing.T) {
+	// 2026-01-02 is a Friday.
+	friday := func(hour, minute int) time.Time {
+		return time.Date(2026, 1, 2, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		window     FreezeWindow
+		at         time.Time
+		wantActive bool
+		wantEnd    time.Time
+	}{
+		{
+			name:       "inside cron window",
+			window:     FreezeWindow{Cron: "0 18 * * fri", Duration: "6h"},
+			at:         friday(20, 30),
+			wantActive: true,
+			wantEnd:    friday(24, 0),
+		},
+		{
+			name:       "at start of cron window",
+			window:     FreezeWindow{Cron: "0 18 * * fri", Duration: "6h"},
+			at:         friday(18, 0),
+			wantActive: true,
+			wantEnd:    friday(24, 0),
+		},
+		{
+			name:   "at end of cron window",
+			window: FreezeWindow{Cron: "0 18 * * fri", Duration: "6h"},
+			at:     friday(24, 0),
+		},
+		{
+			name:   "before cron window",
+			window: FreezeWindow{Cron: "0 18 * * fri", Duration: "6h"},
+			at:     friday(17, 59),
+		},
+		{
+			name:       "weekly window spanning midnight",
+			window:     FreezeWindow{Days: []string{"thu"}, Start: "22:00", End: "02:00"},
+			at:         friday(1, 0),
+			wantActive: true,
+			wantEnd:    friday(2, 0),
+		},
+		{
+			name:   "weekly window on another day",
+			window: FreezeWindow{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00"},
+			at:     friday(12, 0),
+		},
+		{
+			name:       "weekly window in time zone",
+			window:     FreezeWindow{Days: []string{"fri"}, Start: "09:00", End: "17:00", Timezone: "America/New_York"},
+			at:         friday(15, 0), // 10:00 in New York
+			wantActive: true,
+			wantEnd:    friday(22, 0),
+		},
+		{
+			name:       "cron step and list",
+			window:     FreezeWindow{Cron: "*/15 9,12 * * *", Duration: "5m"},
+			at:         friday(12, 47),
+			wantActive: true,
+			wantEnd:    friday(12, 50),
+		},
+		{
+			name:       "day of month or day of week",
+			window:     FreezeWindow{Cron: "0 0 15 * fri", Duration: "24h"},
+			at:         friday(12, 0),
+			wantActive: true,
+			wantEnd:    friday(24, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, active := tt.window.Active(tt.at)
+			if active != tt.wantActive {
+				t.Fatalf("Active() active = %v, want %v", active, tt.wantActive)
+			}
+			if active && !end.Equal(tt.wantEnd) {
+				t.Errorf("Active() end = %v, want %v", end, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestDeployConfig_ActiveFreeze(t *testing.T) {
+	deployConfig := DeployConfig{FreezeWindows: []FreezeWindow{
+		{Name: "evening", Cron: "0 18 * * *", Duration: "4h"},
+		{Name: "night", Cron: "0 22 * * *", Duration: "8h"},
+	}}
+	at := time.Date(2026, 1, 2, 19, 0, 0, 0, time.UTC)
+
+	window, until, frozen := deployConfig.ActiveFreeze(at)
+	if !frozen {
+		t.Fatal("ActiveFreeze() frozen = false, want true")
+	}
+	if window.Name != "evening" {
+		t.Errorf("ActiveFreeze() window = %q, want %q", window.Name, "evening")
+	}
+	// The night window starts when the evening window ends, so deploys are allowed after both.
+	if want := time.Date(2026, 1, 3, 6, 0, 0, 0, time.UTC); !until.Equal(want) {
+		t.Errorf("ActiveFreeze() until = %v, want %v", until, want)
+	}
+
+	if _, _, frozen := deployConfig.ActiveFreeze(time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC)); frozen {
+		t.Error("ActiveFreeze() frozen = true outside the windows, want false")
+	}
+}
@@ -3,8 +3,15 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/helpers"
@@ -14,17 +21,405 @@ import (
 )
 
 type HaloydConfig struct {
-	API struct {
-		Domain string `json:"domain" yaml:"domain" toml:"domain"`
-	} `json:"api" yaml:"api" toml:"api"`
-	Certificates struct {
-		AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-	} `json:"certificates" yaml:"certificates" toml:"certificates"`
+	API           APIConfig           `json:"api" yaml:"api" toml:"api"`
+	Certificates  CertificatesConfig  `json:"certificates" yaml:"certificates" toml:"certificates"`
+	Logging       HaloydLogging       `json:"logging,omitempty" yaml:"logging,omitempty" toml:"logging,omitempty"`
+	Tracing       HaloydTracing       `json:"tracing,omitempty" yaml:"tracing,omitempty" toml:"tracing,omitempty"`
+	Proxy         ProxyConfig         `json:"proxy,omitempty" yaml:"proxy,omitempty" toml:"proxy,omitempty"`
+	Deploy        DeployConfig        `json:"deploy,omitempty" yaml:"deploy,omitempty" toml:"deploy,omitempty"`
+	Database      DatabaseConfig      `json:"database,omitempty" yaml:"database,omitempty" toml:"database,omitempty"`
+	ExternalLB    ExternalLBConfig    `json:"externalLB,omitempty" yaml:"external_lb,omitempty" toml:"external_lb,omitempty"`
+	Notifications NotificationsConfig `json:"notifications,omitempty" yaml:"notifications,omitempty" toml:"notifications,omitempty"`
+	// EventPublishers publish server events to NATS, Redis or Kafka.
+	EventPublishers []EventPublisher `json:"eventPublishers,omitempty" yaml:"event_publishers,omitempty" toml:"event_publishers,omitempty"`
+}
+
+type APIConfig struct {
+	Domain string `json:"domain" yaml:"domain" toml:"domain"`
+	// Dashboard serves a web UI on /dashboard/. All data is loaded through the token protected API.
+	Dashboard bool `json:"dashboard,omitempty" yaml:"dashboard,omitempty" toml:"dashboard,omitempty"`
+	// Registry serves an OCI image registry on /v2/ of the API domain, authenticated with the API token.
+	Registry bool `json:"registry,omitempty" yaml:"registry,omitempty" toml:"registry,omitempty"`
+	// RateLimit limits the requests per client IP and token, and locks out clients after failed authentications.
+	RateLimit APIRateLimit `json:"rateLimit,omitempty" yaml:"rate_limit,omitempty" toml:"rate_limit,omitempty"`
+	// CORSOrigins are the origins of web UIs hosted elsewhere that may call the API from a browser, or "*".
+	CORSOrigins []string `json:"corsOrigins,omitempty" yaml:"cors_origins,omitempty" toml:"cors_origins,omitempty"`
+	// TrustedProxies are the addresses or CIDR ranges of proxies in front of HAProxy, e.g. a CDN. The client IP
+	// is read from X-Forwarded-For past them.
+	TrustedProxies []string `json:"trustedProxies,omitempty" yaml:"trusted_proxies,omitempty" toml:"trusted_proxies,omitempty"`
+	// AppTokens are additional tokens restricted to some apps, created with 'haloyadm api app-token add'.
+	AppTokens []AppToken `json:"appTokens,omitempty" yaml:"app_tokens,omitempty" toml:"app_tokens,omitempty"`
+	// Protection requires a second token to confirm rollbacks and container removals of protected apps.
+	Protection APIProtection `json:"protection,omitempty" yaml:"protection,omitempty" toml:"protection,omitempty"`
+	// OIDC accepts the ID tokens of an OpenID Connect provider, for single sign-on to the dashboard and the CLI.
+	OIDC APIOIDC `json:"oidc,omitempty" yaml:"oidc,omitempty" toml:"oidc,omitempty"`
+}
+
+type CertificatesConfig struct {
+	AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
+	// StagingPrecheck validates new domains against the Let's Encrypt staging CA
+	// before requesting a production certificate, to avoid hitting production rate limits.
+	StagingPrecheck bool `json:"stagingPrecheck,omitempty" yaml:"staging_precheck,omitempty" toml:"staging_precheck,omitempty"`
+	// Staging requests all certificates from the Let's Encrypt staging CA. Browsers don't trust them,
+	// it's for testing certificate issuance without using up production rate limits.
+	Staging bool `json:"staging,omitempty" yaml:"staging,omitempty" toml:"staging,omitempty"`
+	// RenewalWindow limits renewals of expiring certificates, and the HAProxy reloads they cause, to a time of day.
+	RenewalWindow *RenewalWindow `json:"renewalWindow,omitempty" yaml:"renewal_window,omitempty" toml:"renewal_window,omitempty"`
+	// DNSProvider enables DNS-01 validation for domains that fail HTTP-01 validation, e.g. domains behind a CDN.
+	// Credentials are read from the environment of the haloyd container.
+	DNSProvider string `json:"dnsProvider,omitempty" yaml:"dns_provider,omitempty" toml:"dns_provider,omitempty"`
+	// ExpiryAlert reports certificates that keep failing to renew as they get close to expiry.
+	ExpiryAlert ExpiryAlert `json:"expiryAlert,omitempty" yaml:"expiry_alert,omitempty" toml:"expiry_alert,omitempty"`
+	// DualCertificates issues an ECDSA and an RSA certificate for every domain. Modern clients get the faster
+	// ECDSA certificate, old clients without ECDSA support the RSA certificate.
+	DualCertificates bool `json:"dualCertificates,omitempty" yaml:"dual_certificates,omitempty" toml:"dual_certificates,omitempty"`
+	// KeyType is the key algorithm and size of certificates: ec256, ec384, rsa2048 (default) or rsa4096.
+	// Domains can override it with key_type in the app config.
+	KeyType string `json:"keyType,omitempty" yaml:"key_type,omitempty" toml:"key_type,omitempty"`
+	// Store is where certificates are persisted: "file" (default) or "database", which keeps them in the haloyd
+	// database and writes them to the certificate directory for HAProxy. Changes take effect when haloyd restarts.
+	Store string `json:"store,omitempty" yaml:"store,omitempty" toml:"store,omitempty"`
+}
+
+// validateCaddy rejects the settings of the certificates haloyd obtains. With the caddy backend Caddy obtains
+// the certificates with its own ACME client, so they would be ignored.
+func (c CertificatesConfig) validateCaddy() error {
+	unsupported := func(setting string) error {
+		return fmt.Errorf("certificates.%s is not supported with the caddy backend, Caddy obtains the certificates", setting)
+	}
+	switch {
+	case c.StagingPrecheck:
+		return unsupported("staging_precheck")
+	case c.RenewalWindow != nil:
+		return unsupported("renewal_window")
+	case c.DNSProvider != "":
+		return unsupported("dns_provider")
+	case c.DualCertificates:
+		return unsupported("dual_certificates")
+	case c.KeyType != "":
+		return unsupported("key_type")
+	case c.Store == CertStoreDatabase:
+		return unsupported("store")
+	}
+	return nil
+}
+
+// Certificate stores, see CertificatesConfig.Store.
+const (
+	CertStoreFile     = "file"
+	CertStoreDatabase = "database"
+)
+
+// DNSProviderCloudflare validates domains with TXT records created through the Cloudflare API.
+const DNSProviderCloudflare = "cloudflare"
+
+// DatabaseConfig controls how haloyd handles schema upgrades of its database.
+type DatabaseConfig struct {
+	// ManualMigrations stops haloyd from migrating the database at startup. haloyd refuses to start
+	// until pending migrations are applied with 'haloyadm db migrate'.
+	ManualMigrations bool `json:"manualMigrations,omitempty" yaml:"manual_migrations,omitempty" toml:"manual_migrations,omitempty"`
+}
+
+// DeployConfig restricts when apps can be deployed.
+type DeployConfig struct {
+	// FreezeWindows are periods in which deploy requests are rejected or queued, see FreezeAction.
+	FreezeWindows []FreezeWindow `json:"freezeWindows,omitempty" yaml:"freeze_windows,omitempty" toml:"freeze_windows,omitempty"`
+	// FreezeAction is "reject" (default) or "queue", which starts the deployment when the window ends.
+	FreezeAction string `json:"freezeAction,omitempty" yaml:"freeze_action,omitempty" toml:"freeze_action,omitempty"`
+}
+
+func (d DeployConfig) Validate() error {
+	switch d.FreezeAction {
+	case "", FreezeActionReject, FreezeActionQueue:
+	default:
+		return fmt.Errorf("invalid deploy freezeAction '%s', must be '%s' or '%s'", d.FreezeAction, FreezeActionReject, FreezeActionQueue)
+	}
+
+	for _, window := range d.FreezeWindows {
+		if err := window.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HaloydLogging configures the logs of haloyd itself, not the logs of the deployed apps.
+type HaloydLogging struct {
+	// Format is "text" (default) or "json".
+	Format string `json:"format,omitempty" yaml:"format,omitempty" toml:"format,omitempty"`
+	// Level is the minimum level logged: debug, info (default), warn or error.
+	Level string `json:"level,omitempty" yaml:"level,omitempty" toml:"level,omitempty"`
+	// File also writes the logs to logs/haloyd.log in the data directory.
+	File bool `json:"file,omitempty" yaml:"file,omitempty" toml:"file,omitempty"`
+	// MaxSize is the size in megabytes at which the log file is rotated.
+	MaxSize int `json:"maxSize,omitempty" yaml:"max_size,omitempty" toml:"max_size,omitempty"`
+	// MaxAge is the number of days rotated log files are kept.
+	MaxAge int `json:"maxAge,omitempty" yaml:"max_age,omitempty" toml:"max_age,omitempty"`
+	// DeploymentLogsMaxAge is the number of days the logs of deployments are kept in the database
+	// for 'haloy logs --deployment'.
+	DeploymentLogsMaxAge int `json:"deploymentLogsMaxAge,omitempty" yaml:"deployment_logs_max_age,omitempty" toml:"deployment_logs_max_age,omitempty"`
+}
+
+const (
+	HaloydLogFormatText = "text"
+	HaloydLogFormatJSON = "json"
+
+	DefaultHaloydLogMaxSize = 50 // megabytes
+	DefaultHaloydLogMaxAge  = 14 // days
+
+	DefaultDeploymentLogsMaxAge = 30 // days
+)
+
+var haloydLogLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// SlogLevel returns the configured log level, defaulting to info.
+func (l HaloydLogging) SlogLevel() slog.Level {
+	if level, ok := haloydLogLevels[strings.ToLower(l.Level)]; ok {
+		return level
+	}
+	return slog.LevelInfo
+}
+
+// DeploymentLogsRetention returns how long deployment logs are kept, defaulting to DefaultDeploymentLogsMaxAge days.
+func (l HaloydLogging) DeploymentLogsRetention() time.Duration {
+	days := l.DeploymentLogsMaxAge
+	if days == 0 {
+		days = DefaultDeploymentLogsMaxAge
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (l HaloydLogging) Validate() error {
+	switch l.Format {
+	case "", HaloydLogFormatText, HaloydLogFormatJSON:
+	default:
+		return fmt.Errorf("invalid logging format '%s', must be '%s' or '%s'", l.Format, HaloydLogFormatText, HaloydLogFormatJSON)
+	}
+
+	if l.Level != "" {
+		if _, ok := haloydLogLevels[strings.ToLower(l.Level)]; !ok {
+			return fmt.Errorf("invalid logging level '%s', must be one of debug, info, warn or error", l.Level)
+		}
+	}
+
+	if l.MaxSize < 0 {
+		return fmt.Errorf("logging maxSize must be positive, got %d", l.MaxSize)
+	}
+	if l.MaxAge < 0 {
+		return fmt.Errorf("logging maxAge must be positive, got %d", l.MaxAge)
+	}
+	if l.DeploymentLogsMaxAge < 0 {
+		return fmt.Errorf("logging deploymentLogsMaxAge must be positive, got %d", l.DeploymentLogsMaxAge)
+	}
+
+	return nil
+}
+
+// HaloydTracing configures export of deployment traces to an OpenTelemetry collector.
+type HaloydTracing struct {
+	// Endpoint is the OTLP/HTTP endpoint URL, e.g. "http://otel-collector:4318". Tracing is disabled when empty.
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty" toml:"endpoint,omitempty"`
+	// Headers are sent with every export request, e.g. for authentication with a hosted collector.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" toml:"headers,omitempty"`
+	// SampleRatio is the fraction of traces recorded, between 0 and 1. Defaults to 1.
+	SampleRatio *float64 `json:"sampleRatio,omitempty" yaml:"sample_ratio,omitempty" toml:"sample_ratio,omitempty"`
+}
+
+func (t HaloydTracing) Validate() error {
+	if t.Endpoint != "" {
+		u, err := url.Parse(t.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid tracing endpoint '%s', must be an http or https URL", t.Endpoint)
+		}
+	}
+
+	if t.SampleRatio != nil && (*t.SampleRatio < 0 || *t.SampleRatio > 1) {
+		return fmt.Errorf("tracing sampleRatio must be between 0 and 1, got %g", *t.SampleRatio)
+	}
+
+	return nil
+}
+
+// ProxyConfig configures the ports HAProxy listens on.
+type ProxyConfig struct {
+	// Backend is the reverse proxy that routes traffic to the apps: haproxy (default) or caddy.
+	// Caddy obtains the certificates itself and doesn't support frontends, the internal port or the stats page.
+	Backend string `json:"backend,omitempty" yaml:"backend,omitempty" toml:"backend,omitempty"`
+	// HTTPPort is the public port for plain HTTP. Defaults to 80.
+	// Let's Encrypt HTTP-01 validation still needs port 80 on the server to reach it.
+	HTTPPort int `json:"httpPort,omitempty" yaml:"http_port,omitempty" toml:"http_port,omitempty"`
+	// HTTPSPort is the public port for HTTPS. Defaults to 443.
+	HTTPSPort int `json:"httpsPort,omitempty" yaml:"https_port,omitempty" toml:"https_port,omitempty"`
+	// Frontends are additional ports, only apps that select a frontend by name are served on it.
+	Frontends []ProxyFrontend `json:"frontends,omitempty" yaml:"frontends,omitempty" toml:"frontends,omitempty"`
+	// InternalPort enables a frontend for internal apps that is only reachable on the haloy network.
+	// Requests are routed by the app name in the Host header or the first path segment.
+	InternalPort int `json:"internalPort,omitempty" yaml:"internal_port,omitempty" toml:"internal_port,omitempty"`
+	// Stats serves the HAProxy stats page on /v1/haproxy/stats of the API, authenticated with the API token.
+	Stats bool `json:"stats,omitempty" yaml:"stats,omitempty" toml:"stats,omitempty"`
+	// Routing is how HAProxy routes domains to apps: "map" (default) looks them up in map files that haloyd
+	// updates through the HAProxy runtime API without reloading, "acl" generates ACL rules per domain in haproxy.cfg
+	// like earlier versions did. Additional frontends and the internal port always use ACL rules.
+	Routing string `json:"routing,omitempty" yaml:"routing,omitempty" toml:"routing,omitempty"`
+}
+
+// ProxyFrontend is an additional HAProxy frontend, e.g. a separate port for admin apps.
+type ProxyFrontend struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	Port int    `json:"port" yaml:"port" toml:"port"`
+	// Address is the host IP the port is published on, e.g. a private or VPN address. Defaults to all addresses.
+	Address string `json:"address,omitempty" yaml:"address,omitempty" toml:"address,omitempty"`
+	// TLS terminates TLS with the certificates of the apps' domains.
+	TLS bool `json:"tls,omitempty" yaml:"tls,omitempty" toml:"tls,omitempty"`
+}
+
+const (
+	ProxyBackendHAProxy = "haproxy"
+	ProxyBackendCaddy   = "caddy"
+
+	ProxyRoutingMap = "map"
+	ProxyRoutingACL = "acl"
+
+	DefaultProxyHTTPPort  = 80
+	DefaultProxyHTTPSPort = 443
+
+	// ProxyInternalFrontendName is the HAProxy frontend of the internal port.
+	ProxyInternalFrontendName = "internal"
+	// ProxyStatsFrontendName is the HAProxy frontend of the stats page.
+	ProxyStatsFrontendName = "stats"
+	// ProxyShadowFrontendName is the HAProxy frontend that receives mirrored requests of apps with shadow_to.
+	ProxyShadowFrontendName = "shadow"
+)
+
+// Frontend names used by haloy in the HAProxy config.
+var reservedProxyFrontendNames = []string{"http-in", "https-in", ProxyInternalFrontendName, ProxyStatsFrontendName, ProxyShadowFrontendName}
+
+var proxyFrontendNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Frontend returns the additional frontend with the given name.
+func (p ProxyConfig) Frontend(name string) (ProxyFrontend, bool) {
+	for _, frontend := range p.Frontends {
+		if frontend.Name == name {
+			return frontend, true
+		}
+	}
+	return ProxyFrontend{}, false
+}
+
+// UsesMapRouting reports whether domains are routed with map files, the default, instead of ACL rules.
+func (p ProxyConfig) UsesMapRouting() bool {
+	return p.Routing != ProxyRoutingACL
+}
+
+func (p ProxyConfig) Validate() error {
+	switch p.Backend {
+	case "", ProxyBackendHAProxy:
+	case ProxyBackendCaddy:
+		switch {
+		case len(p.Frontends) > 0:
+			return fmt.Errorf("proxy.frontends is not supported with the caddy backend")
+		case p.InternalPort != 0:
+			return fmt.Errorf("proxy.internalPort is not supported with the caddy backend")
+		case p.Stats:
+			return fmt.Errorf("proxy.stats is not supported with the caddy backend")
+		}
+	default:
+		return fmt.Errorf("invalid proxy.backend '%s', must be %s or %s", p.Backend, ProxyBackendHAProxy, ProxyBackendCaddy)
+	}
+
+	switch p.Routing {
+	case "", ProxyRoutingMap, ProxyRoutingACL:
+	default:
+		return fmt.Errorf("invalid proxy.routing '%s', must be %s or %s", p.Routing, ProxyRoutingMap, ProxyRoutingACL)
+	}
+
+	ports := make(map[int]string)
+	checkPort := func(port int, owner string) error {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d for %s, must be between 1 and 65535", port, owner)
+		}
+		if other, ok := ports[port]; ok {
+			return fmt.Errorf("port %d is used by both %s and %s", port, other, owner)
+		}
+		ports[port] = owner
+		return nil
+	}
+
+	// Unset ports use the defaults, which frontends can't take either.
+	httpPort, httpsPort := p.HTTPPort, p.HTTPSPort
+	if httpPort == 0 {
+		httpPort = DefaultProxyHTTPPort
+	}
+	if httpsPort == 0 {
+		httpsPort = DefaultProxyHTTPSPort
+	}
+	if err := checkPort(httpPort, "proxy.httpPort"); err != nil {
+		return err
+	}
+	if err := checkPort(httpsPort, "proxy.httpsPort"); err != nil {
+		return err
+	}
+	if p.InternalPort != 0 {
+		if err := checkPort(p.InternalPort, "proxy.internalPort"); err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]struct{})
+	for i, frontend := range p.Frontends {
+		if !proxyFrontendNameRegex.MatchString(frontend.Name) {
+			return fmt.Errorf("proxy.frontends[%d]: invalid name '%s', must be lowercase letters, digits, '-' or '_'", i, frontend.Name)
+		}
+		if slices.Contains(reservedProxyFrontendNames, frontend.Name) {
+			return fmt.Errorf("proxy.frontends[%d]: name '%s' is reserved", i, frontend.Name)
+		}
+		if _, ok := names[frontend.Name]; ok {
+			return fmt.Errorf("proxy.frontends[%d]: duplicate name '%s'", i, frontend.Name)
+		}
+		names[frontend.Name] = struct{}{}
+
+		if err := checkPort(frontend.Port, fmt.Sprintf("proxy frontend '%s'", frontend.Name)); err != nil {
+			return err
+		}
+		if frontend.Address != "" && net.ParseIP(frontend.Address) == nil {
+			return fmt.Errorf("proxy.frontends[%d]: invalid address '%s', must be an IP address", i, frontend.Address)
+		}
+	}
+
+	return nil
 }
 
 // Normalize sets default values for HaloydConfig
 func (mc *HaloydConfig) Normalize() *HaloydConfig {
-	// Add any defaults if needed in the future
+	if mc.Proxy.Backend == "" {
+		mc.Proxy.Backend = ProxyBackendHAProxy
+	}
+	if mc.Proxy.Routing == "" {
+		mc.Proxy.Routing = ProxyRoutingMap
+	}
+	if mc.Proxy.HTTPPort == 0 {
+		mc.Proxy.HTTPPort = DefaultProxyHTTPPort
+	}
+	if mc.Proxy.HTTPSPort == 0 {
+		mc.Proxy.HTTPSPort = DefaultProxyHTTPSPort
+	}
+	if mc.ExternalLB.Enabled() && mc.ExternalLB.Port == 0 {
+		mc.ExternalLB.Port = mc.Proxy.HTTPPort
+	}
+	if mc.Logging.File {
+		if mc.Logging.MaxSize == 0 {
+			mc.Logging.MaxSize = DefaultHaloydLogMaxSize
+		}
+		if mc.Logging.MaxAge == 0 {
+			mc.Logging.MaxAge = DefaultHaloydLogMaxAge
+		}
+	}
 	return mc
 }
 
@@ -43,6 +438,96 @@ func (mc *HaloydConfig) Validate() error {
 		return fmt.Errorf("acmeEmail is required when domain is specified")
 	}
 
+	if mc.API.Registry && mc.API.Domain == "" {
+		return fmt.Errorf("api.registry requires api.domain, images are pushed to <domain>/<repository>")
+	}
+
+	if err := mc.API.validateAccess(); err != nil {
+		return err
+	}
+
+	if err := validateAppTokens(mc.API.AppTokens); err != nil {
+		return err
+	}
+
+	if err := mc.API.RateLimit.Validate(); err != nil {
+		return err
+	}
+
+	if err := mc.API.Protection.Validate(); err != nil {
+		return err
+	}
+
+	if err := mc.API.OIDC.Validate(); err != nil {
+		return err
+	}
+
+	if mc.API.OIDC.Enabled() && mc.API.Domain == "" {
+		return fmt.Errorf("api.oidc requires api.domain, the provider redirects to https://<domain>/v1/oidc/callback")
+	}
+
+	if mc.Certificates.RenewalWindow != nil {
+		if err := mc.Certificates.RenewalWindow.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := mc.Certificates.ExpiryAlert.Validate(); err != nil {
+		return err
+	}
+
+	if err := ValidateKeyType(mc.Certificates.KeyType); err != nil {
+		return fmt.Errorf("certificates.key_type: %w", err)
+	}
+
+	switch mc.Certificates.DNSProvider {
+	case "", DNSProviderCloudflare:
+	default:
+		return fmt.Errorf("invalid certificates.dns_provider '%s', supported providers: %s", mc.Certificates.DNSProvider, DNSProviderCloudflare)
+	}
+
+	switch mc.Certificates.Store {
+	case "", CertStoreFile, CertStoreDatabase:
+	default:
+		return fmt.Errorf("invalid certificates.store '%s', must be '%s' or '%s'", mc.Certificates.Store, CertStoreFile, CertStoreDatabase)
+	}
+
+	if err := mc.Logging.Validate(); err != nil {
+		return err
+	}
+
+	if err := mc.Tracing.Validate(); err != nil {
+		return err
+	}
+
+	if err := mc.Proxy.Validate(); err != nil {
+		return err
+	}
+
+	if mc.Proxy.Backend == ProxyBackendCaddy {
+		if err := mc.Certificates.validateCaddy(); err != nil {
+			return err
+		}
+	}
+
+	if err := mc.Deploy.Validate(); err != nil {
+		return err
+	}
+
+	if err := mc.ExternalLB.Validate(); err != nil {
+		return err
+	}
+
+	if err := mc.Notifications.Validate(); err != nil {
+		return err
+	}
+
+	for i, publisher := range mc.EventPublishers {
+		if err := publisher.Validate(i); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ameistad/haloy/internal/helpers"
 )
@@ -23,33 +25,77 @@ func TestHaloydConfig_Validate(t *testing.T) {
 		{
 			name: "valid config with domain and email",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				API:          APIConfig{Domain: "api.example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid config with registry",
+			config: HaloydConfig{
+				API:          APIConfig{Domain: "api.example.com", Registry: true},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "registry without domain",
+			config: HaloydConfig{
+				API: APIConfig{Registry: true},
+			},
+			wantErr: true,
+			errMsg:  "api.registry requires api.domain",
+		},
+		{
+			name: "valid config with dns provider",
+			config: HaloydConfig{
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com", DNSProvider: DNSProviderCloudflare},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported dns provider",
+			config: HaloydConfig{
+				Certificates: CertificatesConfig{DNSProvider: "route53"},
+			},
+			wantErr: true,
+			errMsg:  "invalid certificates.dns_provider 'route53'",
+		},
+		{
+			name: "database certificate store",
+			config: HaloydConfig{
+				Certificates: CertificatesConfig{Store: CertStoreDatabase},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported certificate store",
+			config: HaloydConfig{
+				Certificates: CertificatesConfig{Store: "s3"},
+			},
+			wantErr: true,
+			errMsg:  "invalid certificates.store 's3'",
+		},
+		{
+			name: "invalid key type",
+			config: HaloydConfig{
+				Certificates: CertificatesConfig{KeyType: "rsa1024"},
+			},
+			wantErr: true,
+			errMsg:  "certificates.key_type: invalid key type 'rsa1024'",
+		},
 		{
 			name: "valid config with only email",
 			config: HaloydConfig{
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 			wantErr: false,
 		},
 		{
 			name: "invalid domain format",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "invalid domain"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				API:          APIConfig{Domain: "invalid domain"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 			wantErr: true,
 			errMsg:  "invalid domain format",
@@ -57,12 +103,8 @@ func TestHaloydConfig_Validate(t *testing.T) {
 		{
 			name: "invalid email format",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "not-an-email"},
+				API:          APIConfig{Domain: "api.example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "not-an-email"},
 			},
 			wantErr: true,
 			errMsg:  "invalid acme-email format",
@@ -70,13 +112,239 @@ func TestHaloydConfig_Validate(t *testing.T) {
 		{
 			name: "domain without email",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 			},
 			wantErr: true,
 			errMsg:  "acmeEmail is required when domain is specified",
 		},
+		{
+			name: "valid logging config",
+			config: HaloydConfig{
+				Logging: HaloydLogging{Format: "json", Level: "debug", File: true, MaxSize: 10, MaxAge: 7},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid logging format",
+			config: HaloydConfig{
+				Logging: HaloydLogging{Format: "xml"},
+			},
+			wantErr: true,
+			errMsg:  "invalid logging format",
+		},
+		{
+			name: "invalid logging level",
+			config: HaloydConfig{
+				Logging: HaloydLogging{Level: "verbose"},
+			},
+			wantErr: true,
+			errMsg:  "invalid logging level",
+		},
+		{
+			name: "negative logging max size",
+			config: HaloydConfig{
+				Logging: HaloydLogging{File: true, MaxSize: -1},
+			},
+			wantErr: true,
+			errMsg:  "logging maxSize must be positive",
+		},
+		{
+			name: "negative deployment logs max age",
+			config: HaloydConfig{
+				Logging: HaloydLogging{DeploymentLogsMaxAge: -1},
+			},
+			wantErr: true,
+			errMsg:  "logging deploymentLogsMaxAge must be positive",
+		},
+		{
+			name: "valid tracing config",
+			config: HaloydConfig{
+				Tracing: HaloydTracing{Endpoint: "http://otel-collector:4318", SampleRatio: helpers.Float64Ptr(0.5)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "tracing endpoint without scheme",
+			config: HaloydConfig{
+				Tracing: HaloydTracing{Endpoint: "otel-collector:4318"},
+			},
+			wantErr: true,
+			errMsg:  "invalid tracing endpoint",
+		},
+		{
+			name: "tracing sample ratio out of range",
+			config: HaloydConfig{
+				Tracing: HaloydTracing{Endpoint: "https://collector.example.com", SampleRatio: helpers.Float64Ptr(1.5)},
+			},
+			wantErr: true,
+			errMsg:  "tracing sampleRatio must be between 0 and 1",
+		},
+		{
+			name: "valid proxy config",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{
+					HTTPPort:  8080,
+					HTTPSPort: 8443,
+					Frontends: []ProxyFrontend{{Name: "admin", Port: 9443, Address: "10.0.0.5", TLS: true}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "proxy port out of range",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{HTTPSPort: 70000},
+			},
+			wantErr: true,
+			errMsg:  "invalid port 70000",
+		},
+		{
+			name: "frontend port conflicts with default https port",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Frontends: []ProxyFrontend{{Name: "admin", Port: 443}}},
+			},
+			wantErr: true,
+			errMsg:  "port 443 is used by both proxy.httpsPort and proxy frontend 'admin'",
+		},
+		{
+			name: "duplicate frontend name",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Frontends: []ProxyFrontend{{Name: "admin", Port: 8443}, {Name: "admin", Port: 9443}}},
+			},
+			wantErr: true,
+			errMsg:  "duplicate name 'admin'",
+		},
+		{
+			name: "invalid frontend name",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Frontends: []ProxyFrontend{{Name: "Admin Panel", Port: 8443}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid name 'Admin Panel'",
+		},
+		{
+			name: "reserved frontend name",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Frontends: []ProxyFrontend{{Name: "internal", Port: 8443}}},
+			},
+			wantErr: true,
+			errMsg:  "name 'internal' is reserved",
+		},
+		{
+			name: "internal port conflicts with frontend",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{InternalPort: 8443, Frontends: []ProxyFrontend{{Name: "admin", Port: 8443}}},
+			},
+			wantErr: true,
+			errMsg:  "port 8443 is used by both proxy.internalPort and proxy frontend 'admin'",
+		},
+		{
+			name: "valid caddy backend",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Backend: ProxyBackendCaddy, HTTPSPort: 8443},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown proxy backend",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Backend: "nginx"},
+			},
+			wantErr: true,
+			errMsg:  "invalid proxy.backend 'nginx'",
+		},
+		{
+			name: "acl proxy routing",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Routing: ProxyRoutingACL},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown proxy routing",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Routing: "lua"},
+			},
+			wantErr: true,
+			errMsg:  "invalid proxy.routing 'lua'",
+		},
+		{
+			name: "caddy backend with frontends",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Backend: ProxyBackendCaddy, Frontends: []ProxyFrontend{{Name: "admin", Port: 8443}}},
+			},
+			wantErr: true,
+			errMsg:  "proxy.frontends is not supported with the caddy backend",
+		},
+		{
+			name: "caddy backend with stats page",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Backend: ProxyBackendCaddy, Stats: true},
+			},
+			wantErr: true,
+			errMsg:  "proxy.stats is not supported with the caddy backend",
+		},
+		{
+			name: "caddy backend with certificate key type",
+			config: HaloydConfig{
+				Proxy:        ProxyConfig{Backend: ProxyBackendCaddy},
+				Certificates: CertificatesConfig{KeyType: KeyTypeEC256},
+			},
+			wantErr: true,
+			errMsg:  "certificates.key_type is not supported with the caddy backend",
+		},
+		{
+			name: "caddy backend with dual certificates",
+			config: HaloydConfig{
+				Proxy:        ProxyConfig{Backend: ProxyBackendCaddy},
+				Certificates: CertificatesConfig{DualCertificates: true},
+			},
+			wantErr: true,
+			errMsg:  "certificates.dual_certificates is not supported with the caddy backend",
+		},
+		{
+			name: "caddy backend with dns provider",
+			config: HaloydConfig{
+				Proxy:        ProxyConfig{Backend: ProxyBackendCaddy},
+				Certificates: CertificatesConfig{DNSProvider: DNSProviderCloudflare},
+			},
+			wantErr: true,
+			errMsg:  "certificates.dns_provider is not supported with the caddy backend",
+		},
+		{
+			name: "api cors origins and trusted proxies",
+			config: HaloydConfig{
+				API: APIConfig{
+					CORSOrigins:    []string{"https://ui.example.com", "http://localhost:5173"},
+					TrustedProxies: []string{"203.0.113.7", "2001:db8::/32"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "api cors origin with path",
+			config: HaloydConfig{
+				API: APIConfig{CORSOrigins: []string{"https://ui.example.com/app"}},
+			},
+			wantErr: true,
+			errMsg:  "invalid api.cors_origins 'https://ui.example.com/app'",
+		},
+		{
+			name: "invalid api trusted proxy",
+			config: HaloydConfig{
+				API: APIConfig{TrustedProxies: []string{"cdn.example.com"}},
+			},
+			wantErr: true,
+			errMsg:  "invalid api.trusted_proxies 'cdn.example.com'",
+		},
+		{
+			name: "invalid frontend address",
+			config: HaloydConfig{
+				Proxy: ProxyConfig{Frontends: []ProxyFrontend{{Name: "admin", Port: 8443, Address: "localhost"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid address 'localhost'",
+		},
 	}
 
 	for _, tt := range tests {
@@ -109,12 +377,8 @@ func TestHaloydConfig_Normalize(t *testing.T) {
 		{
 			name: "config with values",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				API:          APIConfig{Domain: "api.example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 		},
 	}
@@ -125,11 +389,89 @@ func TestHaloydConfig_Normalize(t *testing.T) {
 			if result != &tt.config {
 				t.Errorf("Normalize() should return the same config instance")
 			}
-			// Currently Normalize() doesn't modify anything, but test is here for future changes
 		})
 	}
 }
 
+func TestHaloydConfig_NormalizeLogging(t *testing.T) {
+	withFile := (&HaloydConfig{Logging: HaloydLogging{File: true}}).Normalize()
+	if withFile.Logging.MaxSize != DefaultHaloydLogMaxSize {
+		t.Errorf("Normalize() Logging.MaxSize = %d, expected %d", withFile.Logging.MaxSize, DefaultHaloydLogMaxSize)
+	}
+	if withFile.Logging.MaxAge != DefaultHaloydLogMaxAge {
+		t.Errorf("Normalize() Logging.MaxAge = %d, expected %d", withFile.Logging.MaxAge, DefaultHaloydLogMaxAge)
+	}
+
+	withoutFile := (&HaloydConfig{}).Normalize()
+	if withoutFile.Logging.MaxSize != 0 || withoutFile.Logging.MaxAge != 0 {
+		t.Errorf("Normalize() should not set rotation defaults when file logging is disabled")
+	}
+}
+
+func TestHaloydConfig_NormalizeProxy(t *testing.T) {
+	defaults := (&HaloydConfig{}).Normalize()
+	if defaults.Proxy.HTTPPort != DefaultProxyHTTPPort || defaults.Proxy.HTTPSPort != DefaultProxyHTTPSPort {
+		t.Errorf("Normalize() proxy ports = %d/%d, expected %d/%d",
+			defaults.Proxy.HTTPPort, defaults.Proxy.HTTPSPort, DefaultProxyHTTPPort, DefaultProxyHTTPSPort)
+	}
+	if defaults.Proxy.Backend != ProxyBackendHAProxy {
+		t.Errorf("Normalize() proxy backend = %q, expected %q", defaults.Proxy.Backend, ProxyBackendHAProxy)
+	}
+	if defaults.Proxy.Routing != ProxyRoutingMap {
+		t.Errorf("Normalize() proxy routing = %q, expected %q", defaults.Proxy.Routing, ProxyRoutingMap)
+	}
+
+	custom := (&HaloydConfig{Proxy: ProxyConfig{HTTPPort: 8080, HTTPSPort: 8443}}).Normalize()
+	if custom.Proxy.HTTPPort != 8080 || custom.Proxy.HTTPSPort != 8443 {
+		t.Errorf("Normalize() should keep configured proxy ports, got %d/%d", custom.Proxy.HTTPPort, custom.Proxy.HTTPSPort)
+	}
+}
+
+func TestAPIConfig_AllowsOrigin(t *testing.T) {
+	api := APIConfig{CORSOrigins: []string{"https://ui.example.com/"}}
+	if !api.AllowsOrigin("https://ui.example.com") {
+		t.Errorf("AllowsOrigin() = false for a configured origin")
+	}
+	if api.AllowsOrigin("https://evil.example.com") {
+		t.Errorf("AllowsOrigin() = true for an origin that isn't configured")
+	}
+	if !(APIConfig{CORSOrigins: []string{CORSAllowAllOrigins}}).AllowsOrigin("https://evil.example.com") {
+		t.Errorf("AllowsOrigin() = false with all origins allowed")
+	}
+	if (APIConfig{}).AllowsOrigin("https://ui.example.com") {
+		t.Errorf("AllowsOrigin() = true without configured origins")
+	}
+}
+
+func TestHaloydLogging_SlogLevel(t *testing.T) {
+	tests := []struct {
+		level    string
+		expected slog.Level
+	}{
+		{"", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{"WARN", slog.LevelWarn},
+		{"error", slog.LevelError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			if got := (HaloydLogging{Level: tt.level}).SlogLevel(); got != tt.expected {
+				t.Errorf("SlogLevel() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHaloydLogging_DeploymentLogsRetention(t *testing.T) {
+	if got := (HaloydLogging{}).DeploymentLogsRetention(); got != DefaultDeploymentLogsMaxAge*24*time.Hour {
+		t.Errorf("DeploymentLogsRetention() = %v, expected the default of %d days", got, DefaultDeploymentLogsMaxAge)
+	}
+	if got := (HaloydLogging{DeploymentLogsMaxAge: 7}).DeploymentLogsRetention(); got != 7*24*time.Hour {
+		t.Errorf("DeploymentLogsRetention() = %v, expected 7 days", got)
+	}
+}
+
 func TestLoadHaloydConfig(t *testing.T) {
 	// Create temporary directory for test files
 	tempDir := t.TempDir()
@@ -150,12 +492,8 @@ certificates:
 `,
 			extension: ".yaml",
 			expected: &HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				API:          APIConfig{Domain: "api.example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 		},
 		{
@@ -170,12 +508,8 @@ certificates:
 }`,
 			extension: ".json",
 			expected: &HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				API:          APIConfig{Domain: "api.example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 		},
 		{
@@ -194,12 +528,8 @@ certificates:
 `,
 			extension: ".yaml",
 			expected: &HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: ""},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: ""},
+				API:          APIConfig{Domain: ""},
+				Certificates: CertificatesConfig{AcmeEmail: ""},
 			},
 		},
 		{
@@ -274,24 +604,16 @@ func TestSaveHaloydConfig(t *testing.T) {
 		{
 			name: "save yaml config",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				API:          APIConfig{Domain: "api.example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 			extension: ".yaml",
 		},
 		{
 			name: "save json config",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
-				Certificates: struct {
-					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
-				}{AcmeEmail: "admin@example.com"},
+				API:          APIConfig{Domain: "api.example.com"},
+				Certificates: CertificatesConfig{AcmeEmail: "admin@example.com"},
 			},
 			extension: ".json",
 		},
@@ -303,9 +625,7 @@ func TestSaveHaloydConfig(t *testing.T) {
 		{
 			name: "save config with only domain",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 			},
 			extension: ".yaml",
 		},
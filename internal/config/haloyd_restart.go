@@ -0,0 +1,63 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// restartRequiredSettings are the settings haloyd only reads at startup, changing them needs 'haloyadm restart'.
+// Both the config reload of haloyd and 'haloyadm config set' use them.
+var restartRequiredSettings = []struct {
+	key string
+	// field returns a pointer to the setting in the config.
+	field func(mc *HaloydConfig) any
+}{
+	{"api.dashboard", func(mc *HaloydConfig) any { return &mc.API.Dashboard }},
+	{"api.registry", func(mc *HaloydConfig) any { return &mc.API.Registry }},
+	{"logging", func(mc *HaloydConfig) any { return &mc.Logging }},
+	{"tracing", func(mc *HaloydConfig) any { return &mc.Tracing }},
+	// Ports are published when the proxy container is created. proxy.routing is the exception, it only
+	// changes the generated config.
+	{"proxy", func(mc *HaloydConfig) any { return &mc.Proxy }},
+	// The load balancer provider is set up at startup.
+	{"external_lb", func(mc *HaloydConfig) any { return &mc.ExternalLB }},
+	// The certificate store is opened at startup.
+	{"certificates.store", func(mc *HaloydConfig) any { return &mc.Certificates.Store }},
+	// Migrations only run at startup.
+	{"database", func(mc *HaloydConfig) any { return &mc.Database }},
+}
+
+// proxyRoutingKey is the only setting below proxy that's applied without a restart.
+const proxyRoutingKey = "proxy.routing"
+
+// RequiresRestart reports whether changing the setting with the given key, e.g. proxy.http_port, needs a restart.
+func RequiresRestart(key string) bool {
+	if key == proxyRoutingKey || strings.HasPrefix(key, proxyRoutingKey+".") {
+		return false
+	}
+	for _, setting := range restartRequiredSettings {
+		if key == setting.key || strings.HasPrefix(key, setting.key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepRestartRequired resets the settings of mc that need a restart to their values in current, and returns
+// the keys of the settings that were changed.
+func (mc *HaloydConfig) KeepRestartRequired(current *HaloydConfig) []string {
+	routing := mc.Proxy.Routing
+	mc.Proxy.Routing = current.Proxy.Routing
+	defer func() { mc.Proxy.Routing = routing }()
+
+	var changed []string
+	for _, setting := range restartRequiredSettings {
+		next := reflect.ValueOf(setting.field(mc)).Elem()
+		previous := reflect.ValueOf(setting.field(current)).Elem()
+		if !reflect.DeepEqual(next.Interface(), previous.Interface()) {
+			changed = append(changed, setting.key)
+			next.Set(previous)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRequiresRestart(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "proxy", want: true},
+		{key: "proxy.http_port", want: true},
+		{key: "proxy.routing", want: false},
+		{key: "external_lb.provider", want: true},
+		{key: "certificates.store", want: true},
+		{key: "certificates.key_type", want: false},
+		{key: "api.domain", want: false},
+		{key: "api.dashboard", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := RequiresRestart(tt.key); got != tt.want {
+				t.Errorf("RequiresRestart(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepRestartRequired(t *testing.T) {
+	current := &HaloydConfig{
+		Proxy:        ProxyConfig{HTTPPort: 80},
+		Certificates: CertificatesConfig{Store: CertStoreFile},
+	}
+	next := &HaloydConfig{
+		Proxy:        ProxyConfig{HTTPPort: 8080, Routing: ProxyRoutingACL},
+		Certificates: CertificatesConfig{Store: CertStoreDatabase, KeyType: KeyTypeEC256},
+	}
+
+	changed := next.KeepRestartRequired(current)
+	if want := []string{"proxy", "certificates.store"}; !slices.Equal(changed, want) {
+		t.Errorf("KeepRestartRequired() = %v, want %v", changed, want)
+	}
+	if next.Proxy.HTTPPort != 80 || next.Certificates.Store != CertStoreFile {
+		t.Errorf("settings that need a restart weren't reset: %+v", next)
+	}
+	if next.Proxy.Routing != ProxyRoutingACL || next.Certificates.KeyType != KeyTypeEC256 {
+		t.Errorf("reloadable settings were reset: %+v", next)
+	}
+
+	if changed := next.KeepRestartRequired(current); len(changed) != 0 {
+		t.Errorf("KeepRestartRequired() without changes = %v", changed)
+	}
+}
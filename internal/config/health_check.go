@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type HealthCheckType string
+
+const (
+	HealthCheckTypeHTTP HealthCheckType = "http" // GET request to the health check path (default)
+	HealthCheckTypeTCP  HealthCheckType = "tcp"  // Connect to the container port
+	HealthCheckTypeGRPC HealthCheckType = "grpc" // Standard gRPC health checking protocol (grpc.health.v1)
+	HealthCheckTypeExec HealthCheckType = "exec" // Run a command inside the container
+)
+
+type HealthCheck struct {
+	Type HealthCheckType `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	// Command is run inside the container for the exec type. Exit code 0 means healthy.
+	Command []string `json:"command,omitempty" yaml:"command,omitempty" toml:"command,omitempty"`
+	// GRPCService is the service name sent in the gRPC health check request. Empty checks the overall server health.
+	GRPCService string `json:"grpcService,omitempty" yaml:"grpc_service,omitempty" toml:"grpc_service,omitempty"`
+
+	// ReadinessPath is checked before a new container receives traffic. Defaults to the target's healthCheckPath.
+	ReadinessPath string `json:"readinessPath,omitempty" yaml:"readiness_path,omitempty" toml:"readiness_path,omitempty"`
+	// LivenessPath is checked continuously by HAProxy while the container serves traffic. Defaults to the target's healthCheckPath.
+	LivenessPath string `json:"livenessPath,omitempty" yaml:"liveness_path,omitempty" toml:"liveness_path,omitempty"`
+
+	// Timing options use Go duration strings, e.g. "500ms", "5s" or "1m".
+	// Interval is the time between check attempts. When not set, attempts back off exponentially starting at 500ms.
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty" toml:"interval,omitempty"`
+	// Timeout is the maximum duration of a single check attempt (default 5s).
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+	// StartPeriod is how long to wait after the container has started before the first check.
+	StartPeriod string `json:"startPeriod,omitempty" yaml:"start_period,omitempty" toml:"start_period,omitempty"`
+	// Retries is the number of attempts before the container is considered unhealthy (default 5).
+	// HAProxy uses it as the number of failed checks before a server is marked down.
+	Retries *int `json:"retries,omitempty" yaml:"retries,omitempty" toml:"retries,omitempty"`
+	// Rise is the number of successful HAProxy checks before a server is marked up again (HAProxy default 2).
+	Rise *int `json:"rise,omitempty" yaml:"rise,omitempty" toml:"rise,omitempty"`
+	// ExpectedStatusCodes are the HTTP status codes considered healthy. Defaults to any 2xx status.
+	ExpectedStatusCodes []int `json:"expectedStatusCodes,omitempty" yaml:"expected_status_codes,omitempty" toml:"expected_status_codes,omitempty"`
+}
+
+// HealthCheckDurations holds the parsed timing options of a HealthCheck. Zero values mean not set.
+type HealthCheckDurations struct {
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+}
+
+// Durations parses the timing options. Call Validate first to get descriptive errors.
+func (hc *HealthCheck) Durations() (HealthCheckDurations, error) {
+	var durations HealthCheckDurations
+	var err error
+	if durations.Interval, err = parseHealthCheckDuration(hc.Interval); err != nil {
+		return durations, fmt.Errorf("invalid interval: %w", err)
+	}
+	if durations.Timeout, err = parseHealthCheckDuration(hc.Timeout); err != nil {
+		return durations, fmt.Errorf("invalid timeout: %w", err)
+	}
+	if durations.StartPeriod, err = parseHealthCheckDuration(hc.StartPeriod); err != nil {
+		return durations, fmt.Errorf("invalid start period: %w", err)
+	}
+	return durations, nil
+}
+
+func parseHealthCheckDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got '%s'", value)
+	}
+	return d, nil
+}
+
+func (hc *HealthCheck) Validate(format string) error {
+	if hc.Type != "" {
+		validTypes := []HealthCheckType{HealthCheckTypeHTTP, HealthCheckTypeTCP, HealthCheckTypeGRPC, HealthCheckTypeExec}
+		if !slices.Contains(validTypes, hc.Type) {
+			return fmt.Errorf("%s.type must be 'http', 'tcp', 'grpc' or 'exec', got '%s'", GetFieldNameForFormat(TargetConfig{}, "HealthCheck", format), hc.Type)
+		}
+	}
+
+	if hc.Type == HealthCheckTypeExec {
+		if len(hc.Command) == 0 || strings.TrimSpace(hc.Command[0]) == "" {
+			return fmt.Errorf("%s.command is required for exec health checks", GetFieldNameForFormat(TargetConfig{}, "HealthCheck", format))
+		}
+	} else if len(hc.Command) > 0 {
+		return fmt.Errorf("%s.command can only be used with exec health checks", GetFieldNameForFormat(TargetConfig{}, "HealthCheck", format))
+	}
+
+	if hc.GRPCService != "" && hc.Type != HealthCheckTypeGRPC {
+		return fmt.Errorf("%s can only be used with grpc health checks", GetFieldNameForFormat(HealthCheck{}, "GRPCService", format))
+	}
+
+	pathFields := []struct {
+		fieldName string
+		value     string
+	}{
+		{"ReadinessPath", hc.ReadinessPath},
+		{"LivenessPath", hc.LivenessPath},
+	}
+	for _, field := range pathFields {
+		if field.value == "" {
+			continue
+		}
+		if hc.Type != "" && hc.Type != HealthCheckTypeHTTP {
+			return fmt.Errorf("%s can only be used with http health checks", GetFieldNameForFormat(HealthCheck{}, field.fieldName, format))
+		}
+		if field.value[0] != '/' {
+			return fmt.Errorf("%s must start with a slash", GetFieldNameForFormat(HealthCheck{}, field.fieldName, format))
+		}
+	}
+
+	durationFields := []struct {
+		fieldName string
+		value     string
+	}{
+		{"Interval", hc.Interval},
+		{"Timeout", hc.Timeout},
+		{"StartPeriod", hc.StartPeriod},
+	}
+	for _, field := range durationFields {
+		if _, err := parseHealthCheckDuration(field.value); err != nil {
+			return fmt.Errorf("%s.%s is invalid: %w", GetFieldNameForFormat(TargetConfig{}, "HealthCheck", format), GetFieldNameForFormat(HealthCheck{}, field.fieldName, format), err)
+		}
+	}
+
+	if hc.Retries != nil && *hc.Retries < 1 {
+		return fmt.Errorf("%s.retries must be at least 1", GetFieldNameForFormat(TargetConfig{}, "HealthCheck", format))
+	}
+
+	if hc.Rise != nil && *hc.Rise < 1 {
+		return fmt.Errorf("%s.rise must be at least 1", GetFieldNameForFormat(TargetConfig{}, "HealthCheck", format))
+	}
+
+	if len(hc.ExpectedStatusCodes) > 0 {
+		if hc.Type != "" && hc.Type != HealthCheckTypeHTTP {
+			return fmt.Errorf("%s can only be used with http health checks", GetFieldNameForFormat(HealthCheck{}, "ExpectedStatusCodes", format))
+		}
+		for _, code := range hc.ExpectedStatusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("%s contains invalid HTTP status code %d", GetFieldNameForFormat(HealthCheck{}, "ExpectedStatusCodes", format), code)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Warmup sends requests to a new container after it passes its health check and before
+// HAProxy routes traffic to it. Useful for apps that are slow to serve their first requests.
+type Warmup struct {
+	Paths []string `json:"paths" yaml:"paths" toml:"paths"`
+	// Requests is the number of requests sent to each path (default 1).
+	Requests *int `json:"requests,omitempty" yaml:"requests,omitempty" toml:"requests,omitempty"`
+}
+
+func (w *Warmup) Validate(format string) error {
+	warmupField := GetFieldNameForFormat(TargetConfig{}, "Warmup", format)
+	if len(w.Paths) == 0 {
+		return fmt.Errorf("%s.paths must contain at least one path", warmupField)
+	}
+
+	for _, path := range w.Paths {
+		if path == "" || path[0] != '/' {
+			return fmt.Errorf("%s.paths entry '%s' must start with a slash", warmupField, path)
+		}
+	}
+
+	if w.Requests != nil && *w.Requests < 1 {
+		return fmt.Errorf("%s.requests must be at least 1", warmupField)
+	}
+
+	return nil
+}
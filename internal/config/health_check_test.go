@@ -0,0 +1,221 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestHealthCheck_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthCheck HealthCheck
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:        "empty health check uses defaults",
+			healthCheck: HealthCheck{},
+			expectError: false,
+		},
+		{
+			name:        "valid http",
+			healthCheck: HealthCheck{Type: HealthCheckTypeHTTP},
+			expectError: false,
+		},
+		{
+			name:        "valid tcp",
+			healthCheck: HealthCheck{Type: HealthCheckTypeTCP},
+			expectError: false,
+		},
+		{
+			name:        "valid grpc with service",
+			healthCheck: HealthCheck{Type: HealthCheckTypeGRPC, GRPCService: "my.package.Service"},
+			expectError: false,
+		},
+		{
+			name:        "valid exec",
+			healthCheck: HealthCheck{Type: HealthCheckTypeExec, Command: []string{"pg_isready", "-U", "postgres"}},
+			expectError: false,
+		},
+		{
+			name:        "invalid type",
+			healthCheck: HealthCheck{Type: "udp"},
+			expectError: true,
+			errMsg:      "must be 'http', 'tcp', 'grpc' or 'exec'",
+		},
+		{
+			name:        "exec without command",
+			healthCheck: HealthCheck{Type: HealthCheckTypeExec},
+			expectError: true,
+			errMsg:      "command is required",
+		},
+		{
+			name:        "command with non exec type",
+			healthCheck: HealthCheck{Type: HealthCheckTypeTCP, Command: []string{"true"}},
+			expectError: true,
+			errMsg:      "can only be used with exec",
+		},
+		{
+			name:        "grpc service with non grpc type",
+			healthCheck: HealthCheck{Type: HealthCheckTypeHTTP, GRPCService: "my.package.Service"},
+			expectError: true,
+			errMsg:      "can only be used with grpc",
+		},
+		{
+			name: "valid timing options",
+			healthCheck: HealthCheck{
+				Interval:            "2s",
+				Timeout:             "500ms",
+				StartPeriod:         "1m",
+				Retries:             helpers.IntPtr(10),
+				Rise:                helpers.IntPtr(1),
+				ExpectedStatusCodes: []int{200, 204, 301},
+			},
+			expectError: false,
+		},
+		{
+			name:        "invalid interval",
+			healthCheck: HealthCheck{Interval: "2 seconds"},
+			expectError: true,
+			errMsg:      "interval is invalid",
+		},
+		{
+			name:        "negative timeout",
+			healthCheck: HealthCheck{Timeout: "-1s"},
+			expectError: true,
+			errMsg:      "duration must be positive",
+		},
+		{
+			name:        "zero retries",
+			healthCheck: HealthCheck{Retries: helpers.IntPtr(0)},
+			expectError: true,
+			errMsg:      "retries must be at least 1",
+		},
+		{
+			name:        "zero rise",
+			healthCheck: HealthCheck{Rise: helpers.IntPtr(0)},
+			expectError: true,
+			errMsg:      "rise must be at least 1",
+		},
+		{
+			name:        "invalid status code",
+			healthCheck: HealthCheck{ExpectedStatusCodes: []int{200, 999}},
+			expectError: true,
+			errMsg:      "invalid HTTP status code 999",
+		},
+		{
+			name:        "status codes with tcp type",
+			healthCheck: HealthCheck{Type: HealthCheckTypeTCP, ExpectedStatusCodes: []int{200}},
+			expectError: true,
+			errMsg:      "can only be used with http",
+		},
+		{
+			name:        "valid readiness and liveness paths",
+			healthCheck: HealthCheck{ReadinessPath: "/ready", LivenessPath: "/live"},
+			expectError: false,
+		},
+		{
+			name:        "readiness path without leading slash",
+			healthCheck: HealthCheck{ReadinessPath: "ready"},
+			expectError: true,
+			errMsg:      "readiness_path must start with a slash",
+		},
+		{
+			name:        "liveness path with tcp type",
+			healthCheck: HealthCheck{Type: HealthCheckTypeTCP, LivenessPath: "/live"},
+			expectError: true,
+			errMsg:      "liveness_path can only be used with http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.healthCheck.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheck_Durations(t *testing.T) {
+	hc := HealthCheck{Interval: "2s", Timeout: "500ms"}
+	durations, err := hc.Durations()
+	if err != nil {
+		t.Fatalf("Durations() unexpected error = %v", err)
+	}
+	if durations.Interval != 2*time.Second {
+		t.Errorf("Durations() Interval = %v, want %v", durations.Interval, 2*time.Second)
+	}
+	if durations.Timeout != 500*time.Millisecond {
+		t.Errorf("Durations() Timeout = %v, want %v", durations.Timeout, 500*time.Millisecond)
+	}
+	if durations.StartPeriod != 0 {
+		t.Errorf("Durations() StartPeriod = %v, want 0", durations.StartPeriod)
+	}
+
+	hc = HealthCheck{StartPeriod: "soon"}
+	if _, err := hc.Durations(); err == nil {
+		t.Errorf("Durations() expected error for invalid start period")
+	}
+}
+
+func TestWarmup_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		warmup      Warmup
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:        "valid warmup",
+			warmup:      Warmup{Paths: []string{"/", "/api/products"}, Requests: helpers.IntPtr(20)},
+			expectError: false,
+		},
+		{
+			name:        "no paths",
+			warmup:      Warmup{},
+			expectError: true,
+			errMsg:      "must contain at least one path",
+		},
+		{
+			name:        "path without leading slash",
+			warmup:      Warmup{Paths: []string{"api"}},
+			expectError: true,
+			errMsg:      "must start with a slash",
+		},
+		{
+			name:        "zero requests",
+			warmup:      Warmup{Paths: []string{"/"}, Requests: helpers.IntPtr(0)},
+			expectError: true,
+			errMsg:      "requests must be at least 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.warmup.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
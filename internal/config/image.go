@@ -51,10 +51,20 @@ func (i *Image) GetEffectivePushStrategy() BuildPushOption {
 	return BuildPushOptionServer
 }
 
+// IsDigestReference reports whether the repository pins the image by digest, e.g. "ghcr.io/org/app@sha256:...".
+func (i *Image) IsDigestReference() bool {
+	return strings.Contains(i.Repository, "@")
+}
+
 func (i *Image) ImageRef() string {
 	repo := strings.TrimSpace(i.Repository)
 	tag := strings.TrimSpace(i.Tag)
 
+	// A repository pinned by digest refers to exactly one image, the tag is ignored
+	if i.IsDigestReference() {
+		return repo
+	}
+
 	// If repository already contains a tag, don't add another one
 	if strings.Contains(repo, ":") && tag == "" {
 		return repo
@@ -83,7 +93,7 @@ func (i *Image) Validate(format string) error {
 			return err
 		}
 
-		if i.History.Strategy == HistoryStrategyRegistry {
+		if i.History.Strategy == HistoryStrategyRegistry && !i.IsDigestReference() {
 			// Prevent mutable tags with registry strategy
 			tag := strings.TrimSpace(i.Tag)
 			if tag == "" || tag == "latest" {
@@ -208,6 +218,26 @@ func (b *BuildConfig) Validate(format string) error {
 		}
 	}
 
+	switch b.Source {
+	case "":
+	case SourceBuilderBuildpacks, SourceBuilderNixpacks:
+		if b.Dockerfile != "" {
+			return fmt.Errorf("builder.dockerfile can't be used with builder.source '%s'", b.Source)
+		}
+	default:
+		return fmt.Errorf("builder.source must be '%s' or '%s', got '%s'", SourceBuilderBuildpacks, SourceBuilderNixpacks, b.Source)
+	}
+	if b.Buildpacks != "" && b.Source != SourceBuilderBuildpacks {
+		return fmt.Errorf("builder.buildpacks requires builder.source '%s'", SourceBuilderBuildpacks)
+	}
+
+	if b.Compression != "" {
+		validCompressions := []UploadCompression{UploadCompressionGzip, UploadCompressionZstd, UploadCompressionNone}
+		if !slices.Contains(validCompressions, b.Compression) {
+			return fmt.Errorf("builder.compression must be 'gzip', 'zstd' or 'none', got '%s'", b.Compression)
+		}
+	}
+
 	return nil
 }
 
@@ -224,6 +254,38 @@ type BuildConfig struct {
 	Platform   string          `json:"platform,omitempty" yaml:"platform,omitempty" toml:"platform,omitempty"`
 	Args       []BuildArg      `json:"args,omitempty" yaml:"args,omitempty" toml:"args,omitempty"`
 	Push       BuildPushOption `json:"push,omitempty" yaml:"push,omitempty" toml:"push,omitempty"`
+	// Compression of the image archive uploaded to the server when push is 'server'. Defaults to gzip.
+	Compression UploadCompression `json:"compression,omitempty" yaml:"compression,omitempty" toml:"compression,omitempty"`
+	// Source builds the image from the app source without a Dockerfile, with Cloud Native Buildpacks
+	// ("buildpacks", requires the pack CLI) or Nixpacks ("nixpacks", requires the nixpacks CLI).
+	Source SourceBuilder `json:"source,omitempty" yaml:"source,omitempty" toml:"source,omitempty"`
+	// Buildpacks is the builder image used with source 'buildpacks'. Defaults to DefaultBuildpacksBuilder.
+	Buildpacks string `json:"buildpacks,omitempty" yaml:"buildpacks,omitempty" toml:"buildpacks,omitempty"`
+}
+
+type SourceBuilder string
+
+const (
+	SourceBuilderBuildpacks SourceBuilder = "buildpacks"
+	SourceBuilderNixpacks   SourceBuilder = "nixpacks"
+
+	DefaultBuildpacksBuilder = "paketobuildpacks/builder-jammy-base"
+)
+
+type UploadCompression string
+
+const (
+	UploadCompressionGzip UploadCompression = "gzip"
+	UploadCompressionZstd UploadCompression = "zstd" // Requires the zstd command on the machine running haloy
+	UploadCompressionNone UploadCompression = "none"
+)
+
+// GetEffectiveCompression returns the compression used for uploaded images.
+func (b *BuildConfig) GetEffectiveCompression() UploadCompression {
+	if b == nil || b.Compression == "" {
+		return UploadCompressionGzip
+	}
+	return b.Compression
 }
 
 type BuildArg struct {
@@ -52,6 +52,14 @@ func TestImage_ImageRef(t *testing.T) {
 			},
 			expected: "registry.example.com/myapp:v1.0.0",
 		},
+		{
+			name: "repository pinned by digest ignores tag",
+			image: Image{
+				Repository: "registry.example.com/myapp@sha256:3f1d6a2b",
+				Tag:        "v1.0.0",
+			},
+			expected: "registry.example.com/myapp@sha256:3f1d6a2b",
+		},
 	}
 
 	for _, tt := range tests {
@@ -163,6 +171,18 @@ func TestImage_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid registry strategy with digest",
+			image: Image{
+				Repository: "myapp@sha256:3f1d6a2b",
+				History: &ImageHistory{
+					Strategy: HistoryStrategyRegistry,
+					Count:    helpers.IntPtr(5),
+					Pattern:  "v*",
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "valid registry auth",
 			image: Image{
@@ -385,6 +405,65 @@ func TestBuildConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "builder.push must be 'server' or 'registry'",
 		},
+		{
+			name: "valid upload compression",
+			build: BuildConfig{
+				Push:        BuildPushOptionServer,
+				Compression: UploadCompressionZstd,
+			},
+			wantErr: false,
+		},
+		{
+			name: "source build with buildpacks",
+			build: BuildConfig{
+				Source:     SourceBuilderBuildpacks,
+				Buildpacks: "heroku/builder:24",
+			},
+			wantErr: false,
+		},
+		{
+			name: "source build with nixpacks",
+			build: BuildConfig{
+				Context: "./api",
+				Source:  SourceBuilderNixpacks,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid source builder",
+			build: BuildConfig{
+				Source: "kaniko",
+			},
+			wantErr: true,
+			errMsg:  "builder.source must be 'buildpacks' or 'nixpacks'",
+		},
+		{
+			name: "source build with dockerfile",
+			build: BuildConfig{
+				Dockerfile: "Dockerfile",
+				Source:     SourceBuilderNixpacks,
+			},
+			wantErr: true,
+			errMsg:  "builder.dockerfile can't be used with builder.source",
+		},
+		{
+			name: "buildpacks builder without buildpacks source",
+			build: BuildConfig{
+				Source:     SourceBuilderNixpacks,
+				Buildpacks: "heroku/builder:24",
+			},
+			wantErr: true,
+			errMsg:  "builder.buildpacks requires builder.source 'buildpacks'",
+		},
+		{
+			name: "invalid upload compression",
+			build: BuildConfig{
+				Push:        BuildPushOptionServer,
+				Compression: "brotli",
+			},
+			wantErr: true,
+			errMsg:  "builder.compression must be 'gzip', 'zstd' or 'none'",
+		},
 		{
 			name: "context with whitespace",
 			build: BuildConfig{
@@ -0,0 +1,313 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultImageWatchInterval is the time between registry checks when image_watch.interval is not set.
+	DefaultImageWatchInterval = 5 * time.Minute
+	// MinImageWatchInterval keeps the checks of an app below the rate limits of registries.
+	MinImageWatchInterval = time.Minute
+	// DefaultImageWatchCooldown is the minimum time between deployments of the watcher when image_watch.cooldown is not set.
+	DefaultImageWatchCooldown = 15 * time.Minute
+)
+
+// ImageWatch lets haloyd deploy new images of an app from its registry. With Semver, the highest tag in the
+// range that is newer than the deployed tag is deployed. Without it, the deployed tag is deployed again when
+// its digest in the registry changes, e.g. when a new build of "latest" is pushed.
+type ImageWatch struct {
+	// Semver is a range of tags like "^1.4", "~1.4.2", "1.x" or ">=1.4.0 <2.0.0". Tags are versions like 1.4.2
+	// or v1.4.2, pre-releases are only matched by ranges that name a pre-release of the same version.
+	Semver string `json:"semver,omitempty" yaml:"semver,omitempty" toml:"semver,omitempty"`
+	// Interval is the time between registry checks, as a Go duration string (default 5m, at least 1m).
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty" toml:"interval,omitempty"`
+	// Cooldown is the minimum time between deployments of the watcher, as a Go duration string (default 15m).
+	Cooldown string `json:"cooldown,omitempty" yaml:"cooldown,omitempty" toml:"cooldown,omitempty"`
+	// RequireApproval holds new images for approval, like require_approval does for all deployments of the target.
+	RequireApproval bool `json:"requireApproval,omitempty" yaml:"require_approval,omitempty" toml:"require_approval,omitempty"`
+}
+
+func (w *ImageWatch) Validate(format string) error {
+	watchField := GetFieldNameForFormat(TargetConfig{}, "ImageWatch", format)
+	fieldName := func(name string) string {
+		return fmt.Sprintf("%s.%s", watchField, GetFieldNameForFormat(ImageWatch{}, name, format))
+	}
+
+	if w.Semver != "" {
+		if _, err := parseSemverRange(w.Semver); err != nil {
+			return fmt.Errorf("%s '%s' is invalid: %w", fieldName("Semver"), w.Semver, err)
+		}
+	}
+
+	interval, err := parseHealthCheckDuration(w.Interval)
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", fieldName("Interval"), err)
+	}
+	if interval != 0 && interval < MinImageWatchInterval {
+		return fmt.Errorf("%s must be at least %s", fieldName("Interval"), MinImageWatchInterval)
+	}
+	if _, err := parseHealthCheckDuration(w.Cooldown); err != nil {
+		return fmt.Errorf("%s is invalid: %w", fieldName("Cooldown"), err)
+	}
+
+	return nil
+}
+
+// IntervalDuration returns the time between registry checks. Call Validate first.
+func (w *ImageWatch) IntervalDuration() time.Duration {
+	if d, err := parseHealthCheckDuration(w.Interval); err == nil && d > 0 {
+		return d
+	}
+	return DefaultImageWatchInterval
+}
+
+// CooldownDuration returns the minimum time between deployments of the watcher. Call Validate first.
+func (w *ImageWatch) CooldownDuration() time.Duration {
+	if d, err := parseHealthCheckDuration(w.Cooldown); err == nil && d > 0 {
+		return d
+	}
+	return DefaultImageWatchCooldown
+}
+
+// NewerTag returns the highest of tags in the Semver range, if it's newer than the current tag. A current tag
+// that isn't a version, like "latest", is replaced by any tag in the range.
+func (w *ImageWatch) NewerTag(tags []string, current string) (string, bool) {
+	if w.Semver == "" {
+		return "", false
+	}
+	r, err := parseSemverRange(w.Semver)
+	if err != nil {
+		return "", false
+	}
+
+	best, bestTag := semver{}, ""
+	if v, ok := parseSemver(current); ok {
+		best = v
+	}
+	for _, tag := range tags {
+		v, ok := parseSemver(tag)
+		if !ok || !r.matches(v) || v.compare(best) <= 0 {
+			continue
+		}
+		best, bestTag = v, tag
+	}
+	return bestTag, bestTag != ""
+}
+
+// semver is a version of the form MAJOR.MINOR.PATCH with an optional pre-release. Build metadata is ignored.
+type semver struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// parseSemver parses a full version with an optional "v" prefix. Partial versions like "1.4" aren't accepted,
+// as tags like that usually move with each release.
+func parseSemver(tag string) (semver, bool) {
+	v, parts, ok := parseSemverParts(strings.TrimPrefix(tag, "v"))
+	return v, ok && parts == 3
+}
+
+// parseSemverParts parses a version that may leave out the minor and patch numbers, returning the number of
+// parts given. "x", "X" and "*" stand for a missing part.
+func parseSemverParts(s string) (semver, int, bool) {
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, _ := strings.Cut(s, "-")
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return semver{}, 0, false
+	}
+
+	var numbers [3]int
+	parts := 0
+	for _, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			break
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 || (len(field) > 1 && field[0] == '0') {
+			return semver{}, 0, false
+		}
+		numbers[parts] = n
+		parts++
+	}
+	if parts == 0 && fields[0] != "x" && fields[0] != "X" && fields[0] != "*" {
+		return semver{}, 0, false
+	}
+	if pre != "" && parts < 3 {
+		return semver{}, 0, false
+	}
+	return semver{major: numbers[0], minor: numbers[1], patch: numbers[2], pre: pre}, parts, true
+}
+
+func (v semver) compare(o semver) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	// A pre-release sorts before its release.
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	return comparePrerelease(v.pre, o.pre)
+}
+
+// comparePrerelease compares dot separated pre-release identifiers, numeric ones by value.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return an - bn
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(as) - len(bs)
+}
+
+type semverComparator struct {
+	op      string
+	version semver
+}
+
+// semverRange matches a version when all comparators of one of its sets match.
+type semverRange [][]semverComparator
+
+func parseSemverRange(s string) (semverRange, error) {
+	var r semverRange
+	for _, set := range strings.Split(s, "||") {
+		var comparators []semverComparator
+		for _, term := range strings.Fields(set) {
+			c, err := parseSemverTerm(term)
+			if err != nil {
+				return nil, err
+			}
+			comparators = append(comparators, c...)
+		}
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("empty range")
+		}
+		r = append(r, comparators)
+	}
+	return r, nil
+}
+
+// parseSemverTerm turns a term like "^1.4", "~1.4.2", "1.x" or ">=1.4.0" into comparators.
+func parseSemverTerm(term string) ([]semverComparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if rest, found := strings.CutPrefix(term, prefix); found {
+			op, term = prefix, rest
+			break
+		}
+	}
+	v, parts, ok := parseSemverParts(strings.TrimPrefix(term, "v"))
+	if !ok {
+		return nil, fmt.Errorf("invalid version '%s'", term)
+	}
+	if parts == 0 {
+		// "*" and "x" match all versions.
+		return []semverComparator{{">=", semver{}}}, nil
+	}
+
+	// The first version after the range of a partial version, e.g. 2.0.0 for "1" and 1.5.0 for "1.4".
+	next := func(parts int) semver {
+		switch parts {
+		case 1:
+			return semver{major: v.major + 1}
+		case 2:
+			return semver{major: v.major, minor: v.minor + 1}
+		}
+		return semver{major: v.major, minor: v.minor, patch: v.patch + 1}
+	}
+	lower := semverComparator{">=", v}
+
+	switch op {
+	case "^":
+		// Changes that don't modify the left-most non-zero part, e.g. ^1.4 allows 1.x and ^0.4 allows 0.4.x.
+		switch {
+		case v.major > 0 || parts == 1:
+			return []semverComparator{lower, {"<", next(1)}}, nil
+		case v.minor > 0 || parts == 2:
+			return []semverComparator{lower, {"<", next(2)}}, nil
+		}
+		return []semverComparator{lower, {"<", next(3)}}, nil
+	case "~":
+		// Patch changes when the minor version is given, minor changes otherwise.
+		if parts == 1 {
+			return []semverComparator{lower, {"<", next(1)}}, nil
+		}
+		return []semverComparator{lower, {"<", next(2)}}, nil
+	case "", "=":
+		if parts < 3 {
+			return []semverComparator{lower, {"<", next(parts)}}, nil
+		}
+		return []semverComparator{{"=", v}}, nil
+	case ">":
+		if parts < 3 {
+			return []semverComparator{{">=", next(parts)}}, nil
+		}
+	case "<=":
+		if parts < 3 {
+			return []semverComparator{{"<", next(parts)}}, nil
+		}
+	}
+	return []semverComparator{{op, v}}, nil
+}
+
+func (r semverRange) matches(v semver) bool {
+	for _, set := range r {
+		if setMatches(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func setMatches(set []semverComparator, v semver) bool {
+	allowPre := v.pre == ""
+	for _, c := range set {
+		cmp := v.compare(c.version)
+		var ok bool
+		switch c.op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		default:
+			ok = cmp == 0
+		}
+		if !ok {
+			return false
+		}
+		// A pre-release only matches when the range names a pre-release of the same version.
+		if c.version.pre != "" && c.version.major == v.major && c.version.minor == v.minor && c.version.patch == v.patch {
+			allowPre = true
+		}
+	}
+	return allowPre
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestImageWatch_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		watch       ImageWatch
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:  "digest of the tag",
+			watch: ImageWatch{},
+		},
+		{
+			name:  "semver range",
+			watch: ImageWatch{Semver: ">=1.4.0 <2.0.0 || ^3", Interval: "10m", Cooldown: "1h", RequireApproval: true},
+		},
+		{
+			name:        "invalid range",
+			watch:       ImageWatch{Semver: "^latest"},
+			expectError: true,
+			errMsg:      "image_watch.semver '^latest' is invalid",
+		},
+		{
+			name:        "empty range",
+			watch:       ImageWatch{Semver: "^1 ||"},
+			expectError: true,
+			errMsg:      "empty range",
+		},
+		{
+			name:        "interval too short",
+			watch:       ImageWatch{Interval: "10s"},
+			expectError: true,
+			errMsg:      "image_watch.interval must be at least 1m0s",
+		},
+		{
+			name:        "invalid cooldown",
+			watch:       ImageWatch{Cooldown: "soon"},
+			expectError: true,
+			errMsg:      "image_watch.cooldown is invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.watch.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestImageWatch_NewerTag(t *testing.T) {
+	tags := []string{"latest", "1.3.9", "1.4", "1.4.0", "1.4.2", "v1.5.0", "1.6.0-rc.1", "2.0.0", "0.3.1", "0.3.7", "0.4.0"}
+
+	tests := []struct {
+		name    string
+		semver  string
+		current string
+		want    string
+	}{
+		{"caret takes highest minor", "^1.4", "1.4.0", "v1.5.0"},
+		{"tilde stays on minor", "~1.4.0", "1.4.0", "1.4.2"},
+		{"x range", "1.x", "1.3.9", "v1.5.0"},
+		{"comparators", ">=1.4.0 <1.5.0", "1.3.9", "1.4.2"},
+		{"caret below 1.0 stays on minor", "^0.3", "0.3.1", "0.3.7"},
+		{"alternatives", "^0.4 || ^2", "0.3.7", "2.0.0"},
+		{"current tag is not a version", "^1", "latest", "v1.5.0"},
+		{"no newer tag", "^1.4", "v1.5.0", ""},
+		{"never downgrades", "^1.4", "2.0.0", ""},
+		{"pre-release of the range", ">=1.6.0-rc.0 <1.7.0", "v1.5.0", "1.6.0-rc.1"},
+		{"any version", "*", "1.4.2", "2.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := (&ImageWatch{Semver: tt.semver}).NewerTag(tags, tt.current)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("NewerTag() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageWatch_Durations(t *testing.T) {
+	watch := ImageWatch{}
+	if got := watch.IntervalDuration(); got != DefaultImageWatchInterval {
+		t.Errorf("IntervalDuration() = %v, want %v", got, DefaultImageWatchInterval)
+	}
+	if got := watch.CooldownDuration(); got != DefaultImageWatchCooldown {
+		t.Errorf("CooldownDuration() = %v, want %v", got, DefaultImageWatchCooldown)
+	}
+
+	watch = ImageWatch{Interval: "2m", Cooldown: "1h"}
+	if got := watch.IntervalDuration(); got != 2*time.Minute {
+		t.Errorf("IntervalDuration() = %v, want %v", got, 2*time.Minute)
+	}
+	if got := watch.CooldownDuration(); got != time.Hour {
+		t.Errorf("CooldownDuration() = %v, want %v", got, time.Hour)
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultInitContainerTimeout is used when an init container doesn't set a timeout.
+const DefaultInitContainerTimeout = 10 * time.Minute
+
+// InitContainer is a one-shot container, e.g. a database migration, that must run to completion
+// before the app containers of a deployment are started. A non-zero exit code aborts the deployment.
+type InitContainer struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Image defaults to the image being deployed.
+	Image   *Image   `json:"image,omitempty" yaml:"image,omitempty" toml:"image,omitempty"`
+	Command []string `json:"command" yaml:"command" toml:"command"`
+	// Env is added to the app's environment variables, overriding variables with the same name.
+	Env     []EnvVar `json:"env,omitempty" yaml:"env,omitempty" toml:"env,omitempty"`
+	Volumes []string `json:"volumes,omitempty" yaml:"volumes,omitempty" toml:"volumes,omitempty"`
+	// Timeout is a Go duration string, e.g. "30s" or "5m" (default 10m).
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+}
+
+// TimeoutDuration returns the parsed timeout or the default. Call Validate first to get descriptive errors.
+func (ic *InitContainer) TimeoutDuration() (time.Duration, error) {
+	if ic.Timeout == "" {
+		return DefaultInitContainerTimeout, nil
+	}
+	d, err := time.ParseDuration(ic.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got '%s'", ic.Timeout)
+	}
+	return d, nil
+}
+
+func (ic *InitContainer) Validate(format string) error {
+	initContainersField := GetFieldNameForFormat(TargetConfig{}, "InitContainers", format)
+
+	if !isValidAppName(ic.Name) {
+		return fmt.Errorf("%s: invalid name '%s'; must contain only alphanumeric characters, hyphens, and underscores", initContainersField, ic.Name)
+	}
+
+	if len(ic.Command) == 0 || strings.TrimSpace(ic.Command[0]) == "" {
+		return fmt.Errorf("%s '%s': command is required", initContainersField, ic.Name)
+	}
+
+	if ic.Image != nil {
+		if err := ic.Image.Validate(format); err != nil {
+			return fmt.Errorf("%s '%s': %w", initContainersField, ic.Name, err)
+		}
+		if ic.Image.ShouldBuild() {
+			return fmt.Errorf("%s '%s': init container images can't be built, omit the image to use the app image", initContainersField, ic.Name)
+		}
+	}
+
+	for j, envVar := range ic.Env {
+		if err := envVar.Validate(format); err != nil {
+			return fmt.Errorf("%s '%s': env[%d]: %w", initContainersField, ic.Name, j, err)
+		}
+	}
+
+	for _, volume := range ic.Volumes {
+		if err := validateVolume(volume); err != nil {
+			return fmt.Errorf("%s '%s': %w", initContainersField, ic.Name, err)
+		}
+	}
+
+	if _, err := ic.TimeoutDuration(); err != nil {
+		return fmt.Errorf("%s '%s': timeout is invalid: %w", initContainersField, ic.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestInitContainer_Validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		initContainer InitContainer
+		expectError   bool
+		errMsg        string
+	}{
+		{
+			name:          "valid init container using app image",
+			initContainer: InitContainer{Name: "migrate", Command: []string{"./manage.py", "migrate"}, Timeout: "5m"},
+			expectError:   false,
+		},
+		{
+			name: "valid init container with image",
+			initContainer: InitContainer{
+				Name:    "wait-for-db",
+				Image:   &Image{Repository: "busybox"},
+				Command: []string{"sh", "-c", "until nc -z db 5432; do sleep 1; done"},
+			},
+			expectError: false,
+		},
+		{
+			name:          "missing command",
+			initContainer: InitContainer{Name: "migrate"},
+			expectError:   true,
+			errMsg:        "command is required",
+		},
+		{
+			name:          "invalid name",
+			initContainer: InitContainer{Name: "-migrate", Command: []string{"migrate"}},
+			expectError:   true,
+			errMsg:        "invalid name",
+		},
+		{
+			name:          "invalid timeout",
+			initContainer: InitContainer{Name: "migrate", Command: []string{"migrate"}, Timeout: "5 minutes"},
+			expectError:   true,
+			errMsg:        "timeout is invalid",
+		},
+		{
+			name:          "negative timeout",
+			initContainer: InitContainer{Name: "migrate", Command: []string{"migrate"}, Timeout: "-1m"},
+			expectError:   true,
+			errMsg:        "duration must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.initContainer.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestInitContainer_TimeoutDuration(t *testing.T) {
+	ic := InitContainer{}
+	timeout, err := ic.TimeoutDuration()
+	if err != nil || timeout != DefaultInitContainerTimeout {
+		t.Errorf("TimeoutDuration() = %v, %v, want %v", timeout, err, DefaultInitContainerTimeout)
+	}
+
+	ic.Timeout = "90s"
+	timeout, err = ic.TimeoutDuration()
+	if err != nil || timeout != 90*time.Second {
+		t.Errorf("TimeoutDuration() = %v, %v, want %v", timeout, err, 90*time.Second)
+	}
+}
@@ -1,53 +1,151 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/helpers"
 )
 
+// LabelPrefix is the namespace of all labels set by haloy.
+const LabelPrefix = "dev.haloy."
+
+// LabelSchemaVersion is the version of the label format written by ToLabels. Containers without the
+// schema version label were created with version 1, which stores every domain and alias in its own label.
+// Version 2 stores all domains in one JSON encoded label.
+const LabelSchemaVersion = 2
+
 const (
+	// Schema version of the labels of a container, see LabelSchemaVersion.
+	LabelSchema          = "dev.haloy.schema"
 	LabelAppName         = "dev.haloy.appName"
 	LabelDeploymentID    = "dev.haloy.deployment-id"
 	LabelHealthCheckPath = "dev.haloy.health-check-path" // optional default to "/"
 	LabelACMEEmail       = "dev.haloy.acme.email"
-	LabelPort            = "dev.haloy.port" // optional
+	LabelACMEStaging     = "dev.haloy.acme.staging" // optional, "true" requests certificates from the staging CA
+	LabelPort            = "dev.haloy.port"         // optional
+	LabelFrontend        = "dev.haloy.frontend"     // optional, defaults to the public frontends
+	LabelExposure        = "dev.haloy.exposure"     // optional, defaults to public
+	// Optional pool or target group the server is registered with in the external load balancer.
+	LabelExternalLBTarget = "dev.haloy.external-lb-target"
+
+	// Optional health check settings. When the type is not set, the HTTP check against the health check path is used.
+	LabelHealthCheckType        = "dev.haloy.health-check-type"
+	LabelHealthCheckCommand     = "dev.haloy.health-check-command" // JSON encoded list of command arguments
+	LabelHealthCheckGRPCService = "dev.haloy.health-check-grpc-service"
+
+	// Optional health check timing. Durations are stored as Go duration strings.
+	LabelHealthCheckInterval            = "dev.haloy.health-check-interval"
+	LabelHealthCheckTimeout             = "dev.haloy.health-check-timeout"
+	LabelHealthCheckStartPeriod         = "dev.haloy.health-check-start-period"
+	LabelHealthCheckRetries             = "dev.haloy.health-check-retries"
+	LabelHealthCheckRise                = "dev.haloy.health-check-rise"
+	LabelHealthCheckExpectedStatusCodes = "dev.haloy.health-check-expected-status-codes" // Comma separated
+
+	// Optional separate paths for the readiness check before routing and the HAProxy liveness check.
+	LabelHealthCheckReadinessPath = "dev.haloy.health-check-readiness-path"
+	LabelHealthCheckLivenessPath  = "dev.haloy.health-check-liveness-path"
+
+	// Optional warmup requests sent before the container receives traffic.
+	LabelWarmupPaths    = "dev.haloy.warmup-paths" // JSON encoded list of paths
+	LabelWarmupRequests = "dev.haloy.warmup-requests"
 
-	// Format strings for indexed canonical domains and aliases.
+	// Optional connection limits and queueing in HAProxy.
+	LabelMaxConnections           = "dev.haloy.max-connections"
+	LabelMaxConnectionsPerReplica = "dev.haloy.max-connections-per-replica"
+	LabelMaxQueue                 = "dev.haloy.max-queue"
+	LabelQueueTimeout             = "dev.haloy.queue-timeout"
+
+	// Optional app that a percentage of the requests is mirrored to.
+	LabelShadowTo         = "dev.haloy.shadow-to"
+	LabelShadowPercentage = "dev.haloy.shadow-percentage"
+
+	// JSON encoded list of the domains, see Domain. Replaces the indexed domain labels in schema version 2.
+	LabelDomains = "dev.haloy.domains"
+
+	// Format strings for indexed canonical domains and aliases, only read from containers with schema version 1.
 	// Use fmt.Sprintf(LabelDomainCanonical, index) to get "dev.haloy.domain.<index>"
 	LabelDomainCanonical = "dev.haloy.domain.%d"
 	// Use fmt.Sprintf(LabelDomainAlias, domainIndex, aliasIndex) to get "dev.haloy.domain.<domainIndex>.alias.<aliasIndex>"
 	LabelDomainAlias = "dev.haloy.domain.%d.alias.%d"
+	// Use fmt.Sprintf(LabelDomainTLS, domainIndex) to get "dev.haloy.domain.<domainIndex>.tls", only set when TLS is disabled.
+	LabelDomainTLS = "dev.haloy.domain.%d.tls"
+	// Use fmt.Sprintf(LabelDomainKeyType, domainIndex) to get "dev.haloy.domain.<domainIndex>.key-type", only set when the domain sets a key type.
+	LabelDomainKeyType = "dev.haloy.domain.%d.key-type"
 	// Used to identify the role of the container (e.g., "haproxy", "haloyd", etc.)
 	LabelRole = "dev.haloy.role"
+	// Name of the sidecar as configured in the app config. Only set on sidecar containers.
+	LabelSidecarName = "dev.haloy.sidecar-name"
+	// Name of the init container as configured in the app config. Only set on init containers.
+	LabelInitContainerName = "dev.haloy.init-container-name"
+	// JSON encoded list of the keys of the labels from the app config, which tells them apart from the
+	// labels of the image. Only set on app containers.
+	LabelAppLabelKeys = "dev.haloy.app-label-keys"
 )
 
 const (
 	HAProxyLabelRole = "haproxy"
+	CaddyLabelRole   = "caddy"
 	HaloydLabelRole  = "haloyd"
 	AppLabelRole     = "app"
+	SidecarLabelRole = "sidecar"
+	InitLabelRole    = "init"
+	// Containers of the variant deployment of an A/B test. They're routed by the A/B test only, and
+	// aren't taken for the deployment of the app.
+	ABVariantLabelRole = "ab-variant"
 )
 
 type ContainerLabels struct {
-	AppName         string
-	DeploymentID    string
-	HealthCheckPath string
-	ACMEEmail       string
-	Port            Port
-	Domains         []Domain
-	Role            string
+	AppName                string
+	DeploymentID           string
+	HealthCheckPath        string
+	HealthCheckType        HealthCheckType
+	HealthCheckCommand     []string
+	HealthCheckGRPCService string
+	// Zero values mean the default is used.
+	HealthCheckInterval            time.Duration
+	HealthCheckTimeout             time.Duration
+	HealthCheckStartPeriod         time.Duration
+	HealthCheckRetries             int
+	HealthCheckRise                int
+	HealthCheckExpectedStatusCodes []int
+	HealthCheckReadinessPath       string
+	HealthCheckLivenessPath        string
+	WarmupPaths                    []string
+	WarmupRequests                 int
+	MaxConnections                 int
+	MaxConnectionsPerReplica       int
+	MaxQueue                       int
+	QueueTimeout                   time.Duration
+	ShadowTo                       string
+	ShadowPercentage               int
+	ACMEEmail                      string
+	ACMEStaging                    bool
+	Port                           Port
+	Domains                        []Domain
+	Frontend                       string
+	ExternalLBTarget               string
+	Exposure                       Exposure
+	Role                           string
 }
 
 // Parse from docker labels to ContainerLabels struct.
 func ParseContainerLabels(labels map[string]string) (*ContainerLabels, error) {
 	cl := &ContainerLabels{
-		AppName:      labels[LabelAppName],
-		DeploymentID: labels[LabelDeploymentID],
-		ACMEEmail:    labels[LabelACMEEmail],
-		Role:         labels[LabelRole],
+		AppName:          labels[LabelAppName],
+		DeploymentID:     labels[LabelDeploymentID],
+		ACMEEmail:        labels[LabelACMEEmail],
+		ACMEStaging:      labels[LabelACMEStaging] == "true",
+		Frontend:         labels[LabelFrontend],
+		ShadowTo:         labels[LabelShadowTo],
+		ExternalLBTarget: labels[LabelExternalLBTarget],
+		Exposure:         Exposure(labels[LabelExposure]),
+		Role:             labels[LabelRole],
 	}
 
 	if v, ok := labels[LabelPort]; ok {
@@ -63,7 +161,98 @@ func ParseContainerLabels(labels map[string]string) (*ContainerLabels, error) {
 		cl.HealthCheckPath = constants.DefaultHealthCheckPath
 	}
 
-	// Parse domains
+	cl.HealthCheckType = HealthCheckType(labels[LabelHealthCheckType])
+	cl.HealthCheckGRPCService = labels[LabelHealthCheckGRPCService]
+	cl.HealthCheckReadinessPath = labels[LabelHealthCheckReadinessPath]
+	cl.HealthCheckLivenessPath = labels[LabelHealthCheckLivenessPath]
+	if v, ok := labels[LabelWarmupPaths]; ok && v != "" {
+		if err := json.Unmarshal([]byte(v), &cl.WarmupPaths); err != nil {
+			return nil, fmt.Errorf("invalid warmup paths label: %w", err)
+		}
+	}
+	if v, ok := labels[LabelHealthCheckCommand]; ok && v != "" {
+		if err := json.Unmarshal([]byte(v), &cl.HealthCheckCommand); err != nil {
+			return nil, fmt.Errorf("invalid health check command label: %w", err)
+		}
+	}
+
+	durationLabels := map[string]*time.Duration{
+		LabelHealthCheckInterval:    &cl.HealthCheckInterval,
+		LabelHealthCheckTimeout:     &cl.HealthCheckTimeout,
+		LabelHealthCheckStartPeriod: &cl.HealthCheckStartPeriod,
+		LabelQueueTimeout:           &cl.QueueTimeout,
+	}
+	for label, target := range durationLabels {
+		if v, ok := labels[label]; ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s label: %w", label, err)
+			}
+			*target = d
+		}
+	}
+
+	intLabels := map[string]*int{
+		LabelHealthCheckRetries:       &cl.HealthCheckRetries,
+		LabelHealthCheckRise:          &cl.HealthCheckRise,
+		LabelWarmupRequests:           &cl.WarmupRequests,
+		LabelMaxConnections:           &cl.MaxConnections,
+		LabelMaxConnectionsPerReplica: &cl.MaxConnectionsPerReplica,
+		LabelMaxQueue:                 &cl.MaxQueue,
+		LabelShadowPercentage:         &cl.ShadowPercentage,
+	}
+	for label, target := range intLabels {
+		if v, ok := labels[label]; ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s label: %w", label, err)
+			}
+			*target = n
+		}
+	}
+
+	if v, ok := labels[LabelHealthCheckExpectedStatusCodes]; ok && v != "" {
+		for code := range strings.SplitSeq(v, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s label: %w", LabelHealthCheckExpectedStatusCodes, err)
+			}
+			cl.HealthCheckExpectedStatusCodes = append(cl.HealthCheckExpectedStatusCodes, n)
+		}
+	}
+
+	version := 1
+	if v, ok := labels[LabelSchema]; ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid %s label '%s'", LabelSchema, v)
+		}
+		version = n
+	}
+
+	// Newer schema versions are read like the current one, so a downgraded haloyd still routes the
+	// containers a newer version created. Labels added in them are ignored.
+	if version >= 2 {
+		if v, ok := labels[LabelDomains]; ok && v != "" {
+			if err := json.Unmarshal([]byte(v), &cl.Domains); err != nil {
+				return nil, fmt.Errorf("invalid %s label: %w", LabelDomains, err)
+			}
+		}
+	} else {
+		cl.Domains = parseIndexedDomainLabels(labels)
+	}
+
+	// Validate the parsed labels.
+	if err := cl.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cl, nil
+}
+
+// parseIndexedDomainLabels reads the domains of containers with schema version 1, which have a label per
+// canonical domain, alias, tls and key type setting.
+func parseIndexedDomainLabels(labels map[string]string) []Domain {
 	domainMap := make(map[int]*Domain)
 
 	// Process domain and alias labels.
@@ -71,7 +260,23 @@ func ParseContainerLabels(labels map[string]string) (*ContainerLabels, error) {
 		if !strings.HasPrefix(key, "dev.haloy.domain.") {
 			continue
 		}
-		if strings.Contains(key, ".alias.") {
+		if strings.HasSuffix(key, ".tls") {
+			// Parse TLS key: "dev.haloy.domain.<domainIdx>.tls"
+			var domainIdx int
+			if _, err := fmt.Sscanf(key, LabelDomainTLS, &domainIdx); err != nil {
+				continue
+			}
+			domain := getOrCreateDomain(domainMap, domainIdx)
+			domain.TLS = value
+		} else if strings.HasSuffix(key, ".key-type") {
+			// Parse key type key: "dev.haloy.domain.<domainIdx>.key-type"
+			var domainIdx int
+			if _, err := fmt.Sscanf(key, LabelDomainKeyType, &domainIdx); err != nil {
+				continue
+			}
+			domain := getOrCreateDomain(domainMap, domainIdx)
+			domain.KeyType = value
+		} else if strings.Contains(key, ".alias.") {
 			// Parse alias key: "dev.haloy.domain.<domainIdx>.alias.<aliasIdx>"
 			var domainIdx, aliasIdx int
 			if _, err := fmt.Sscanf(key, LabelDomainAlias, &domainIdx, &aliasIdx); err != nil {
@@ -97,16 +302,11 @@ func ParseContainerLabels(labels map[string]string) (*ContainerLabels, error) {
 		indices = append(indices, i)
 	}
 	sort.Ints(indices)
+	var domains []Domain
 	for _, i := range indices {
-		cl.Domains = append(cl.Domains, *domainMap[i])
+		domains = append(domains, *domainMap[i])
 	}
-
-	// Validate the parsed labels.
-	if err := cl.Validate(); err != nil {
-		return nil, err
-	}
-
-	return cl, nil
+	return domains
 }
 
 // getOrCreateDomain returns an existing *config.Domain from domainMap or creates a new one.
@@ -121,6 +321,7 @@ func getOrCreateDomain(domainMap map[int]*Domain, idx int) *Domain {
 // ToLabels converts the ContainerLabels struct back to a map[string]string.
 func (cl *ContainerLabels) ToLabels() map[string]string {
 	labels := map[string]string{
+		LabelSchema:          strconv.Itoa(LabelSchemaVersion),
 		LabelAppName:         cl.AppName,
 		LabelDeploymentID:    cl.DeploymentID,
 		LabelHealthCheckPath: cl.HealthCheckPath,
@@ -129,17 +330,85 @@ func (cl *ContainerLabels) ToLabels() map[string]string {
 		LabelRole:            cl.Role,
 	}
 
-	// Iterate through the domains slice.
-	for i, domain := range cl.Domains {
-		// Set canonical domain.
-		canonicalKey := fmt.Sprintf(LabelDomainCanonical, i)
-		labels[canonicalKey] = domain.Canonical
-
-		// Set aliases.
-		for j, alias := range domain.Aliases {
-			aliasKey := fmt.Sprintf(LabelDomainAlias, i, j)
-			labels[aliasKey] = alias
+	if cl.ACMEStaging {
+		labels[LabelACMEStaging] = "true"
+	}
+	if cl.Frontend != "" {
+		labels[LabelFrontend] = cl.Frontend
+	}
+	if cl.ExternalLBTarget != "" {
+		labels[LabelExternalLBTarget] = cl.ExternalLBTarget
+	}
+	if cl.Exposure != "" {
+		labels[LabelExposure] = string(cl.Exposure)
+	}
+	if cl.HealthCheckType != "" {
+		labels[LabelHealthCheckType] = string(cl.HealthCheckType)
+	}
+	if len(cl.HealthCheckCommand) > 0 {
+		// Marshalling a slice of strings can't fail.
+		command, _ := json.Marshal(cl.HealthCheckCommand)
+		labels[LabelHealthCheckCommand] = string(command)
+	}
+	if cl.HealthCheckGRPCService != "" {
+		labels[LabelHealthCheckGRPCService] = cl.HealthCheckGRPCService
+	}
+	if cl.HealthCheckReadinessPath != "" {
+		labels[LabelHealthCheckReadinessPath] = cl.HealthCheckReadinessPath
+	}
+	if cl.HealthCheckLivenessPath != "" {
+		labels[LabelHealthCheckLivenessPath] = cl.HealthCheckLivenessPath
+	}
+	if len(cl.WarmupPaths) > 0 {
+		paths, _ := json.Marshal(cl.WarmupPaths)
+		labels[LabelWarmupPaths] = string(paths)
+	}
+	if cl.WarmupRequests > 0 {
+		labels[LabelWarmupRequests] = strconv.Itoa(cl.WarmupRequests)
+	}
+	if cl.MaxConnections > 0 {
+		labels[LabelMaxConnections] = strconv.Itoa(cl.MaxConnections)
+	}
+	if cl.MaxConnectionsPerReplica > 0 {
+		labels[LabelMaxConnectionsPerReplica] = strconv.Itoa(cl.MaxConnectionsPerReplica)
+	}
+	if cl.MaxQueue > 0 {
+		labels[LabelMaxQueue] = strconv.Itoa(cl.MaxQueue)
+	}
+	if cl.QueueTimeout > 0 {
+		labels[LabelQueueTimeout] = cl.QueueTimeout.String()
+	}
+	if cl.ShadowTo != "" {
+		labels[LabelShadowTo] = cl.ShadowTo
+		labels[LabelShadowPercentage] = strconv.Itoa(cl.ShadowPercentage)
+	}
+	if cl.HealthCheckInterval > 0 {
+		labels[LabelHealthCheckInterval] = cl.HealthCheckInterval.String()
+	}
+	if cl.HealthCheckTimeout > 0 {
+		labels[LabelHealthCheckTimeout] = cl.HealthCheckTimeout.String()
+	}
+	if cl.HealthCheckStartPeriod > 0 {
+		labels[LabelHealthCheckStartPeriod] = cl.HealthCheckStartPeriod.String()
+	}
+	if cl.HealthCheckRetries > 0 {
+		labels[LabelHealthCheckRetries] = strconv.Itoa(cl.HealthCheckRetries)
+	}
+	if cl.HealthCheckRise > 0 {
+		labels[LabelHealthCheckRise] = strconv.Itoa(cl.HealthCheckRise)
+	}
+	if len(cl.HealthCheckExpectedStatusCodes) > 0 {
+		codes := make([]string, len(cl.HealthCheckExpectedStatusCodes))
+		for i, code := range cl.HealthCheckExpectedStatusCodes {
+			codes[i] = strconv.Itoa(code)
 		}
+		labels[LabelHealthCheckExpectedStatusCodes] = strings.Join(codes, ",")
+	}
+
+	if len(cl.Domains) > 0 {
+		// Marshalling domains can't fail, they only contain strings.
+		domains, _ := json.Marshal(cl.Domains)
+		labels[LabelDomains] = string(domains)
 	}
 
 	return labels
@@ -170,8 +439,8 @@ func (cl *ContainerLabels) Validate() error {
 		return fmt.Errorf("port is required")
 	}
 
-	if cl.Role != AppLabelRole {
-		return fmt.Errorf("role must be '%s'", AppLabelRole)
+	if cl.Role != AppLabelRole && cl.Role != ABVariantLabelRole {
+		return fmt.Errorf("role must be '%s' or '%s'", AppLabelRole, ABVariantLabelRole)
 	}
 
 	return nil
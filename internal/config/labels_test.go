@@ -0,0 +1,120 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainerLabels_RoundTrip(t *testing.T) {
+	cl := &ContainerLabels{
+		AppName:         "my-app",
+		DeploymentID:    "01K2Z3ZK0GQ5X8Y4N2V6T9W1AB",
+		HealthCheckPath: "/health",
+		Port:            "3000",
+		Role:            AppLabelRole,
+		Domains: []Domain{
+			{Canonical: "example.com", Aliases: []string{"www.example.com", "example.net"}, KeyType: "ec256"},
+			{Canonical: "internal.example.com", TLS: "disabled"},
+		},
+	}
+
+	labels := cl.ToLabels()
+	if labels[LabelSchema] != "2" {
+		t.Errorf("ToLabels() %s = %q, expected %q", LabelSchema, labels[LabelSchema], "2")
+	}
+	for key := range labels {
+		if strings.HasPrefix(key, "dev.haloy.domain.") {
+			t.Errorf("ToLabels() wrote indexed domain label %s", key)
+		}
+	}
+
+	parsed, err := ParseContainerLabels(labels)
+	if err != nil {
+		t.Fatalf("ParseContainerLabels() error = %v", err)
+	}
+	if !reflect.DeepEqual(parsed.Domains, cl.Domains) {
+		t.Errorf("ParseContainerLabels() domains = %+v, expected %+v", parsed.Domains, cl.Domains)
+	}
+}
+
+func TestParseContainerLabels_SchemaVersion1(t *testing.T) {
+	// Labels of a container created before the schema version label was added.
+	labels := map[string]string{
+		LabelAppName:                  "my-app",
+		LabelDeploymentID:             "01K2Z3ZK0GQ5X8Y4N2V6T9W1AB",
+		LabelRole:                     AppLabelRole,
+		"dev.haloy.domain.0":          "example.com",
+		"dev.haloy.domain.0.alias.0":  "www.example.com",
+		"dev.haloy.domain.0.key-type": "rsa4096",
+		"dev.haloy.domain.1":          "internal.example.com",
+		"dev.haloy.domain.1.tls":      "disabled",
+	}
+
+	parsed, err := ParseContainerLabels(labels)
+	if err != nil {
+		t.Fatalf("ParseContainerLabels() error = %v", err)
+	}
+	expected := []Domain{
+		{Canonical: "example.com", Aliases: []string{"www.example.com"}, KeyType: "rsa4096"},
+		{Canonical: "internal.example.com", TLS: "disabled"},
+	}
+	if !reflect.DeepEqual(parsed.Domains, expected) {
+		t.Errorf("ParseContainerLabels() domains = %+v, expected %+v", parsed.Domains, expected)
+	}
+}
+
+func TestParseContainerLabels_Schema(t *testing.T) {
+	base := map[string]string{
+		LabelAppName:      "my-app",
+		LabelDeploymentID: "01K2Z3ZK0GQ5X8Y4N2V6T9W1AB",
+		LabelRole:         AppLabelRole,
+		LabelDomains:      `[{"domain":"example.com"}]`,
+	}
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr string
+	}{
+		{
+			name:   "newer schema version is read with the current format",
+			labels: map[string]string{LabelSchema: "3", "dev.haloy.future-setting": "on"},
+		},
+		{
+			name:    "invalid schema version",
+			labels:  map[string]string{LabelSchema: "two"},
+			wantErr: "invalid dev.haloy.schema label",
+		},
+		{
+			name:    "invalid domains label",
+			labels:  map[string]string{LabelSchema: "2", LabelDomains: "example.com"},
+			wantErr: "invalid dev.haloy.domains label",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := make(map[string]string)
+			for k, v := range base {
+				labels[k] = v
+			}
+			for k, v := range tt.labels {
+				labels[k] = v
+			}
+
+			parsed, err := ParseContainerLabels(labels)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseContainerLabels() error = %v, expected it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseContainerLabels() error = %v", err)
+			}
+			if len(parsed.Domains) != 1 || parsed.Domains[0].Canonical != "example.com" {
+				t.Errorf("ParseContainerLabels() domains = %+v, expected example.com", parsed.Domains)
+			}
+		})
+	}
+}
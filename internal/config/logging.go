@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Logging configures the Docker log driver used for the app containers.
+type Logging struct {
+	// Driver is the Docker log driver, e.g. "json-file", "local", "journald" or "fluentd". Defaults to the daemon default.
+	Driver string `json:"driver,omitempty" yaml:"driver,omitempty" toml:"driver,omitempty"`
+	// Tag is used by drivers that support it to identify the log source, e.g. "{{.Name}}".
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty" toml:"tag,omitempty"`
+	// MaxSize and MaxFile configure log rotation for the json-file and local drivers.
+	MaxSize string `json:"maxSize,omitempty" yaml:"max_size,omitempty" toml:"max_size,omitempty"`
+	MaxFile *int   `json:"maxFile,omitempty" yaml:"max_file,omitempty" toml:"max_file,omitempty"`
+	// Options are passed to the log driver as is, e.g. fluentd-address.
+	Options map[string]string `json:"options,omitempty" yaml:"options,omitempty" toml:"options,omitempty"`
+}
+
+var logMaxSizeRegex = regexp.MustCompile(`^[0-9]+[kmg]?$`)
+
+// DriverOptions returns the options passed to the log driver.
+func (l *Logging) DriverOptions() map[string]string {
+	options := make(map[string]string, len(l.Options)+3)
+	maps.Copy(options, l.Options)
+	if l.Tag != "" {
+		options["tag"] = l.Tag
+	}
+	if l.MaxSize != "" {
+		options["max-size"] = l.MaxSize
+	}
+	if l.MaxFile != nil {
+		options["max-file"] = strconv.Itoa(*l.MaxFile)
+	}
+	return options
+}
+
+func (l *Logging) Validate(format string) error {
+	loggingField := GetFieldNameForFormat(TargetConfig{}, "Logging", format)
+
+	if strings.ContainsAny(l.Driver, " \t\n\r") {
+		return fmt.Errorf("%s.driver '%s' contains whitespace", loggingField, l.Driver)
+	}
+
+	if l.MaxSize != "" || l.MaxFile != nil {
+		if l.Driver != "" && l.Driver != "json-file" && l.Driver != "local" {
+			return fmt.Errorf("%s: %s and %s can only be used with the json-file and local drivers", loggingField,
+				GetFieldNameForFormat(Logging{}, "MaxSize", format), GetFieldNameForFormat(Logging{}, "MaxFile", format))
+		}
+	}
+
+	if l.MaxSize != "" && !logMaxSizeRegex.MatchString(l.MaxSize) {
+		return fmt.Errorf("%s.%s '%s' is invalid; expected a size like '10m'", loggingField, GetFieldNameForFormat(Logging{}, "MaxSize", format), l.MaxSize)
+	}
+
+	if l.MaxFile != nil && *l.MaxFile < 1 {
+		return fmt.Errorf("%s.%s must be at least 1", loggingField, GetFieldNameForFormat(Logging{}, "MaxFile", format))
+	}
+
+	for key := range l.Options {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%s.options cannot contain an empty key", loggingField)
+		}
+	}
+
+	return nil
+}
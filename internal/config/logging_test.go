@@ -0,0 +1,86 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestLogging_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		logging     Logging
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:        "json-file with rotation",
+			logging:     Logging{Driver: "json-file", MaxSize: "10m", MaxFile: helpers.IntPtr(3)},
+			expectError: false,
+		},
+		{
+			name:        "rotation with default driver",
+			logging:     Logging{MaxSize: "500k"},
+			expectError: false,
+		},
+		{
+			name:        "fluentd with options",
+			logging:     Logging{Driver: "fluentd", Tag: "{{.Name}}", Options: map[string]string{"fluentd-address": "localhost:24224"}},
+			expectError: false,
+		},
+		{
+			name:        "rotation with journald",
+			logging:     Logging{Driver: "journald", MaxFile: helpers.IntPtr(3)},
+			expectError: true,
+			errMsg:      "can only be used with the json-file and local drivers",
+		},
+		{
+			name:        "invalid max size",
+			logging:     Logging{MaxSize: "10 MB"},
+			expectError: true,
+			errMsg:      "expected a size like '10m'",
+		},
+		{
+			name:        "zero max file",
+			logging:     Logging{MaxFile: helpers.IntPtr(0)},
+			expectError: true,
+			errMsg:      "must be at least 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.logging.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLogging_DriverOptions(t *testing.T) {
+	logging := Logging{
+		Tag:     "myapp",
+		MaxSize: "10m",
+		MaxFile: helpers.IntPtr(3),
+		Options: map[string]string{"compress": "true"},
+	}
+	expected := map[string]string{
+		"tag":      "myapp",
+		"max-size": "10m",
+		"max-file": "3",
+		"compress": "true",
+	}
+	if options := logging.DriverOptions(); !reflect.DeepEqual(options, expected) {
+		t.Errorf("DriverOptions() = %v, want %v", options, expected)
+	}
+}
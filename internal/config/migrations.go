@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+)
+
+// FieldMigration maps a deprecated app config field to the field that replaced it.
+// From and To are dotted paths with the yaml and toml names, json configs use the
+// same paths in camelCase. A path may move a field into or out of a section, e.g.
+// acme.email became acme_email.
+type FieldMigration struct {
+	From string
+	To   string
+	// Target fields are also migrated in every entry of targets.
+	Target bool
+}
+
+// AppConfigMigrations lists the deprecated app config fields that are still read.
+// Configs using them load with a warning and are rewritten by 'haloy config migrate'.
+var AppConfigMigrations = []FieldMigration{
+	// The server and its token were called the manager before haloyd.
+	{From: "manager", To: "server", Target: true},
+	{From: "manager_token", To: "api_token", Target: true},
+	{From: "healthcheck_path", To: "health_check_path", Target: true},
+	{From: "acme.email", To: "acme_email", Target: true},
+	{From: "acme.staging", To: "acme_staging", Target: true},
+	{From: "pre_deploy_hooks", To: "global_pre_deploy"},
+	{From: "post_deploy_hooks", To: "global_post_deploy"},
+}
+
+// FromPath returns the path of the deprecated field for the config format.
+func (m FieldMigration) FromPath(format string) []string {
+	return migrationPath(m.From, format)
+}
+
+// ToPath returns the path of the current field for the config format.
+func (m FieldMigration) ToPath(format string) []string {
+	return migrationPath(m.To, format)
+}
+
+func migrationPath(path, format string) []string {
+	parts := strings.Split(path, ".")
+	if format == "json" {
+		for i, part := range parts {
+			parts[i] = snakeToCamel(part)
+		}
+	}
+	return parts
+}
+
+func snakeToCamel(s string) string {
+	words := strings.Split(s, "_")
+	for i := 1; i < len(words); i++ {
+		if words[i] != "" {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	return strings.Join(words, "")
+}
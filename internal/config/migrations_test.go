@@ -0,0 +1,44 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFieldMigrationPaths(t *testing.T) {
+	migration := FieldMigration{From: "acme.email", To: "acme_email"}
+
+	tests := []struct {
+		format string
+		from   []string
+		to     []string
+	}{
+		{format: "yaml", from: []string{"acme", "email"}, to: []string{"acme_email"}},
+		{format: "toml", from: []string{"acme", "email"}, to: []string{"acme_email"}},
+		{format: "json", from: []string{"acme", "email"}, to: []string{"acmeEmail"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := migration.FromPath(tt.format); !slices.Equal(got, tt.from) {
+				t.Errorf("FromPath() = %v, want %v", got, tt.from)
+			}
+			if got := migration.ToPath(tt.format); !slices.Equal(got, tt.to) {
+				t.Errorf("ToPath() = %v, want %v", got, tt.to)
+			}
+		})
+	}
+}
+
+func TestAppConfigMigrationsUseKnownFields(t *testing.T) {
+	for _, migration := range AppConfigMigrations {
+		for _, format := range []string{"yaml", "json"} {
+			to := strings.Join(migration.ToPath(format), ".")
+			if err := CheckUnknownFields(reflect.TypeOf(AppConfig{}), []string{to}, format); err != nil {
+				t.Errorf("migration %s -> %s: %v", migration.From, migration.To, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+const DefaultSMTPPort = 587
+
+// DefaultNotificationEvents are the event types emailed by rules that don't list any.
+var DefaultNotificationEvents = []string{"deployment.failed", "deployment.rollback", "cert.expiring"}
+
+// NotificationsConfig emails server events, e.g. failed deployments, to team addresses over SMTP.
+type NotificationsConfig struct {
+	SMTP  SMTPConfig         `json:"smtp,omitempty" yaml:"smtp,omitempty" toml:"smtp,omitempty"`
+	Rules []NotificationRule `json:"rules,omitempty" yaml:"rules,omitempty" toml:"rules,omitempty"`
+}
+
+// SMTPConfig is the mail server notifications are sent through. The password is read from
+// HALOY_SMTP_PASSWORD in the environment of the haloyd container.
+type SMTPConfig struct {
+	Host string `json:"host,omitempty" yaml:"host,omitempty" toml:"host,omitempty"`
+	// Port defaults to 587 with STARTTLS. Port 465 connects with TLS right away.
+	Port     int    `json:"port,omitempty" yaml:"port,omitempty" toml:"port,omitempty"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty"`
+	From     string `json:"from,omitempty" yaml:"from,omitempty" toml:"from,omitempty"`
+}
+
+// NotificationRule emails the matching events to the listed addresses.
+type NotificationRule struct {
+	Email []string `json:"email" yaml:"email" toml:"email"`
+	// Apps limits the rule to the events of these apps, all apps when empty. Certificate events belong
+	// to the app serving the domain.
+	Apps []string `json:"apps,omitempty" yaml:"apps,omitempty" toml:"apps,omitempty"`
+	// Events are event types or prefixes, e.g. "deployment". Defaults to DefaultNotificationEvents.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty" toml:"events,omitempty"`
+}
+
+// Enabled reports whether any rule is configured.
+func (n NotificationsConfig) Enabled() bool {
+	return len(n.Rules) > 0
+}
+
+// EventTypes returns the event types or prefixes of the rule.
+func (r NotificationRule) EventTypes() []string {
+	if len(r.Events) == 0 {
+		return DefaultNotificationEvents
+	}
+	return r.Events
+}
+
+func (n NotificationsConfig) Validate() error {
+	if !n.Enabled() {
+		return nil
+	}
+
+	if n.SMTP.Host == "" {
+		return fmt.Errorf("notifications.smtp.host is required when notification rules are configured")
+	}
+	if n.SMTP.Port < 0 || n.SMTP.Port > 65535 {
+		return fmt.Errorf("invalid notifications.smtp.port %d, must be between 1 and 65535", n.SMTP.Port)
+	}
+	if !helpers.IsValidEmail(n.SMTP.From) {
+		return fmt.Errorf("invalid notifications.smtp.from '%s', must be an email address", n.SMTP.From)
+	}
+
+	for i, rule := range n.Rules {
+		if len(rule.Email) == 0 {
+			return fmt.Errorf("notifications.rules[%d]: email is required", i)
+		}
+		for _, address := range rule.Email {
+			if !helpers.IsValidEmail(address) {
+				return fmt.Errorf("notifications.rules[%d]: invalid email '%s'", i, address)
+			}
+		}
+		for _, eventType := range rule.Events {
+			if eventType == "" || strings.ContainsAny(eventType, " \t,") {
+				return fmt.Errorf("notifications.rules[%d]: invalid event '%s', must be an event type like deployment.failed", i, eventType)
+			}
+		}
+		for _, app := range rule.Apps {
+			if strings.TrimSpace(app) == "" {
+				return fmt.Errorf("notifications.rules[%d]: apps cannot contain an empty name", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SMTPPort returns the SMTP port, defaulting to DefaultSMTPPort.
+func (s SMTPConfig) SMTPPort() int {
+	if s.Port == 0 {
+		return DefaultSMTPPort
+	}
+	return s.Port
+}
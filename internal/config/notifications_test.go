@@ -0,0 +1,99 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestNotificationsConfig_Validate(t *testing.T) {
+	smtp := SMTPConfig{Host: "smtp.example.com", From: "haloy@example.com"}
+
+	tests := []struct {
+		name          string
+		notifications NotificationsConfig
+		expectError   bool
+		errMsg        string
+	}{
+		{
+			name:          "disabled",
+			notifications: NotificationsConfig{},
+		},
+		{
+			name: "rule with defaults",
+			notifications: NotificationsConfig{
+				SMTP:  smtp,
+				Rules: []NotificationRule{{Email: []string{"team@example.com"}}},
+			},
+		},
+		{
+			name: "rule for apps and events",
+			notifications: NotificationsConfig{
+				SMTP:  SMTPConfig{Host: "smtp.example.com", Port: 465, Username: "haloy", From: "haloy@example.com"},
+				Rules: []NotificationRule{{Email: []string{"team@example.com"}, Apps: []string{"api"}, Events: []string{"deployment"}}},
+			},
+		},
+		{
+			name: "missing host",
+			notifications: NotificationsConfig{
+				SMTP:  SMTPConfig{From: "haloy@example.com"},
+				Rules: []NotificationRule{{Email: []string{"team@example.com"}}},
+			},
+			expectError: true,
+			errMsg:      "smtp.host is required",
+		},
+		{
+			name: "invalid from",
+			notifications: NotificationsConfig{
+				SMTP:  SMTPConfig{Host: "smtp.example.com", From: "haloy"},
+				Rules: []NotificationRule{{Email: []string{"team@example.com"}}},
+			},
+			expectError: true,
+			errMsg:      "invalid notifications.smtp.from",
+		},
+		{
+			name: "rule without email",
+			notifications: NotificationsConfig{
+				SMTP:  smtp,
+				Rules: []NotificationRule{{Apps: []string{"api"}}},
+			},
+			expectError: true,
+			errMsg:      "email is required",
+		},
+		{
+			name: "invalid recipient",
+			notifications: NotificationsConfig{
+				SMTP:  smtp,
+				Rules: []NotificationRule{{Email: []string{"team"}}},
+			},
+			expectError: true,
+			errMsg:      "invalid email 'team'",
+		},
+		{
+			name: "invalid event",
+			notifications: NotificationsConfig{
+				SMTP:  smtp,
+				Rules: []NotificationRule{{Email: []string{"team@example.com"}, Events: []string{"deployment.failed, cert.expiring"}}},
+			},
+			expectError: true,
+			errMsg:      "invalid event",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.notifications.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
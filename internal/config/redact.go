@@ -0,0 +1,170 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// RedactValue replaces a value that may be a secret with a short hash of it, so two values can be
+// compared without revealing them.
+func RedactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// MaskedValue replaces literal secret values in exported configs.
+const MaskedValue = "<masked>"
+
+// Redacted returns a copy of the target config with the values of environment variables, build
+// arguments, the API token, the deploy webhook secret and registry credentials replaced by RedactValue.
+func (tc TargetConfig) Redacted() (TargetConfig, error) {
+	return tc.replaceValues(RedactValue)
+}
+
+// Masked returns a copy of the target config with the same values as Redacted replaced by MaskedValue.
+// References to secret providers are kept.
+func (tc TargetConfig) Masked() (TargetConfig, error) {
+	return tc.replaceValues(func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return MaskedValue
+	})
+}
+
+// HasMaskedValues reports whether any value of the target config was masked on export.
+func (tc TargetConfig) HasMaskedValues() bool {
+	masked := false
+	tc.visitValueSources(func(valueSource *ValueSource) {
+		masked = masked || valueSource.Value == MaskedValue
+	})
+	return masked
+}
+
+// HasUnresolvedValues reports whether a value references an environment variable or a secret provider and
+// wasn't resolved.
+func (tc TargetConfig) HasUnresolvedValues() bool {
+	unresolved := false
+	tc.visitValueSources(func(valueSource *ValueSource) {
+		unresolved = unresolved || (valueSource.From != nil && valueSource.Value == "")
+	})
+	return unresolved
+}
+
+// SecretReferences returns the sorted secret provider references, e.g. "onepassword:prod.db-password",
+// used by the target config.
+func (tc TargetConfig) SecretReferences() []string {
+	seen := make(map[string]bool)
+	tc.visitValueSources(func(valueSource *ValueSource) {
+		if valueSource.From != nil && valueSource.From.Secret != "" {
+			seen[valueSource.From.Secret] = true
+		}
+	})
+	return slices.Sorted(maps.Keys(seen))
+}
+
+// SecretValues returns the values of the secret provider references of the target config by reference,
+// taken from resolved, the same target config with the values resolved.
+func (tc TargetConfig) SecretValues(resolved TargetConfig) (map[string]string, error) {
+	var references []*ValueSource
+	tc.visitValueSources(func(valueSource *ValueSource) {
+		references = append(references, valueSource)
+	})
+	var values []*ValueSource
+	resolved.visitValueSources(func(valueSource *ValueSource) {
+		values = append(values, valueSource)
+	})
+	if len(references) != len(values) {
+		return nil, fmt.Errorf("resolved config of %s doesn't match its references", tc.Name)
+	}
+
+	secretValues := make(map[string]string)
+	for i, reference := range references {
+		if reference.From != nil && reference.From.Secret != "" && values[i].From == nil {
+			secretValues[reference.From.Secret] = values[i].Value
+		}
+	}
+	return secretValues, nil
+}
+
+// ResolveSecretReferences sets the unresolved secret provider references of the target config to the values
+// returned by lookup. It returns the references lookup didn't find.
+func (tc *TargetConfig) ResolveSecretReferences(lookup func(reference string) (string, bool)) []string {
+	missing := make(map[string]bool)
+	tc.visitValueSources(func(valueSource *ValueSource) {
+		if valueSource.From == nil || valueSource.From.Secret == "" || valueSource.Value != "" {
+			return
+		}
+		if value, ok := lookup(valueSource.From.Secret); ok {
+			valueSource.Value = value
+			valueSource.From = nil
+		} else {
+			missing[valueSource.From.Secret] = true
+		}
+	})
+	return slices.Sorted(maps.Keys(missing))
+}
+
+func (tc TargetConfig) replaceValues(replace func(string) string) (TargetConfig, error) {
+	var replaced TargetConfig
+	data, err := json.Marshal(tc)
+	if err != nil {
+		return replaced, fmt.Errorf("failed to copy target config: %w", err)
+	}
+	if err := json.Unmarshal(data, &replaced); err != nil {
+		return replaced, fmt.Errorf("failed to copy target config: %w", err)
+	}
+	replaced.Format = tc.Format
+
+	replaced.visitValueSources(func(valueSource *ValueSource) {
+		valueSource.Value = replace(valueSource.Value)
+	})
+	return replaced, nil
+}
+
+// visitValueSources calls fn with each value of the target config that may hold a secret.
+func (tc *TargetConfig) visitValueSources(fn func(*ValueSource)) {
+	visitEnv := func(env []EnvVar) {
+		for i := range env {
+			fn(&env[i].ValueSource)
+		}
+	}
+
+	visitEnv(tc.Env)
+	// Sorted, so the values of two copies of a config are visited in the same order.
+	for _, name := range slices.Sorted(maps.Keys(tc.EnvOverrides)) {
+		if valueSource := tc.EnvOverrides[name]; valueSource != nil {
+			fn(valueSource)
+		}
+	}
+	for i := range tc.Sidecars {
+		visitEnv(tc.Sidecars[i].Env)
+	}
+	for i := range tc.InitContainers {
+		visitEnv(tc.InitContainers[i].Env)
+	}
+	if tc.APIToken != nil {
+		fn(tc.APIToken)
+	}
+	if tc.DeployWebhook != nil {
+		fn(&tc.DeployWebhook.Secret)
+	}
+	if image := tc.Image; image != nil {
+		if image.RegistryAuth != nil {
+			fn(&image.RegistryAuth.Username)
+			fn(&image.RegistryAuth.Password)
+		}
+		if image.BuildConfig != nil {
+			for i := range image.BuildConfig.Args {
+				fn(&image.BuildConfig.Args[i].ValueSource)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactValue(t *testing.T) {
+	if got := RedactValue(""); got != "" {
+		t.Errorf("RedactValue(\"\") = %q, want empty", got)
+	}
+
+	redacted := RedactValue("s3cret")
+	if !strings.HasPrefix(redacted, "sha256:") || strings.Contains(redacted, "s3cret") {
+		t.Errorf("RedactValue() = %q, want a hash of the value", redacted)
+	}
+	if RedactValue("s3cret") != redacted {
+		t.Error("RedactValue() is not stable for the same value")
+	}
+	if RedactValue("other") == redacted {
+		t.Error("RedactValue() is the same for different values")
+	}
+}
+
+func TestTargetConfig_Redacted(t *testing.T) {
+	targetConfig := TargetConfig{
+		Name:     "my-app",
+		APIToken: &ValueSource{Value: "token"},
+		Image: &Image{
+			Repository: "registry.example.com/my-app",
+			RegistryAuth: &RegistryAuth{
+				Username: ValueSource{Value: "user"},
+				Password: ValueSource{Value: "password"},
+			},
+			BuildConfig: &BuildConfig{Args: []BuildArg{{Name: "NPM_TOKEN", ValueSource: ValueSource{Value: "npm"}}}},
+		},
+		Env:      []EnvVar{{Name: "DATABASE_URL", ValueSource: ValueSource{Value: "postgres://secret"}}},
+		Sidecars: []Sidecar{{Name: "worker", Env: []EnvVar{{Name: "KEY", ValueSource: ValueSource{Value: "sidecar"}}}}},
+	}
+
+	redacted, err := targetConfig.Redacted()
+	if err != nil {
+		t.Fatalf("Redacted() unexpected error: %v", err)
+	}
+
+	checks := map[string][2]string{
+		"env":               {redacted.Env[0].Value, "postgres://secret"},
+		"sidecar env":       {redacted.Sidecars[0].Env[0].Value, "sidecar"},
+		"api token":         {redacted.APIToken.Value, "token"},
+		"registry username": {redacted.Image.RegistryAuth.Username.Value, "user"},
+		"registry password": {redacted.Image.RegistryAuth.Password.Value, "password"},
+		"build argument":    {redacted.Image.BuildConfig.Args[0].Value, "npm"},
+	}
+	for name, check := range checks {
+		got, original := check[0], check[1]
+		if got != RedactValue(original) {
+			t.Errorf("Redacted() %s = %q, want %q", name, got, RedactValue(original))
+		}
+	}
+	if redacted.Image.Repository != targetConfig.Image.Repository {
+		t.Errorf("Redacted() image repository = %q, want %q", redacted.Image.Repository, targetConfig.Image.Repository)
+	}
+
+	// The original config is not modified.
+	if targetConfig.Env[0].Value != "postgres://secret" || targetConfig.Image.RegistryAuth.Password.Value != "password" {
+		t.Error("Redacted() modified the original target config")
+	}
+}
+
+func TestTargetConfig_Masked(t *testing.T) {
+	targetConfig := TargetConfig{
+		Name: "my-app",
+		Env: []EnvVar{
+			{Name: "DATABASE_URL", ValueSource: ValueSource{Value: "postgres://secret"}},
+			{Name: "API_KEY", ValueSource: ValueSource{From: &SourceReference{Secret: "onepassword:api.key"}}},
+		},
+	}
+	if targetConfig.HasMaskedValues() {
+		t.Error("HasMaskedValues() = true before masking, want false")
+	}
+
+	masked, err := targetConfig.Masked()
+	if err != nil {
+		t.Fatalf("Masked() unexpected error: %v", err)
+	}
+	if masked.Env[0].Value != MaskedValue {
+		t.Errorf("Masked() literal value = %q, want %q", masked.Env[0].Value, MaskedValue)
+	}
+	if masked.Env[1].Value != "" || masked.Env[1].From == nil || masked.Env[1].From.Secret != "onepassword:api.key" {
+		t.Errorf("Masked() secret reference = %+v, want it unchanged", masked.Env[1].ValueSource)
+	}
+	if !masked.HasMaskedValues() {
+		t.Error("HasMaskedValues() = false after masking, want true")
+	}
+}
+
+func TestTargetConfig_SecretReferences(t *testing.T) {
+	targetConfig := TargetConfig{
+		Name:     "my-app",
+		APIToken: &ValueSource{From: &SourceReference{Env: "HALOY_API_TOKEN"}},
+		Image: &Image{
+			RegistryAuth: &RegistryAuth{
+				Username: ValueSource{Value: "user"},
+				Password: ValueSource{From: &SourceReference{Secret: "onepassword:registry.password"}},
+			},
+		},
+		Env: []EnvVar{
+			{Name: "DATABASE_URL", ValueSource: ValueSource{From: &SourceReference{Secret: "onepassword:db.url"}}},
+			{Name: "DATABASE_URL_COPY", ValueSource: ValueSource{From: &SourceReference{Secret: "onepassword:db.url"}}},
+			{Name: "LOG_LEVEL", ValueSource: ValueSource{Value: "info"}},
+		},
+		Sidecars: []Sidecar{{Name: "worker", Env: []EnvVar{{Name: "KEY", ValueSource: ValueSource{From: &SourceReference{Secret: "onepassword:worker.key"}}}}}},
+	}
+
+	got := strings.Join(targetConfig.SecretReferences(), ",")
+	want := "onepassword:db.url,onepassword:registry.password,onepassword:worker.key"
+	if got != want {
+		t.Errorf("SecretReferences() = %q, want %q", got, want)
+	}
+
+	if refs := (TargetConfig{Name: "my-app"}).SecretReferences(); len(refs) != 0 {
+		t.Errorf("SecretReferences() = %v, want none", refs)
+	}
+}
+
+func TestTargetConfig_HasUnresolvedValues(t *testing.T) {
+	targetConfig := TargetConfig{
+		Name: "my-app",
+		Env: []EnvVar{
+			{Name: "DATABASE_URL", ValueSource: ValueSource{Value: "postgres://secret"}},
+			{Name: "API_KEY", ValueSource: ValueSource{From: &SourceReference{Secret: "onepassword:api.key"}}},
+		},
+	}
+	if !targetConfig.HasUnresolvedValues() {
+		t.Error("HasUnresolvedValues() = false with a secret reference, want true")
+	}
+
+	targetConfig.Env[1].Value = "resolved"
+	if targetConfig.HasUnresolvedValues() {
+		t.Error("HasUnresolvedValues() = true after resolving, want false")
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RenewalWindow is the time of day in which certificates are renewed, e.g. at night when HAProxy reloads
+// disturb the fewest requests. Certificates for new or changed domains are still issued right away.
+type RenewalWindow struct {
+	// Start and End are times of day as "HH:MM". An end before the start spans midnight.
+	Start string `json:"start" yaml:"start" toml:"start"`
+	End   string `json:"end" yaml:"end" toml:"end"`
+	// Timezone is the IANA time zone of Start and End, e.g. "Europe/Oslo". Defaults to UTC.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty" toml:"timezone,omitempty"`
+}
+
+func (w RenewalWindow) Validate() error {
+	if _, err := parseTimeOfDay(w.Start); err != nil {
+		return fmt.Errorf("certificates.renewal_window: invalid start: %w", err)
+	}
+	if _, err := parseTimeOfDay(w.End); err != nil {
+		return fmt.Errorf("certificates.renewal_window: invalid end: %w", err)
+	}
+	if w.Start == w.End {
+		return fmt.Errorf("certificates.renewal_window: start and end must be different")
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("certificates.renewal_window: invalid timezone '%s'", w.Timezone)
+		}
+	}
+	return nil
+}
+
+// Active reports whether t is inside the window. The window is a daily freeze window schedule.
+func (w RenewalWindow) Active(t time.Time) bool {
+	window := FreezeWindow{
+		Days:     []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"},
+		Start:    w.Start,
+		End:      w.End,
+		Timezone: w.Timezone,
+	}
+	_, active := window.Active(t)
+	return active
+}
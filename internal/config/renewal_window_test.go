@@ -0,0 +1,99 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestRenewalWindow_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		window      RenewalWindow
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:   "night window",
+			window: RenewalWindow{Start: "02:00", End: "05:00", Timezone: "Europe/Oslo"},
+		},
+		{
+			name:   "spanning midnight",
+			window: RenewalWindow{Start: "23:00", End: "03:00"},
+		},
+		{
+			name:        "missing end",
+			window:      RenewalWindow{Start: "02:00"},
+			expectError: true,
+			errMsg:      "invalid end",
+		},
+		{
+			name:        "invalid start",
+			window:      RenewalWindow{Start: "2am", End: "05:00"},
+			expectError: true,
+			errMsg:      "invalid start",
+		},
+		{
+			name:        "empty window",
+			window:      RenewalWindow{Start: "02:00", End: "02:00"},
+			expectError: true,
+			errMsg:      "must be different",
+		},
+		{
+			name:        "invalid timezone",
+			window:      RenewalWindow{Start: "02:00", End: "05:00", Timezone: "Mars/Olympus"},
+			expectError: true,
+			errMsg:      "invalid timezone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.window.Validate()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRenewalWindow_Active(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 1, 2, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window RenewalWindow
+		at     time.Time
+		want   bool
+	}{
+		{"inside", RenewalWindow{Start: "02:00", End: "05:00"}, at(3, 0), true},
+		{"at start", RenewalWindow{Start: "02:00", End: "05:00"}, at(2, 0), true},
+		{"at end", RenewalWindow{Start: "02:00", End: "05:00"}, at(5, 0), false},
+		{"before", RenewalWindow{Start: "02:00", End: "05:00"}, at(1, 59), false},
+		{"after midnight in window spanning midnight", RenewalWindow{Start: "23:00", End: "03:00"}, at(1, 0), true},
+		{"before midnight in window spanning midnight", RenewalWindow{Start: "23:00", End: "03:00"}, at(23, 30), true},
+		{"outside window spanning midnight", RenewalWindow{Start: "23:00", End: "03:00"}, at(12, 0), false},
+		// 02:00-05:00 in Oslo is 01:00-04:00 UTC in winter.
+		{"in timezone", RenewalWindow{Start: "02:00", End: "05:00", Timezone: "Europe/Oslo"}, at(1, 30), true},
+		{"outside timezone", RenewalWindow{Start: "02:00", End: "05:00", Timezone: "Europe/Oslo"}, at(4, 30), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Active(tt.at); got != tt.want {
+				t.Errorf("Active(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import "fmt"
+
+// ShadowTo mirrors a share of the requests of an app to another app, e.g. a staging deployment of a new version.
+// Mirrored requests are sent in the background after the request was forwarded, their responses are discarded.
+type ShadowTo struct {
+	// App is the name of the app the requests are mirrored to.
+	App string `json:"app" yaml:"app" toml:"app"`
+	// Percentage of the requests that are mirrored, 1-100. Defaults to 100.
+	Percentage *int `json:"percentage,omitempty" yaml:"percentage,omitempty" toml:"percentage,omitempty"`
+}
+
+func (s *ShadowTo) Validate(appName, format string) error {
+	shadowField := GetFieldNameForFormat(TargetConfig{}, "ShadowTo", format)
+	appField := GetFieldNameForFormat(ShadowTo{}, "App", format)
+
+	if s.App == "" {
+		return fmt.Errorf("%s.%s is required", shadowField, appField)
+	}
+	if !isValidAppName(s.App) {
+		return fmt.Errorf("%s.%s '%s' is not a valid app name", shadowField, appField, s.App)
+	}
+	if s.App == appName {
+		return fmt.Errorf("%s.%s can't be the app itself", shadowField, appField)
+	}
+	if s.Percentage != nil && (*s.Percentage < 1 || *s.Percentage > 100) {
+		return fmt.Errorf("%s.%s must be between 1 and 100", shadowField, GetFieldNameForFormat(ShadowTo{}, "Percentage", format))
+	}
+	return nil
+}
+
+// PercentageOrDefault returns the percentage of requests that are mirrored.
+func (s *ShadowTo) PercentageOrDefault() int {
+	if s.Percentage == nil {
+		return 100
+	}
+	return *s.Percentage
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestShadowTo_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		shadowTo    ShadowTo
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name:        "all requests",
+			shadowTo:    ShadowTo{App: "my-app-staging"},
+			expectError: false,
+		},
+		{
+			name:        "percentage of requests",
+			shadowTo:    ShadowTo{App: "my-app-staging", Percentage: helpers.IntPtr(10)},
+			expectError: false,
+		},
+		{
+			name:        "missing app",
+			shadowTo:    ShadowTo{Percentage: helpers.IntPtr(10)},
+			expectError: true,
+			errMsg:      "shadow_to.app is required",
+		},
+		{
+			name:        "invalid app name",
+			shadowTo:    ShadowTo{App: "my app"},
+			expectError: true,
+			errMsg:      "is not a valid app name",
+		},
+		{
+			name:        "app itself",
+			shadowTo:    ShadowTo{App: "my-app"},
+			expectError: true,
+			errMsg:      "can't be the app itself",
+		},
+		{
+			name:        "zero percentage",
+			shadowTo:    ShadowTo{App: "my-app-staging", Percentage: helpers.IntPtr(0)},
+			expectError: true,
+			errMsg:      "shadow_to.percentage must be between 1 and 100",
+		},
+		{
+			name:        "percentage above 100",
+			shadowTo:    ShadowTo{App: "my-app-staging", Percentage: helpers.IntPtr(101)},
+			expectError: true,
+			errMsg:      "shadow_to.percentage must be between 1 and 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.shadowTo.Validate("my-app", "yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestShadowTo_PercentageOrDefault(t *testing.T) {
+	if got := (&ShadowTo{App: "my-app-staging"}).PercentageOrDefault(); got != 100 {
+		t.Errorf("PercentageOrDefault() = %d, want 100", got)
+	}
+	if got := (&ShadowTo{App: "my-app-staging", Percentage: helpers.IntPtr(25)}).PercentageOrDefault(); got != 25 {
+		t.Errorf("PercentageOrDefault() = %d, want 25", got)
+	}
+}
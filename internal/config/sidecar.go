@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Sidecar is a companion container that is deployed, health checked and rolled back together with the app.
+// Sidecars are not routed by HAProxy and are reachable from the app at the hostname <app name>-<sidecar name>.
+type Sidecar struct {
+	Name  string `json:"name" yaml:"name" toml:"name"`
+	Image *Image `json:"image" yaml:"image" toml:"image"`
+	// Command overrides the default command of the image.
+	Command []string `json:"command,omitempty" yaml:"command,omitempty" toml:"command,omitempty"`
+	Env     []EnvVar `json:"env,omitempty" yaml:"env,omitempty" toml:"env,omitempty"`
+	Volumes []string `json:"volumes,omitempty" yaml:"volumes,omitempty" toml:"volumes,omitempty"`
+}
+
+func (s *Sidecar) Validate(format string) error {
+	sidecarsField := GetFieldNameForFormat(TargetConfig{}, "Sidecars", format)
+
+	if !isValidAppName(s.Name) {
+		return fmt.Errorf("%s: invalid name '%s'; must contain only alphanumeric characters, hyphens, and underscores", sidecarsField, s.Name)
+	}
+
+	if s.Image == nil {
+		return fmt.Errorf("%s '%s': image is required", sidecarsField, s.Name)
+	}
+	if err := s.Image.Validate(format); err != nil {
+		return fmt.Errorf("%s '%s': %w", sidecarsField, s.Name, err)
+	}
+	if s.Image.ShouldBuild() {
+		return fmt.Errorf("%s '%s': sidecar images can't be built, use a prebuilt image", sidecarsField, s.Name)
+	}
+
+	for j, envVar := range s.Env {
+		if err := envVar.Validate(format); err != nil {
+			return fmt.Errorf("%s '%s': env[%d]: %w", sidecarsField, s.Name, j, err)
+		}
+	}
+
+	for _, volume := range s.Volumes {
+		if err := validateVolume(volume); err != nil {
+			return fmt.Errorf("%s '%s': %w", sidecarsField, s.Name, err)
+		}
+	}
+
+	return nil
+}
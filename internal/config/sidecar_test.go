@@ -0,0 +1,81 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+func TestSidecar_Validate(t *testing.T) {
+	buildImage := true
+
+	tests := []struct {
+		name        string
+		sidecar     Sidecar
+		expectError bool
+		errMsg      string
+	}{
+		{
+			name: "valid sidecar",
+			sidecar: Sidecar{
+				Name:    "redis",
+				Image:   &Image{Repository: "redis", Tag: "7"},
+				Command: []string{"redis-server", "--save", ""},
+				Env:     []EnvVar{{Name: "REDIS_ARGS", ValueSource: ValueSource{Value: "--maxmemory 100mb"}}},
+				Volumes: []string{"redis-data:/data"},
+			},
+			expectError: false,
+		},
+		{
+			name:        "invalid name",
+			sidecar:     Sidecar{Name: "my cache", Image: &Image{Repository: "redis"}},
+			expectError: true,
+			errMsg:      "invalid name 'my cache'",
+		},
+		{
+			name:        "missing image",
+			sidecar:     Sidecar{Name: "redis"},
+			expectError: true,
+			errMsg:      "image is required",
+		},
+		{
+			name:        "build image",
+			sidecar:     Sidecar{Name: "shipper", Image: &Image{Repository: "shipper", Build: &buildImage}},
+			expectError: true,
+			errMsg:      "can't be built",
+		},
+		{
+			name: "invalid env var",
+			sidecar: Sidecar{
+				Name:  "redis",
+				Image: &Image{Repository: "redis"},
+				Env:   []EnvVar{{Name: "EMPTY"}},
+			},
+			expectError: true,
+			errMsg:      "env[0]",
+		},
+		{
+			name:        "relative volume path",
+			sidecar:     Sidecar{Name: "redis", Image: &Image{Repository: "redis"}, Volumes: []string{"./data:/data"}},
+			expectError: true,
+			errMsg:      "must be absolute",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sidecar.Validate("yaml")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Validate() expected error but got none")
+				} else if tt.errMsg != "" && !helpers.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Validate() error = %v, expected to contain %v", err, tt.errMsg)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+			}
+		})
+	}
+}
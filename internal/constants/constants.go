@@ -7,6 +7,8 @@ const (
 	HAProxyVersion           = "3.2"
 	HaloydContainerName      = "haloyd"
 	HAProxyContainerName     = "haloy-haproxy"
+	CaddyVersion             = "2.10"
+	CaddyContainerName       = "haloy-caddy"
 	DockerNetwork            = "haloy-public"
 	DefaultDeploymentsToKeep = 6
 	DefaultHealthCheckPath   = "/"
@@ -15,15 +17,35 @@ const (
 
 	CertificatesHTTPProviderPort = "8080"
 	APIServerPort                = "9999"
+	HAProxyStatsPagePort         = "8404" // stats page of HAProxy, proxied by haloyd when proxy.stats is enabled.
+	HAProxyStatsPagePath         = "/v1/haproxy/stats"
+	HAProxyStatsPageUser         = "haloyd"
+	HAProxyShadowPort            = "8405" // loopback frontend of HAProxy for mirrored requests, see shadow_to.
 
 	// Environment variables
 	EnvVarAPIToken      = "HALOY_API_TOKEN"
-	EnvVarReplicaID     = "HALOY_REPLICA_ID" // available in all containers.
-	EnvVarDataDir       = "HALOY_DATA_DIR"   // used to override default data directory.
-	EnvVarConfigDir     = "HALOY_CONFIG_DIR" // used to override default config directory for haloy.
+	EnvVarApproveToken  = "HALOY_APPROVE_TOKEN" // optional token that approves deployments, see 'haloy approve'.
+	EnvVarReplicaID     = "HALOY_REPLICA_ID"    // available in all containers.
+	EnvVarAppName       = "HALOY_APP_NAME"      // available in all containers.
+	EnvVarDeploymentID  = "HALOY_DEPLOYMENT_ID" // available in all containers.
+	EnvVarTarget        = "HALOY_TARGET"        // available in all containers, empty for single target configs.
+	EnvVarImageRef      = "HALOY_IMAGE_REF"     // available in all containers.
+	EnvVarDomains       = "HALOY_DOMAINS"       // available in all containers, comma-separated.
+	EnvVarDataDir       = "HALOY_DATA_DIR"      // used to override default data directory.
+	EnvVarConfigDir     = "HALOY_CONFIG_DIR"    // used to override default config directory for haloy.
 	EnvVarDebug         = "HALOY_DEBUG"
+	EnvVarTraceParent   = "TRACEPARENT"          // W3C trace context passed on to haloyd.
+	EnvVarCorrelationID = "HALOY_CORRELATION_ID" // overrides the correlation ID the CLI sends, e.g. with the ID of a CI run.
 	EnvVarSystemInstall = "HALOY_SYSTEM_INSTALL" // used to disable system wide install
 
+	// EnvVarOIDCClientSecret is the client secret of api.oidc, set in the .env file of haloyd. Providers that
+	// allow public clients with PKCE don't need it.
+	EnvVarOIDCClientSecret = "HALOY_OIDC_CLIENT_SECRET"
+
+	// HeaderCorrelationID carries the correlation ID of a request. The CLI sends one ID for all requests
+	// of a command and haloyd returns it in the response.
+	HeaderCorrelationID = "X-Correlation-ID"
+
 	// Directories
 	SystemDataDir   = "/var/lib/haloy"
 	SystemConfigDir = "/etc/haloy"
@@ -32,15 +54,28 @@ const (
 
 	// Subdirectories
 	DBDir            = "db"
+	DBBackupsDir     = "db-backups"
 	HAProxyConfigDir = "haproxy-config"
+	HAProxyRunDir    = "haproxy-run" // stats and admin sockets of HAProxy, only shared with haloyd.
+	CaddyConfigDir   = "caddy-config"
+	CaddyDataDir     = "caddy-data" // certificates and ACME account of Caddy
 	CertStorageDir   = "cert-storage"
+	LogsDir          = "logs"
+	UploadsDir       = "uploads"
+	RegistryDir      = "registry"
 
 	// File names
 	HaloydConfigFileName  = "haloyd.yaml"
 	ClientConfigFileName  = "client.yaml"
 	ConfigEnvFileName     = ".env"
 	HAProxyConfigFileName = "haproxy.cfg"
+	HAProxyMirrorFileName = "mirror.lua"
+	HAProxyAdminSocket    = "admin.sock"
+	HAProxyStatsSocket    = "stats.sock"
+	CaddyConfigFileName   = "Caddyfile"
 	DBFileName            = "haloy.db"
+	HaloydLogFileName     = "haloyd.log"
+	ServerKeyFileName     = "server.key" // age identity of haloyd, resolved configs are encrypted to it in the database.
 )
 
 // File and directory permissions
@@ -0,0 +1,78 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/docker/docker/client"
+)
+
+// StartABVariant starts the variant deployment of an A/B test from the spec of the app with another image.
+// The variant uses the sidecars of the app and runs no init containers.
+func StartABVariant(ctx context.Context, cli *client.Client, logger *slog.Logger, deploymentID string, targetConfig config.TargetConfig) ([]docker.ContainerRunResult, error) {
+	if err := docker.EnsureImageUpToDate(ctx, cli, logger, *targetConfig.Image); err != nil {
+		return nil, err
+	}
+	imageRef, err := tagImage(ctx, cli, targetConfig.Image.ImageRef(), targetConfig.Name, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tag image: %w", err)
+	}
+	return docker.RunABVariantContainers(ctx, cli, deploymentID, imageRef, targetConfig)
+}
+
+// ABTest returns the A/B test of an app, or nil if it has none.
+func ABTest(appName string) (*storage.ABTest, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return db.GetABTest(appName)
+}
+
+// ABTests returns the running A/B tests by app name.
+func ABTests() (map[string]storage.ABTest, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	abTests, err := db.GetABTests()
+	if err != nil {
+		return nil, err
+	}
+
+	tests := make(map[string]storage.ABTest, len(abTests))
+	for _, test := range abTests {
+		tests[test.AppName] = test
+	}
+	return tests, nil
+}
+
+// StartABTest saves the A/B test of an app, replacing a running one.
+func StartABTest(test storage.ABTest) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.SaveABTest(test)
+}
+
+// StopABTest removes the A/B test of an app.
+func StopABTest(appName string) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.DeleteABTest(appName)
+}
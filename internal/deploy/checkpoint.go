@@ -0,0 +1,163 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// Checkpoints record the progress of deployments in the database so haloyd can resume or roll back
+// deployments that were in progress when it stopped. Failing to write a checkpoint doesn't fail the
+// deployment, it only affects recovery after a restart.
+
+func saveCheckpoint(deploymentID string, targetConfig config.TargetConfig, rawAppConfig config.AppConfig, step string, logger *slog.Logger) {
+	targetConfigJSON, err := json.Marshal(targetConfig)
+	if err != nil {
+		logger.Warn("Failed to save deployment checkpoint", "error", err)
+		return
+	}
+	rawAppConfigJSON, err := json.Marshal(rawAppConfig)
+	if err != nil {
+		logger.Warn("Failed to save deployment checkpoint", "error", err)
+		return
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to save deployment checkpoint", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.SaveCheckpoint(storage.DeploymentCheckpoint{
+		DeploymentID: deploymentID,
+		AppName:      targetConfig.Name,
+		Step:         step,
+		TargetConfig: targetConfigJSON,
+		RawAppConfig: rawAppConfigJSON,
+		UpdatedAt:    time.Now(),
+	}); err != nil {
+		logger.Warn("Failed to save deployment checkpoint", "error", err)
+	}
+}
+
+func updateCheckpoint(deploymentID, step string, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to update deployment checkpoint", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.UpdateCheckpointStep(deploymentID, step); err != nil {
+		logger.Warn("Failed to update deployment checkpoint", "error", err)
+	}
+}
+
+// ClearCheckpoint removes the checkpoint of a deployment once it has finished or failed.
+func ClearCheckpoint(deploymentID string, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to remove deployment checkpoint", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.DeleteCheckpoint(deploymentID); err != nil {
+		logger.Warn("Failed to remove deployment checkpoint", "error", err)
+	}
+}
+
+// CompleteCheckpoint stores the resolved config of a successful deployment as the app's desired state
+// and removes its checkpoint and the paused state of the app.
+func CompleteCheckpoint(deploymentID, appName string, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to save deployment spec", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.CompleteCheckpoint(deploymentID); err != nil {
+		logger.Warn("Failed to save deployment spec", "error", err)
+		return
+	}
+	if err := db.PruneDeploymentSpecs(appName); err != nil {
+		logger.Warn("Failed to prune deployment specs", "error", err)
+	}
+	// A new deployment of a paused app replaces the paused one, so the app is no longer paused.
+	if err := db.DeletePausedApp(appName); err != nil {
+		logger.Warn("Failed to clear paused state", "error", err)
+	}
+}
+
+// AppDeploying reports whether a deployment of an app is in progress, i.e. it has a checkpoint.
+func AppDeploying(appName string) (bool, error) {
+	db, err := storage.New()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	checkpoints, err := db.GetCheckpoints()
+	if err != nil {
+		return false, err
+	}
+	for _, checkpoint := range checkpoints {
+		if checkpoint.AppName == appName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LoadSpec returns the resolved target config stored for a successful deployment, or nil if there is none,
+// e.g. for deployments made before specs were stored.
+func LoadSpec(deploymentID string) (*config.TargetConfig, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	spec, err := db.GetDeploymentSpec(deploymentID)
+	if err != nil || spec == nil {
+		return nil, err
+	}
+
+	var targetConfig config.TargetConfig
+	if err := json.Unmarshal(spec.TargetConfig, &targetConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment spec: %w", err)
+	}
+	return &targetConfig, nil
+}
+
+// SaveSpecReplicas updates the replica count stored for a deployment, so reconciliation keeps the replicas
+// an app was scaled to.
+func SaveSpecReplicas(deploymentID string, replicas int) error {
+	targetConfig, err := LoadSpec(deploymentID)
+	if err != nil {
+		return err
+	}
+	if targetConfig == nil {
+		return fmt.Errorf("no spec stored for deployment %s", deploymentID)
+	}
+	targetConfig.Replicas = &replicas
+
+	targetConfigJSON, err := json.Marshal(targetConfig)
+	if err != nil {
+		return fmt.Errorf("failed to convert target config to JSON: %w", err)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.UpdateDeploymentSpec(deploymentID, targetConfigJSON)
+}
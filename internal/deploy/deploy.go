@@ -10,14 +10,28 @@ import (
 
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/logging"
 	"github.com/ameistad/haloy/internal/storage"
+	"github.com/ameistad/haloy/internal/tracing"
 	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, targetConfig config.TargetConfig, rawAppConfig config.AppConfig, logger *slog.Logger) error {
+func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, targetConfig config.TargetConfig, rawAppConfig config.AppConfig, logger *slog.Logger) (err error) {
 	imageRef := targetConfig.Image.ImageRef()
 
-	err := docker.EnsureImageUpToDate(ctx, cli, logger, *targetConfig.Image)
+	// The checkpoint is kept until haloyd has switched traffic to the new containers.
+	saveCheckpoint(deploymentID, targetConfig, rawAppConfig, logging.StepPull, logger)
+	defer func() {
+		if err != nil {
+			ClearCheckpoint(deploymentID, logger)
+		}
+	}()
+
+	logging.LogStep(logger, logging.StepPull, "Preparing image")
+	pullCtx, pullSpan := tracing.Start(ctx, "image.pull", attribute.String("haloy.image", imageRef))
+	err = docker.EnsureImageUpToDate(pullCtx, cli, logger, *targetConfig.Image)
+	tracing.End(pullSpan, err)
 	if err != nil {
 		return err
 	}
@@ -27,6 +41,41 @@ func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, tar
 		return fmt.Errorf("failed to tag image: %w", err)
 	}
 
+	updateCheckpoint(deploymentID, logging.StepCreate, logger)
+	logging.LogStep(logger, logging.StepCreate, "Creating containers")
+	createCtx, createSpan := tracing.Start(ctx, "containers.create")
+	err = createContainers(createCtx, cli, deploymentID, newImageRef, targetConfig, logger)
+	tracing.End(createSpan, err)
+	if err != nil {
+		return err
+	}
+	updateCheckpoint(deploymentID, logging.StepTraffic, logger)
+
+	// We'll make sure to save the raw app config (without resolved secrets to history)
+	handleImageHistory(ctx, cli, rawAppConfig, deploymentID, newImageRef, logger)
+
+	return nil
+}
+
+// createContainers starts the sidecars, init containers and app containers of the deployment.
+func createContainers(ctx context.Context, cli *client.Client, deploymentID, newImageRef string, targetConfig config.TargetConfig, logger *slog.Logger) error {
+	// Sidecars are started first so they are available when the app starts.
+	if len(targetConfig.Sidecars) > 0 {
+		if err := docker.RunSidecars(ctx, cli, logger, deploymentID, targetConfig); err != nil {
+			return err
+		}
+	}
+
+	// Init containers run to completion before any app container of the deployment is started.
+	if len(targetConfig.InitContainers) > 0 {
+		if err := docker.RunInitContainers(ctx, cli, logger, deploymentID, newImageRef, targetConfig); err != nil {
+			if len(targetConfig.Sidecars) > 0 {
+				docker.RemoveDeploymentSidecars(context.WithoutCancel(ctx), cli, logger, targetConfig.Name, deploymentID)
+			}
+			return err
+		}
+	}
+
 	if targetConfig.DeploymentStrategy == config.DeploymentStrategyReplace {
 		_, err := docker.StopContainers(ctx, cli, logger, targetConfig.Name, "")
 		if err != nil {
@@ -36,6 +85,9 @@ func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, tar
 
 	runResult, err := docker.RunContainer(ctx, cli, deploymentID, newImageRef, targetConfig)
 	if err != nil {
+		if len(targetConfig.Sidecars) > 0 {
+			docker.RemoveDeploymentSidecars(context.WithoutCancel(ctx), cli, logger, targetConfig.Name, deploymentID)
+		}
 		if errors.Is(err, context.DeadlineExceeded) {
 			return fmt.Errorf("container startup timed out: %w", err)
 		} else if errors.Is(err, context.Canceled) {
@@ -54,9 +106,6 @@ func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, tar
 	} else {
 		logger.Info(fmt.Sprintf("Containers started successfully (%d replicas)", len(runResult)), "count", len(runResult), "deploymentID", deploymentID)
 	}
-	// We'll make sure to save the raw app config (without resolved secrets to history)
-	handleImageHistory(ctx, cli, rawAppConfig, deploymentID, newImageRef, logger)
-
 	return nil
 }
 
@@ -174,3 +223,24 @@ func writeAppConfigHistory(rawAppConfig config.AppConfig, deploymentID, newImage
 
 	return nil
 }
+
+// LoadAppConfigHistory returns the raw app config, without resolved secrets, that was stored with the
+// deployment in the history.
+func LoadAppConfigHistory(deploymentID string) (config.AppConfig, error) {
+	var rawAppConfig config.AppConfig
+
+	db, err := storage.New()
+	if err != nil {
+		return rawAppConfig, err
+	}
+	defer db.Close()
+
+	deployment, err := db.GetDeployment(deploymentID)
+	if err != nil {
+		return rawAppConfig, err
+	}
+	if err := json.Unmarshal(deployment.RawAppConfig, &rawAppConfig); err != nil {
+		return rawAppConfig, fmt.Errorf("failed to parse app config of deployment %s: %w", deploymentID, err)
+	}
+	return rawAppConfig, nil
+}
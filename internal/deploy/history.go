@@ -0,0 +1,58 @@
+package deploy
+
+import (
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// Deployments returns the deployments in the history of all apps, oldest first.
+func Deployments() ([]storage.Deployment, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return db.GetAllDeployments()
+}
+
+// DeploymentAppName returns the name of the app a deployment belongs to, looked up in the history, the
+// deployment specs, the checkpoints of deployments in progress and the stored logs. It returns an empty
+// name when the deployment isn't found.
+func DeploymentAppName(deploymentID string) (string, error) {
+	db, err := storage.New()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	if deployment, err := db.GetDeployment(deploymentID); err == nil {
+		return deployment.AppName, nil
+	}
+	spec, err := db.GetDeploymentSpec(deploymentID)
+	if err != nil {
+		return "", err
+	}
+	if spec != nil {
+		return spec.AppName, nil
+	}
+	checkpoints, err := db.GetCheckpoints()
+	if err != nil {
+		return "", err
+	}
+	for _, checkpoint := range checkpoints {
+		if checkpoint.DeploymentID == deploymentID {
+			return checkpoint.AppName, nil
+		}
+	}
+	// Failed deployments are only left in the logs.
+	entries, err := db.GetDeploymentLogs(deploymentID)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.AppName != "" {
+			return entry.AppName, nil
+		}
+	}
+	return "", nil
+}
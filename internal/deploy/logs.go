@@ -0,0 +1,17 @@
+package deploy
+
+import (
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// DeploymentLogs returns the stored log entries of a deployment, empty when there are none or they were pruned.
+func DeploymentLogs(deploymentID string) ([]logging.LogEntry, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return db.GetDeploymentLogs(deploymentID)
+}
@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/docker/docker/client"
+)
+
+// PausedApp returns the paused state of an app, or nil if it isn't paused.
+func PausedApp(appName string) (*storage.PausedApp, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return db.GetPausedApp(appName)
+}
+
+// PausedApps returns the paused apps by app name.
+func PausedApps() (map[string]storage.PausedApp, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	pausedApps, err := db.GetPausedApps()
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make(map[string]storage.PausedApp, len(pausedApps))
+	for _, app := range pausedApps {
+		apps[app.AppName] = app
+	}
+	return apps, nil
+}
+
+// ClearPausedApp removes the paused state of an app, e.g. when its containers are removed.
+func ClearPausedApp(appName string) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.DeletePausedApp(appName)
+}
+
+// PauseApp stops the containers and sidecars of an app and records the deployment as paused. The state is saved
+// before the containers stop, so HAProxy routes the domains to the maintenance page instead of dropping them.
+func PauseApp(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, deploymentID string, labels map[string]string) ([]string, error) {
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert container labels to JSON: %w", err)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := db.SavePausedApp(storage.PausedApp{
+		AppName:      appName,
+		DeploymentID: deploymentID,
+		Labels:       labelsJSON,
+		PausedAt:     time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save paused state: %w", err)
+	}
+
+	stoppedIDs, err := docker.StopContainers(ctx, cli, logger, appName, "")
+	if err != nil {
+		return stoppedIDs, err
+	}
+	if _, err := docker.StopSidecars(ctx, cli, logger, appName, ""); err != nil {
+		return stoppedIDs, err
+	}
+	return stoppedIDs, nil
+}
+
+// ResumeApp starts the sidecars and containers of the paused deployment of an app and clears its paused state.
+// haloyd health checks the containers before HAProxy routes to them again.
+func ResumeApp(ctx context.Context, cli *client.Client, logger *slog.Logger, paused storage.PausedApp) ([]string, error) {
+	if _, err := docker.StartSidecars(ctx, cli, logger, paused.AppName, paused.DeploymentID); err != nil {
+		return nil, err
+	}
+	startedIDs, err := docker.StartContainers(ctx, cli, logger, paused.AppName, paused.DeploymentID)
+	if err != nil {
+		return startedIDs, err
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return startedIDs, err
+	}
+	defer db.Close()
+
+	if err := db.DeletePausedApp(paused.AppName); err != nil {
+		return startedIDs, fmt.Errorf("failed to clear paused state: %w", err)
+	}
+	return startedIDs, nil
+}
@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"sort"
 
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/deploytypes"
 	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/ameistad/haloy/internal/storage"
 	"github.com/docker/docker/client"
 )
@@ -32,6 +32,16 @@ func RollbackApp(ctx context.Context, cli *client.Client, targetConfig config.Ta
 			if target.RawAppConfig == nil {
 				return fmt.Errorf("no raw app config stored for app %s: %w", appName, err)
 			}
+
+			// The stored spec deploys the target exactly as it ran before. The config sent by the client
+			// is only used for deployments made before specs were stored.
+			spec, err := LoadSpec(targetDeploymentID)
+			if err != nil {
+				logger.Warn("Failed to load deployment spec, using the config sent by the client", "error", err)
+			} else if spec != nil {
+				targetConfig = *spec
+				targetConfig.Image = target.RawAppConfig.Image
+			}
 			if err := DeployApp(ctx, cli, newDeploymentID, targetConfig, *target.RawAppConfig, logger); err != nil {
 				return fmt.Errorf("failed to deploy app %s: %w", appName, err)
 			}
@@ -101,11 +111,14 @@ func GetRollbackTargets(ctx context.Context, cli *client.Client, appName string)
 		// Replace the image in the config with the deployed image
 		rawAppConfig.Image = &deployedImage
 
+		spec, _ := db.GetDeploymentSpec(deployment.ID)
+
 		target := deploytypes.RollbackTarget{
 			DeploymentID: deployment.ID,
 			ImageRef:     imageRef,
 			IsRunning:    deployment.ID == runningDeploymentID,
 			RawAppConfig: &rawAppConfig,
+			HasSpec:      spec != nil,
 		}
 
 		targets = append(targets, target)
@@ -152,9 +165,5 @@ func getRunningDeploymentID(ctx context.Context, cli *client.Client, appName str
 		return "", fmt.Errorf("no deployment IDs found in running containers for app %s", appName)
 	}
 
-	sort.Slice(deploymentIDs, func(i, j int) bool {
-		return deploymentIDs[i] > deploymentIDs[j]
-	})
-
-	return deploymentIDs[0], nil
+	return helpers.NewestDeploymentID(deploymentIDs...), nil
 }
@@ -0,0 +1,80 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ScaleReplicas adds or removes replicas of a deployment until it has desired replicas, replicas are its current
+// containers. New replicas are cloned from the first replica and get the lowest free IDs, removed replicas are the
+// ones with the highest IDs, so IDs stay contiguous. The new count is stored in the deployment spec so the
+// reconciler keeps it. It returns the number of replicas the deployment has, which falls short of desired when
+// a replica can't be added or removed.
+func ScaleReplicas(ctx context.Context, cli *client.Client, logger *slog.Logger, deploymentID string, replicas []container.Summary, desired int) (int, error) {
+	current := len(replicas)
+	if current == 0 {
+		return 0, fmt.Errorf("deployment %s has no replicas to scale", deploymentID)
+	}
+	if desired == current {
+		return current, nil
+	}
+
+	slices.SortFunc(replicas, func(x, y container.Summary) int {
+		return docker.ReplicaID(x) - docker.ReplicaID(y)
+	})
+	scaled := current
+	var scaleErr error
+	if desired > current {
+		source, err := cli.ContainerInspect(ctx, replicas[0].ID)
+		if err != nil {
+			return current, fmt.Errorf("failed to inspect container %s: %w", helpers.SafeIDPrefix(replicas[0].ID), err)
+		}
+		used := make(map[int]struct{}, current)
+		for _, c := range replicas {
+			used[docker.ReplicaID(c)] = struct{}{}
+		}
+		for replica := 1; scaled < desired; replica++ {
+			if _, ok := used[replica]; ok {
+				continue
+			}
+			if _, err := docker.CloneReplica(ctx, cli, source, replica); err != nil {
+				scaleErr = fmt.Errorf("failed to add replica %d: %w", replica, err)
+				break
+			}
+			scaled++
+		}
+	} else {
+		// Saved first, the reconciler would otherwise restore the replicas while they're stopping.
+		if err := SaveSpecReplicas(deploymentID, desired); err != nil {
+			return current, fmt.Errorf("failed to save replica count: %w", err)
+		}
+		timeout := 20
+		for _, c := range slices.Backward(replicas) {
+			if scaled == desired {
+				break
+			}
+			if err := cli.ContainerStop(ctx, c.ID, container.StopOptions{Timeout: &timeout}); err != nil {
+				scaleErr = fmt.Errorf("failed to stop replica %d: %w", docker.ReplicaID(c), err)
+				break
+			}
+			if err := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}); err != nil {
+				logger.Warn("Failed to remove replica", "deploymentID", deploymentID, "container_id", helpers.SafeIDPrefix(c.ID), "error", err)
+			}
+			scaled--
+		}
+	}
+	if scaled != desired || desired > current {
+		if err := SaveSpecReplicas(deploymentID, scaled); err != nil {
+			return scaled, errors.Join(scaleErr, fmt.Errorf("failed to save replica count: %w", err))
+		}
+	}
+	return scaled, scaleErr
+}
@@ -0,0 +1,16 @@
+package deploy
+
+import (
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// SchemaVersion returns the applied database schema version.
+func SchemaVersion() (int, error) {
+	db, err := storage.New()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return db.SchemaVersion()
+}
@@ -8,4 +8,5 @@ type RollbackTarget struct {
 	ImageRef     string
 	IsRunning    bool // The image is live
 	RawAppConfig *config.AppConfig
+	HasSpec      bool // haloyd stored the resolved config of the deployment and rolls back to it
 }
@@ -2,10 +2,13 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ameistad/haloy/internal/config"
@@ -13,6 +16,7 @@ import (
 	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 )
 
@@ -22,28 +26,97 @@ type ContainerRunResult struct {
 	ReplicaID    int
 }
 
-func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRef string, targetConfig config.TargetConfig) ([]ContainerRunResult, error) {
-	result := make([]ContainerRunResult, 0, *targetConfig.Replicas)
+// AppContainerSpec is the configuration shared by the app containers of a deployment. Each replica
+// also gets its own name and replica ID variable.
+type AppContainerSpec struct {
+	Labels           map[string]string
+	Env              []string
+	HostConfig       *container.HostConfig
+	NetworkingConfig *network.NetworkingConfig
+}
 
-	if err := checkImagePlatformCompatibility(ctx, cli, imageRef); err != nil {
-		return result, err
-	}
+// BuildAppContainerSpec returns the container configuration RunContainer uses for a deployment.
+func BuildAppContainerSpec(deploymentID string, targetConfig config.TargetConfig) (AppContainerSpec, error) {
 	cl := config.ContainerLabels{
-		AppName:         targetConfig.Name,
-		DeploymentID:    deploymentID,
-		ACMEEmail:       targetConfig.ACMEEmail,
-		Port:            targetConfig.Port,
-		HealthCheckPath: targetConfig.HealthCheckPath,
-		Domains:         targetConfig.Domains,
-		Role:            config.AppLabelRole,
+		AppName:          targetConfig.Name,
+		DeploymentID:     deploymentID,
+		ACMEEmail:        targetConfig.ACMEEmail,
+		ACMEStaging:      targetConfig.ACMEStaging,
+		Port:             targetConfig.Port,
+		HealthCheckPath:  targetConfig.HealthCheckPath,
+		Domains:          targetConfig.Domains,
+		Frontend:         targetConfig.Frontend,
+		ExternalLBTarget: targetConfig.ExternalLBTarget,
+		Exposure:         targetConfig.Exposure,
+		Role:             config.AppLabelRole,
+	}
+	if hc := targetConfig.HealthCheck; hc != nil {
+		durations, err := hc.Durations()
+		if err != nil {
+			return AppContainerSpec{}, fmt.Errorf("invalid health check configuration: %w", err)
+		}
+		cl.HealthCheckType = hc.Type
+		cl.HealthCheckCommand = hc.Command
+		cl.HealthCheckGRPCService = hc.GRPCService
+		cl.HealthCheckInterval = durations.Interval
+		cl.HealthCheckTimeout = durations.Timeout
+		cl.HealthCheckStartPeriod = durations.StartPeriod
+		cl.HealthCheckExpectedStatusCodes = hc.ExpectedStatusCodes
+		cl.HealthCheckReadinessPath = hc.ReadinessPath
+		cl.HealthCheckLivenessPath = hc.LivenessPath
+		if hc.Retries != nil {
+			cl.HealthCheckRetries = *hc.Retries
+		}
+		if hc.Rise != nil {
+			cl.HealthCheckRise = *hc.Rise
+		}
 	}
-	labels := cl.ToLabels()
+	if targetConfig.Warmup != nil {
+		cl.WarmupPaths = targetConfig.Warmup.Paths
+		if targetConfig.Warmup.Requests != nil {
+			cl.WarmupRequests = *targetConfig.Warmup.Requests
+		}
+	}
+	if c := targetConfig.Connections; c != nil {
+		if c.Max != nil {
+			cl.MaxConnections = *c.Max
+		}
+		if c.MaxPerReplica != nil {
+			cl.MaxConnectionsPerReplica = *c.MaxPerReplica
+		}
+		if c.MaxQueue != nil {
+			cl.MaxQueue = *c.MaxQueue
+		}
+		cl.QueueTimeout = config.DefaultQueueTimeout
+		if c.QueueTimeout != "" {
+			queueTimeout, err := time.ParseDuration(c.QueueTimeout)
+			if err != nil {
+				return AppContainerSpec{}, fmt.Errorf("invalid queue timeout: %w", err)
+			}
+			cl.QueueTimeout = queueTimeout
+		}
+	}
+	if targetConfig.ShadowTo != nil {
+		cl.ShadowTo = targetConfig.ShadowTo.App
+		cl.ShadowPercentage = targetConfig.ShadowTo.PercentageOrDefault()
+	}
+	labels := make(map[string]string, len(targetConfig.Labels))
+	maps.Copy(labels, targetConfig.Labels)
+	maps.Copy(labels, cl.ToLabels())
+	appLabelKeys := slices.Sorted(maps.Keys(targetConfig.Labels))
+	if appLabelKeys == nil {
+		appLabelKeys = []string{}
+	}
+	// Marshalling a slice of strings can't fail.
+	appLabelKeysJSON, _ := json.Marshal(appLabelKeys)
+	labels[config.LabelAppLabelKeys] = string(appLabelKeysJSON)
 
 	var envVars []string
 
 	for _, envVar := range targetConfig.Env {
 		envVars = append(envVars, fmt.Sprintf("%s=%s", envVar.Name, envVar.Value))
 	}
+	envVars = append(envVars, metadataEnv(deploymentID, targetConfig)...)
 
 	network := container.NetworkMode(constants.DockerNetwork)
 	if targetConfig.Network != "" {
@@ -53,21 +126,67 @@ func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRe
 		NetworkMode:   network,
 		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
 		Binds:         targetConfig.Volumes,
+		LogConfig:     logConfig(targetConfig),
+		DNS:           targetConfig.DNS,
+		DNSSearch:     targetConfig.DNSSearch,
+		ExtraHosts:    targetConfig.ExtraHosts,
+	}
+
+	return AppContainerSpec{
+		Labels:           labels,
+		Env:              envVars,
+		HostConfig:       hostConfig,
+		NetworkingConfig: appNetworkingConfig(string(network), targetConfig.Name),
+	}, nil
+}
+
+// AppContainerName returns the container name of a replica. Replica IDs start at 1.
+func AppContainerName(appName, deploymentID string, replicaID, replicas int) string {
+	containerName := fmt.Sprintf("%s-haloy-%s", appName, deploymentID)
+	if replicas > 1 {
+		containerName += fmt.Sprintf("-replica-%d", replicaID)
+	}
+	return containerName
+}
+
+func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRef string, targetConfig config.TargetConfig) ([]ContainerRunResult, error) {
+	spec, err := BuildAppContainerSpec(deploymentID, targetConfig)
+	if err != nil {
+		return nil, err
+	}
+	return runContainers(ctx, cli, deploymentID, imageRef, targetConfig, spec)
+}
+
+// RunABVariantContainers starts the replicas of the variant deployment of an A/B test. They get the A/B variant
+// role, so they aren't taken for the deployment of the app, and no app alias, so other apps on the haloy network
+// keep reaching the app.
+func RunABVariantContainers(ctx context.Context, cli *client.Client, deploymentID, imageRef string, targetConfig config.TargetConfig) ([]ContainerRunResult, error) {
+	spec, err := BuildAppContainerSpec(deploymentID, targetConfig)
+	if err != nil {
+		return nil, err
+	}
+	spec.Labels[config.LabelRole] = config.ABVariantLabelRole
+	spec.NetworkingConfig = nil
+	return runContainers(ctx, cli, deploymentID, imageRef, targetConfig, spec)
+}
+
+func runContainers(ctx context.Context, cli *client.Client, deploymentID, imageRef string, targetConfig config.TargetConfig, spec AppContainerSpec) (result []ContainerRunResult, err error) {
+	result = make([]ContainerRunResult, 0, *targetConfig.Replicas)
+
+	if err := CheckImagePlatformCompatibility(ctx, cli, imageRef); err != nil {
+		return result, err
 	}
 
 	for i := range make([]struct{}, *targetConfig.Replicas) {
-		envVars := append(envVars, fmt.Sprintf("%s=%d", constants.EnvVarReplicaID, i+1))
+		envVars := append(spec.Env, fmt.Sprintf("%s=%d", constants.EnvVarReplicaID, i+1))
 		containerConfig := &container.Config{
 			Image:  imageRef,
-			Labels: labels,
+			Labels: spec.Labels,
 			Env:    envVars,
 		}
-		containerName := fmt.Sprintf("%s-haloy-%s", targetConfig.Name, deploymentID)
-		if *targetConfig.Replicas > 1 {
-			containerName += fmt.Sprintf("-replica-%d", i+1)
-		}
+		containerName := AppContainerName(targetConfig.Name, deploymentID, i+1, *targetConfig.Replicas)
 
-		createResponse, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, containerName)
+		createResponse, err := cli.ContainerCreate(ctx, containerConfig, spec.HostConfig, spec.NetworkingConfig, nil, containerName)
 		if err != nil {
 			return result, fmt.Errorf("failed to create container: %w", err)
 		}
@@ -81,6 +200,13 @@ func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRe
 			}
 		}(createResponse.ID)
 
+		// Extra networks are connected before start so the app can reach them from its first request.
+		for _, networkName := range targetConfig.Networks {
+			if err = cli.NetworkConnect(ctx, networkName, createResponse.ID, nil); err != nil {
+				return result, fmt.Errorf("failed to connect container to network %s: %w", networkName, err)
+			}
+		}
+
 		if err := cli.ContainerStart(ctx, createResponse.ID, container.StartOptions{}); err != nil {
 			return result, fmt.Errorf("failed to start container: %w", err)
 		}
@@ -96,6 +222,25 @@ func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRe
 	return result, nil
 }
 
+// AppNetworkAlias returns the alias all containers of an app share on the haloy network. It stays the same
+// across deployments, so other apps can use it instead of container names.
+func AppNetworkAlias(appName string) string {
+	return appName + ".haloy"
+}
+
+// appNetworkingConfig adds the app alias when the container runs on the haloy network.
+// Aliases are only supported on user-defined networks, so apps with a custom network get none.
+func appNetworkingConfig(networkName, appName string) *network.NetworkingConfig {
+	if networkName != constants.DockerNetwork || appName == "" {
+		return nil
+	}
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: []string{AppNetworkAlias(appName)}},
+		},
+	}
+}
+
 func StopContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, ignoreDeploymentID string) (stoppedIDs []string, err error) {
 	containerList, err := GetAppContainers(ctx, cli, true, appName)
 	if err != nil {
@@ -203,6 +348,55 @@ func stopSingleContainer(ctx context.Context, cli *client.Client, logger *slog.L
 	return nil
 }
 
+// RestartContainers restarts the containers of the latest deployment of an app one at a time, so replicas
+// keep serving while the others restart.
+func RestartContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName string) (restartedIDs []string, err error) {
+	containerList, err := GetAppContainers(ctx, cli, true, appName)
+	if err != nil {
+		return restartedIDs, err
+	}
+
+	latestDeploymentID := ""
+	for _, containerInfo := range containerList {
+		if deploymentID := containerInfo.Labels[config.LabelDeploymentID]; helpers.CompareDeploymentIDs(deploymentID, latestDeploymentID) > 0 {
+			latestDeploymentID = deploymentID
+		}
+	}
+
+	timeout := 20
+	for _, containerInfo := range containerList {
+		if containerInfo.Labels[config.LabelDeploymentID] != latestDeploymentID {
+			continue
+		}
+		if err := cli.ContainerRestart(ctx, containerInfo.ID, container.StopOptions{Timeout: &timeout}); err != nil {
+			return restartedIDs, fmt.Errorf("failed to restart container %s: %w", helpers.SafeIDPrefix(containerInfo.ID), err)
+		}
+		logger.Debug("Restarted container", "app", appName, "container_id", helpers.SafeIDPrefix(containerInfo.ID))
+		restartedIDs = append(restartedIDs, containerInfo.ID)
+	}
+	return restartedIDs, nil
+}
+
+// StartContainers starts the stopped containers of a deployment of an app.
+func StartContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, deploymentID string) (startedIDs []string, err error) {
+	containerList, err := GetAppContainers(ctx, cli, true, appName)
+	if err != nil {
+		return startedIDs, err
+	}
+
+	for _, containerInfo := range containerList {
+		if containerInfo.Labels[config.LabelDeploymentID] != deploymentID || containerInfo.State == "running" {
+			continue
+		}
+		if err := cli.ContainerStart(ctx, containerInfo.ID, container.StartOptions{}); err != nil {
+			return startedIDs, fmt.Errorf("failed to start container %s: %w", helpers.SafeIDPrefix(containerInfo.ID), err)
+		}
+		logger.Debug("Started container", "app", appName, "container_id", helpers.SafeIDPrefix(containerInfo.ID))
+		startedIDs = append(startedIDs, containerInfo.ID)
+	}
+	return startedIDs, nil
+}
+
 type RemoveContainersResult struct {
 	ID           string
 	DeploymentID string
@@ -214,7 +408,19 @@ func RemoveContainers(ctx context.Context, cli *client.Client, logger *slog.Logg
 	if err != nil {
 		return removedIDs, err
 	}
+	return removeContainers(ctx, cli, logger, containerList, ignoreDeploymentID), nil
+}
+
+// RemoveABVariantContainers removes the containers of the A/B test variants of an app, ignoring a specific deployment.
+func RemoveABVariantContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, ignoreDeploymentID string) (removedIDs []string, err error) {
+	containerList, err := GetABVariantContainers(ctx, cli, true, appName)
+	if err != nil {
+		return removedIDs, err
+	}
+	return removeContainers(ctx, cli, logger, containerList, ignoreDeploymentID), nil
+}
 
+func removeContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, containerList []container.Summary, ignoreDeploymentID string) (removedIDs []string) {
 	for _, containerInfo := range containerList {
 		deploymentID := containerInfo.Labels[config.LabelDeploymentID]
 		if deploymentID == ignoreDeploymentID {
@@ -223,13 +429,13 @@ func RemoveContainers(ctx context.Context, cli *client.Client, logger *slog.Logg
 
 		err := cli.ContainerRemove(ctx, containerInfo.ID, container.RemoveOptions{Force: true})
 		if err != nil {
-			logger.Error("Error removing container %s: %v\n", helpers.SafeIDPrefix(containerInfo.ID), err)
+			logger.Error("Error removing container", "container_id", helpers.SafeIDPrefix(containerInfo.ID), "error", err)
 		} else {
 			removedIDs = append(removedIDs, containerInfo.ID)
 		}
 	}
 
-	return removedIDs, nil
+	return removedIDs
 }
 
 func HealthCheckContainer(ctx context.Context, cli *client.Client, logger *slog.Logger, containerID string, initialWaitTime ...time.Duration) error {
@@ -257,9 +463,18 @@ func HealthCheckContainer(ctx context.Context, cli *client.Client, logger *slog.
 		}
 	}
 
-	if len(initialWaitTime) > 0 && initialWaitTime[0] > 0 {
-		waitTime := initialWaitTime[0]
+	labels, err := config.ParseContainerLabels(containerInfo.Config.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to parse container labels: %w", err)
+	}
+
+	var waitTime time.Duration
+	if len(initialWaitTime) > 0 {
+		waitTime = initialWaitTime[0]
+	}
+	waitTime = max(waitTime, labels.HealthCheckStartPeriod)
 
+	if waitTime > 0 {
 		waitTimer := time.NewTimer(waitTime)
 		select {
 		case <-ctx.Done():
@@ -268,7 +483,8 @@ func HealthCheckContainer(ctx context.Context, cli *client.Client, logger *slog.
 		}
 	}
 
-	if containerInfo.State.Health != nil {
+	// An explicitly configured health check type takes precedence over the Docker healthcheck.
+	if labels.HealthCheckType == "" && containerInfo.State.Health != nil {
 		if containerInfo.State.Health.Status == "healthy" {
 			return nil
 		}
@@ -311,57 +527,38 @@ func HealthCheckContainer(ctx context.Context, cli *client.Client, logger *slog.
 		}
 	}
 
-	labels, err := config.ParseContainerLabels(containerInfo.Config.Labels)
+	check, err := newHealthCheckFunc(cli, containerInfo, labels)
 	if err != nil {
-		return fmt.Errorf("failed to parse container labels: %w", err)
+		return err
 	}
 
-	if labels.Port == "" {
-		return fmt.Errorf("container %s has no port label set", helpers.SafeIDPrefix(containerID))
-	}
-
-	if labels.HealthCheckPath == "" {
-		return fmt.Errorf("container %s has no health check path set", helpers.SafeIDPrefix(containerID))
-	}
-
-	targetIP, err := ContainerNetworkIP(containerInfo, constants.DockerNetwork)
-	if err != nil {
-		return fmt.Errorf("failed to get container IP address: %w", err)
+	maxRetries := 5
+	if labels.HealthCheckRetries > 0 {
+		maxRetries = labels.HealthCheckRetries
 	}
 
-	healthCheckURL := fmt.Sprintf("http://%s:%s%s", targetIP, labels.Port, labels.HealthCheckPath)
-	maxRetries := 5
+	// Back off exponentially unless a fixed interval is configured.
 	backoff := 500 * time.Millisecond
-
-	httpClient := &http.Client{
-		Timeout: 5 * time.Second,
+	fixedInterval := labels.HealthCheckInterval > 0
+	if fixedInterval {
+		backoff = labels.HealthCheckInterval
 	}
 
 	for retry := 0; retry < maxRetries; retry++ {
 		if retry > 0 {
 			logger.Info("Retrying health check...", "backoff", backoff, "attempt", retry+1, "max_retries", maxRetries)
 			time.Sleep(backoff)
-			backoff *= 2
-		}
-
-		req, err := http.NewRequestWithContext(ctx, "GET", healthCheckURL, nil)
-		if err != nil {
-			return fmt.Errorf("failed to create health check request: %w", err)
+			if !fixedInterval {
+				backoff *= 2
+			}
 		}
 
-		resp, err := httpClient.Do(req)
-		if err != nil {
+		if err := check(ctx); err != nil {
 			logger.Warn("Health check attempt failed", "error", err)
 			continue
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			return nil
-		}
 
-		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		logger.Warn("Health check returned error status", "status_code", resp.StatusCode, "response", string(bodyBytes))
+		return nil
 	}
 
 	return fmt.Errorf("container %s failed health check after %d attempts", helpers.SafeIDPrefix(containerID), maxRetries)
@@ -380,8 +577,17 @@ func HealthCheckContainer(ctx context.Context, cli *client.Client, logger *slog.
 //   - A slice of container summaries.
 //   - An error if something went wrong during the container listing.
 func GetAppContainers(ctx context.Context, cli *client.Client, listAll bool, appName string) ([]container.Summary, error) {
+	return listRoleContainers(ctx, cli, listAll, config.AppLabelRole, appName)
+}
+
+// GetABVariantContainers returns the containers of the A/B test variants, of all apps when appName is empty.
+func GetABVariantContainers(ctx context.Context, cli *client.Client, listAll bool, appName string) ([]container.Summary, error) {
+	return listRoleContainers(ctx, cli, listAll, config.ABVariantLabelRole, appName)
+}
+
+func listRoleContainers(ctx context.Context, cli *client.Client, listAll bool, role, appName string) ([]container.Summary, error) {
 	filterArgs := filters.NewArgs()
-	filterArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelRole, config.AppLabelRole))
+	filterArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelRole, role))
 	if appName != "" {
 		filterArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelAppName, appName))
 	}
@@ -400,6 +606,139 @@ func GetAppContainers(ctx context.Context, cli *client.Client, listAll bool, app
 	return containerList, nil
 }
 
+// logConfig returns the log configuration for the containers of a target. An empty config uses the Docker daemon default.
+func logConfig(targetConfig config.TargetConfig) container.LogConfig {
+	if targetConfig.Logging == nil {
+		return container.LogConfig{}
+	}
+	return container.LogConfig{
+		Type:   targetConfig.Logging.Driver,
+		Config: targetConfig.Logging.DriverOptions(),
+	}
+}
+
+// metadataEnv returns the deployment metadata injected into every app container so apps can tag telemetry
+// without duplicating config. It's added after the configured env and takes precedence over it.
+func metadataEnv(deploymentID string, targetConfig config.TargetConfig) []string {
+	imageRef := ""
+	if targetConfig.Image != nil {
+		imageRef = targetConfig.Image.ImageRef()
+	}
+
+	var domains []string
+	for _, domain := range targetConfig.Domains {
+		domains = append(domains, domain.Canonical)
+		domains = append(domains, domain.Aliases...)
+	}
+
+	return []string{
+		fmt.Sprintf("%s=%s", constants.EnvVarAppName, targetConfig.Name),
+		fmt.Sprintf("%s=%s", constants.EnvVarDeploymentID, deploymentID),
+		fmt.Sprintf("%s=%s", constants.EnvVarTarget, targetConfig.TargetName),
+		fmt.Sprintf("%s=%s", constants.EnvVarImageRef, imageRef),
+		fmt.Sprintf("%s=%s", constants.EnvVarDomains, strings.Join(domains, ",")),
+	}
+}
+
+// GetReplicaContainer returns the running container of the latest deployment of an app for the given replica (starting at 1).
+func GetReplicaContainer(ctx context.Context, cli *client.Client, appName string, replica int) (container.Summary, error) {
+	containerList, err := GetAppContainers(ctx, cli, false, appName)
+	if err != nil {
+		return container.Summary{}, err
+	}
+	if len(containerList) == 0 {
+		return container.Summary{}, fmt.Errorf("no running containers found for app %s", appName)
+	}
+
+	latestDeploymentID := ""
+	for _, c := range containerList {
+		if id := c.Labels[config.LabelDeploymentID]; helpers.CompareDeploymentIDs(id, latestDeploymentID) > 0 {
+			latestDeploymentID = id
+		}
+	}
+
+	var deploymentContainers []container.Summary
+	for _, c := range containerList {
+		if c.Labels[config.LabelDeploymentID] == latestDeploymentID {
+			deploymentContainers = append(deploymentContainers, c)
+		}
+	}
+
+	// Containers of a single replica deployment don't have a replica suffix.
+	if len(deploymentContainers) == 1 && replica == 1 {
+		return deploymentContainers[0], nil
+	}
+
+	suffix := fmt.Sprintf("-replica-%d", replica)
+	for _, c := range deploymentContainers {
+		for _, name := range c.Names {
+			if strings.HasSuffix(name, suffix) {
+				return c, nil
+			}
+		}
+	}
+
+	return container.Summary{}, fmt.Errorf("replica %d not found for app %s (%d running)", replica, appName, len(deploymentContainers))
+}
+
+// ReplicaID returns the replica number of an app container, based on the replica suffix of its name.
+// Containers of a single replica deployment don't have a suffix and are replica 1.
+func ReplicaID(c container.Summary) int {
+	for _, name := range c.Names {
+		if i := strings.LastIndex(name, "-replica-"); i >= 0 {
+			if id, err := strconv.Atoi(name[i+len("-replica-"):]); err == nil {
+				return id
+			}
+		}
+	}
+	return 1
+}
+
+// CloneReplica creates and starts a replica from the container of another replica of the same deployment.
+// The clone keeps the resolved configuration of the source, only the name and replica ID differ.
+func CloneReplica(ctx context.Context, cli *client.Client, source container.InspectResponse, replica int) (string, error) {
+	containerConfig := *source.Config
+	containerConfig.Hostname = ""
+	containerConfig.Env = make([]string, 0, len(source.Config.Env))
+	for _, env := range source.Config.Env {
+		if !strings.HasPrefix(env, constants.EnvVarReplicaID+"=") {
+			containerConfig.Env = append(containerConfig.Env, env)
+		}
+	}
+	containerConfig.Env = append(containerConfig.Env, fmt.Sprintf("%s=%d", constants.EnvVarReplicaID, replica))
+
+	name := strings.TrimPrefix(source.Name, "/")
+	if i := strings.LastIndex(name, "-replica-"); i >= 0 {
+		name = name[:i]
+	}
+	name += fmt.Sprintf("-replica-%d", replica)
+
+	networkingConfig := appNetworkingConfig(string(source.HostConfig.NetworkMode), source.Config.Labels[config.LabelAppName])
+	createResponse, err := cli.ContainerCreate(ctx, &containerConfig, source.HostConfig, networkingConfig, nil, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	if source.NetworkSettings != nil {
+		for networkName := range source.NetworkSettings.Networks {
+			if networkName == string(source.HostConfig.NetworkMode) {
+				continue
+			}
+			if err := cli.NetworkConnect(ctx, networkName, createResponse.ID, nil); err != nil {
+				cli.ContainerRemove(ctx, createResponse.ID, container.RemoveOptions{Force: true})
+				return "", fmt.Errorf("failed to connect container to network %s: %w", networkName, err)
+			}
+		}
+	}
+
+	if err := cli.ContainerStart(ctx, createResponse.ID, container.StartOptions{}); err != nil {
+		cli.ContainerRemove(ctx, createResponse.ID, container.RemoveOptions{Force: true})
+		return "", fmt.Errorf("failed to start container: %w", err)
+	}
+
+	return createResponse.ID, nil
+}
+
 // ContainerNetworkInfo extracts the container's IP address
 func ContainerNetworkIP(containerInfo container.InspectResponse, networkName string) (string, error) {
 	if containerInfo.State == nil {
@@ -430,8 +769,8 @@ func ContainerNetworkIP(containerInfo container.InspectResponse, networkName str
 	return ipAddress, nil
 }
 
-// checkImagePlatformCompatibility verifies the image platform matches the host
-func checkImagePlatformCompatibility(ctx context.Context, cli *client.Client, imageRef string) error {
+// CheckImagePlatformCompatibility verifies the image platform matches the host
+func CheckImagePlatformCompatibility(ctx context.Context, cli *client.Client, imageRef string) error {
 	imageInspect, err := cli.ImageInspect(ctx, imageRef)
 	if err != nil {
 		return fmt.Errorf("failed to inspect image %s: %w", imageRef, err)
@@ -459,12 +798,20 @@ func checkImagePlatformCompatibility(ctx context.Context, cli *client.Client, im
 	}
 
 	if imagePlatform != hostPlatform {
-		return fmt.Errorf(
-			"image built for %s but host is %s. "+
-				"Rebuild the image for the correct platform or use docker buildx with --platform flag",
-			imagePlatform, hostPlatform,
-		)
+		return &PlatformMismatchError{ImagePlatform: imagePlatform, HostPlatform: hostPlatform}
 	}
 
 	return nil
 }
+
+// PlatformMismatchError is returned by CheckImagePlatformCompatibility when the image can't run on the host.
+type PlatformMismatchError struct {
+	ImagePlatform string
+	HostPlatform  string
+}
+
+func (e *PlatformMismatchError) Error() string {
+	return fmt.Sprintf("image built for %s but host is %s. "+
+		"Rebuild the image for the correct platform or use docker buildx with --platform flag",
+		e.ImagePlatform, e.HostPlatform)
+}
@@ -0,0 +1,350 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	defaultHealthCheckTimeout = 5 * time.Second
+	// Warmup requests are expected to be slow, that's the point of sending them.
+	warmupRequestTimeout = 30 * time.Second
+
+	grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+	// grpcServingStatus is the SERVING value of grpc.health.v1.HealthCheckResponse.ServingStatus.
+	grpcServingStatus = 1
+)
+
+// healthCheckFunc performs a single health check attempt and returns an error if the container is not healthy.
+type healthCheckFunc func(ctx context.Context) error
+
+// newHealthCheckFunc returns the health check matching the type set in the container labels.
+func newHealthCheckFunc(cli *client.Client, containerInfo container.InspectResponse, labels *config.ContainerLabels) (healthCheckFunc, error) {
+	containerID := containerInfo.ID
+
+	timeout := defaultHealthCheckTimeout
+	if labels.HealthCheckTimeout > 0 {
+		timeout = labels.HealthCheckTimeout
+	}
+
+	// Exec checks run inside the container and don't need network access.
+	if labels.HealthCheckType == config.HealthCheckTypeExec {
+		if len(labels.HealthCheckCommand) == 0 {
+			return nil, fmt.Errorf("container %s has no health check command set", helpers.SafeIDPrefix(containerID))
+		}
+		command := labels.HealthCheckCommand
+		return func(ctx context.Context) error {
+			return execHealthCheck(ctx, cli, containerID, command, timeout)
+		}, nil
+	}
+
+	if labels.Port == "" {
+		return nil, fmt.Errorf("container %s has no port label set", helpers.SafeIDPrefix(containerID))
+	}
+
+	targetIP, err := ContainerNetworkIP(containerInfo, constants.DockerNetwork)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container IP address: %w", err)
+	}
+	address := net.JoinHostPort(targetIP, labels.Port.String())
+
+	switch labels.HealthCheckType {
+	case config.HealthCheckTypeTCP:
+		return func(ctx context.Context) error {
+			return tcpHealthCheck(ctx, address, timeout)
+		}, nil
+	case config.HealthCheckTypeGRPC:
+		service := labels.HealthCheckGRPCService
+		return func(ctx context.Context) error {
+			return grpcHealthCheck(ctx, address, service, timeout)
+		}, nil
+	default:
+		path := labels.HealthCheckPath
+		if labels.HealthCheckReadinessPath != "" {
+			path = labels.HealthCheckReadinessPath
+		}
+		if path == "" {
+			return nil, fmt.Errorf("container %s has no health check path set", helpers.SafeIDPrefix(containerID))
+		}
+		healthCheckURL := fmt.Sprintf("http://%s%s", address, path)
+		expectedStatusCodes := labels.HealthCheckExpectedStatusCodes
+		return func(ctx context.Context) error {
+			return httpHealthCheck(ctx, healthCheckURL, expectedStatusCodes, timeout)
+		}, nil
+	}
+}
+
+// httpHealthCheck sends a GET request to the health check URL. Any 2xx status is healthy
+// unless expectedStatusCodes is set.
+func httpHealthCheck(ctx context.Context, healthCheckURL string, expectedStatusCodes []int, timeout time.Duration) error {
+	httpClient := &http.Client{
+		Timeout: timeout,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", healthCheckURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if len(expectedStatusCodes) > 0 {
+		if slices.Contains(expectedStatusCodes, resp.StatusCode) {
+			return nil
+		}
+	} else if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("health check returned status %d: %s", resp.StatusCode, string(bodyBytes))
+}
+
+func tcpHealthCheck(ctx context.Context, address string, timeout time.Duration) error {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	return conn.Close()
+}
+
+// grpcHealthCheck calls the standard gRPC health service (grpc.health.v1.Health/Check) over
+// unencrypted HTTP/2. The protobuf messages are small enough to be encoded by hand.
+func grpcHealthCheck(ctx context.Context, address, service string, timeout time.Duration) error {
+	// HealthCheckRequest has a single string field: service = 1.
+	var message []byte
+	if service != "" {
+		message = append(message, 0x0a)
+		message = binary.AppendUvarint(message, uint64(len(service)))
+		message = append(message, service...)
+	}
+
+	// Length-prefixed gRPC message: 1 byte compression flag followed by a big endian uint32 length.
+	body := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(message)))
+	body = append(body, message...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+grpcHealthCheckPath, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create gRPC health check request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Protocols: protocols},
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The body must be read to the end before trailers are available.
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read gRPC health check response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gRPC health check returned HTTP status %d", resp.StatusCode)
+	}
+
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	grpcMessage := resp.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" {
+		// Trailers-only responses put the status in the headers.
+		grpcStatus = resp.Header.Get("Grpc-Status")
+		grpcMessage = resp.Header.Get("Grpc-Message")
+	}
+	if grpcStatus != "0" {
+		return fmt.Errorf("gRPC health check failed with status %s: %s", grpcStatus, grpcMessage)
+	}
+
+	servingStatus, err := parseGRPCHealthCheckResponse(respBody)
+	if err != nil {
+		return err
+	}
+	if servingStatus != grpcServingStatus {
+		return fmt.Errorf("gRPC service is not serving (status %d)", servingStatus)
+	}
+
+	return nil
+}
+
+// parseGRPCHealthCheckResponse decodes the status field (1) of a length-prefixed HealthCheckResponse message.
+func parseGRPCHealthCheckResponse(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, fmt.Errorf("gRPC health check response is too short")
+	}
+	if body[0] != 0 {
+		return 0, fmt.Errorf("compressed gRPC health check responses are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < length {
+		return 0, fmt.Errorf("gRPC health check response is truncated")
+	}
+	message := body[5 : 5+length]
+
+	var status uint64
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid gRPC health check response")
+		}
+		message = message[n:]
+
+		fieldNumber, wireType := key>>3, key&0x7
+		switch wireType {
+		case 0: // varint
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, fmt.Errorf("invalid gRPC health check response")
+			}
+			message = message[n:]
+			if fieldNumber == 1 {
+				status = value
+			}
+		case 1: // fixed64
+			if len(message) < 8 {
+				return 0, fmt.Errorf("invalid gRPC health check response")
+			}
+			message = message[8:]
+		case 2: // length-delimited
+			size, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < size {
+				return 0, fmt.Errorf("invalid gRPC health check response")
+			}
+			message = message[n+int(size):]
+		case 5: // fixed32
+			if len(message) < 4 {
+				return 0, fmt.Errorf("invalid gRPC health check response")
+			}
+			message = message[4:]
+		default:
+			return 0, fmt.Errorf("invalid gRPC health check response")
+		}
+	}
+
+	return status, nil
+}
+
+func execHealthCheck(ctx context.Context, cli *client.Client, containerID string, command []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	execResp, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exec health check: %w", err)
+	}
+
+	attachResp, err := cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start exec health check: %w", err)
+	}
+	defer attachResp.Close()
+
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, attachResp.Reader); err != nil {
+		return fmt.Errorf("failed to read exec health check output: %w", err)
+	}
+
+	for {
+		inspect, err := cli.ContainerExecInspect(ctx, execResp.ID)
+		if err != nil {
+			return fmt.Errorf("failed to inspect exec health check: %w", err)
+		}
+
+		if !inspect.Running {
+			if inspect.ExitCode != 0 {
+				out := strings.TrimSpace(output.String())
+				if len(out) > 1024 {
+					out = out[:1024]
+				}
+				return fmt.Errorf("health check command exited with code %d: %s", inspect.ExitCode, out)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for health check command to finish")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// WarmupContainer sends requests to each path so the app can initialize caches and JIT compile
+// hot paths before it receives traffic. Failed requests are logged but don't fail the deployment.
+func WarmupContainer(ctx context.Context, logger *slog.Logger, address string, paths []string, requests int) {
+	if requests < 1 {
+		requests = 1
+	}
+
+	httpClient := &http.Client{
+		Timeout: warmupRequestTimeout,
+	}
+
+	start := time.Now()
+	failed := 0
+	for _, path := range paths {
+		warmupURL := fmt.Sprintf("http://%s%s", address, path)
+		for range requests {
+			if ctx.Err() != nil {
+				logger.Warn("Warmup canceled", "address", address, "error", ctx.Err())
+				return
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, warmupURL, nil)
+			if err != nil {
+				logger.Warn("Failed to create warmup request", "url", warmupURL, "error", err)
+				failed++
+				continue
+			}
+
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				logger.Debug("Warmup request failed", "url", warmupURL, "error", err)
+				failed++
+				continue
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+
+	logger.Info("Warmup completed",
+		"address", address,
+		"requests", len(paths)*requests,
+		"failed", failed,
+		"duration", time.Since(start).Round(time.Millisecond))
+}
@@ -9,8 +9,11 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
@@ -52,6 +55,46 @@ func getRegistryAuthString(imageConfig *config.Image) (string, error) {
 	return authStr, nil
 }
 
+// The embedded registry of haloyd. Images pushed to <domain>/<repository> are pulled through the
+// API port published on localhost, which Docker allows without TLS.
+var (
+	localRegistryMutex  sync.RWMutex
+	localRegistryDomain string
+	localRegistryToken  string
+)
+
+// SetLocalRegistry makes images on domain pull from the embedded registry.
+func SetLocalRegistry(domain, token string) {
+	localRegistryMutex.Lock()
+	defer localRegistryMutex.Unlock()
+	localRegistryDomain = domain
+	localRegistryToken = token
+}
+
+// localRegistryPull returns the reference and auth to pull the image from the embedded registry,
+// if the image is hosted there.
+func localRegistryPull(imageConfig *config.Image) (pullRef, registryAuth string, ok bool) {
+	localRegistryMutex.RLock()
+	domain, token := localRegistryDomain, localRegistryToken
+	localRegistryMutex.RUnlock()
+
+	server := GetRegistryServer(imageConfig)
+	if domain == "" || !strings.EqualFold(server, domain) {
+		return "", "", false
+	}
+
+	localServer := "localhost:" + constants.APIServerPort
+	authStr, err := registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      "haloy",
+		Password:      token,
+		ServerAddress: localServer,
+	})
+	if err != nil {
+		return "", "", false
+	}
+	return localServer + "/" + strings.TrimPrefix(imageConfig.ImageRef(), server+"/"), authStr, true
+}
+
 func EnsureImageUpToDate(ctx context.Context, cli *client.Client, logger *slog.Logger, imageConfig config.Image) error {
 	imageRef := imageConfig.ImageRef()
 
@@ -67,6 +110,10 @@ func EnsureImageUpToDate(ctx context.Context, cli *client.Client, logger *slog.L
 		return nil
 	}
 
+	if pullRef, registryAuth, ok := localRegistryPull(&imageConfig); ok {
+		return pullFromLocalRegistry(ctx, cli, logger, imageRef, pullRef, registryAuth)
+	}
+
 	registryAuth, err := getRegistryAuthString(&imageConfig)
 	if err != nil {
 		return fmt.Errorf("failed to resolve registry auth for image %s: %w", imageRef, err)
@@ -159,7 +206,7 @@ func RemoveImages(ctx context.Context, cli *client.Client, logger *slog.Logger,
 			if strings.HasSuffix(tag, ":latest") || strings.HasSuffix(tag, ":"+ignoreDeploymentID) || !strings.HasPrefix(tag, appName+":") {
 				continue
 			}
-			// Expected tag format: "appName:deploymentID", e.g. "test-app:20250615214304"
+			// Expected tag format: "appName:deploymentID", e.g. "test-app:01jxvq7m3k8h2n4p6r9s0t1v2w"
 			parts := strings.SplitN(tag, ":", 2)
 			if len(parts) != 2 {
 				// Unexpected tag format, skip this tag.
@@ -176,7 +223,7 @@ func RemoveImages(ctx context.Context, cli *client.Client, logger *slog.Logger,
 
 	// Sort the candidate tags descending by deploymentID (newest first).
 	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].DeploymentID > candidates[j].DeploymentID
+		return helpers.CompareDeploymentIDs(candidates[i].DeploymentID, candidates[j].DeploymentID) > 0
 	})
 
 	// Build sets of safe-to-keep tags and the corresponding imageIDs.
@@ -222,65 +269,120 @@ func LoadImageFromTar(ctx context.Context, cli *client.Client, tarPath string) e
 	}
 	defer file.Close()
 
-	response, err := cli.ImageLoad(ctx, file)
-	if err != nil {
-		return fmt.Errorf("failed to load image: %w", err)
-	}
-	defer response.Body.Close()
+	_, err = LoadImage(ctx, cli, file)
+	return err
+}
 
-	// Read and parse the JSON response
-	body, err := io.ReadAll(response.Body)
+// LoadImage loads an image archive, as created by docker save, and returns the loaded image
+// references. Docker detects gzip and zstd compressed archives by itself.
+func LoadImage(ctx context.Context, cli *client.Client, archive io.Reader) ([]string, error) {
+	response, err := cli.ImageLoad(ctx, archive)
 	if err != nil {
-		return fmt.Errorf("failed to read load response: %w", err)
+		return nil, fmt.Errorf("failed to load image: %w", err)
 	}
+	defer response.Body.Close()
 
-	responseText := string(body)
-
-	// Parse JSON lines to find loaded images
-	lines := strings.Split(responseText, "\n")
-	loadedImages := []string{}
-	allMessages := []string{}
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	var loadedImages []string
+	var messages []string
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var message struct {
+			Stream      string `json:"stream"`
+			Status      string `json:"status"`
+			ErrorDetail *struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
 		}
-
-		// Parse each JSON line
-		var jsonResponse struct {
-			Stream string `json:"stream"`
-			Status string `json:"status"`
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read load response: %w", err)
 		}
 
-		if err := json.Unmarshal([]byte(line), &jsonResponse); err != nil {
-			// Skip non-JSON lines but log them
-			allMessages = append(allMessages, line)
-			continue
+		if message.ErrorDetail != nil {
+			return nil, fmt.Errorf("failed to load image: %s", message.ErrorDetail.Message)
 		}
-
-		// Collect all messages for debugging
-		if jsonResponse.Stream != "" {
-			allMessages = append(allMessages, jsonResponse.Stream)
+		if message.Stream != "" {
+			messages = append(messages, strings.TrimSpace(message.Stream))
 		}
-		if jsonResponse.Status != "" {
-			allMessages = append(allMessages, jsonResponse.Status)
+		if message.Status != "" {
+			messages = append(messages, message.Status)
 		}
 
-		// Look for "Loaded image:" in the stream field
-		if jsonResponse.Stream != "" && strings.HasPrefix(jsonResponse.Stream, "Loaded image:") {
-			loadedImage := strings.TrimSpace(strings.TrimPrefix(jsonResponse.Stream, "Loaded image:"))
-			loadedImages = append(loadedImages, loadedImage)
+		// Images loaded by reference are reported as "Loaded image: <ref>", untagged ones as "Loaded image ID: <id>".
+		if loadedImage, ok := strings.CutPrefix(strings.TrimSpace(message.Stream), "Loaded image:"); ok {
+			loadedImages = append(loadedImages, strings.TrimSpace(loadedImage))
+		} else if loadedImage, ok := strings.CutPrefix(strings.TrimSpace(message.Stream), "Loaded image ID:"); ok {
+			loadedImages = append(loadedImages, strings.TrimSpace(loadedImage))
 		}
 	}
 
 	if len(loadedImages) == 0 {
-		return fmt.Errorf("no images were loaded from tar file. All messages: %v", allMessages)
+		return nil, fmt.Errorf("no images were loaded from archive. All messages: %v", messages)
 	}
 
+	return loadedImages, nil
+}
+
+// pullFromLocalRegistry pulls an image from the embedded registry and tags it with the pushed
+// reference. Layers pulled before are reused, so pulling an unchanged image only fetches the manifest.
+func pullFromLocalRegistry(ctx context.Context, cli *client.Client, logger *slog.Logger, imageRef, pullRef, registryAuth string) error {
+	logger.Debug("Pulling image from embedded registry", "image", imageRef)
+	r, err := cli.ImagePull(ctx, pullRef, image.PullOptions{RegistryAuth: registryAuth})
+	if err != nil {
+		return fmt.Errorf("failed to pull %s from embedded registry: %w", imageRef, err)
+	}
+	defer r.Close()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("error reading pull response: %w", err)
+	}
+
+	if err := cli.ImageTag(ctx, pullRef, imageRef); err != nil {
+		return fmt.Errorf("failed to tag %s: %w", imageRef, err)
+	}
 	return nil
 }
 
+// PresentLayers returns how many of the leading layers, given by their diff IDs, are already part
+// of an image on the host. docker load skips layers whose chain of parent layers exists, so an
+// uploaded archive can leave them out. Returns 0 when the host uses the containerd image store,
+// which expects complete archives.
+func PresentLayers(ctx context.Context, cli *client.Client, diffIDs []string) (int, error) {
+	hostInfo, err := cli.Info(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get docker info: %w", err)
+	}
+	for _, status := range hostInfo.DriverStatus {
+		if status[0] == "driver-type" && strings.Contains(status[1], "containerd") {
+			return 0, nil
+		}
+	}
+
+	images, err := cli.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	present := 0
+	for _, summary := range images {
+		imageInfo, err := cli.ImageInspect(ctx, summary.ID)
+		if err != nil || imageInfo.RootFS.Layers == nil {
+			continue
+		}
+		layers := imageInfo.RootFS.Layers
+		shared := 0
+		for shared < len(layers) && shared < len(diffIDs) && layers[shared] == diffIDs[shared] {
+			shared++
+		}
+		present = max(present, shared)
+		if present == len(diffIDs) {
+			break
+		}
+	}
+	return present, nil
+}
+
 func PushImage(ctx context.Context, cli *client.Client, imageRef string, imageConfig *config.Image) error {
 	if imageConfig.RegistryAuth == nil {
 		return fmt.Errorf("no registry authentication configured for image %s", imageRef)
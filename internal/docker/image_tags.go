@@ -0,0 +1,233 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/docker/docker/client"
+)
+
+// maxTagPages limits the pages read from registries that return the tags of a repository in pages.
+const maxTagPages = 20
+
+var registryClient = &http.Client{Timeout: 30 * time.Second}
+
+// RemoteImageDigest returns the digest of the image in its registry, without pulling it.
+func RemoteImageDigest(ctx context.Context, cli *client.Client, imageConfig config.Image) (string, error) {
+	imageRef := imageConfig.ImageRef()
+	registryAuth, err := getRegistryAuthString(&imageConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve registry auth for image %s: %w", imageRef, err)
+	}
+	if pullRef, localAuth, ok := localRegistryPull(&imageConfig); ok {
+		imageRef, registryAuth = pullRef, localAuth
+	}
+
+	remote, err := cli.DistributionInspect(ctx, imageRef, registryAuth)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s in its registry: %w", imageConfig.ImageRef(), err)
+	}
+	return remote.Descriptor.Digest.String(), nil
+}
+
+// ListImageTags returns the tags of the repository of the image from its registry, using the registry API
+// directly as Docker can't list tags. Registries asking for a bearer token get one with the registry
+// credentials of the image, or anonymously without them.
+func ListImageTags(ctx context.Context, imageConfig config.Image) ([]string, error) {
+	server := GetRegistryServer(&imageConfig)
+	repository := registryRepository(imageConfig.Repository, server)
+	scheme, host := "https", server
+	username, password := "", ""
+	if auth := imageConfig.RegistryAuth; auth != nil {
+		username, password = auth.Username.Value, auth.Password.Value
+	}
+
+	if _, _, ok := localRegistryPull(&imageConfig); ok {
+		localRegistryMutex.RLock()
+		token := localRegistryToken
+		localRegistryMutex.RUnlock()
+		scheme, host = "http", "localhost:"+constants.APIServerPort
+		username, password = "haloy", token
+	} else if host == "index.docker.io" || host == "docker.io" {
+		host = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+
+	next := fmt.Sprintf("%s://%s/v2/%s/tags/list?n=1000", scheme, host, repository)
+	authorization := ""
+	var tags []string
+	for page := 0; next != "" && page < maxTagPages; page++ {
+		resp, err := registryGet(ctx, next, authorization)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && authorization == "" {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if authorization, err = registryAuthorization(ctx, challenge, repository, username, password); err != nil {
+				return nil, err
+			}
+			if resp, err = registryGet(ctx, next, authorization); err != nil {
+				return nil, err
+			}
+		}
+
+		var tagList struct {
+			Tags []string `json:"tags"`
+		}
+		err = func() error {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("failed to list tags of %s: registry returned %s", imageConfig.Repository, resp.Status)
+			}
+			return json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&tagList)
+		}()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tagList.Tags...)
+
+		next, err = nextTagsPage(resp.Request.URL, resp.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// registryRepository returns the name of the repository in its registry, without the registry server and tag.
+func registryRepository(repository, server string) string {
+	repository = strings.TrimPrefix(repository, server+"/")
+	if host, rest, found := strings.Cut(repository, "/"); found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		repository = rest
+	}
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+	return repository
+}
+
+func registryGet(ctx context.Context, target, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	return resp, nil
+}
+
+// registryAuthorization answers the WWW-Authenticate challenge of a registry, with basic auth or a bearer
+// token from the token service the challenge names.
+func registryAuthorization(ctx context.Context, challenge, repository, username, password string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", fmt.Errorf("registry requires credentials, set image.registry")
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(username, password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("registry asked for unsupported authentication '%s'", scheme)
+	}
+
+	values := parseChallengeParams(params)
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("registry returned an invalid token realm '%s'", values["realm"])
+	}
+	query := realm.Query()
+	if service := values["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("registry returned no token")
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallengeParams parses the comma separated key="value" parameters of a WWW-Authenticate challenge.
+// Quoted values can contain commas, e.g. scope="repository:org/app:pull,push".
+func parseChallengeParams(params string) map[string]string {
+	values := make(map[string]string)
+	for params != "" {
+		key, rest, found := strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		if !found {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		values[strings.ToLower(strings.TrimSpace(key))] = value
+		params = rest
+	}
+	return values
+}
+
+// nextTagsPage returns the URL of the next page from the Link header of a tags list, or "" on the last page.
+func nextTagsPage(current *url.URL, link string) (string, error) {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return "", nil
+	}
+	target, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(link), "<"), ">")
+	next, err := current.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("registry returned an invalid next page '%s': %w", target, err)
+	}
+	return next.String(), nil
+}
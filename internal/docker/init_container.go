@@ -0,0 +1,166 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// RunInitContainers runs the init containers of a deployment one at a time and returns an error
+// if any of them exits with a non-zero code or times out. Output is streamed to the logger.
+func RunInitContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, deploymentID, appImageRef string, targetConfig config.TargetConfig) error {
+	for _, initContainer := range targetConfig.InitContainers {
+		logger.Info("Running init container", "init_container", initContainer.Name)
+		start := time.Now()
+		if err := runInitContainer(ctx, cli, logger, deploymentID, appImageRef, targetConfig, initContainer); err != nil {
+			return fmt.Errorf("init container '%s' failed: %w", initContainer.Name, err)
+		}
+		logger.Info("Init container completed", "init_container", initContainer.Name, "duration", time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func runInitContainer(ctx context.Context, cli *client.Client, logger *slog.Logger, deploymentID, appImageRef string, targetConfig config.TargetConfig, initContainer config.InitContainer) error {
+	timeout, err := initContainer.TimeoutDuration()
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+
+	imageRef := appImageRef
+	if initContainer.Image != nil {
+		if err := EnsureImageUpToDate(ctx, cli, logger, *initContainer.Image); err != nil {
+			return err
+		}
+		imageRef = initContainer.Image.ImageRef()
+	}
+
+	// Init containers get the app environment so migrations can reach the same database.
+	env := make(map[string]string)
+	var envNames []string
+	for _, envVar := range slices.Concat(targetConfig.Env, initContainer.Env) {
+		if _, exists := env[envVar.Name]; !exists {
+			envNames = append(envNames, envVar.Name)
+		}
+		env[envVar.Name] = envVar.Value
+	}
+	envVars := make([]string, 0, len(envNames))
+	for _, name := range envNames {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", name, env[name]))
+	}
+
+	network := container.NetworkMode(constants.DockerNetwork)
+	if targetConfig.Network != "" {
+		network = container.NetworkMode(targetConfig.Network)
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: network,
+		Binds:       initContainer.Volumes,
+		LogConfig:   logConfig(targetConfig),
+		DNS:         targetConfig.DNS,
+		DNSSearch:   targetConfig.DNSSearch,
+		ExtraHosts:  targetConfig.ExtraHosts,
+	}
+	containerConfig := &container.Config{
+		Image: imageRef,
+		Labels: map[string]string{
+			config.LabelAppName:           targetConfig.Name,
+			config.LabelDeploymentID:      deploymentID,
+			config.LabelRole:              config.InitLabelRole,
+			config.LabelInitContainerName: initContainer.Name,
+		},
+		Env: envVars,
+		Cmd: initContainer.Command,
+	}
+	containerName := fmt.Sprintf("%s-haloy-%s-init-%s", targetConfig.Name, deploymentID, initContainer.Name)
+
+	createResponse, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	containerID := createResponse.ID
+
+	// Init containers are always removed, also when the deployment is canceled.
+	defer func() {
+		if err := cli.ContainerRemove(context.WithoutCancel(ctx), containerID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Warn("Failed to remove init container", "container_id", helpers.SafeIDPrefix(containerID), "error", err)
+		}
+	}()
+
+	for _, networkName := range targetConfig.Networks {
+		if err := cli.NetworkConnect(ctx, networkName, containerID, nil); err != nil {
+			return fmt.Errorf("failed to connect container to network %s: %w", networkName, err)
+		}
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Wait must be registered before the container starts so a fast exit isn't missed.
+	waitC, waitErrC := cli.ContainerWait(runCtx, containerID, container.WaitConditionNextExit)
+
+	if err := cli.ContainerStart(runCtx, containerID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		streamInitContainerLogs(runCtx, cli, logger, containerID, initContainer.Name)
+	}()
+
+	select {
+	case result := <-waitC:
+		<-logsDone
+		if result.Error != nil {
+			return fmt.Errorf("failed waiting for container: %s", result.Error.Message)
+		}
+		if result.StatusCode != 0 {
+			return fmt.Errorf("exited with code %d", result.StatusCode)
+		}
+		return nil
+	case err := <-waitErrC:
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		return fmt.Errorf("failed waiting for container: %w", err)
+	}
+}
+
+// streamInitContainerLogs forwards the output of an init container to the logger line by line until the container exits.
+func streamInitContainerLogs(ctx context.Context, cli *client.Client, logger *slog.Logger, containerID, name string) {
+	logs, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		logger.Warn("Failed to stream init container logs", "init_container", name, "error", err)
+		return
+	}
+	defer logs.Close()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, logs)
+		pw.CloseWithError(err)
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		logger.Info(scanner.Text(), "init_container", name)
+	}
+}
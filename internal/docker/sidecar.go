@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// sidecarStartTimeout is how long a sidecar has to start and report healthy before the deployment is aborted.
+const sidecarStartTimeout = 2 * time.Minute
+
+// SidecarHostname returns the network alias the app uses to reach a sidecar.
+func SidecarHostname(appName, sidecarName string) string {
+	return fmt.Sprintf("%s-%s", appName, sidecarName)
+}
+
+// RunSidecars starts the sidecars of a deployment and waits until they are running and healthy.
+// If any sidecar fails, the sidecars already started for the deployment are removed.
+func RunSidecars(ctx context.Context, cli *client.Client, logger *slog.Logger, deploymentID string, targetConfig config.TargetConfig) error {
+	for _, sidecar := range targetConfig.Sidecars {
+		if err := runSidecar(ctx, cli, logger, deploymentID, targetConfig, sidecar); err != nil {
+			RemoveDeploymentSidecars(ctx, cli, logger, targetConfig.Name, deploymentID)
+			return fmt.Errorf("sidecar '%s' failed: %w", sidecar.Name, err)
+		}
+		logger.Info("Sidecar started successfully", "sidecar", sidecar.Name, "hostname", SidecarHostname(targetConfig.Name, sidecar.Name))
+	}
+	return nil
+}
+
+func runSidecar(ctx context.Context, cli *client.Client, logger *slog.Logger, deploymentID string, targetConfig config.TargetConfig, sidecar config.Sidecar) error {
+	if err := EnsureImageUpToDate(ctx, cli, logger, *sidecar.Image); err != nil {
+		return err
+	}
+
+	labels := map[string]string{
+		config.LabelAppName:      targetConfig.Name,
+		config.LabelDeploymentID: deploymentID,
+		config.LabelRole:         config.SidecarLabelRole,
+		config.LabelSidecarName:  sidecar.Name,
+	}
+
+	var envVars []string
+	for _, envVar := range sidecar.Env {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", envVar.Name, envVar.Value))
+	}
+
+	networkName := constants.DockerNetwork
+	if targetConfig.Network != "" {
+		networkName = targetConfig.Network
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode:   container.NetworkMode(networkName),
+		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+		Binds:         sidecar.Volumes,
+		LogConfig:     logConfig(targetConfig),
+		DNS:           targetConfig.DNS,
+		DNSSearch:     targetConfig.DNSSearch,
+		ExtraHosts:    targetConfig.ExtraHosts,
+	}
+
+	// Aliases are only supported on user-defined networks, so the stable hostname is only added on the haloy network.
+	var networkingConfig *network.NetworkingConfig
+	if targetConfig.Network == "" {
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				networkName: {Aliases: []string{SidecarHostname(targetConfig.Name, sidecar.Name)}},
+			},
+		}
+	}
+
+	containerConfig := &container.Config{
+		Image:  sidecar.Image.ImageRef(),
+		Labels: labels,
+		Env:    envVars,
+		Cmd:    sidecar.Command,
+	}
+	containerName := fmt.Sprintf("%s-haloy-%s-%s", targetConfig.Name, deploymentID, sidecar.Name)
+
+	createResponse, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+
+	for _, networkName := range targetConfig.Networks {
+		if err := cli.NetworkConnect(ctx, networkName, createResponse.ID, nil); err != nil {
+			return fmt.Errorf("failed to connect container to network %s: %w", networkName, err)
+		}
+	}
+
+	if err := cli.ContainerStart(ctx, createResponse.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	return waitForSidecar(ctx, cli, createResponse.ID)
+}
+
+// waitForSidecar waits until the sidecar is running. If the image defines a Docker HEALTHCHECK
+// it also waits for the container to become healthy.
+func waitForSidecar(ctx context.Context, cli *client.Client, containerID string) error {
+	ctx, cancel := context.WithTimeout(ctx, sidecarStartTimeout)
+	defer cancel()
+
+	for {
+		containerInfo, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container %s: %w", helpers.SafeIDPrefix(containerID), err)
+		}
+
+		if state := containerInfo.State; state != nil {
+			switch {
+			case state.Restarting || state.Status == "exited" || state.Status == "dead":
+				return fmt.Errorf("container %s stopped unexpectedly (status: %s, exit code: %d)", helpers.SafeIDPrefix(containerID), state.Status, state.ExitCode)
+			case state.Running && (state.Health == nil || state.Health.Status == "healthy"):
+				return nil
+			case state.Running && state.Health.Status == "unhealthy":
+				return fmt.Errorf("container %s is unhealthy according to Docker healthcheck", helpers.SafeIDPrefix(containerID))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for container %s to become healthy", helpers.SafeIDPrefix(containerID))
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// GetSidecarContainers returns all sidecar containers for an app, including stopped ones.
+func GetSidecarContainers(ctx context.Context, cli *client.Client, appName string) ([]container.Summary, error) {
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelRole, config.SidecarLabelRole))
+	filterArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelAppName, appName))
+	containerList, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filterArgs,
+		All:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sidecar containers for app %s: %w", appName, err)
+	}
+	return containerList, nil
+}
+
+// StopSidecars stops the sidecars of an app, ignoring those belonging to a specific deployment.
+func StopSidecars(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, ignoreDeploymentID string) (stoppedIDs []string, err error) {
+	containerList, err := GetSidecarContainers(ctx, cli, appName)
+	if err != nil {
+		return stoppedIDs, err
+	}
+
+	var containersToStop []container.Summary
+	for _, containerInfo := range containerList {
+		if containerInfo.Labels[config.LabelDeploymentID] != ignoreDeploymentID && containerInfo.State == "running" {
+			containersToStop = append(containersToStop, containerInfo)
+		}
+	}
+
+	if len(containersToStop) == 0 {
+		return stoppedIDs, nil
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	return stopContainersSequential(stopCtx, cli, logger, containersToStop)
+}
+
+// StartSidecars starts the stopped sidecars of a deployment of an app.
+func StartSidecars(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, deploymentID string) (startedIDs []string, err error) {
+	containerList, err := GetSidecarContainers(ctx, cli, appName)
+	if err != nil {
+		return startedIDs, err
+	}
+
+	for _, containerInfo := range containerList {
+		if containerInfo.Labels[config.LabelDeploymentID] != deploymentID || containerInfo.State == "running" {
+			continue
+		}
+		if err := cli.ContainerStart(ctx, containerInfo.ID, container.StartOptions{}); err != nil {
+			return startedIDs, fmt.Errorf("failed to start sidecar %s: %w", helpers.SafeIDPrefix(containerInfo.ID), err)
+		}
+		logger.Debug("Started sidecar", "app", appName, "container_id", helpers.SafeIDPrefix(containerInfo.ID))
+		startedIDs = append(startedIDs, containerInfo.ID)
+	}
+	return startedIDs, nil
+}
+
+// RemoveSidecars removes the sidecars of an app, ignoring those belonging to a specific deployment.
+func RemoveSidecars(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, ignoreDeploymentID string) (removedIDs []string, err error) {
+	containerList, err := GetSidecarContainers(ctx, cli, appName)
+	if err != nil {
+		return removedIDs, err
+	}
+
+	for _, containerInfo := range containerList {
+		if containerInfo.Labels[config.LabelDeploymentID] == ignoreDeploymentID {
+			continue
+		}
+
+		if err := cli.ContainerRemove(ctx, containerInfo.ID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Error("Error removing sidecar container", "container_id", helpers.SafeIDPrefix(containerInfo.ID), "error", err)
+		} else {
+			removedIDs = append(removedIDs, containerInfo.ID)
+		}
+	}
+
+	return removedIDs, nil
+}
+
+// RemoveDeploymentSidecars removes the sidecars started for a single deployment. Used to clean up after a failed deployment.
+func RemoveDeploymentSidecars(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, deploymentID string) {
+	containerList, err := GetSidecarContainers(ctx, cli, appName)
+	if err != nil {
+		logger.Warn("Failed to list sidecars for cleanup", "error", err)
+		return
+	}
+
+	for _, containerInfo := range containerList {
+		if containerInfo.Labels[config.LabelDeploymentID] != deploymentID {
+			continue
+		}
+		if err := cli.ContainerRemove(ctx, containerInfo.ID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Warn("Failed to remove sidecar container", "container_id", helpers.SafeIDPrefix(containerInfo.ID), "error", err)
+		}
+	}
+}
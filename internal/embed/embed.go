@@ -7,3 +7,6 @@ var DataFS embed.FS
 
 //go:embed templates/*
 var TemplatesFS embed.FS
+
+//go:embed dashboard/*
+var DashboardFS embed.FS
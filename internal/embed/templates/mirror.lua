@@ -0,0 +1,47 @@
+-- Mirrors requests of apps with shadow_to. Generated by haloy, do not edit.
+--
+-- Usage in a backend with option http-buffer-request:
+--   http-request lua.haloy_mirror <app> <port>
+--
+-- The request is copied and sent in a background task to the shadow frontend on the given port,
+-- which routes it to the backend of <app> by the X-Haloy-Shadow header. Responses are discarded.
+
+local methods = { GET = "get", HEAD = "head", POST = "post", PUT = "put", DELETE = "delete" }
+
+-- Hop-by-hop headers and headers the HTTP client sets itself.
+local skipped_headers = {
+    ["connection"] = true,
+    ["content-length"] = true,
+    ["transfer-encoding"] = true,
+    ["x-haloy-shadow"] = true,
+}
+
+core.register_action("haloy_mirror", { "http-req" }, function(txn, app, port)
+    local method = methods[txn.sf:method()]
+    if method == nil then
+        return
+    end
+
+    local headers = {}
+    for name, values in pairs(txn.http:req_get_headers()) do
+        if not skipped_headers[name] then
+            headers[name] = {}
+            for _, value in pairs(values) do
+                table.insert(headers[name], value)
+            end
+        end
+    end
+    headers["x-haloy-shadow"] = { app }
+
+    local request = {
+        url = "http://127.0.0.1:" .. port .. txn.sf:pathq(),
+        headers = headers,
+        body = txn.sf:req_body(),
+        timeout = 10000,
+    }
+
+    core.register_task(function()
+        local client = core.httpclient()
+        client[method](client, request)
+    end)
+end, 2)
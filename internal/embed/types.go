@@ -5,7 +5,14 @@ type HAProxyTemplateData struct {
 	HTTPFrontend            string
 	HTTPSFrontend           string
 	HTTPSFrontendUseBackend string
+	Frontends               string // Additional frontends from the haloyd config
 	Backends                string
+	HTTPPort                int
+	HTTPSPort               int
+	StatsSocket             string // Path of the read-only stats socket in the HAProxy container
+	MirrorScript            string // Path of the Lua script that mirrors requests, empty when no app uses shadow_to
+	AdminSocket             string // Path of the admin socket in the HAProxy container, empty with ACL routing
+	AdminSocketUID          int    // Owner of the stats and admin sockets, the user haloyd runs as
 }
 
 type ConfigFileWithTestAppTemplateData struct {
@@ -0,0 +1,166 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+// Type identifies the kind of server activity an event describes. Types are dot separated so
+// subscribers can filter on a prefix, e.g. "deployment" matches all deployment events.
+type Type string
+
+const (
+	TypeDeploymentStarted  Type = "deployment.started"
+	TypeDeploymentFinished Type = "deployment.finished"
+	TypeDeploymentFailed   Type = "deployment.failed"
+	TypeDeploymentPending  Type = "deployment.pending"
+	TypeDeploymentApproved Type = "deployment.approved"
+	TypeDeploymentRejected Type = "deployment.rejected"
+	TypeDeploymentQueued   Type = "deployment.queued"
+	TypeDeploymentRollback Type = "deployment.rollback"
+	TypeHAProxyReloaded    Type = "haproxy.reloaded"
+	TypeHAProxyMapsUpdated Type = "haproxy.maps_updated"
+	TypeProxyReloaded      Type = "proxy.reloaded"
+	TypeCertRenewed        Type = "cert.renewed"
+	TypeCertExpiring       Type = "cert.expiring"
+	TypeContainerUnhealthy Type = "container.unhealthy"
+	TypeGCRun              Type = "gc.run"
+	TypeReconcileFixed     Type = "reconcile.fixed"
+	TypeAppScaled          Type = "app.scaled"
+	TypeImageUpdated       Type = "image.updated"
+	TypeConfigReloaded     Type = "config.reloaded"
+	TypeConfigRejected     Type = "config.rejected"
+	TypeDockerDisconnected Type = "docker.disconnected"
+	TypeDockerReconnected  Type = "docker.reconnected"
+	TypeLBRegistered       Type = "lb.registered"
+	TypeLBDeregistered     Type = "lb.deregistered"
+	TypeLBFailed           Type = "lb.failed"
+	TypeAPILockout         Type = "api.lockout"
+	TypeActionPending      Type = "action.pending"
+	TypeActionConfirmed    Type = "action.confirmed"
+)
+
+// Event is a machine readable notification about server activity.
+type Event struct {
+	Type         Type      `json:"type"`
+	Timestamp    time.Time `json:"timestamp"`
+	AppName      string    `json:"appName,omitempty"`
+	DeploymentID string    `json:"deploymentID,omitempty"`
+	// CorrelationID is the correlation ID of the request that started the deployment, when known.
+	CorrelationID string         `json:"correlationID,omitempty"`
+	Data          map[string]any `json:"data,omitempty"`
+}
+
+// Filter selects the events a subscriber receives. Empty fields match everything.
+type Filter struct {
+	Types   []string
+	AppName string
+}
+
+// Match reports whether the event passes the filter.
+func (f Filter) Match(event Event) bool {
+	if f.AppName != "" && event.AppName != f.AppName {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if string(event.Type) == t || strings.HasPrefix(string(event.Type), t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Broker fans out events to subscribers. A nil Broker is valid and drops all events.
+type Broker struct {
+	subscribers map[int]chan Event
+	nextID      int
+	mutex       sync.Mutex
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[int]chan Event),
+	}
+}
+
+// Publish sends the event to all subscribers without blocking. Subscribers that can't keep up are disconnected.
+func (b *Broker) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.CorrelationID == "" && event.DeploymentID != "" {
+		event.CorrelationID = logging.CorrelationID(event.DeploymentID)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			close(ch)
+			delete(b.subscribers, id)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving all future events and an ID used to unsubscribe.
+func (b *Broker) Subscribe() (<-chan Event, int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Event, 100)
+	b.subscribers[id] = ch
+	return ch, id
+}
+
+func (b *Broker) Unsubscribe(id int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if ch, exists := b.subscribers[id]; exists {
+		close(ch)
+		delete(b.subscribers, id)
+	}
+}
+
+// Consume passes the events of the broker to handle until the context is canceled. The broker drops subscribers
+// that fall behind, Consume subscribes again and calls fellBehind, as the events in between are lost.
+func (b *Broker) Consume(ctx context.Context, handle func(Event), fellBehind func()) {
+	for {
+		eventChan, subscriberID := b.Subscribe()
+		if !consume(ctx, eventChan, handle) {
+			b.Unsubscribe(subscriberID)
+			return
+		}
+		fellBehind()
+	}
+}
+
+// consume handles events until the channel is closed, which it reports with true, or the context is canceled.
+func consume(ctx context.Context, eventChan <-chan Event, handle func(Event)) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-eventChan:
+			if !ok {
+				return true
+			}
+			handle(event)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func ABCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ab",
+		Short: "Route a share of the requests of an application to a variant",
+		Long: `Start and stop A/B tests. A variant deployment of the application runs another image tag next to the
+current deployment, and requests to its domains that match a header, a cookie or a percentage are routed to it.`,
+	}
+
+	cmd.AddCommand(ABStartCmd(configPath, flags))
+	cmd.AddCommand(ABStopCmd(configPath, flags))
+
+	return cmd
+}
+
+func ABStartCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var tagFlag string
+	var headerFlag string
+	var cookieFlag string
+	var percentageFlag int
+
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start a variant deployment and route matching requests to it",
+		Long: `Start a variant deployment of the application with the image tag of --tag, and route the requests to
+its domains that match --header, --cookie or --percentage to it. A request matching any of them goes to
+the variant. --percentage picks requests at random, so use a cookie to keep users on one variant.
+
+The variant runs the config of the current deployment with the other tag and uses its sidecars. It keeps
+running when the application is deployed again. Starting a test for an app that already has one replaces it.`,
+		Example: "  haloy ab start --tag beta --header X-Beta=1\n  haloy ab start --tag 1.5.0 --cookie beta=1 --percentage 5",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			ctx := cmd.Context()
+
+			req := apitypes.ABTestRequest{Tag: tagFlag, Percentage: percentageFlag}
+			var err error
+			if headerFlag != "" {
+				if req.HeaderName, req.HeaderValue, err = parseABMatch("--header", headerFlag); err != nil {
+					ui.Error("%v", err)
+					return
+				}
+			}
+			if cookieFlag != "" {
+				if req.CookieName, req.CookieValue, err = parseABMatch("--cookie", cookieFlag); err != nil {
+					ui.Error("%v", err)
+					return
+				}
+			}
+			if req.Tag == "" {
+				ui.Error("--tag is required")
+				return
+			}
+			if req.HeaderName == "" && req.CookieName == "" && req.Percentage == 0 {
+				ui.Error("At least one of --header, --cookie or --percentage is required")
+				return
+			}
+
+			apps, err := configApps(ctx, *configPath, flags)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			runBulk(ctx, apps, defaultBulkParallelism, func(ctx context.Context, api *apiclient.APIClient, app selectedApp) (string, error) {
+				var response apitypes.ABTestResponse
+				if err := api.Post(ctx, fmt.Sprintf("ab/start/%s", app.name), req, &response); err != nil {
+					return "", err
+				}
+				return response.Message, nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Start the test on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Start the test on all targets")
+	cmd.Flags().StringVar(&tagFlag, "tag", "", "Image tag the variant deployment runs")
+	cmd.Flags().StringVar(&headerFlag, "header", "", "Route requests with this header to the variant, e.g. X-Beta=1")
+	cmd.Flags().StringVar(&cookieFlag, "cookie", "", "Route requests with this cookie to the variant, e.g. beta=1")
+	cmd.Flags().IntVar(&percentageFlag, "percentage", 0, "Route this percentage of the other requests to the variant")
+
+	return cmd
+}
+
+func ABStopCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "stop",
+		Short:   "Stop an A/B test, route all requests to the application and remove the variant",
+		Example: "  haloy ab stop\n  haloy ab stop --targets production",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			ctx := cmd.Context()
+
+			apps, err := configApps(ctx, *configPath, flags)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			runBulk(ctx, apps, defaultBulkParallelism, func(ctx context.Context, api *apiclient.APIClient, app selectedApp) (string, error) {
+				var response apitypes.ABTestResponse
+				if err := api.Post(ctx, fmt.Sprintf("ab/stop/%s", app.name), nil, &response); err != nil {
+					return "", err
+				}
+				return response.Message, nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Stop the test on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Stop the test on all targets")
+
+	return cmd
+}
+
+// parseABMatch parses a name=value flag.
+func parseABMatch(flag, value string) (string, string, error) {
+	name, matchValue, ok := strings.Cut(value, "=")
+	if !ok || name == "" || matchValue == "" {
+		return "", "", fmt.Errorf("%s must be name=value, got '%s'", flag, value)
+	}
+	return name, matchValue, nil
+}
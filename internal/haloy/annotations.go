@@ -0,0 +1,76 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Annotations captured from the git repository of the config at deploy time.
+const (
+	AnnotationGitCommit = "git.commit"
+	AnnotationGitBranch = "git.branch"
+	AnnotationGitDirty  = "git.dirty"
+)
+
+// deployAnnotations returns the git metadata of the repository in dir combined with the key=value
+// annotations from the command line, which take precedence.
+func deployAnnotations(ctx context.Context, dir string, flags []string) (map[string]string, error) {
+	annotations := gitAnnotations(ctx, dir)
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid annotation '%s', expected key=value", flag)
+		}
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
+// gitAnnotations returns the commit, branch and dirty state of the git repository in dir,
+// or nil when dir isn't in a git repository or git isn't installed.
+func gitAnnotations(ctx context.Context, dir string) map[string]string {
+	commit, err := gitOutput(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil
+	}
+
+	annotations := map[string]string{AnnotationGitCommit: commit}
+	// A detached HEAD has no branch.
+	if branch, err := gitOutput(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		annotations[AnnotationGitBranch] = branch
+	}
+	if status, err := gitOutput(ctx, dir, "status", "--porcelain"); err == nil {
+		annotations[AnnotationGitDirty] = strconv.FormatBool(status != "")
+	}
+	return annotations
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// formatAnnotations formats annotations as sorted key=value pairs, shortening the git commit.
+func formatAnnotations(annotations map[string]string) string {
+	pairs := make([]string, 0, len(annotations))
+	for _, key := range slices.Sorted(maps.Keys(annotations)) {
+		value := annotations[key]
+		if key == AnnotationGitCommit && len(value) > 12 {
+			value = value[:12]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,393 @@
+package haloy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/cmdexec"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// Actions of apply for an app.
+const (
+	applyCreate    = "create"
+	applyUpdate    = "update"
+	applyUnchanged = "unchanged"
+	applyDelete    = "delete"
+)
+
+// applyFile is a config file given to apply with its selected targets.
+type applyFile struct {
+	path            string
+	rawAppConfig    config.AppConfig
+	rawTargets      map[string]config.TargetConfig
+	resolvedTargets map[string]config.TargetConfig
+}
+
+// applyChange is what apply does with an app on a server.
+type applyChange struct {
+	action string
+	app    string
+	server string
+	// file and targetName are the definition of the app, empty for apps that are deleted.
+	file       *applyFile
+	targetName string
+	// changes are the differences to the live deployment of an updated app, see configChanges.
+	changes []string
+	// targetConfig is used to get the API token of the server.
+	targetConfig *config.TargetConfig
+}
+
+func ApplyCmd() *cobra.Command {
+	var filenameFlags []string
+	var recursiveFlag bool
+	var pruneFlag bool
+	var dryRunFlag bool
+	var selectorFlag string
+	var noLogsFlag bool
+	var ignoreFreezeFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "apply -f <file|dir>",
+		Short: "Make the apps on the servers match the app configs in files",
+		Long: `Compare the app configs in the files with the apps on their servers and deploy the ones that are
+new or changed. Apps that match their config are left alone, so apply can run on every commit, e.g. from CI.
+
+A directory applies every config file in it, add --recursive to include its subdirectories. All targets of
+the configs are applied. With --prune, apps on the same servers that have no config are deleted, limit them
+with --selector. Use --dry-run to see what apply would do.`,
+		Example: "  haloy apply -f haloy/apps\n  haloy apply -f haloy/ --recursive --prune --selector env=production\n  haloy apply -f shop.yaml --dry-run",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			selector, err := newAppSelector("", selectorFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			var paths []string
+			for _, filename := range filenameFlags {
+				files, err := appconfigloader.FindConfigFiles(filename, recursiveFlag)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				for _, file := range files {
+					if !slices.Contains(paths, file) {
+						paths = append(paths, file)
+					}
+				}
+			}
+
+			files := make([]*applyFile, 0, len(paths))
+			for _, path := range paths {
+				file, err := loadApplyFile(ctx, path, selector)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				files = append(files, file)
+			}
+
+			changes, err := planApply(ctx, files, selector, pruneFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if len(changes) == 0 {
+				ui.Warn("No apps match the selector")
+				return
+			}
+			printApplyPlan(changes, dryRunFlag)
+			if dryRunFlag {
+				return
+			}
+
+			if !slices.ContainsFunc(changes, func(change applyChange) bool { return change.action != applyUnchanged }) {
+				ui.Success("All apps match their config")
+				return
+			}
+
+			for _, file := range files {
+				var targetNames []string
+				for _, change := range changes {
+					if change.file == file && (change.action == applyCreate || change.action == applyUpdate) {
+						targetNames = append(targetNames, change.targetName)
+					}
+				}
+				if len(targetNames) > 0 && !applyFileChanges(ctx, file, targetNames, noLogsFlag, ignoreFreezeFlag) {
+					return
+				}
+			}
+
+			for _, change := range changes {
+				if change.action == applyDelete {
+					stopApp(ctx, change.targetConfig, change.server, change.app, true)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&filenameFlags, "filename", "f", nil, "Config file or directory to apply (repeatable)")
+	cmd.Flags().BoolVarP(&recursiveFlag, "recursive", "R", false, "Apply the config files in subdirectories too")
+	cmd.Flags().BoolVar(&pruneFlag, "prune", false, "Delete apps on the servers that have no config")
+	cmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Show what would change without changing anything")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only apply and prune apps with labels, e.g. env=production,team=payments")
+	cmd.Flags().BoolVar(&noLogsFlag, "no-logs", false, "Don't stream deployment logs")
+	cmd.Flags().BoolVar(&ignoreFreezeFlag, "ignore-freeze", false, "Deploy during a freeze window of the server")
+	cmd.MarkFlagRequired("filename")
+
+	return cmd
+}
+
+// loadApplyFile loads all targets of a config file that the selector matches, with their secrets resolved.
+func loadApplyFile(ctx context.Context, path string, selector appSelector) (*applyFile, error) {
+	rawAppConfig, _, err := appconfigloader.LoadRawAppConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	rawAppConfig, err = appconfigloader.Load(ctx, path, nil, len(rawAppConfig.Targets) > 0)
+	if err != nil {
+		return nil, err
+	}
+	rawTargets, err := appconfigloader.ExtractTargets(rawAppConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, targetConfig := range rawTargets {
+		if !selector.matches(targetConfig.Name, targetConfig.Labels) {
+			delete(rawTargets, name)
+		}
+	}
+
+	file := &applyFile{path: path, rawAppConfig: rawAppConfig, rawTargets: rawTargets}
+	if len(rawTargets) == 0 {
+		return file, nil
+	}
+
+	resolvedAppConfig, err := appconfigloader.ResolveSecrets(ctx, rawAppConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	resolvedTargets, err := appconfigloader.ExtractTargets(resolvedAppConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name := range resolvedTargets {
+		if _, selected := rawTargets[name]; !selected {
+			delete(resolvedTargets, name)
+		}
+	}
+	file.resolvedTargets = resolvedTargets
+	return file, nil
+}
+
+// planApply compares the targets of the files with the apps on their servers. With prune, the apps on those
+// servers that the selector matches and that aren't in the files are deleted.
+func planApply(ctx context.Context, files []*applyFile, selector appSelector, prune bool) ([]applyChange, error) {
+	type definition struct {
+		file       *applyFile
+		targetName string
+	}
+	definitions := make(map[string]map[string]definition)
+	for _, file := range files {
+		for _, targetName := range slices.Sorted(maps.Keys(file.resolvedTargets)) {
+			target := file.resolvedTargets[targetName]
+			if definitions[target.Server] == nil {
+				definitions[target.Server] = make(map[string]definition)
+			}
+			if existing, exists := definitions[target.Server][target.Name]; exists {
+				return nil, fmt.Errorf("app '%s' on %s is defined in both %s and %s", target.Name, target.Server, existing.file.path, file.path)
+			}
+			definitions[target.Server][target.Name] = definition{file: file, targetName: targetName}
+		}
+	}
+
+	var changes []applyChange
+	for _, server := range slices.Sorted(maps.Keys(definitions)) {
+		apps := definitions[server]
+		// Any target of the server can be used for the token, they are all checked when they're deployed.
+		first := apps[slices.Sorted(maps.Keys(apps))[0]]
+		serverTarget := first.file.resolvedTargets[first.targetName]
+		api, err := bulkClient(selectedApp{server: server, targetConfig: &serverTarget})
+		if err != nil {
+			return nil, err
+		}
+
+		var response apitypes.AppsResponse
+		if err := api.Get(ctx, "apps", &response); err != nil {
+			return nil, fmt.Errorf("failed to list apps on %s: %w", server, err)
+		}
+		live := make(map[string]bool, len(response.Apps))
+		for _, app := range response.Apps {
+			live[app.Name] = true
+		}
+
+		for _, appName := range slices.Sorted(maps.Keys(apps)) {
+			definition := apps[appName]
+			target := definition.file.resolvedTargets[definition.targetName]
+			change := applyChange{
+				action:       applyCreate,
+				app:          appName,
+				server:       server,
+				file:         definition.file,
+				targetName:   definition.targetName,
+				targetConfig: &target,
+			}
+			if live[appName] {
+				change.action, change.changes, err = applyUpdateAction(ctx, api, target)
+				if err != nil {
+					return nil, err
+				}
+			}
+			changes = append(changes, change)
+		}
+
+		if !prune {
+			continue
+		}
+		for _, app := range response.Apps {
+			if _, defined := apps[app.Name]; defined || !selector.matches(app.Name, app.Labels) {
+				continue
+			}
+			changes = append(changes, applyChange{action: applyDelete, app: app.Name, server: server, targetConfig: &serverTarget})
+		}
+	}
+	return changes, nil
+}
+
+// applyUpdateAction compares a target with the live deployment of its app.
+func applyUpdateAction(ctx context.Context, api *apiclient.APIClient, target config.TargetConfig) (string, []string, error) {
+	var response apitypes.DeployedConfigResponse
+	if err := api.Get(ctx, fmt.Sprintf("config/%s", target.Name), &response); err != nil {
+		// Deployments made before haloyd stored their config can't be compared, they're deployed again.
+		var apiErr *apiclient.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return applyUpdate, []string{"The live deployment has no stored config"}, nil
+		}
+		return "", nil, fmt.Errorf("failed to get the deployed config of %s: %w", target.Name, err)
+	}
+
+	local, err := target.Redacted()
+	if err != nil {
+		return "", nil, err
+	}
+	changes, err := configChanges(response.TargetConfig, local)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to compare the config of %s: %w", target.Name, err)
+	}
+	if len(changes) == 0 {
+		return applyUnchanged, nil, nil
+	}
+	return applyUpdate, changes, nil
+}
+
+func printApplyPlan(changes []applyChange, showChanges bool) {
+	rows := make([][]string, 0, len(changes))
+	for _, change := range changes {
+		source := ""
+		if change.file != nil {
+			source = change.file.path
+			if relative, err := filepath.Rel(".", change.file.path); err == nil {
+				source = relative
+			}
+		}
+		rows = append(rows, []string{change.app, change.server, change.action, source})
+	}
+	ui.Table([]string{"APP", "SERVER", "ACTION", "CONFIG"}, rows)
+
+	if !showChanges {
+		return
+	}
+	for _, change := range changes {
+		if change.action == applyUpdate {
+			ui.Section(fmt.Sprintf("Changes to %s on %s", change.app, change.server), change.changes)
+		}
+	}
+}
+
+// applyFileChanges deploys the targets of a file like 'haloy deploy' does, with the global hooks of the file
+// around them. It returns false when a global hook failed.
+func applyFileChanges(ctx context.Context, file *applyFile, targetNames []string, noLogs, ignoreFreeze bool) bool {
+	workDir := getHooksWorkDir(file.path)
+	format := file.rawAppConfig.Format
+
+	rawTargets := make(map[string]config.TargetConfig, len(targetNames))
+	resolvedTargets := make(map[string]config.TargetConfig, len(targetNames))
+	annotations, err := deployAnnotations(ctx, workDir, nil)
+	if err != nil {
+		ui.Error("%v", err)
+		return false
+	}
+	for _, targetName := range targetNames {
+		rawTarget, resolvedTarget := file.rawTargets[targetName], file.resolvedTargets[targetName]
+		if len(annotations) > 0 {
+			rawTarget.Annotations = annotations
+			resolvedTarget.Annotations = annotations
+		}
+		rawTargets[targetName], resolvedTargets[targetName] = rawTarget, resolvedTarget
+	}
+
+	progress := ui.NewStepProgress("", false)
+	if err := buildAndPublishImages(ctx, resolvedTargets, file.path, progress); err != nil {
+		progress.Finish(err)
+		ui.Error("%v", err)
+		return false
+	}
+	progress.Finish(nil)
+
+	for _, hookCmd := range file.rawAppConfig.GlobalPreDeploy {
+		if err := cmdexec.RunCommand(ctx, hookCmd, workDir); err != nil {
+			ui.Error("%s hook failed: %v", config.GetFieldNameForFormat(config.AppConfig{}, "GlobalPreDeploy", format), err)
+			return false
+		}
+	}
+
+	targetTimings := make(map[string][]ui.StepTiming)
+	for _, targetName := range targetNames {
+		rollbackAppConfig := config.AppConfig{
+			TargetConfig:    rawTargets[targetName],
+			SecretProviders: file.rawAppConfig.SecretProviders,
+		}
+		prefix := ""
+		if len(targetNames) > 1 {
+			prefix = lipgloss.NewStyle().Bold(true).Foreground(ui.White).Render(fmt.Sprintf("%s ", targetName))
+		}
+		targetTimings[targetName] = deployTarget(
+			ctx,
+			resolvedTargets[targetName],
+			rollbackAppConfig,
+			file.path,
+			prefix,
+			noLogs,
+			false,
+			ignoreFreeze,
+			len(targetNames) == 1 && ui.IsInteractive(),
+			nil,
+		)
+	}
+	if !noLogs {
+		ui.PrintStepTimings(progress.Timings(), targetTimings)
+	}
+
+	for _, hookCmd := range file.rawAppConfig.GlobalPostDeploy {
+		if err := cmdexec.RunCommand(ctx, hookCmd, workDir); err != nil {
+			ui.Error("%s hook failed: %v", config.GetFieldNameForFormat(config.AppConfig{}, "GlobalPostDeploy", format), err)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package haloy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func ApproveCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var rejectFlag bool
+	var ignoreFreezeFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "approve [deployment-id]",
+		Short: "Approve a pending deployment",
+		Long: fmt.Sprintf(`Approve a deployment of a target with require_approval, which starts it on the server.
+Without a deployment ID the pending deployments are listed.
+
+The token in %s is used when it's set, otherwise the API token of the server.`, constants.EnvVarApproveToken),
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			servers := make(map[string]*config.TargetConfig)
+			if serverFlag != "" {
+				servers[serverFlag] = nil
+			} else {
+				rawAppConfig, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				targets, err := appconfigloader.ExtractTargets(rawAppConfig)
+				if err != nil {
+					ui.Error("Unable to create deploy targets: %v", err)
+					return
+				}
+				for server, targetNames := range appconfigloader.TargetsByServer(targets) {
+					target := targets[targetNames[0]]
+					servers[server] = &target
+				}
+			}
+
+			for _, server := range slices.Sorted(maps.Keys(servers)) {
+				api, err := approveClient(servers[server], server)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+
+				if len(args) == 0 {
+					listPendingDeployments(ctx, api, server)
+					continue
+				}
+
+				deploymentID := args[0]
+				action := "approve"
+				if rejectFlag {
+					action = "reject"
+				}
+				path := fmt.Sprintf("deploy/%s/%s", deploymentID, action)
+				if ignoreFreezeFlag && !rejectFlag {
+					path += "?ignore-freeze=true"
+				}
+				var response apitypes.DeployResponse
+				err = api.Post(ctx, path, nil, &response)
+				if err != nil {
+					// The deployment may be pending on another server of the config.
+					var apiErr *apiclient.APIError
+					if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && len(servers) > 1 {
+						continue
+					}
+					ui.Error("Failed to %s deployment %s: %v", action, deploymentID, err)
+					if hint := errorHint(err); hint != "" {
+						ui.Info("%s", hint)
+					}
+					return
+				}
+				switch {
+				case rejectFlag:
+					ui.Success("Rejected deployment %s on %s", deploymentID, server)
+				case response.QueuedUntil != nil:
+					ui.Success("Approved deployment %s on %s, it starts after the freeze window ends at %s",
+						deploymentID, server, helpers.FormatTime(*response.QueuedUntil))
+				default:
+					ui.Success("Approved deployment %s on %s, follow it with 'haloy logs'", deploymentID, server)
+				}
+				return
+			}
+
+			if len(args) == 1 {
+				ui.Error("No pending deployment with ID %s", args[0])
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Use the servers of specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Use the servers of all targets")
+	cmd.Flags().BoolVar(&rejectFlag, "reject", false, "Reject the deployment instead of approving it")
+	cmd.Flags().BoolVar(&ignoreFreezeFlag, "ignore-freeze", false, "Start the deployment during a freeze window of the server")
+
+	return cmd
+}
+
+// approveClient creates an API client using the approve token when it's set.
+func approveClient(targetConfig *config.TargetConfig, server string) (*apiclient.APIClient, error) {
+	token := os.Getenv(constants.EnvVarApproveToken)
+	if token == "" {
+		var err error
+		if token, err = getToken(targetConfig, server); err != nil {
+			return nil, err
+		}
+	}
+	api, err := apiclient.New(server, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API client: %w", err)
+	}
+	return api, nil
+}
+
+func listPendingDeployments(ctx context.Context, api *apiclient.APIClient, server string) {
+	var response apitypes.PendingDeploymentsResponse
+	if err := api.Get(ctx, "deploy/pending", &response); err != nil {
+		ui.Error("Failed to get pending deployments from %s: %v", server, err)
+		return
+	}
+	if len(response.Deployments) == 0 {
+		ui.Info("No pending deployments on %s", server)
+		return
+	}
+
+	rows := make([][]string, 0, len(response.Deployments))
+	for _, deployment := range response.Deployments {
+		rows = append(rows, []string{
+			deployment.DeploymentID,
+			deployment.AppName,
+			deployment.Image,
+			helpers.FormatTime(deployment.RequestedAt),
+		})
+	}
+	ui.Info("Pending deployments on %s", server)
+	ui.Table([]string{"DEPLOYMENT ID", "APP", "IMAGE", "REQUESTED"}, rows)
+}
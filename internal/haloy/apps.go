@@ -0,0 +1,78 @@
+package haloy
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func AppsCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var selectorFlag string
+
+	cmd := &cobra.Command{
+		Use:   "apps [app-pattern]",
+		Short: "List the apps on the servers",
+		Long: `List the apps on the servers of the targets in the config, or on the server given with --server,
+with their state and labels. Filter them with a glob pattern for the name or a label selector.`,
+		Example: "  haloy apps\n  haloy apps --selector team=payments\n  haloy apps 'team-a-*' --server haloy.example.com",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			selector, err := newAppSelector(pattern, selectorFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			apps, err := selectApps(ctx, *configPath, flags, serverFlag, selector)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if len(apps) == 0 {
+				ui.Info("No apps found")
+				return
+			}
+
+			rows := make([][]string, 0, len(apps))
+			for _, app := range apps {
+				rows = append(rows, []string{
+					app.name,
+					app.server,
+					displayState(app.summary.State),
+					strconv.Itoa(app.summary.Replicas),
+					app.summary.DeploymentID,
+					formatLabels(app.summary.Labels),
+				})
+			}
+			ui.Table([]string{"APP", "SERVER", "STATE", "REPLICAS", "DEPLOYMENT ID", "LABELS"}, rows)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "List apps on the servers of specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "List apps on the servers of all targets")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only list apps with labels, e.g. team=payments,env=production")
+
+	return cmd
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+	return strings.Join(pairs, ",")
+}
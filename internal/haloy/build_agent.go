@@ -0,0 +1,158 @@
+package haloy
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func BuildAgentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "build-agent",
+		Short: "Manage remote build agents",
+		Long: `Add, remove, and list remote Docker hosts that build images for servers with another architecture.
+
+When the local Docker daemon has another architecture than the server, e.g. an arm64 laptop deploying
+to an amd64 server, haloy deploy builds the image on an agent with the server's architecture instead
+of emulating it.`,
+	}
+
+	cmd.AddCommand(BuildAgentAddCmd())
+	cmd.AddCommand(BuildAgentDeleteCmd())
+	cmd.AddCommand(BuildAgentListCmd())
+
+	return cmd
+}
+
+func BuildAgentAddCmd() *cobra.Command {
+	var force bool
+	var arch string
+	cmd := &cobra.Command{
+		Use:   "add <name> <docker-host>",
+		Short: "Add a remote build agent",
+		Example: `  haloy build-agent add arm-builder ssh://builder@arm-builder.example.com --arch arm64
+  haloy build-agent add x86-builder tcp://10.0.0.5:2376 --arch amd64`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			name, host := args[0], args[1]
+
+			configDir, err := config.ConfigDir()
+			if err != nil {
+				ui.Error("Failed to get config dir: %v", err)
+				return
+			}
+			if err = helpers.EnsureDir(configDir); err != nil {
+				ui.Error("Failed to create config dir: %v", err)
+				return
+			}
+
+			clientConfigPath := filepath.Join(configDir, constants.ClientConfigFileName)
+			clientConfig, err := config.LoadClientConfig(clientConfigPath)
+			if err != nil {
+				ui.Error("Failed to load client config: %v", err)
+				return
+			}
+			if clientConfig == nil {
+				clientConfig = &config.ClientConfig{}
+			}
+
+			if err := clientConfig.AddBuildAgent(name, host, arch, force); err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if err := config.SaveClientConfig(clientConfig, clientConfigPath); err != nil {
+				ui.Error("Failed to save client config: %v", err)
+				return
+			}
+
+			ui.Success("Build agent %s added successfully", name)
+		},
+	}
+
+	cmd.Flags().StringVar(&arch, "arch", "", "Architecture of the agent: amd64 or arm64")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Force overwrite if the build agent already exists")
+	cmd.MarkFlagRequired("arch")
+
+	return cmd
+}
+
+func BuildAgentDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a remote build agent",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+
+			configDir, err := config.ConfigDir()
+			if err != nil {
+				ui.Error("Failed to get config dir: %v", err)
+				return
+			}
+
+			clientConfigPath := filepath.Join(configDir, constants.ClientConfigFileName)
+			clientConfig, err := config.LoadClientConfig(clientConfigPath)
+			if err != nil {
+				ui.Error("Failed to load client config: %v", err)
+				return
+			}
+			if clientConfig == nil {
+				ui.Error("No config file found in %s", clientConfigPath)
+				return
+			}
+
+			if err := clientConfig.DeleteBuildAgent(name); err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if err := config.SaveClientConfig(clientConfig, clientConfigPath); err != nil {
+				ui.Error("Failed to save client config: %v", err)
+				return
+			}
+
+			ui.Success("Build agent %s deleted successfully", name)
+		},
+	}
+	return cmd
+}
+
+func BuildAgentListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List remote build agents",
+		Run: func(cmd *cobra.Command, args []string) {
+			configDir, err := config.ConfigDir()
+			if err != nil {
+				ui.Error("Failed to get config dir: %v", err)
+				return
+			}
+
+			clientConfigPath := filepath.Join(configDir, constants.ClientConfigFileName)
+			clientConfig, err := config.LoadClientConfig(clientConfigPath)
+			if err != nil {
+				ui.Error("Failed to load client config: %v", err)
+				return
+			}
+
+			if clientConfig == nil || len(clientConfig.BuildAgents) == 0 {
+				ui.Info("No build agents found")
+				return
+			}
+
+			headers := []string{"NAME", "ARCH", "HOST"}
+			rows := make([][]string, 0, len(clientConfig.BuildAgents))
+			for _, name := range slices.Sorted(maps.Keys(clientConfig.BuildAgents)) {
+				agent := clientConfig.BuildAgents[name]
+				rows = append(rows, []string{name, agent.Arch, agent.Host})
+			}
+			ui.Table(headers, rows)
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,81 @@
+package haloy
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func ConfigCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage haloy config files",
+	}
+
+	cmd.AddCommand(ConfigMigrateCmd(configPath, flags))
+
+	return cmd
+}
+
+func ConfigMigrateCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var dryRunFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Rewrite deprecated fields in a config file",
+		Long: `Rewrite the deprecated fields of a haloy config file, and the base config it extends, to the fields that replaced them.
+
+YAML files keep their comments and field order. JSON and TOML files are written again from the parsed
+config, which keeps the values but not the formatting or TOML comments.`,
+		Example: `  haloy config migrate
+  haloy config migrate -c haloy/apps/api.yaml --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			files, err := appconfigloader.MigrateConfig(*configPath)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			migrated := 0
+			for _, file := range files {
+				if len(file.Deprecations) == 0 {
+					continue
+				}
+				migrated++
+				for _, deprecation := range file.Deprecations {
+					ui.Info("%s", deprecation)
+				}
+
+				if dryRunFlag {
+					name := filepath.Base(file.Path)
+					ui.Basic("%s", helpers.UnifiedDiff(name, name, string(file.Original), string(file.Migrated)))
+					continue
+				}
+
+				stat, err := os.Stat(file.Path)
+				if err != nil {
+					ui.Error("Failed to read %s: %v", file.Path, err)
+					return
+				}
+				if err := os.WriteFile(file.Path, file.Migrated, stat.Mode().Perm()); err != nil {
+					ui.Error("Failed to write %s: %v", file.Path, err)
+					return
+				}
+				ui.Success("Migrated %s", file.Path)
+			}
+
+			if migrated == 0 {
+				ui.Success("No deprecated fields found")
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Show the changes without writing the files")
+
+	return cmd
+}
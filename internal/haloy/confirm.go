@@ -0,0 +1,135 @@
+package haloy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func ConfirmCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+
+	cmd := &cobra.Command{
+		Use:   "confirm [action-id]",
+		Short: "Confirm a destructive operation on a protected app",
+		Long: fmt.Sprintf(`Confirm a rollback or container removal of an app protected with api.protection on the server,
+which runs it. It must be confirmed with another token than the one that requested it.
+Without an action ID the operations waiting for confirmation are listed.
+
+The token in %s is used when it's set, otherwise the API token of the server.`, constants.EnvVarApproveToken),
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			servers := make(map[string]*config.TargetConfig)
+			if serverFlag != "" {
+				servers[serverFlag] = nil
+			} else {
+				rawAppConfig, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				targets, err := appconfigloader.ExtractTargets(rawAppConfig)
+				if err != nil {
+					ui.Error("Unable to create deploy targets: %v", err)
+					return
+				}
+				for server, targetNames := range appconfigloader.TargetsByServer(targets) {
+					target := targets[targetNames[0]]
+					servers[server] = &target
+				}
+			}
+
+			for _, server := range slices.Sorted(maps.Keys(servers)) {
+				api, err := approveClient(servers[server], server)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+
+				if len(args) == 0 {
+					listPendingActions(ctx, api, server)
+					continue
+				}
+
+				actionID := args[0]
+				var response apitypes.ConfirmActionResponse
+				err = api.Post(ctx, fmt.Sprintf("actions/%s/confirm", actionID), nil, &response)
+				if err != nil {
+					// The action may be pending on another server of the config.
+					var apiErr *apiclient.APIError
+					if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && len(servers) > 1 {
+						continue
+					}
+					ui.Error("Failed to confirm action %s: %v", actionID, err)
+					if hint := errorHint(err); hint != "" {
+						ui.Info("%s", hint)
+					}
+					return
+				}
+				if response.DeploymentID != "" {
+					ui.Success("%s on %s as deployment %s, follow it with 'haloy logs'", response.Message, server, response.DeploymentID)
+				} else {
+					ui.Success("%s", response.Message)
+				}
+				return
+			}
+
+			if len(args) == 1 {
+				ui.Error("No pending action with ID %s", args[0])
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Use the servers of specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Use the servers of all targets")
+
+	return cmd
+}
+
+func listPendingActions(ctx context.Context, api *apiclient.APIClient, server string) {
+	var response apitypes.PendingActionsResponse
+	if err := api.Get(ctx, "actions", &response); err != nil {
+		ui.Error("Failed to get pending actions from %s: %v", server, err)
+		return
+	}
+	if len(response.Actions) == 0 {
+		ui.Info("No actions waiting for confirmation on %s", server)
+		return
+	}
+
+	rows := make([][]string, 0, len(response.Actions))
+	for _, action := range response.Actions {
+		rows = append(rows, []string{
+			action.ActionID,
+			action.AppName,
+			action.Description,
+			helpers.FormatTime(action.RequestedAt),
+			helpers.FormatTime(action.ExpiresAt),
+		})
+	}
+	ui.Info("Actions waiting for confirmation on %s", server)
+	ui.Table([]string{"ACTION ID", "APP", "OPERATION", "REQUESTED", "EXPIRES"}, rows)
+}
+
+// printPendingAction tells the user how to confirm an operation held by the server.
+func printPendingAction(action *apitypes.PendingAction) {
+	ui.Warn("%s is protected, the operation waits for the confirmation of a second token until %s",
+		action.AppName, helpers.FormatTime(action.ExpiresAt))
+	ui.Info("Confirm it with: haloy confirm %s", action.ActionID)
+}
@@ -0,0 +1,290 @@
+package haloy
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// copyTimeout is the maximum duration of a single copy, large heap dumps can take a while on slow connections.
+const copyTimeout = 15 * time.Minute
+
+func CopyCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var replicaFlag int
+
+	cmd := &cobra.Command{
+		Use:   "cp <app>:<path> <local path> | <local path> <app>:<path>",
+		Short: "Copy files between a running container and the local filesystem",
+		Long: `Copy files or directories between a running app container and the local filesystem.
+
+Container paths must be absolute. When copying to a container, the destination must be an
+existing directory. Transfers are limited to 512 MB and are recorded in the haloyd log.
+
+Examples:
+  # Download a heap dump from the first replica
+  haloy cp my-app:/tmp/heap.hprof ./heap.hprof
+
+  # Download a directory from the second replica
+  haloy cp my-app:/app/reports ./reports --replica 2
+
+  # Upload a file to a container
+  haloy cp ./debug.conf my-app:/tmp`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			srcApp, srcPath, srcRemote := parseCopyArg(args[0])
+			dstApp, dstPath, dstRemote := parseCopyArg(args[1])
+			if srcRemote == dstRemote {
+				ui.Error("Exactly one of source and destination must be a container path in the form <app>:<path>")
+				return
+			}
+
+			appName, containerPath := srcApp, srcPath
+			if dstRemote {
+				appName, containerPath = dstApp, dstPath
+			}
+			if !path.IsAbs(containerPath) {
+				ui.Error("Container path must be absolute, got '%s'", containerPath)
+				return
+			}
+
+			var targetConfig *config.TargetConfig
+			server := serverFlag
+			if server == "" {
+				target, err := findCopyTarget(ctx, *configPath, flags, appName)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				targetConfig = target
+				server = target.Server
+			}
+
+			token, err := getToken(targetConfig, server)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			api, err := apiclient.NewWithTimeout(server, token, copyTimeout)
+			if err != nil {
+				ui.Error("Failed to create API client: %v", err)
+				return
+			}
+
+			query := url.Values{}
+			query.Set("path", containerPath)
+			query.Set("replica", fmt.Sprintf("%d", replicaFlag))
+			apiPath := fmt.Sprintf("cp/%s?%s", appName, query.Encode())
+
+			if srcRemote {
+				if err := downloadFromContainer(ctx, api, apiPath, dstPath); err != nil {
+					ui.Error("Failed to copy from %s: %v", appName, err)
+					return
+				}
+				ui.Success("Copied %s:%s to %s", appName, containerPath, dstPath)
+			} else {
+				if err := uploadToContainer(ctx, api, apiPath, srcPath); err != nil {
+					ui.Error("Failed to copy to %s: %v", appName, err)
+					return
+				}
+				ui.Success("Copied %s to %s:%s", srcPath, appName, containerPath)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Look up the app in specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Look up the app in all targets")
+	cmd.Flags().IntVarP(&replicaFlag, "replica", "r", 1, "Replica to copy from or to")
+
+	return cmd
+}
+
+// parseCopyArg splits an argument in the form <app>:<path>. Arguments that start with a path
+// separator or a dot are always local paths, so local files containing a colon can still be copied.
+func parseCopyArg(arg string) (appName, filePath string, remote bool) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") || filepath.IsAbs(arg) {
+		return "", arg, false
+	}
+	appName, filePath, found := strings.Cut(arg, ":")
+	if !found || appName == "" {
+		return "", arg, false
+	}
+	return appName, filePath, true
+}
+
+func findCopyTarget(ctx context.Context, configPath string, flags *appCmdFlags, appName string) (*config.TargetConfig, error) {
+	rawAppConfig, err := appconfigloader.Load(ctx, configPath, flags.targets, flags.all)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := appconfigloader.ExtractTargets(rawAppConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create deploy targets: %w", err)
+	}
+
+	var matches []config.TargetConfig
+	for _, target := range targets {
+		if target.Name == appName {
+			matches = append(matches, target)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no app named '%s' found in the config", appName)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("app '%s' is deployed to %d targets, select one with --targets", appName, len(matches))
+	}
+}
+
+func downloadFromContainer(ctx context.Context, api *apiclient.APIClient, apiPath, localPath string) error {
+	body, err := api.Download(ctx, apiPath)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Like docker cp, copy into an existing directory or create the destination with the given name.
+	destDir, rename := localPath, ""
+	if info, err := os.Stat(localPath); err != nil || !info.IsDir() {
+		destDir, rename = filepath.Dir(localPath), filepath.Base(localPath)
+	}
+
+	return extractTar(body, destDir, rename)
+}
+
+// extractTar extracts the archive into destDir. If rename is set, the top level entry of the archive is renamed.
+func extractTar(r io.Reader, destDir, rename string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		name := path.Clean(header.Name)
+		if rename != "" {
+			if _, rest, found := strings.Cut(name, "/"); found {
+				name = path.Join(rename, rest)
+			} else {
+				name = rename
+			}
+		}
+
+		target := filepath.Join(destDir, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(destDir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry '%s' is outside the destination", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, header.FileInfo().Mode().Perm()|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, header.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			ui.Warn("Skipping %s, only regular files and directories are copied", header.Name)
+		}
+	}
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	return file.Close()
+}
+
+func uploadToContainer(ctx context.Context, api *apiclient.APIClient, apiPath, localPath string) error {
+	if _, err := os.Stat(localPath); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, localPath))
+	}()
+	defer pr.Close()
+
+	return api.Upload(ctx, apiPath, "application/x-tar", pr)
+}
+
+// writeTar writes a tar archive of localPath, a file or directory, with entries relative to its parent directory.
+func writeTar(w io.Writer, localPath string) error {
+	tw := tar.NewWriter(w)
+	baseDir := filepath.Dir(filepath.Clean(localPath))
+
+	err := filepath.Walk(localPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			ui.Warn("Skipping %s, only regular files and directories are copied", filePath)
+			return nil
+		}
+
+		relPath, err := filepath.Rel(baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,75 @@
+package haloy
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testArchive returns a tar archive with the given files, keyed by entry name.
+func testArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractTar(t *testing.T) {
+	tests := []struct {
+		name    string
+		destDir string // Relative to the working directory, which is a new temp dir
+		rename  string
+		files   map[string]string
+		want    string // Path of the extracted file relative to the working directory
+		wantErr bool
+	}{
+		{name: "current directory", destDir: ".", files: map[string]string{"hosts": "a"}, want: "hosts"},
+		{name: "current directory with trailing slash", destDir: "./", files: map[string]string{"reports/day.csv": "a"}, want: "reports/day.csv"},
+		{name: "current directory renamed", destDir: ".", rename: "heap.hprof", files: map[string]string{"dump.hprof": "a"}, want: "heap.hprof"},
+		{name: "relative directory", destDir: "out", files: map[string]string{"reports/day.csv": "a"}, want: "out/reports/day.csv"},
+		{name: "absolute directory", files: map[string]string{"reports/day.csv": "a"}, want: "abs/reports/day.csv"},
+		{name: "parent escape", destDir: "out", files: map[string]string{"../escape": "a"}, wantErr: true},
+		{name: "nested parent escape", destDir: ".", files: map[string]string{"reports/../../escape": "a"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := t.TempDir()
+			t.Chdir(workDir)
+			destDir := tt.destDir
+			if destDir == "" {
+				destDir = filepath.Join(workDir, "abs")
+			}
+			if err := os.MkdirAll(destDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := extractTar(testArchive(t, tt.files), destDir, tt.rename)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractTar() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, err := os.Stat(filepath.Join(filepath.Dir(workDir), "escape")); err == nil {
+					t.Errorf("extractTar() wrote a file outside the destination")
+				}
+				return
+			}
+			if content, err := os.ReadFile(filepath.FromSlash(tt.want)); err != nil || string(content) != "a" {
+				t.Errorf("extractTar() did not extract %s: %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -3,17 +3,21 @@ package haloy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/ameistad/haloy/internal/apiclient"
 	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/appconfigloader"
 	"github.com/ameistad/haloy/internal/cmdexec"
 	"github.com/ameistad/haloy/internal/config"
-	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/ameistad/haloy/internal/logging"
 	"github.com/ameistad/haloy/internal/ui"
 	"github.com/charmbracelet/lipgloss"
@@ -22,74 +26,180 @@ import (
 
 func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 	var noLogsFlag bool
+	var checkDNSFlag bool
+	var stagingCertsFlag bool
+	var fromSourceFlag string
+	var sourceBuilderFlag string
+	var serverDryRunFlag bool
+	var ignoreFreezeFlag bool
+	var annotationFlags []string
+	var selectorFlag string
+	var parallelFlag int
+	var saveLogsFlag string
+	var saveLogsFormatFlag string
 
 	cmd := &cobra.Command{
-		Use:   "deploy",
+		Use:   "deploy [app]",
 		Short: "Deploy an application",
-		Long:  "Deploy an application using a haloy configuration file.",
-		Args:  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, _ []string) {
+		Long: `Deploy an application using a haloy configuration file.
+
+In a monorepo the app can be given as a reference to its config, e.g. 'haloy deploy apps/api'
+deploys haloy/apps/api.yaml layered on top of haloy/base.yaml.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
 			ctx := cmd.Context()
 
-			rawAppConfig, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
+			if len(args) > 0 {
+				if flags.configPath != "" {
+					ui.Error("cannot specify both an app and the --config flag")
+					return
+				}
+				*configPath = args[0]
+			}
+			// App references like apps/api are resolved to their file, so hooks and
+			// builds run relative to the app config.
+			if *configPath != "." {
+				configFile, err := appconfigloader.FindConfigFile(*configPath)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				*configPath = configFile
+			}
+
+			// Local steps print the output of docker build and secret providers directly,
+			// so they always use the compact progress output.
+			progress := ui.NewStepProgress("", false)
+			progress.Start(logging.StepResolve)
+
+			selector, err := newAppSelector("", selectorFlag)
 			if err != nil {
+				progress.Finish(err)
 				ui.Error("%v", err)
 				return
 			}
 
-			resolvedAppConfig, err := appconfigloader.ResolveSecrets(ctx, rawAppConfig)
+			saveLogs, err := newLogArtifact(saveLogsFlag, saveLogsFormatFlag)
 			if err != nil {
+				progress.Finish(err)
+				ui.Error("%v", err)
+				return
+			}
+
+			var rawAppConfig config.AppConfig
+			if selector.isEmpty() {
+				rawAppConfig, err = appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
+			} else {
+				rawAppConfig, err = loadForSelector(ctx, *configPath, flags)
+			}
+			if err != nil {
+				progress.Finish(err)
 				ui.Error("%v", err)
 				return
 			}
 
 			rawTargets, err := appconfigloader.ExtractTargets(rawAppConfig)
 			if err != nil {
+				progress.Finish(err)
+				ui.Error("%v", err)
+				return
+			}
+			for name, targetConfig := range rawTargets {
+				if !selector.matches(targetConfig.Name, targetConfig.Labels) {
+					delete(rawTargets, name)
+				}
+			}
+			if len(rawTargets) == 0 {
+				err := fmt.Errorf("no targets match the selector '%s'", selectorFlag)
+				progress.Finish(err)
+				ui.Error("%v", err)
+				return
+			}
+
+			progress.Start(logging.StepSecrets)
+			resolvedAppConfig, err := appconfigloader.ResolveSecrets(ctx, rawAppConfig)
+			if err != nil {
+				progress.Finish(err)
 				ui.Error("%v", err)
 				return
 			}
 
 			resolvedTargets, err := appconfigloader.ExtractTargets(resolvedAppConfig)
 			if err != nil {
+				progress.Finish(err)
 				ui.Error("%v", err)
 				return
 			}
 
+			for name := range resolvedTargets {
+				if _, selected := rawTargets[name]; !selected {
+					delete(resolvedTargets, name)
+				}
+			}
+
 			if len(rawTargets) != len(resolvedTargets) {
+				progress.Finish(errors.New("target mismatch"))
 				ui.Error("Mismatch between raw targets (%d) and resolved targets (%d). This indicates a configuration processing error.", len(rawTargets), len(resolvedTargets))
 				return
 			}
-
-			builds, pushes, uploads := ResolveImageBuilds(resolvedTargets)
-			for imageRef, image := range builds {
-				if err := BuildImage(ctx, imageRef, image, *configPath); err != nil {
-					ui.Error("%v", err)
-					return
+			if stagingCertsFlag {
+				for name, targetConfig := range rawTargets {
+					targetConfig.ACMEStaging = true
+					rawTargets[name] = targetConfig
+				}
+				for name, targetConfig := range resolvedTargets {
+					targetConfig.ACMEStaging = true
+					resolvedTargets[name] = targetConfig
 				}
 			}
-			for imageRef, targetConfigs := range uploads {
-				if err := UploadImage(ctx, imageRef, targetConfigs); err != nil {
+
+			if fromSourceFlag != "" {
+				if err := applySourceBuild(resolvedTargets, fromSourceFlag, config.SourceBuilder(sourceBuilderFlag)); err != nil {
+					progress.Finish(err)
 					ui.Error("%v", err)
 					return
 				}
 			}
 
-			if len(pushes) > 0 {
-				cli, err := docker.NewClient(ctx)
-				if err != nil {
-					ui.Error("Unable to create docker client for push image: %v", err)
-					return
+			annotations, err := deployAnnotations(ctx, getHooksWorkDir(*configPath), annotationFlags)
+			if err != nil {
+				progress.Finish(err)
+				ui.Error("%v", err)
+				return
+			}
+			if len(annotations) > 0 {
+				for name, targetConfig := range rawTargets {
+					targetConfig.Annotations = annotations
+					rawTargets[name] = targetConfig
 				}
-				for imageRef, images := range pushes {
-					for _, image := range images {
-						registryServer := docker.GetRegistryServer(image)
-						ui.Info("Pushing image '%s' to %s", imageRef, registryServer)
-						if err := docker.PushImage(ctx, cli, imageRef, image); err != nil {
-							ui.Error("%v", err)
-							return
-						}
+				for name, targetConfig := range resolvedTargets {
+					targetConfig.Annotations = annotations
+					resolvedTargets[name] = targetConfig
+				}
+			}
+			progress.Finish(nil)
+
+			if err := buildAndPublishImages(ctx, resolvedTargets, *configPath, progress); err != nil {
+				progress.Finish(err)
+				ui.Error("%v", err)
+				return
+			}
+			progress.Finish(nil)
+
+			// Images are built and uploaded so the server can check them, hooks only run for real deployments.
+			if serverDryRunFlag {
+				for _, targetName := range slices.Sorted(maps.Keys(rawTargets)) {
+					prefix := ""
+					if len(rawTargets) > 1 {
+						prefix = lipgloss.NewStyle().Bold(true).Foreground(ui.White).Render(fmt.Sprintf("%s ", targetName))
+					}
+					rollbackAppConfig := config.AppConfig{
+						TargetConfig:    rawTargets[targetName],
+						SecretProviders: rawAppConfig.SecretProviders,
 					}
+					dryRunTarget(ctx, resolvedTargets[targetName], rollbackAppConfig, prefix)
 				}
+				return
 			}
 
 			if len(rawAppConfig.GlobalPreDeploy) > 0 {
@@ -103,13 +213,18 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 
 			servers := appconfigloader.TargetsByServer(rawTargets)
 
-			// Create deployment IDs per app name
-			deploymentIDs := make(map[string]string)
-			for _, target := range resolvedTargets {
-				if _, exists := deploymentIDs[target.Name]; !exists {
-					deploymentIDs[target.Name] = createDeploymentID()
-				}
+			// Spinners are only drawn for a single target, concurrent deployments print compact output.
+			interactive := len(rawTargets) == 1 && ui.IsInteractive()
+
+			var timingsMutex sync.Mutex
+			targetTimings := make(map[string][]ui.StepTiming)
+
+			// Servers deploy concurrently, limited by --parallel when it's set.
+			parallel := len(servers)
+			if parallelFlag > 0 {
+				parallel = parallelFlag
 			}
+			semaphore := make(chan struct{}, parallel)
 
 			var wg sync.WaitGroup
 			for server, targetNames := range servers {
@@ -118,9 +233,10 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 					server string,
 					targetNames []string,
 					rawTargets, resolvedTargets map[string]config.TargetConfig,
-					deploymentIDs map[string]string,
 				) {
 					defer wg.Done()
+					semaphore <- struct{}{}
+					defer func() { <-semaphore }()
 					for _, targetName := range targetNames {
 
 						rawTargetConfig, rawTargetExists := rawTargets[targetName]
@@ -135,12 +251,6 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 							return
 						}
 
-						deploymentID, deploymentIDExists := deploymentIDs[resolvedTargetConfig.Name]
-						if !deploymentIDExists {
-							ui.Error("Could not find deployment ID for app '%s'", resolvedTargetConfig.Name)
-							return
-						}
-
 						// Recreate the AppConfig with just the target for rollbacks
 						rollbackAppConfig := config.AppConfig{
 							TargetConfig:    rawTargetConfig,
@@ -152,22 +262,32 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 							prefix = lipgloss.NewStyle().Bold(true).Foreground(ui.White).Render(fmt.Sprintf("%s ", targetName))
 						}
 
-						deployTarget(
+						timings := deployTarget(
 							ctx,
 							resolvedTargetConfig,
 							rollbackAppConfig,
 							*configPath,
-							deploymentID,
 							prefix,
 							noLogsFlag,
+							checkDNSFlag,
+							ignoreFreezeFlag,
+							interactive,
+							saveLogs,
 						)
+						timingsMutex.Lock()
+						targetTimings[targetName] = timings
+						timingsMutex.Unlock()
 
 					}
-				}(server, targetNames, rawTargets, resolvedTargets, deploymentIDs)
+				}(server, targetNames, rawTargets, resolvedTargets)
 			}
 
 			wg.Wait()
 
+			if !noLogsFlag {
+				ui.PrintStepTimings(progress.Timings(), targetTimings)
+			}
+
 			if len(rawAppConfig.GlobalPostDeploy) > 0 {
 				for _, hookCmd := range rawAppConfig.GlobalPostDeploy {
 					if err := cmdexec.RunCommand(ctx, hookCmd, getHooksWorkDir(*configPath)); err != nil {
@@ -182,6 +302,17 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
 	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Deploy to a specific targets (comma-separated)")
 	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Deploy to all targets")
+	cmd.Flags().BoolVar(&checkDNSFlag, "check-dns", false, "Check that the domains resolve to the server before deploying")
+	cmd.Flags().BoolVar(&stagingCertsFlag, "staging-certs", false, "Request certificates from the Let's Encrypt staging CA")
+	cmd.Flags().StringVar(&fromSourceFlag, "from-source", "", "Build the images from the source in this directory without a Dockerfile")
+	cmd.Flags().StringVar(&sourceBuilderFlag, "source-builder", "", "Builder used with --from-source: buildpacks (default) or nixpacks")
+	cmd.Flags().StringArrayVar(&annotationFlags, "annotation", nil, "Add a key=value annotation to the deployment (repeatable)")
+	cmd.Flags().BoolVar(&ignoreFreezeFlag, "ignore-freeze", false, "Deploy during a freeze window of the server")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Deploy the targets with labels, e.g. env=staging,team=payments")
+	cmd.Flags().IntVarP(&parallelFlag, "parallel", "p", 0, "Number of servers to deploy to at the same time (default: all)")
+	cmd.Flags().BoolVar(&serverDryRunFlag, "server-dry-run", false, "Show what the deployment would change on the server without deploying")
+	cmd.Flags().StringVar(&saveLogsFlag, "save-logs", "", "Write the full log of each deployment to a file in this directory")
+	cmd.Flags().StringVar(&saveLogsFormatFlag, "save-logs-format", apitypes.LogFormatText, "Format of the saved logs: text, ndjson or json")
 
 	return cmd
 }
@@ -190,9 +321,10 @@ func deployTarget(
 	ctx context.Context,
 	targetConfig config.TargetConfig,
 	rollbackAppConfig config.AppConfig,
-	configPath, deploymentID, prefix string,
-	noLogs bool,
-) {
+	configPath, prefix string,
+	noLogs, dnsCheck, ignoreFreeze, interactive bool,
+	saveLogs *logArtifact,
+) []ui.StepTiming {
 	format := targetConfig.Format
 	server := targetConfig.Server
 	preDeploy := targetConfig.PreDeploy
@@ -206,7 +338,7 @@ func deployTarget(
 		for _, hookCmd := range preDeploy {
 			if err := cmdexec.RunCommand(ctx, hookCmd, getHooksWorkDir(configPath)); err != nil {
 				pui.Error("%s hook failed: %v", config.GetFieldNameForFormat(config.AppConfig{}, "PreDeploy", format), err)
-				return
+				return nil
 			}
 		}
 	}
@@ -214,44 +346,106 @@ func deployTarget(
 	token, err := getToken(&targetConfig, server)
 	if err != nil {
 		pui.Error("%v", err)
-		return
+		return nil
 	}
 
 	// Send the deploy request
 	api, err := apiclient.New(server, token)
 	if err != nil {
 		pui.Error("Failed to create API client: %v", err)
-		return
+		return nil
+	}
+
+	// DNS problems only affect certificates, so they are reported without stopping the deployment.
+	if dnsCheck {
+		warnings, err := checkDNS(ctx, api, targetConfig)
+		if err != nil {
+			pui.Warn("Skipping DNS check: %v", err)
+		}
+		for _, warning := range warnings {
+			pui.Warn("%s", warning)
+		}
 	}
 
 	request := apitypes.DeployRequest{
 		TargetConfig:      targetConfig,
 		RollbackAppConfig: rollbackAppConfig,
-		DeploymentID:      deploymentID,
+		IgnoreFreeze:      ignoreFreeze,
 	}
-	err = api.Post(ctx, "deploy", request, nil)
+	var response apitypes.DeployResponse
+	err = api.Post(ctx, "deploy", request, &response)
 	if err != nil {
 		pui.Error("Deployment request failed: %v", err)
-		return
+		if hint := errorHint(err); hint != "" {
+			pui.Info("%s", hint)
+		}
+		pui.Info("Correlation ID for the haloyd logs: %s", apiclient.CorrelationID())
+		return nil
+	}
+	// haloyd assigns the deployment ID.
+	deploymentID := response.DeploymentID
+	if response.Pending {
+		pui.Warn("%s requires approval, the deployment is pending. Approve it with: haloy approve %s", targetConfig.Name, deploymentID)
+		return nil
+	}
+	if response.QueuedUntil != nil {
+		pui.Warn("Deployments are frozen on %s, %s is queued and starts at %s", server, deploymentID, helpers.FormatTime(*response.QueuedUntil))
+		return nil
 	}
 
+	var timings []ui.StepTiming
 	if !noLogs {
 		streamPath := fmt.Sprintf("deploy/%s/logs", deploymentID)
+		progress := ui.NewStepProgress(prefix, interactive)
+		timer := &stepTimer{}
 
 		streamHandler := func(data string) bool {
 			var logEntry logging.LogEntry
 			if err := json.Unmarshal([]byte(data), &logEntry); err != nil {
-				pui.Error("failed to ummarshal json: %v", err)
+				progress.Print(func() { pui.Error("failed to ummarshal json: %v", err) })
 				return false // we don't stop on errors.
 			}
 
-			ui.DisplayLogEntry(logEntry, prefix)
+			// Step markers are rendered by the progress output instead of as log lines.
+			if logEntry.Step != "" {
+				timer.mark(logEntry.Step, logEntry.Timestamp)
+				progress.Start(logEntry.Step)
+				return false
+			}
+
+			if logEntry.IsDeploymentComplete {
+				timer.mark("", logEntry.Timestamp)
+				var stepErr error
+				if logEntry.IsDeploymentFailed {
+					stepErr = errors.New(logEntry.Message)
+				}
+				progress.Finish(stepErr)
+			}
+
+			progress.Print(func() { ui.DisplayLogEntry(logEntry, prefix) })
+			if logEntry.IsDeploymentFailed {
+				progress.Print(func() { pui.Info("Correlation ID for the haloyd logs: %s", apiclient.CorrelationID()) })
+			}
 
 			// If deployment is complete we'll return true to signal stream should stop
 			return logEntry.IsDeploymentComplete
 		}
 
-		api.Stream(ctx, streamPath, streamHandler)
+		if err := api.Stream(ctx, streamPath, streamHandler); err != nil {
+			progress.Finish(err)
+			pui.Error("Log stream failed: %v", err)
+		}
+		progress.Finish(nil)
+		timings = timer.timings
+
+		if saveLogs != nil {
+			path, err := saveLogs.save(ctx, api, targetConfig.Name, deploymentID)
+			if err != nil {
+				pui.Error("Failed to save deployment logs: %v", err)
+			} else {
+				pui.Info("Saved deployment logs to %s", path)
+			}
+		}
 	}
 
 	if len(postDeploy) > 0 {
@@ -261,6 +455,8 @@ func deployTarget(
 			}
 		}
 	}
+
+	return timings
 }
 
 func getHooksWorkDir(configPath string) string {
@@ -277,3 +473,20 @@ func getHooksWorkDir(configPath string) string {
 	}
 	return workDir
 }
+
+// stepTimer measures the server side deployment steps from the timestamps of the streamed
+// log entries, so the durations are not affected by network latency.
+type stepTimer struct {
+	step    string
+	started time.Time
+	timings []ui.StepTiming
+}
+
+// mark ends the running step at the given time and starts the next one. An empty step ends the deployment.
+func (t *stepTimer) mark(step string, at time.Time) {
+	if t.step != "" && !at.IsZero() {
+		t.timings = append(t.timings, ui.StepTiming{Step: t.step, Duration: at.Sub(t.started)})
+	}
+	t.step = step
+	t.started = at
+}
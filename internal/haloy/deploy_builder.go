@@ -2,15 +2,26 @@ package haloy
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/cmdexec"
 	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/docker"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
 	"github.com/ameistad/haloy/internal/ui"
 )
 
@@ -42,9 +53,51 @@ func ResolveImageBuilds(targets map[string]config.TargetConfig) (map[string]*con
 	return builds, pushes, uploads
 }
 
-// BuildImage builds a Docker image using the provided image configuration
-func BuildImage(ctx context.Context, imageRef string, image *config.Image, configPath string) error {
-	ui.Info("Building image %s", imageRef)
+// buildAndPublishImages builds the images of the targets that are built from source and uploads them to the
+// servers or pushes them to their registries.
+func buildAndPublishImages(ctx context.Context, targets map[string]config.TargetConfig, configPath string, progress *ui.StepProgress) error {
+	builds, pushes, uploads := ResolveImageBuilds(targets)
+	if len(builds) > 0 || len(pushes) > 0 || len(uploads) > 0 {
+		progress.Start(logging.StepPush)
+	}
+	for imageRef, image := range builds {
+		agent := selectBuildAgent(ctx, imageRef, image, targets)
+		if err := BuildImage(ctx, imageRef, image, configPath, agent); err != nil {
+			return err
+		}
+	}
+	for imageRef, targetConfigs := range uploads {
+		if err := UploadImage(ctx, imageRef, targetConfigs, progress); err != nil {
+			return err
+		}
+	}
+
+	if len(pushes) > 0 {
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to create docker client for push image: %w", err)
+		}
+		for imageRef, images := range pushes {
+			for _, image := range images {
+				registryServer := docker.GetRegistryServer(image)
+				ui.Info("Pushing image '%s' to %s", imageRef, registryServer)
+				if err := docker.PushImage(ctx, cli, imageRef, image); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// BuildImage builds a Docker image using the provided image configuration. When agent is set the image
+// is built on the agent's Docker host and loaded into the local Docker daemon afterwards.
+func BuildImage(ctx context.Context, imageRef string, image *config.Image, configPath string, agent *config.BuildAgent) error {
+	if agent != nil {
+		ui.Info("Building image %s on %s", imageRef, agent.Host)
+	} else {
+		ui.Info("Building image %s", imageRef)
+	}
 
 	buildConfig := image.BuildConfig
 	if buildConfig == nil {
@@ -57,15 +110,45 @@ func BuildImage(ctx context.Context, imageRef string, image *config.Image, confi
 		buildContext = buildConfig.Context
 	}
 
+	if buildConfig.Platform == "" {
+		buildConfig.Platform = "linux/amd64" // most widely used platform and a common pitfall
+	}
+
+	dockerCmd := "docker"
+	if agent != nil {
+		dockerCmd = fmt.Sprintf("docker --host %s", agent.Host)
+	}
+
+	var cmd string
+	if buildConfig.Source != "" {
+		cmd = sourceBuildCommand(imageRef, buildConfig, agent)
+	} else {
+		cmd = dockerBuildCommand(dockerCmd, imageRef, buildConfig, buildContext)
+	}
+	if err := cmdexec.RunCommand(ctx, cmd, workDir); err != nil {
+		return fmt.Errorf("failed to build image %s: %w", imageRef, err)
+	}
+
+	// Uploads and registry pushes use the local Docker daemon.
+	if agent != nil {
+		ui.Info("Copying image %s from %s", imageRef, agent.Host)
+		loadCmd := fmt.Sprintf("%s save %s | docker load", dockerCmd, imageRef)
+		if err := cmdexec.RunCommand(ctx, loadCmd, workDir); err != nil {
+			return fmt.Errorf("failed to copy image %s from build agent: %w", imageRef, err)
+		}
+	}
+
+	ui.Success("Successfully built image %s", imageRef)
+	return nil
+}
+
+func dockerBuildCommand(dockerCmd, imageRef string, buildConfig *config.BuildConfig, buildContext string) string {
 	args := []string{"build"}
 
 	if buildConfig.Dockerfile != "" {
 		args = append(args, "-f", buildConfig.Dockerfile)
 	}
 
-	if buildConfig.Platform == "" {
-		buildConfig.Platform = "linux/amd64" // most widely used platform and a common pitfall
-	}
 	args = append(args, "--platform", buildConfig.Platform)
 
 	for _, buildArg := range buildConfig.Args {
@@ -83,12 +166,143 @@ func BuildImage(ctx context.Context, imageRef string, image *config.Image, confi
 	// Add build context as the last argument
 	args = append(args, buildContext)
 
-	cmd := fmt.Sprintf("docker %s", strings.Join(args, " "))
-	if err := cmdexec.RunCommand(ctx, cmd, workDir); err != nil {
-		return fmt.Errorf("failed to build image %s: %w", imageRef, err)
+	return fmt.Sprintf("%s %s", dockerCmd, strings.Join(args, " "))
+}
+
+// sourceBuildCommand returns the pack or nixpacks command that builds the image from the source in the
+// working directory. Both build with the Docker daemon in DOCKER_HOST, which is set to the agent's host.
+// Build args are passed to the build as environment variables.
+func sourceBuildCommand(imageRef string, buildConfig *config.BuildConfig, agent *config.BuildAgent) string {
+	var args []string
+	switch buildConfig.Source {
+	case config.SourceBuilderBuildpacks:
+		builder := buildConfig.Buildpacks
+		if builder == "" {
+			builder = config.DefaultBuildpacksBuilder
+		}
+		args = []string{"pack", "build", imageRef, "--path", ".", "--builder", builder, "--platform", buildConfig.Platform}
+	case config.SourceBuilderNixpacks:
+		args = []string{"nixpacks", "build", ".", "--name", imageRef, "--platform", buildConfig.Platform}
 	}
 
-	ui.Success("Successfully built image %s", imageRef)
+	for _, buildArg := range buildConfig.Args {
+		if buildArg.Value != "" {
+			args = append(args, "--env", fmt.Sprintf("%s=%q", buildArg.Name, buildArg.Value))
+		} else {
+			// Without a value the variable is taken from the environment.
+			args = append(args, "--env", fmt.Sprintf("%s=\"$%s\"", buildArg.Name, buildArg.Name))
+		}
+	}
+
+	cmd := strings.Join(args, " ")
+	if agent != nil {
+		cmd = fmt.Sprintf("DOCKER_HOST=%s %s", agent.Host, cmd)
+	}
+	return cmd
+}
+
+// selectBuildAgent sets the build platform of the image to the architecture of its server when it's not
+// configured, and returns the build agent from the client config to build it on when the local Docker
+// daemon has another architecture. Without a matching agent the image is built locally with emulation.
+func selectBuildAgent(ctx context.Context, imageRef string, image *config.Image, targets map[string]config.TargetConfig) *config.BuildAgent {
+	if image.BuildConfig == nil {
+		image.BuildConfig = &config.BuildConfig{}
+	}
+	if image.BuildConfig.Platform == "" {
+		image.BuildConfig.Platform = "linux/" + serverArch(ctx, imageRef, targets)
+	}
+	arch := config.PlatformArch(image.BuildConfig.Platform)
+
+	localArch, err := cmdexec.RunCLICommand(ctx, "docker", "version", "--format", "{{.Server.Arch}}")
+	if err != nil || config.NormalizeArch(localArch) == arch {
+		return nil
+	}
+
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return nil
+	}
+	clientConfig, err := config.LoadClientConfig(filepath.Join(configDir, constants.ClientConfigFileName))
+	if err != nil || clientConfig == nil {
+		clientConfig = &config.ClientConfig{}
+	}
+	name, agent, ok := clientConfig.BuildAgentForArch(arch)
+	if !ok {
+		ui.Warn("Building %s for %s on a %s Docker host uses emulation, which can be slow. Add a build agent with 'haloy build-agent add'", imageRef, arch, config.NormalizeArch(localArch))
+		return nil
+	}
+	ui.Info("Using build agent %s (%s) for %s", name, arch, imageRef)
+	return &agent
+}
+
+// serverArch returns the architecture of the first server, ordered by target name, that deploys the image.
+// It defaults to amd64 when the server can't be asked, e.g. because it's running an older haloyd.
+func serverArch(ctx context.Context, imageRef string, targets map[string]config.TargetConfig) string {
+	const defaultArch = "amd64" // most widely used platform and a common pitfall
+	for _, name := range slices.Sorted(maps.Keys(targets)) {
+		target := targets[name]
+		if target.Image == nil || target.Image.ImageRef() != imageRef {
+			continue
+		}
+		token, err := getToken(&target, target.Server)
+		if err != nil {
+			return defaultArch
+		}
+		api, err := apiclient.New(target.Server, token)
+		if err != nil {
+			return defaultArch
+		}
+		var system apitypes.SystemResponse
+		if err := api.Get(ctx, "system", &system); err != nil || system.Arch == "" {
+			return defaultArch
+		}
+		return config.NormalizeArch(system.Arch)
+	}
+	return defaultArch
+}
+
+// applySourceBuild makes the targets build their image from the source in dir with a source builder,
+// the one in the app config when builder is empty, or buildpacks.
+func applySourceBuild(targets map[string]config.TargetConfig, dir string, builder config.SourceBuilder) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid source directory '%s': %w", dir, err)
+	}
+	if stat, err := os.Stat(absDir); err != nil || !stat.IsDir() {
+		return fmt.Errorf("source directory '%s' not found", dir)
+	}
+
+	for name, target := range targets {
+		if target.Image == nil {
+			return fmt.Errorf("target '%s' has no image to build, set image.repository", name)
+		}
+		// Targets can share the image of the app config, so it's copied before it's changed.
+		image := *target.Image
+		buildConfig := config.BuildConfig{}
+		if image.BuildConfig != nil {
+			buildConfig = *image.BuildConfig
+		}
+		buildConfig.Context = absDir
+		buildConfig.Dockerfile = ""
+		if builder != "" {
+			buildConfig.Source = builder
+		}
+		if buildConfig.Source == "" {
+			buildConfig.Source = config.SourceBuilderBuildpacks
+		}
+		if buildConfig.Buildpacks != "" && buildConfig.Source != config.SourceBuilderBuildpacks {
+			buildConfig.Buildpacks = ""
+		}
+		if err := buildConfig.Validate(target.Format); err != nil {
+			return err
+		}
+
+		build := true
+		image.Build = &build
+		image.BuildConfig = &buildConfig
+		target.Image = &image
+		targets[name] = target
+	}
 	return nil
 }
 
@@ -119,37 +333,168 @@ func getBuilderWorkDir(configPath, builderContext string) string {
 	return workDir
 }
 
-// UploadImage uploads a Docker image tar to the specified server
-func UploadImage(ctx context.Context, imageRef string, resolvedTargetConfigs []*config.TargetConfig) error {
-	tempFile, err := os.CreateTemp("", fmt.Sprintf("haloy-upload-%s-*.tar", strings.ReplaceAll(imageRef, ":", "-")))
+const (
+	uploadChunkSize = 16 << 20
+	uploadRetries   = 5
+)
+
+// UploadImage uploads a Docker image to the servers of the targets. Layers a server already has
+// are left out of the archive, and the archive is sent in chunks so an interrupted upload resumes
+// where it stopped.
+func UploadImage(ctx context.Context, imageRef string, resolvedTargetConfigs []*config.TargetConfig, progress *ui.StepProgress) error {
+	var buildConfig *config.BuildConfig
+	if len(resolvedTargetConfigs) > 0 && resolvedTargetConfigs[0].Image != nil {
+		buildConfig = resolvedTargetConfigs[0].Image.BuildConfig
+	}
+	compression := buildConfig.GetEffectiveCompression()
+
+	// The server compares the loaded image with this ID to verify the upload.
+	imageID, err := cmdexec.RunCLICommand(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", imageRef)
+	if err != nil {
+		return fmt.Errorf("failed to inspect image %s: %w", imageRef, err)
+	}
+
+	tempPattern := fmt.Sprintf("haloy-upload-%s-*.tar", strings.NewReplacer(":", "-", "/", "-").Replace(imageRef))
+	rawFile, err := os.CreateTemp("", tempPattern)
 	if err != nil {
 		return fmt.Errorf("failed to create temporary file: %w", err)
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
+	defer os.Remove(rawFile.Name())
+	rawFile.Close()
 
-	saveCmd := fmt.Sprintf("docker save -o %s %s", tempFile.Name(), imageRef)
-	if err := cmdexec.RunCommand(ctx, saveCmd, "."); err != nil {
-		return fmt.Errorf("failed to save image to tar: %w", err)
+	if _, err := cmdexec.RunCLICommand(ctx, "docker", "save", "-o", rawFile.Name(), imageRef); err != nil {
+		return fmt.Errorf("failed to save image %s: %w", imageRef, err)
+	}
+	archive, err := readImageArchive(rawFile.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read image archive: %w", err)
 	}
 
-	for _, resolvedAppConfig := range resolvedTargetConfigs {
-		ui.Info("Uploading image %s to %s", imageRef, resolvedAppConfig.Server)
+	// Servers that have the same layers get the same archive.
+	type preparedArchive struct {
+		file *os.File
+		req  apitypes.ImageUploadRequest
+	}
+	prepared := make(map[int]preparedArchive)
+	defer func() {
+		for _, p := range prepared {
+			p.file.Close()
+			os.Remove(p.file.Name())
+		}
+	}()
 
-		token, err := getToken(resolvedAppConfig, resolvedAppConfig.Server)
+	for _, resolvedAppConfig := range resolvedTargetConfigs {
+		server := resolvedAppConfig.Server
+		token, err := getToken(resolvedAppConfig, server)
 		if err != nil {
 			return fmt.Errorf("failed to get authentication token: %w", err)
 		}
 
-		api, err := apiclient.NewWithTimeout(resolvedAppConfig.Server, token, 5*time.Minute)
+		api, err := apiclient.NewWithTimeout(server, token, 15*time.Minute)
 		if err != nil {
 			return fmt.Errorf("failed to create API client: %w", err)
 		}
 
-		if err := api.PostFile(ctx, "images/upload", "image", tempFile.Name()); err != nil {
-			return fmt.Errorf("failed to upload image: %w", err)
+		// Servers without layer support get the full archive.
+		var layers apitypes.ImageLayersResponse
+		if err := api.Post(ctx, "images/layers", apitypes.ImageLayersRequest{DiffIDs: archive.diffIDs}, &layers); err != nil {
+			layers.PresentLayers = 0
+		}
+		present := min(max(layers.PresentLayers, 0), len(archive.diffIDs))
+
+		p, ok := prepared[present]
+		if !ok {
+			file, err := os.CreateTemp("", tempPattern)
+			if err != nil {
+				return fmt.Errorf("failed to create temporary file: %w", err)
+			}
+			p = preparedArchive{file: file}
+			prepared[present] = p
+
+			p.req, err = prepareArchive(ctx, archive, present, compression, file)
+			if err != nil {
+				return err
+			}
+			p.req.ImageRef = imageRef
+			p.req.ImageID = imageID
+			prepared[present] = p
+		}
+
+		onProgress := func(sent int64) {
+			progress.SetDetail(fmt.Sprintf("%s %s / %s", server, helpers.FormatBytes(sent), helpers.FormatBytes(p.req.Size)))
+		}
+		if err := uploadArchive(ctx, api, p.file, p.req, onProgress); err != nil {
+			return fmt.Errorf("failed to upload image to %s: %w", server, err)
 		}
+		progress.Print(func() {
+			ui.Info("Uploaded image %s to %s (%s, %s, %d of %d layers already on server)",
+				imageRef, server, helpers.FormatBytes(p.req.Size), compression, present, len(archive.diffIDs))
+		})
 	}
 
 	return nil
 }
+
+// prepareArchive writes the compressed archive without the first skip layers to file and returns
+// the size and digest of the upload.
+func prepareArchive(ctx context.Context, archive imageArchive, skip int, compression config.UploadCompression, file *os.File) (apitypes.ImageUploadRequest, error) {
+	var req apitypes.ImageUploadRequest
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.CloseWithError(archive.writeWithoutLayers(skip, pipeWriter))
+	}()
+
+	hash := sha256.New()
+	err := compressArchive(ctx, pipeReader, compression, io.MultiWriter(file, hash))
+	pipeReader.CloseWithError(err)
+	if err != nil {
+		return req, fmt.Errorf("failed to create image archive: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return req, fmt.Errorf("failed to stat image archive: %w", err)
+	}
+	req.Size = info.Size()
+	req.Digest = "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	return req, nil
+}
+
+// uploadArchive sends the archive in chunks and asks the server to load it. Failed chunks are
+// retried from the offset reported by the server.
+func uploadArchive(ctx context.Context, api *apiclient.APIClient, archive *os.File, uploadReq apitypes.ImageUploadRequest, onProgress func(sent int64)) error {
+	var status apitypes.ImageUploadStatusResponse
+	if err := api.Post(ctx, "images/uploads", uploadReq, &status); err != nil {
+		return err
+	}
+
+	failures := 0
+	for status.Offset < uploadReq.Size {
+		onProgress(status.Offset)
+
+		chunk := io.NewSectionReader(archive, status.Offset, min(uploadChunkSize, uploadReq.Size-status.Offset))
+		var next apitypes.ImageUploadStatusResponse
+		err := api.UploadChunk(ctx, "images/uploads/"+status.UploadID, status.Offset, chunk, &next)
+		if err == nil || (errors.Is(err, apiclient.ErrOffsetMismatch) && next.Offset != status.Offset) {
+			status = next
+			failures = 0
+			continue
+		}
+
+		failures++
+		if failures > uploadRetries || ctx.Err() != nil {
+			return err
+		}
+		// The next attempt is answered with the server's offset if part of the chunk was received.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(failures) * 2 * time.Second):
+		}
+	}
+	onProgress(uploadReq.Size)
+
+	var response apitypes.ImageUploadResponse
+	return api.Post(ctx, "images/uploads/"+status.UploadID+"/complete", nil, &response)
+}
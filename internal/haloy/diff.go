@@ -0,0 +1,219 @@
+package haloy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func DiffCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff [app]",
+		Short: "Show what a deploy would change compared to the live deployment",
+		Long: `Compare the locally resolved config with the config of the live deployment stored by haloyd.
+Changes to the image, replicas, domains and environment variables are listed first, followed by a diff of the other settings.
+
+Secret values never leave the server, environment variables are compared by a hash of their value.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			rawAppConfig, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			resolvedAppConfig, err := appconfigloader.ResolveSecrets(ctx, rawAppConfig)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			targets, err := appconfigloader.ExtractTargets(resolvedAppConfig)
+			if err != nil {
+				ui.Error("Unable to create deploy targets: %v", err)
+				return
+			}
+
+			found := false
+			for _, targetName := range slices.Sorted(maps.Keys(targets)) {
+				target := targets[targetName]
+				if len(args) == 1 && target.Name != args[0] {
+					continue
+				}
+				found = true
+				diffTarget(ctx, target)
+			}
+			if !found {
+				ui.Error("No target in the config deploys '%s'", args[0])
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Compare specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Compare all targets")
+	return cmd
+}
+
+func diffTarget(ctx context.Context, targetConfig config.TargetConfig) {
+	token, err := getToken(&targetConfig, targetConfig.Server)
+	if err != nil {
+		ui.Error("%v", err)
+		return
+	}
+
+	api, err := apiclient.New(targetConfig.Server, token)
+	if err != nil {
+		ui.Error("Failed to create API client: %v", err)
+		return
+	}
+
+	var response apitypes.DeployedConfigResponse
+	if err := api.Get(ctx, fmt.Sprintf("config/%s", targetConfig.Name), &response); err != nil {
+		ui.Error("Failed to get the deployed config of %s: %v", targetConfig.Name, err)
+		return
+	}
+
+	local, err := targetConfig.Redacted()
+	if err != nil {
+		ui.Error("%v", err)
+		return
+	}
+
+	changes, err := configChanges(response.TargetConfig, local)
+	if err != nil {
+		ui.Error("Failed to compare the config of %s: %v", targetConfig.Name, err)
+		return
+	}
+	if len(changes) == 0 {
+		ui.Success("%s on %s matches deployment %s", targetConfig.Name, targetConfig.Server, response.DeploymentID)
+		return
+	}
+	ui.Section(fmt.Sprintf("Changes to deployment %s of %s on %s", response.DeploymentID, targetConfig.Name, targetConfig.Server), changes)
+}
+
+// configChanges lists the changes from the deployed to the local config, both with redacted secrets.
+func configChanges(deployed, local config.TargetConfig) ([]string, error) {
+	var changes []string
+
+	if deployedRef, localRef := diffImageRef(deployed.Image), diffImageRef(local.Image); deployedRef != localRef {
+		changes = append(changes, fmt.Sprintf("~ Image: %s -> %s", deployedRef, localRef))
+	}
+
+	if deployedReplicas, localReplicas := diffReplicas(deployed.Replicas), diffReplicas(local.Replicas); deployedReplicas != localReplicas {
+		changes = append(changes, fmt.Sprintf("~ Replicas: %d -> %d", deployedReplicas, localReplicas))
+	}
+
+	deployedDomains, localDomains := diffDomains(deployed.Domains), diffDomains(local.Domains)
+	for _, domain := range deployedDomains {
+		if !slices.Contains(localDomains, domain) {
+			changes = append(changes, fmt.Sprintf("- Domain: %s", domain))
+		}
+	}
+	for _, domain := range localDomains {
+		if !slices.Contains(deployedDomains, domain) {
+			changes = append(changes, fmt.Sprintf("+ Domain: %s", domain))
+		}
+	}
+
+	deployedEnv, localEnv := diffEnv(deployed.Env), diffEnv(local.Env)
+	names := slices.Sorted(maps.Keys(deployedEnv))
+	for name := range localEnv {
+		if _, exists := deployedEnv[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		deployedValue, inDeployed := deployedEnv[name]
+		localValue, inLocal := localEnv[name]
+		switch {
+		case !inLocal:
+			changes = append(changes, fmt.Sprintf("- Env: %s", name))
+		case !inDeployed:
+			changes = append(changes, fmt.Sprintf("+ Env: %s", name))
+		case deployedValue != localValue:
+			changes = append(changes, fmt.Sprintf("~ Env: %s (value changed)", name))
+		}
+	}
+
+	deployedRest, err := otherSettings(deployed)
+	if err != nil {
+		return nil, err
+	}
+	localRest, err := otherSettings(local)
+	if err != nil {
+		return nil, err
+	}
+	if diff := helpers.UnifiedDiff("deployed", "local", deployedRest, localRest); diff != "" {
+		changes = append(changes, "Other settings:")
+		changes = append(changes, strings.Split(strings.TrimRight(diff, "\n"), "\n")...)
+	}
+
+	return changes, nil
+}
+
+func diffImageRef(image *config.Image) string {
+	if image == nil {
+		return "none"
+	}
+	return image.ImageRef()
+}
+
+func diffReplicas(replicas *int) int {
+	if replicas == nil {
+		return constants.DefaultReplicas
+	}
+	return *replicas
+}
+
+func diffDomains(domains []config.Domain) []string {
+	formatted := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if len(domain.Aliases) > 0 {
+			formatted = append(formatted, fmt.Sprintf("%s (aliases: %s)", domain.Canonical, strings.Join(domain.Aliases, ", ")))
+		} else {
+			formatted = append(formatted, domain.Canonical)
+		}
+	}
+	return formatted
+}
+
+func diffEnv(env []config.EnvVar) map[string]string {
+	values := make(map[string]string, len(env))
+	for _, envVar := range env {
+		values[envVar.Name] = envVar.Value
+	}
+	return values
+}
+
+// otherSettings formats the settings that aren't listed individually, leaving out the ones that
+// describe the deployment or the client rather than the app.
+func otherSettings(targetConfig config.TargetConfig) (string, error) {
+	targetConfig.Image = nil
+	targetConfig.Replicas = nil
+	targetConfig.Domains = nil
+	targetConfig.Env = nil
+	targetConfig.APIToken = nil
+	targetConfig.Server = ""
+	targetConfig.Annotations = nil
+	data, err := json.MarshalIndent(targetConfig, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
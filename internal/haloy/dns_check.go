@@ -0,0 +1,107 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/helpers"
+)
+
+// cdnRanges are the published address ranges of CDN proxies. Proxied domains don't resolve to the server,
+// and Let's Encrypt HTTP-01 validation fails when the proxy redirects or answers the challenge itself.
+var cdnRanges = map[string][]string{
+	"Cloudflare": {
+		"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22", "141.101.64.0/18",
+		"108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20", "197.234.240.0/22", "198.41.128.0/17",
+		"162.158.0.0/15", "104.16.0.0/13", "104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+		"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32", "2405:8100::/32",
+		"2a06:98c0::/29", "2c0f:f248::/32",
+	},
+}
+
+const dnsLookupTimeout = 5 * time.Second
+
+// checkDNS resolves the domains of a target and compares them to the public addresses of its server.
+// It returns a warning for each domain whose records will keep haloy from obtaining a certificate.
+func checkDNS(ctx context.Context, api *apiclient.APIClient, targetConfig config.TargetConfig) ([]string, error) {
+	if len(targetConfig.Domains) == 0 {
+		return nil, nil
+	}
+
+	var serverIP apitypes.ServerIPResponse
+	if err := api.Get(ctx, "server/ip", &serverIP); err != nil {
+		return nil, fmt.Errorf("failed to get the public IP of the server: %w", err)
+	}
+
+	var warnings []string
+	for _, domain := range targetConfig.Domains {
+		for _, name := range append([]string{domain.Canonical}, domain.Aliases...) {
+			if warning := checkDomainDNS(ctx, name, serverIP); warning != "" {
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+	return warnings, nil
+}
+
+func checkDomainDNS(ctx context.Context, domain string, serverIP apitypes.ServerIPResponse) string {
+	lookupCtx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(lookupCtx, domain)
+	if err != nil {
+		return helpers.DescribeDNSError(domain, err)
+	}
+	if len(addrs) == 0 {
+		return helpers.MissingRecordsGuidance(domain)
+	}
+
+	var ipv4, ipv6 []string
+	for _, addr := range addrs {
+		if provider := cdnProvider(addr.IP); provider != "" {
+			return fmt.Sprintf("%s resolves to %s, which is proxied by %s. Set the record to DNS only until the certificate is issued, HTTP-01 validation can't reach the server through the proxy.",
+				domain, addr.IP, provider)
+		}
+		if addr.IP.To4() != nil {
+			ipv4 = append(ipv4, addr.IP.String())
+		} else {
+			ipv6 = append(ipv6, addr.IP.String())
+		}
+	}
+
+	if serverIP.IPv4 != "" && len(ipv4) > 0 && !slices.Contains(ipv4, serverIP.IPv4) {
+		return fmt.Sprintf("A record of %s points to %s, not to the server. Update it to: %s A %s",
+			domain, strings.Join(ipv4, ", "), domain, serverIP.IPv4)
+	}
+	if len(ipv6) > 0 {
+		// Let's Encrypt prefers IPv6 when a domain has AAAA records, so a wrong one fails validation.
+		if serverIP.IPv6 == "" {
+			return fmt.Sprintf("%s has an AAAA record (%s) but the server has no public IPv6 address. Remove the AAAA record, Let's Encrypt validates over IPv6 when it's present.",
+				domain, strings.Join(ipv6, ", "))
+		}
+		if !slices.Contains(ipv6, serverIP.IPv6) {
+			return fmt.Sprintf("AAAA record of %s points to %s, not to the server. Update it to: %s AAAA %s",
+				domain, strings.Join(ipv6, ", "), domain, serverIP.IPv6)
+		}
+	}
+	return ""
+}
+
+// cdnProvider returns the name of the CDN whose proxy the IP belongs to, or an empty string.
+func cdnProvider(ip net.IP) string {
+	for provider, ranges := range cdnRanges {
+		for _, cidr := range ranges {
+			if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+				return provider
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/ui"
+)
+
+// dryRunTarget asks the server what deploying the target would change and prints it.
+// The server checks the image and renders the container spec and HAProxy config without creating containers.
+func dryRunTarget(ctx context.Context, targetConfig config.TargetConfig, rollbackAppConfig config.AppConfig, prefix string) {
+	pui := &ui.PrefixedUI{Prefix: prefix}
+
+	token, err := getToken(&targetConfig, targetConfig.Server)
+	if err != nil {
+		pui.Error("%v", err)
+		return
+	}
+
+	api, err := apiclient.New(targetConfig.Server, token)
+	if err != nil {
+		pui.Error("Failed to create API client: %v", err)
+		return
+	}
+
+	request := apitypes.DeployRequest{
+		TargetConfig:      targetConfig,
+		RollbackAppConfig: rollbackAppConfig,
+	}
+	var response apitypes.DryRunResponse
+	if err := api.Post(ctx, "deploy/dry-run", request, &response); err != nil {
+		pui.Error("Dry run failed: %v", err)
+		if hint := errorHint(err); hint != "" {
+			pui.Info("%s", hint)
+		}
+		return
+	}
+
+	pui.Success("Dry run for %s on %s, nothing was changed", targetConfig.Name, targetConfig.Server)
+	pui.Info("Image: %s", response.Image)
+	for _, container := range response.Containers {
+		lines := []string{fmt.Sprintf("Network: %s", container.Network)}
+		if len(container.Networks) > 0 {
+			lines = append(lines, fmt.Sprintf("Networks: %s", strings.Join(container.Networks, ", ")))
+		}
+		if len(container.Volumes) > 0 {
+			lines = append(lines, fmt.Sprintf("Volumes: %s", strings.Join(container.Volumes, ", ")))
+		}
+		if len(container.DNS) > 0 {
+			lines = append(lines, fmt.Sprintf("DNS: %s", strings.Join(container.DNS, ", ")))
+		}
+		if len(container.DNSSearch) > 0 {
+			lines = append(lines, fmt.Sprintf("DNS search: %s", strings.Join(container.DNSSearch, ", ")))
+		}
+		if len(container.ExtraHosts) > 0 {
+			lines = append(lines, fmt.Sprintf("Extra hosts: %s", strings.Join(container.ExtraHosts, ", ")))
+		}
+		lines = append(lines, fmt.Sprintf("Environment: %s", strings.Join(container.Env, ", ")))
+		lines = append(lines, "Labels:")
+		for _, key := range slices.Sorted(maps.Keys(container.Labels)) {
+			lines = append(lines, fmt.Sprintf("\t%s=%s", key, container.Labels[key]))
+		}
+		ui.Section(fmt.Sprintf("%sContainer %s", prefix, container.Name), lines)
+	}
+
+	for _, warning := range response.Warnings {
+		pui.Warn("%s", warning)
+	}
+
+	if response.HAProxyDiff == "" {
+		pui.Info("HAProxy config is unchanged")
+		return
+	}
+	ui.Section(fmt.Sprintf("%sHAProxy config changes", prefix), strings.Split(strings.TrimRight(response.HAProxyDiff, "\n"), "\n"))
+}
@@ -0,0 +1,131 @@
+package haloy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func ExportCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var outputFlag string
+	var includeValuesFlag bool
+	var forceFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "export <app>",
+		Short: "Export the config of a deployed app",
+		Long: fmt.Sprintf(`Download the config of the current deployment of an app from the server as a haloy config file,
+which 'haloy import' deploys to another server.
+
+References to secret providers are kept, literal values of environment variables, build arguments and
+credentials are replaced by %s unless --include-values is set.`, config.MaskedValue),
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			appName := args[0]
+
+			var targetConfig *config.TargetConfig
+			server := serverFlag
+			if server == "" {
+				rawAppConfig, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				targets, err := appconfigloader.ExtractTargets(rawAppConfig)
+				if err != nil {
+					ui.Error("Unable to create deploy targets: %v", err)
+					return
+				}
+				for _, target := range targets {
+					if target.Name == appName {
+						targetConfig = &target
+						server = target.Server
+						break
+					}
+				}
+				if server == "" {
+					ui.Error("No target in the config deploys '%s', use --server to export it from a server", appName)
+					return
+				}
+			}
+
+			if outputFlag != "-" && !forceFlag {
+				if _, err := os.Stat(outputFlag); err == nil {
+					ui.Error("%s already exists, use --force to overwrite it or --output to write to another file", outputFlag)
+					return
+				} else if !errors.Is(err, os.ErrNotExist) {
+					ui.Error("%v", err)
+					return
+				}
+			}
+
+			token, err := getToken(targetConfig, server)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			api, err := apiclient.New(server, token)
+			if err != nil {
+				ui.Error("Failed to create API client: %v", err)
+				return
+			}
+
+			path := fmt.Sprintf("export/%s", appName)
+			if includeValuesFlag {
+				path += "?values=true"
+			}
+			var response apitypes.ExportResponse
+			if err := api.Get(ctx, path, &response); err != nil {
+				ui.Error("Failed to export %s: %v", appName, err)
+				return
+			}
+
+			data, err := yaml.Marshal(response.AppConfig)
+			if err != nil {
+				ui.Error("Failed to convert the config to YAML: %v", err)
+				return
+			}
+			data = append([]byte(fmt.Sprintf("# Exported from deployment %s of %s on %s\n", response.DeploymentID, appName, server)), data...)
+
+			if outputFlag == "-" {
+				fmt.Print(string(data))
+				return
+			}
+			if err := os.WriteFile(outputFlag, data, 0o600); err != nil {
+				ui.Error("Failed to write %s: %v", outputFlag, err)
+				return
+			}
+
+			ui.Success("Exported deployment %s of %s to %s", response.DeploymentID, appName, outputFlag)
+			if response.Resolved {
+				ui.Warn("%s is deployed without image history, the config was exported from the resolved deployment and has no secret provider references", appName)
+			}
+			if response.AppConfig.HasMaskedValues() {
+				ui.Warn("Secret values are masked as %s, replace them before importing", config.MaskedValue)
+			}
+			if image := response.AppConfig.Image; image != nil && image.ShouldBuild() {
+				ui.Warn("The image is built from source, its build context is relative to %s", outputFlag)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Find the app in specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Find the app in all targets")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL (overrides config)")
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "haloy.yaml", "File to write the config to, - for stdout")
+	cmd.Flags().BoolVar(&includeValuesFlag, "include-values", false, "Include literal secret values instead of masking them")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, "Overwrite the output file if it exists")
+
+	return cmd
+}
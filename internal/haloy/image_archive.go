@@ -0,0 +1,150 @@
+package haloy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/ameistad/haloy/internal/config"
+)
+
+// imageArchive describes an archive created by docker save.
+type imageArchive struct {
+	path string
+	// layers are the paths of the layer files in the archive and diffIDs their diff IDs, base layer first.
+	layers  []string
+	diffIDs []string
+}
+
+// readImageArchive reads the manifest and image config of a single image archive.
+func readImageArchive(path string) (imageArchive, error) {
+	archive := imageArchive{path: path}
+
+	var manifest []struct {
+		Config string
+		Layers []string
+	}
+	if err := readArchiveJSON(path, "manifest.json", &manifest); err != nil {
+		return archive, err
+	}
+	if len(manifest) != 1 {
+		return archive, fmt.Errorf("expected one image in archive, found %d", len(manifest))
+	}
+
+	var imageConfig struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := readArchiveJSON(path, manifest[0].Config, &imageConfig); err != nil {
+		return archive, err
+	}
+	if len(imageConfig.RootFS.DiffIDs) != len(manifest[0].Layers) {
+		return archive, fmt.Errorf("image config has %d layers, manifest has %d", len(imageConfig.RootFS.DiffIDs), len(manifest[0].Layers))
+	}
+
+	archive.layers = manifest[0].Layers
+	archive.diffIDs = imageConfig.RootFS.DiffIDs
+	return archive, nil
+}
+
+func readArchiveJSON(path, name string, v any) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open image archive: %w", err)
+	}
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s not found in image archive", name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image archive: %w", err)
+		}
+		if header.Name == name {
+			if err := json.NewDecoder(reader).Decode(v); err != nil {
+				return fmt.Errorf("failed to parse %s in image archive: %w", name, err)
+			}
+			return nil
+		}
+	}
+}
+
+// writeWithoutLayers copies the archive to w, leaving out the files of the first skip layers.
+// docker load doesn't read layer files for layers it already has.
+func (a imageArchive) writeWithoutLayers(skip int, w io.Writer) error {
+	skipped := make(map[string]struct{}, skip)
+	for _, layer := range a.layers[:skip] {
+		skipped[layer] = struct{}{}
+	}
+	// Layer files can be shared, keep the ones still needed by a later layer.
+	for _, layer := range a.layers[skip:] {
+		delete(skipped, layer)
+	}
+
+	file, err := os.Open(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to open image archive: %w", err)
+	}
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+	writer := tar.NewWriter(w)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image archive: %w", err)
+		}
+		if _, ok := skipped[header.Name]; ok {
+			continue
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+		if _, err := io.Copy(writer, reader); err != nil {
+			return fmt.Errorf("failed to write image archive: %w", err)
+		}
+	}
+	return writer.Close()
+}
+
+// compressArchive writes src to w with the given compression.
+func compressArchive(ctx context.Context, src io.Reader, compression config.UploadCompression, w io.Writer) error {
+	switch compression {
+	case config.UploadCompressionNone:
+		_, err := io.Copy(w, src)
+		return err
+
+	case config.UploadCompressionZstd:
+		if _, err := exec.LookPath("zstd"); err != nil {
+			return fmt.Errorf("zstd compression requires the zstd command: %w", err)
+		}
+		compress := exec.CommandContext(ctx, "zstd", "-q", "-T0", "-c")
+		compress.Stdin = src
+		compress.Stdout = w
+		compress.Stderr = os.Stderr
+		if err := compress.Run(); err != nil {
+			return fmt.Errorf("zstd failed: %w", err)
+		}
+		return nil
+
+	default:
+		gzipWriter := gzip.NewWriter(w)
+		if _, err := io.Copy(gzipWriter, src); err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	}
+}
@@ -0,0 +1,109 @@
+package haloy
+
+import (
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func ImportCmd() *cobra.Command {
+	var serverFlag string
+	var noLogsFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Deploy an app exported with 'haloy export' to a server",
+		Long: `Re-create an app from a config exported with 'haloy export', e.g. to move it to a new server.
+The config is deployed as it is, on the server given with --server instead of the one it was exported from.
+
+Masked secret values must be replaced with the values or secret provider references before importing.
+References to secrets imported to the server with 'haloy secrets import' are resolved by the server.`,
+		Example: "  haloy export my-app --server old.example.com -o my-app.yaml\n  haloy import my-app.yaml --server new.example.com",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			configPath := args[0]
+
+			rawAppConfig, err := appconfigloader.Load(ctx, configPath, nil, false)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if len(rawAppConfig.Targets) > 0 {
+				ui.Error("%s has multiple targets, import takes a config exported with 'haloy export'", configPath)
+				return
+			}
+			if serverFlag != "" {
+				// The token of the server the config was exported from doesn't work on the new server.
+				rawAppConfig.Server = serverFlag
+				rawAppConfig.APIToken = nil
+			}
+			if rawAppConfig.HasMaskedValues() {
+				ui.Error("%s has masked values (%s), replace them with the values or secret provider references before importing", configPath, config.MaskedValue)
+				return
+			}
+
+			rawTargets, err := appconfigloader.ExtractTargets(rawAppConfig)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			// Secrets imported to the server with 'haloy secrets import' are resolved by the server.
+			var imported map[string]bool
+			if len(rawAppConfig.SecretReferences()) > 0 {
+				imported, err = importedSecrets(ctx, &rawAppConfig.TargetConfig, rawAppConfig.Server)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+			}
+			resolvedAppConfig, err := appconfigloader.ResolveSecretsExcept(ctx, rawAppConfig, imported)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			resolvedTargets, err := appconfigloader.ExtractTargets(resolvedAppConfig)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			progress := ui.NewStepProgress("", false)
+			if err := buildAndPublishImages(ctx, resolvedTargets, configPath, progress); err != nil {
+				progress.Finish(err)
+				ui.Error("%v", err)
+				return
+			}
+			progress.Finish(nil)
+
+			for targetName, resolvedTarget := range resolvedTargets {
+				ui.Info("Importing %s to %s", resolvedTarget.Name, resolvedTarget.Server)
+				rollbackAppConfig := config.AppConfig{
+					TargetConfig:    rawTargets[targetName],
+					SecretProviders: rawAppConfig.SecretProviders,
+				}
+				timings := deployTarget(
+					ctx,
+					resolvedTarget,
+					rollbackAppConfig,
+					configPath,
+					"",
+					noLogsFlag,
+					false,
+					false,
+					ui.IsInteractive(),
+					nil,
+				)
+				if !noLogsFlag {
+					ui.PrintStepTimings(progress.Timings(), map[string][]ui.StepTiming{targetName: timings})
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL to import the app to (default: the server in the file)")
+	cmd.Flags().BoolVar(&noLogsFlag, "no-logs", false, "Don't stream deployment logs")
+
+	return cmd
+}
@@ -0,0 +1,176 @@
+package haloy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/charmbracelet/x/term"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/spf13/cobra"
+)
+
+func LoginCmd() *cobra.Command {
+	var ttlFlag string
+	var ssoFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "login <server>",
+		Short: "Log in to a server with a short-lived session token",
+		Long: `Exchange the API token of a server for a session token and store only the session token, so the API
+token doesn't have to be kept on this machine. The API token is read from the prompt, or from stdin when it's
+not a terminal, e.g. 'echo $TOKEN | haloy login haloy.example.com'.
+
+Sessions are valid for 1h by default, log in again when one expired.
+
+With --sso you sign in with the OIDC provider of the server in the browser instead, and the ID token it issues
+is stored. It's valid as long as the provider issued it for, usually 1h.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			normalizedURL, err := helpers.NormalizeServerURL(args[0])
+			if err != nil {
+				ui.Error("Invalid URL: %v", err)
+				return
+			}
+			if err := helpers.IsValidDomain(normalizedURL); err != nil {
+				ui.Error("Invalid domain: %v", err)
+				return
+			}
+
+			if ssoFlag {
+				token, expiresAt, err := loginWithSSO(ctx, normalizedURL)
+				if err != nil {
+					ui.Error("Failed to sign in to %s: %v", normalizedURL, err)
+					return
+				}
+				tokenEnv, err := storeServerToken(normalizedURL, token, true)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				ui.Success("Signed in to %s until %s", normalizedURL, helpers.FormatTime(expiresAt))
+				ui.Info("ID token stored as: %s", tokenEnv)
+				return
+			}
+
+			apiToken, err := readAPIToken()
+			if err != nil {
+				ui.Error("Failed to read API token: %v", err)
+				return
+			}
+			if apiToken == "" {
+				ui.Error("Token is required")
+				return
+			}
+
+			api, err := apiclient.New(normalizedURL, apiToken)
+			if err != nil {
+				ui.Error("Failed to create API client: %v", err)
+				return
+			}
+			var response apitypes.SessionResponse
+			if err := api.Post(ctx, "sessions", apitypes.SessionRequest{TTL: ttlFlag}, &response); err != nil {
+				ui.Error("Failed to log in to %s: %v", normalizedURL, err)
+				return
+			}
+
+			tokenEnv, err := storeServerToken(normalizedURL, response.Token, true)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			ui.Success("Logged in to %s until %s", normalizedURL, helpers.FormatTime(response.ExpiresAt))
+			ui.Info("Session token stored as: %s", tokenEnv)
+		},
+	}
+
+	cmd.Flags().StringVar(&ttlFlag, "ttl", "", "How long the session is valid, e.g. 8h (default 1h, at most 24h)")
+	cmd.Flags().BoolVar(&ssoFlag, "sso", false, "Sign in with the OIDC provider of the server in the browser")
+	cmd.MarkFlagsMutuallyExclusive("sso", "ttl")
+
+	return cmd
+}
+
+// readAPIToken prompts for the API token without echoing it, or reads it from stdin when it's not a terminal.
+func readAPIToken() (string, error) {
+	if term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprint(os.Stderr, "API token: ")
+		token, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// loginWithSSO signs in with the OIDC provider of the server. The browser is sent back to a listener on the
+// loopback address with the ID token.
+func loginWithSSO(ctx context.Context, normalizedURL string) (string, time.Time, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to listen for the sign-in callback: %w", err)
+	}
+	defer listener.Close()
+
+	tokens := make(chan string, 1)
+	server := &http.Server{
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get("token")
+			if r.URL.Path != "/callback" || token == "" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintln(w, "Signed in, you can close this window and return to the terminal.")
+			select {
+			case tokens <- token:
+			default:
+			}
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	redirectURI := fmt.Sprintf("http://%s/callback", listener.Addr())
+	loginURL := helpers.BuildServerURL(normalizedURL) + "/v1/oidc/login?" + url.Values{"redirect_uri": {redirectURI}}.Encode()
+	ui.Info("Open this URL in your browser to sign in:")
+	ui.Basic("  %s", loginURL)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	var token string
+	select {
+	case token = <-tokens:
+	case <-ctx.Done():
+		return "", time.Time{}, fmt.Errorf("timed out waiting for the sign-in")
+	}
+
+	// haloyd verified the token before sending it, the expiry is only read to show it.
+	var claims jwt.Claims
+	parsed, err := jwt.ParseSigned(token, []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.ES256, jose.ES384, jose.ES512, jose.PS256, jose.EdDSA})
+	if err != nil || parsed.UnsafeClaimsWithoutVerification(&claims) != nil || claims.Expiry == nil {
+		return "", time.Time{}, fmt.Errorf("the server returned an invalid ID token")
+	}
+	return token, claims.Expiry.Time(), nil
+}
@@ -3,12 +3,21 @@ package haloy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 
 	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/appconfigloader"
 	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/logging"
 	"github.com/ameistad/haloy/internal/ui"
 	"github.com/spf13/cobra"
@@ -16,17 +25,23 @@ import (
 
 func LogsCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 	var serverFlag string
+	var deploymentFlag string
 
 	cmd := &cobra.Command{
 		Use:   "logs",
 		Short: "Stream logs from haloy server",
 		Long: `Stream all logs from haloy server in real-time.
 
-The logs are streamed in real-time and will continue until interrupted (Ctrl+C).`,
+The logs are streamed in real-time and will continue until interrupted (Ctrl+C).
+With --deployment the stored logs of a deployment are shown instead, also after it finished.`,
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, _ []string) {
 			ctx := cmd.Context()
 			if serverFlag != "" {
+				if deploymentFlag != "" {
+					showDeploymentLogs(ctx, map[string]*config.TargetConfig{serverFlag: nil}, deploymentFlag)
+					return
+				}
 				streamLogs(ctx, nil, serverFlag)
 			} else {
 				rawAppConfig, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
@@ -43,6 +58,16 @@ The logs are streamed in real-time and will continue until interrupted (Ctrl+C).
 
 				servers := appconfigloader.TargetsByServer(targets)
 
+				if deploymentFlag != "" {
+					targetsByServer := make(map[string]*config.TargetConfig, len(servers))
+					for server, targetNames := range servers {
+						target := targets[targetNames[0]]
+						targetsByServer[server] = &target
+					}
+					showDeploymentLogs(ctx, targetsByServer, deploymentFlag)
+					return
+				}
+
 				var wg sync.WaitGroup
 				for server, targetNames := range servers {
 					targetConfig, exists := targets[targetNames[0]]
@@ -64,6 +89,7 @@ The logs are streamed in real-time and will continue until interrupted (Ctrl+C).
 
 	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
 	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL")
+	cmd.Flags().StringVar(&deploymentFlag, "deployment", "", "Show the stored logs of a deployment instead of streaming")
 	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Show logs for specific targets (comma-separated)")
 	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Show all target logs")
 
@@ -101,3 +127,82 @@ func streamLogs(ctx context.Context, targetConfig *config.TargetConfig, targetSe
 	}
 	return api.Stream(ctx, "logs", streamHandler)
 }
+
+// showDeploymentLogs prints the stored logs of a deployment from the first server that has them.
+func showDeploymentLogs(ctx context.Context, servers map[string]*config.TargetConfig, deploymentID string) {
+	for _, server := range slices.Sorted(maps.Keys(servers)) {
+		token, err := getToken(servers[server], server)
+		if err != nil {
+			ui.Error("%v", err)
+			return
+		}
+		api, err := apiclient.New(server, token)
+		if err != nil {
+			ui.Error("Failed to create API client: %v", err)
+			return
+		}
+
+		var response apitypes.DeploymentLogsResponse
+		if err := api.Get(ctx, fmt.Sprintf("deploy/%s/logs/history", deploymentID), &response); err != nil {
+			// The deployment may be on another server of the config.
+			var apiErr *apiclient.APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && len(servers) > 1 {
+				continue
+			}
+			ui.Error("Failed to get logs of deployment %s: %v", deploymentID, err)
+			return
+		}
+
+		for _, entry := range response.Entries {
+			ui.DisplayLogEntry(entry, "")
+		}
+		return
+	}
+	ui.Error("No logs found for deployment %s on %d servers", deploymentID, len(servers))
+}
+
+var logFileExts = map[string]string{
+	apitypes.LogFormatText:   ".log",
+	apitypes.LogFormatNDJSON: ".ndjson",
+	apitypes.LogFormatJSON:   ".json",
+}
+
+// logArtifact writes the full log of deployments to files in a directory, e.g. for CI artifacts or incident tickets.
+type logArtifact struct {
+	dir    string
+	format string
+}
+
+// newLogArtifact returns nil when dir is empty.
+func newLogArtifact(dir, format string) (*logArtifact, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, ok := logFileExts[format]; !ok {
+		return nil, fmt.Errorf("invalid log format '%s', must be %s, %s or %s", format, apitypes.LogFormatText, apitypes.LogFormatNDJSON, apitypes.LogFormatJSON)
+	}
+	if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return &logArtifact{dir: dir, format: format}, nil
+}
+
+// save downloads the log of the deployment and returns the path of the file it was written to.
+func (a *logArtifact) save(ctx context.Context, api *apiclient.APIClient, appName, deploymentID string) (string, error) {
+	body, err := api.Download(ctx, fmt.Sprintf("deploy/%s/logs/download?format=%s", deploymentID, a.format))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	path := filepath.Join(a.dir, fmt.Sprintf("%s-%s%s", appName, deploymentID, logFileExts[a.format]))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, file.Close()
+}
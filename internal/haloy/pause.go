@@ -0,0 +1,138 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func PauseAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var selectorFlag string
+	var parallelFlag int
+
+	cmd := &cobra.Command{
+		Use:   "pause [app-pattern]",
+		Short: "Pause an application, keeping its domains and config",
+		Long: `Stop the containers of an application while keeping its certificates, domains and deployment.
+Requests to the domains get a maintenance page until the app is started again with 'haloy resume'
+or deployed again.
+
+Unlike 'haloy stop', a paused app is never restarted by haloyd and is brought back with a single command.`,
+		Example: "  haloy pause\n  haloy pause 'team-a-*' --server haloy.example.com",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			selector, err := newAppSelector(pattern, selectorFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			var apps []selectedApp
+			if selector.isEmpty() {
+				apps, err = configApps(ctx, *configPath, flags)
+			} else {
+				apps, err = selectApps(ctx, *configPath, flags, serverFlag, selector)
+			}
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if len(apps) == 0 {
+				ui.Warn("No apps match the selector")
+				return
+			}
+
+			runBulk(ctx, apps, parallelFlag, pauseApp)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL to select apps on (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Pause app on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Pause app on all targets")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Pause apps with labels, e.g. env=staging,team=payments")
+	cmd.Flags().IntVarP(&parallelFlag, "parallel", "p", defaultBulkParallelism, "Number of apps to pause at the same time")
+
+	return cmd
+}
+
+func ResumeAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var selectorFlag string
+	var parallelFlag int
+
+	cmd := &cobra.Command{
+		Use:   "resume [app-pattern]",
+		Short: "Resume a paused application",
+		Long: `Start the containers of an application paused with 'haloy pause'. HAProxy routes the domains to the
+containers again once they pass their health check.`,
+		Example: "  haloy resume\n  haloy resume 'team-a-*' --server haloy.example.com",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			selector, err := newAppSelector(pattern, selectorFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			var apps []selectedApp
+			if selector.isEmpty() {
+				apps, err = configApps(ctx, *configPath, flags)
+			} else {
+				apps, err = selectApps(ctx, *configPath, flags, serverFlag, selector)
+			}
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if len(apps) == 0 {
+				ui.Warn("No apps match the selector")
+				return
+			}
+
+			runBulk(ctx, apps, parallelFlag, resumeApp)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL to select apps on (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Resume app on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Resume app on all targets")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Resume apps with labels, e.g. env=staging,team=payments")
+	cmd.Flags().IntVarP(&parallelFlag, "parallel", "p", defaultBulkParallelism, "Number of apps to resume at the same time")
+
+	return cmd
+}
+
+func pauseApp(ctx context.Context, api *apiclient.APIClient, app selectedApp) (string, error) {
+	var response apitypes.PauseAppResponse
+	if err := api.Post(ctx, fmt.Sprintf("pause/%s", app.name), nil, &response); err != nil {
+		return "", err
+	}
+	return response.Message, nil
+}
+
+func resumeApp(ctx context.Context, api *apiclient.APIClient, app selectedApp) (string, error) {
+	var response apitypes.PauseAppResponse
+	if err := api.Post(ctx, fmt.Sprintf("resume/%s", app.name), nil, &response); err != nil {
+		return "", err
+	}
+	return response.Message, nil
+}
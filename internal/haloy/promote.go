@@ -0,0 +1,196 @@
+package haloy
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// Annotations added to promoted deployments.
+const (
+	AnnotationPromotedFrom       = "promoted.from"
+	AnnotationPromotedDeployment = "promoted.deployment"
+)
+
+func PromoteCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var fromFlag string
+	var toFlag string
+	var noLogsFlag bool
+	var ignoreFreezeFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "promote [app]",
+		Short: "Promote the deployed image of one target to another",
+		Long: `Deploy the exact image running on the --from target to the --to target, without building the image or resolving its tag again.
+
+The image is pinned by its registry digest, so the same artifact moves through environments.
+Images uploaded to the server have no registry digest and can only be promoted between targets on the same server.`,
+		Example: "  haloy promote my-app --from staging --to production",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			if fromFlag == "" || toFlag == "" {
+				ui.Error("Both --from and --to targets are required")
+				return
+			}
+			if fromFlag == toFlag {
+				ui.Error("--from and --to must be different targets")
+				return
+			}
+
+			rawAppConfig, err := appconfigloader.Load(ctx, *configPath, []string{fromFlag, toFlag}, false)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			rawTargets, err := appconfigloader.ExtractTargets(rawAppConfig)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			resolvedAppConfig, err := appconfigloader.ResolveSecrets(ctx, rawAppConfig)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			resolvedTargets, err := appconfigloader.ExtractTargets(resolvedAppConfig)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			fromTarget := resolvedTargets[fromFlag]
+			if len(args) == 1 && args[0] != fromTarget.Name {
+				ui.Error("Target '%s' deploys '%s', not '%s'", fromFlag, fromTarget.Name, args[0])
+				return
+			}
+
+			token, err := getToken(&fromTarget, fromTarget.Server)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			api, err := apiclient.New(fromTarget.Server, token)
+			if err != nil {
+				ui.Error("Failed to create API client: %v", err)
+				return
+			}
+			var status apitypes.AppStatusResponse
+			if err := api.Get(ctx, fmt.Sprintf("status/%s", fromTarget.Name), &status); err != nil {
+				ui.Error("Failed to get the deployment of %s on %s: %v", fromTarget.Name, fromFlag, err)
+				return
+			}
+
+			rawToTarget := rawTargets[toFlag]
+			resolvedToTarget := resolvedTargets[toFlag]
+			image, err := promotedImage(resolvedToTarget.Image, fromTarget.Server, resolvedToTarget.Server, status)
+			if err != nil {
+				ui.Error("Unable to promote %s: %v", fromTarget.Name, err)
+				return
+			}
+
+			annotations := maps.Clone(status.Annotations)
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[AnnotationPromotedFrom] = fromFlag
+			annotations[AnnotationPromotedDeployment] = status.DeploymentID
+
+			// The image of the raw target keeps its registry credentials unresolved for rollbacks.
+			rawImage := *image
+			if image.RegistryAuth != nil && rawToTarget.Image != nil {
+				rawImage.RegistryAuth = rawToTarget.Image.RegistryAuth
+			}
+			rawToTarget.Image = &rawImage
+			rawToTarget.Annotations = annotations
+			resolvedToTarget.Image = image
+			resolvedToTarget.Annotations = annotations
+
+			ui.Info("Promoting deployment %s of %s on %s to %s: %s", status.DeploymentID, fromTarget.Name, fromFlag, toFlag, image.ImageRef())
+
+			rollbackAppConfig := config.AppConfig{
+				TargetConfig:    rawToTarget,
+				SecretProviders: rawAppConfig.SecretProviders,
+			}
+			timings := deployTarget(
+				ctx,
+				resolvedToTarget,
+				rollbackAppConfig,
+				*configPath,
+				"",
+				noLogsFlag,
+				false,
+				ignoreFreezeFlag,
+				ui.IsInteractive(),
+				nil,
+			)
+			if !noLogsFlag {
+				ui.PrintStepTimings(nil, map[string][]ui.StepTiming{toFlag: timings})
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVar(&fromFlag, "from", "", "Target to take the deployed image from")
+	cmd.Flags().StringVar(&toFlag, "to", "", "Target to deploy the image to")
+	cmd.Flags().BoolVar(&noLogsFlag, "no-logs", false, "Don't stream deployment logs")
+	cmd.Flags().BoolVar(&ignoreFreezeFlag, "ignore-freeze", false, "Deploy during a freeze window of the server")
+
+	return cmd
+}
+
+// promotedImage returns the image of the target pinned to the image of the deployment in status.
+// A registry digest is used when there is one, otherwise the image ID, which only exists on the same server.
+func promotedImage(image *config.Image, fromServer, toServer string, status apitypes.AppStatusResponse) (*config.Image, error) {
+	promoted := config.Image{}
+	if image != nil {
+		promoted = *image
+	}
+	build := false
+	promoted.Build = &build
+	promoted.BuildConfig = nil
+	promoted.Tag = ""
+
+	if digest := matchingRepoDigest(promoted.Repository, status.RepoDigests); digest != "" {
+		promoted.Repository = digest
+		return &promoted, nil
+	}
+
+	if status.ImageID == "" {
+		return nil, fmt.Errorf("the server didn't report the image of deployment %s, upgrade haloyd", status.DeploymentID)
+	}
+	if fromServer != toServer {
+		return nil, fmt.Errorf("image %s of deployment %s has no registry digest, images uploaded to the server can only be promoted to targets on the same server", status.ImageID, status.DeploymentID)
+	}
+	promoted.Repository = status.ImageID
+	promoted.RegistryAuth = nil
+	return &promoted, nil
+}
+
+// matchingRepoDigest returns the digest of the repository, or the first digest when none match.
+func matchingRepoDigest(repository string, repoDigests []string) string {
+	name, _, _ := strings.Cut(repository, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	for _, digest := range repoDigests {
+		if strings.HasPrefix(digest, name+"@") {
+			return digest
+		}
+	}
+	if len(repoDigests) > 0 {
+		return repoDigests[0]
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func RestartAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var selectorFlag string
+	var parallelFlag int
+
+	cmd := &cobra.Command{
+		Use:   "restart [app-pattern]",
+		Short: "Restart an application's containers",
+		Long: `Restart the containers of the current deployment of an application, one replica at a time.
+
+Without arguments the apps of the targets in the config are restarted. With a glob pattern, e.g. 'team-a-*',
+or a label selector, e.g. --selector env=staging, all matching apps on the servers are restarted.`,
+		Example: "  haloy restart\n  haloy restart 'team-a-*'\n  haloy restart --selector env=staging --server haloy.example.com",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			selector, err := newAppSelector(pattern, selectorFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			var apps []selectedApp
+			if selector.isEmpty() {
+				apps, err = configApps(ctx, *configPath, flags)
+			} else {
+				apps, err = selectApps(ctx, *configPath, flags, serverFlag, selector)
+			}
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			if len(apps) == 0 {
+				ui.Warn("No apps match the selector")
+				return
+			}
+
+			runBulk(ctx, apps, parallelFlag, restartApp)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL to select apps on (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Restart app on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Restart app on all targets")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Restart apps with labels, e.g. env=staging,team=payments")
+	cmd.Flags().IntVarP(&parallelFlag, "parallel", "p", defaultBulkParallelism, "Number of apps to restart at the same time")
+
+	return cmd
+}
+
+func restartApp(ctx context.Context, api *apiclient.APIClient, app selectedApp) (string, error) {
+	var response apitypes.RestartAppResponse
+	if err := api.Post(ctx, fmt.Sprintf("restart/%s", app.name), nil, &response); err != nil {
+		return "", err
+	}
+	return response.Message, nil
+}
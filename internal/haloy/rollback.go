@@ -44,8 +44,6 @@ Use 'haloy rollback-targets' to list available deployment IDs.`,
 				return
 			}
 
-			newDeploymentID := createDeploymentID()
-
 			servers := appconfigloader.TargetsByServer(targets)
 
 			var wg sync.WaitGroup
@@ -90,28 +88,41 @@ Use 'haloy rollback-targets' to list available deployment IDs.`,
 							ui.Error("Unable to find configuration for rollback")
 							return
 						}
-						newResolvedAppConfig, err := appconfigloader.ResolveSecrets(ctx, *availableTarget.RawAppConfig)
-						if err != nil {
-							ui.Error("Unable to resolve secrets for the app config. This usually occurs when secrets names have been changed or deleted between deployments: %v", err)
-							return
+						// haloyd rolls back to its stored config of the deployment when it has one, so secrets
+						// only have to be resolved for deployments made before it stored them.
+						newResolvedAppConfig := *availableTarget.RawAppConfig
+						if !availableTarget.HasSpec {
+							newResolvedAppConfig, err = appconfigloader.ResolveSecrets(ctx, *availableTarget.RawAppConfig)
+							if err != nil {
+								ui.Error("Unable to resolve secrets for the app config. This usually occurs when secrets names have been changed or deleted between deployments: %v", err)
+								return
+							}
 						}
-						newResolvedTargetConfig, err := appconfigloader.MergeToTarget(newResolvedAppConfig, config.TargetConfig{}, newResolvedAppConfig.Name)
+						newResolvedTargetConfig, err := appconfigloader.MergeToTarget(newResolvedAppConfig, config.TargetConfig{}, newResolvedAppConfig.TargetConfig.TargetName)
 						if err != nil {
 							ui.Error("Failed to merge to target")
 							return
 						}
 						request := apitypes.RollbackRequest{
 							TargetDeploymentID: targetDeploymentID,
-							NewDeploymentID:    newDeploymentID,
 							NewTargetConfig:    newResolvedTargetConfig,
 						}
-						if err := api.Post(ctx, "rollback", request, nil); err != nil {
+						var response apitypes.RollbackResponse
+						if err := api.Post(ctx, "rollback", request, &response); err != nil {
 							ui.Error("Rollback failed: %v", err)
+							if hint := errorHint(err); hint != "" {
+								ui.Info("%s", hint)
+							}
+							return
+						}
+						if response.PendingAction != nil {
+							printPendingAction(response.PendingAction)
 							return
 						}
 
-						if !noLogsFlag {
-							streamPath := fmt.Sprintf("deploy/%s/logs", newDeploymentID)
+						// Older servers don't return the ID of the rollback.
+						if !noLogsFlag && response.DeploymentID != "" {
+							streamPath := fmt.Sprintf("deploy/%s/logs", response.DeploymentID)
 
 							streamHandler := func(data string) bool {
 								var logEntry logging.LogEntry
@@ -236,7 +247,7 @@ func displayRollbackTargets(appName string, rollbackTargets []deploytypes.Rollba
 	}
 	ui.Info("%s", header)
 
-	headers := []string{"DEPLOYMENT ID", "IMAGE REFERENCE", "DATE", "STATUS"}
+	headers := []string{"DEPLOYMENT ID", "IMAGE REFERENCE", "DATE", "ANNOTATIONS", "STATUS"}
 	rows := make([][]string, 0, len(rollbackTargets))
 
 	for _, rollbackTarget := range rollbackTargets {
@@ -251,10 +262,16 @@ func displayRollbackTargets(appName string, rollbackTargets []deploytypes.Rollba
 			status = "🟢 CURRENT"
 		}
 
+		annotations := ""
+		if rollbackTarget.RawAppConfig != nil {
+			annotations = formatAnnotations(rollbackTarget.RawAppConfig.Annotations)
+		}
+
 		rows = append(rows, []string{
 			rollbackTarget.DeploymentID,
 			rollbackTarget.ImageRef,
 			date,
+			annotations,
 			status,
 		})
 	}
@@ -18,12 +18,22 @@ type appCmdFlags struct {
 
 // Commands that support target flags and need validation
 var targetFlagCommands = []string{
+	"apps",
+	"cp",
 	"deploy",
+	"diff",
+	"export",
+	"start", // haloy ab start
 	"status",
 	"stop",
+	"list", // haloy secrets list
 	"logs",
+	"pause",
+	"restart",
+	"resume",
 	"rollback",
 	"rollback-targets",
+	"tui",
 	"validate-config",
 }
 
@@ -51,7 +61,7 @@ func NewRootCmd() *cobra.Command {
 			}
 			config.LoadEnvFiles(appFlags.targets) // load environment variables in .env for all commands.
 
-			if cmd.Name() == "completion" || cmd.Parent().Name() == "server" {
+			if cmd.Name() == "completion" || cmd.Parent().Name() == "server" || cmd.Parent().Name() == "build-agent" {
 				return
 			}
 
@@ -67,18 +77,36 @@ func NewRootCmd() *cobra.Command {
 	validateCmd.Flags().StringVarP(&appFlags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
 
 	cmd.AddCommand(
+		ABCmd(&resolvedConfigPath, appFlags),
+		ApplyCmd(),
+		AppsCmd(&resolvedConfigPath, appFlags),
+		ApproveCmd(&resolvedConfigPath, appFlags),
+		ConfigCmd(&resolvedConfigPath, appFlags),
+		ConfirmCmd(&resolvedConfigPath, appFlags),
+		CopyCmd(&resolvedConfigPath, appFlags),
 		DeployAppCmd(&resolvedConfigPath, appFlags),
+		DiffCmd(&resolvedConfigPath, appFlags),
+		ExportCmd(&resolvedConfigPath, appFlags),
+		ImportCmd(),
+		PauseAppCmd(&resolvedConfigPath, appFlags),
+		RestartAppCmd(&resolvedConfigPath, appFlags),
+		ResumeAppCmd(&resolvedConfigPath, appFlags),
 		RollbackTargetsCmd(&resolvedConfigPath, appFlags),
 		RollbackAppCmd(&resolvedConfigPath, appFlags),
+		SecretsCmd(&resolvedConfigPath, appFlags),
 		LogsCmd(&resolvedConfigPath, appFlags),
+		PromoteCmd(&resolvedConfigPath, appFlags),
 		StatusAppCmd(&resolvedConfigPath, appFlags),
 		StopAppCmd(&resolvedConfigPath, appFlags),
+		TuiCmd(&resolvedConfigPath, appFlags),
 		VersionCmd(&resolvedConfigPath, appFlags),
 
 		validateCmd,
 
 		CompletionCmd(),
+		LoginCmd(),
 		ServerCmd(),
+		BuildAgentCmd(),
 	)
 
 	return cmd
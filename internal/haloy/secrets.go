@@ -0,0 +1,290 @@
+package haloy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/serverkey"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func SecretsCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Show and move the secrets used by deployed apps",
+		Long: `Show the secret provider references, e.g. onepassword:prod.db-password, used by the apps on the servers,
+and move their values to another server with export and import.`,
+	}
+
+	cmd.AddCommand(SecretsListCmd(configPath, flags))
+	cmd.AddCommand(SecretsExportCmd())
+	cmd.AddCommand(SecretsImportCmd())
+
+	return cmd
+}
+
+func SecretsListCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var serverFlag string
+	var usageFlag bool
+	var unusedDaysFlag int
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the secrets referenced by deployments",
+		Long: `List the secret provider references used by the deployments in the history on the servers of the
+targets in the config, or on the server given with --server.
+
+With --usage the apps and deployments using each secret are shown, and secrets that no current deployment
+has used for --unused-days are flagged as stale. Only deployments kept in the image history are counted.`,
+		Example: "  haloy secrets list\n  haloy secrets list --usage --unused-days 90 --server haloy.example.com",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			ctx := cmd.Context()
+
+			servers, err := selectServers(ctx, *configPath, flags, serverFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			var rows [][]string
+			stale := 0
+			for _, server := range slices.Sorted(maps.Keys(servers)) {
+				api, err := bulkClient(selectedApp{server: server, targetConfig: servers[server]})
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				var response apitypes.SecretsResponse
+				if err := api.Get(ctx, "secrets", &response); err != nil {
+					ui.Error("Failed to list secrets on %s: %v", server, err)
+					return
+				}
+
+				for _, secret := range response.Secrets {
+					if !usageFlag {
+						rows = append(rows, []string{secret.Name, server, strings.Join(secretApps(secret, true), ", ")})
+						continue
+					}
+
+					status := "in use"
+					if secret.UnusedSince != nil {
+						unusedDays := int(time.Since(*secret.UnusedSince).Hours() / 24)
+						status = fmt.Sprintf("unused for %d days", unusedDays)
+						if unusedDays >= unusedDaysFlag {
+							status += " (stale)"
+							stale++
+						}
+					}
+					rows = append(rows, []string{
+						secret.Name,
+						server,
+						strings.Join(secretApps(secret, false), ", "),
+						strconv.Itoa(len(secret.Consumers)),
+						helpers.FormatTime(secret.LastUsed),
+						status,
+					})
+				}
+			}
+
+			if len(rows) == 0 {
+				ui.Info("No secrets found")
+				return
+			}
+			if !usageFlag {
+				ui.Table([]string{"SECRET", "SERVER", "APPS"}, rows)
+				return
+			}
+			ui.Table([]string{"SECRET", "SERVER", "APPS", "DEPLOYMENTS", "LAST USED", "STATUS"}, rows)
+			if stale > 0 {
+				ui.Warn("%d secret(s) not used by a current deployment for %d days or more, they can likely be removed", stale, unusedDaysFlag)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL (overrides config)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "List secrets on the servers of specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "List secrets on the servers of all targets")
+	cmd.Flags().BoolVar(&usageFlag, "usage", false, "Show the apps and deployments using each secret and flag stale secrets")
+	cmd.Flags().IntVar(&unusedDaysFlag, "unused-days", 30, "Flag secrets unused for this many days as stale (with --usage)")
+
+	return cmd
+}
+
+func SecretsExportCmd() *cobra.Command {
+	var serverFlag string
+	var outputFlag string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the secret values of the deployed apps on a server",
+		Long: `Write the values of the secret provider references used by the current deployments on a server, and of
+the secrets imported to it, as JSON for 'haloy secrets import'. The values are in plain text, pipe them
+straight to 'haloy secrets import', which encrypts them to the key of the destination server.`,
+		Example: "  haloy secrets export --server old.example.com | haloy secrets import --server new.example.com",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			ctx := cmd.Context()
+
+			api, err := bulkClient(selectedApp{server: serverFlag})
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			var response apitypes.SecretsExportResponse
+			if err := api.Get(ctx, "secrets/export", &response); err != nil {
+				ui.Error("Failed to export secrets from %s: %v", serverFlag, err)
+				return
+			}
+
+			data, err := json.MarshalIndent(response, "", "  ")
+			if err != nil {
+				ui.Error("Failed to convert the secrets to JSON: %v", err)
+				return
+			}
+			data = append(data, '\n')
+
+			if outputFlag == "-" {
+				fmt.Print(string(data))
+				return
+			}
+			if err := os.WriteFile(outputFlag, data, 0o600); err != nil {
+				ui.Error("Failed to write %s: %v", outputFlag, err)
+				return
+			}
+			ui.Success("Exported %d secret(s) from %s to %s", len(response.Secrets), serverFlag, outputFlag)
+		},
+	}
+
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL to export the secrets from")
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "-", "File to write the secrets to, - for stdout")
+	_ = cmd.MarkFlagRequired("server")
+
+	return cmd
+}
+
+func SecretsImportCmd() *cobra.Command {
+	var serverFlag string
+
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import secrets exported with 'haloy secrets export' to a server",
+		Long: `Import the secrets written by 'haloy secrets export' from a file, or from stdin without one. Each value
+is encrypted to the age recipient of the server before it's sent, and the server stores it encrypted.
+
+Deployments to the server, e.g. with 'haloy import', leave imported secrets unresolved and the server fills
+in their values, so apps can move to the server without access to their secret providers. App tokens can
+only deploy an imported secret to the apps that used it on the exporting server.`,
+		Example: "  haloy secrets export --server old.example.com | haloy secrets import --server new.example.com",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+
+			var data []byte
+			var err error
+			if len(args) == 1 && args[0] != "-" {
+				data, err = os.ReadFile(args[0])
+			} else {
+				data, err = io.ReadAll(os.Stdin)
+			}
+			if err != nil {
+				ui.Error("Failed to read the secrets: %v", err)
+				return
+			}
+			var export apitypes.SecretsExportResponse
+			if err := json.Unmarshal(data, &export); err != nil {
+				ui.Error("Failed to parse the secrets, expected the output of 'haloy secrets export': %v", err)
+				return
+			}
+			if len(export.Secrets) == 0 {
+				ui.Info("No secrets to import")
+				return
+			}
+
+			api, err := bulkClient(selectedApp{server: serverFlag})
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			var recipient apitypes.SecretsRecipientResponse
+			if err := api.Get(ctx, "secrets/recipient", &recipient); err != nil {
+				ui.Error("Failed to get the recipient of %s: %v", serverFlag, err)
+				return
+			}
+
+			request := apitypes.SecretsImportRequest{Secrets: make([]apitypes.ExportedSecret, 0, len(export.Secrets))}
+			for _, secret := range export.Secrets {
+				encrypted, err := serverkey.EncryptTo(recipient.Recipient, secret.Value)
+				if err != nil {
+					ui.Error("Failed to encrypt %s: %v", secret.Name, err)
+					return
+				}
+				secret.Value = encrypted
+				request.Secrets = append(request.Secrets, secret)
+			}
+
+			var response apitypes.SecretsImportResponse
+			if err := api.Post(ctx, "secrets/import", request, &response); err != nil {
+				ui.Error("Failed to import secrets to %s: %v", serverFlag, err)
+				return
+			}
+			ui.Success("Imported %d secret(s) to %s", response.Imported, serverFlag)
+		},
+	}
+
+	cmd.Flags().StringVarP(&serverFlag, "server", "s", "", "Haloy server URL to import the secrets to")
+	_ = cmd.MarkFlagRequired("server")
+
+	return cmd
+}
+
+// importedSecrets returns the names of the secrets imported to a server with 'haloy secrets import'.
+func importedSecrets(ctx context.Context, targetConfig *config.TargetConfig, server string) (map[string]bool, error) {
+	api, err := bulkClient(selectedApp{server: server, targetConfig: targetConfig})
+	if err != nil {
+		return nil, err
+	}
+	var response apitypes.SecretsResponse
+	if err := api.Get(ctx, "secrets", &response); err != nil {
+		return nil, fmt.Errorf("failed to list the secrets imported to %s: %w", server, err)
+	}
+
+	imported := make(map[string]bool, len(response.Imported))
+	for _, name := range response.Imported {
+		imported[name] = true
+	}
+	return imported, nil
+}
+
+// secretApps returns the apps using a secret. Apps whose current deployment no longer uses it are
+// left out with currentOnly, otherwise they are marked as previous.
+func secretApps(secret apitypes.SecretUsage, currentOnly bool) []string {
+	current := make(map[string]bool)
+	for _, consumer := range secret.Consumers {
+		current[consumer.App] = current[consumer.App] || consumer.Current
+	}
+
+	var apps []string
+	for _, app := range slices.Sorted(maps.Keys(current)) {
+		switch {
+		case current[app]:
+			apps = append(apps, app)
+		case !currentOnly:
+			apps = append(apps, app+" (previous)")
+		}
+	}
+	return apps
+}
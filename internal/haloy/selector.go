@@ -0,0 +1,219 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/ui"
+)
+
+const defaultBulkParallelism = 4
+
+// appSelector selects apps by a glob pattern on the name, e.g. "team-a-*", and labels, e.g. "env=staging,tier=web".
+type appSelector struct {
+	pattern string
+	labels  map[string]string
+}
+
+func newAppSelector(pattern, labelSelector string) (appSelector, error) {
+	selector := appSelector{pattern: pattern}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return selector, fmt.Errorf("invalid app pattern '%s': %w", pattern, err)
+	}
+	if labelSelector == "" {
+		return selector, nil
+	}
+
+	selector.labels = make(map[string]string)
+	for part := range strings.SplitSeq(labelSelector, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return selector, fmt.Errorf("invalid selector '%s', expected key=value pairs separated by commas", labelSelector)
+		}
+		selector.labels[key] = strings.TrimSpace(value)
+	}
+	return selector, nil
+}
+
+func (s appSelector) isEmpty() bool {
+	return s.pattern == "" && len(s.labels) == 0
+}
+
+func (s appSelector) matches(name string, labels map[string]string) bool {
+	if s.pattern != "" {
+		if matched, _ := path.Match(s.pattern, name); !matched {
+			return false
+		}
+	}
+	for key, value := range s.labels {
+		if labelValue, exists := labels[key]; !exists || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// selectedApp is an app on a server that a bulk command runs for.
+type selectedApp struct {
+	name   string
+	server string
+	// targetConfig is used to get the API token of the server, nil when the server was given with --server.
+	targetConfig *config.TargetConfig
+	// summary is the app as listed by the server, empty for apps of the targets in the config.
+	summary apitypes.AppSummary
+}
+
+// loadForSelector loads the config of a command with a selector, which selects from all targets when
+// no targets are given.
+func loadForSelector(ctx context.Context, configPath string, flags *appCmdFlags) (config.AppConfig, error) {
+	allTargets := flags.all
+	if len(flags.targets) == 0 && !allTargets {
+		rawAppConfig, _, err := appconfigloader.LoadRawAppConfig(configPath)
+		if err != nil {
+			return config.AppConfig{}, err
+		}
+		allTargets = len(rawAppConfig.Targets) > 0
+	}
+	return appconfigloader.Load(ctx, configPath, flags.targets, allTargets)
+}
+
+// selectApps lists the apps on the server, or on the servers of the targets in the config, and returns
+// the ones the selector matches.
+func selectApps(ctx context.Context, configPath string, flags *appCmdFlags, server string, selector appSelector) ([]selectedApp, error) {
+	servers, err := selectServers(ctx, configPath, flags, server)
+	if err != nil {
+		return nil, err
+	}
+
+	var apps []selectedApp
+	for _, server := range slices.Sorted(maps.Keys(servers)) {
+		api, err := bulkClient(selectedApp{server: server, targetConfig: servers[server]})
+		if err != nil {
+			return nil, err
+		}
+		var response apitypes.AppsResponse
+		if err := api.Get(ctx, "apps", &response); err != nil {
+			return nil, fmt.Errorf("failed to list apps on %s: %w", server, err)
+		}
+		for _, app := range response.Apps {
+			if selector.matches(app.Name, app.Labels) {
+				apps = append(apps, selectedApp{name: app.Name, server: server, targetConfig: servers[server], summary: app})
+			}
+		}
+	}
+	return apps, nil
+}
+
+// selectServers returns the server given with --server, or the servers of the targets in the config,
+// with a target config to get the API token from. The target config is nil for --server.
+func selectServers(ctx context.Context, configPath string, flags *appCmdFlags, server string) (map[string]*config.TargetConfig, error) {
+	servers := make(map[string]*config.TargetConfig)
+	if server != "" {
+		servers[server] = nil
+		return servers, nil
+	}
+
+	rawAppConfig, err := loadForSelector(ctx, configPath, flags)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := appconfigloader.ExtractTargets(rawAppConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create deploy targets: %w", err)
+	}
+	for targetServer, targetNames := range appconfigloader.TargetsByServer(targets) {
+		target := targets[targetNames[0]]
+		servers[targetServer] = &target
+	}
+	return servers, nil
+}
+
+// configApps returns the apps of the targets in the config.
+func configApps(ctx context.Context, configPath string, flags *appCmdFlags) ([]selectedApp, error) {
+	rawAppConfig, err := appconfigloader.Load(ctx, configPath, flags.targets, flags.all)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := appconfigloader.ExtractTargets(rawAppConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create deploy targets: %w", err)
+	}
+
+	apps := make([]selectedApp, 0, len(targets))
+	for _, targetName := range slices.Sorted(maps.Keys(targets)) {
+		target := targets[targetName]
+		apps = append(apps, selectedApp{name: target.Name, server: target.Server, targetConfig: &target})
+	}
+	return apps, nil
+}
+
+func bulkClient(app selectedApp) (*apiclient.APIClient, error) {
+	token, err := getToken(app.targetConfig, app.server)
+	if err != nil {
+		return nil, err
+	}
+	api, err := apiclient.New(app.server, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API client: %w", err)
+	}
+	return api, nil
+}
+
+// runBulk runs action for each app with at most parallel apps at a time and prints a summary table.
+// It returns false if the action failed for any app.
+func runBulk(ctx context.Context, apps []selectedApp, parallel int, action func(context.Context, *apiclient.APIClient, selectedApp) (string, error)) bool {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]string, len(apps))
+	failed := make([]bool, len(apps))
+	semaphore := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, app := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			api, err := bulkClient(app)
+			if err == nil {
+				results[i], err = action(ctx, api, app)
+			}
+			if err != nil {
+				results[i], failed[i] = err.Error(), true
+			}
+		}()
+	}
+	wg.Wait()
+
+	rows := make([][]string, 0, len(apps))
+	failures := 0
+	for i, app := range apps {
+		status := "ok"
+		if failed[i] {
+			status = "failed"
+			failures++
+		}
+		rows = append(rows, []string{app.name, app.server, status, results[i]})
+	}
+	ui.Table([]string{"APP", "SERVER", "STATUS", "RESULT"}, rows)
+
+	if failures > 0 {
+		ui.Error("%d of %d app(s) failed", failures, len(apps))
+		return false
+	}
+	ui.Success("Done for %d app(s)", len(apps))
+	return true
+}
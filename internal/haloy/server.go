@@ -66,63 +66,67 @@ func ServerAddCmd() *cobra.Command {
 				return
 			}
 
-			configDir, err := config.ConfigDir()
+			tokenEnv, err := storeServerToken(normalizedURL, token, force)
 			if err != nil {
-				ui.Error("Failed to get config dir: %v", err)
+				ui.Error("%v", err)
 				return
 			}
 
-			if err = helpers.EnsureDir(configDir); err != nil {
-				ui.Error("Failed to create config dir: %v", err)
-				return
-			}
+			ui.Success("Server %s added successfully", normalizedURL)
+			ui.Info("API token stored as: %s", tokenEnv)
+		},
+	}
 
-			envFile := filepath.Join(configDir, constants.ConfigEnvFileName)
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Force overwrite if server already exists")
 
-			tokenEnv := generateTokenEnvName(normalizedURL)
+	return cmd
+}
 
-			env, err := godotenv.Read(envFile)
-			if err != nil {
-				if os.IsNotExist(err) {
-					// Create empty map if file doesn't exist
-					env = make(map[string]string)
-				} else {
-					ui.Error("Failed to read env file: %v", err)
-					return
-				}
-			}
-			env[tokenEnv] = token
-			if err := godotenv.Write(env, envFile); err != nil {
-				ui.Error("Failed to write env file: %v", err)
-				return
-			}
+// storeServerToken saves the token of a server in the .env file of the config directory and adds the server
+// to the client config. It returns the environment variable the token is stored as.
+func storeServerToken(normalizedURL, token string, force bool) (string, error) {
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config dir: %w", err)
+	}
 
-			clientConfigPath := filepath.Join(configDir, constants.ClientConfigFileName)
-			clientConfig, err := config.LoadClientConfig(clientConfigPath)
-			if err != nil {
-				ui.Error("Failed to load client config: %v", err)
-				return
-			}
+	if err = helpers.EnsureDir(configDir); err != nil {
+		return "", fmt.Errorf("failed to create config dir: %w", err)
+	}
 
-			if clientConfig == nil {
-				clientConfig = &config.ClientConfig{}
-			}
+	envFile := filepath.Join(configDir, constants.ConfigEnvFileName)
 
-			clientConfig.AddServer(normalizedURL, tokenEnv, force)
+	tokenEnv := generateTokenEnvName(normalizedURL)
 
-			if err := config.SaveClientConfig(clientConfig, clientConfigPath); err != nil {
-				ui.Error("Failed to save client config: %v", err)
-				return
-			}
+	env, err := godotenv.Read(envFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read env file: %w", err)
+		}
+		// Create empty map if file doesn't exist
+		env = make(map[string]string)
+	}
+	env[tokenEnv] = token
+	if err := godotenv.Write(env, envFile); err != nil {
+		return "", fmt.Errorf("failed to write env file: %w", err)
+	}
 
-			ui.Success("Server %s added successfully", normalizedURL)
-			ui.Info("API token stored as: %s", tokenEnv)
-		},
+	clientConfigPath := filepath.Join(configDir, constants.ClientConfigFileName)
+	clientConfig, err := config.LoadClientConfig(clientConfigPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load client config: %w", err)
 	}
 
-	cmd.Flags().BoolVarP(&force, "force", "f", false, "Force overwrite if server already exists")
+	if clientConfig == nil {
+		clientConfig = &config.ClientConfig{}
+	}
 
-	return cmd
+	clientConfig.AddServer(normalizedURL, tokenEnv, force)
+
+	if err := config.SaveClientConfig(clientConfig, clientConfigPath); err != nil {
+		return "", fmt.Errorf("failed to save client config: %w", err)
+	}
+	return tokenEnv, nil
 }
 
 func generateTokenEnvName(url string) string {
@@ -1,25 +1,18 @@
 package haloy
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
 
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/helpers"
-	"github.com/oklog/ulid"
 )
 
-func createDeploymentID() string {
-	entropy := ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
-	id := ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
-	return strings.ToLower(id)
-}
-
 func getToken(targetConfig *config.TargetConfig, url string) (string, error) {
 	if targetConfig != nil && targetConfig.APIToken != nil && targetConfig.APIToken.Value != "" {
 		return targetConfig.APIToken.Value, nil
@@ -56,3 +49,30 @@ func getToken(targetConfig *config.TargetConfig, url string) (string, error) {
 
 	return token, nil
 }
+
+// errorHint returns how to fix the API error err, or "" when there's no specific advice for it.
+func errorHint(err error) string {
+	var apiErr *apiclient.APIError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+
+	switch apiErr.Code {
+	case apitypes.ErrCodeImagePlatformMismatch:
+		platform := "linux/" + apiErr.Detail("hostPlatform")
+		return fmt.Sprintf("Set image.build.platform to '%s' in the app config, or build with 'docker buildx build --platform %s'", platform, platform)
+	case apitypes.ErrCodeDomainConflict:
+		return fmt.Sprintf("Remove %s from the domains of one of the apps, or stop '%s' with 'haloy stop' first",
+			apiErr.Detail("domain"), apiErr.Detail("app"))
+	case apitypes.ErrCodeDeployFrozen:
+		return "Wait for the freeze window to end, or deploy anyway with --ignore-freeze"
+	case apitypes.ErrCodeInvalidConfig:
+		return "Check the app config with 'haloy validate-config', the server may be older than this CLI"
+	case apitypes.ErrCodeUnauthorized:
+		return "Check the API token of the server, or log in again with 'haloy login <server>' when your session expired"
+	case apitypes.ErrCodeUnavailable:
+		return "haloyd is restarting, retry in a moment"
+	default:
+		return ""
+	}
+}
@@ -92,7 +92,32 @@ func getAppStatus(ctx context.Context, targetConfig *config.TargetConfig, target
 		fmt.Sprintf("State: %s", state),
 		fmt.Sprintf("Deployment ID: %s", response.DeploymentID),
 		fmt.Sprintf("Running container(s): %s", strings.Join(containerIDs, ", ")),
-		fmt.Sprintf("Domain(s): %s", strings.Join(canonicalDomains, ", ")),
+	}
+	if response.NetworkAlias != "" {
+		formattedOutput = append(formattedOutput, fmt.Sprintf("Network alias: %s", response.NetworkAlias))
+	}
+	if response.Exposure == config.ExposureInternal {
+		formattedOutput = append(formattedOutput,
+			"Exposure: internal",
+			fmt.Sprintf("Address(es): %s", strings.Join(response.Addresses, ", ")))
+	} else {
+		formattedOutput = append(formattedOutput, fmt.Sprintf("Domain(s): %s", strings.Join(canonicalDomains, ", ")))
+	}
+
+	if len(response.Annotations) > 0 {
+		formattedOutput = append(formattedOutput, fmt.Sprintf("Annotations: %s", formatAnnotations(response.Annotations)))
+	}
+
+	if traffic := response.Traffic; traffic != nil {
+		formattedOutput = append(formattedOutput, fmt.Sprintf("Traffic: %d active sessions, %d new/s, %d queued, %d 5xx responses",
+			traffic.CurrentSessions, traffic.SessionRate, traffic.QueuedRequests, traffic.Responses5xx))
+		servers := make([]string, 0, len(traffic.Servers))
+		for _, server := range traffic.Servers {
+			servers = append(servers, fmt.Sprintf("%s %s (%d sessions)", server.Name, server.Status, server.CurrentSessions))
+		}
+		if len(servers) > 0 {
+			formattedOutput = append(formattedOutput, fmt.Sprintf("Servers: %s", strings.Join(servers, ", ")))
+		}
 	}
 
 	ui.Section(fmt.Sprintf("Status for %s", appName), formattedOutput)
@@ -16,14 +16,53 @@ import (
 func StopAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 	var serverFlag string
 	var removeContainersFlag bool
+	var selectorFlag string
+	var parallelFlag int
 
 	cmd := &cobra.Command{
-		Use:   "stop",
+		Use:   "stop [app-pattern]",
 		Short: "Stop an application's running containers",
-		Long:  "Stop all running containers for an application using a haloy configuration file.",
-		Args:  cobra.NoArgs,
+		Long: `Stop all running containers for an application using a haloy configuration file.
+
+With a glob pattern, e.g. 'team-a-*', or a label selector, e.g. --selector env=staging, all matching apps
+on the servers are stopped.`,
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			ctx := cmd.Context()
+
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			selector, err := newAppSelector(pattern, selectorFlag)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			if !selector.isEmpty() {
+				apps, err := selectApps(ctx, *configPath, flags, serverFlag, selector)
+				if err != nil {
+					ui.Error("%v", err)
+					return
+				}
+				if len(apps) == 0 {
+					ui.Warn("No apps match the selector")
+					return
+				}
+				runBulk(ctx, apps, parallelFlag, func(ctx context.Context, api *apiclient.APIClient, app selectedApp) (string, error) {
+					var response apitypes.StopAppResponse
+					if err := api.Post(ctx, stopPath(app.name, removeContainersFlag), nil, &response); err != nil {
+						return "", err
+					}
+					if response.PendingAction != nil {
+						return fmt.Sprintf("waits for confirmation with 'haloy confirm %s'", response.PendingAction.ActionID), nil
+					}
+					return response.Message, nil
+				})
+				return
+			}
+
 			if serverFlag != "" {
 				stopApp(ctx, nil, serverFlag, "", removeContainersFlag)
 			} else {
@@ -58,6 +97,8 @@ func StopAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Stop app on specific targets (comma-separated)")
 	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Stop app on all targets")
 	cmd.Flags().BoolVarP(&removeContainersFlag, "remove-containers", "r", false, "Remove containers after stopping them")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Stop apps with labels, e.g. env=staging,team=payments")
+	cmd.Flags().IntVarP(&parallelFlag, "parallel", "p", defaultBulkParallelism, "Number of apps to stop at the same time")
 
 	return cmd
 }
@@ -76,18 +117,25 @@ func stopApp(ctx context.Context, targetConfig *config.TargetConfig, targetServe
 		ui.Error("Failed to create API client: %v", err)
 		return
 	}
-	path := fmt.Sprintf("stop/%s", appName)
-
-	// Add query parameter if removeContainers is true
-	if removeContainers {
-		path += "?remove-containers=true"
-	}
-
 	var response apitypes.StopAppResponse
-	if err := api.Post(ctx, path, nil, &response); err != nil {
+	if err := api.Post(ctx, stopPath(appName, removeContainers), nil, &response); err != nil {
 		ui.Error("Failed to stop app: %v", err)
 		return
 	}
+	if response.PendingAction != nil {
+		printPendingAction(response.PendingAction)
+		return
+	}
 
 	ui.Success("%s", response.Message)
 }
+
+func stopPath(appName string, removeContainers bool) string {
+	path := fmt.Sprintf("stop/%s", appName)
+
+	// Add query parameter if removeContainers is true
+	if removeContainers {
+		path += "?remove-containers=true"
+	}
+	return path
+}
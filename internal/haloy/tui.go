@@ -0,0 +1,565 @@
+package haloy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/appconfigloader"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploytypes"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/ui"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+	"github.com/spf13/cobra"
+)
+
+const (
+	tuiRefreshInterval = 5 * time.Second
+	tuiMaxLogLines     = 500
+)
+
+func TuiCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Interactive view of apps and logs across servers",
+		Long: `Show a live view of the apps, replicas and health on every server in the config, with streaming logs.
+
+Keys:
+  ↑/↓ or k/j  select app
+  d           deploy the selected app
+  b           roll back the selected app
+  +/-         add or remove a replica of the selected app
+  s           stop the selected app
+  r           refresh
+  q           quit`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			if !term.IsTerminal(os.Stdin.Fd()) {
+				ui.Error("haloy tui requires an interactive terminal")
+				return
+			}
+
+			rawAppConfig, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+			targets, err := appconfigloader.ExtractTargets(rawAppConfig)
+			if err != nil {
+				ui.Error("Unable to create deploy targets: %v", err)
+				return
+			}
+
+			model, err := newTuiModel(ctx, targets, *configPath, len(rawAppConfig.Targets) > 0)
+			if err != nil {
+				ui.Error("%v", err)
+				return
+			}
+
+			program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+			if _, err := program.Run(); err != nil && ctx.Err() == nil {
+				ui.Error("%v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Show specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Show all targets")
+	return cmd
+}
+
+type tuiServer struct {
+	url  string
+	api  *apiclient.APIClient
+	apps []apitypes.AppSummary
+	err  error
+}
+
+type tuiRow struct {
+	server *tuiServer
+	app    apitypes.AppSummary
+	// target is the config target deploying this app, nil for apps that aren't in the config.
+	target *config.TargetConfig
+}
+
+type tuiMode int
+
+const (
+	tuiModeApps tuiMode = iota
+	tuiModeRollback
+	tuiModeConfirmStop
+)
+
+// Messages sent to the model by commands and the log and event streams.
+type (
+	tuiTickMsg       struct{}
+	tuiRefreshMsg    struct{}
+	tuiLogMsg        string
+	tuiStatusMsg     string
+	tuiErrorMsg      struct{ err error }
+	tuiServerAppsMsg struct {
+		server *tuiServer
+		apps   []apitypes.AppSummary
+		err    error
+	}
+	tuiRollbackTargetsMsg struct {
+		app     string
+		targets []deploytypes.RollbackTarget
+	}
+	tuiCommandDoneMsg struct{ err error }
+)
+
+type tuiModel struct {
+	ctx         context.Context
+	servers     []*tuiServer
+	targets     map[string]config.TargetConfig
+	configPath  string
+	multiTarget bool
+	// updates carries the lines and changes of the log and event streams of all servers.
+	updates chan tea.Msg
+
+	width, height int
+	rows          []tuiRow
+	selected      int
+	logs          []string
+	status        string
+
+	mode             tuiMode
+	rollbackTargets  []deploytypes.RollbackTarget
+	rollbackSelected int
+}
+
+func newTuiModel(ctx context.Context, targets map[string]config.TargetConfig, configPath string, multiTarget bool) (*tuiModel, error) {
+	m := &tuiModel{
+		ctx:         ctx,
+		targets:     targets,
+		configPath:  configPath,
+		multiTarget: multiTarget,
+		updates:     make(chan tea.Msg, 64),
+		width:       100,
+		height:      30,
+	}
+
+	targetNames := make([]string, 0, len(targets))
+	for name := range targets {
+		targetNames = append(targetNames, name)
+	}
+	sort.Strings(targetNames)
+
+	seen := make(map[string]bool)
+	for _, name := range targetNames {
+		target := targets[name]
+		normalized, err := helpers.NormalizeServerURL(target.Server)
+		if err != nil {
+			return nil, err
+		}
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+
+		token, err := getToken(&target, target.Server)
+		if err != nil {
+			return nil, err
+		}
+		api, err := apiclient.New(target.Server, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create API client: %w", err)
+		}
+		m.servers = append(m.servers, &tuiServer{url: normalized, api: api})
+	}
+
+	return m, nil
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	for _, server := range m.servers {
+		go m.streamLogs(server)
+		go m.streamEvents(server)
+	}
+	return tea.Batch(m.refresh(), m.waitForUpdate(), tuiTick())
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(tuiRefreshInterval, func(time.Time) tea.Msg { return tuiTickMsg{} })
+}
+
+// waitForUpdate returns the next message of the log and event streams.
+func (m *tuiModel) waitForUpdate() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case msg := <-m.updates:
+			return msg
+		case <-m.ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg.String())
+
+	case tuiTickMsg:
+		return m, tea.Batch(m.refresh(), tuiTick())
+
+	case tuiRefreshMsg:
+		return m, tea.Batch(m.refresh(), m.waitForUpdate())
+
+	case tuiLogMsg:
+		m.logs = append(m.logs, string(msg))
+		if len(m.logs) > tuiMaxLogLines {
+			m.logs = m.logs[len(m.logs)-tuiMaxLogLines:]
+		}
+		return m, m.waitForUpdate()
+
+	case tuiServerAppsMsg:
+		msg.server.apps, msg.server.err = msg.apps, msg.err
+		m.buildRows()
+
+	case tuiStatusMsg:
+		m.status = string(msg)
+		return m, m.refresh()
+
+	case tuiErrorMsg:
+		m.status = lipgloss.NewStyle().Foreground(ui.Red).Render(msg.err.Error())
+
+	case tuiRollbackTargetsMsg:
+		m.rollbackTargets = msg.targets
+		m.rollbackSelected = 0
+		if len(m.rollbackTargets) == 0 {
+			m.status = fmt.Sprintf("No rollback targets available for %s", msg.app)
+		} else {
+			m.mode = tuiModeRollback
+			m.status = ""
+		}
+
+	case tuiCommandDoneMsg:
+		if msg.err != nil {
+			m.status = lipgloss.NewStyle().Foreground(ui.Red).Render(msg.err.Error())
+		}
+		return m, m.refresh()
+	}
+	return m, nil
+}
+
+// handleKey updates the model for a key press and returns the command it starts, if any.
+func (m *tuiModel) handleKey(key string) tea.Cmd {
+	if key == "q" || key == "ctrl+c" {
+		return tea.Quit
+	}
+
+	switch m.mode {
+	case tuiModeConfirmStop:
+		m.mode = tuiModeApps
+		m.status = ""
+		if key == "y" && m.selected < len(m.rows) {
+			row := m.rows[m.selected]
+			return func() tea.Msg {
+				var response apitypes.StopAppResponse
+				if err := row.server.api.Post(m.ctx, fmt.Sprintf("stop/%s", row.app.Name), nil, &response); err != nil {
+					return tuiErrorMsg{err}
+				}
+				return tuiStatusMsg(fmt.Sprintf("Stopping %s on %s", row.app.Name, row.server.url))
+			}
+		}
+
+	case tuiModeRollback:
+		switch key {
+		case "k", "up":
+			m.rollbackSelected = max(0, m.rollbackSelected-1)
+		case "j", "down":
+			m.rollbackSelected = min(len(m.rollbackTargets)-1, m.rollbackSelected+1)
+		case "esc":
+			m.mode = tuiModeApps
+		case "enter":
+			m.mode = tuiModeApps
+			if m.rollbackSelected < len(m.rollbackTargets) && m.selected < len(m.rows) {
+				return m.haloyCommand(m.rows[m.selected], "rollback", m.rollbackTargets[m.rollbackSelected].DeploymentID)
+			}
+		}
+
+	case tuiModeApps:
+		switch key {
+		case "k", "up":
+			m.selected = max(0, m.selected-1)
+		case "j", "down":
+			m.selected = min(len(m.rows)-1, m.selected+1)
+		case "r":
+			return m.refresh()
+		case "s":
+			if m.selected < len(m.rows) {
+				m.mode = tuiModeConfirmStop
+				m.status = fmt.Sprintf("Stop %s on %s? (y/n)", m.rows[m.selected].app.Name, m.rows[m.selected].server.url)
+			}
+		case "+", "-":
+			if m.selected < len(m.rows) {
+				row := m.rows[m.selected]
+				replicas := row.app.Replicas + 1
+				if key == "-" {
+					replicas = row.app.Replicas - 1
+				}
+				return m.scale(row, replicas)
+			}
+		case "d":
+			if m.selected < len(m.rows) {
+				if m.rows[m.selected].target == nil {
+					m.status = "App is not in the config, it can't be deployed from here"
+					return nil
+				}
+				return m.haloyCommand(m.rows[m.selected], "deploy")
+			}
+		case "b":
+			if m.selected < len(m.rows) {
+				row := m.rows[m.selected]
+				if row.target == nil {
+					m.status = "App is not in the config, it can't be rolled back from here"
+					return nil
+				}
+				return m.loadRollbackTargets(row)
+			}
+		}
+	}
+	return nil
+}
+
+// haloyCommand runs this binary with the config and target of the row, so deploys and rollbacks behave exactly as on the command line.
+// The terminal is handed over to the command and returned when it's done.
+func (m *tuiModel) haloyCommand(row tuiRow, args ...string) tea.Cmd {
+	args = append(args, "--config", m.configPath)
+	if m.multiTarget {
+		args = append(args, "--targets", row.target.TargetName)
+	}
+	command := &tuiForegroundCommand{Cmd: exec.Command(os.Args[0], args...)}
+	return tea.Exec(command, func(err error) tea.Msg { return tuiCommandDoneMsg{err} })
+}
+
+// tuiForegroundCommand waits for enter after the command has finished, so its output can be read before the
+// view of haloy tui replaces it.
+type tuiForegroundCommand struct {
+	*exec.Cmd
+}
+
+func (c *tuiForegroundCommand) SetStdin(r io.Reader)  { c.Stdin = r }
+func (c *tuiForegroundCommand) SetStdout(w io.Writer) { c.Stdout = w }
+func (c *tuiForegroundCommand) SetStderr(w io.Writer) { c.Stderr = w }
+
+func (c *tuiForegroundCommand) Run() error {
+	err := c.Cmd.Run()
+	if err != nil {
+		ui.Error("%v", err)
+	}
+	fmt.Fprint(c.Stdout, "\nPress enter to return to haloy tui")
+	bufio.NewReader(c.Stdin).ReadString('\n')
+	return err
+}
+
+// scale sets the replicas of the current deployment of an app without deploying it again.
+func (m *tuiModel) scale(row tuiRow, replicas int) tea.Cmd {
+	if replicas < 1 {
+		m.status = fmt.Sprintf("%s has a single replica, stop it instead", row.app.Name)
+		return nil
+	}
+	m.status = fmt.Sprintf("Scaling %s on %s to %d replica(s)", row.app.Name, row.server.url, replicas)
+	return func() tea.Msg {
+		var response apitypes.ScaleResponse
+		if err := row.server.api.Post(m.ctx, fmt.Sprintf("scale/%s", row.app.Name), apitypes.ScaleRequest{Replicas: replicas}, &response); err != nil {
+			return tuiErrorMsg{err}
+		}
+		return tuiStatusMsg(response.Message)
+	}
+}
+
+func (m *tuiModel) loadRollbackTargets(row tuiRow) tea.Cmd {
+	return func() tea.Msg {
+		var response apitypes.RollbackTargetsResponse
+		if err := row.server.api.Get(m.ctx, fmt.Sprintf("rollback/%s", row.app.Name), &response); err != nil {
+			return tuiErrorMsg{err}
+		}
+		msg := tuiRollbackTargetsMsg{app: row.app.Name}
+		for _, target := range response.Targets {
+			if !target.IsRunning {
+				msg.targets = append(msg.targets, target)
+			}
+		}
+		return msg
+	}
+}
+
+// refresh loads the apps of every server, each server updates the view when it answers.
+func (m *tuiModel) refresh() tea.Cmd {
+	cmds := make([]tea.Cmd, 0, len(m.servers))
+	for _, server := range m.servers {
+		cmds = append(cmds, func() tea.Msg {
+			var response apitypes.AppsResponse
+			err := server.api.Get(m.ctx, "apps", &response)
+			return tuiServerAppsMsg{server: server, apps: response.Apps, err: err}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// buildRows lists the apps of all servers, keeping the selected app selected.
+func (m *tuiModel) buildRows() {
+	var selectedKey string
+	if m.selected < len(m.rows) {
+		selectedKey = m.rows[m.selected].server.url + "/" + m.rows[m.selected].app.Name
+	}
+	m.rows = nil
+	for _, server := range m.servers {
+		for _, app := range server.apps {
+			row := tuiRow{server: server, app: app}
+			for name, target := range m.targets {
+				if normalized, _ := helpers.NormalizeServerURL(target.Server); target.Name == app.Name && normalized == server.url {
+					target := m.targets[name]
+					row.target = &target
+				}
+			}
+			if server.url+"/"+app.Name == selectedKey {
+				m.selected = len(m.rows)
+			}
+			m.rows = append(m.rows, row)
+		}
+	}
+	m.selected = max(0, min(m.selected, len(m.rows)-1))
+}
+
+// send passes a message of a stream to the model, unless the program has quit.
+func (m *tuiModel) send(msg tea.Msg) bool {
+	select {
+	case m.updates <- msg:
+		return true
+	case <-m.ctx.Done():
+		return false
+	}
+}
+
+func (m *tuiModel) streamLogs(server *tuiServer) {
+	prefix := ""
+	if len(m.servers) > 1 {
+		prefix = server.url + " "
+	}
+	for m.ctx.Err() == nil {
+		server.api.Stream(m.ctx, "logs", func(data string) bool {
+			var entry logging.LogEntry
+			if err := json.Unmarshal([]byte(data), &entry); err != nil {
+				return false
+			}
+			line := fmt.Sprintf("%s %s%s", entry.Timestamp.Format("15:04:05"), prefix, entry.Message)
+			if entry.AppName != "" {
+				line = fmt.Sprintf("%s %s[%s] %s", entry.Timestamp.Format("15:04:05"), prefix, entry.AppName, entry.Message)
+			}
+			return !m.send(tuiLogMsg(line))
+		})
+		select {
+		case <-m.ctx.Done():
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+// streamEvents refreshes the app list as soon as the server reports a change.
+func (m *tuiModel) streamEvents(server *tuiServer) {
+	for m.ctx.Err() == nil {
+		server.api.Stream(m.ctx, "events?type=deployment,container,app", func(data string) bool {
+			var event events.Event
+			if json.Unmarshal([]byte(data), &event) != nil {
+				return false
+			}
+			return !m.send(tuiRefreshMsg{})
+		})
+		select {
+		case <-m.ctx.Done():
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+func (m *tuiModel) View() string {
+	title := lipgloss.NewStyle().Bold(true).Foreground(ui.White)
+	muted := lipgloss.NewStyle().Foreground(ui.Gray)
+	selected := lipgloss.NewStyle().Bold(true).Foreground(ui.Blue)
+
+	var lines []string
+	lines = append(lines, title.Render("haloy")+muted.Render("  ↑/↓ select · d deploy · b rollback · +/- scale · s stop · r refresh · q quit"), "")
+
+	for _, server := range m.servers {
+		header := title.Render(server.url)
+		if server.err != nil {
+			header += " " + lipgloss.NewStyle().Foreground(ui.Red).Render(server.err.Error())
+		}
+		lines = append(lines, header)
+		for i, row := range m.rows {
+			if row.server != server {
+				continue
+			}
+			domains := make([]string, 0, len(row.app.Domains))
+			for _, domain := range row.app.Domains {
+				domains = append(domains, domain.Canonical)
+			}
+			cursor := "  "
+			name := row.app.Name
+			if i == m.selected {
+				cursor = selected.Render("> ")
+				name = selected.Render(name)
+			}
+			lines = append(lines, fmt.Sprintf("%s%-24s %-12s %d replica(s)  %s  %s",
+				cursor, name, displayState(row.app.State), row.app.Replicas,
+				muted.Render(row.app.DeploymentID), strings.Join(domains, ", ")))
+		}
+		lines = append(lines, "")
+	}
+
+	if m.mode == tuiModeRollback {
+		lines = append(lines, title.Render("Roll back to (enter to confirm, esc to cancel)"))
+		for i, target := range m.rollbackTargets {
+			line := fmt.Sprintf("  %s  %s", target.DeploymentID, muted.Render(target.ImageRef))
+			if i == m.rollbackSelected {
+				line = selected.Render("> "+target.DeploymentID) + "  " + muted.Render(target.ImageRef)
+			}
+			lines = append(lines, line)
+		}
+		lines = append(lines, "")
+	}
+
+	if m.status != "" {
+		lines = append(lines, m.status, "")
+	}
+
+	lines = append(lines, title.Render("Logs"))
+	logLines := max(0, m.height-len(lines))
+	start := max(0, len(m.logs)-logLines)
+	for _, line := range m.logs[start:] {
+		if len(line) > m.width {
+			line = line[:m.width]
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) > m.height {
+		lines = lines[:m.height]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -33,7 +33,7 @@ func ValidateAppConfigCmd(configPath *string) *cobra.Command {
 
 			rawAppConfig, format, err := appconfigloader.LoadRawAppConfig(*configPath)
 			if err != nil {
-				ui.Error("Unable to load config file from %s: %v", *configPath, err)
+				ui.Error("Unable to load config: %v", err)
 				return
 			}
 
@@ -47,7 +47,8 @@ func ValidateAppConfigCmd(configPath *string) *cobra.Command {
 					}
 
 					if err := mergedTargetConfig.Validate(rawAppConfig.Format); err != nil {
-						errors = append(errors, fmt.Errorf("target '%s' validation failed: %w", targetName, err))
+						location := rawAppConfig.TargetLocations[targetName]
+						errors = append(errors, fmt.Errorf("%s: target '%s' validation failed: %w", location, targetName, err))
 					}
 				}
 			} else {
@@ -56,7 +57,7 @@ func ValidateAppConfigCmd(configPath *string) *cobra.Command {
 					errors = append(errors, fmt.Errorf("unable to extract config: %w", err))
 				} else {
 					if err := mergedSingleTargetConfig.Validate(rawAppConfig.Format); err != nil {
-						errors = append(errors, fmt.Errorf("configuration validation failed: %w", err))
+						errors = append(errors, fmt.Errorf("%s: configuration validation failed: %w", rawAppConfig.Source, err))
 					}
 				}
 			}
@@ -83,4 +83,7 @@ func getVersion(ctx context.Context, targetConfig *config.TargetConfig, targetSe
 		ui.Warn("haloy version %s does not match haloyd (server) version %s", cliVersion, response.Version)
 		ui.Warn("HAProxy version: %s", response.HAProxyVersion)
 	}
+	if response.SchemaVersion < response.LatestSchemaVersion {
+		ui.Warn("Database schema version %d is behind %d, run 'haloyadm db migrate' on the server", response.SchemaVersion, response.LatestSchemaVersion)
+	}
 }
@@ -0,0 +1,175 @@
+package haloyadm
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ameistad/haloy/internal/acme"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func AcmeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "acme",
+		Short: "Manage the ACME accounts used for certificates",
+	}
+
+	cmd.AddCommand(AcmeAccountsCmd())
+
+	return cmd
+}
+
+func AcmeAccountsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "accounts",
+		Short: "List, export and import ACME accounts",
+		Long: `List, export and import the ACME accounts haloyd requests certificates with.
+
+Accounts are created per ACME email the first time a certificate is requested. Export them to back them up or to
+use the same accounts on another server, e.g. to keep rate limit overrides tied to an account.`,
+	}
+
+	cmd.AddCommand(AcmeAccountsListCmd())
+	cmd.AddCommand(AcmeAccountsExportCmd())
+	cmd.AddCommand(AcmeAccountsImportCmd())
+
+	return cmd
+}
+
+func AcmeAccountsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the ACME accounts and their registrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			accountsDir, err := acmeAccountsDir()
+			if err != nil {
+				return err
+			}
+			accounts, err := acme.ListAccounts(accountsDir)
+			if err != nil {
+				return err
+			}
+			if len(accounts) == 0 {
+				ui.Info("No ACME accounts found")
+				return nil
+			}
+
+			var rows [][]string
+			for _, account := range accounts {
+				if len(account.Registrations) == 0 {
+					rows = append(rows, []string{account.Email, "-", "not registered", "-", "-"})
+					continue
+				}
+				for _, caDirURL := range slices.Sorted(maps.Keys(account.Registrations)) {
+					registration := account.Registrations[caDirURL]
+					rows = append(rows, []string{
+						account.Email,
+						acme.CAName(caDirURL),
+						registration.Status,
+						registration.URI,
+						registration.RegisteredAt.Local().Format("2006-01-02 15:04:05"),
+					})
+				}
+			}
+			ui.Table([]string{"EMAIL", "CA", "STATUS", "ACCOUNT URL", "REGISTERED"}, rows)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func AcmeAccountsExportCmd() *cobra.Command {
+	var outputPath string
+
+	cmd := &cobra.Command{
+		Use:   "export [email...]",
+		Short: "Export ACME accounts with their keys",
+		Long: `Export ACME accounts with their private keys as JSON, all accounts unless emails are given.
+The export holds the private keys, store it like a password.`,
+		Example: "  haloyadm acme accounts export -o accounts.json\n  haloyadm acme accounts export you@example.com > accounts.json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			accountsDir, err := acmeAccountsDir()
+			if err != nil {
+				return err
+			}
+			export, err := acme.ExportAccounts(accountsDir, args)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(export, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode accounts: %w", err)
+			}
+
+			if outputPath == "" {
+				fmt.Println(string(data))
+				return nil
+			}
+			if err := os.WriteFile(outputPath, data, constants.ModeFileSecret); err != nil {
+				return fmt.Errorf("failed to write %s: %w", outputPath, err)
+			}
+			ui.Success("Exported %d account(s) to %s", len(export.Accounts), outputPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "Write the export to this file instead of stdout")
+	return cmd
+}
+
+func AcmeAccountsImportCmd() *cobra.Command {
+	var overwrite bool
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import ACME accounts exported with 'haloyadm acme accounts export'",
+		Long: `Import ACME accounts exported with 'haloyadm acme accounts export'.
+
+Certificates are requested with the account of the ACME email in the haloyd config or the app config, so import
+the accounts of the emails used on this server. Restart haloyd with 'haloyadm restart' to use them.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", args[0], err)
+			}
+			var export acme.Export
+			if err := json.Unmarshal(data, &export); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", args[0], err)
+			}
+
+			accountsDir, err := acmeAccountsDir()
+			if err != nil {
+				return err
+			}
+			imported, err := acme.ImportAccounts(accountsDir, export, overwrite)
+			if err != nil {
+				return err
+			}
+			for _, email := range imported {
+				ui.Success("Imported account %s", email)
+			}
+			ui.Info("Restart haloyd with 'haloyadm restart' to use the imported accounts")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace existing accounts with a different key")
+	return cmd
+}
+
+func acmeAccountsDir() (string, error) {
+	dataDir, err := config.DataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine data directory: %w", err)
+	}
+	return filepath.Join(dataDir, constants.CertStorageDir, acme.AccountsDir), nil
+}
@@ -156,6 +156,7 @@ func APIDomainCmd() *cobra.Command {
 
 func APITokenCmd() *cobra.Command {
 	var raw bool
+	var approve bool
 	cmd := &cobra.Command{
 		Use:   "token",
 		Short: "Reveal API token",
@@ -181,13 +182,17 @@ func APITokenCmd() *cobra.Command {
 				return err
 			}
 
-			token, exists := env[constants.EnvVarAPIToken]
+			tokenName, tokenEnvVar := "API token", constants.EnvVarAPIToken
+			if approve {
+				tokenName, tokenEnvVar = "Approve token", constants.EnvVarApproveToken
+			}
+			token, exists := env[tokenEnvVar]
 			if !exists || token == "" {
-				err := fmt.Errorf("API token not found in %s", envFile)
+				err := fmt.Errorf("%s not found in %s", tokenName, envFile)
 				if raw {
 					fmt.Fprintln(os.Stderr, err)
 				} else {
-					ui.Error("API token not found in %s", envFile)
+					ui.Error("%s not found in %s", tokenName, envFile)
 				}
 				return err
 			}
@@ -195,12 +200,13 @@ func APITokenCmd() *cobra.Command {
 			if raw {
 				fmt.Print(token)
 			} else {
-				ui.Info("API token: %s\n", token)
+				ui.Info("%s: %s\n", tokenName, token)
 			}
 			return nil
 		},
 	}
 	cmd.Flags().BoolVar(&raw, "raw", false, "Output only the token value")
+	cmd.Flags().BoolVar(&approve, "approve", false, "Reveal the token that approves deployments")
 	return cmd
 }
 
@@ -260,6 +266,7 @@ const (
 func APINewTokenCmd() *cobra.Command {
 	var devMode bool
 	var debug bool
+	var approve bool
 	cmd := &cobra.Command{
 		Use:   "generate-token",
 		Short: "Generate a new API token and restart the haloyd",
@@ -289,7 +296,11 @@ func APINewTokenCmd() *cobra.Command {
 				ui.Error("Failed to read environment variables from %s: %v", envFile, err)
 				return
 			}
-			env[constants.EnvVarAPIToken] = token
+			tokenName, tokenEnvVar := "API token", constants.EnvVarAPIToken
+			if approve {
+				tokenName, tokenEnvVar = "approve token", constants.EnvVarApproveToken
+			}
+			env[tokenEnvVar] = token
 			if err := godotenv.Write(env, envFile); err != nil {
 				ui.Error("Failed to write environment variables to %s: %v", envFile, err)
 				return
@@ -305,11 +316,12 @@ func APINewTokenCmd() *cobra.Command {
 				return
 			}
 
-			ui.Success("Generated new API token and restarted haloyd")
-			ui.Info("New API token: %s\n", token)
+			ui.Success("Generated new %s and restarted haloyd", tokenName)
+			ui.Info("New %s: %s\n", tokenName, token)
 		},
 	}
 	cmd.Flags().BoolVar(&devMode, "dev", false, "Restart in development mode using the local haloyd image")
+	cmd.Flags().BoolVar(&approve, "approve", false, "Generate the token that approves deployments instead of the API token")
 	cmd.Flags().BoolVar(&debug, "debug", false, "Restart haloyd in debug mode")
 	return cmd
 }
@@ -323,6 +335,7 @@ func APICmd() *cobra.Command {
 	cmd.AddCommand(APIDomainCmd())
 	cmd.AddCommand(APITokenCmd())
 	cmd.AddCommand(APINewTokenCmd())
+	cmd.AddCommand(APIAppTokenCmd())
 	cmd.AddCommand(APIURLCmd())
 
 	return cmd
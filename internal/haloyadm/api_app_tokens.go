@@ -0,0 +1,147 @@
+package haloyadm
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// loadHaloydConfigForEdit loads the haloyd config and returns it with its path, or an empty config if the file
+// does not exist yet.
+func loadHaloydConfigForEdit() (*config.HaloydConfig, string, error) {
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to determine config directory: %w", err)
+	}
+	haloydConfigPath := filepath.Join(configDir, constants.HaloydConfigFileName)
+	haloydConfig, err := config.LoadHaloydConfig(haloydConfigPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load haloyd configuration: %w", err)
+	}
+	if haloydConfig == nil {
+		haloydConfig = &config.HaloydConfig{}
+	}
+	return haloydConfig, haloydConfigPath, nil
+}
+
+func APIAppTokenAddCmd() *cobra.Command {
+	var apps []string
+	cmd := &cobra.Command{
+		Use:   "add <name> --apps <pattern>",
+		Short: "Generate a token that can only manage the given apps",
+		Long: `Generate a token that can only manage the apps matching the patterns, e.g. for the CI pipeline of one project.
+Patterns support * and ? wildcards. The token is shown once, only its hash is stored in the haloyd config.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			haloydConfig, haloydConfigPath, err := loadHaloydConfigForEdit()
+			if err != nil {
+				ui.Error("%v", err)
+				return err
+			}
+
+			token, err := generateAPIToken()
+			if err != nil {
+				ui.Error("Failed to generate app token: %v", err)
+				return err
+			}
+			appToken := config.AppToken{Name: args[0], TokenHash: config.HashAPIToken(token), Apps: apps}
+			haloydConfig.API.AppTokens = append(haloydConfig.API.AppTokens, appToken)
+			if err := haloydConfig.Validate(); err != nil {
+				ui.Error("Invalid app token: %v", err)
+				return err
+			}
+			if err := config.SaveHaloydConfig(haloydConfig, haloydConfigPath); err != nil {
+				ui.Error("Failed to save haloyd configuration: %v", err)
+				return err
+			}
+
+			ui.Success("Added app token %s for apps %s", appToken.Name, strings.Join(apps, ", "))
+			ui.Info("Token: %s", token)
+			ui.Warn("Store the token now, it cannot be shown again.")
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&apps, "apps", nil, "App name patterns the token can manage, e.g. shop-* (required)")
+	_ = cmd.MarkFlagRequired("apps")
+	return cmd
+}
+
+func APIAppTokenRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove an app token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			haloydConfig, haloydConfigPath, err := loadHaloydConfigForEdit()
+			if err != nil {
+				ui.Error("%v", err)
+				return err
+			}
+
+			name := args[0]
+			tokens := haloydConfig.API.AppTokens
+			haloydConfig.API.AppTokens = slices.DeleteFunc(slices.Clone(tokens), func(t config.AppToken) bool {
+				return t.Name == name
+			})
+			if len(haloydConfig.API.AppTokens) == len(tokens) {
+				err := fmt.Errorf("app token %s not found", name)
+				ui.Error("%v", err)
+				return err
+			}
+			if err := config.SaveHaloydConfig(haloydConfig, haloydConfigPath); err != nil {
+				ui.Error("Failed to save haloyd configuration: %v", err)
+				return err
+			}
+
+			ui.Success("Removed app token %s", name)
+			return nil
+		},
+	}
+}
+
+func APIAppTokenListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List app tokens and the apps they can manage",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			haloydConfig, _, err := loadHaloydConfigForEdit()
+			if err != nil {
+				ui.Error("%v", err)
+				return err
+			}
+
+			if len(haloydConfig.API.AppTokens) == 0 {
+				ui.Info("No app tokens configured")
+				return nil
+			}
+			headers := []string{"NAME", "APPS"}
+			rows := make([][]string, 0, len(haloydConfig.API.AppTokens))
+			for _, t := range haloydConfig.API.AppTokens {
+				rows = append(rows, []string{t.Name, strings.Join(t.Apps, ", ")})
+			}
+			ui.Table(headers, rows)
+			return nil
+		},
+	}
+}
+
+func APIAppTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "app-token",
+		Short: "Manage tokens restricted to specific apps",
+		Long:  "Manage tokens restricted to specific apps. Changes are applied by haloyd without a restart.",
+	}
+
+	cmd.AddCommand(APIAppTokenAddCmd())
+	cmd.AddCommand(APIAppTokenRemoveCmd())
+	cmd.AddCommand(APIAppTokenListCmd())
+
+	return cmd
+}
@@ -0,0 +1,216 @@
+package haloyadm
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func ConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Read and change the haloyd config",
+		Long: fmt.Sprintf(`Read and change settings in %s.
+
+Keys are the YAML keys separated by dots, e.g. certificates.acme_email or api.domain.
+haloyd reloads the file when it changes, most settings are applied without a restart.`, constants.HaloydConfigFileName),
+	}
+
+	cmd.AddCommand(ConfigGetCmd())
+	cmd.AddCommand(ConfigSetCmd())
+
+	return cmd
+}
+
+func ConfigGetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get [key]",
+		Short: "Print a setting, or the whole config without a key",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			haloydConfig, _, err := loadHaloydConfigFile()
+			if err != nil {
+				return err
+			}
+
+			value := reflect.ValueOf(haloydConfig).Elem()
+			if len(args) == 1 {
+				if value, err = configField(value, args[0]); err != nil {
+					return err
+				}
+			}
+
+			if value.Kind() == reflect.Pointer {
+				if value.IsNil() {
+					return nil
+				}
+				value = value.Elem()
+			}
+			switch value.Kind() {
+			case reflect.Struct, reflect.Slice, reflect.Map:
+				data, err := yaml.Marshal(value.Interface())
+				if err != nil {
+					return fmt.Errorf("failed to marshal config: %w", err)
+				}
+				fmt.Print(string(data))
+			default:
+				fmt.Println(value.Interface())
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func ConfigSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Change a setting",
+		Long: `Change a setting. The config is validated before it's saved and an empty value removes the setting.
+
+Examples:
+  haloyadm config set certificates.acme_email you@example.com
+  haloyadm config set api.domain haloy.example.com
+  haloyadm config set logging.level debug`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, value := args[0], args[1]
+
+			if err := checkDirectoryAccess(RequiredAccess{Config: true}); err != nil {
+				return err
+			}
+
+			haloydConfig, path, err := loadHaloydConfigFile()
+			if err != nil {
+				return err
+			}
+
+			if key == "api.domain" && value != "" {
+				if value, err = helpers.NormalizeServerURL(value); err != nil {
+					return fmt.Errorf("invalid domain: %w", err)
+				}
+			}
+
+			field, err := configField(reflect.ValueOf(haloydConfig).Elem(), key)
+			if err != nil {
+				return err
+			}
+			if err := setConfigField(field, value); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", key, err)
+			}
+
+			if err := haloydConfig.Validate(); err != nil {
+				return fmt.Errorf("config not saved: %w", err)
+			}
+			if err := config.SaveHaloydConfig(haloydConfig, path); err != nil {
+				return fmt.Errorf("failed to save haloyd config: %w", err)
+			}
+
+			if value == "" {
+				ui.Success("Removed %s", key)
+			} else {
+				ui.Success("Set %s to '%s'", key, value)
+			}
+			if config.RequiresRestart(key) {
+				ui.Info("Run 'haloyadm restart' to apply the change")
+			} else {
+				ui.Info("haloyd applies the change automatically")
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+// loadHaloydConfigFile loads the haloyd config file, or an empty config if it doesn't exist yet.
+func loadHaloydConfigFile() (*config.HaloydConfig, string, error) {
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to determine config directory: %w", err)
+	}
+	path := filepath.Join(configDir, constants.HaloydConfigFileName)
+	haloydConfig, err := config.LoadHaloydConfig(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load haloyd config: %w", err)
+	}
+	if haloydConfig == nil {
+		haloydConfig = &config.HaloydConfig{}
+	}
+	return haloydConfig, path, nil
+}
+
+// configField returns the field of the config struct at a dot separated key of YAML names.
+func configField(value reflect.Value, key string) (reflect.Value, error) {
+	for name := range strings.SplitSeq(key, ".") {
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown key '%s'", key)
+		}
+
+		found := false
+		for i := range value.NumField() {
+			tag, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("yaml"), ",")
+			if tag == name {
+				value = value.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown key '%s'", key)
+		}
+	}
+	return value, nil
+}
+
+// setConfigField parses the value into a single value field. Lists and sections have to be edited in the file.
+func setConfigField(field reflect.Value, value string) error {
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.Kind() == reflect.Pointer {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not true or false", value)
+		}
+		field.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		field.SetInt(int64(parsed))
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("not a single value, edit %s instead", constants.HaloydConfigFileName)
+	}
+	return nil
+}
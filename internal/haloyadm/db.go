@@ -0,0 +1,183 @@
+package haloyadm
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func DBCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the haloyd database schema",
+		Long: `Show and change the schema version of the haloyd database.
+
+haloyd applies pending migrations at startup unless database.manual_migrations is set in the haloyd config.
+The database is backed up to the db-backups directory in the data dir before it is changed.`,
+	}
+
+	cmd.AddCommand(DBStatusCmd())
+	cmd.AddCommand(DBMigrateCmd())
+	cmd.AddCommand(DBRollbackCmd())
+
+	return cmd
+}
+
+func DBStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the schema version and the migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := storage.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			statuses, err := db.Migrations()
+			if err != nil {
+				return err
+			}
+
+			rows := make([][]string, 0, len(statuses))
+			pending := 0
+			for _, status := range statuses {
+				applied := "pending"
+				if status.AppliedAt != nil {
+					applied = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+				} else {
+					pending++
+				}
+				rows = append(rows, []string{strconv.Itoa(status.Version), status.Name, applied})
+			}
+			ui.Table([]string{"VERSION", "NAME", "APPLIED"}, rows)
+
+			version, err := db.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				ui.Warn("Schema version %d, %d pending migration(s), latest is %d", version, pending, storage.LatestSchemaVersion())
+			} else {
+				ui.Success("Schema version %d is up to date", version)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func DBMigrateCmd() *cobra.Command {
+	var toVersion int
+	var noBackup bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := storage.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			current, err := db.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			target := storage.LatestSchemaVersion()
+			if toVersion > 0 {
+				target = toVersion
+			}
+			if current >= target {
+				ui.Success("Schema version %d is up to date", current)
+				return nil
+			}
+
+			if !noBackup {
+				backupPath, err := db.BackupBeforeMigrate()
+				if err != nil {
+					return err
+				}
+				ui.Info("Backed up database to %s", backupPath)
+			}
+
+			if err := db.MigrateTo(target); err != nil {
+				return err
+			}
+			ui.Success("Migrated database schema from version %d to %d", current, target)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&toVersion, "to", 0, "Migrate up to this schema version instead of the latest")
+	cmd.Flags().BoolVar(&noBackup, "no-backup", false, "Don't back up the database before migrating")
+	return cmd
+}
+
+func DBRollbackCmd() *cobra.Command {
+	var steps int
+	var noBackup bool
+
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Revert the last applied migrations",
+		Long: `Revert the last applied migrations. Tables created by the reverted migrations are dropped with their data.
+
+haloyd must be stopped with 'haloyadm stop' first. Set database.manual_migrations in the haloyd config,
+otherwise haloyd migrates the database again when it starts.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exists, err := containerExists(cmd.Context(), config.HaloydLabelRole)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return errors.New("haloyd is running, stop it with 'haloyadm stop' before rolling back")
+			}
+
+			db, err := storage.New()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			current, err := db.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			if current == 0 {
+				ui.Info("No migrations to roll back")
+				return nil
+			}
+
+			if !noBackup {
+				backupPath, err := db.BackupBeforeMigrate()
+				if err != nil {
+					return err
+				}
+				ui.Info("Backed up database to %s", backupPath)
+			}
+
+			if err := db.Rollback(steps); err != nil {
+				return err
+			}
+			version, err := db.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			ui.Success("Rolled back database schema from version %d to %d", current, version)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&steps, "steps", 1, "Number of migrations to revert")
+	cmd.Flags().BoolVar(&noBackup, "no-backup", false, "Don't back up the database before rolling back")
+	return cmd
+}
@@ -0,0 +1,303 @@
+package haloyadm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apiclient"
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/ui"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Let's Encrypt rejects requests and certificates look invalid when the clock is off by more than this.
+	maxClockSkew   = time.Minute
+	clockSourceURL = "https://acme-v02.api.letsencrypt.org/directory"
+)
+
+// doctorCheck is a single check run by haloyadm doctor. Checks that need Docker are skipped when it can't be reached.
+type doctorCheck struct {
+	name        string
+	needsDocker bool
+	run         func(ctx context.Context, env doctorEnv) error
+}
+
+type doctorEnv struct {
+	dataDir      string
+	configDir    string
+	haloydConfig *config.HaloydConfig
+}
+
+// checkFailure is returned by checks to show how to fix the problem.
+type checkFailure struct {
+	err error
+	fix string
+}
+
+func (f *checkFailure) Error() string {
+	return f.err.Error()
+}
+
+func failCheck(fix string, format string, a ...any) error {
+	return &checkFailure{err: fmt.Errorf(format, a...), fix: fix}
+}
+
+func DoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the server setup for common problems",
+		Long: `Check the server setup for common problems and print how to fix them.
+
+Checks Docker, the haloy network, the HAProxy ports, directory permissions, the .env file,
+the certificate directory, the system clock and the haloyd API.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			dataDir, err := config.DataDir()
+			if err != nil {
+				return fmt.Errorf("failed to determine data directory: %w", err)
+			}
+			configDir, err := config.ConfigDir()
+			if err != nil {
+				return fmt.Errorf("failed to determine config directory: %w", err)
+			}
+
+			env := doctorEnv{dataDir: dataDir, configDir: configDir}
+			// An invalid config is reported by the config check, the other checks use the defaults.
+			if haloydConfig, err := loadHaloydConfig(configDir); err == nil {
+				env.haloydConfig = haloydConfig
+			} else {
+				env.haloydConfig = (&config.HaloydConfig{}).Normalize()
+			}
+
+			failed := 0
+			dockerOK := true
+			for _, check := range doctorChecks() {
+				if check.needsDocker && !dockerOK {
+					ui.Warn("%s: skipped, Docker is not reachable", check.name)
+					continue
+				}
+
+				checkCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+				err := check.run(checkCtx, env)
+				cancel()
+				if err == nil {
+					ui.Success("%s", check.name)
+					continue
+				}
+
+				failed++
+				if check.name == "Docker" {
+					dockerOK = false
+				}
+				ui.Error("%s: %v", check.name, err)
+				var failure *checkFailure
+				if errors.As(err, &failure) && failure.fix != "" {
+					ui.Info("  Fix: %s", failure.fix)
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d check(s) failed", failed)
+			}
+			ui.Success("All checks passed")
+			return nil
+		},
+	}
+	return cmd
+}
+
+func doctorChecks() []doctorCheck {
+	return []doctorCheck{
+		{name: "Docker", run: checkDocker},
+		{name: "Docker network", needsDocker: true, run: checkNetwork},
+		{name: "HAProxy ports", needsDocker: true, run: checkProxyPorts},
+		{name: "Config directory", run: func(ctx context.Context, env doctorEnv) error {
+			return checkDirectory(env.configDir, false)
+		}},
+		{name: "Data directory", run: func(ctx context.Context, env doctorEnv) error {
+			return checkDirectory(env.dataDir, true)
+		}},
+		{name: "Certificate directory", run: func(ctx context.Context, env doctorEnv) error {
+			return checkDirectory(filepath.Join(env.dataDir, constants.CertStorageDir), true)
+		}},
+		{name: "haloyd config", run: checkHaloydConfig},
+		{name: "Environment file", run: checkEnvFile},
+		{name: "System clock", run: checkClock},
+		{name: "haloyd API", run: checkAPI},
+	}
+}
+
+func checkDocker(ctx context.Context, env doctorEnv) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", "info", "--format", "{{.ServerVersion}}")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return failCheck("install Docker, see https://docs.docker.com/engine/install/", "docker command not found")
+		}
+		message := strings.TrimSpace(stderr.String())
+		if strings.Contains(message, "permission denied") {
+			return failCheck("add your user to the docker group with 'sudo usermod -aG docker $USER' and log in again, or run haloyadm with sudo",
+				"permission denied connecting to the Docker daemon")
+		}
+		if hint := rootlessHint(); hint != "" {
+			return failCheck(hint, "Docker daemon not reachable: %s", message)
+		}
+		return failCheck("start Docker with 'sudo systemctl start docker'", "Docker daemon not reachable: %s", message)
+	}
+	return nil
+}
+
+func checkNetwork(ctx context.Context, env doctorEnv) error {
+	cmd := exec.CommandContext(ctx, "docker", "network", "ls", "--filter", fmt.Sprintf("name=%s", constants.DockerNetwork), "--format", "{{.Name}}")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list Docker networks: %w", err)
+	}
+	if !slices.Contains(strings.Split(strings.TrimSpace(string(output)), "\n"), constants.DockerNetwork) {
+		return failCheck(fmt.Sprintf("run 'haloyadm start' or 'docker network create --driver bridge --attachable %s'", constants.DockerNetwork),
+			"network %s does not exist", constants.DockerNetwork)
+	}
+	return nil
+}
+
+// checkProxyPorts verifies that the HAProxy ports are published by the haloy HAProxy container or free.
+func checkProxyPorts(ctx context.Context, env doctorEnv) error {
+	ports := []int{env.haloydConfig.Proxy.HTTPPort, env.haloydConfig.Proxy.HTTPSPort}
+	for _, frontend := range env.haloydConfig.Proxy.Frontends {
+		ports = append(ports, frontend.Port)
+	}
+
+	// Output lines look like "80/tcp -> 0.0.0.0:80", empty when the container doesn't exist.
+	published, _ := exec.CommandContext(ctx, "docker", "port", constants.HAProxyContainerName).Output()
+
+	var inUse []string
+	for _, port := range ports {
+		if strings.Contains(string(published), fmt.Sprintf("%d/tcp ->", port)) {
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+		if err != nil {
+			continue // Nothing is listening
+		}
+		conn.Close()
+		inUse = append(inUse, strconv.Itoa(port))
+	}
+
+	if len(inUse) > 0 {
+		return failCheck(fmt.Sprintf("find the process with 'sudo ss -ltnp' and stop it, e.g. another web server, or change the ports in %s", constants.HaloydConfigFileName),
+			"port(s) %s in use by another process", strings.Join(inUse, ", "))
+	}
+	return nil
+}
+
+// checkDirectory verifies that a directory exists, is writable and, for directories used by haloyd,
+// is owned by the current user since haloyd runs with the same user ID.
+func checkDirectory(dir string, ownedByUser bool) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return failCheck("run 'haloyadm init'", "%s does not exist", dir)
+		}
+		return failCheck("run haloyadm with sudo for a system install", "cannot access %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return failCheck(fmt.Sprintf("remove %s and run 'haloyadm init'", dir), "%s is not a directory", dir)
+	}
+
+	testFile := filepath.Join(dir, ".haloyadm-doctor-test")
+	if err := os.WriteFile(testFile, []byte("test"), constants.ModeFileDefault); err != nil {
+		return failCheck(fmt.Sprintf("run 'sudo chown -R %d:%d %s'", os.Getuid(), os.Getgid(), dir), "%s is not writable: %v", dir, err)
+	}
+	_ = os.Remove(testFile)
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && ownedByUser && int(stat.Uid) != os.Getuid() {
+		return failCheck(fmt.Sprintf("run 'sudo chown -R %d:%d %s'", os.Getuid(), os.Getgid(), dir),
+			"%s is owned by user %d, haloyd runs as user %d", dir, stat.Uid, os.Getuid())
+	}
+	return nil
+}
+
+func checkHaloydConfig(ctx context.Context, env doctorEnv) error {
+	if _, err := loadHaloydConfig(env.configDir); err != nil {
+		return failCheck(fmt.Sprintf("correct %s", filepath.Join(env.configDir, constants.HaloydConfigFileName)), "%v", err)
+	}
+	return nil
+}
+
+func checkEnvFile(ctx context.Context, env doctorEnv) error {
+	envFile := filepath.Join(env.configDir, constants.ConfigEnvFileName)
+	values, err := godotenv.Read(envFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return failCheck("run 'haloyadm init'", "%s does not exist", envFile)
+		}
+		return failCheck(fmt.Sprintf("correct the syntax of %s, values with spaces or quotes must be quoted", envFile), "failed to parse %s: %v", envFile, err)
+	}
+	if values[constants.EnvVarAPIToken] == "" {
+		return failCheck("run 'haloyadm api generate-token'", "%s is not set in %s", constants.EnvVarAPIToken, envFile)
+	}
+	if info, err := os.Stat(envFile); err == nil && info.Mode().Perm()&0o077 != 0 {
+		return failCheck(fmt.Sprintf("run 'chmod 600 %s'", envFile), "%s is readable by other users and contains the API token", envFile)
+	}
+	return nil
+}
+
+// checkClock compares the system clock with the Date header of the Let's Encrypt API.
+func checkClock(ctx context.Context, env doctorEnv) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, clockSourceURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return failCheck("check that the server can make outbound HTTPS requests", "failed to reach %s: %v", clockSourceURL, err)
+	}
+	resp.Body.Close()
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("failed to parse time from %s: %w", clockSourceURL, err)
+	}
+	skew := time.Since(remote).Round(time.Second)
+	if skew.Abs() > maxClockSkew {
+		return failCheck("enable time synchronization with 'sudo timedatectl set-ntp true'", "system clock is off by %s", skew)
+	}
+	return nil
+}
+
+func checkAPI(ctx context.Context, env doctorEnv) error {
+	apiURL := fmt.Sprintf("http://localhost:%s", constants.APIServerPort)
+	values, _ := godotenv.Read(filepath.Join(env.configDir, constants.ConfigEnvFileName))
+	api, err := apiclient.New(apiURL, values[constants.EnvVarAPIToken])
+	if err != nil {
+		return err
+	}
+
+	if err := api.HealthCheck(ctx); err != nil {
+		return failCheck("start the services with 'haloyadm start' and check 'docker logs haloyd'", "haloyd API not ready at %s: %v", apiURL, err)
+	}
+	var version apitypes.VersionResponse
+	if err := api.Get(ctx, "version", &version); err != nil {
+		return failCheck("restart haloyd with 'haloyadm restart' after changing the token in .env", "haloyd rejected the API token: %v", err)
+	}
+	return nil
+}
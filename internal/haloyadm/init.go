@@ -83,6 +83,21 @@ The data directory can be customized by setting the %s environment variable.`,
 				return
 			}
 
+			daemon, err := detectDockerDaemon(ctx)
+			if err != nil {
+				ui.Error("%v\n", err)
+				return
+			}
+			if daemon.Rootless {
+				if config.IsSystemMode() {
+					ui.Error("Rootless Docker can't be used with a system install, the daemon runs as your user and can't access the system directories.\n" +
+						"Run 'haloyadm init --local-install' without sudo.")
+					return
+				}
+				ui.Info("Rootless Docker detected, using socket %s", daemon.SocketPath)
+				ui.Info("Apps may see an internal address instead of the client IP, depending on the RootlessKit port driver.")
+			}
+
 			dataDir, err := config.DataDir()
 			if err != nil {
 				ui.Error("Failed to determine data directory: %v\n", err)
@@ -156,9 +171,9 @@ The data directory can be customized by setting the %s environment variable.`,
 				waitCtx, waitCancel := context.WithTimeout(ctx, 30*time.Second)
 				defer waitCancel()
 
-				ui.Info("Waiting for HAProxy to become available...")
-				if err := waitForHAProxy(waitCtx); err != nil {
-					ui.Error("HAProxy failed to become ready: %v", err)
+				ui.Info("Waiting for the proxy to become available...")
+				if err := waitForProxy(waitCtx, configDir); err != nil {
+					ui.Error("The proxy failed to become ready: %v", err)
 					return
 				}
 
@@ -275,7 +290,12 @@ func copyConfigTemplateFiles(dataDir string) error {
 		HTTPFrontend:            "",
 		HTTPSFrontend:           "",
 		HTTPSFrontendUseBackend: "",
+		Frontends:               "",
 		Backends:                "",
+		HTTPPort:                config.DefaultProxyHTTPPort,
+		HTTPSPort:               config.DefaultProxyHTTPSPort,
+		StatsSocket:             "/usr/local/etc/haproxy-run/" + constants.HAProxyStatsSocket,
+		AdminSocketUID:          os.Getuid(),
 	}
 
 	haproxyConfigFile, err := renderTemplate(fmt.Sprintf("templates/%s", constants.HAProxyConfigFileName), haproxyConfigTemplateData)
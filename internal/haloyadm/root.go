@@ -24,6 +24,10 @@ func NewRootCmd() *cobra.Command {
 		RestartCmd(),
 		StopCmd(),
 		APICmd(),
+		ConfigCmd(),
+		DBCmd(),
+		AcmeCmd(),
+		DoctorCmd(),
 	)
 
 	return cmd
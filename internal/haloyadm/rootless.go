@@ -0,0 +1,128 @@
+package haloyadm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+const (
+	defaultDockerSocket = "/var/run/docker.sock"
+	// Ports below this are privileged unless the sysctl is lowered, which rootless Docker can't bypass.
+	unprivilegedPortStartFile = "/proc/sys/net/ipv4/ip_unprivileged_port_start"
+	defaultUnprivilegedPort   = 1024
+)
+
+// dockerDaemon describes the Docker daemon haloyadm talks to.
+type dockerDaemon struct {
+	Rootless   bool
+	SocketPath string // Path of the daemon socket on the host, mounted into haloyd
+}
+
+// detectDockerDaemon asks the Docker daemon whether it runs rootless and finds the socket it listens on.
+func detectDockerDaemon(ctx context.Context) (dockerDaemon, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", "info", "--format", "{{json .SecurityOptions}}")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		if hint := rootlessHint(); hint != "" {
+			return dockerDaemon{}, fmt.Errorf("failed to connect to the Docker daemon: %s\n%s", message, hint)
+		}
+		return dockerDaemon{}, fmt.Errorf("failed to connect to the Docker daemon: %s", message)
+	}
+
+	daemon := dockerDaemon{
+		Rootless:   strings.Contains(stdout.String(), "name=rootless"),
+		SocketPath: defaultDockerSocket,
+	}
+	if socket := dockerSocketPath(ctx); socket != "" {
+		daemon.SocketPath = socket
+	} else if daemon.Rootless {
+		daemon.SocketPath = rootlessSocketPath()
+	}
+	return daemon, nil
+}
+
+// dockerSocketPath returns the unix socket of the current Docker context, or an empty string
+// when the daemon is reached some other way.
+func dockerSocketPath(ctx context.Context) string {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		output, err := exec.CommandContext(ctx, "docker", "context", "inspect", "--format", "{{.Endpoints.docker.Host}}").Output()
+		if err != nil {
+			return ""
+		}
+		host = strings.TrimSpace(string(output))
+	}
+	if socket, ok := strings.CutPrefix(host, "unix://"); ok {
+		return socket
+	}
+	return ""
+}
+
+// rootlessSocketPath returns the default socket of a rootless Docker daemon run by the current user.
+func rootlessSocketPath() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return filepath.Join(runtimeDir, "docker.sock")
+}
+
+// rootlessHint explains how to reach a rootless daemon when haloyadm runs as root and there's no
+// system daemon, which happens when haloyadm is run with sudo on a rootless host.
+func rootlessHint() string {
+	if os.Geteuid() != 0 {
+		return ""
+	}
+	if _, err := os.Stat(defaultDockerSocket); err == nil {
+		return ""
+	}
+	sockets, _ := filepath.Glob("/run/user/*/docker.sock")
+	if len(sockets) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Docker appears to run rootless (%s). Rootless Docker runs per user, "+
+		"run 'haloyadm init' as that user without sudo.", sockets[0])
+}
+
+// checkRootlessPorts returns an error when the proxy ports are privileged, rootless Docker can't publish them.
+func checkRootlessPorts(proxyConfig config.ProxyConfig) error {
+	start := defaultUnprivilegedPort
+	if data, err := os.ReadFile(unprivilegedPortStartFile); err == nil {
+		if value, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			start = value
+		}
+	}
+
+	ports := []int{proxyConfig.HTTPPort, proxyConfig.HTTPSPort}
+	for _, frontend := range proxyConfig.Frontends {
+		ports = append(ports, frontend.Port)
+	}
+	lowest := 0
+	for _, port := range ports {
+		if port < start && (lowest == 0 || port < lowest) {
+			lowest = port
+		}
+	}
+	if lowest == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("rootless Docker can't publish port %d, ports below %d are privileged on this host.\n"+
+		"Allow them with 'sudo sysctl net.ipv4.ip_unprivileged_port_start=%d' (add it to /etc/sysctl.d/ to persist it), "+
+		"or set proxy.http_port and proxy.https_port in %s to %d or higher", lowest, start, lowest, constants.HaloydConfigFileName, start)
+}
@@ -6,12 +6,15 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,9 +35,10 @@ func startHaloyd(ctx context.Context, dataDir, configDir string, devMode bool, d
 		image = fmt.Sprintf("ghcr.io/ameistad/haloy-haloyd:%s", constants.Version)
 	}
 
-	uid := os.Getuid()
-	gid := os.Getgid()
-	dockerGID := getDockerGroupID()
+	daemon, err := detectDockerDaemon(ctx)
+	if err != nil {
+		return err
+	}
 
 	args := []string{
 		"run",
@@ -44,17 +48,27 @@ func startHaloyd(ctx context.Context, dataDir, configDir string, devMode bool, d
 		"--publish", fmt.Sprintf("127.0.0.1:%s:%s", constants.APIServerPort, constants.APIServerPort),
 		"--volume", fmt.Sprintf("%s:%s:ro", configDir, configDir), // /etc/haloy or ~/.config/haloy
 		"--volume", fmt.Sprintf("%s:%s:rw", dataDir, dataDir), // /var/lib/haloy or ~/.local/share/haloy
-		"--volume", "/var/run/docker.sock:/var/run/docker.sock:rw",
-		"--user", fmt.Sprintf("%d:%d", uid, gid),
-		"--group-add", dockerGID,
+		"--volume", fmt.Sprintf("%s:%s:rw", daemon.SocketPath, defaultDockerSocket),
 		"--label", fmt.Sprintf("%s=%s", config.LabelRole, config.HaloydLabelRole),
 		"--restart", "unless-stopped",
+		// Gives running deployments time to finish before Docker kills haloyd.
+		"--stop-timeout", "60",
 		"--network", constants.DockerNetwork,
 		// Path environment variables so we can use paths functions and get the same results as on the host system.
 		"--env", fmt.Sprintf("%s=%s", constants.EnvVarDataDir, dataDir),
 		"--env", fmt.Sprintf("%s=%s", constants.EnvVarConfigDir, configDir),
 		"--env", fmt.Sprintf("%s=%s", constants.EnvVarSystemInstall, fmt.Sprintf("%t", config.IsSystemMode())),
 	}
+	if daemon.Rootless {
+		// Root in the container is the current user on the host with rootless Docker, which owns the socket
+		// and the directories. There's no docker group to add.
+		args = append(args, "--user", "0:0")
+	} else {
+		args = append(args,
+			"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+			"--group-add", getDockerGroupID(),
+		)
+	}
 
 	// using godotenv to add env variables from .env because --env-file does not support quotes in values.
 	envFile := filepath.Join(configDir, constants.ConfigEnvFileName)
@@ -108,16 +122,89 @@ func getDockerGroupID() string {
 	return "999"
 }
 
-// startHAProxy runs the docker command to start HAProxy.
-func startHAProxy(ctx context.Context, dataDir string) error {
-	cmd := exec.CommandContext(ctx, "docker", "run",
+// proxyContainers are the proxy backends by label role, with their container names.
+var proxyContainers = []struct{ role, name string }{
+	{config.HAProxyLabelRole, constants.HAProxyContainerName},
+	{config.CaddyLabelRole, constants.CaddyContainerName},
+}
+
+// proxyLabelRole returns the label role of the container of the proxy backend in the proxy config.
+func proxyLabelRole(proxyConfig config.ProxyConfig) string {
+	if proxyConfig.Backend == config.ProxyBackendCaddy {
+		return config.CaddyLabelRole
+	}
+	return config.HAProxyLabelRole
+}
+
+// startProxy starts the container of the proxy backend selected in the proxy config.
+func startProxy(ctx context.Context, dataDir string, proxyConfig config.ProxyConfig) error {
+	if proxyConfig.Backend == config.ProxyBackendCaddy {
+		return startCaddy(ctx, dataDir, proxyConfig)
+	}
+	return startHAProxy(ctx, dataDir, proxyConfig)
+}
+
+// proxyPublishArgs returns the --publish arguments for the ports from the proxy config.
+func proxyPublishArgs(ctx context.Context, proxyConfig config.ProxyConfig) ([]string, error) {
+	daemon, err := detectDockerDaemon(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if daemon.Rootless {
+		if err := checkRootlessPorts(proxyConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	// The slirp4netns port driver of rootless Docker only forwards IPv4, so ports are bound to 0.0.0.0
+	// instead of all addresses.
+	publishAddress := ""
+	if daemon.Rootless {
+		publishAddress = "0.0.0.0"
+	}
+	publish := func(address string, port int) string {
+		if address == "" {
+			address = publishAddress
+		}
+		if address == "" {
+			return fmt.Sprintf("%d:%d", port, port)
+		}
+		return net.JoinHostPort(address, strconv.Itoa(port)) + ":" + strconv.Itoa(port)
+	}
+
+	args := []string{
+		"--publish", publish("", proxyConfig.HTTPPort),
+		"--publish", publish("", proxyConfig.HTTPSPort),
+	}
+	for _, frontend := range proxyConfig.Frontends {
+		args = append(args, "--publish", publish(frontend.Address, frontend.Port))
+	}
+	return args, nil
+}
+
+// startHAProxy runs the docker command to start HAProxy, publishing the ports from the proxy config.
+func startHAProxy(ctx context.Context, dataDir string, proxyConfig config.ProxyConfig) error {
+	publishArgs, err := proxyPublishArgs(ctx, proxyConfig)
+	if err != nil {
+		return err
+	}
+
+	// haloyd reads metrics and updates the domain maps through the sockets HAProxy creates in the run directory.
+	runDir := filepath.Join(dataDir, constants.HAProxyRunDir)
+	if err := os.MkdirAll(runDir, constants.ModeDirPrivate); err != nil {
+		return fmt.Errorf("failed to create %s: %w", runDir, err)
+	}
+
+	args := []string{"run",
 		"--detach",
 		"--name", constants.HAProxyContainerName,
-		"--publish", "80:80",
-		"--publish", "443:443",
+	}
+	args = append(args, publishArgs...)
+	args = append(args,
 		"--volume", fmt.Sprintf("%s/%s:/usr/local/etc/haproxy:ro", dataDir, constants.HAProxyConfigDir),
 		"--volume", fmt.Sprintf("%s/%s:/usr/local/etc/haproxy-certs:rw", dataDir, constants.CertStorageDir),
 		"--volume", fmt.Sprintf("%s/error-pages:/usr/local/etc/haproxy-errors:ro", dataDir),
+		"--volume", fmt.Sprintf("%s:/usr/local/etc/haproxy-run:rw", runDir),
 		"--label", fmt.Sprintf("%s=%s", config.LabelRole, config.HAProxyLabelRole),
 		// Running as root is necessary for privileged ports 80 and 443.
 		"--user", "root",
@@ -125,6 +212,7 @@ func startHAProxy(ctx context.Context, dataDir string) error {
 		"--network", constants.DockerNetwork,
 		fmt.Sprintf("haproxy:%s", constants.HAProxyVersion),
 	)
+	cmd := exec.CommandContext(ctx, "docker", args...)
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
@@ -139,6 +227,55 @@ func startHAProxy(ctx context.Context, dataDir string) error {
 	return nil
 }
 
+// startCaddy runs the docker command to start Caddy. The Caddyfile is written by haloyd, until then
+// Caddy starts with an empty config. Certificates are kept in the caddy-data directory.
+func startCaddy(ctx context.Context, dataDir string, proxyConfig config.ProxyConfig) error {
+	publishArgs, err := proxyPublishArgs(ctx, proxyConfig)
+	if err != nil {
+		return err
+	}
+
+	configDir := filepath.Join(dataDir, constants.CaddyConfigDir)
+	for _, dir := range []string{configDir, filepath.Join(dataDir, constants.CaddyDataDir)} {
+		if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	caddyfile := filepath.Join(configDir, constants.CaddyConfigFileName)
+	if _, err := os.Stat(caddyfile); errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(caddyfile, []byte("# Generated by haloyd, changes are overwritten.\n"), constants.ModeFileDefault); err != nil {
+			return fmt.Errorf("failed to write %s: %w", caddyfile, err)
+		}
+	}
+
+	args := []string{"run",
+		"--detach",
+		"--name", constants.CaddyContainerName,
+	}
+	args = append(args, publishArgs...)
+	args = append(args,
+		"--volume", fmt.Sprintf("%s:/etc/caddy:ro", configDir),
+		"--volume", fmt.Sprintf("%s/%s:/data:rw", dataDir, constants.CaddyDataDir),
+		"--label", fmt.Sprintf("%s=%s", config.LabelRole, config.CaddyLabelRole),
+		"--restart", "unless-stopped",
+		"--network", constants.DockerNetwork,
+		fmt.Sprintf("caddy:%s", constants.CaddyVersion),
+	)
+	cmd := exec.CommandContext(ctx, "docker", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("failed to start caddy: %s", stderr.String())
+		}
+		return fmt.Errorf("failed to start caddy: %w", err)
+	}
+
+	return nil
+}
+
 // containerExists checks if a haloy container with the given role exists (running or stopped).
 func containerExists(ctx context.Context, role string) (bool, error) {
 	cmd := exec.CommandContext(ctx, "docker", "ps", "-a",
@@ -157,44 +294,73 @@ func containerExists(ctx context.Context, role string) (bool, error) {
 	return output != "", nil
 }
 
+// loadHaloydConfig loads and validates the haloyd config with defaults applied. A missing file gives the defaults.
+func loadHaloydConfig(configDir string) (*config.HaloydConfig, error) {
+	haloydConfig, err := config.LoadHaloydConfig(filepath.Join(configDir, constants.HaloydConfigFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load haloyd config: %w", err)
+	}
+	if haloydConfig == nil {
+		haloydConfig = &config.HaloydConfig{}
+	}
+	if err := haloydConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid haloyd config: %w", err)
+	}
+	return haloydConfig.Normalize(), nil
+}
+
 func startServices(ctx context.Context, dataDir, configDir string, devMode, restart, debug bool) error {
+	haloydConfig, err := loadHaloydConfig(configDir)
+	if err != nil {
+		return err
+	}
+
 	haloydExists, err := containerExists(ctx, config.HaloydLabelRole)
 	if err != nil {
 		return fmt.Errorf("failed to check haloyd container: %w", err)
 	}
 
-	haproxyExists, err := containerExists(ctx, config.HAProxyLabelRole)
-	if err != nil {
-		return fmt.Errorf("failed to check haloy-haproxy container: %w", err)
+	// All proxy containers are checked, so a proxy left over from another backend doesn't hold the ports.
+	var existingProxies []string
+	for _, proxy := range proxyContainers {
+		exists, err := containerExists(ctx, proxy.role)
+		if err != nil {
+			return fmt.Errorf("failed to check %s container: %w", proxy.name, err)
+		}
+		if exists {
+			existingProxies = append(existingProxies, proxy.role)
+		}
 	}
 
 	if !restart {
 		if haloydExists {
 			return fmt.Errorf("haloyd container already exists, use haloyadm restart instead")
 		}
-		if haproxyExists {
-			return fmt.Errorf("haloy-haproxy container already exists, use haloyadm restart instead")
+		if len(existingProxies) > 0 {
+			return fmt.Errorf("%s container already exists, use haloyadm restart instead", existingProxies[0])
 		}
 	}
 
 	if restart {
+		// haloyd is stopped first, it recreates a missing proxy container.
 		if haloydExists {
 			if err := stopContainer(ctx, config.HaloydLabelRole); err != nil {
 				return fmt.Errorf("failed to stop existing haloyd: %w", err)
 			}
 		}
-		if haproxyExists {
-			if err := stopContainer(ctx, config.HAProxyLabelRole); err != nil {
-				return fmt.Errorf("failed to stop existing haloy-haproxy: %w", err)
+		for _, role := range existingProxies {
+			if err := stopContainer(ctx, role); err != nil {
+				return fmt.Errorf("failed to stop existing %s: %w", role, err)
 			}
 		}
 	}
 
-	if err := startHaloyd(ctx, dataDir, configDir, devMode, debug); err != nil {
+	// The proxy is started first, haloyd recreates it when it's missing.
+	if err := startProxy(ctx, dataDir, haloydConfig.Proxy); err != nil {
 		return err
 	}
 
-	if err := startHAProxy(ctx, dataDir); err != nil {
+	if err := startHaloyd(ctx, dataDir, configDir, devMode, debug); err != nil {
 		return err
 	}
 
@@ -222,6 +388,10 @@ func stopContainer(ctx context.Context, role string) error {
 	containerName := strings.Split(output, "\n")[0]
 	containerName = strings.TrimSpace(containerName)
 
+	// Stop before removing so haloyd gets SIGTERM and can wait for running deployments.
+	// Errors are ignored, the removal below forces the container down anyway.
+	_ = exec.CommandContext(ctx, "docker", "stop", containerName).Run()
+
 	cmd = exec.CommandContext(ctx, "docker", "rm", "-f", containerName)
 
 	var stderr bytes.Buffer
@@ -294,9 +464,9 @@ func waitForAPI(ctx context.Context, api *apiclient.APIClient) error {
 		case <-ctx.Done():
 			return fmt.Errorf("timeout waiting for API to become ready: %w", ctx.Err())
 		case <-ticker.C:
-			// Try to check API health (without auth since health endpoint is public)
+			// Only wait until haloyd is up, its initialization logs are streamed until it's ready.
 			healthCtx, healthCancel := context.WithTimeout(ctx, 2*time.Second)
-			err := api.HealthCheck(healthCtx)
+			err := api.LivenessCheck(healthCtx)
 			healthCancel()
 
 			if err == nil {
@@ -308,19 +478,25 @@ func waitForAPI(ctx context.Context, api *apiclient.APIClient) error {
 	}
 }
 
-// waitForHAProxy polls HAProxy until it's accepting connections on port 80
-func waitForHAProxy(ctx context.Context) error {
+// waitForHAProxy polls HAProxy until it's accepting connections on the HTTP port
+func waitForProxy(ctx context.Context, configDir string) error {
+	haloydConfig, err := loadHaloydConfig(configDir)
+	if err != nil {
+		return err
+	}
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(haloydConfig.Proxy.HTTPPort))
+
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("timeout waiting for HAProxy to become ready: %w", ctx.Err())
+			return fmt.Errorf("timeout waiting for %s to become ready: %w", haloydConfig.Proxy.Backend, ctx.Err())
 		case <-ticker.C:
-			// Check if HAProxy container is running and healthy
+			// Check if the proxy container is running and healthy
 			cmd := exec.CommandContext(ctx, "docker", "ps",
-				"--filter", fmt.Sprintf("label=%s=%s", config.LabelRole, config.HAProxyLabelRole),
+				"--filter", fmt.Sprintf("label=%s=%s", config.LabelRole, proxyLabelRole(haloydConfig.Proxy)),
 				"--filter", "status=running",
 				"--format", "{{.ID}}")
 
@@ -330,11 +506,11 @@ func waitForHAProxy(ctx context.Context) error {
 				continue // Container not running yet
 			}
 
-			// Check if port 80 is accepting connections
-			conn, err := net.DialTimeout("tcp", "127.0.0.1:80", 2*time.Second)
+			// Check if the HTTP port is accepting connections
+			conn, err := net.DialTimeout("tcp", address, 2*time.Second)
 			if err == nil {
 				conn.Close()
-				return nil // HAProxy is ready
+				return nil // The proxy is ready
 			}
 
 			// Continue polling if port not ready yet
@@ -21,7 +21,7 @@ func StartCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "Start the haloy services",
-		Long:  "Start the haloy services, including HAProxy and haloyd.",
+		Long:  "Start the haloy services, including the proxy (HAProxy or Caddy) and haloyd.",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			ctx := cmd.Context()
@@ -53,9 +53,9 @@ func StartCmd() *cobra.Command {
 			waitCtx, waitCancel := context.WithTimeout(ctx, 30*time.Second)
 			defer waitCancel()
 
-			ui.Info("Waiting for HAProxy to become available...")
-			if err := waitForHAProxy(waitCtx); err != nil {
-				ui.Error("HAProxy failed to become ready: %v", err)
+			ui.Info("Waiting for the proxy to become available...")
+			if err := waitForProxy(waitCtx, configDir); err != nil {
+				ui.Error("The proxy failed to become ready: %v", err)
 				return
 			}
 
@@ -10,7 +10,7 @@ func StopCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "stop",
 		Short: "Stop the haloy services",
-		Long:  "Stop the haloy services, including HAProxy and haloyd.",
+		Long:  "Stop the haloy services, including the proxy (HAProxy or Caddy) and haloyd.",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			ctx := cmd.Context()
@@ -20,9 +20,11 @@ func StopCmd() *cobra.Command {
 				return
 			}
 
-			if err := stopContainer(ctx, config.HAProxyLabelRole); err != nil {
-				ui.Error("Failed to stop HAProxy: %v", err)
-				return
+			for _, proxy := range proxyContainers {
+				if err := stopContainer(ctx, proxy.role); err != nil {
+					ui.Error("Failed to stop %s: %v", proxy.name, err)
+					return
+				}
 			}
 
 			ui.Success("Haloy services stopped successfully")
@@ -7,6 +7,7 @@ import (
 
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 )
@@ -71,7 +72,7 @@ func (d *appDebouncer) signalDone(appName string) {
 	var capturedStartEvent bool
 	for _, event := range capturedEvents {
 
-		if event.Labels.DeploymentID > latestEvent.Labels.DeploymentID {
+		if helpers.CompareDeploymentIDs(event.Labels.DeploymentID, latestEvent.Labels.DeploymentID) > 0 {
 			latestEvent = event
 		}
 
@@ -0,0 +1,154 @@
+package haloyd
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	haloyevents "github.com/ameistad/haloy/internal/events"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Autoscaler scales the replicas of apps with autoscale in their deployment spec between the configured
+// bounds, based on the sessions, session rate and queued requests of their HAProxy backend.
+//
+// New replicas are cloned from a running replica of the current deployment, removed replicas are the
+// ones with the highest replica IDs. The new replica count is stored in the deployment spec so the
+// reconciler keeps it. Paused apps and apps with a deployment in progress are left alone.
+type Autoscaler struct {
+	cli            *client.Client
+	haproxyManager *HAProxyManager
+	events         *haloyevents.Broker
+
+	running    sync.Mutex           // Prevents passes from overlapping
+	lastScaled map[string]time.Time // Last scale action per app, for the cooldown
+}
+
+func NewAutoscaler(cli *client.Client, haproxyManager *HAProxyManager, eventBroker *haloyevents.Broker) *Autoscaler {
+	return &Autoscaler{
+		cli:            cli,
+		haproxyManager: haproxyManager,
+		events:         eventBroker,
+		lastScaled:     make(map[string]time.Time),
+	}
+}
+
+// Autoscale runs a single autoscaling pass. It returns immediately if another pass is still running.
+func (a *Autoscaler) Autoscale(ctx context.Context, logger *slog.Logger) {
+	if !a.running.TryLock() {
+		return
+	}
+	defer a.running.Unlock()
+
+	containerList, err := docker.GetAppContainers(ctx, a.cli, false, "")
+	if err != nil {
+		logger.Error("Autoscale: failed to list containers", "error", err)
+		return
+	}
+	deployingApps, err := appsWithCheckpoint()
+	if err != nil {
+		logger.Error("Autoscale: failed to load deployments in progress", "error", err)
+		return
+	}
+	pausedApps, err := deploy.PausedApps()
+	if err != nil {
+		logger.Error("Autoscale: failed to load paused apps", "error", err)
+		return
+	}
+
+	appContainers := make(map[string][]container.Summary)
+	for _, c := range containerList {
+		appName := c.Labels[config.LabelAppName]
+		appContainers[appName] = append(appContainers[appName], c)
+	}
+
+	// Stats are only read once an app with autoscale is found.
+	var stats map[string]apitypes.HAProxyBackendStats
+	for _, appName := range slices.Sorted(maps.Keys(appContainers)) {
+		_, deploying := deployingApps[appName]
+		_, paused := pausedApps[appName]
+		if appName == "" || deploying || paused {
+			continue
+		}
+
+		deploymentID, ok := a.haproxyManager.AppliedDeploymentID(appName)
+		if !ok {
+			continue
+		}
+		spec, err := deploy.LoadSpec(deploymentID)
+		if err != nil {
+			logger.Warn("Autoscale: failed to load deployment spec", "app", appName, "error", err)
+			continue
+		}
+		if spec == nil || spec.Autoscale == nil {
+			continue
+		}
+		if time.Since(a.lastScaled[appName]) < spec.Autoscale.CooldownDuration() {
+			continue
+		}
+
+		if stats == nil {
+			if stats, err = a.haproxyManager.BackendStats(ctx); err != nil {
+				logger.Error("Autoscale: failed to read HAProxy stats", "error", err)
+				return
+			}
+		}
+		backend, ok := stats[appName]
+		if !ok {
+			continue
+		}
+
+		var replicas []container.Summary
+		for _, c := range appContainers[appName] {
+			if c.Labels[config.LabelDeploymentID] == deploymentID {
+				replicas = append(replicas, c)
+			}
+		}
+		if len(replicas) == 0 {
+			continue
+		}
+		a.scaleApp(ctx, logger, appName, deploymentID, replicas, spec.Autoscale, backend)
+	}
+}
+
+func (a *Autoscaler) scaleApp(ctx context.Context, logger *slog.Logger, appName, deploymentID string, replicas []container.Summary,
+	autoscale *config.Autoscale, backend apitypes.HAProxyBackendStats,
+) {
+	current := len(replicas)
+	desired := autoscale.DesiredReplicas(current, backend.CurrentSessions, backend.SessionRate, backend.QueuedRequests)
+	if desired == current {
+		return
+	}
+
+	scaled, err := deploy.ScaleReplicas(ctx, a.cli, logger, deploymentID, replicas, desired)
+	if err != nil {
+		logger.Warn("Autoscale: failed to scale app", "app", appName, "from", current, "to", desired, "error", err)
+	}
+	if scaled == current {
+		return
+	}
+
+	a.lastScaled[appName] = time.Now()
+	logger.Info("Autoscale: scaled app", "app", appName, "from", current, "to", scaled,
+		"sessions", backend.CurrentSessions, "session_rate", backend.SessionRate, "queued", backend.QueuedRequests)
+	a.events.Publish(haloyevents.Event{
+		Type:         haloyevents.TypeAppScaled,
+		AppName:      appName,
+		DeploymentID: deploymentID,
+		Data: map[string]any{
+			"from":        current,
+			"to":          scaled,
+			"sessions":    backend.CurrentSessions,
+			"sessionRate": backend.SessionRate,
+			"queued":      backend.QueuedRequests,
+		},
+	})
+}
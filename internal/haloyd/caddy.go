@@ -0,0 +1,397 @@
+package haloyd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	// Path of the Caddyfile in the Caddy container.
+	caddyConfigPath      = "/etc/caddy/" + constants.CaddyConfigFileName
+	caddyReloadTimeout   = 30 * time.Second
+	letsEncryptStagingCA = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// CaddyManager routes traffic with Caddy. Caddy obtains and renews the certificates of the app domains
+// itself, so haloyd's ACME client isn't used. A/B tests, shadow traffic and connection limits are HAProxy
+// features and are ignored.
+type CaddyManager struct {
+	cli          *client.Client
+	haloydConfig *config.HaloydConfig
+	configDir    string
+	dataDir      string
+	debug        bool
+	events       *events.Broker
+	updateMutex  sync.Mutex // Protects config writing and reloads
+
+	// The last applied config, used to skip writes and reloads when nothing changed.
+	lastConfig []byte
+	// Deployment ID per app in the last applied config.
+	lastDeployments map[string]string
+	container       proxyContainer
+}
+
+func NewCaddyManager(cli *client.Client, haloydConfig *config.HaloydConfig, dataDir string, debug bool, eventBroker *events.Broker) *CaddyManager {
+	cm := &CaddyManager{
+		cli:          cli,
+		haloydConfig: haloydConfig,
+		configDir:    filepath.Join(dataDir, constants.CaddyConfigDir),
+		dataDir:      dataDir,
+		debug:        debug,
+		events:       eventBroker,
+	}
+	cm.container = proxyContainer{
+		cli:           cli,
+		name:          constants.CaddyContainerName,
+		role:          config.CaddyLabelRole,
+		defaultConfig: cm.defaultContainerConfig,
+	}
+	return cm
+}
+
+func (cm *CaddyManager) Name() string {
+	return config.ProxyBackendCaddy
+}
+
+// ManagesCertificates is true, Caddy obtains the certificates with its own ACME client.
+func (cm *CaddyManager) ManagesCertificates() bool {
+	return true
+}
+
+func (cm *CaddyManager) SetHaloydConfig(haloydConfig *config.HaloydConfig) {
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+	cm.haloydConfig = haloydConfig
+}
+
+func (cm *CaddyManager) GenerateConfig(deployments map[string]Deployment) ([]byte, error) {
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+	return cm.generateConfig(deployments), nil
+}
+
+func (cm *CaddyManager) Apply(ctx context.Context, logger *slog.Logger, deployments map[string]Deployment, forceReload bool) error {
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+
+	for appName, d := range deployments {
+		if d.ABTest != nil || d.Labels.ShadowTo != "" || d.Labels.Frontend != "" {
+			logger.Warn("CaddyManager: A/B tests, shadow_to and proxy frontends are not supported by the caddy backend and are ignored", "app", appName)
+		}
+	}
+
+	configBytes := cm.generateConfig(deployments)
+	configChanged := !bytes.Equal(configBytes, cm.lastConfig)
+	if !configChanged && !forceReload {
+		logger.Debug("CaddyManager: Configuration unchanged, skipping write and reload.")
+		return nil
+	}
+	if configChanged && cm.lastConfig != nil && logger.Enabled(ctx, slog.LevelDebug) {
+		logger.Debug("CaddyManager: Configuration diff\n" + helpers.UnifiedDiff("Caddyfile", "Caddyfile", string(cm.lastConfig), string(configBytes)))
+	}
+
+	if cm.debug {
+		logger.Debug("CaddyManager: Skipping config write and reload.")
+		logger.Debug(string(configBytes))
+		cm.lastConfig, cm.lastDeployments = configBytes, deploymentIDs(deployments)
+		return nil
+	}
+
+	configPath := filepath.Join(cm.configDir, constants.CaddyConfigFileName)
+	if err := os.WriteFile(configPath, configBytes, constants.ModeFileDefault); err != nil {
+		return fmt.Errorf("CaddyManager: failed to write config file %s: %w", configPath, err)
+	}
+	if err := cm.reload(ctx, logger); err != nil {
+		return err
+	}
+
+	// Only cache the config once Caddy has loaded it, so failed reloads are retried.
+	cm.lastConfig, cm.lastDeployments = configBytes, deploymentIDs(deployments)
+
+	cm.events.Publish(events.Event{
+		Type: events.TypeProxyReloaded,
+		Data: map[string]any{"backend": config.ProxyBackendCaddy, "deployments": len(deployments)},
+	})
+	return nil
+}
+
+func (cm *CaddyManager) Reload(ctx context.Context, logger *slog.Logger) error {
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+	return cm.reload(ctx, logger)
+}
+
+// PreviewConfig returns the applied Caddyfile and the Caddyfile with the app in labels deployed with the
+// given number of replicas. The addresses of the new replicas are placeholders.
+func (cm *CaddyManager) PreviewConfig(deployments map[string]Deployment, labels *config.ContainerLabels, replicas int) (string, string, error) {
+	preview := maps.Clone(deployments)
+	instances := make([]DeploymentInstance, 0, replicas)
+	for i := range replicas {
+		instances = append(instances, DeploymentInstance{
+			ContainerID: fmt.Sprintf("dry-run-%d", i+1),
+			IP:          fmt.Sprintf("new-replica-%d", i+1),
+			Port:        labels.Port.String(),
+		})
+	}
+	preview[labels.AppName] = Deployment{Labels: labels, Instances: instances}
+
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+	return string(cm.lastConfig), string(cm.generateConfig(preview)), nil
+}
+
+func (cm *CaddyManager) AppliedDeploymentID(appName string) (string, bool) {
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+	deploymentID, ok := cm.lastDeployments[appName]
+	return deploymentID, ok
+}
+
+func (cm *CaddyManager) RepairConfig(ctx context.Context, logger *slog.Logger) (bool, error) {
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+
+	if cm.debug || cm.lastConfig == nil {
+		return false, nil
+	}
+
+	configPath := filepath.Join(cm.configDir, constants.CaddyConfigFileName)
+	current, err := os.ReadFile(configPath)
+	if err == nil && bytes.Equal(current, cm.lastConfig) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("CaddyManager: failed to read config file %s: %w", configPath, err)
+	}
+
+	logger.Warn("CaddyManager: Configuration on disk differs from the applied configuration, rewriting it")
+	if err := os.WriteFile(configPath, cm.lastConfig, constants.ModeFileDefault); err != nil {
+		return false, fmt.Errorf("CaddyManager: failed to write config file %s: %w", configPath, err)
+	}
+	if err := cm.reload(ctx, logger); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (cm *CaddyManager) EnsureContainer(ctx context.Context, logger *slog.Logger) (string, bool, error) {
+	cm.updateMutex.Lock()
+	defer cm.updateMutex.Unlock()
+
+	if cm.debug {
+		return "", false, nil
+	}
+	return cm.container.ensure(ctx, logger)
+}
+
+// reload runs 'caddy reload' in the Caddy container. The admin endpoint of Caddy only listens on localhost
+// in the container, so apps on the haloy network can't change the config.
+func (cm *CaddyManager) reload(ctx context.Context, logger *slog.Logger) error {
+	caddyID, err := cm.container.runningID(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("CaddyManager: failed to find Caddy container: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, caddyReloadTimeout)
+	defer cancel()
+
+	execResp, err := cm.cli.ContainerExecCreate(ctx, caddyID, container.ExecOptions{
+		Cmd:          []string{"caddy", "reload", "--config", caddyConfigPath, "--adapter", "caddyfile"},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("CaddyManager: failed to create reload command: %w", err)
+	}
+	attachResp, err := cm.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return fmt.Errorf("CaddyManager: failed to run reload command: %w", err)
+	}
+	defer attachResp.Close()
+
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, attachResp.Reader); err != nil {
+		return fmt.Errorf("CaddyManager: failed to read reload output: %w", err)
+	}
+	inspect, err := cm.cli.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return fmt.Errorf("CaddyManager: failed to inspect reload command: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("CaddyManager: caddy reload exited with code %d: %s", inspect.ExitCode, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// defaultContainerConfig returns the configuration haloyadm starts Caddy with.
+func (cm *CaddyManager) defaultContainerConfig(ctx context.Context) (*container.Config, *container.HostConfig, error) {
+	var proxyConfig config.ProxyConfig
+	if cm.haloydConfig != nil {
+		proxyConfig = cm.haloydConfig.Normalize().Proxy
+	}
+	exposedPorts, portBindings, err := proxyPortBindings(ctx, cm.cli, proxyConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	containerConfig := &container.Config{
+		Image:        fmt.Sprintf("caddy:%s", constants.CaddyVersion),
+		Labels:       map[string]string{config.LabelRole: config.CaddyLabelRole},
+		ExposedPorts: exposedPorts,
+	}
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:/etc/caddy:ro", cm.configDir),
+			fmt.Sprintf("%s/%s:/data:rw", cm.dataDir, constants.CaddyDataDir),
+		},
+		PortBindings:  portBindings,
+		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+		NetworkMode:   container.NetworkMode(constants.DockerNetwork),
+	}
+	return containerConfig, hostConfig, nil
+}
+
+// generateConfig renders the Caddyfile. Apps are rendered in a stable order so unchanged deployments
+// produce an identical config.
+func (cm *CaddyManager) generateConfig(deployments map[string]Deployment) []byte {
+	proxyConfig := config.ProxyConfig{HTTPPort: config.DefaultProxyHTTPPort, HTTPSPort: config.DefaultProxyHTTPSPort}
+	var certificates config.CertificatesConfig
+	if cm.haloydConfig != nil {
+		proxyConfig = cm.haloydConfig.Normalize().Proxy
+		certificates = cm.haloydConfig.Certificates
+	}
+	httpsURL := func(domain string) string {
+		if proxyConfig.HTTPSPort == config.DefaultProxyHTTPSPort {
+			return "https://" + domain
+		}
+		return fmt.Sprintf("https://%s:%d", domain, proxyConfig.HTTPSPort)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by haloyd, changes are overwritten.\n{\n")
+	fmt.Fprintf(&b, "\thttp_port %d\n", proxyConfig.HTTPPort)
+	fmt.Fprintf(&b, "\thttps_port %d\n", proxyConfig.HTTPSPort)
+	if certificates.AcmeEmail != "" {
+		fmt.Fprintf(&b, "\temail %s\n", certificates.AcmeEmail)
+	}
+	if certificates.Staging {
+		fmt.Fprintf(&b, "\tacme_ca %s\n", letsEncryptStagingCA)
+	}
+	b.WriteString("}\n")
+
+	if cm.haloydConfig != nil && cm.haloydConfig.API.Domain != "" {
+		fmt.Fprintf(&b, "\n%s {\n", cm.haloydConfig.API.Domain)
+		fmt.Fprintf(&b, "\treverse_proxy haloyd:%s\n", constants.APIServerPort)
+		b.WriteString("}\n")
+	}
+
+	for _, appName := range slices.Sorted(maps.Keys(deployments)) {
+		d := deployments[appName]
+		// Internal apps are reached on the haloy network.
+		if len(d.Labels.Domains) == 0 || d.Labels.Exposure == config.ExposureInternal || d.Labels.Frontend != "" {
+			continue
+		}
+
+		for _, domain := range d.Labels.Domains {
+			if domain.Canonical == "" {
+				continue
+			}
+			siteAddress, targetURL := domain.Canonical, httpsURL(domain.Canonical)
+			if domain.TLSDisabled() {
+				siteAddress, targetURL = "http://"+domain.Canonical, "http://"+domain.Canonical
+				if proxyConfig.HTTPPort != config.DefaultProxyHTTPPort {
+					targetURL = fmt.Sprintf("http://%s:%d", domain.Canonical, proxyConfig.HTTPPort)
+				}
+			}
+
+			fmt.Fprintf(&b, "\n# %s\n%s {\n", appName, siteAddress)
+			if !domain.TLSDisabled() {
+				b.WriteString(caddyTLSDirective(d.Labels))
+			}
+			b.WriteString(caddyHandler(d))
+			b.WriteString("}\n")
+
+			for _, alias := range domain.Aliases {
+				if alias == "" {
+					continue
+				}
+				aliasAddress := alias
+				if domain.TLSDisabled() {
+					aliasAddress = "http://" + alias
+				}
+				fmt.Fprintf(&b, "%s {\n", aliasAddress)
+				if !domain.TLSDisabled() {
+					b.WriteString(caddyTLSDirective(d.Labels))
+				}
+				fmt.Fprintf(&b, "\tredir %s{uri} permanent\n", targetURL)
+				b.WriteString("}\n")
+			}
+		}
+	}
+
+	return []byte(b.String())
+}
+
+// caddyTLSDirective returns the tls directive for the ACME settings of an app, if it has any.
+func caddyTLSDirective(labels *config.ContainerLabels) string {
+	if labels.ACMEEmail == "" && !labels.ACMEStaging {
+		return ""
+	}
+	directive := "\ttls"
+	if labels.ACMEEmail != "" {
+		directive += " " + labels.ACMEEmail
+	}
+	if labels.ACMEStaging {
+		return directive + fmt.Sprintf(" {\n\t\tca %s\n\t}\n", letsEncryptStagingCA)
+	}
+	return directive + "\n"
+}
+
+// caddyHandler returns the directives that serve a deployment: a maintenance page for paused apps,
+// otherwise a load balanced reverse proxy to its instances with the app's health check.
+func caddyHandler(d Deployment) string {
+	if d.Paused {
+		return "\theader Retry-After 300\n\theader Content-Type text/html\n\trespond `" + pausedPage + "` 503\n"
+	}
+	if len(d.Instances) == 0 {
+		return "\trespond 503\n"
+	}
+
+	instances := slices.SortedFunc(slices.Values(d.Instances), func(a, b DeploymentInstance) int {
+		return strings.Compare(a.ContainerID, b.ContainerID)
+	})
+	upstreams := make([]string, len(instances))
+	for i, instance := range instances {
+		upstreams[i] = fmt.Sprintf("%s:%s", instance.IP, instance.Port)
+	}
+
+	handler := fmt.Sprintf("\treverse_proxy %s {\n", strings.Join(upstreams, " "))
+	handler += "\t\tlb_policy round_robin\n"
+	if path, ok := httpHealthCheckPath(d.Labels); ok {
+		handler += fmt.Sprintf("\t\thealth_uri %s\n", path)
+		if len(d.Labels.HealthCheckExpectedStatusCodes) == 1 {
+			handler += fmt.Sprintf("\t\thealth_status %d\n", d.Labels.HealthCheckExpectedStatusCodes[0])
+		}
+	}
+	handler += "\t}\n"
+	return handler
+}
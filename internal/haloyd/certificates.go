@@ -7,34 +7,56 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ameistad/haloy/internal/acme"
+	"github.com/ameistad/haloy/internal/certstore"
+	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/events"
 	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge"
 	"github.com/go-acme/lego/v4/challenge/http01"
 	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
 	"github.com/go-acme/lego/v4/registration"
 )
 
 const (
 	refreshDebounceKey   = "certificate_refresh"
 	refreshDebounceDelay = 5 * time.Second
-	accountsDirName      = "accounts"
 	combinedCertExt      = ".pem"
-	keyCertExt           = ".key"
+	// RSA certificates issued next to the ECDSA certificate with DualCertificates. The name doesn't end in
+	// .pem so the domain listings skip it, HAProxy loads every file in the directory and picks by client support.
+	rsaCertExt = ".rsa.crt"
+	// HAProxy loads every file in the certificate directory, so the challenge methods are kept with the accounts.
+	challengesFileName = "challenges.json"
+
+	challengeHTTP01 = "http-01"
+	challengeDNS01  = "dns-01"
+
+	// Expiring certificates are renewed outside the renewal window once they expire within this deadline.
+	renewalWindowDeadline = 7 * 24 * time.Hour
 )
 
 type CertificatesUser struct {
@@ -56,7 +78,6 @@ func (u *CertificatesUser) GetPrivateKey() crypto.PrivateKey {
 }
 
 type CertificatesClientManager struct {
-	tlsStaging         bool
 	keyManager         *CertificatesKeyManager
 	clients            map[string]*lego.Client
 	clientsMutex       sync.RWMutex
@@ -65,10 +86,9 @@ type CertificatesClientManager struct {
 
 func NewCertificatesClientManager(
 	certDir string,
-	tlsStaging bool,
 	httpProviderPort string,
 ) (*CertificatesClientManager, error) {
-	keyDir := filepath.Join(certDir, accountsDirName)
+	keyDir := filepath.Join(certDir, acme.AccountsDir)
 
 	if err := os.MkdirAll(keyDir, constants.ModeDirPrivate); err != nil {
 		return nil, fmt.Errorf("failed to create key directory '%s': %w", keyDir, err)
@@ -81,16 +101,31 @@ func NewCertificatesClientManager(
 	httpProvider := http01.NewProviderServer("", httpProviderPort)
 
 	return &CertificatesClientManager{
-		tlsStaging:         tlsStaging,
 		clients:            make(map[string]*lego.Client),
 		keyManager:         keyManager,
 		sharedHTTPProvider: httpProvider,
 	}, nil
 }
 
-func (cm *CertificatesClientManager) LoadOrRegisterClient(email string) (*lego.Client, error) {
+// LoadOrRegisterClient returns a client for the production CA, or the staging CA when staging is set.
+// The client validates domains with HTTP-01, or with DNS-01 through dnsProvider when it's set.
+func (cm *CertificatesClientManager) LoadOrRegisterClient(email string, staging bool, dnsProvider string) (*lego.Client, error) {
+	caDirURL := lego.LEDirectoryProduction
+	if staging {
+		caDirURL = lego.LEDirectoryStaging
+	}
+	return cm.loadOrRegisterClient(email, caDirURL, dnsProvider)
+}
+
+func (cm *CertificatesClientManager) loadOrRegisterClient(email, caDirURL, dnsProvider string) (*lego.Client, error) {
+	// Accounts are registered per CA, so clients are keyed by both directory and email.
+	clientKey := caDirURL + "|" + email
+	if dnsProvider != "" {
+		clientKey += "|" + dnsProvider
+	}
+
 	cm.clientsMutex.RLock()
-	client, ok := cm.clients[email]
+	client, ok := cm.clients[clientKey]
 	cm.clientsMutex.RUnlock()
 
 	if ok {
@@ -101,7 +136,7 @@ func (cm *CertificatesClientManager) LoadOrRegisterClient(email string) (*lego.C
 	defer cm.clientsMutex.Unlock()
 
 	// Check again in case another goroutine created it while we were waiting. Just to be safe.
-	if client, ok := cm.clients[email]; ok {
+	if client, ok := cm.clients[clientKey]; ok {
 		return client, nil
 	}
 
@@ -116,22 +151,28 @@ func (cm *CertificatesClientManager) LoadOrRegisterClient(email string) (*lego.C
 	}
 
 	legoConfig := lego.NewConfig(user)
-	if cm.tlsStaging {
-		legoConfig.CADirURL = lego.LEDirectoryStaging
-	} else {
-		legoConfig.CADirURL = lego.LEDirectoryProduction
-	}
+	legoConfig.CADirURL = caDirURL
 
 	client, err = lego.NewClient(legoConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create lego client: %w", err)
 	}
 
-	// Configure HTTP challenge provider using a server that listens on port 8080
-	// HAProxy is configured to forward /.well-known/acme-challenge/* requests to this server
-	err = client.Challenge.SetHTTP01Provider(cm.sharedHTTPProvider)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set HTTP challenge provider: %w", err)
+	if dnsProvider != "" {
+		provider, err := newDNSProvider(dnsProvider)
+		if err != nil {
+			return nil, err
+		}
+		if err := client.Challenge.SetDNS01Provider(provider); err != nil {
+			return nil, fmt.Errorf("failed to set DNS challenge provider: %w", err)
+		}
+	} else {
+		// Configure HTTP challenge provider using a server that listens on port 8080
+		// HAProxy is configured to forward /.well-known/acme-challenge/* requests to this server
+		err = client.Challenge.SetHTTP01Provider(cm.sharedHTTPProvider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set HTTP challenge provider: %w", err)
+		}
 	}
 
 	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
@@ -140,21 +181,69 @@ func (cm *CertificatesClientManager) LoadOrRegisterClient(email string) (*lego.C
 	}
 	user.Registration = reg
 
-	cm.clients[email] = client
+	registration := acme.Registration{URI: reg.URI, Status: reg.Body.Status, RegisteredAt: time.Now()}
+	if err := acme.SaveRegistration(cm.keyManager.keyDir, email, caDirURL, registration); err != nil {
+		return nil, fmt.Errorf("failed to record registration: %w", err)
+	}
+
+	cm.clients[clientKey] = client
 
 	return client, nil
 }
 
+// newDNSProvider returns the DNS-01 provider with the given name, configured from the environment.
+func newDNSProvider(name string) (challenge.Provider, error) {
+	switch name {
+	case config.DNSProviderCloudflare:
+		// Reads CF_DNS_API_TOKEN, or CF_API_EMAIL and CF_API_KEY.
+		provider, err := cloudflare.NewDNSProvider()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure cloudflare DNS provider: %w", err)
+		}
+		return provider, nil
+	default:
+		return nil, fmt.Errorf("unsupported DNS provider '%s'", name)
+	}
+}
+
 type CertificatesManagerConfig struct {
-	CertDir          string
+	// CertDir holds the ACME accounts, and the certificate files HAProxy loads.
+	CertDir string
+	// Store persists the certificates, a certstore.FileStore in CertDir when nil.
+	Store            certstore.CertStore
 	HTTPProviderPort string
-	TlsStaging       bool
+	// StagingPrecheck requests a throwaway staging certificate for new or changed domains
+	// before requesting the production certificate. Ignored for staging domains.
+	StagingPrecheck bool
+	// RenewalWindow defers renewals of expiring certificates until the window, nil renews them right away.
+	RenewalWindow *config.RenewalWindow
+	// DNSProvider enables the DNS-01 fallback for domains that fail HTTP-01 validation, empty disables it.
+	DNSProvider string
+	// ExpiryAlert reports certificates whose renewal keeps failing as they get close to expiry.
+	ExpiryAlert config.ExpiryAlert
+	// DualCertificates issues an ECDSA and an RSA certificate per domain, HAProxy serves the RSA
+	// certificate to clients without ECDSA support.
+	DualCertificates bool
+	Events           *events.Broker
+}
+
+// newCertStore returns the certificate store selected with certificates.store.
+func newCertStore(haloydConfig *config.HaloydConfig, db *storage.DB, certDir string) (certstore.CertStore, error) {
+	if haloydConfig != nil && haloydConfig.Certificates.Store == config.CertStoreDatabase {
+		return certstore.NewDBStore(db, certDir)
+	}
+	return certstore.NewFileStore(certDir)
 }
 
 type CertificatesDomain struct {
 	Canonical string
 	Aliases   []string
 	Email     string
+	// Staging requests the certificate from the staging CA. A certificate from the other CA is replaced.
+	Staging bool
+	// KeyType is the key type of the certificate, config.DefaultKeyType when empty. A certificate with
+	// another key type is replaced.
+	KeyType string
 }
 
 func (cm *CertificatesDomain) Validate() error {
@@ -192,28 +281,42 @@ type CertificatesManager struct {
 	clientManager *CertificatesClientManager
 	updateSignal  chan<- string // signal successful updates
 	debouncer     *helpers.Debouncer
+	// Domains whose renewal waits for the renewal window, by canonical domain.
+	deferredDomains map[string]CertificatesDomain
+	// Consecutive failed certificate requests, by canonical domain.
+	renewalFailures map[string]int
+	// Renewal state of the system domains, by role. Guarded by systemMutex so status reads don't wait for renewals.
+	systemDomains map[string]*systemDomainState
+	systemMutex   sync.Mutex
 }
 
 func NewCertificatesManager(config CertificatesManagerConfig, updateSignal chan<- string) (*CertificatesManager, error) {
-	if err := os.MkdirAll(config.CertDir, constants.ModeDirPrivate); err != nil {
-		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	if config.Store == nil {
+		store, err := certstore.NewFileStore(config.CertDir)
+		if err != nil {
+			return nil, err
+		}
+		config.Store = store
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	clientManager, err := NewCertificatesClientManager(config.CertDir, config.TlsStaging, config.HTTPProviderPort)
+	clientManager, err := NewCertificatesClientManager(config.CertDir, config.HTTPProviderPort)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to create client manager: %w", err)
 	}
 
 	m := &CertificatesManager{
-		config:        config,
-		ctx:           ctx,
-		cancel:        cancel,
-		clientManager: clientManager,
-		updateSignal:  updateSignal,
-		debouncer:     helpers.NewDebouncer(refreshDebounceDelay),
+		config:          config,
+		ctx:             ctx,
+		cancel:          cancel,
+		clientManager:   clientManager,
+		updateSignal:    updateSignal,
+		debouncer:       helpers.NewDebouncer(refreshDebounceDelay),
+		deferredDomains: make(map[string]CertificatesDomain),
+		renewalFailures: make(map[string]int),
+		systemDomains:   make(map[string]*systemDomainState),
 	}
 
 	return m, nil
@@ -224,12 +327,66 @@ func (m *CertificatesManager) Stop() {
 	m.debouncer.Stop() // Stop the debouncer to clean up any pending timers
 }
 
-func (cm *CertificatesManager) RefreshSync(logger *slog.Logger, domains []CertificatesDomain) error {
-	_, err := cm.checkRenewals(logger, domains)
+// SetStagingPrecheck enables or disables the staging precheck for certificates requested from now on.
+func (cm *CertificatesManager) SetStagingPrecheck(enabled bool) {
+	cm.checkMutex.Lock()
+	defer cm.checkMutex.Unlock()
+	cm.config.StagingPrecheck = enabled
+}
+
+// SetRenewalWindow replaces the renewal window, nil renews expiring certificates right away.
+func (cm *CertificatesManager) SetRenewalWindow(window *config.RenewalWindow) {
+	cm.checkMutex.Lock()
+	defer cm.checkMutex.Unlock()
+	cm.config.RenewalWindow = window
+}
+
+// SetDNSProvider replaces the DNS provider used when HTTP-01 validation fails, empty disables the fallback.
+func (cm *CertificatesManager) SetDNSProvider(provider string) {
+	cm.checkMutex.Lock()
+	defer cm.checkMutex.Unlock()
+	cm.config.DNSProvider = provider
+}
+
+// SetDualCertificates enables or disables issuing an RSA certificate next to the ECDSA certificate.
+// Existing certificates are replaced on the next refresh.
+func (cm *CertificatesManager) SetDualCertificates(enabled bool) {
+	cm.checkMutex.Lock()
+	defer cm.checkMutex.Unlock()
+	cm.config.DualCertificates = enabled
+}
+
+// SetExpiryAlert replaces the settings for reporting certificates that keep failing to renew.
+func (cm *CertificatesManager) SetExpiryAlert(alert config.ExpiryAlert) {
+	cm.checkMutex.Lock()
+	defer cm.checkMutex.Unlock()
+	cm.config.ExpiryAlert = alert
+}
+
+// RenewDeferred renews the certificates whose renewal was deferred, once the renewal window is open.
+func (cm *CertificatesManager) RenewDeferred(logger *slog.Logger) {
+	cm.checkMutex.Lock()
+	window := cm.config.RenewalWindow
+	domains := slices.Collect(maps.Values(cm.deferredDomains))
+	cm.checkMutex.Unlock()
+
+	if len(domains) == 0 || (window != nil && !window.Active(time.Now())) {
+		return
+	}
+
+	logger.Info("Renewing certificates in the renewal window", "count", len(domains))
+	renewedDomains, err := cm.checkRenewals(logger, domains)
 	if err != nil {
-		return err
+		logger.Error("Certificate renewal failed", "error", err)
+		return
 	}
-	return nil
+	if len(renewedDomains) > 0 && cm.updateSignal != nil {
+		cm.updateSignal <- "certificates_renewed"
+	}
+}
+
+func (cm *CertificatesManager) RefreshSync(logger *slog.Logger, domains []CertificatesDomain) (renewedDomains []CertificatesDomain, err error) {
+	return cm.checkRenewals(logger, domains)
 }
 
 // Refresh is used for periodic refreshes of certificates.
@@ -305,6 +462,18 @@ func (cm *CertificatesManager) checkRenewals(logger *slog.Logger, domains []Cert
 			needsRenewal = true
 		}
 
+		// Expiring certificates are renewed in the renewal window, unless they are about to expire.
+		if needsRenewal && !configChanged && cm.deferRenewal(domain) {
+			if _, deferred := cm.deferredDomains[canonical]; !deferred {
+				logger.Info("Certificate expires soon, renewal deferred to the renewal window",
+					"domain", canonical,
+					"window", fmt.Sprintf("%s-%s", cm.config.RenewalWindow.Start, cm.config.RenewalWindow.End))
+			}
+			cm.deferredDomains[canonical] = domain
+			continue
+		}
+		delete(cm.deferredDomains, canonical)
+
 		// If configuration changed, clean up all related certificates first
 		if configChanged {
 			logger.Debug("Configuration changed, cleaning up existing certificates", "domain", canonical)
@@ -326,12 +495,27 @@ func (cm *CertificatesManager) checkRenewals(logger *slog.Logger, domains []Cert
 				logging.AttrDomains, allDomains,
 				"domain", canonical,
 				"aliases", domain.Aliases)
+			if configChanged && cm.config.StagingPrecheck && !domain.Staging {
+				logger.Info("Validating domains against staging CA before requesting production certificate",
+					logging.AttrDomains, allDomains,
+					"domain", canonical)
+				if err := cm.stagingPrecheck(domain, logger); err != nil {
+					cm.renewalFailed(logger, domain, err)
+					return renewedDomains, err
+				}
+			}
 			obtainedDomain, err := cm.obtainCertificate(domain, logger)
 			if err != nil {
+				cm.renewalFailed(logger, domain, err)
 				return renewedDomains, err
 			}
+			delete(cm.renewalFailures, canonical)
 
 			renewedDomains = append(renewedDomains, obtainedDomain)
+			cm.config.Events.Publish(events.Event{
+				Type: events.TypeCertRenewed,
+				Data: map[string]any{"domain": canonical, "aliases": domain.Aliases},
+			})
 			logger.Info("Obtained new certificate",
 				logging.AttrDomains, allDomains,
 				"domain", canonical,
@@ -349,17 +533,14 @@ func (cm *CertificatesManager) checkRenewals(logger *slog.Logger, domains []Cert
 
 // hasConfigurationChanged checks if the domain configuration has changed compared to existing certificate
 func (cm *CertificatesManager) hasConfigurationChanged(logger *slog.Logger, domain CertificatesDomain) (bool, error) {
-	combinedCertKeyPath := filepath.Join(cm.config.CertDir, domain.Canonical+combinedCertExt)
-
-	// If certificate files don't exist, configuration has "changed" (need to create)
-	if _, err := os.Stat(combinedCertKeyPath); os.IsNotExist(err) {
-		logger.Debug("Certificate files don't exist, needs creation", "domain", domain.Canonical)
+	// If the certificate doesn't exist, configuration has "changed" (need to create)
+	certData, err := cm.config.Store.Get(domain.Canonical + combinedCertExt)
+	if errors.Is(err, certstore.ErrNotFound) {
+		logger.Debug("Certificate doesn't exist, needs creation", "domain", domain.Canonical)
 		return true, nil
 	}
-
-	certData, err := os.ReadFile(combinedCertKeyPath)
 	if err != nil {
-		logger.Debug("Cannot read certificate file, treating as changed", "domain", domain.Canonical)
+		logger.Debug("Cannot read certificate, treating as changed", "domain", domain.Canonical)
 		return true, nil
 	}
 
@@ -376,18 +557,39 @@ func (cm *CertificatesManager) hasConfigurationChanged(logger *slog.Logger, doma
 	existingDomains := parsedCert.DNSNames
 	sort.Strings(existingDomains)
 
+	if isStagingCertificate(parsedCert) != domain.Staging {
+		logger.Debug("Certificate is from the other CA, needs replacement", "domain", domain.Canonical, "staging", domain.Staging)
+		return true, nil
+	}
+
+	// Dual certificates pair an ECDSA certificate with an RSA certificate, so toggling them replaces both.
+	_, err = cm.config.Store.Get(domain.Canonical + rsaCertExt)
+	hasRSACert := err == nil
+	keyType, _ := cm.keyTypes(domain)
+	if cm.config.DualCertificates != hasRSACert || certificateKeyType(parsedCert) != keyType {
+		logger.Debug("Certificate key type has changed, needs replacement",
+			"domain", domain.Canonical,
+			"keyType", keyType,
+			"dual", cm.config.DualCertificates)
+		return true, nil
+	}
+
 	return !reflect.DeepEqual(requiredDomains, existingDomains), nil
 }
 
+// isStagingCertificate reports whether the certificate was issued by the Let's Encrypt staging CA,
+// whose intermediates are named "(STAGING) ...".
+func isStagingCertificate(cert *x509.Certificate) bool {
+	return strings.Contains(cert.Issuer.CommonName, "(STAGING)")
+}
+
 // needsRenewalDueToExpiry checks if certificate needs renewal due to expiry
 func (cm *CertificatesManager) needsRenewalDueToExpiry(logger *slog.Logger, domain CertificatesDomain) (bool, error) {
-	certFilePath := filepath.Join(cm.config.CertDir, domain.Canonical+combinedCertExt)
-
 	// If certificate doesn't exist, we need to obtain one
-	certData, err := os.ReadFile(certFilePath)
+	certData, err := cm.config.Store.Get(domain.Canonical + combinedCertExt)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return true, nil // File doesn't exist, need to obtain
+		if errors.Is(err, certstore.ErrNotFound) {
+			return true, nil
 		}
 		return false, err
 	}
@@ -406,11 +608,86 @@ func (cm *CertificatesManager) needsRenewalDueToExpiry(logger *slog.Logger, doma
 	return false, nil
 }
 
-// cleanupDomainCertificates removes all certificate files for a domain
+// deferRenewal reports whether the renewal of an expiring certificate waits for the renewal window. Certificates
+// that expire within renewalWindowDeadline are renewed right away, so a missed window never lets them expire.
+func (cm *CertificatesManager) deferRenewal(domain CertificatesDomain) bool {
+	window := cm.config.RenewalWindow
+	if window == nil || window.Active(time.Now()) {
+		return false
+	}
+
+	notAfter, err := cm.certificateExpiry(domain.Canonical)
+	if err != nil {
+		return false
+	}
+	return time.Until(notAfter) > renewalWindowDeadline
+}
+
+// renewalFailed counts the consecutive failed requests for the domain. Once the current certificate expires
+// within the expiry alert threshold, it's reported after every ExpiryAlert.Failures failed requests with a
+// cert.expiring event, and to the webhook when one is configured.
+func (cm *CertificatesManager) renewalFailed(logger *slog.Logger, domain CertificatesDomain, renewErr error) {
+	canonical := domain.Canonical
+	cm.renewalFailures[canonical]++
+	failures := cm.renewalFailures[canonical]
+
+	alert := cm.config.ExpiryAlert
+	if failures%alert.FailureThreshold() != 0 {
+		return
+	}
+	// New domains and domains whose certificate was removed after a config change have nothing to expire.
+	notAfter, err := cm.certificateExpiry(canonical)
+	if err != nil || time.Until(notAfter) > alert.Threshold() {
+		return
+	}
+
+	logger.Error("Certificate renewal keeps failing and the certificate expires soon",
+		"domain", canonical,
+		"expiresAt", notAfter,
+		"failures", failures,
+		"error", renewErr)
+	event := events.Event{
+		Type:      events.TypeCertExpiring,
+		Timestamp: time.Now(),
+		Data: map[string]any{
+			"domain":    canonical,
+			"aliases":   domain.Aliases,
+			"expiresAt": notAfter,
+			"failures":  failures,
+			"error":     renewErr.Error(),
+		},
+	}
+	cm.config.Events.Publish(event)
+
+	if alert.Webhook != "" {
+		go func() {
+			if err := postWebhook(cm.ctx, alert.Webhook, event); err != nil {
+				logger.Warn("Failed to send certificate expiry alert", "domain", canonical, "error", err)
+			}
+		}()
+	}
+}
+
+// certificateExpiry returns when the current certificate of the domain expires.
+func (cm *CertificatesManager) certificateExpiry(canonical string) (time.Time, error) {
+	certData, err := cm.config.Store.Get(canonical + combinedCertExt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	parsedCert, err := parseCertificate(certData)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsedCert.NotAfter, nil
+}
+
+// cleanupDomainCertificates removes all certificates for a domain
 func (cm *CertificatesManager) cleanupDomainCertificates(canonical string) error {
-	combinedPath := filepath.Join(cm.config.CertDir, canonical+combinedCertExt)
-	if err := os.Remove(combinedPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove combined certificate file %s: %w", combinedPath, err)
+	if err := cm.config.Store.Delete(canonical + combinedCertExt); err != nil {
+		return fmt.Errorf("failed to remove combined certificate: %w", err)
+	}
+	if err := cm.config.Store.Delete(canonical + rsaCertExt); err != nil {
+		return fmt.Errorf("failed to remove RSA certificate: %w", err)
 	}
 
 	return nil
@@ -420,62 +697,41 @@ func (cm *CertificatesManager) validateDomain(domain string) error {
 	// Check if domain resolves
 	ips, err := net.LookupIP(domain)
 	if err != nil {
-		// Try to determine the specific issue
-		errorMessage := cm.buildDomainErrorMessage(domain, err)
-		return fmt.Errorf("\n\n%s", errorMessage)
+		return fmt.Errorf("\n\n%s", helpers.DescribeDNSError(domain, err))
 	}
 
 	// Additional check: ensure domain resolves to a reachable IP
 	if len(ips) == 0 {
-		return fmt.Errorf(`domain %s has no IP addresses assigned
-
-Please add DNS records:
-- A record: %s → YOUR_SERVER_IP
-- Test with: dig A %s`, domain, domain, domain)
+		return errors.New(helpers.MissingRecordsGuidance(domain))
 	}
 
 	return nil
 }
 
-func (cm *CertificatesManager) buildDomainErrorMessage(domain string, originalErr error) string {
-	errorStr := originalErr.Error()
-
-	if strings.Contains(errorStr, "NXDOMAIN") || strings.Contains(errorStr, "no such host") {
-		return fmt.Sprintf("Domain %s not found. Check if domain exists and DNS A record is configured.", domain)
-	}
-
-	if strings.Contains(errorStr, "timeout") {
-		return fmt.Sprintf("DNS timeout for %s. Check network connectivity or try different DNS server.", domain)
-	}
-
-	return fmt.Sprintf("DNS resolution failed for %s. Verify domain exists and has proper DNS records.", domain)
-}
-
 func (m *CertificatesManager) obtainCertificate(managedDomain CertificatesDomain, logger *slog.Logger) (obtainedDomain CertificatesDomain, err error) {
 	canonicalDomain := managedDomain.Canonical
 	email := managedDomain.Email
 	aliases := managedDomain.Aliases
-	allDomains := append([]string{canonicalDomain}, aliases...)
 
 	if err := m.validateDomain(canonicalDomain); err != nil {
 		return obtainedDomain, fmt.Errorf("domain validation failed for %s: %w", canonicalDomain, err)
 	}
 
-	client, err := m.clientManager.LoadOrRegisterClient(email)
-	if err != nil {
-		return obtainedDomain, fmt.Errorf("failed to load or register ACME client for %s: %w", email, err)
-	}
-
-	request := certificate.ObtainRequest{
-		Domains: allDomains, // Request cert for canonical + aliases
-		Bundle:  true,       // Bundle intermediate certs
-	}
-
-	certificates, err := client.Certificate.Obtain(request)
+	keyType, rsaKeyType := m.keyTypes(managedDomain)
+	certificates, err := m.obtain(managedDomain, managedDomain.Staging, legoKeyType(keyType), logger)
 	if err != nil {
 		return obtainedDomain, fmt.Errorf("failed to obtain certificate for %s: %w", canonicalDomain, err)
 	}
-	err = m.saveCertificate(canonicalDomain, certificates)
+	if rsaKeyType != "" {
+		rsaCertificates, err := m.obtain(managedDomain, managedDomain.Staging, legoKeyType(rsaKeyType), logger)
+		if err != nil {
+			return obtainedDomain, fmt.Errorf("failed to obtain RSA certificate for %s: %w", canonicalDomain, err)
+		}
+		if err := m.saveCertificate(canonicalDomain+rsaCertExt, rsaCertificates); err != nil {
+			return obtainedDomain, fmt.Errorf("failed to save RSA certificate for %s: %w", canonicalDomain, err)
+		}
+	}
+	err = m.saveCertificate(canonicalDomain+combinedCertExt, certificates)
 	if err != nil {
 		return obtainedDomain, fmt.Errorf("failed to save certificate for %s: %w", canonicalDomain, err)
 	} else {
@@ -483,16 +739,189 @@ func (m *CertificatesManager) obtainCertificate(managedDomain CertificatesDomain
 			Canonical: canonicalDomain,
 			Aliases:   aliases,
 			Email:     email,
+			Staging:   managedDomain.Staging,
+			KeyType:   managedDomain.KeyType,
 		}
 	}
 
 	return obtainedDomain, nil
 }
 
-func (m *CertificatesManager) saveCertificate(domain string, cert *certificate.Resource) error {
-	combinedPath := filepath.Join(m.config.CertDir, domain+combinedCertExt)
-	tmpPath := combinedPath + ".tmp"
+// keyTypes returns the key type of the certificate of the domain, and with dual certificates the key type of
+// the RSA certificate. An RSA key type of the domain then applies to the RSA certificate and the main
+// certificate uses ECDSA P-256, an ECDSA key type is paired with RSA 2048.
+func (m *CertificatesManager) keyTypes(domain CertificatesDomain) (keyType, rsaKeyType string) {
+	keyType = domain.KeyType
+	if keyType == "" {
+		keyType = config.DefaultKeyType
+	}
+	if !m.config.DualCertificates {
+		return keyType, ""
+	}
+	if strings.HasPrefix(keyType, "rsa") {
+		return config.KeyTypeEC256, keyType
+	}
+	return keyType, config.KeyTypeRSA2048
+}
+
+// legoKeyType returns the lego key type of a config key type.
+func legoKeyType(keyType string) certcrypto.KeyType {
+	switch keyType {
+	case config.KeyTypeEC256:
+		return certcrypto.EC256
+	case config.KeyTypeEC384:
+		return certcrypto.EC384
+	case config.KeyTypeRSA4096:
+		return certcrypto.RSA4096
+	default:
+		return certcrypto.RSA2048
+	}
+}
+
+// certificateKeyType returns the config key type of the certificate's key, e.g. ec256 or rsa2048.
+func certificateKeyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ec%d", key.Curve.Params().BitSize)
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa%d", key.N.BitLen())
+	default:
+		return ""
+	}
+}
+
+// stagingPrecheck obtains a certificate from the staging CA for the domain and discards it.
+// A failure here means the production request would most likely fail too, so it is skipped
+// to avoid using up production rate limits on misconfigured domains.
+func (m *CertificatesManager) stagingPrecheck(managedDomain CertificatesDomain, logger *slog.Logger) error {
+	canonicalDomain := managedDomain.Canonical
+
+	if err := m.validateDomain(canonicalDomain); err != nil {
+		return fmt.Errorf("domain validation failed for %s: %w", canonicalDomain, err)
+	}
+
+	if _, err := m.obtain(managedDomain, true, "", logger); err != nil {
+		return fmt.Errorf("staging precheck failed for %s, skipping production certificate request: %w", canonicalDomain, err)
+	}
+
+	return nil
+}
+
+// obtain requests a certificate for the domain and its aliases, with a new key of keyType or lego's default
+// when it's empty. Domains are validated with HTTP-01, and with DNS-01 when HTTP-01 fails and a DNS provider
+// is configured, e.g. for domains proxied by a CDN. The method that succeeded is recorded and tried first
+// for the next request of the domain.
+func (m *CertificatesManager) obtain(managedDomain CertificatesDomain, staging bool, keyType certcrypto.KeyType, logger *slog.Logger) (*certificate.Resource, error) {
+	canonicalDomain := managedDomain.Canonical
+	request := certificate.ObtainRequest{
+		Domains: append([]string{canonicalDomain}, managedDomain.Aliases...), // Request cert for canonical + aliases
+		Bundle:  true,                                                        // Bundle intermediate certs
+	}
+	if keyType != "" {
+		privateKey, err := certcrypto.GeneratePrivateKey(keyType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s certificate key: %w", keyType, err)
+		}
+		request.PrivateKey = privateKey
+	}
+
+	methods := []string{challengeHTTP01}
+	if m.config.DNSProvider != "" {
+		methods = append(methods, challengeDNS01)
+		if m.challengeMethod(logger, canonicalDomain) == challengeDNS01 {
+			slices.Reverse(methods)
+		}
+	}
+
+	var errs []error
+	for i, method := range methods {
+		dnsProvider := ""
+		if method == challengeDNS01 {
+			dnsProvider = m.config.DNSProvider
+		}
+		client, err := m.clientManager.LoadOrRegisterClient(managedDomain.Email, staging, dnsProvider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load or register ACME client for %s: %w", managedDomain.Email, err)
+		}
+
+		certificates, err := client.Certificate.Obtain(request)
+		if err == nil {
+			if err := m.recordChallengeMethod(canonicalDomain, method); err != nil {
+				logger.Warn("Failed to record challenge method", "domain", canonicalDomain, "error", err)
+			}
+			return certificates, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", method, err))
+
+		if i < len(methods)-1 {
+			logger.Warn("Domain validation failed, retrying with another challenge",
+				"domain", canonicalDomain,
+				"challenge", method,
+				"retry", methods[i+1],
+				"error", err)
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// challengeMethod returns the challenge method that last succeeded for the domain, empty if none is recorded.
+func (m *CertificatesManager) challengeMethod(logger *slog.Logger, domain string) string {
+	methods, err := m.loadChallengeMethods()
+	if err != nil {
+		logger.Warn("Failed to load challenge methods", "error", err)
+		return ""
+	}
+	return methods[domain]
+}
+
+func (m *CertificatesManager) recordChallengeMethod(domain, method string) error {
+	methods, err := m.loadChallengeMethods()
+	if err != nil {
+		return err
+	}
+	if methods[domain] == method {
+		return nil
+	}
+	methods[domain] = method
+
+	data, err := json.MarshalIndent(methods, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode challenge methods: %w", err)
+	}
+	path := m.challengesPath()
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, constants.ModeFileDefault); err != nil {
+		return fmt.Errorf("failed to save challenge methods: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace challenge methods: %w", err)
+	}
+	return nil
+}
 
+// loadChallengeMethods returns the recorded challenge methods by canonical domain.
+func (m *CertificatesManager) loadChallengeMethods() (map[string]string, error) {
+	methods := make(map[string]string)
+	data, err := os.ReadFile(m.challengesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return methods, nil
+		}
+		return nil, fmt.Errorf("failed to read challenge methods: %w", err)
+	}
+	if err := json.Unmarshal(data, &methods); err != nil {
+		return nil, fmt.Errorf("failed to parse challenge methods: %w", err)
+	}
+	return methods, nil
+}
+
+func (m *CertificatesManager) challengesPath() string {
+	return filepath.Join(m.config.CertDir, acme.AccountsDir, challengesFileName)
+}
+
+// saveCertificate stores the key and certificate chain as fileName.
+func (m *CertificatesManager) saveCertificate(fileName string, cert *certificate.Resource) error {
 	pemContent := bytes.Buffer{}
 
 	pemContent.Write(cert.PrivateKey)
@@ -501,14 +930,8 @@ func (m *CertificatesManager) saveCertificate(domain string, cert *certificate.R
 	}
 
 	pemContent.Write(cert.Certificate)
-	if err := os.WriteFile(tmpPath, pemContent.Bytes(), constants.ModeFileSecret); err != nil {
-		return fmt.Errorf("failed to save temporary combined certificate/key: %w", err)
-	}
-
-	// Atomic replace
-	if err := os.Rename(tmpPath, combinedPath); err != nil {
-		_ = os.Remove(tmpPath)
-		return fmt.Errorf("failed to atomically replace combined certificate/key: %w", err)
+	if err := m.config.Store.Put(fileName, pemContent.Bytes()); err != nil {
+		return fmt.Errorf("failed to save combined certificate/key: %w", err)
 	}
 
 	return nil
@@ -517,9 +940,9 @@ func (m *CertificatesManager) saveCertificate(domain string, cert *certificate.R
 func (m *CertificatesManager) CleanupExpiredCertificates(logger *slog.Logger, domains []CertificatesDomain) {
 	logger.Debug("Starting certificate cleanup check")
 
-	files, err := os.ReadDir(m.config.CertDir)
+	names, err := m.config.Store.List()
 	if err != nil {
-		logger.Error("Failed to read certificates directory", "dir", m.config.CertDir, "error", err)
+		logger.Error("Failed to list certificates", "error", err)
 		return
 	}
 
@@ -530,39 +953,41 @@ func (m *CertificatesManager) CleanupExpiredCertificates(logger *slog.Logger, do
 		managedDomainsMap[domain.Canonical] = struct{}{}
 	}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), combinedCertExt) {
-			domain := strings.TrimSuffix(file.Name(), combinedCertExt)
-			_, isManaged := managedDomainsMap[domain]
-			combinedCertPath := filepath.Join(m.config.CertDir, file.Name())
+	for _, name := range names {
+		if !strings.HasSuffix(name, combinedCertExt) {
+			continue
+		}
+		domain := strings.TrimSuffix(name, combinedCertExt)
+		if _, isManaged := managedDomainsMap[domain]; isManaged {
+			continue
+		}
 
-			certData, err := os.ReadFile(combinedCertPath)
-			if err != nil {
-				if os.IsNotExist(err) && !isManaged {
-					logger.Warn("Found orphaned PEM file for unmanaged domain (.crt missing). Deleting", "domain", domain)
-					os.Remove(combinedCertPath)
-					deleted++
-				} else if !os.IsNotExist(err) {
-					logger.Warn("Failed to read certificate file during cleanup", "file", combinedCertPath, "error", err)
-				}
-				continue
+		certData, err := m.config.Store.Get(name)
+		if err != nil {
+			// Removed since it was listed.
+			if !errors.Is(err, certstore.ErrNotFound) {
+				logger.Warn("Failed to read certificate during cleanup", "certificate", name, "error", err)
 			}
+			continue
+		}
 
-			parsedCert, err := parseCertificate(certData)
-			if err != nil {
-				logger.Warn("Failed to parse certificate during cleanup", "file", combinedCertPath)
-				continue
-			}
+		parsedCert, err := parseCertificate(certData)
+		if err != nil {
+			logger.Warn("Failed to parse certificate during cleanup", "certificate", name)
+			continue
+		}
 
-			if time.Now().After(parsedCert.NotAfter) && !isManaged {
-				logger.Debug("Deleting expired certificate files for unmanaged domain", "domain", domain)
-				os.Remove(combinedCertPath)
-				deleted++
+		if time.Now().After(parsedCert.NotAfter) {
+			logger.Debug("Deleting expired certificates for unmanaged domain", "domain", domain)
+			if err := m.cleanupDomainCertificates(domain); err != nil {
+				logger.Warn("Failed to delete expired certificates", "domain", domain, "error", err)
+				continue
 			}
+			deleted++
 		}
 	}
 
-	logger.Debug("Certificate cleanup complete. Deleted expired/orphaned certificate sets for unmanaged domains")
+	logger.Debug("Certificate cleanup complete. Deleted expired certificate sets for unmanaged domains", "deleted", deleted)
 }
 
 // parseCertificate takes PEM encoded certificate data and returns the parsed x509.Certificate
@@ -608,9 +1033,7 @@ func NewCertificatesKeyManager(keyDir string) (*CertificatesKeyManager, error) {
 }
 
 func (km *CertificatesKeyManager) LoadOrCreateKey(email string) (crypto.PrivateKey, error) {
-	// Sanitize email for filename
-	filename := helpers.SanitizeString(email) + keyCertExt
-	keyPath := filepath.Join(km.keyDir, filename)
+	keyPath := acme.KeyPath(km.keyDir, email)
 
 	if _, err := os.Stat(keyPath); err == nil {
 		return km.loadKey(keyPath)
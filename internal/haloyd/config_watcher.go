@@ -0,0 +1,157 @@
+package haloyd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Editors often write a file in several steps, changes within this delay are reloaded once.
+const configReloadDelay = time.Second
+
+// configReload is the result of loading the haloyd config file after it changed.
+type configReload struct {
+	config *config.HaloydConfig
+	err    error
+}
+
+// watchHaloydConfig sends the haloyd config each time the file changes, or the error if it's invalid.
+// The directory is watched instead of the file, so changes are seen when an editor replaces the file.
+func watchHaloydConfig(ctx context.Context, configFilePath string, logger *slog.Logger) (<-chan configReload, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(configFilePath)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch %s: %w", filepath.Dir(configFilePath), err)
+	}
+
+	reloads := make(chan configReload)
+	go func() {
+		defer watcher.Close()
+
+		var reloadTimer <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(event.Name) != filepath.Base(configFilePath) || event.Op == fsnotify.Chmod {
+					continue
+				}
+				reloadTimer = time.After(configReloadDelay)
+			case <-reloadTimer:
+				reloadTimer = nil
+				select {
+				case reloads <- loadReloadedConfig(configFilePath):
+				case <-ctx.Done():
+					return
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("Config watcher error", "error", err)
+			}
+		}
+	}()
+
+	return reloads, nil
+}
+
+func loadReloadedConfig(configFilePath string) configReload {
+	haloydConfig, err := config.LoadHaloydConfig(configFilePath)
+	if err != nil {
+		return configReload{err: err}
+	}
+	if haloydConfig == nil {
+		return configReload{err: fmt.Errorf("%s was removed", configFilePath)}
+	}
+	if err := haloydConfig.Validate(); err != nil {
+		return configReload{err: err}
+	}
+	return configReload{config: haloydConfig}
+}
+
+// applyReloadedConfig returns the config to run with after a reload and the settings that changed.
+// Settings that need a restart of the services keep their current values and are returned in restartRequired.
+func applyReloadedConfig(current, reloaded *config.HaloydConfig) (applied *config.HaloydConfig, changed, restartRequired []string) {
+	if current == nil {
+		current = &config.HaloydConfig{}
+	}
+	next := *reloaded
+
+	if next.API.Domain != current.API.Domain {
+		changed = append(changed, "api.domain")
+	}
+	if !slices.Equal(next.API.CORSOrigins, current.API.CORSOrigins) {
+		changed = append(changed, "api.cors_origins")
+	}
+	if !slices.Equal(next.API.TrustedProxies, current.API.TrustedProxies) {
+		changed = append(changed, "api.trusted_proxies")
+	}
+	if !reflect.DeepEqual(next.API.AppTokens, current.API.AppTokens) {
+		changed = append(changed, "api.app_tokens")
+	}
+	if next.API.RateLimit != current.API.RateLimit {
+		changed = append(changed, "api.rate_limit")
+	}
+	if !reflect.DeepEqual(next.API.Protection, current.API.Protection) {
+		changed = append(changed, "api.protection")
+	}
+	if !reflect.DeepEqual(next.API.OIDC, current.API.OIDC) {
+		changed = append(changed, "api.oidc")
+	}
+	if next.Certificates.AcmeEmail != current.Certificates.AcmeEmail {
+		changed = append(changed, "certificates.acme_email")
+	}
+	if next.Certificates.StagingPrecheck != current.Certificates.StagingPrecheck {
+		changed = append(changed, "certificates.staging_precheck")
+	}
+	if !reflect.DeepEqual(next.Certificates.RenewalWindow, current.Certificates.RenewalWindow) {
+		changed = append(changed, "certificates.renewal_window")
+	}
+	if next.Certificates.Staging != current.Certificates.Staging {
+		changed = append(changed, "certificates.staging")
+	}
+	if next.Certificates.DNSProvider != current.Certificates.DNSProvider {
+		changed = append(changed, "certificates.dns_provider")
+	}
+	if next.Certificates.ExpiryAlert != current.Certificates.ExpiryAlert {
+		changed = append(changed, "certificates.expiry_alert")
+	}
+	if next.Certificates.DualCertificates != current.Certificates.DualCertificates {
+		changed = append(changed, "certificates.dual_certificates")
+	}
+	if next.Certificates.KeyType != current.Certificates.KeyType {
+		changed = append(changed, "certificates.key_type")
+	}
+	if !reflect.DeepEqual(next.Deploy, current.Deploy) {
+		changed = append(changed, "deploy")
+	}
+	if !reflect.DeepEqual(next.Notifications, current.Notifications) {
+		changed = append(changed, "notifications")
+	}
+	if !reflect.DeepEqual(next.EventPublishers, current.EventPublishers) {
+		changed = append(changed, "event_publishers")
+	}
+
+	// The routing only changes the generated config, e.g. to switch back to ACL rules while migrating.
+	if next.Proxy.UsesMapRouting() != current.Proxy.UsesMapRouting() {
+		changed = append(changed, "proxy.routing")
+	}
+	restartRequired = next.KeepRestartRequired(current)
+
+	return &next, changed, restartRequired
+}
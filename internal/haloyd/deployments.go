@@ -2,15 +2,21 @@ package haloyd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"maps"
+	"net"
+	"slices"
 	"sync"
 
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/deploy"
 	"github.com/ameistad/haloy/internal/docker"
 	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 )
 
@@ -23,6 +29,12 @@ type DeploymentInstance struct {
 type Deployment struct {
 	Labels    *config.ContainerLabels
 	Instances []DeploymentInstance
+	// Paused deployments have no instances, their domains keep their certificates and serve a maintenance page.
+	Paused bool
+	// ABTest routes matching requests to a variant deployment of the app, nil when none is running.
+	ABTest *storage.ABTest
+	// Variant are the running replicas of the variant deployment of the A/B test.
+	Variant []DeploymentInstance
 }
 
 type FailedContainerInfo struct {
@@ -38,6 +50,10 @@ type DeploymentManager struct {
 	compareResult    compareResult
 	deploymentsMutex sync.RWMutex
 	haloydConfig     *config.HaloydConfig
+	// inspectCache holds container inspect results keyed by container ID. Entries are invalidated
+	// by Docker events, so repeated builds only inspect containers that have changed.
+	inspectCache      map[string]container.InspectResponse
+	inspectCacheMutex sync.Mutex
 }
 
 func NewDeploymentManager(cli *client.Client, haloydConfig *config.HaloydConfig) *DeploymentManager {
@@ -45,11 +61,37 @@ func NewDeploymentManager(cli *client.Client, haloydConfig *config.HaloydConfig)
 		cli:          cli,
 		deployments:  make(map[string]Deployment),
 		haloydConfig: haloydConfig,
+		inspectCache: make(map[string]container.InspectResponse),
 	}
 }
 
-// BuildDeployments scans all running Docker containers with the app label and builds a map of
-// current deployments in the system. It compares the new deployment state with the previous state
+// AppForDomain returns the name of the app serving the canonical domain, or an empty string.
+func (dm *DeploymentManager) AppForDomain(canonical string) string {
+	dm.deploymentsMutex.RLock()
+	defer dm.deploymentsMutex.RUnlock()
+
+	for appName, deployment := range dm.deployments {
+		if deployment.Labels == nil {
+			continue
+		}
+		for _, domain := range deployment.Labels.Domains {
+			if domain.Canonical == canonical {
+				return appName
+			}
+		}
+	}
+	return ""
+}
+
+// SetHaloydConfig replaces the haloyd config used for the API domain and the default ACME email.
+func (dm *DeploymentManager) SetHaloydConfig(haloydConfig *config.HaloydConfig) {
+	dm.deploymentsMutex.Lock()
+	defer dm.deploymentsMutex.Unlock()
+	dm.haloydConfig = haloydConfig
+}
+
+// BuildDeployments scans all running Docker containers with the app label and the paused apps and builds
+// a map of current deployments in the system. It compares the new deployment state with the previous state
 // to determine if any changes have occurred (additions, removals, or updates to deployments).
 // Returns true if the deployment state has changed, along with any error encountered.
 func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.Logger) (hasChanged bool, failedContainers []FailedContainerInfo, err error) {
@@ -59,8 +101,19 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 		return hasChanged, failedContainers, fmt.Errorf("failed to get containers: %w", err)
 	}
 
+	variantContainers, err := docker.GetABVariantContainers(ctx, dm.cli, false, "")
+	if err != nil {
+		return hasChanged, failedContainers, fmt.Errorf("failed to get A/B test variant containers: %w", err)
+	}
+
+	runningIDs := make(map[string]struct{}, len(containers)+len(variantContainers))
+	for _, containerSummary := range slices.Concat(containers, variantContainers) {
+		runningIDs[containerSummary.ID] = struct{}{}
+	}
+	dm.pruneInspectCache(runningIDs)
+
 	for _, containerSummary := range containers {
-		container, err := dm.cli.ContainerInspect(ctx, containerSummary.ID)
+		containerInfo, err := dm.inspectContainer(ctx, containerSummary.ID)
 		if err != nil {
 			logger.Error("Failed to inspect container", "container_id", containerSummary.ID, "error", err)
 			failedContainers = append(failedContainers, FailedContainerInfo{
@@ -71,7 +124,7 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 			continue
 		}
 
-		labels, err := config.ParseContainerLabels(container.Config.Labels)
+		labels, err := config.ParseContainerLabels(containerInfo.Config.Labels)
 		if err != nil {
 			logger.Error("Error parsing labels for container", "container_id", containerSummary.ID, "error", err)
 			failedContainers = append(failedContainers, FailedContainerInfo{
@@ -82,11 +135,11 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 			continue
 		}
 
-		ip, err := docker.ContainerNetworkIP(container, constants.DockerNetwork)
+		ip, err := docker.ContainerNetworkIP(containerInfo, constants.DockerNetwork)
 		if err != nil {
-			logger.Error("Error getting IP for container", "container_id", helpers.SafeIDPrefix(container.ID), "error", err)
+			logger.Error("Error getting IP for container", "container_id", helpers.SafeIDPrefix(containerInfo.ID), "error", err)
 			failedContainers = append(failedContainers, FailedContainerInfo{
-				ContainerID: container.ID,
+				ContainerID: containerInfo.ID,
 				Error:       err.Error(),
 				Labels:      labels,
 			})
@@ -100,7 +153,7 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 			port = constants.DefaultContainerPort
 		}
 
-		instance := DeploymentInstance{ContainerID: container.ID, IP: ip, Port: port}
+		instance := DeploymentInstance{ContainerID: containerInfo.ID, IP: ip, Port: port}
 
 		if deployment, exists := newDeployments[labels.AppName]; exists {
 			// There is a appName match, check if the deployment ID matches.
@@ -109,7 +162,7 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 				newDeployments[labels.AppName] = deployment
 			} else {
 				// Replace the deployment if the new one has a higher deployment ID
-				if deployment.Labels.DeploymentID < labels.DeploymentID {
+				if helpers.CompareDeploymentIDs(deployment.Labels.DeploymentID, labels.DeploymentID) < 0 {
 					newDeployments[labels.AppName] = Deployment{Labels: labels, Instances: []DeploymentInstance{instance}}
 				}
 			}
@@ -118,6 +171,64 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 		}
 	}
 
+	// Paused apps keep their routing and certificates. An app with running containers, e.g. one being
+	// deployed again, is routed to them instead.
+	pausedApps, err := deploy.PausedApps()
+	if err != nil {
+		return hasChanged, failedContainers, fmt.Errorf("failed to get paused apps: %w", err)
+	}
+	for appName, paused := range pausedApps {
+		if _, exists := newDeployments[appName]; exists {
+			continue
+		}
+		var containerLabels map[string]string
+		if err := json.Unmarshal(paused.Labels, &containerLabels); err != nil {
+			logger.Error("Error parsing labels of paused app", "app", appName, "error", err)
+			continue
+		}
+		labels, err := config.ParseContainerLabels(containerLabels)
+		if err != nil {
+			logger.Error("Error parsing labels of paused app", "app", appName, "error", err)
+			continue
+		}
+		newDeployments[appName] = Deployment{Labels: labels, Paused: true}
+	}
+
+	abTests, err := deploy.ABTests()
+	if err != nil {
+		return hasChanged, failedContainers, fmt.Errorf("failed to get A/B tests: %w", err)
+	}
+	for appName, test := range abTests {
+		if deployment, exists := newDeployments[appName]; exists {
+			deployment.ABTest = &test
+			newDeployments[appName] = deployment
+		}
+	}
+	for _, containerSummary := range variantContainers {
+		appName := containerSummary.Labels[config.LabelAppName]
+		deployment, exists := newDeployments[appName]
+		// Containers of a replaced or stopped test are removed by the API, they're never routed to.
+		if !exists || deployment.ABTest == nil || deployment.ABTest.VariantDeploymentID != containerSummary.Labels[config.LabelDeploymentID] {
+			continue
+		}
+		containerInfo, err := dm.inspectContainer(ctx, containerSummary.ID)
+		if err != nil {
+			logger.Error("Failed to inspect A/B test variant container", "container_id", helpers.SafeIDPrefix(containerSummary.ID), "error", err)
+			continue
+		}
+		ip, err := docker.ContainerNetworkIP(containerInfo, constants.DockerNetwork)
+		if err != nil {
+			logger.Error("Error getting IP for A/B test variant container", "container_id", helpers.SafeIDPrefix(containerSummary.ID), "error", err)
+			continue
+		}
+		port := constants.DefaultContainerPort
+		if deployment.Labels.Port != "" {
+			port = deployment.Labels.Port.String()
+		}
+		deployment.Variant = append(deployment.Variant, DeploymentInstance{ContainerID: containerInfo.ID, IP: ip, Port: port})
+		newDeployments[appName] = deployment
+	}
+
 	dm.deploymentsMutex.Lock()
 	defer dm.deploymentsMutex.Unlock()
 
@@ -133,6 +244,51 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 	return hasChanged, failedContainers, nil
 }
 
+// inspectContainer returns the cached inspect result of a container, inspecting it on a cache miss.
+func (dm *DeploymentManager) inspectContainer(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	dm.inspectCacheMutex.Lock()
+	cached, ok := dm.inspectCache[containerID]
+	dm.inspectCacheMutex.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	containerInfo, err := dm.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return containerInfo, err
+	}
+
+	dm.inspectCacheMutex.Lock()
+	dm.inspectCache[containerID] = containerInfo
+	dm.inspectCacheMutex.Unlock()
+	return containerInfo, nil
+}
+
+// pruneInspectCache removes cached containers that are no longer running.
+func (dm *DeploymentManager) pruneInspectCache(runningIDs map[string]struct{}) {
+	dm.inspectCacheMutex.Lock()
+	defer dm.inspectCacheMutex.Unlock()
+	for containerID := range dm.inspectCache {
+		if _, ok := runningIDs[containerID]; !ok {
+			delete(dm.inspectCache, containerID)
+		}
+	}
+}
+
+// InvalidateContainer drops the cached inspect result of a container, e.g. when Docker reports an event for it.
+func (dm *DeploymentManager) InvalidateContainer(containerID string) {
+	dm.inspectCacheMutex.Lock()
+	defer dm.inspectCacheMutex.Unlock()
+	delete(dm.inspectCache, containerID)
+}
+
+// InvalidateContainers drops all cached inspect results. Used when Docker events may have been missed.
+func (dm *DeploymentManager) InvalidateContainers() {
+	dm.inspectCacheMutex.Lock()
+	defer dm.inspectCacheMutex.Unlock()
+	clear(dm.inspectCache)
+}
+
 func (dm *DeploymentManager) HealthCheckNewContainers(ctx context.Context, logger *slog.Logger) (checked []Deployment, failedContainerIDs []string) {
 	for _, deployment := range dm.compareResult.AddedDeployments {
 		checked = append(checked, deployment)
@@ -146,6 +302,13 @@ func (dm *DeploymentManager) HealthCheckNewContainers(ctx context.Context, logge
 		for _, instance := range deployment.Instances {
 			if err := docker.HealthCheckContainer(ctx, dm.cli, logger, instance.ContainerID); err != nil {
 				failedContainerIDs = append(failedContainerIDs, instance.ContainerID)
+				continue
+			}
+
+			// Warm up the container before the HAProxy config including it is applied.
+			if len(deployment.Labels.WarmupPaths) > 0 {
+				address := net.JoinHostPort(instance.IP, instance.Port)
+				docker.WarmupContainer(ctx, logger, address, deployment.Labels.WarmupPaths, deployment.Labels.WarmupRequests)
 			}
 		}
 	}
@@ -162,7 +325,8 @@ func (dm *DeploymentManager) Deployments() map[string]Deployment {
 	return deploymentsCopy
 }
 
-// GetCertificateDomains collects all canonical domains and their aliases for certificate management.
+// GetCertificateDomains collects the canonical domains and aliases of the apps for certificate management.
+// System domains like the API domain are managed separately, see SystemDomains.
 func (dm *DeploymentManager) GetCertificateDomains() ([]CertificatesDomain, error) {
 	dm.deploymentsMutex.RLock()
 	defer dm.deploymentsMutex.RUnlock()
@@ -170,11 +334,12 @@ func (dm *DeploymentManager) GetCertificateDomains() ([]CertificatesDomain, erro
 	certDomains := make([]CertificatesDomain, 0, len(dm.deployments))
 
 	for _, deployment := range dm.deployments {
-		if deployment.Labels == nil {
+		// Internal apps are not routed publicly, so they never need certificates.
+		if deployment.Labels == nil || deployment.Labels.Exposure == config.ExposureInternal {
 			continue
 		}
 		for _, domain := range deployment.Labels.Domains {
-			if domain.Canonical != "" {
+			if domain.Canonical != "" && !domain.TLSDisabled() {
 				email := deployment.Labels.ACMEEmail
 				if dm.haloydConfig != nil && email == "" {
 					email = dm.haloydConfig.Certificates.AcmeEmail // Use default email if not set
@@ -184,10 +349,17 @@ func (dm *DeploymentManager) GetCertificateDomains() ([]CertificatesDomain, erro
 					return nil, fmt.Errorf("ACME email for domain %s not found in haloyd config or labels", domain.Canonical)
 				}
 
+				keyType := domain.KeyType
+				if dm.haloydConfig != nil && keyType == "" {
+					keyType = dm.haloydConfig.Certificates.KeyType
+				}
+
 				newDomain := CertificatesDomain{
 					Canonical: domain.Canonical,
 					Aliases:   domain.Aliases,
 					Email:     email,
+					Staging:   deployment.Labels.ACMEStaging || (dm.haloydConfig != nil && dm.haloydConfig.Certificates.Staging),
+					KeyType:   keyType,
 				}
 
 				if err := newDomain.Validate(); err != nil {
@@ -198,19 +370,16 @@ func (dm *DeploymentManager) GetCertificateDomains() ([]CertificatesDomain, erro
 			}
 		}
 	}
-
-	// We'll add the domain set in the haloyd config file if it exists.
-	if dm.haloydConfig != nil && dm.haloydConfig.API.Domain != "" && dm.haloydConfig.Certificates.AcmeEmail != "" {
-		apiDomain := CertificatesDomain{
-			Canonical: dm.haloydConfig.API.Domain,
-			Aliases:   []string{},
-			Email:     dm.haloydConfig.Certificates.AcmeEmail,
-		}
-		certDomains = append(certDomains, apiDomain)
-	}
 	return certDomains, nil
 }
 
+// SystemDomains returns the domains served by haloyd itself, see SystemDomain.
+func (dm *DeploymentManager) SystemDomains() []SystemDomain {
+	dm.deploymentsMutex.RLock()
+	defer dm.deploymentsMutex.RUnlock()
+	return systemDomains(dm.haloydConfig)
+}
+
 type compareResult struct {
 	UpdatedDeployments map[string]Deployment
 	RemovedDeployments map[string]Deployment
@@ -229,10 +398,11 @@ func compareDeployments(oldDeployments, newDeployments map[string]Deployment) co
 
 	for appName, prevDeployment := range oldDeployments {
 		if currentDeployment, exists := newDeployments[appName]; exists {
-			if prevDeployment.Labels.DeploymentID != currentDeployment.Labels.DeploymentID {
+			if prevDeployment.Labels.DeploymentID != currentDeployment.Labels.DeploymentID || prevDeployment.Paused != currentDeployment.Paused ||
+				!abTestsEqual(prevDeployment.ABTest, currentDeployment.ABTest) {
 				updatedDeployments[appName] = currentDeployment
 			} else {
-				if !instancesEqual(prevDeployment.Instances, currentDeployment.Instances) {
+				if !instancesEqual(prevDeployment.Instances, currentDeployment.Instances) || !instancesEqual(prevDeployment.Variant, currentDeployment.Variant) {
 					updatedDeployments[appName] = currentDeployment
 				}
 			}
@@ -256,6 +426,14 @@ func compareDeployments(oldDeployments, newDeployments map[string]Deployment) co
 	return result
 }
 
+func abTestsEqual(a, b *storage.ABTest) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.VariantDeploymentID == b.VariantDeploymentID && a.HeaderName == b.HeaderName && a.HeaderValue == b.HeaderValue &&
+		a.CookieName == b.CookieName && a.CookieValue == b.CookieValue && a.Percentage == b.Percentage
+}
+
 func instancesEqual(a, b []DeploymentInstance) bool {
 	if len(a) != len(b) {
 		return false
@@ -0,0 +1,77 @@
+package haloyd
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/docker/docker/client"
+)
+
+// DockerStatus tracks the connection to the Docker daemon, e.g. while it restarts.
+type DockerStatus struct {
+	mutex     sync.Mutex
+	connected bool
+	since     time.Time
+	lastError string
+}
+
+func NewDockerStatus() *DockerStatus {
+	return &DockerStatus{connected: true, since: time.Now()}
+}
+
+func (s *DockerStatus) Connected() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connected
+}
+
+func (s *DockerStatus) setDisconnected(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.connected {
+		s.connected = false
+		s.since = time.Now()
+	}
+	if err != nil {
+		s.lastError = err.Error()
+	}
+}
+
+func (s *DockerStatus) setConnected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.connected = true
+	s.since = time.Now()
+	s.lastError = ""
+}
+
+// Status returns the connection state for the API.
+func (s *DockerStatus) Status() apitypes.DockerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	since := s.since
+	return apitypes.DockerStatus{Connected: s.connected, Since: &since, Error: s.lastError}
+}
+
+// waitForDocker pings the Docker daemon with exponential backoff until it answers. It returns false
+// when ctx is done first.
+func waitForDocker(ctx context.Context, cli *client.Client, logger *slog.Logger) bool {
+	delay := dockerReconnectMinDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		_, err := cli.Ping(ctx)
+		if err == nil {
+			return true
+		}
+		delay = min(delay*2, dockerReconnectMaxDelay)
+		logger.Debug("Docker daemon not reachable yet", "retryIn", delay, "error", err)
+	}
+}
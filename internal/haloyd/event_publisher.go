@@ -0,0 +1,172 @@
+package haloyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
+)
+
+const (
+	eventPublishTimeout = 10 * time.Second
+	// eventPublisherQueueSize is how many events wait for a slow broker before new events are dropped.
+	eventPublisherQueueSize = 500
+)
+
+// eventPublisherClient sends a message to a message broker. Connections are opened on the first publish and kept
+// open, Close drops the connection so the next publish opens a new one.
+type eventPublisherClient interface {
+	Publish(ctx context.Context, topic, key string, payload []byte) error
+	Close()
+}
+
+// EventPublishers publish server events to the message brokers of the haloyd config. Events are published at most
+// once: an event that can't be delivered after reconnecting once is logged and dropped.
+type EventPublishers struct {
+	logger *slog.Logger
+	// appForDomain returns the app serving a domain, so certificate events match the apps of a publisher.
+	appForDomain func(canonical string) string
+
+	mutex   sync.Mutex
+	workers []*eventPublisherWorker
+}
+
+func NewEventPublishers(publishers []config.EventPublisher, appForDomain func(canonical string) string, logger *slog.Logger) *EventPublishers {
+	p := &EventPublishers{
+		logger:       logger,
+		appForDomain: appForDomain,
+	}
+	p.SetConfig(publishers)
+	return p
+}
+
+// SetConfig replaces the publishers. Events queued for the previous publishers are still sent.
+func (p *EventPublishers) SetConfig(publishers []config.EventPublisher) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, worker := range p.workers {
+		close(worker.queue)
+	}
+	p.workers = nil
+	for _, publisherConfig := range publishers {
+		client, err := newEventPublisherClient(publisherConfig)
+		if err != nil {
+			p.logger.Warn("Failed to set up event publisher", "type", publisherConfig.Type, "error", err)
+			continue
+		}
+		worker := &eventPublisherWorker{
+			config: publisherConfig,
+			client: client,
+			queue:  make(chan events.Event, eventPublisherQueueSize),
+		}
+		p.workers = append(p.workers, worker)
+		go worker.run(p.logger)
+	}
+}
+
+// Run publishes the events of the broker until the context is canceled.
+func (p *EventPublishers) Run(ctx context.Context, eventBroker *events.Broker) {
+	defer p.SetConfig(nil)
+	eventBroker.Consume(ctx, p.publish, func() {
+		p.logger.Warn("Event publishers fell behind on events, some events were not published")
+	})
+}
+
+func (p *EventPublishers) publish(event events.Event) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.workers) == 0 {
+		return
+	}
+
+	appName := event.AppName
+	if appName == "" && p.appForDomain != nil {
+		if domain, ok := event.Data["domain"].(string); ok {
+			appName = p.appForDomain(domain)
+		}
+	}
+
+	for _, worker := range p.workers {
+		if len(worker.config.Apps) > 0 && !slices.Contains(worker.config.Apps, appName) {
+			continue
+		}
+		filter := events.Filter{Types: worker.config.Events}
+		if !filter.Match(event) {
+			continue
+		}
+		select {
+		case worker.queue <- event:
+		default:
+			p.logger.Warn("Event publisher is falling behind, dropped event", "type", worker.config.Type, "event", event.Type)
+		}
+	}
+}
+
+// eventPublisherWorker publishes the queued events of one publisher in order.
+type eventPublisherWorker struct {
+	config config.EventPublisher
+	client eventPublisherClient
+	queue  chan events.Event
+}
+
+func (w *eventPublisherWorker) run(logger *slog.Logger) {
+	defer w.client.Close()
+	for event := range w.queue {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			logger.Warn("Failed to encode event", "event", event.Type, "error", err)
+			continue
+		}
+		if err := w.send(event, payload); err != nil {
+			logger.Warn("Failed to publish event", "type", w.config.Type, "event", event.Type, "error", err)
+		}
+	}
+}
+
+// send publishes the event, and once more on a new connection when the connection was closed by the broker.
+func (w *eventPublisherWorker) send(event events.Event, payload []byte) error {
+	topic := w.config.TopicName()
+	if w.config.Type != config.EventPublisherKafka {
+		// Subscribers filter on the event type with wildcards, e.g. haloy.events.deployment.> in NATS.
+		topic += "." + string(event.Type)
+	}
+
+	var err error
+	for range 2 {
+		ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+		err = w.client.Publish(ctx, topic, event.AppName, payload)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		w.client.Close()
+	}
+	return err
+}
+
+func newEventPublisherClient(publisherConfig config.EventPublisher) (eventPublisherClient, error) {
+	u, err := url.Parse(publisherConfig.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	password := os.Getenv(publisherConfig.PasswordEnvVar())
+	switch publisherConfig.Type {
+	case config.EventPublisherNATS:
+		return newNATSPublisher(u, password), nil
+	case config.EventPublisherRedis:
+		return newRedisPublisher(u, password)
+	case config.EventPublisherKafka:
+		return newKafkaPublisher(u, password), nil
+	default:
+		return nil, fmt.Errorf("unknown type '%s'", publisherConfig.Type)
+	}
+}
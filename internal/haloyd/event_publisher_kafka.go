@@ -0,0 +1,92 @@
+package haloyd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// kafkaPublisher produces events to a Kafka topic through the v2 API of a Kafka REST proxy, which the Confluent
+// REST Proxy and the HTTP proxy of Redpanda serve. The app name is the record key, so the events of an app stay
+// in order.
+type kafkaPublisher struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	password string
+}
+
+func newKafkaPublisher(u *url.URL, password string) *kafkaPublisher {
+	base := *u
+	base.User = nil
+	return &kafkaPublisher{
+		client:   &http.Client{Timeout: eventPublishTimeout},
+		baseURL:  strings.TrimSuffix(base.String(), "/"),
+		username: u.User.Username(),
+		password: password,
+	}
+}
+
+type kafkaRecord struct {
+	Key   *string         `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+	Message string `json:"message"`
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	record := kafkaRecord{Value: payload}
+	if key != "" {
+		record.Key = &key
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": {record}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce to %s: %w", p.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	var produced kafkaProduceResponse
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	json.Unmarshal(responseBody, &produced)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if produced.Message != "" {
+			return fmt.Errorf("REST proxy returned status %d: %s", resp.StatusCode, produced.Message)
+		}
+		return fmt.Errorf("REST proxy returned status %d", resp.StatusCode)
+	}
+	for _, offset := range produced.Offsets {
+		if offset.ErrorCode != nil || offset.Error != "" {
+			return fmt.Errorf("REST proxy failed to produce the event: %s", offset.Error)
+		}
+	}
+	return nil
+}
+
+// Close does nothing, the HTTP client reuses its connections.
+func (p *kafkaPublisher) Close() {}
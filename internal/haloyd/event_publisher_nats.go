@@ -0,0 +1,176 @@
+package haloyd
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+// natsPublisher publishes events with the text protocol of NATS. Every publish is followed by a PING, so the
+// PONG of the server confirms it received the message.
+type natsPublisher struct {
+	address  string
+	tls      bool
+	username string
+	password string
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newNATSPublisher(u *url.URL, password string) *natsPublisher {
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &natsPublisher{
+		address:  address,
+		tls:      u.Scheme == "tls",
+		username: u.User.Username(),
+		password: password,
+	}
+}
+
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+func (p *natsPublisher) connect(ctx context.Context) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", p.address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read server info: %w", err)
+	}
+	infoJSON, found := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !found {
+		conn.Close()
+		return fmt.Errorf("unexpected greeting from %s, is it a NATS server?", p.address)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to decode server info: %w", err)
+	}
+
+	// NATS upgrades to TLS after the INFO line.
+	useTLS := p.tls || info.TLSRequired
+	if useTLS {
+		host, _, _ := net.SplitHostPort(p.address)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("TLS handshake with %s failed: %w", p.address, err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	connect := natsConnect{
+		TLSRequired: useTLS,
+		Name:        "haloyd",
+		Lang:        "go",
+		Version:     constants.Version,
+		Protocol:    1,
+	}
+	if p.username != "" {
+		connect.User = p.username
+		connect.Pass = p.password
+	} else {
+		connect.AuthToken = p.password
+	}
+	connectJSON, err := json.Marshal(connect)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.conn = conn
+	p.reader = reader
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connectJSON); err != nil {
+		p.Close()
+		return err
+	}
+	if err := p.waitForPong(); err != nil {
+		p.Close()
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, subject, _ string, payload []byte) error {
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		p.conn.SetDeadline(deadline)
+	}
+
+	message := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := p.conn.Write([]byte(message)); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", p.address, err)
+	}
+	return p.waitForPong()
+}
+
+// waitForPong reads until the PONG of the server, answering its PINGs.
+func (p *natsPublisher) waitForPong() error {
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read from %s: %w", p.address, err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("NATS server returned " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need no answer.
+	}
+}
+
+func (p *natsPublisher) Close() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.reader = nil
+	}
+}
@@ -0,0 +1,132 @@
+package haloyd
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// redisPublisher publishes events with PUBLISH on a Redis connection.
+type redisPublisher struct {
+	address  string
+	tls      bool
+	username string
+	password string
+	database int
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisPublisher(u *url.URL, password string) (*redisPublisher, error) {
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	database := 0
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		var err error
+		database, err = strconv.Atoi(path)
+		if err != nil || database < 0 {
+			return nil, fmt.Errorf("invalid database '%s' in url, must be a number", path)
+		}
+	}
+	return &redisPublisher{
+		address:  address,
+		tls:      u.Scheme == "rediss",
+		username: u.User.Username(),
+		password: password,
+		database: database,
+	}, nil
+}
+
+func (p *redisPublisher) connect(ctx context.Context) error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{}
+	if p.tls {
+		host, _, _ := net.SplitHostPort(p.address)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", p.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", p.address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", p.address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	p.conn = conn
+	p.reader = bufio.NewReader(conn)
+
+	if p.password != "" {
+		args := []string{"AUTH", p.password}
+		if p.username != "" {
+			args = []string{"AUTH", p.username, p.password}
+		}
+		if err := p.command(args...); err != nil {
+			p.Close()
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	if p.database != 0 {
+		if err := p.command("SELECT", strconv.Itoa(p.database)); err != nil {
+			p.Close()
+			return fmt.Errorf("failed to select database %d: %w", p.database, err)
+		}
+	}
+	return nil
+}
+
+func (p *redisPublisher) Publish(ctx context.Context, channel, _ string, payload []byte) error {
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		p.conn.SetDeadline(deadline)
+	}
+	return p.command("PUBLISH", channel, string(payload))
+}
+
+// command sends a command and reads its reply. Only the simple replies of the commands used here are read.
+func (p *redisPublisher) command(args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := p.conn.Write([]byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", p.address, err)
+	}
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read from %s: %w", p.address, err)
+	}
+	line = strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(line, "+"), strings.HasPrefix(line, ":"):
+		return nil
+	case strings.HasPrefix(line, "-"):
+		return errors.New("Redis returned " + line[1:])
+	default:
+		return fmt.Errorf("unexpected reply from %s", p.address)
+	}
+}
+
+func (p *redisPublisher) Close() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.reader = nil
+	}
+}
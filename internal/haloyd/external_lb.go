@@ -0,0 +1,135 @@
+package haloyd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
+)
+
+// externalLBProvider adds and removes the server in a pool or target group of an external load balancer.
+// Both calls are idempotent.
+type externalLBProvider interface {
+	Register(ctx context.Context, target string) error
+	Deregister(ctx context.Context, target string) error
+}
+
+// ExternalLB keeps the server registered with the external load balancer targets of the deployed apps.
+type ExternalLB struct {
+	provider externalLBProvider
+	name     string
+	events   *events.Broker
+	// registered maps app names to the target they were registered with.
+	registered map[string]string
+	mutex      sync.Mutex
+}
+
+// NewExternalLB returns the external load balancer integration of the haloyd config, or nil when it's disabled.
+func NewExternalLB(lbConfig config.ExternalLBConfig, eventBroker *events.Broker) (*ExternalLB, error) {
+	var provider externalLBProvider
+	var err error
+	switch lbConfig.Provider {
+	case "":
+		return nil, nil
+	case config.ExternalLBProviderCloudflare:
+		provider, err = newCloudflareLB(lbConfig)
+	case config.ExternalLBProviderAWS:
+		provider, err = newAWSLB(lbConfig)
+	default:
+		err = fmt.Errorf("unknown provider '%s'", lbConfig.Provider)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure external load balancer: %w", err)
+	}
+
+	return &ExternalLB{
+		provider:   provider,
+		name:       lbConfig.Provider,
+		events:     eventBroker,
+		registered: make(map[string]string),
+	}, nil
+}
+
+// Sync registers the server with the targets of the deployments and deregisters it from targets no
+// deployment uses anymore. The apps that were just deployed are registered again, in case the
+// registration was removed in the load balancer. Failed registrations are retried on the next sync.
+func (lb *ExternalLB) Sync(ctx context.Context, logger *slog.Logger, deployments map[string]Deployment, apps []*TriggeredByApp) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	desired := make(map[string]string)
+	inUse := make(map[string]struct{})
+	for appName, d := range deployments {
+		if d.Labels == nil || d.Labels.ExternalLBTarget == "" {
+			continue
+		}
+		desired[appName] = d.Labels.ExternalLBTarget
+		inUse[d.Labels.ExternalLBTarget] = struct{}{}
+	}
+
+	deployed := make(map[string]*TriggeredByApp, len(apps))
+	for _, app := range apps {
+		deployed[app.appName] = app
+	}
+
+	for appName, target := range lb.registered {
+		if desired[appName] == target {
+			continue
+		}
+		// Apps can share a pool, the server stays registered while one of them is deployed.
+		if _, ok := inUse[target]; ok {
+			delete(lb.registered, appName)
+			continue
+		}
+		if err := lb.provider.Deregister(ctx, target); err != nil {
+			logger.Error("Failed to deregister from external load balancer, retrying on the next update", "app", appName, "target", target, "error", err)
+			lb.publishFailure(appName, "", target, err)
+			continue
+		}
+		delete(lb.registered, appName)
+		logger.Info("Deregistered from external load balancer", "app", appName, "target", target, "provider", lb.name)
+		lb.events.Publish(events.Event{
+			Type:    events.TypeLBDeregistered,
+			AppName: appName,
+			Data:    map[string]any{"provider": lb.name, "target": target},
+		})
+	}
+
+	for appName, target := range desired {
+		app, justDeployed := deployed[appName]
+		if lb.registered[appName] == target && !justDeployed {
+			continue
+		}
+		appLogger := logger
+		var deploymentID string
+		if justDeployed {
+			appLogger = app.log(logger)
+			deploymentID = app.deploymentID
+		}
+		if err := lb.provider.Register(ctx, target); err != nil {
+			appLogger.Error("Failed to register with external load balancer, retrying on the next update", "app", appName, "target", target, "error", err)
+			lb.publishFailure(appName, deploymentID, target, err)
+			continue
+		}
+		lb.registered[appName] = target
+		appLogger.Info("Registered with external load balancer", "app", appName, "target", target, "provider", lb.name)
+		lb.events.Publish(events.Event{
+			Type:         events.TypeLBRegistered,
+			AppName:      appName,
+			DeploymentID: deploymentID,
+			Data:         map[string]any{"provider": lb.name, "target": target},
+		})
+	}
+}
+
+func (lb *ExternalLB) publishFailure(appName, deploymentID, target string, err error) {
+	lb.events.Publish(events.Event{
+		Type:         events.TypeLBFailed,
+		AppName:      appName,
+		DeploymentID: deploymentID,
+		Data:         map[string]any{"provider": lb.name, "target": target, "error": err.Error()},
+	})
+}
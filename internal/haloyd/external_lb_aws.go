@@ -0,0 +1,160 @@
+package haloyd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+)
+
+const awsELBAPIVersion = "2015-12-01"
+
+// awsLB registers the server as a target in AWS Application Load Balancer target groups through the
+// Elastic Load Balancing API. Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// the optional AWS_SESSION_TOKEN. The region is taken from the target group ARN.
+type awsLB struct {
+	client          *http.Client
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	address         string
+	port            int
+}
+
+func newAWSLB(lbConfig config.ExternalLBConfig) (*awsLB, error) {
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return &awsLB{
+		client:          &http.Client{Timeout: 30 * time.Second},
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		address:         lbConfig.Address,
+		port:            lbConfig.Port,
+	}, nil
+}
+
+func (a *awsLB) Register(ctx context.Context, targetGroupARN string) error {
+	return a.call(ctx, "RegisterTargets", targetGroupARN)
+}
+
+func (a *awsLB) Deregister(ctx context.Context, targetGroupARN string) error {
+	return a.call(ctx, "DeregisterTargets", targetGroupARN)
+}
+
+type awsErrorResponse struct {
+	Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+func (a *awsLB) call(ctx context.Context, action, targetGroupARN string) error {
+	// arn:aws:elasticloadbalancing:<region>:<account>:targetgroup/<name>/<id>
+	arnParts := strings.Split(targetGroupARN, ":")
+	if len(arnParts) < 6 || arnParts[2] != "elasticloadbalancing" || arnParts[3] == "" {
+		return fmt.Errorf("invalid target group ARN '%s'", targetGroupARN)
+	}
+	region := arnParts[3]
+
+	form := url.Values{}
+	form.Set("Action", action)
+	form.Set("Version", awsELBAPIVersion)
+	form.Set("TargetGroupArn", targetGroupARN)
+	form.Set("Targets.member.1.Id", a.address)
+	form.Set("Targets.member.1.Port", strconv.Itoa(a.port))
+	body := []byte(form.Encode())
+
+	endpoint := fmt.Sprintf("https://elasticloadbalancing.%s.amazonaws.com/", region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create AWS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	a.sign(req, body, region, "elasticloadbalancing", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var errResp awsErrorResponse
+		if xml.Unmarshal(respBody, &errResp) == nil && errResp.Error.Code != "" {
+			return fmt.Errorf("%s: %s: %s", action, errResp.Error.Code, errResp.Error.Message)
+		}
+		return fmt.Errorf("%s returned status %d", action, resp.StatusCode)
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to the request.
+func (a *awsLB) sign(req *http.Request, body []byte, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	dateStamp := now.UTC().Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.sessionToken)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date"}
+	if a.sessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := dateStamp + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+a.secretAccessKey), dateStamp)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
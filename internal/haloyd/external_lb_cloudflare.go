@@ -0,0 +1,147 @@
+package haloyd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+)
+
+const cloudflareAPIURL = "https://api.cloudflare.com/client/v4"
+
+// cloudflareLB adds the server as an origin to Cloudflare Load Balancing pools. The API token is read
+// from CLOUDFLARE_API_TOKEN and needs the Load Balancing: Monitors and Pools Edit permission.
+type cloudflareLB struct {
+	client    *http.Client
+	token     string
+	accountID string
+	address   string
+	port      int
+}
+
+func newCloudflareLB(lbConfig config.ExternalLBConfig) (*cloudflareLB, error) {
+	token := os.Getenv("CLOUDFLARE_API_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("CLOUDFLARE_API_TOKEN is not set")
+	}
+	return &cloudflareLB{
+		client:    &http.Client{Timeout: 30 * time.Second},
+		token:     token,
+		accountID: lbConfig.AccountID,
+		address:   lbConfig.Address,
+		port:      lbConfig.Port,
+	}, nil
+}
+
+// cloudflareOrigin is an origin of a pool. Fields haloy doesn't use are kept as they are when the
+// origins are written back.
+type cloudflareOrigin map[string]any
+
+func (o cloudflareOrigin) address() string {
+	address, _ := o["address"].(string)
+	return address
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result struct {
+		Origins []cloudflareOrigin `json:"origins"`
+	} `json:"result"`
+}
+
+func (c *cloudflareLB) Register(ctx context.Context, pool string) error {
+	origins, err := c.origins(ctx, pool)
+	if err != nil {
+		return err
+	}
+	for _, origin := range origins {
+		if origin.address() == c.address {
+			if enabled, _ := origin["enabled"].(bool); enabled {
+				return nil
+			}
+			origin["enabled"] = true
+			return c.setOrigins(ctx, pool, origins)
+		}
+	}
+	origins = append(origins, cloudflareOrigin{
+		"name":    "haloy-" + strings.ReplaceAll(c.address, ":", "-"),
+		"address": c.address,
+		"port":    c.port,
+		"enabled": true,
+		"weight":  1,
+	})
+	return c.setOrigins(ctx, pool, origins)
+}
+
+func (c *cloudflareLB) Deregister(ctx context.Context, pool string) error {
+	origins, err := c.origins(ctx, pool)
+	if err != nil {
+		return err
+	}
+	remaining := make([]cloudflareOrigin, 0, len(origins))
+	for _, origin := range origins {
+		if origin.address() != c.address {
+			remaining = append(remaining, origin)
+		}
+	}
+	if len(remaining) == len(origins) {
+		return nil
+	}
+	return c.setOrigins(ctx, pool, remaining)
+}
+
+func (c *cloudflareLB) origins(ctx context.Context, pool string) ([]cloudflareOrigin, error) {
+	resp, err := c.do(ctx, http.MethodGet, pool, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Result.Origins, nil
+}
+
+func (c *cloudflareLB) setOrigins(ctx context.Context, pool string, origins []cloudflareOrigin) error {
+	body, err := json.Marshal(map[string]any{"origins": origins})
+	if err != nil {
+		return fmt.Errorf("failed to encode origins: %w", err)
+	}
+	_, err = c.do(ctx, http.MethodPatch, pool, body)
+	return err
+}
+
+func (c *cloudflareLB) do(ctx context.Context, method, pool string, body []byte) (*cloudflareResponse, error) {
+	url := fmt.Sprintf("%s/accounts/%s/load_balancers/pools/%s", cloudflareAPIURL, c.accountID, pool)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloudflare request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cloudflare request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Cloudflare response (status %d): %w", resp.StatusCode, err)
+	}
+	if !result.Success {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, fmt.Sprintf("%s (code %d)", e.Message, e.Code))
+		}
+		return nil, fmt.Errorf("cloudflare pool %s: status %d: %s", pool, resp.StatusCode, strings.Join(messages, ", "))
+	}
+	return &result, nil
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -16,10 +18,13 @@ import (
 	"github.com/ameistad/haloy/internal/api"
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/deploy"
 	"github.com/ameistad/haloy/internal/docker"
+	haloyevents "github.com/ameistad/haloy/internal/events"
 	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/ameistad/haloy/internal/logging"
 	"github.com/ameistad/haloy/internal/storage"
+	"github.com/ameistad/haloy/internal/tracing"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
@@ -27,9 +32,17 @@ import (
 )
 
 const (
-	maintenanceInterval = 12 * time.Hour   // Interval for periodic maintenance tasks
-	eventDebounceDelay  = 5 * time.Second  // Delay for debouncing container events
-	updateTimeout       = 15 * time.Minute // Max time for a single update operation
+	maintenanceInterval     = 12 * time.Hour         // Interval for periodic maintenance tasks
+	eventDebounceDelay      = 5 * time.Second        // Delay for debouncing container events
+	updateTimeout           = 15 * time.Minute       // Max time for a single update operation
+	updateCoalesceWindow    = 500 * time.Millisecond // Time to collect app events for a single update
+	shutdownTimeout         = 50 * time.Second       // Max time to wait for running deployments on shutdown
+	reconcileInterval       = time.Minute            // Interval for comparing containers to deployments and correcting drift
+	dockerReconnectMinDelay = time.Second            // First delay before pinging the Docker daemon after the event stream failed
+	dockerReconnectMaxDelay = 30 * time.Second       // Max delay between pings while the Docker daemon is down
+	autoscaleInterval       = 15 * time.Second       // Interval for scaling apps with autoscale based on HAProxy stats
+	imageWatchInterval      = 30 * time.Second       // Interval for checking apps with image_watch, each app is checked at its own interval
+	renewalCheckInterval    = 10 * time.Minute       // Interval for renewing deferred certificates in the renewal window
 )
 
 type ContainerEvent struct {
@@ -51,13 +64,16 @@ func Run(debug bool) {
 	logBroker := logging.NewLogBroker()
 	logger := logging.NewLogger(logLevel, logBroker)
 
+	// Structured events for machines, e.g. dashboards and bots, streamed on /v1/events.
+	eventBroker := haloyevents.NewBroker()
+
 	logger.Info("haloyd started",
 		"version", constants.Version,
 		"network", constants.DockerNetwork,
 		"debug", debug)
 
 	if debug {
-		logger.Info("Debug mode enabled: No changes will be applied to HAProxy. Staging certificates will be used for all domains.")
+		logger.Info("Debug mode enabled: No changes will be applied to HAProxy. Set certificates.staging to use staging certificates.")
 	}
 
 	db, err := storage.New()
@@ -66,11 +82,6 @@ func Run(debug bool) {
 		return
 	}
 	defer db.Close()
-	if err := db.Migrate(); err != nil {
-		logger.Error("Failed to run database migrations", "error", err)
-		return
-	}
-	logger.Info("Database initialized successfully")
 
 	dataDir, err := config.DataDir()
 	if err != nil {
@@ -89,6 +100,46 @@ func Run(debug bool) {
 		return
 	}
 
+	logLevel, logFile, err := configureLogging(haloydConfig, dataDir, debug)
+	if err != nil {
+		logger.Error("Failed to configure logging", "error", err)
+		return
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	logger = logging.NewLogger(logLevel, logBroker)
+
+	if err := migrateDatabase(db, haloydConfig, logger); err != nil {
+		logger.Error("Failed to run database migrations", "error", err)
+		return
+	}
+	logger.Info("Database initialized successfully")
+
+	// Deployment logs are kept for 'haloy logs --deployment' after the live stream is gone.
+	logBroker.PersistDeploymentLogs(db, logger)
+	pruneDeploymentLogs(db, haloydConfig, logger)
+
+	var tracingConfig config.HaloydTracing
+	if haloydConfig != nil {
+		tracingConfig = haloydConfig.Tracing
+	}
+	shutdownTracing, err := tracing.Setup(ctx, tracingConfig)
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		return
+	}
+	defer func() {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Warn("Failed to flush traces", "error", err)
+		}
+	}()
+	if tracingConfig.Endpoint != "" {
+		logger.Info("Tracing enabled", "endpoint", tracingConfig.Endpoint)
+	}
+
 	cli, err := docker.NewClient(ctx)
 	if err != nil {
 		logging.LogFatal(logger, "Failed to create Docker client", "error", err)
@@ -100,13 +151,27 @@ func Run(debug bool) {
 		logging.LogFatal(logger, "%s environment variable not set", constants.EnvVarAPIToken)
 	}
 
-	apiServer := api.NewServer(apiToken, logBroker, logLevel)
-	go func() {
-		logger.Info(fmt.Sprintf("Starting API server on :%s...", constants.APIServerPort))
-		if err := apiServer.ListenAndServe(fmt.Sprintf(":%s", constants.APIServerPort)); err != nil && err != http.ErrServerClosed {
-			logging.LogFatal(logger, "API server failed", "error", err)
+	apiServer := api.NewServer(apiToken, logBroker, eventBroker, logLevel)
+	apiServer.EnableApprovals(os.Getenv(constants.EnvVarApproveToken))
+	if haloydConfig != nil {
+		apiServer.SetDeployConfig(haloydConfig.Deploy)
+		apiServer.SetProxyBackend(haloydConfig.Proxy.Backend)
+		apiServer.SetRateLimit(haloydConfig.API.RateLimit)
+		apiServer.SetAccess(haloydConfig.API)
+	}
+	if haloydConfig != nil && haloydConfig.API.Dashboard {
+		if err := apiServer.EnableDashboard(); err != nil {
+			logging.LogFatal(logger, "Failed to enable dashboard", "error", err)
 		}
-	}()
+		logger.Info("Dashboard enabled on /dashboard/")
+	}
+	if haloydConfig != nil && haloydConfig.API.Registry {
+		if err := apiServer.EnableRegistry(filepath.Join(dataDir, constants.RegistryDir)); err != nil {
+			logging.LogFatal(logger, "Failed to enable registry", "error", err)
+		}
+		docker.SetLocalRegistry(haloydConfig.API.Domain, apiToken)
+		logger.Info("Registry enabled", "domain", haloydConfig.API.Domain)
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -115,24 +180,95 @@ func Run(debug bool) {
 	certUpdateSignal := make(chan string, 5)
 
 	deploymentManager := NewDeploymentManager(cli, haloydConfig)
+	certDir := filepath.Join(dataDir, constants.CertStorageDir)
+	certStore, err := newCertStore(haloydConfig, db, certDir)
+	if err != nil {
+		logging.LogFatal(logger, "Failed to set up certificate store", "error", err)
+	}
+	apiServer.SetCertStore(certStore)
 	certManagerConfig := CertificatesManagerConfig{
-		CertDir:          filepath.Join(dataDir, constants.CertStorageDir),
+		CertDir:          certDir,
+		Store:            certStore,
 		HTTPProviderPort: constants.CertificatesHTTPProviderPort,
-		TlsStaging:       debug,
+		StagingPrecheck:  haloydConfig != nil && haloydConfig.Certificates.StagingPrecheck,
+		Events:           eventBroker,
+	}
+	if haloydConfig != nil {
+		certManagerConfig.RenewalWindow = haloydConfig.Certificates.RenewalWindow
+		certManagerConfig.DNSProvider = haloydConfig.Certificates.DNSProvider
+		certManagerConfig.ExpiryAlert = haloydConfig.Certificates.ExpiryAlert
+		certManagerConfig.DualCertificates = haloydConfig.Certificates.DualCertificates
 	}
 	certManager, err := NewCertificatesManager(certManagerConfig, certUpdateSignal)
 	if err != nil {
 		logging.LogFatal(logger, "Failed to create certificate manager", "error", err)
 	}
-	haproxyManager := NewHAProxyManager(cli, haloydConfig, filepath.Join(dataDir, constants.HAProxyConfigDir), debug)
+	proxy := NewProxyBackend(cli, haloydConfig, dataDir, debug, eventBroker)
+	// Backend metrics, the stats page and autoscaling are only available with HAProxy.
+	haproxyManager, _ := proxy.(*HAProxyManager)
+	// Notifications can be enabled by a config reload, so the notifier always runs.
+	var notificationsConfig config.NotificationsConfig
+	if haloydConfig != nil {
+		notificationsConfig = haloydConfig.Notifications
+	}
+	notifier := NewNotifier(notificationsConfig, deploymentManager.AppForDomain)
+	go notifier.Run(ctx, eventBroker, logger)
+	var eventPublishersConfig []config.EventPublisher
+	if haloydConfig != nil {
+		eventPublishersConfig = haloydConfig.EventPublishers
+	}
+	eventPublishers := NewEventPublishers(eventPublishersConfig, deploymentManager.AppForDomain, logger)
+	go eventPublishers.Run(ctx, eventBroker)
+
+	var externalLB *ExternalLB
+	if haloydConfig != nil {
+		externalLB, err = NewExternalLB(haloydConfig.ExternalLB, eventBroker)
+		if err != nil {
+			logging.LogFatal(logger, "Failed to set up external load balancer", "error", err)
+		}
+	}
 	updaterConfig := UpdaterConfig{
 		Cli:               cli,
 		DeploymentManager: deploymentManager,
 		CertManager:       certManager,
-		HAProxyManager:    haproxyManager,
+		Proxy:             proxy,
+		ExternalLB:        externalLB,
+		Events:            eventBroker,
+	}
+
+	apiServer.SetHAProxyPreview(func(labels *config.ContainerLabels, replicas int) (string, string, error) {
+		return proxy.PreviewConfig(deploymentManager.Deployments(), labels, replicas)
+	})
+	if haproxyManager != nil {
+		apiServer.SetHAProxyStats(haproxyManager.BackendStats)
+	}
+	apiServer.SetSystemDomains(certManager.SystemDomainStatuses)
+	dockerStatus := NewDockerStatus()
+	apiServer.SetDockerStatus(dockerStatus.Status)
+	if haproxyManager != nil && haloydConfig != nil && haloydConfig.Proxy.Stats {
+		statsPassword, err := generateStatsPassword()
+		if err != nil {
+			logging.LogFatal(logger, "Failed to enable HAProxy stats page", "error", err)
+		}
+		haproxyManager.EnableStatsPage(statsPassword)
+		apiServer.EnableHAProxyStatsPage(statsPassword)
+		logger.Info("HAProxy stats page enabled on /v1/haproxy/stats")
 	}
 
 	updater := NewUpdater(updaterConfig)
+	apiServer.SetRoutingUpdate(func(ctx context.Context) error {
+		return updater.Update(ctx, logger, TriggerRoutingChanged, nil)
+	})
+
+	// The API is started once the readiness checks are added, deployments wait for /readyz.
+	apiServer.AddReadinessCheck("storage", db.PingContext)
+	apiServer.AddReadinessCheck(proxy.Name(), updater.ProxyConfigApplied)
+	go func() {
+		logger.Info(fmt.Sprintf("Starting API server on :%s...", constants.APIServerPort))
+		if err := apiServer.ListenAndServe(fmt.Sprintf(":%s", constants.APIServerPort)); err != nil && err != http.ErrServerClosed {
+			logging.LogFatal(logger, "API server failed", "error", err)
+		}
+	}()
 	if err := updater.Update(ctx, logger, TriggerReasonInitial, nil); err != nil {
 		logger.Error("Initial update failed", "error", err)
 	}
@@ -144,7 +280,8 @@ func Run(debug bool) {
 	// Docker event listener
 	eventsChan := make(chan ContainerEvent)
 	errorsChan := make(chan error)
-	go listenForDockerEvents(ctx, cli, eventsChan, errorsChan, logger)
+	dockerReconnected := make(chan struct{})
+	go listenForDockerEvents(ctx, cli, deploymentManager, dockerStatus, eventsChan, errorsChan, dockerReconnected, logger)
 
 	debouncedEventsChan := make(chan debouncedAppEvent)
 	defer close(debouncedEventsChan)
@@ -152,9 +289,42 @@ func Run(debug bool) {
 	appDebouncer := newAppDebouncer(eventDebounceDelay, debouncedEventsChan, logger)
 	defer appDebouncer.stop()
 
+	// Apps deploying at the same time are handled in a single update.
+	coalescer := newUpdateCoalescer(updateCoalesceWindow, func(batch []debouncedAppEvent) {
+		handleAppEvents(ctx, batch, updater, eventBroker, logLevel, logBroker, logger)
+	})
+
+	// Deployments interrupted by the last shutdown are resumed or rolled back.
+	recoverDeployments(ctx, cli, coalescer, eventBroker, logLevel, logBroker, logger)
+
 	maintenanceTicker := time.NewTicker(maintenanceInterval)
 	defer maintenanceTicker.Stop()
 
+	reconciler := NewReconciler(cli, proxy, eventBroker)
+	reconcileTicker := time.NewTicker(reconcileInterval)
+	defer reconcileTicker.Stop()
+
+	var autoscaler *Autoscaler
+	if haproxyManager != nil {
+		autoscaler = NewAutoscaler(cli, haproxyManager, eventBroker)
+	}
+	autoscaleTicker := time.NewTicker(autoscaleInterval)
+	defer autoscaleTicker.Stop()
+
+	imageWatcher := NewImageWatcher(cli, apiServer.DeployImageUpdate, eventBroker)
+	imageWatchTicker := time.NewTicker(imageWatchInterval)
+	defer imageWatchTicker.Stop()
+
+	renewalTicker := time.NewTicker(renewalCheckInterval)
+	defer renewalTicker.Stop()
+
+	// Changes to the config file are applied without restarting haloyd. Reloads are disabled if the
+	// directory can't be watched, the config is then only read at startup.
+	configReloads, err := watchHaloydConfig(ctx, configFilePath, logger)
+	if err != nil {
+		logger.Warn("Config reload disabled", "error", err)
+	}
+
 	// Main event loop
 	for {
 		select {
@@ -165,72 +335,7 @@ func Run(debug bool) {
 
 		// Debounced docker events
 		case de := <-debouncedEventsChan:
-			go func() {
-				deploymentLogger := logging.NewDeploymentLogger(de.DeploymentID, logLevel, logBroker)
-
-				// we also support apps that has no domains configured.
-				if de.CapturedStartEvent && (len(de.Domains) == 0 || !de.IsOnNetwork) {
-					var message string
-					var reasons []string
-
-					// Determine the specific reasons for skipping full deployment processing
-					if len(de.Domains) == 0 {
-						reasons = append(reasons, "no domains configured")
-					}
-
-					if !de.IsOnNetwork {
-						reasons = append(reasons, fmt.Sprintf("not on the %s network", constants.DockerNetwork))
-					}
-
-					// Create an appropriate message based on the reasons
-					switch len(reasons) {
-					case 1:
-						message = fmt.Sprintf("Container %s started successfully (%s). Skipped health checks, HAProxy updates, and domain handling.",
-							de.AppName, reasons[0])
-					case 2:
-						message = fmt.Sprintf("Container %s started successfully (%s and %s). Skipped health checks, HAProxy updates, and domain handling.",
-							de.AppName, reasons[0], reasons[1])
-					default:
-						message = fmt.Sprintf("Container %s started successfully. Skipped health checks, HAProxy updates, and domain handling.",
-							de.AppName)
-					}
-
-					logging.LogDeploymentComplete(deploymentLogger, []string{}, de.DeploymentID, de.AppName, message)
-
-					return
-				}
-
-				updateCtx, cancelUpdate := context.WithTimeout(ctx, updateTimeout)
-				defer cancelUpdate()
-
-				app := &TriggeredByApp{
-					appName:           de.AppName,
-					domains:           de.Domains,
-					deploymentID:      de.DeploymentID,
-					dockerEventAction: de.EventAction,
-				}
-
-				if err := app.Validate(); err != nil {
-					deploymentLogger.Error("App data not valid", "error", err)
-					return
-				}
-
-				if err := updater.Update(updateCtx, deploymentLogger, TriggerReasonAppUpdated, app); err != nil {
-					logging.LogDeploymentFailed(deploymentLogger, de.DeploymentID, de.AppName,
-						"Deployment failed", err)
-					return
-				}
-
-				// Start event indicates that this is a new deployment and we'll signal the logger that the deployment is done.
-				if de.CapturedStartEvent {
-					canonicalDomains := make([]string, len(de.Domains))
-					for i, domain := range de.Domains {
-						canonicalDomains[i] = domain.Canonical
-					}
-					logging.LogDeploymentComplete(deploymentLogger, canonicalDomains, de.DeploymentID, de.AppName,
-						fmt.Sprintf("Successfully deployed %s", de.AppName))
-				}
-			}()
+			coalescer.add(de)
 
 		case domainUpdated := <-certUpdateSignal:
 			logger.Info("Received cert update signal", "domain", domainUpdated)
@@ -243,8 +348,8 @@ func Run(debug bool) {
 				// Update only needs to apply config, not full build/check
 				// We assume the deployment state triggering the cert update is still valid.
 				currentDeployments := updater.deploymentManager.Deployments()
-				if err := updater.haproxyManager.ApplyConfig(updateCtx, logger, currentDeployments); err != nil {
-					logger.Error("Background HAProxy update failed",
+				if err := updater.proxy.Apply(updateCtx, logger, currentDeployments, true); err != nil {
+					logger.Error("Background proxy update failed",
 						"reason", "cert update",
 						"domain", domainUpdated,
 						"error", err)
@@ -252,10 +357,20 @@ func Run(debug bool) {
 			}()
 
 		case <-maintenanceTicker.C:
+			if !dockerStatus.Connected() {
+				logger.Warn("Skipping periodic maintenance while the Docker daemon is unavailable")
+				continue
+			}
 			logger.Info("Performing periodic maintenance...")
-			_, err := docker.PruneImages(ctx, cli, logger)
+			pruneDeploymentLogs(db, haloydConfig, logger)
+			reclaimed, err := docker.PruneImages(ctx, cli, logger)
 			if err != nil {
 				logger.Warn("Failed to prune images", "error", err)
+			} else {
+				eventBroker.Publish(haloyevents.Event{
+					Type: haloyevents.TypeGCRun,
+					Data: map[string]any{"bytesReclaimed": reclaimed},
+				})
 			}
 			go func() {
 				deploymentCtx, cancelDeployment := context.WithCancel(ctx)
@@ -266,11 +381,105 @@ func Run(debug bool) {
 				}
 			}()
 
+		case <-reconcileTicker.C:
+			if dockerStatus.Connected() {
+				go reconciler.Reconcile(ctx, logger)
+			}
+
+		case <-autoscaleTicker.C:
+			if autoscaler != nil && dockerStatus.Connected() {
+				go autoscaler.Autoscale(ctx, logger)
+			}
+
+		case <-imageWatchTicker.C:
+			if dockerStatus.Connected() {
+				go imageWatcher.Watch(ctx, logger)
+			}
+
+		case <-renewalTicker.C:
+			go certManager.RenewDeferred(logger)
+
+		case reload := <-configReloads:
+			if reload.err != nil {
+				logger.Error("Rejected haloyd config, keeping the current config", "error", reload.err)
+				eventBroker.Publish(haloyevents.Event{
+					Type: haloyevents.TypeConfigRejected,
+					Data: map[string]any{"error": reload.err.Error()},
+				})
+				continue
+			}
+
+			applied, changed, restartRequired := applyReloadedConfig(haloydConfig, reload.config)
+			if len(changed) == 0 && len(restartRequired) == 0 {
+				continue
+			}
+			haloydConfig = applied
+			deploymentManager.SetHaloydConfig(applied)
+			proxy.SetHaloydConfig(applied)
+			certManager.SetStagingPrecheck(applied.Certificates.StagingPrecheck)
+			certManager.SetRenewalWindow(applied.Certificates.RenewalWindow)
+			certManager.SetDNSProvider(applied.Certificates.DNSProvider)
+			certManager.SetExpiryAlert(applied.Certificates.ExpiryAlert)
+			certManager.SetDualCertificates(applied.Certificates.DualCertificates)
+			apiServer.SetDeployConfig(applied.Deploy)
+			apiServer.SetRateLimit(applied.API.RateLimit)
+			apiServer.SetAccess(applied.API)
+			notifier.SetConfig(applied.Notifications)
+			if slices.Contains(changed, "event_publishers") {
+				eventPublishers.SetConfig(applied.EventPublishers)
+			}
+			if applied.API.Registry {
+				docker.SetLocalRegistry(applied.API.Domain, apiToken)
+			}
+
+			logger.Info("Reloaded haloyd config", "changed", strings.Join(changed, ", "))
+			if len(restartRequired) > 0 {
+				logger.Warn("Some config changes need a restart with 'haloyadm restart'", "settings", strings.Join(restartRequired, ", "))
+			}
+			eventBroker.Publish(haloyevents.Event{
+				Type: haloyevents.TypeConfigReloaded,
+				Data: map[string]any{"changed": changed, "restartRequired": restartRequired},
+			})
+
+			if len(changed) > 0 {
+				go func() {
+					updateCtx, cancelUpdate := context.WithTimeout(ctx, updateTimeout)
+					defer cancelUpdate()
+
+					if err := updater.Update(updateCtx, logger, TriggerConfigReloaded, nil); err != nil {
+						logger.Error("Update after config reload failed", "error", err)
+					}
+				}()
+			}
+
 		case err := <-errorsChan:
-			logger.Error("Error from docker events", "error", err)
+			logger.Warn("Lost connection to the Docker daemon, reconnecting", "error", err)
+			eventBroker.Publish(haloyevents.Event{
+				Type: haloyevents.TypeDockerDisconnected,
+				Data: map[string]any{"error": err.Error()},
+			})
+
+		case <-dockerReconnected:
+			logger.Info("Reconnected to the Docker daemon, resyncing deployments")
+			eventBroker.Publish(haloyevents.Event{Type: haloyevents.TypeDockerReconnected})
+			go func() {
+				updateCtx, cancelUpdate := context.WithTimeout(ctx, updateTimeout)
+				defer cancelUpdate()
+
+				if err := updater.Update(updateCtx, logger, TriggerDockerReconnected, nil); err != nil {
+					logger.Error("Resync after Docker reconnect failed", "error", err)
+					return
+				}
+				reconciler.Reconcile(ctx, logger)
+			}()
 
 		case <-sigChan:
 			logger.Info("Received shutdown signal, stopping haloyd...")
+			drainCtx, cancelDrain := context.WithTimeout(context.Background(), shutdownTimeout)
+			if err := apiServer.Drain(drainCtx); err != nil {
+				logger.Warn("Deployments still running at shutdown, they will be recovered on the next start", "error", err)
+			}
+			cancelDrain()
 			if certManager != nil {
 				certManager.Stop()
 			}
@@ -280,10 +489,193 @@ func Run(debug bool) {
 	}
 }
 
-// listenForDockerEvents sets up a listener for Docker events
-func listenForDockerEvents(ctx context.Context, cli *client.Client, eventsChan chan ContainerEvent, errorsChan chan error, logger *slog.Logger) {
+// handleAppEvents runs a single update for a batch of debounced app events and reports the result to each deployment.
+func handleAppEvents(
+	ctx context.Context,
+	batch []debouncedAppEvent,
+	updater *Updater,
+	eventBroker *haloyevents.Broker,
+	logLevel slog.Level,
+	logBroker logging.StreamPublisher,
+	logger *slog.Logger,
+) {
+	var apps []*TriggeredByApp
+	var appEvents []debouncedAppEvent
+
+	for _, de := range latestAppEvents(batch, eventBroker, logLevel, logBroker) {
+		deploymentLogger := logging.NewDeploymentLogger(de.DeploymentID, logLevel, logBroker)
+
+		// we also support apps that has no domains configured.
+		if de.CapturedStartEvent && (len(de.Domains) == 0 || !de.IsOnNetwork) {
+			var message string
+			var reasons []string
+
+			// Determine the specific reasons for skipping full deployment processing
+			if len(de.Domains) == 0 {
+				reasons = append(reasons, "no domains configured")
+			}
+
+			if !de.IsOnNetwork {
+				reasons = append(reasons, fmt.Sprintf("not on the %s network", constants.DockerNetwork))
+			}
+
+			// Create an appropriate message based on the reasons
+			switch len(reasons) {
+			case 1:
+				message = fmt.Sprintf("Container %s started successfully (%s). Skipped health checks, HAProxy updates, and domain handling.",
+					de.AppName, reasons[0])
+			case 2:
+				message = fmt.Sprintf("Container %s started successfully (%s and %s). Skipped health checks, HAProxy updates, and domain handling.",
+					de.AppName, reasons[0], reasons[1])
+			default:
+				message = fmt.Sprintf("Container %s started successfully. Skipped health checks, HAProxy updates, and domain handling.",
+					de.AppName)
+			}
+
+			logging.LogDeploymentComplete(deploymentLogger, []string{}, de.DeploymentID, de.AppName, message)
+			tracing.EndDeployment(de.DeploymentID, nil)
+			deploy.CompleteCheckpoint(de.DeploymentID, de.AppName, deploymentLogger)
+			eventBroker.Publish(haloyevents.Event{
+				Type:         haloyevents.TypeDeploymentFinished,
+				AppName:      de.AppName,
+				DeploymentID: de.DeploymentID,
+			})
+			continue
+		}
+
+		app := &TriggeredByApp{
+			appName:           de.AppName,
+			domains:           de.Domains,
+			deploymentID:      de.DeploymentID,
+			dockerEventAction: de.EventAction,
+			logger:            deploymentLogger,
+		}
+
+		if err := app.Validate(); err != nil {
+			deploymentLogger.Error("App data not valid", "error", err)
+			tracing.EndDeployment(de.DeploymentID, err)
+			deploy.ClearCheckpoint(de.DeploymentID, deploymentLogger)
+			continue
+		}
+
+		apps = append(apps, app)
+		appEvents = append(appEvents, de)
+	}
+
+	if len(apps) == 0 {
+		return
+	}
+
+	// A single app keeps streaming all update logs to its client. Shared passes log to haloyd
+	// and only send the steps and results to each deployment.
+	updateLogger := logger
+	updateCtx := ctx
+	if len(apps) == 1 {
+		updateLogger = apps[0].logger
+		updateCtx = tracing.WithDeployment(ctx, apps[0].deploymentID)
+	} else {
+		appNames := make([]string, len(apps))
+		for i, app := range apps {
+			appNames[i] = app.appName
+		}
+		logger.Info("Updating apps in a single pass", "apps", strings.Join(appNames, ", "))
+	}
+
+	updateCtx, cancelUpdate := context.WithTimeout(updateCtx, updateTimeout)
+	defer cancelUpdate()
+
+	err := updater.Update(updateCtx, updateLogger, TriggerReasonAppUpdated, apps)
+
+	for i, app := range apps {
+		de := appEvents[i]
+		if err != nil {
+			logging.LogDeploymentFailed(app.logger, de.DeploymentID, de.AppName,
+				"Deployment failed", err)
+			tracing.EndDeployment(de.DeploymentID, err)
+			deploy.ClearCheckpoint(de.DeploymentID, app.logger)
+			eventBroker.Publish(haloyevents.Event{
+				Type:         haloyevents.TypeDeploymentFailed,
+				AppName:      de.AppName,
+				DeploymentID: de.DeploymentID,
+				Data:         map[string]any{"error": err.Error()},
+			})
+			continue
+		}
+
+		// Start event indicates that this is a new deployment and we'll signal the logger that the deployment is done.
+		if de.CapturedStartEvent {
+			canonicalDomains := make([]string, len(de.Domains))
+			for i, domain := range de.Domains {
+				canonicalDomains[i] = domain.Canonical
+				if domain.TLSDisabled() {
+					canonicalDomains[i] = "http://" + domain.Canonical
+				}
+			}
+			logging.LogDeploymentComplete(app.logger, canonicalDomains, de.DeploymentID, de.AppName,
+				fmt.Sprintf("Successfully deployed %s", de.AppName))
+			tracing.EndDeployment(de.DeploymentID, nil)
+			deploy.CompleteCheckpoint(de.DeploymentID, de.AppName, app.logger)
+			eventBroker.Publish(haloyevents.Event{
+				Type:         haloyevents.TypeDeploymentFinished,
+				AppName:      de.AppName,
+				DeploymentID: de.DeploymentID,
+				Data:         map[string]any{"domains": canonicalDomains},
+			})
+		}
+	}
+}
+
+// latestAppEvents keeps the newest event per app, sorted by app name. Deployments replaced by a
+// newer deployment of the same app in the batch are reported as failed.
+func latestAppEvents(batch []debouncedAppEvent, eventBroker *haloyevents.Broker, logLevel slog.Level, logBroker logging.StreamPublisher) []debouncedAppEvent {
+	latest := make(map[string]debouncedAppEvent)
+	for _, de := range batch {
+		current, exists := latest[de.AppName]
+		switch {
+		case !exists:
+			latest[de.AppName] = de
+		case current.DeploymentID == de.DeploymentID:
+			de.CapturedStartEvent = de.CapturedStartEvent || current.CapturedStartEvent
+			latest[de.AppName] = de
+		default:
+			superseded := de
+			if helpers.CompareDeploymentIDs(de.DeploymentID, current.DeploymentID) > 0 {
+				superseded = current
+				latest[de.AppName] = de
+			}
+			if superseded.CapturedStartEvent {
+				err := fmt.Errorf("replaced by a newer deployment of %s", superseded.AppName)
+				deploymentLogger := logging.NewDeploymentLogger(superseded.DeploymentID, logLevel, logBroker)
+				logging.LogDeploymentFailed(deploymentLogger, superseded.DeploymentID, superseded.AppName, "Deployment superseded", err)
+				tracing.EndDeployment(superseded.DeploymentID, err)
+				deploy.ClearCheckpoint(superseded.DeploymentID, deploymentLogger)
+				eventBroker.Publish(haloyevents.Event{
+					Type:         haloyevents.TypeDeploymentFailed,
+					AppName:      superseded.AppName,
+					DeploymentID: superseded.DeploymentID,
+					Data:         map[string]any{"error": err.Error()},
+				})
+			}
+		}
+	}
+
+	appNames := slices.Sorted(maps.Keys(latest))
+	events := make([]debouncedAppEvent, len(appNames))
+	for i, appName := range appNames {
+		events[i] = latest[appName]
+	}
+	return events
+}
+
+// listenForDockerEvents sets up a listener for Docker events. Every container and network event
+// invalidates the cached inspect result of the container in the deployment manager.
+// When the event stream fails, e.g. because the Docker daemon restarts, the error is sent on errorsChan
+// and the daemon is polled with backoff. Once it answers again the listener resubscribes and signals
+// reconnectedChan so the deployments can be resynced.
+func listenForDockerEvents(ctx context.Context, cli *client.Client, deploymentManager *DeploymentManager, dockerStatus *DockerStatus, eventsChan chan ContainerEvent, errorsChan chan error, reconnectedChan chan struct{}, logger *slog.Logger) {
 	filterArgs := filters.NewArgs()
 	filterArgs.Add("type", "container")
+	filterArgs.Add("type", "network")
 
 	// Define allowed actions for event processing
 	allowedActions := map[string]struct{}{
@@ -298,13 +690,51 @@ func listenForDockerEvents(ctx context.Context, cli *client.Client, eventsChan c
 		Filters: filterArgs,
 	}
 
+	for {
+		err := streamDockerEvents(ctx, cli, deploymentManager, eventOptions, allowedActions, eventsChan, logger)
+		if ctx.Err() != nil {
+			return
+		}
+
+		dockerStatus.setDisconnected(err)
+		// Events may have been missed while disconnected.
+		deploymentManager.InvalidateContainers()
+		select {
+		case errorsChan <- err:
+		case <-ctx.Done():
+			return
+		}
+
+		if !waitForDocker(ctx, cli, logger) {
+			return
+		}
+		dockerStatus.setConnected()
+		select {
+		case reconnectedChan <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// streamDockerEvents forwards Docker events until the event stream fails and returns the error.
+func streamDockerEvents(ctx context.Context, cli *client.Client, deploymentManager *DeploymentManager, eventOptions events.ListOptions, allowedActions map[string]struct{}, eventsChan chan ContainerEvent, logger *slog.Logger) error {
 	events, errs := cli.Events(ctx, eventOptions)
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		case event := <-events:
+			// Network connects and disconnects change the container IP.
+			if event.Type == "network" {
+				if containerID := event.Actor.Attributes["container"]; containerID != "" {
+					deploymentManager.InvalidateContainer(containerID)
+				}
+				continue
+			}
+			deploymentManager.InvalidateContainer(event.Actor.ID)
+
 			if _, ok := allowedActions[string(event.Action)]; ok {
 				container, err := cli.ContainerInspect(ctx, event.Actor.ID)
 				if err != nil {
@@ -333,24 +763,98 @@ func listenForDockerEvents(ctx context.Context, cli *client.Client, eventsChan c
 						Container: container,
 						Labels:    labels,
 					}
-					eventsChan <- containerEvent
+					select {
+					case eventsChan <- containerEvent:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
 				} else {
 					logger.Debug("Container not eligible for haloy management",
 						"containerID", helpers.SafeIDPrefix(event.Actor.ID))
 				}
 			}
 		case err := <-errs:
-			if err != nil {
-				errorsChan <- err
-				// For non-fatal errors we'll try to reconnect instead of exiting
-				if err != io.EOF && !strings.Contains(err.Error(), "connection refused") {
-					// Attempt to reconnect
-					time.Sleep(5 * time.Second)
-					events, errs = cli.Events(ctx, eventOptions)
-					continue
-				}
+			if err == nil {
+				err = io.EOF
 			}
-			return
+			return err
 		}
 	}
 }
+
+// configureLogging applies the logging section of the haloyd config and returns the log level.
+// The returned closer is set when logs are also written to a file.
+func configureLogging(haloydConfig *config.HaloydConfig, dataDir string, debug bool) (slog.Level, io.Closer, error) {
+	var logConfig config.HaloydLogging
+	if haloydConfig != nil {
+		logConfig = haloydConfig.Normalize().Logging
+	}
+	if err := logConfig.Validate(); err != nil {
+		return slog.LevelInfo, nil, err
+	}
+
+	level := logConfig.SlogLevel()
+	if debug {
+		level = slog.LevelDebug
+	}
+
+	var w io.Writer = os.Stdout
+	var closer io.Closer
+	if logConfig.File {
+		logFile, err := logging.NewRotatingFile(filepath.Join(dataDir, constants.LogsDir, constants.HaloydLogFileName), logConfig.MaxSize, logConfig.MaxAge)
+		if err != nil {
+			return level, nil, err
+		}
+		w = io.MultiWriter(os.Stdout, logFile)
+		closer = logFile
+	}
+
+	logging.SetOutput(w, logConfig.Format == config.HaloydLogFormatJSON)
+	return level, closer, nil
+}
+
+// migrateDatabase applies pending schema migrations, after backing up databases that already have a schema.
+// With database.manual_migrations set it only checks that the schema is current.
+// pruneDeploymentLogs deletes the deployment logs older than logging.deployment_logs_max_age.
+func pruneDeploymentLogs(db *storage.DB, haloydConfig *config.HaloydConfig, logger *slog.Logger) {
+	var loggingConfig config.HaloydLogging
+	if haloydConfig != nil {
+		loggingConfig = haloydConfig.Logging
+	}
+	deleted, err := db.PruneDeploymentLogs(time.Now().Add(-loggingConfig.DeploymentLogsRetention()))
+	if err != nil {
+		logger.Warn("Failed to prune deployment logs", "error", err)
+		return
+	}
+	if deleted > 0 {
+		logger.Debug("Pruned deployment logs", "entries", deleted)
+	}
+}
+
+func migrateDatabase(db *storage.DB, haloydConfig *config.HaloydConfig, logger *slog.Logger) error {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest := storage.LatestSchemaVersion()
+	if current >= latest {
+		return db.Migrate()
+	}
+
+	if haloydConfig != nil && haloydConfig.Database.ManualMigrations {
+		return fmt.Errorf("database schema is at version %d, version %d is required: run 'haloyadm db migrate'", current, latest)
+	}
+
+	if current > 0 {
+		backupPath, err := db.BackupBeforeMigrate()
+		if err != nil {
+			return err
+		}
+		logger.Info("Backed up database before migration", "path", backupPath)
+	}
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+	logger.Info("Migrated database schema", "from", current, "to", latest)
+	return nil
+}
@@ -3,21 +3,25 @@ package haloyd
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
-	"time"
 
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/constants"
 	"github.com/ameistad/haloy/internal/embed"
+	"github.com/ameistad/haloy/internal/events"
 	"github.com/ameistad/haloy/internal/helpers"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 )
 
@@ -25,22 +29,70 @@ type HAProxyManager struct {
 	cli          *client.Client
 	haloydConfig *config.HaloydConfig
 	configDir    string
+	dataDir      string
 	debug        bool
+	events       *events.Broker
 	updateMutex  sync.Mutex // Mutex protects config writing and reload signaling
+
+	// The last applied config and its backend sections, used to skip writes and reloads when nothing changed.
+	lastConfig   []byte
+	lastBackends map[string]string
+	// The last applied domain maps, nil with ACL routing. Changes are applied without a reload when possible.
+	lastMaps haproxyMaps
+	// Deployment ID per app in the last applied config.
+	lastDeployments map[string]string
+	// Password of the stats page, empty when it's disabled. See EnableStatsPage.
+	statsPassword string
+	container     proxyContainer
 }
 
-func NewHAProxyManager(cli *client.Client, haloydConfig *config.HaloydConfig, configDir string, debug bool) *HAProxyManager {
-	return &HAProxyManager{
+func NewHAProxyManager(cli *client.Client, haloydConfig *config.HaloydConfig, dataDir string, debug bool, eventBroker *events.Broker) *HAProxyManager {
+	hpm := &HAProxyManager{
 		cli:          cli,
 		haloydConfig: haloydConfig,
-		configDir:    configDir,
+		configDir:    filepath.Join(dataDir, constants.HAProxyConfigDir),
+		dataDir:      dataDir,
 		debug:        debug,
+		events:       eventBroker,
+	}
+	hpm.container = proxyContainer{
+		cli:           cli,
+		name:          constants.HAProxyContainerName,
+		role:          config.HAProxyLabelRole,
+		defaultConfig: hpm.defaultContainerConfig,
 	}
+	return hpm
+}
+
+func (hpm *HAProxyManager) Name() string {
+	return config.ProxyBackendHAProxy
+}
+
+// ManagesCertificates is false, HAProxy serves the certificates obtained by haloyd.
+func (hpm *HAProxyManager) ManagesCertificates() bool {
+	return false
+}
+
+// EnableStatsPage serves the HAProxy stats page on the haloy network, protected by the given password.
+// It's only read by haloyd, which proxies it on the API.
+func (hpm *HAProxyManager) EnableStatsPage(password string) {
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+	hpm.statsPassword = password
+}
+
+// SetHaloydConfig replaces the haloyd config used to generate the HAProxy config. It's applied on the next update.
+func (hpm *HAProxyManager) SetHaloydConfig(haloydConfig *config.HaloydConfig) {
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+	hpm.haloydConfig = haloydConfig
 }
 
-// ApplyConfig generates, writes (if not debug), and reloads HAProxy config.
+// Apply generates, writes (if not debug), and reloads HAProxy config. Writing and reloading
+// is skipped when the generated config is the same as the last applied one, unless forceReload is set,
+// since HAProxy only reads changed certificate files on reload.
 // This method is concurrency-safe due to the internal mutex.
-func (hpm *HAProxyManager) ApplyConfig(ctx context.Context, logger *slog.Logger, deployments map[string]Deployment) error {
+func (hpm *HAProxyManager) Apply(ctx context.Context, logger *slog.Logger, deployments map[string]Deployment, forceReload bool) error {
 	logger.Debug("HAProxyManager: Attempting to apply new configuration...")
 
 	hpm.updateMutex.Lock()
@@ -48,189 +100,719 @@ func (hpm *HAProxyManager) ApplyConfig(ctx context.Context, logger *slog.Logger,
 
 	// Generate Config (with certificate check)
 	logger.Debug("HAProxyManager: Generating new configuration...")
-	configBuf, err := hpm.generateConfig(deployments)
+	configBuf, domainMaps, err := hpm.generateConfig(deployments)
 	if err != nil {
 		return fmt.Errorf("HAProxyManager: failed to generate config: %w", err)
 	}
+	var proxyConfig config.ProxyConfig
+	if hpm.haloydConfig != nil {
+		proxyConfig = hpm.haloydConfig.Proxy
+	}
+	for appName, d := range deployments {
+		if _, ok := proxyConfig.Frontend(d.Labels.Frontend); d.Labels.Frontend != "" && !ok {
+			logger.Warn("HAProxyManager: app uses an undefined proxy frontend and is not routed", "app", appName, "frontend", d.Labels.Frontend)
+		}
+	}
+
+	configChanged := !bytes.Equal(configBuf.Bytes(), hpm.lastConfig)
+	mapsChanged := !domainMaps.equal(hpm.lastMaps)
+	if !configChanged && !mapsChanged && !forceReload {
+		logger.Debug("HAProxyManager: Configuration unchanged, skipping write and reload.")
+		return nil
+	}
+
+	backends := backendSections(configBuf.String())
+	if configChanged && hpm.lastConfig != nil {
+		if changed := changedBackends(hpm.lastBackends, backends); len(changed) > 0 {
+			logger.Info("HAProxy configuration changed", "backends", strings.Join(changed, ", "))
+		}
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			logger.Debug("HAProxyManager: Configuration diff\n" + helpers.UnifiedDiff("haproxy.cfg", "haproxy.cfg", string(hpm.lastConfig), configBuf.String()))
+		}
+	}
 
 	if hpm.debug {
 		logger.Debug("HAProxyManager: Skipping config write and reload.")
 		logger.Debug(configBuf.String())
+		hpm.lastConfig, hpm.lastBackends, hpm.lastDeployments = configBuf.Bytes(), backends, deploymentIDs(deployments)
+		hpm.lastMaps = domainMaps
 		return nil
 	}
 
+	// The maps are written before the config, a reload must find the maps the config references.
+	if domainMaps != nil && (mapsChanged || configChanged) {
+		logger.Debug("HAProxyManager: Writing domain maps")
+		if err := hpm.writeMaps(domainMaps); err != nil {
+			return err
+		}
+	}
+
+	// When only domains changed, the running HAProxy is updated through the runtime API instead of reloading it.
+	if !configChanged && !forceReload && hpm.lastMaps != nil {
+		updates, err := hpm.updateMapsAtRuntime(ctx, hpm.lastMaps, domainMaps)
+		if err == nil {
+			logger.Info("HAProxy domain maps updated without reload", "updates", updates)
+			hpm.lastMaps, hpm.lastDeployments = domainMaps, deploymentIDs(deployments)
+			hpm.events.Publish(events.Event{
+				Type: events.TypeHAProxyMapsUpdated,
+				Data: map[string]any{"deployments": len(deployments), "updates": updates},
+			})
+			return nil
+		}
+		logger.Warn("HAProxyManager: Failed to update domain maps at runtime, reloading instead", "error", err)
+	}
+
+	if configChanged {
+		if err := hpm.writeMirrorScript(); err != nil {
+			return err
+		}
+		configPath := filepath.Join(hpm.configDir, constants.HAProxyConfigFileName)
+		logger.Debug("HAProxyManager: Writing config")
+		if err := os.WriteFile(configPath, configBuf.Bytes(), constants.ModeFileDefault); err != nil {
+			return fmt.Errorf("HAProxyManager: failed to write config file %s: %w", configPath, err)
+		}
+	}
+
+	reloaded, err := hpm.reload(ctx, logger)
+	if err != nil {
+		return err
+	}
+	if !reloaded {
+		return nil // Not necessarily an error if HAProxy isn't running
+	}
+
+	// Only cache the config once HAProxy has been told to load it, so failed reloads are retried.
+	hpm.lastConfig, hpm.lastBackends, hpm.lastDeployments = configBuf.Bytes(), backends, deploymentIDs(deployments)
+	hpm.lastMaps = domainMaps
+
+	hpm.events.Publish(events.Event{
+		Type: events.TypeHAProxyReloaded,
+		Data: map[string]any{"deployments": len(deployments)},
+	})
+
+	return nil
+}
+
+// AppliedDeploymentID returns the deployment of an app that HAProxy was last configured to route to.
+func (hpm *HAProxyManager) AppliedDeploymentID(appName string) (string, bool) {
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+	deploymentID, ok := hpm.lastDeployments[appName]
+	return deploymentID, ok
+}
+
+// PreviewConfig returns the applied config and the config HAProxy would get if the app in labels was
+// deployed with the given number of replicas. The addresses of the new replicas are placeholders.
+func (hpm *HAProxyManager) PreviewConfig(deployments map[string]Deployment, labels *config.ContainerLabels, replicas int) (string, string, error) {
+	preview := maps.Clone(deployments)
+	instances := make([]DeploymentInstance, 0, replicas)
+	for i := range replicas {
+		instances = append(instances, DeploymentInstance{
+			ContainerID: fmt.Sprintf("dry-run-%d", i+1),
+			IP:          fmt.Sprintf("new-replica-%d", i+1),
+			Port:        labels.Port.String(),
+		})
+	}
+	preview[labels.AppName] = Deployment{Labels: labels, Instances: instances}
+
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+
+	configBuf, _, err := hpm.generateConfig(preview)
+	if err != nil {
+		return "", "", fmt.Errorf("HAProxyManager: failed to generate preview config: %w", err)
+	}
+	return string(hpm.lastConfig), configBuf.String(), nil
+}
+
+func deploymentIDs(deployments map[string]Deployment) map[string]string {
+	ids := make(map[string]string, len(deployments))
+	for appName, deployment := range deployments {
+		ids[appName] = deployment.Labels.DeploymentID
+	}
+	return ids
+}
+
+// RepairConfig rewrites and reloads the HAProxy config and domain maps when the files on disk no longer match
+// the last applied ones, e.g. after they were edited or removed by hand. It reports whether they were repaired.
+func (hpm *HAProxyManager) RepairConfig(ctx context.Context, logger *slog.Logger) (bool, error) {
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+
+	if hpm.debug || hpm.lastConfig == nil {
+		return false, nil
+	}
+
 	configPath := filepath.Join(hpm.configDir, constants.HAProxyConfigFileName)
-	logger.Debug("HAProxyManager: Writing config")
-	if err := os.WriteFile(configPath, configBuf.Bytes(), constants.ModeFileDefault); err != nil {
-		return fmt.Errorf("HAProxyManager: failed to write config file %s: %w", configPath, err)
+	current, err := os.ReadFile(configPath)
+	mapsMatch := hpm.lastMaps == nil || hpm.mapsOnDiskMatch(hpm.lastMaps)
+	if err == nil && bytes.Equal(current, hpm.lastConfig) && mapsMatch {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("HAProxyManager: failed to read config file %s: %w", configPath, err)
+	}
+
+	logger.Warn("HAProxyManager: Configuration on disk differs from the applied configuration, rewriting it")
+	if hpm.lastMaps != nil {
+		if err := hpm.writeMaps(hpm.lastMaps); err != nil {
+			return false, err
+		}
+	}
+	if err := os.WriteFile(configPath, hpm.lastConfig, constants.ModeFileDefault); err != nil {
+		return false, fmt.Errorf("HAProxyManager: failed to write config file %s: %w", configPath, err)
+	}
+	if _, err := hpm.reload(ctx, logger); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GenerateConfig renders the HAProxy config for the deployments without applying it.
+func (hpm *HAProxyManager) GenerateConfig(deployments map[string]Deployment) ([]byte, error) {
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+
+	configBuf, _, err := hpm.generateConfig(deployments)
+	if err != nil {
+		return nil, fmt.Errorf("HAProxyManager: failed to generate config: %w", err)
+	}
+	return configBuf.Bytes(), nil
+}
+
+// Reload signals HAProxy to load the config file on disk.
+func (hpm *HAProxyManager) Reload(ctx context.Context, logger *slog.Logger) error {
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+
+	_, err := hpm.reload(ctx, logger)
+	return err
+}
+
+// EnsureContainer starts or recreates the HAProxy container when it's stopped, unhealthy or missing.
+// It returns the container ID and reports whether the container was started or recreated.
+func (hpm *HAProxyManager) EnsureContainer(ctx context.Context, logger *slog.Logger) (string, bool, error) {
+	hpm.updateMutex.Lock()
+	defer hpm.updateMutex.Unlock()
+
+	if hpm.debug {
+		return "", false, nil
+	}
+	return hpm.container.ensure(ctx, logger)
+}
+
+// defaultContainerConfig returns the configuration haloyadm starts HAProxy with. The data directory is
+// mounted at the same path in haloyd, so its paths are valid on the host.
+func (hpm *HAProxyManager) defaultContainerConfig(ctx context.Context) (*container.Config, *container.HostConfig, error) {
+	var proxyConfig config.ProxyConfig
+	if hpm.haloydConfig != nil {
+		proxyConfig = hpm.haloydConfig.Normalize().Proxy
 	}
+	exposedPorts, portBindings, err := proxyPortBindings(ctx, hpm.cli, proxyConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	containerConfig := &container.Config{
+		Image:        fmt.Sprintf("haproxy:%s", constants.HAProxyVersion),
+		Labels:       map[string]string{config.LabelRole: config.HAProxyLabelRole},
+		ExposedPorts: exposedPorts,
+		// Running as root is necessary for privileged ports 80 and 443.
+		User: "root",
+	}
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:/usr/local/etc/haproxy:ro", hpm.configDir),
+			fmt.Sprintf("%s/%s:/usr/local/etc/haproxy-certs:rw", hpm.dataDir, constants.CertStorageDir),
+			fmt.Sprintf("%s/error-pages:/usr/local/etc/haproxy-errors:ro", hpm.dataDir),
+			fmt.Sprintf("%s/%s:%s:rw", hpm.dataDir, constants.HAProxyRunDir, haproxyAdminSocketDir),
+		},
+		PortBindings:  portBindings,
+		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+		NetworkMode:   container.NetworkMode(constants.DockerNetwork),
+	}
+	return containerConfig, hostConfig, nil
+}
 
-	haproxyID, err := hpm.getContainerID(ctx, logger)
+// reload signals HAProxy to load the config file. It reports false without an error when no HAProxy container is running.
+func (hpm *HAProxyManager) reload(ctx context.Context, logger *slog.Logger) (bool, error) {
+	haproxyID, err := hpm.container.runningID(ctx, logger)
 	if err != nil {
-		return fmt.Errorf("HAProxyManager: failed to find HAProxy container: %w", err)
+		return false, fmt.Errorf("HAProxyManager: failed to find HAProxy container: %w", err)
 	}
 	if haproxyID == "" {
 		logger.Warn("HAProxyManager: No HAProxy container found with label, cannot reload.")
-		return nil // Not necessarily an error if HAProxy isn't running
+		return false, nil
 	}
 
-	// Signal HAProxy Reload
 	logger.Debug("HAProxyManager: Sending SIGUSR2 signal to HAProxy container...")
-	err = hpm.cli.ContainerKill(ctx, haproxyID, "SIGUSR2")
-	if err != nil {
-		return fmt.Errorf("HAProxyManager: failed to send SIGUSR2 to HAProxy container %s: %w", helpers.SafeIDPrefix(haproxyID), err)
+	if err := hpm.cli.ContainerKill(ctx, haproxyID, "SIGUSR2"); err != nil {
+		return false, fmt.Errorf("HAProxyManager: failed to send SIGUSR2 to HAProxy container %s: %w", helpers.SafeIDPrefix(haproxyID), err)
 	}
+	return true, nil
+}
 
-	return nil
+// backendSections splits a rendered config into its backend sections, keyed by backend name.
+func backendSections(cfg string) map[string]string {
+	sections := make(map[string]string)
+	var name string
+	var section strings.Builder
+	flush := func() {
+		if name != "" {
+			sections[name] = section.String()
+		}
+		name = ""
+		section.Reset()
+	}
+
+	for line := range strings.Lines(cfg) {
+		trimmed := strings.TrimSpace(line)
+		if line != "" && line[0] != ' ' && line[0] != '\t' && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			flush()
+			if backendName, ok := strings.CutPrefix(trimmed, "backend "); ok {
+				name = strings.TrimSpace(backendName)
+			}
+		}
+		if name != "" {
+			section.WriteString(line)
+		}
+	}
+	flush()
+	return sections
+}
+
+// changedBackends returns the sorted names of backends that were added, removed or modified.
+func changedBackends(previous, current map[string]string) []string {
+	var changed []string
+	for name, section := range current {
+		if previous[name] != section {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	slices.Sort(changed)
+	return changed
 }
 
-// generateConfig creates the HAProxy configuration content based on deployments.
-// It checks for certificate existence before adding HTTPS bindings.
-func (hpm *HAProxyManager) generateConfig(deployments map[string]Deployment) (bytes.Buffer, error) {
+// haproxyConfigTemplate parses the embedded HAProxy config template once, it's the same for every update.
+var haproxyConfigTemplate = sync.OnceValues(func() (*template.Template, error) {
+	data, err := embed.TemplatesFS.ReadFile(fmt.Sprintf("templates/%s", constants.HAProxyConfigFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded file: %w", err)
+	}
+	tmpl, err := template.New("config").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+})
+
+// generateConfig creates the HAProxy configuration content based on deployments, and the domain maps it
+// references unless the proxy routing is set to acl.
+func (hpm *HAProxyManager) generateConfig(deployments map[string]Deployment) (bytes.Buffer, haproxyMaps, error) {
 	var buf bytes.Buffer
-	var httpFrontend string
-	var httpsFrontend string
-	var httpsFrontendUseBackend string
-	var backends string
+	// The sections are built with builders, appending to strings copies them for every line, which gets
+	// slow on servers with hundreds of apps.
+	var httpFrontend strings.Builder
+	var httpFrontendUseBackend strings.Builder
+	var httpsFrontend strings.Builder
+	var httpsFrontendUseBackend strings.Builder
+	var backends strings.Builder
 	const indent = "    "
 
+	proxyConfig := config.ProxyConfig{HTTPPort: config.DefaultProxyHTTPPort, HTTPSPort: config.DefaultProxyHTTPSPort}
+	if hpm.haloydConfig != nil {
+		proxyConfig = hpm.haloydConfig.Normalize().Proxy
+	}
+	// Clients include non-default ports in the Host header.
+	hostFetch := "hdr(host)"
+	if proxyConfig.HTTPPort != config.DefaultProxyHTTPPort || proxyConfig.HTTPSPort != config.DefaultProxyHTTPSPort {
+		hostFetch = "hdr(host),host_only"
+	}
+	httpsURL := func(domain string) string {
+		if proxyConfig.HTTPSPort == config.DefaultProxyHTTPSPort {
+			return "https://" + domain
+		}
+		return fmt.Sprintf("https://%s:%d", domain, proxyConfig.HTTPSPort)
+	}
+	httpURL := func(domain string) string {
+		if proxyConfig.HTTPPort == config.DefaultProxyHTTPPort {
+			return "http://" + domain
+		}
+		return fmt.Sprintf("http://%s:%d", domain, proxyConfig.HTTPPort)
+	}
+
+	var domainMaps haproxyMaps
+	if proxyConfig.UsesMapRouting() {
+		domainMaps = newHAProxyMaps()
+	}
+
 	// Add ACLs for api
 	if hpm.haloydConfig != nil && hpm.haloydConfig.API.Domain != "" {
 		apiDomain := hpm.haloydConfig.API.Domain
-		apiACLName := generateACLName("haloy_api", apiDomain, "acl")
+		if domainMaps != nil {
+			domainMaps.set(domainsMapFile, apiDomain, "haloy_api")
+			domainMaps.set(httpRedirectsMapFile, apiDomain, httpsURL(apiDomain))
+		} else {
+			apiACLName := generateACLName("haloy_api", apiDomain, "acl")
+
+			fmt.Fprintf(&httpsFrontend, "%sacl %s %s -i %s\n", indent, apiACLName, hostFetch, apiDomain)
+			fmt.Fprintf(&httpsFrontendUseBackend, "%suse_backend haloy_api if %s\n", indent, apiACLName)
+
+			fmt.Fprintf(&httpFrontend, "%sacl %s %s -i %s\n", indent, apiACLName, hostFetch, apiDomain)
+			fmt.Fprintf(&httpFrontend, "%shttp-request redirect code 301 location %s%%[path] if %s !is_acme_challenge\n",
+				indent, httpsURL(apiDomain), apiACLName)
+		}
 
-		httpsFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, apiACLName, apiDomain)
-		httpsFrontendUseBackend += fmt.Sprintf("%suse_backend haloy_api if %s\n", indent, apiACLName)
+		backends.WriteString("backend haloy_api\n")
+		fmt.Fprintf(&backends, "%smode http\n", indent)
+		fmt.Fprintf(&backends, "%s# Forward to the haloyd API server. The client address is appended to X-Forwarded-For, so haloyd\n", indent)
+		fmt.Fprintf(&backends, "%s# can read the client IP past trusted proxies in front of HAProxy.\n", indent)
+		fmt.Fprintf(&backends, "%soption forwardfor\n", indent)
+		fmt.Fprintf(&backends, "%shttp-request set-header X-Forwarded-Proto https\n", indent)
+		fmt.Fprintf(&backends, "%shttp-request set-header X-Forwarded-Port %%[dst_port]\n", indent)
+		fmt.Fprintf(&backends, "%shttp-request set-header Host %%[req.hdr(host)]\n", indent)
+		fmt.Fprintf(&backends, "%sserver haloyd haloyd:%s check\n", indent, constants.APIServerPort)
+		backends.WriteString("\n")
+	}
 
-		httpFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, apiACLName, apiDomain)
-		httpFrontend += fmt.Sprintf("%shttp-request redirect code 301 location https://%s%%[path] if %s !is_acme_challenge\n",
-			indent, apiDomain, apiACLName)
+	// Render apps in a stable order so unchanged deployments produce an identical config.
+	appNames := slices.Sorted(maps.Keys(deployments))
 
-		backends += "backend haloy_api\n"
-		backends += fmt.Sprintf("%smode http\n", indent)
-		backends += fmt.Sprintf("%s# Forward to the haloyd API server\n", indent)
-		backends += fmt.Sprintf("%shttp-request set-header X-Forwarded-For %%[src]\n", indent)
-		backends += fmt.Sprintf("%shttp-request set-header X-Forwarded-Proto https\n", indent)
-		backends += fmt.Sprintf("%shttp-request set-header X-Forwarded-Port %%[dst_port]\n", indent)
-		backends += fmt.Sprintf("%shttp-request set-header Host %%[req.hdr(host)]\n", indent)
-		backends += fmt.Sprintf("%sserver haloyd haloyd:%s check\n", indent, constants.APIServerPort)
-		backends += "\n"
-	}
+	// Routing rules of apps served on an additional frontend, by frontend name.
+	frontendRules := make(map[string]*strings.Builder)
 
-	for appName, d := range deployments {
+	for _, appName := range appNames {
+		d := deployments[appName]
 		var canonicalACLs []string
+		// Conditions of the canonical domains with tls disabled, served on the HTTP frontend.
+		var plainConditions []string
+
+		// Internal apps only get a backend, they are reached on the haloy network.
+		if len(d.Labels.Domains) == 0 || d.Labels.Exposure == config.ExposureInternal {
+			continue
+		}
+
+		if d.Labels.Frontend != "" {
+			frontend, ok := proxyConfig.Frontend(d.Labels.Frontend)
+			if !ok {
+				continue
+			}
+			rules, ok := frontendRules[frontend.Name]
+			if !ok {
+				rules = &strings.Builder{}
+				frontendRules[frontend.Name] = rules
+			}
+			rules.WriteString(frontendRoutingRules(d, deployments, frontend, indent))
+			continue
+		}
 
-		if len(d.Labels.Domains) == 0 {
+		if domainMaps != nil {
+			var routedHTTPS, routedHTTP bool
+			for _, domain := range d.Labels.Domains {
+				if domain.Canonical == "" {
+					continue
+				}
+				if domain.TLSDisabled() {
+					domainMaps.set(plainDomainsMapFile, domain.Canonical, appName)
+					routedHTTP = true
+					for _, alias := range domain.Aliases {
+						if alias != "" {
+							domainMaps.set(httpRedirectsMapFile, alias, httpURL(domain.Canonical))
+						}
+					}
+					continue
+				}
+				domainMaps.set(domainsMapFile, domain.Canonical, appName)
+				domainMaps.set(httpRedirectsMapFile, domain.Canonical, httpsURL(domain.Canonical))
+				routedHTTPS = true
+				for _, alias := range domain.Aliases {
+					if alias != "" {
+						domainMaps.set(httpsRedirectsMapFile, alias, httpsURL(domain.Canonical))
+						domainMaps.set(httpRedirectsMapFile, alias, httpsURL(domain.Canonical))
+					}
+				}
+			}
+			if routedHTTPS {
+				httpsFrontendUseBackend.WriteString(abTestRules(d, []string{mapRoutedCondition(appName)}, indent))
+			}
+			if routedHTTP {
+				httpFrontendUseBackend.WriteString(abTestRules(d, []string{mapRoutedCondition(appName) + " !is_acme_challenge"}, indent))
+			}
 			continue
 		}
 
 		for _, domain := range d.Labels.Domains {
-			if domain.Canonical != "" {
+			if domain.Canonical != "" && domain.TLSDisabled() {
+				canonicalACLName := generateACLName(appName, domain.Canonical, "canonical")
+				fmt.Fprintf(&httpFrontend, "%sacl %s %s -i %s\n", indent, canonicalACLName, hostFetch, domain.Canonical)
+				// ACME challenges still go to haloyd, e.g. while a certificate of the domain is cleaned up.
+				plainConditions = append(plainConditions, canonicalACLName+" !is_acme_challenge")
+
+				for _, alias := range domain.Aliases {
+					if alias != "" {
+						aliasACLName := fmt.Sprintf("%s_%s_alias", appName, strings.ReplaceAll(alias, ".", "_"))
+						fmt.Fprintf(&httpFrontend, "%sacl %s %s -i %s\n", indent, aliasACLName, hostFetch, alias)
+						fmt.Fprintf(&httpFrontend, "%shttp-request redirect code 301 location %s%%[path] if %s !is_acme_challenge\n",
+							indent, httpURL(domain.Canonical), aliasACLName)
+					}
+				}
+			} else if domain.Canonical != "" {
 				canonicalACLName := generateACLName(appName, domain.Canonical, "canonical")
 
-				httpsFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, canonicalACLName, domain.Canonical)
+				fmt.Fprintf(&httpsFrontend, "%sacl %s %s -i %s\n", indent, canonicalACLName, hostFetch, domain.Canonical)
 				canonicalACLs = append(canonicalACLs, canonicalACLName)
 
-				httpFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, canonicalACLName, domain.Canonical)
+				fmt.Fprintf(&httpFrontend, "%sacl %s %s -i %s\n", indent, canonicalACLName, hostFetch, domain.Canonical)
 				// Redirect HTTP to HTTPS for the canonical domain but exclude ACME challenge.
-				httpFrontend += fmt.Sprintf("%shttp-request redirect code 301 location https://%s%%[path] if %s !is_acme_challenge\n",
-					indent, domain.Canonical, canonicalACLName)
+				fmt.Fprintf(&httpFrontend, "%shttp-request redirect code 301 location %s%%[path] if %s !is_acme_challenge\n",
+					indent, httpsURL(domain.Canonical), canonicalACLName)
 
 				for _, alias := range domain.Aliases {
 					if alias != "" {
 						aliasKey := strings.ReplaceAll(alias, ".", "_")
 						aliasACLName := fmt.Sprintf("%s_%s_alias", appName, aliasKey)
 
-						httpsFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, aliasACLName, alias)
-						httpsFrontend += fmt.Sprintf("%shttp-request redirect code 301 location https://%s%%[path] if %s !is_acme_challenge\n",
-							indent, domain.Canonical, aliasACLName)
+						fmt.Fprintf(&httpsFrontend, "%sacl %s %s -i %s\n", indent, aliasACLName, hostFetch, alias)
+						fmt.Fprintf(&httpsFrontend, "%shttp-request redirect code 301 location %s%%[path] if %s !is_acme_challenge\n",
+							indent, httpsURL(domain.Canonical), aliasACLName)
 
-						httpFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, aliasACLName, alias)
-						httpFrontend += fmt.Sprintf("%shttp-request redirect code 301 location https://%s%%[path] if %s !is_acme_challenge\n",
-							indent, domain.Canonical, aliasACLName)
+						fmt.Fprintf(&httpFrontend, "%sacl %s %s -i %s\n", indent, aliasACLName, hostFetch, alias)
+						fmt.Fprintf(&httpFrontend, "%shttp-request redirect code 301 location %s%%[path] if %s !is_acme_challenge\n",
+							indent, httpsURL(domain.Canonical), aliasACLName)
 					}
 				}
 			}
 		}
 
 		if len(canonicalACLs) > 0 {
-			httpsFrontendUseBackend += fmt.Sprintf("%suse_backend %s if %s\n", indent, appName, strings.Join(canonicalACLs, " or "))
+			httpsFrontendUseBackend.WriteString(abTestRules(d, canonicalACLs, indent))
+			fmt.Fprintf(&httpsFrontendUseBackend, "%suse_backend %s if %s\n", indent, appName, strings.Join(canonicalACLs, " or "))
+		}
+		if len(plainConditions) > 0 {
+			httpFrontendUseBackend.WriteString(abTestRules(d, plainConditions, indent))
+			fmt.Fprintf(&httpFrontendUseBackend, "%suse_backend %s if %s\n", indent, appName, strings.Join(plainConditions, " or "))
+		}
+	}
+
+	if domainMaps != nil {
+		httpFrontend.WriteString(mapRoutingRules(httpRedirectsMapFile, plainDomainsMapFile, indent))
+		fmt.Fprintf(&httpFrontendUseBackend, "%suse_backend %%[var(txn.haloy_app)] if { var(txn.haloy_app) -m found } !is_acme_challenge\n", indent)
+		httpsFrontend.WriteString(mapRoutingRules(httpsRedirectsMapFile, domainsMapFile, indent))
+		fmt.Fprintf(&httpsFrontendUseBackend, "%suse_backend %%[var(txn.haloy_app)] if { var(txn.haloy_app) -m found }\n", indent)
+	}
+
+	// Additional frontends are rendered even without apps so their ports are always bound.
+	var frontends strings.Builder
+	for _, frontend := range proxyConfig.Frontends {
+		fmt.Fprintf(&frontends, "frontend %s\n", frontend.Name)
+		if frontend.TLS {
+			fmt.Fprintf(&frontends, "%sbind *:%d ssl crt /usr/local/etc/haproxy-certs/ alpn h2,http/1.1\n", indent, frontend.Port)
+		} else {
+			fmt.Fprintf(&frontends, "%sbind *:%d\n", indent, frontend.Port)
+		}
+		fmt.Fprintf(&frontends, "%smode http\n", indent)
+		if rules, ok := frontendRules[frontend.Name]; ok {
+			frontends.WriteString(rules.String())
 		}
+		fmt.Fprintf(&frontends, "%sdefault_backend default_backend\n\n", indent)
+	}
+	if proxyConfig.InternalPort != 0 {
+		frontends.WriteString(internalFrontend(deployments, appNames, proxyConfig.InternalPort, indent))
+	}
+	if hpm.statsPassword != "" {
+		frontends.WriteString(statsFrontend(hpm.statsPassword, indent))
 	}
 
-	for _, d := range deployments {
+	// Apps mirrored to by apps with shadow_to, rendered after the backends.
+	var shadowTargets []string
+
+	for _, appName := range appNames {
+		d := deployments[appName]
 		backendName := d.Labels.AppName
-		backends += fmt.Sprintf("backend %s\n", backendName)
-		for i, instance := range d.Instances {
-			backends += fmt.Sprintf("%sserver app%d %s:%s check\n", indent, i+1, instance.IP, instance.Port)
+		fmt.Fprintf(&backends, "backend %s\n", backendName)
+		if d.Paused {
+			backends.WriteString(pausedBackendOptions(indent))
+			continue
+		}
+		backends.WriteString(healthCheckOptions(d.Labels, indent))
+		backends.WriteString(queueOptions(d.Labels, indent))
+		if target := shadowTarget(d, deployments); target != "" {
+			backends.WriteString(shadowOptions(d.Labels, target, indent))
+			shadowTargets = append(shadowTargets, target)
+		}
+		backends.WriteString(backendServers(d.Labels, d.Instances, indent))
+
+		// The variant of an A/B test runs the same config with another image, so it gets the same options.
+		if d.ABTest != nil && len(d.Variant) > 0 {
+			fmt.Fprintf(&backends, "backend %s\n", abVariantBackendName(backendName))
+			backends.WriteString(healthCheckOptions(d.Labels, indent))
+			backends.WriteString(queueOptions(d.Labels, indent))
+			backends.WriteString(backendServers(d.Labels, d.Variant, indent))
 		}
 	}
 
-	data, err := embed.TemplatesFS.ReadFile(fmt.Sprintf("templates/%s", constants.HAProxyConfigFileName))
-	if err != nil {
-		return buf, fmt.Errorf("failed to read embedded file: %w", err)
+	var mirrorScript string
+	if len(shadowTargets) > 0 {
+		frontends.WriteString(shadowFrontend(shadowTargets, indent))
+		mirrorScript = "/usr/local/etc/haproxy/" + constants.HAProxyMirrorFileName
 	}
 
-	tmpl, err := template.New("config").Parse(string(data))
+	// The admin socket is only needed to update the domain maps at runtime. It's owned by the user of
+	// haloyd, which is the user of haloyadm on the host.
+	var adminSocket string
+	if domainMaps != nil {
+		adminSocket = haproxyAdminSocketDir + "/" + constants.HAProxyAdminSocket
+	}
+
+	tmpl, err := haproxyConfigTemplate()
 	if err != nil {
-		return buf, fmt.Errorf("failed to parse template: %w", err)
+		return buf, nil, err
 	}
 
 	templateData := embed.HAProxyTemplateData{
-		HTTPFrontend:            httpFrontend,
-		HTTPSFrontend:           httpsFrontend,
-		HTTPSFrontendUseBackend: httpsFrontendUseBackend,
-		Backends:                backends,
+		HTTPFrontend:            httpFrontend.String() + httpFrontendUseBackend.String(),
+		HTTPSFrontend:           httpsFrontend.String(),
+		HTTPSFrontendUseBackend: httpsFrontendUseBackend.String(),
+		Frontends:               frontends.String(),
+		Backends:                backends.String(),
+		HTTPPort:                proxyConfig.HTTPPort,
+		HTTPSPort:               proxyConfig.HTTPSPort,
+		StatsSocket:             haproxyAdminSocketDir + "/" + constants.HAProxyStatsSocket,
+		MirrorScript:            mirrorScript,
+		AdminSocket:             adminSocket,
+		AdminSocketUID:          os.Getuid(),
 	}
 
 	if err := tmpl.Execute(&buf, templateData); err != nil {
-		return buf, fmt.Errorf("failed to execute template: %w", err)
+		return buf, nil, fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	return buf, nil
+	return buf, domainMaps, nil
 }
 
-func (hpm *HAProxyManager) getContainerID(ctx context.Context, logger *slog.Logger) (string, error) {
-	maxRetries := 30
-	retryInterval := time.Second
+// backendServers returns the server lines of the replicas of a backend, sorted so the config is stable.
+func backendServers(labels *config.ContainerLabels, replicas []DeploymentInstance, indent string) string {
+	serverCheckOptions := serverCheckOptions(labels) + serverConnectionOptions(labels, len(replicas))
+	instances := slices.SortedFunc(slices.Values(replicas), func(a, b DeploymentInstance) int {
+		return strings.Compare(a.ContainerID, b.ContainerID)
+	})
+	var servers strings.Builder
+	for i, instance := range instances {
+		fmt.Fprintf(&servers, "%sserver app%d %s:%s %s\n", indent, i+1, instance.IP, instance.Port, serverCheckOptions)
+	}
+	return servers.String()
+}
 
-	for retry := range maxRetries {
-		if ctx.Err() != nil {
-			return "", fmt.Errorf("context canceled while waiting for HAProxy container: %w", ctx.Err())
-		}
+// mapRoutingRules looks up the host of a request in the redirects and domains maps of a frontend. Redirects
+// come first, the backend of a routed host is stored in txn.haloy_app for the use_backend rules. ACME
+// challenges are never redirected.
+func mapRoutingRules(redirectsMap, domainsMap, indent string) string {
+	var rules strings.Builder
+	fmt.Fprintf(&rules, "%shttp-request set-var(txn.haloy_redirect) %s\n", indent, mapLookup(redirectsMap))
+	fmt.Fprintf(&rules, "%shttp-request redirect code 301 location %%[var(txn.haloy_redirect)]%%[path] if { var(txn.haloy_redirect) -m found } !is_acme_challenge\n", indent)
+	fmt.Fprintf(&rules, "%shttp-request set-var(txn.haloy_app) %s\n", indent, mapLookup(domainsMap))
+	return rules.String()
+}
 
-		filtersArgs := filters.NewArgs()
-		filtersArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelRole, config.HAProxyLabelRole))
-		filtersArgs.Add("status", "running") // Only consider running containers
+// mapRoutedCondition matches the requests the domain maps route to an app.
+func mapRoutedCondition(appName string) string {
+	return fmt.Sprintf("{ var(txn.haloy_app) -m str %s }", appName)
+}
 
-		containers, err := hpm.cli.ContainerList(ctx, container.ListOptions{
-			Filters: filtersArgs,
-			Limit:   1, // We only expect one HAProxy container managed by haloy
-		})
-		if err != nil {
-			return "", fmt.Errorf("failed to list containers with label %s=%s: %w",
-				config.LabelRole, config.HAProxyLabelRole, err)
-		}
+// httpHealthCheckPath returns the path the proxy checks replicas on, and false for apps without an HTTP check.
+func httpHealthCheckPath(labels *config.ContainerLabels) (string, bool) {
+	// A liveness path implies an HTTP check even when the type is not set explicitly.
+	isHTTPCheck := labels.HealthCheckType == config.HealthCheckTypeHTTP ||
+		(labels.HealthCheckType == "" && labels.HealthCheckLivenessPath != "")
+	if !isHTTPCheck {
+		return "", false
+	}
 
-		if len(containers) > 0 {
-			// Found a running HAProxy container
-			return containers[0].ID, nil
-		}
+	path := labels.HealthCheckPath
+	if labels.HealthCheckLivenessPath != "" {
+		path = labels.HealthCheckLivenessPath
+	}
+	if path == "" {
+		path = constants.DefaultHealthCheckPath
+	}
+	return path, true
+}
 
-		if retry == 0 || retry == maxRetries/2 {
-			logger.Info("Waiting for HAProxy container to be running", "attempt", retry+1, "max_retries", maxRetries)
-		}
+// pausedBackendOptions answers all requests to a paused app with a maintenance page.
+func pausedBackendOptions(indent string) string {
+	return fmt.Sprintf("%shttp-request return status 503 content-type \"text/html\" string \"%s\" hdr Retry-After 300\n",
+		indent, pausedPage)
+}
+
+const pausedPage = `<!DOCTYPE html><html><head><title>Temporarily unavailable</title></head>` +
+	`<body><h1>Temporarily unavailable</h1><p>This site is paused for maintenance. Please check back later.</p></body></html>`
+
+// healthCheckOptions returns the backend check options matching the app's health check type.
+// HAProxy can't run commands in containers or speak the gRPC health protocol, so exec and grpc
+// checks fall back to the default TCP connect check. The same goes for apps without an explicit type
+// or liveness path.
+func healthCheckOptions(labels *config.ContainerLabels, indent string) string {
+	path, ok := httpHealthCheckPath(labels)
+	if !ok {
+		return ""
+	}
 
-		select {
-		case <-ctx.Done():
-			return "", fmt.Errorf("context canceled while waiting for HAProxy container: %w", ctx.Err())
-		case <-time.After(retryInterval):
-			// Continue to next retries
+	expectedStatus := "200-299"
+	if len(labels.HealthCheckExpectedStatusCodes) > 0 {
+		codes := make([]string, len(labels.HealthCheckExpectedStatusCodes))
+		for i, code := range labels.HealthCheckExpectedStatusCodes {
+			codes[i] = strconv.Itoa(code)
 		}
+		expectedStatus = strings.Join(codes, ",")
+	}
+
+	var options strings.Builder
+	fmt.Fprintf(&options, "%soption httpchk GET %s\n", indent, path)
+	fmt.Fprintf(&options, "%shttp-check expect status %s\n", indent, expectedStatus)
+	return options.String()
+}
+
+// serverCheckOptions returns the check options for server lines, using HAProxy defaults for unset values.
+func serverCheckOptions(labels *config.ContainerLabels) string {
+	options := "check"
+	if labels.HealthCheckInterval > 0 {
+		options += fmt.Sprintf(" inter %d", max(labels.HealthCheckInterval.Milliseconds(), 1))
+	}
+	if labels.HealthCheckRise > 0 {
+		options += fmt.Sprintf(" rise %d", labels.HealthCheckRise)
+	}
+	if labels.HealthCheckRetries > 0 {
+		options += fmt.Sprintf(" fall %d", labels.HealthCheckRetries)
+	}
+	return options
+}
+
+// queueOptions returns the queue timeout of an app with connection limits.
+func queueOptions(labels *config.ContainerLabels, indent string) string {
+	if labels.ReplicaMaxConn(1) == 0 || labels.QueueTimeout <= 0 {
+		return ""
 	}
+	return fmt.Sprintf("%stimeout queue %dms\n", indent, max(labels.QueueTimeout.Milliseconds(), 1))
+}
 
-	return "", fmt.Errorf("timed out waiting for HAProxy container to be in running state after %d seconds",
-		maxRetries)
+// serverConnectionOptions returns the connection limits for the server lines of an app with the given
+// number of replicas. Requests above the limit are queued by HAProxy.
+func serverConnectionOptions(labels *config.ContainerLabels, replicas int) string {
+	maxConn := labels.ReplicaMaxConn(replicas)
+	if maxConn == 0 {
+		return ""
+	}
+	options := fmt.Sprintf(" maxconn %d", maxConn)
+	if labels.MaxQueue > 0 {
+		options += fmt.Sprintf(" maxqueue %d", labels.MaxQueue)
+	}
+	return options
 }
 
 // sanitizeForACL converts a domain name to a safe ACL identifier
@@ -238,6 +820,180 @@ func sanitizeForACL(domain string) string {
 	return strings.ReplaceAll(domain, ".", "_")
 }
 
+// frontendRoutingRules returns the host based routing rules of an app served on an additional frontend.
+// Aliases redirect to the canonical domain on the same frontend.
+func frontendRoutingRules(d Deployment, deployments map[string]Deployment, frontend config.ProxyFrontend, indent string) string {
+	appName := d.Labels.AppName
+	scheme := "http"
+	if frontend.TLS {
+		scheme = "https"
+	}
+
+	var rules strings.Builder
+	var canonicalACLs []string
+	for _, domain := range d.Labels.Domains {
+		if domain.Canonical == "" {
+			continue
+		}
+		canonicalACLName := generateACLName(appName, domain.Canonical, "canonical")
+		fmt.Fprintf(&rules, "%sacl %s hdr(host),host_only -i %s\n", indent, canonicalACLName, domain.Canonical)
+		canonicalACLs = append(canonicalACLs, canonicalACLName)
+
+		for _, alias := range domain.Aliases {
+			if alias == "" {
+				continue
+			}
+			aliasACLName := generateACLName(appName, alias, "alias")
+			fmt.Fprintf(&rules, "%sacl %s hdr(host),host_only -i %s\n", indent, aliasACLName, alias)
+			fmt.Fprintf(&rules, "%shttp-request redirect code 301 location %s://%s:%d%%[path] if %s\n",
+				indent, scheme, domain.Canonical, frontend.Port, aliasACLName)
+		}
+	}
+	if len(canonicalACLs) > 0 {
+		rules.WriteString(abTestRules(d, canonicalACLs, indent))
+		fmt.Fprintf(&rules, "%suse_backend %s if %s\n", indent, appName, strings.Join(canonicalACLs, " or "))
+	}
+	return rules.String()
+}
+
+// abTestRules routes the requests to the domains of an app that match its A/B test to the backend of the variant
+// deployment, as long as the variant has running replicas. They must come before the use_backend rule of the app.
+func abTestRules(d Deployment, canonicalACLs []string, indent string) string {
+	test := d.ABTest
+	if test == nil || len(d.Variant) == 0 {
+		return ""
+	}
+
+	// ACL lines with the same name are ORed, so any of the matches selects the variant.
+	aclName := generateACLName(d.Labels.AppName, "ab", "variant")
+	var rules strings.Builder
+	if test.HeaderName != "" {
+		fmt.Fprintf(&rules, "%sacl %s req.hdr(%s) -m str %s\n", indent, aclName, test.HeaderName, test.HeaderValue)
+	}
+	if test.CookieName != "" {
+		fmt.Fprintf(&rules, "%sacl %s req.cook(%s) -m str %s\n", indent, aclName, test.CookieName, test.CookieValue)
+	}
+	if test.Percentage > 0 {
+		fmt.Fprintf(&rules, "%sacl %s rand(100) lt %d\n", indent, aclName, test.Percentage)
+	}
+
+	conditions := make([]string, 0, len(canonicalACLs))
+	for _, canonicalACL := range canonicalACLs {
+		conditions = append(conditions, canonicalACL+" "+aclName)
+	}
+	fmt.Fprintf(&rules, "%suse_backend %s if %s\n", indent, abVariantBackendName(d.Labels.AppName), strings.Join(conditions, " or "))
+	return rules.String()
+}
+
+// abVariantBackendName returns the backend of the variant deployment of an app. App names can't contain a dot,
+// so it never clashes with the backend of another app.
+func abVariantBackendName(appName string) string {
+	return appName + ".ab"
+}
+
+// internalFrontend returns the frontend that routes requests from the haloy network to internal apps.
+// An app is selected by its name in the Host header or by the first path segment, which is removed
+// before the request is forwarded. The backend is picked before any path is rewritten, so a rewritten
+// path can't match the prefix of another app.
+func internalFrontend(deployments map[string]Deployment, appNames []string, port int, indent string) string {
+	var frontend, selectRules, rewriteRules strings.Builder
+	fmt.Fprintf(&frontend, "frontend %s\n", config.ProxyInternalFrontendName)
+	// Not published by haloyadm, so only containers on the haloy network can connect.
+	fmt.Fprintf(&frontend, "%sbind *:%d\n", indent, port)
+	fmt.Fprintf(&frontend, "%smode http\n", indent)
+
+	for _, appName := range appNames {
+		if deployments[appName].Labels.Exposure != config.ExposureInternal {
+			continue
+		}
+		hostACLName := generateACLName(appName, "internal", "host")
+		pathACLName := generateACLName(appName, "internal", "path")
+		fmt.Fprintf(&frontend, "%sacl %s hdr(host),host_only -i %s\n", indent, hostACLName, appName)
+		fmt.Fprintf(&frontend, "%sacl %s path /%s\n", indent, pathACLName, appName)
+		fmt.Fprintf(&frontend, "%sacl %s path_beg /%s/\n", indent, pathACLName, appName)
+
+		fmt.Fprintf(&selectRules, "%shttp-request set-var(txn.internal_app) str(%s) if %s or %s\n", indent, appName, hostACLName, pathACLName)
+
+		selected := fmt.Sprintf("{ var(txn.internal_app) -m str %s }", appName)
+		fmt.Fprintf(&rewriteRules, "%shttp-request set-header X-Forwarded-Prefix /%s if %s %s !%s\n", indent, appName, selected, pathACLName, hostACLName)
+		fmt.Fprintf(&rewriteRules, "%shttp-request set-path %%[path,regsub(^/%s/?,/)] if %s %s !%s\n", indent, appName, selected, pathACLName, hostACLName)
+	}
+	frontend.WriteString(selectRules.String())
+	frontend.WriteString(rewriteRules.String())
+	fmt.Fprintf(&frontend, "%suse_backend %%[var(txn.internal_app)] if { var(txn.internal_app) -m found }\n", indent)
+	fmt.Fprintf(&frontend, "%sdefault_backend default_backend\n\n", indent)
+	return frontend.String()
+}
+
+// statsFrontend serves the stats page on the same path as the API, so the links of the page work when it's proxied.
+func statsFrontend(password, indent string) string {
+	var frontend strings.Builder
+	fmt.Fprintf(&frontend, "frontend %s\n", config.ProxyStatsFrontendName)
+	// Not published by haloyadm, the password keeps other containers on the haloy network out.
+	fmt.Fprintf(&frontend, "%sbind *:%s\n", indent, constants.HAProxyStatsPagePort)
+	fmt.Fprintf(&frontend, "%smode http\n", indent)
+	fmt.Fprintf(&frontend, "%sstats enable\n", indent)
+	fmt.Fprintf(&frontend, "%sstats uri %s\n", indent, constants.HAProxyStatsPagePath)
+	fmt.Fprintf(&frontend, "%sstats refresh 10s\n", indent)
+	fmt.Fprintf(&frontend, "%sstats hide-version\n", indent)
+	fmt.Fprintf(&frontend, "%sstats auth %s:%s\n\n", indent, constants.HAProxyStatsPageUser, password)
+	return frontend.String()
+}
+
+// shadowTarget returns the app the requests of d are mirrored to, or an empty string when the app has no
+// shadow_to or the app it names has no running replicas.
+func shadowTarget(d Deployment, deployments map[string]Deployment) string {
+	if d.Labels.ShadowTo == "" {
+		return ""
+	}
+	target, ok := deployments[d.Labels.ShadowTo]
+	if !ok || target.Paused || len(target.Instances) == 0 {
+		return ""
+	}
+	return d.Labels.ShadowTo
+}
+
+// shadowOptions mirrors a percentage of the requests of a backend to the shadow frontend. Mirrored requests are
+// never mirrored again, so apps can shadow each other.
+func shadowOptions(labels *config.ContainerLabels, target, indent string) string {
+	condition := "!{ req.hdr(x-haloy-shadow) -m found }"
+	if labels.ShadowPercentage > 0 && labels.ShadowPercentage < 100 {
+		condition += fmt.Sprintf(" { rand(100) lt %d }", labels.ShadowPercentage)
+	}
+	var options strings.Builder
+	// The body is buffered so it can be copied.
+	fmt.Fprintf(&options, "%soption http-buffer-request\n", indent)
+	fmt.Fprintf(&options, "%shttp-request lua.haloy_mirror %s %s if %s\n", indent, target, constants.HAProxyShadowPort, condition)
+	return options.String()
+}
+
+// shadowFrontend routes mirrored requests to the backends of their target apps. It's bound to the loopback
+// interface, so only the mirror script of HAProxy can reach it.
+func shadowFrontend(targets []string, indent string) string {
+	var frontend strings.Builder
+	fmt.Fprintf(&frontend, "frontend %s\n", config.ProxyShadowFrontendName)
+	fmt.Fprintf(&frontend, "%sbind 127.0.0.1:%s\n", indent, constants.HAProxyShadowPort)
+	fmt.Fprintf(&frontend, "%smode http\n", indent)
+	for _, target := range slices.Compact(slices.Sorted(slices.Values(targets))) {
+		fmt.Fprintf(&frontend, "%suse_backend %s if { req.hdr(x-haloy-shadow) -m str %s }\n", indent, target, target)
+	}
+	fmt.Fprintf(&frontend, "%sdefault_backend default_backend\n\n", indent)
+	return frontend.String()
+}
+
+// writeMirrorScript writes the Lua script that mirrors requests next to the HAProxy config.
+func (hpm *HAProxyManager) writeMirrorScript() error {
+	data, err := embed.TemplatesFS.ReadFile(fmt.Sprintf("templates/%s", constants.HAProxyMirrorFileName))
+	if err != nil {
+		return fmt.Errorf("failed to read embedded file: %w", err)
+	}
+	scriptPath := filepath.Join(hpm.configDir, constants.HAProxyMirrorFileName)
+	if err := os.WriteFile(scriptPath, data, constants.ModeFileDefault); err != nil {
+		return fmt.Errorf("HAProxyManager: failed to write mirror script %s: %w", scriptPath, err)
+	}
+	return nil
+}
+
 // generateACLName creates a consistent ACL name
 func generateACLName(appName, domain, suffix string) string {
 	return fmt.Sprintf("%s_%s_%s", appName, sanitizeForACL(domain), suffix)
@@ -0,0 +1,156 @@
+package haloyd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+// Map files of the domain routing, see config.ProxyRoutingMap. They're written next to haproxy.cfg.
+const (
+	// domainsMapFile routes the hosts of the HTTPS frontend to backends.
+	domainsMapFile = "domains.map"
+	// plainDomainsMapFile routes the hosts of domains with tls disabled on the HTTP frontend to backends.
+	plainDomainsMapFile = "plain_domains.map"
+	// httpRedirectsMapFile redirects hosts on the HTTP frontend, to HTTPS or from aliases to the canonical domain.
+	httpRedirectsMapFile = "http_redirects.map"
+	// httpsRedirectsMapFile redirects the aliases on the HTTPS frontend to their canonical domain.
+	httpsRedirectsMapFile = "https_redirects.map"
+)
+
+var haproxyMapFiles = []string{domainsMapFile, plainDomainsMapFile, httpRedirectsMapFile, httpsRedirectsMapFile}
+
+// haproxyMapDir is where the config directory is mounted in the HAProxy container.
+const haproxyMapDir = "/usr/local/etc/haproxy"
+
+// haproxyAdminSocketDir is where the run directory with the stats and admin sockets is mounted in the HAProxy container.
+const haproxyAdminSocketDir = "/usr/local/etc/haproxy-run"
+
+const adminSocketTimeout = 5 * time.Second
+
+// haproxyMaps holds the entries of the map files by file name. Keys are lowercase hosts.
+type haproxyMaps map[string]map[string]string
+
+func newHAProxyMaps() haproxyMaps {
+	m := make(haproxyMaps, len(haproxyMapFiles))
+	for _, file := range haproxyMapFiles {
+		m[file] = make(map[string]string)
+	}
+	return m
+}
+
+func (m haproxyMaps) set(file, host, value string) {
+	m[file][strings.ToLower(host)] = value
+}
+
+// render returns the content of a map file, sorted so unchanged maps produce identical files.
+func (m haproxyMaps) render(file string) []byte {
+	var b strings.Builder
+	b.WriteString("# Generated by haloyd, changes are overwritten.\n")
+	for _, key := range slices.Sorted(maps.Keys(m[file])) {
+		fmt.Fprintf(&b, "%s %s\n", key, m[file][key])
+	}
+	return []byte(b.String())
+}
+
+func (m haproxyMaps) equal(other haproxyMaps) bool {
+	return maps.EqualFunc(m, other, func(a, b map[string]string) bool { return maps.Equal(a, b) })
+}
+
+// mapLookup returns the sample that looks up the host of a request in a map file.
+func mapLookup(file string) string {
+	return fmt.Sprintf("req.hdr(host),host_only,lower,map(%s/%s)", haproxyMapDir, file)
+}
+
+// writeMaps writes all map files, HAProxy refuses to load a config that references a missing one.
+func (hpm *HAProxyManager) writeMaps(m haproxyMaps) error {
+	for _, file := range haproxyMapFiles {
+		mapPath := filepath.Join(hpm.configDir, file)
+		if err := os.WriteFile(mapPath, m.render(file), constants.ModeFileDefault); err != nil {
+			return fmt.Errorf("HAProxyManager: failed to write map file %s: %w", mapPath, err)
+		}
+	}
+	return nil
+}
+
+// mapsOnDiskMatch reports whether the map files on disk have the content of m.
+func (hpm *HAProxyManager) mapsOnDiskMatch(m haproxyMaps) bool {
+	for _, file := range haproxyMapFiles {
+		current, err := os.ReadFile(filepath.Join(hpm.configDir, file))
+		if err != nil || string(current) != string(m.render(file)) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateMapsAtRuntime applies the differences between the previous and current maps through the admin socket
+// of HAProxy, so running HAProxy processes route the changed domains without a reload.
+func (hpm *HAProxyManager) updateMapsAtRuntime(ctx context.Context, previous, current haproxyMaps) (int, error) {
+	socketPath := filepath.Join(hpm.dataDir, constants.HAProxyRunDir, constants.HAProxyAdminSocket)
+	if _, err := os.Stat(socketPath); err != nil {
+		// HAProxy containers created before map routing don't mount the run directory.
+		return 0, fmt.Errorf("admin socket not available, restart HAProxy with 'haloyadm restart' to create it: %w", err)
+	}
+
+	var commands []string
+	for _, file := range haproxyMapFiles {
+		mapPath := haproxyMapDir + "/" + file
+		for _, key := range slices.Sorted(maps.Keys(current[file])) {
+			value := current[file][key]
+			previousValue, ok := previous[file][key]
+			switch {
+			case !ok:
+				commands = append(commands, fmt.Sprintf("add map %s %s %s", mapPath, key, value))
+			case previousValue != value:
+				commands = append(commands, fmt.Sprintf("set map %s %s %s", mapPath, key, value))
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(previous[file])) {
+			if _, ok := current[file][key]; !ok {
+				commands = append(commands, fmt.Sprintf("del map %s %s", mapPath, key))
+			}
+		}
+	}
+
+	for _, command := range commands {
+		if err := adminSocketCommand(ctx, socketPath, command); err != nil {
+			return 0, err
+		}
+	}
+	return len(commands), nil
+}
+
+// adminSocketCommand runs a command on the HAProxy runtime API. Map commands print nothing when they succeed.
+func adminSocketCommand(ctx context.Context, socketPath, command string) error {
+	dialer := net.Dialer{Timeout: adminSocketTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the HAProxy admin socket: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(adminSocketTimeout)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, command+"\n"); err != nil {
+		return fmt.Errorf("failed to send '%s' to the HAProxy admin socket: %w", command, err)
+	}
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read the response to '%s' from the HAProxy admin socket: %w", command, err)
+	}
+	if msg := strings.TrimSpace(string(response)); msg != "" {
+		return fmt.Errorf("HAProxy rejected '%s': %s", command, msg)
+	}
+	return nil
+}
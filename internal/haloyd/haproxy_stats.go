@@ -0,0 +1,124 @@
+package haloyd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+const statsSocketTimeout = 5 * time.Second
+
+// generateStatsPassword creates the password of the stats page. It's only shared between haloyd and HAProxy,
+// so a new one is generated on every start.
+func generateStatsPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate stats page password: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// BackendStats returns the current metrics of all backends and their servers by backend name,
+// which is the app name for apps. They're read from the HAProxy stats socket.
+func (hpm *HAProxyManager) BackendStats(ctx context.Context) (map[string]apitypes.HAProxyBackendStats, error) {
+	dialer := net.Dialer{Timeout: statsSocketTimeout}
+	socketPath := filepath.Join(hpm.dataDir, constants.HAProxyRunDir, constants.HAProxyStatsSocket)
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the HAProxy stats socket: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(statsSocketTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, "show stat\n"); err != nil {
+		return nil, fmt.Errorf("failed to query the HAProxy stats socket: %w", err)
+	}
+	return parseBackendStats(conn)
+}
+
+// parseBackendStats parses the CSV output of 'show stat'. The columns are looked up by name from the
+// header line, which starts with "# ". Frontends are skipped.
+func parseBackendStats(r io.Reader) (map[string]apitypes.HAProxyBackendStats, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HAProxy stats: %w", err)
+	}
+	if len(header) == 0 || !strings.HasPrefix(header[0], "# ") {
+		return nil, fmt.Errorf("unexpected HAProxy stats header: %s", strings.Join(header, ","))
+	}
+	header[0] = strings.TrimPrefix(header[0], "# ")
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	number := func(record []string, name string) int {
+		n, _ := strconv.Atoi(field(record, name))
+		return n
+	}
+
+	stats := make(map[string]apitypes.HAProxyBackendStats)
+	servers := make(map[string][]apitypes.HAProxyServerStats)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HAProxy stats: %w", err)
+		}
+		name := field(record, "pxname")
+		switch svname := field(record, "svname"); svname {
+		case "FRONTEND":
+		case "BACKEND":
+			stats[name] = apitypes.HAProxyBackendStats{
+				Name:            name,
+				Status:          field(record, "status"),
+				CurrentSessions: number(record, "scur"),
+				SessionRate:     number(record, "rate"),
+				QueuedRequests:  number(record, "qcur"),
+				TotalSessions:   number(record, "stot"),
+				Responses5xx:    number(record, "hrsp_5xx"),
+			}
+		default:
+			servers[name] = append(servers[name], apitypes.HAProxyServerStats{
+				Name:            svname,
+				Address:         field(record, "addr"),
+				Status:          field(record, "status"),
+				CheckStatus:     field(record, "check_status"),
+				CurrentSessions: number(record, "scur"),
+				SessionRate:     number(record, "rate"),
+				QueuedRequests:  number(record, "qcur"),
+				MaxConnections:  number(record, "slim"),
+			})
+		}
+	}
+
+	// Servers are listed before the BACKEND line of their backend.
+	for name, backend := range stats {
+		backend.Servers = servers[name]
+		stats[name] = backend
+	}
+	return stats, nil
+}
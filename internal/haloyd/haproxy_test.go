@@ -0,0 +1,174 @@
+package haloyd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/storage"
+)
+
+// configGenerationTarget is the latency the config of a server with many apps must be generated within.
+// Config generation runs on every update while the update mutex is held.
+const configGenerationTarget = 500 * time.Millisecond
+
+// testDeployments returns apps with the given number of domains, each with an alias, and two replicas.
+func testDeployments(apps, domainsPerApp int) map[string]Deployment {
+	deployments := make(map[string]Deployment, apps)
+	for i := range apps {
+		appName := fmt.Sprintf("app-%d", i)
+		domains := make([]config.Domain, domainsPerApp)
+		for j := range domains {
+			domains[j] = config.Domain{
+				Canonical: fmt.Sprintf("d%d.%s.example.com", j, appName),
+				Aliases:   []string{fmt.Sprintf("www.d%d.%s.example.com", j, appName)},
+			}
+		}
+		deployments[appName] = Deployment{
+			Labels: &config.ContainerLabels{
+				AppName:      appName,
+				DeploymentID: fmt.Sprintf("01K00000000000000000000%03d", i),
+				Port:         "8080",
+				Domains:      domains,
+			},
+			Instances: []DeploymentInstance{
+				{ContainerID: fmt.Sprintf("%s-a", appName), IP: fmt.Sprintf("172.18.%d.%d", i/250, i%250+1), Port: "8080"},
+				{ContainerID: fmt.Sprintf("%s-b", appName), IP: fmt.Sprintf("172.19.%d.%d", i/250, i%250+1), Port: "8080"},
+			},
+		}
+	}
+	return deployments
+}
+
+func TestGenerateConfig_ManyApps(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+
+	const apps, domainsPerApp = 500, 5
+	deployments := testDeployments(apps, domainsPerApp)
+
+	for _, routing := range []string{config.ProxyRoutingMap, config.ProxyRoutingACL} {
+		t.Run(routing, func(t *testing.T) {
+			hpm := &HAProxyManager{haloydConfig: &config.HaloydConfig{
+				API:   config.APIConfig{Domain: "api.example.com"},
+				Proxy: config.ProxyConfig{Routing: routing},
+			}}
+
+			start := time.Now()
+			configBuf, domainMaps, err := hpm.generateConfig(deployments)
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatalf("generateConfig() error = %v", err)
+			}
+			if elapsed > configGenerationTarget {
+				t.Errorf("generateConfig() took %v for %d apps with %d domains each, expected less than %v",
+					elapsed, apps, domainsPerApp, configGenerationTarget)
+			}
+
+			cfg := configBuf.String()
+			if got := strings.Count(cfg, "\nbackend app-"); got != apps {
+				t.Errorf("generateConfig() rendered %d app backends, expected %d", got, apps)
+			}
+			lastDomain := fmt.Sprintf("d%d.app-%d.example.com", domainsPerApp-1, apps-1)
+			if routing == config.ProxyRoutingACL {
+				if domainMaps != nil {
+					t.Errorf("generateConfig() returned domain maps with acl routing")
+				}
+				if !strings.Contains(cfg, lastDomain) {
+					t.Errorf("generateConfig() config is missing the ACL of %s", lastDomain)
+				}
+				return
+			}
+
+			if strings.Contains(cfg, lastDomain) {
+				t.Errorf("generateConfig() config contains %s, expected it only in the domain maps", lastDomain)
+			}
+			// The API domain is routed with the apps.
+			if got := len(domainMaps[domainsMapFile]); got != apps*domainsPerApp+1 {
+				t.Errorf("domains map has %d entries, expected %d", got, apps*domainsPerApp+1)
+			}
+			if got := domainMaps[httpsRedirectsMapFile]["www."+lastDomain]; got != "https://"+lastDomain {
+				t.Errorf("https redirect of www.%s = %q, expected %q", lastDomain, got, "https://"+lastDomain)
+			}
+		})
+	}
+}
+
+func TestGenerateConfig_Stable(t *testing.T) {
+	hpm := &HAProxyManager{haloydConfig: &config.HaloydConfig{}}
+	deployments := testDeployments(20, 2)
+
+	first, firstMaps, err := hpm.generateConfig(deployments)
+	if err != nil {
+		t.Fatalf("generateConfig() error = %v", err)
+	}
+	second, secondMaps, err := hpm.generateConfig(deployments)
+	if err != nil {
+		t.Fatalf("generateConfig() error = %v", err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("generateConfig() rendered different configs for the same deployments")
+	}
+	if !firstMaps.equal(secondMaps) {
+		t.Errorf("generateConfig() returned different domain maps for the same deployments")
+	}
+}
+
+func TestGenerateConfig_ABTest(t *testing.T) {
+	deployments := testDeployments(2, 1)
+	d := deployments["app-0"]
+	d.ABTest = &storage.ABTest{AppName: "app-0", VariantDeploymentID: "01K00000000000000000000100", HeaderName: "X-Beta", HeaderValue: "1"}
+	d.Variant = []DeploymentInstance{{ContainerID: "app-0-variant", IP: "172.20.0.1", Port: "8080"}}
+	deployments["app-0"] = d
+
+	for _, routing := range []string{config.ProxyRoutingMap, config.ProxyRoutingACL} {
+		t.Run(routing, func(t *testing.T) {
+			hpm := &HAProxyManager{haloydConfig: &config.HaloydConfig{Proxy: config.ProxyConfig{Routing: routing}}}
+			configBuf, _, err := hpm.generateConfig(deployments)
+			if err != nil {
+				t.Fatalf("generateConfig() error = %v", err)
+			}
+			cfg := configBuf.String()
+			for _, expected := range []string{"req.hdr(X-Beta) -m str 1", "use_backend app-0.ab if ", "backend app-0.ab\n", "server app1 172.20.0.1:8080"} {
+				if !strings.Contains(cfg, expected) {
+					t.Errorf("generateConfig() config is missing %q", expected)
+				}
+			}
+			if strings.Contains(cfg, "app-1.ab") {
+				t.Errorf("generateConfig() rendered a variant backend for an app without an A/B test")
+			}
+		})
+	}
+
+	// Without running replicas the variant gets no backend, and all requests go to the app.
+	d.Variant = nil
+	deployments["app-0"] = d
+	hpm := &HAProxyManager{haloydConfig: &config.HaloydConfig{}}
+	configBuf, _, err := hpm.generateConfig(deployments)
+	if err != nil {
+		t.Fatalf("generateConfig() error = %v", err)
+	}
+	if strings.Contains(configBuf.String(), "app-0.ab") {
+		t.Errorf("generateConfig() routed to a variant without replicas")
+	}
+}
+
+func BenchmarkGenerateConfig(b *testing.B) {
+	for _, apps := range []int{10, 100, 500} {
+		for _, routing := range []string{config.ProxyRoutingMap, config.ProxyRoutingACL} {
+			b.Run(fmt.Sprintf("%s/apps=%d", routing, apps), func(b *testing.B) {
+				hpm := &HAProxyManager{haloydConfig: &config.HaloydConfig{Proxy: config.ProxyConfig{Routing: routing}}}
+				deployments := testDeployments(apps, 5)
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, _, err := hpm.generateConfig(deployments); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
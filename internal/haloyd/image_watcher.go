@@ -0,0 +1,202 @@
+package haloyd
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/api"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	haloyevents "github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ImageUpdateFunc deploys a new image of an app, see api.APIServer.DeployImageUpdate.
+type ImageUpdateFunc func(ctx context.Context, update api.ImageUpdate) (api.ImageUpdateResult, error)
+
+// ImageWatcher deploys new images of apps with image_watch in their deployment spec. Apps with a semver range
+// get the highest tag in the range that is newer than their tag, other apps are deployed again when the
+// digest of their tag in the registry changes.
+//
+// Updates are deployed through the API server, so they wait for approval and freeze windows, and an image
+// that fails its health checks leaves the current deployment running. An image the watcher deployed isn't
+// deployed again, after a failure the watcher waits for the next one. Paused apps and apps with a deployment
+// in progress are left alone.
+type ImageWatcher struct {
+	cli    *client.Client
+	deploy ImageUpdateFunc
+	events *haloyevents.Broker
+
+	running sync.Mutex // Prevents passes from overlapping
+	apps    map[string]*watchedApp
+}
+
+type watchedApp struct {
+	checkedAt  time.Time // Last registry check, for the interval
+	deployedAt time.Time // Last deployment of the watcher, for the cooldown
+	// deployed is the tag or digest the watcher deployed last, so a failed image isn't deployed again.
+	deployed string
+}
+
+func NewImageWatcher(cli *client.Client, deployUpdate ImageUpdateFunc, eventBroker *haloyevents.Broker) *ImageWatcher {
+	return &ImageWatcher{
+		cli:    cli,
+		deploy: deployUpdate,
+		events: eventBroker,
+		apps:   make(map[string]*watchedApp),
+	}
+}
+
+// Watch runs a single pass, checking the registries of the apps whose interval has passed. It returns
+// immediately if another pass is still running.
+func (w *ImageWatcher) Watch(ctx context.Context, logger *slog.Logger) {
+	if !w.running.TryLock() {
+		return
+	}
+	defer w.running.Unlock()
+
+	containerList, err := docker.GetAppContainers(ctx, w.cli, false, "")
+	if err != nil {
+		logger.Error("Image watch: failed to list containers", "error", err)
+		return
+	}
+	deployingApps, err := appsWithCheckpoint()
+	if err != nil {
+		logger.Error("Image watch: failed to load deployments in progress", "error", err)
+		return
+	}
+	pausedApps, err := deploy.PausedApps()
+	if err != nil {
+		logger.Error("Image watch: failed to load paused apps", "error", err)
+		return
+	}
+
+	// The current deployment of an app is its newest one with running containers.
+	current := make(map[string]container.Summary)
+	for _, c := range containerList {
+		appName := c.Labels[config.LabelAppName]
+		if existing, ok := current[appName]; !ok ||
+			helpers.CompareDeploymentIDs(c.Labels[config.LabelDeploymentID], existing.Labels[config.LabelDeploymentID]) > 0 {
+			current[appName] = c
+		}
+	}
+
+	for _, appName := range slices.Sorted(maps.Keys(current)) {
+		_, deploying := deployingApps[appName]
+		_, paused := pausedApps[appName]
+		if appName == "" || deploying || paused {
+			continue
+		}
+
+		c := current[appName]
+		spec, err := deploy.LoadSpec(c.Labels[config.LabelDeploymentID])
+		if err != nil {
+			logger.Warn("Image watch: failed to load deployment spec", "app", appName, "error", err)
+			continue
+		}
+		if spec == nil || spec.ImageWatch == nil || spec.Image == nil {
+			delete(w.apps, appName)
+			continue
+		}
+
+		state := w.apps[appName]
+		if state == nil {
+			state = &watchedApp{}
+			w.apps[appName] = state
+		}
+		if time.Since(state.checkedAt) < spec.ImageWatch.IntervalDuration() ||
+			time.Since(state.deployedAt) < spec.ImageWatch.CooldownDuration() {
+			continue
+		}
+		state.checkedAt = time.Now()
+		w.checkApp(ctx, logger, appName, c, spec, state)
+	}
+}
+
+// checkApp deploys the new image of an app, if its registry has one.
+func (w *ImageWatcher) checkApp(ctx context.Context, logger *slog.Logger, appName string, c container.Summary,
+	spec *config.TargetConfig, state *watchedApp,
+) {
+	watch := spec.ImageWatch
+	var tag, found, digest string
+	annotations := map[string]string{}
+
+	if watch.Semver != "" {
+		tags, err := docker.ListImageTags(ctx, *spec.Image)
+		if err != nil {
+			logger.Warn("Image watch: failed to list image tags", "app", appName, "image", spec.Image.Repository, "error", err)
+			return
+		}
+		newer, ok := watch.NewerTag(tags, spec.Image.Tag)
+		if !ok {
+			return
+		}
+		tag, found = newer, newer
+		annotations["image.watch"] = watch.Semver
+	} else {
+		remoteDigest, err := docker.RemoteImageDigest(ctx, w.cli, *spec.Image)
+		if err != nil {
+			logger.Warn("Image watch: failed to check image digest", "app", appName, "image", spec.Image.ImageRef(), "error", err)
+			return
+		}
+		imageInfo, err := w.cli.ImageInspect(ctx, c.ImageID)
+		if err != nil {
+			logger.Warn("Image watch: failed to inspect image", "app", appName, "error", err)
+			return
+		}
+		for _, repoDigest := range imageInfo.RepoDigests {
+			if strings.HasSuffix(repoDigest, "@"+remoteDigest) {
+				return
+			}
+		}
+		tag, found, digest = spec.Image.Tag, remoteDigest, remoteDigest
+		annotations["image.watch"] = "digest"
+		annotations["image.digest"] = remoteDigest
+	}
+	if found == state.deployed {
+		return
+	}
+
+	result, err := w.deploy(ctx, api.ImageUpdate{
+		AppName:         appName,
+		Tag:             tag,
+		Annotations:     annotations,
+		RequireApproval: watch.RequireApproval,
+	})
+	if err != nil {
+		logger.Warn("Image watch: failed to deploy new image", "app", appName, "tag", tag, "error", err)
+		return
+	}
+	state.deployed = found
+	state.deployedAt = time.Now()
+
+	image := *spec.Image
+	image.Tag = tag
+	updated := image.ImageRef()
+	logger.Info("Image watch: found new image", "app", appName, "image", updated, "state", result.State, "deploymentID", result.DeploymentID)
+	data := map[string]any{
+		"image":       updated,
+		"previousTag": spec.Image.Tag,
+		"state":       result.State,
+	}
+	if digest != "" {
+		data["digest"] = digest
+	}
+	if result.QueuedUntil != nil {
+		data["until"] = *result.QueuedUntil
+	}
+	w.events.Publish(haloyevents.Event{
+		Type:         haloyevents.TypeImageUpdated,
+		AppName:      appName,
+		DeploymentID: result.DeploymentID,
+		Data:         data,
+	})
+}
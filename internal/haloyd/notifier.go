@@ -0,0 +1,205 @@
+package haloyd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"maps"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// Notifier emails server events that match the notification rules of the haloyd config.
+type Notifier struct {
+	config config.NotificationsConfig
+	mutex  sync.RWMutex
+	// appForDomain returns the app serving a domain, so certificate events match app rules.
+	appForDomain func(canonical string) string
+}
+
+func NewNotifier(notificationsConfig config.NotificationsConfig, appForDomain func(canonical string) string) *Notifier {
+	return &Notifier{
+		config:       notificationsConfig,
+		appForDomain: appForDomain,
+	}
+}
+
+// SetConfig replaces the SMTP settings and rules. It's applied to the next event.
+func (n *Notifier) SetConfig(notificationsConfig config.NotificationsConfig) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.config = notificationsConfig
+}
+
+// Run emails the events published on the broker until the context is canceled.
+func (n *Notifier) Run(ctx context.Context, eventBroker *events.Broker, logger *slog.Logger) {
+	eventBroker.Consume(ctx, func(event events.Event) { n.notify(event, logger) }, func() {
+		logger.Warn("Notifier fell behind on events, some notifications were not sent")
+	})
+}
+
+func (n *Notifier) notify(event events.Event, logger *slog.Logger) {
+	n.mutex.RLock()
+	notificationsConfig := n.config
+	n.mutex.RUnlock()
+
+	if !notificationsConfig.Enabled() {
+		return
+	}
+
+	appName := event.AppName
+	if appName == "" && n.appForDomain != nil {
+		if domain, ok := event.Data["domain"].(string); ok {
+			appName = n.appForDomain(domain)
+		}
+	}
+
+	recipients := make(map[string]struct{})
+	for _, rule := range notificationsConfig.Rules {
+		if len(rule.Apps) > 0 && !slices.Contains(rule.Apps, appName) {
+			continue
+		}
+		filter := events.Filter{Types: rule.EventTypes()}
+		if !filter.Match(event) {
+			continue
+		}
+		for _, address := range rule.Email {
+			recipients[address] = struct{}{}
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	to := slices.Sorted(maps.Keys(recipients))
+	go func() {
+		if err := sendMail(notificationsConfig.SMTP, to, notificationSubject(event, appName), notificationBody(event, appName)); err != nil {
+			logger.Warn("Failed to send email notification", "event", event.Type, "app", appName, "error", err)
+		}
+	}()
+}
+
+func notificationSubject(event events.Event, appName string) string {
+	switch event.Type {
+	case events.TypeDeploymentFailed:
+		return fmt.Sprintf("[haloy] Deployment of %s failed", appName)
+	case events.TypeDeploymentRollback:
+		return fmt.Sprintf("[haloy] %s is being rolled back", appName)
+	case events.TypeCertExpiring:
+		return fmt.Sprintf("[haloy] Certificate of %v expires soon", event.Data["domain"])
+	case events.TypeImageUpdated:
+		return fmt.Sprintf("[haloy] New image %v for %s", event.Data["image"], appName)
+	}
+	if appName != "" {
+		return fmt.Sprintf("[haloy] %s: %s", event.Type, appName)
+	}
+	return fmt.Sprintf("[haloy] %s", event.Type)
+}
+
+func notificationBody(event events.Event, appName string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Event: %s\n", event.Type)
+	fmt.Fprintf(&b, "Time: %s\n", event.Timestamp.UTC().Format(time.RFC1123))
+	if hostname, err := os.Hostname(); err == nil {
+		fmt.Fprintf(&b, "Server: %s\n", hostname)
+	}
+	if appName != "" {
+		fmt.Fprintf(&b, "App: %s\n", appName)
+	}
+	if event.DeploymentID != "" {
+		fmt.Fprintf(&b, "Deployment: %s\n", event.DeploymentID)
+	}
+	if event.CorrelationID != "" {
+		fmt.Fprintf(&b, "Correlation ID: %s\n", event.CorrelationID)
+	}
+	for _, key := range slices.Sorted(maps.Keys(event.Data)) {
+		fmt.Fprintf(&b, "%s: %v\n", key, event.Data[key])
+	}
+	return b.String()
+}
+
+// sendMail sends a plain text email. Port 465 uses TLS from the start, other ports upgrade
+// the connection with STARTTLS when the server supports it.
+func sendMail(smtpConfig config.SMTPConfig, to []string, subject, body string) error {
+	port := smtpConfig.SMTPPort()
+	address := net.JoinHostPort(smtpConfig.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: smtpConfig.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, smtpConfig.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if port != 465 {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		}
+	}
+	if smtpConfig.Username != "" {
+		auth := smtp.PlainAuth("", smtpConfig.Username, os.Getenv("HALOY_SMTP_PASSWORD"), smtpConfig.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := c.Mail(smtpConfig.From); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range to {
+		if err := c.Rcpt(recipient); err != nil {
+			return fmt.Errorf("RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %w", err)
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", smtpConfig.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if _, err := w.Write([]byte(message.String())); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return c.Quit()
+}
@@ -0,0 +1,46 @@
+package haloyd
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/events"
+	"github.com/docker/docker/client"
+)
+
+// ProxyBackend is the reverse proxy that routes traffic to the deployments, selected with proxy.backend
+// in the haloyd config. HAProxy is the default, see HAProxyManager and CaddyManager.
+type ProxyBackend interface {
+	// Name is the value of proxy.backend, e.g. haproxy.
+	Name() string
+	// ManagesCertificates reports whether the proxy obtains the TLS certificates itself. haloyd doesn't
+	// request certificates for the app domains then.
+	ManagesCertificates() bool
+	// GenerateConfig renders the proxy config for the deployments without applying it.
+	GenerateConfig(deployments map[string]Deployment) ([]byte, error)
+	// Apply writes the config for the deployments and reloads the proxy. Writing and reloading is skipped
+	// when the config is unchanged, unless forceReload is set, e.g. because certificates were renewed.
+	Apply(ctx context.Context, logger *slog.Logger, deployments map[string]Deployment, forceReload bool) error
+	// Reload makes the proxy load the config file on disk.
+	Reload(ctx context.Context, logger *slog.Logger) error
+	// PreviewConfig returns the applied config and the config the proxy would get if the app in labels was
+	// deployed with the given number of replicas.
+	PreviewConfig(deployments map[string]Deployment, labels *config.ContainerLabels, replicas int) (string, string, error)
+	// AppliedDeploymentID returns the deployment of an app that the proxy was last configured to route to.
+	AppliedDeploymentID(appName string) (string, bool)
+	// RepairConfig rewrites and reloads the config file when it no longer matches the applied config.
+	RepairConfig(ctx context.Context, logger *slog.Logger) (bool, error)
+	// EnsureContainer starts or recreates the proxy container when it's stopped, unhealthy or missing.
+	EnsureContainer(ctx context.Context, logger *slog.Logger) (string, bool, error)
+	// SetHaloydConfig replaces the haloyd config used to generate the config. It's applied on the next update.
+	SetHaloydConfig(haloydConfig *config.HaloydConfig)
+}
+
+// NewProxyBackend returns the proxy backend selected in the haloyd config.
+func NewProxyBackend(cli *client.Client, haloydConfig *config.HaloydConfig, dataDir string, debug bool, eventBroker *events.Broker) ProxyBackend {
+	if haloydConfig != nil && haloydConfig.Proxy.Backend == config.ProxyBackendCaddy {
+		return NewCaddyManager(cli, haloydConfig, dataDir, debug, eventBroker)
+	}
+	return NewHAProxyManager(cli, haloydConfig, dataDir, debug, eventBroker)
+}
@@ -0,0 +1,231 @@
+package haloyd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// proxyStartWait is how long a starting or restarting proxy container is given before it's recreated.
+const proxyStartWait = 10 * time.Second
+
+// proxyContainer manages the container of a proxy backend, e.g. haloy-haproxy.
+type proxyContainer struct {
+	cli  *client.Client
+	name string // Container name
+	role string // Value of the role label
+	// defaultConfig returns the configuration of a new container, used when there's no container to copy it from.
+	defaultConfig func(ctx context.Context) (*container.Config, *container.HostConfig, error)
+}
+
+// runningID returns the ID of the running proxy container. A container that is starting, e.g. after
+// a Docker restart, is given a few seconds, after that a stopped, unhealthy or missing container is started
+// or recreated with ensure.
+func (pc proxyContainer) runningID(ctx context.Context, logger *slog.Logger) (string, error) {
+	filtersArgs := filters.NewArgs()
+	filtersArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelRole, pc.role))
+	filtersArgs.Add("status", "running") // Only consider running containers
+
+	deadline := time.Now().Add(proxyStartWait)
+	for {
+		containers, err := pc.cli.ContainerList(ctx, container.ListOptions{
+			Filters: filtersArgs,
+			Limit:   1, // We only expect one proxy container managed by haloy
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list containers with label %s=%s: %w", config.LabelRole, pc.role, err)
+		}
+		if len(containers) > 0 {
+			return containers[0].ID, nil
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("context canceled while waiting for %s container: %w", pc.name, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	logger.Info("Proxy container is not running after waiting, starting or recreating it", "container", pc.name, "waited", proxyStartWait)
+	id, _, err := pc.ensure(ctx, logger)
+	return id, err
+}
+
+// ensure makes sure the proxy container is running and returns its ID. A stopped container is started
+// again. A container that can't be started, is dead or keeps failing its health check is replaced by a
+// new one with the same configuration, and a missing container is created with the mounts, ports and
+// labels haloyadm uses. It reports whether the container was started or recreated.
+func (pc proxyContainer) ensure(ctx context.Context, logger *slog.Logger) (string, bool, error) {
+	existing, err := pc.find(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	if existing == nil {
+		logger.Warn("Proxy container is missing, creating it", "container", pc.name)
+		id, err := pc.create(ctx, nil)
+		return id, err == nil, err
+	}
+
+	state := existing.State
+	switch {
+	case state.Running && !state.Restarting && (state.Health == nil || state.Health.Status != container.Unhealthy):
+		return existing.ID, false, nil
+
+	case state.Restarting || (state.Running && state.Health != nil && state.Health.Status == container.Unhealthy):
+		// Docker restarts failing containers by itself, they are only replaced when they don't recover.
+		if since, err := time.Parse(time.RFC3339Nano, state.StartedAt); err == nil && time.Since(since) < proxyStartWait {
+			return existing.ID, false, nil
+		}
+		logger.Warn("Proxy container is not healthy, recreating it",
+			"container", pc.name, "containerID", helpers.SafeIDPrefix(existing.ID), "status", state.Status)
+
+	case state.Dead:
+		logger.Warn("Proxy container is dead, recreating it", "container", pc.name, "containerID", helpers.SafeIDPrefix(existing.ID))
+
+	default:
+		logger.Warn("Proxy container is not running, starting it",
+			"container", pc.name, "containerID", helpers.SafeIDPrefix(existing.ID), "status", state.Status)
+		err := pc.cli.ContainerStart(ctx, existing.ID, container.StartOptions{})
+		if err == nil {
+			return existing.ID, true, nil
+		}
+		logger.Warn("Failed to start proxy container, recreating it", "container", pc.name, "error", err)
+	}
+
+	if err := pc.cli.ContainerRemove(ctx, existing.ID, container.RemoveOptions{Force: true}); err != nil {
+		return "", false, fmt.Errorf("failed to remove %s container %s: %w", pc.name, helpers.SafeIDPrefix(existing.ID), err)
+	}
+	id, err := pc.create(ctx, existing)
+	return id, err == nil, err
+}
+
+// find returns the proxy container, running or not, or nil if there's none.
+func (pc proxyContainer) find(ctx context.Context) (*container.InspectResponse, error) {
+	filtersArgs := filters.NewArgs()
+	filtersArgs.Add("label", fmt.Sprintf("%s=%s", config.LabelRole, pc.role))
+
+	containers, err := pc.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: filtersArgs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers with label %s=%s: %w", config.LabelRole, pc.role, err)
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+
+	// Prefer a running container in case a replaced one was left behind.
+	slices.SortStableFunc(containers, func(a, b container.Summary) int {
+		if a.State == b.State {
+			return 0
+		}
+		if a.State == "running" {
+			return -1
+		}
+		return 1
+	})
+	inspect, err := pc.cli.ContainerInspect(ctx, containers[0].ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect %s container %s: %w", pc.name, helpers.SafeIDPrefix(containers[0].ID), err)
+	}
+	return &inspect, nil
+}
+
+// create creates and starts the proxy container. The configuration of the previous container is
+// reused when there is one, so options set by haloyadm are kept.
+func (pc proxyContainer) create(ctx context.Context, previous *container.InspectResponse) (string, error) {
+	var containerConfig *container.Config
+	var hostConfig *container.HostConfig
+	if previous != nil && previous.Config != nil && previous.HostConfig != nil {
+		previousConfig := *previous.Config
+		previousConfig.Hostname = ""
+		containerConfig = &previousConfig
+		hostConfig = previous.HostConfig
+	} else {
+		var err error
+		containerConfig, hostConfig, err = pc.defaultConfig(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			constants.DockerNetwork: {},
+		},
+	}
+	createResponse, err := pc.cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, pc.name)
+	if client.IsErrNotFound(err) {
+		// The image was removed, e.g. by a manual prune.
+		if pullErr := pc.pullImage(ctx, containerConfig.Image); pullErr != nil {
+			return "", pullErr
+		}
+		createResponse, err = pc.cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, pc.name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s container: %w", pc.name, err)
+	}
+	if err := pc.cli.ContainerStart(ctx, createResponse.ID, container.StartOptions{}); err != nil {
+		pc.cli.ContainerRemove(ctx, createResponse.ID, container.RemoveOptions{Force: true})
+		return "", fmt.Errorf("failed to start %s container: %w", pc.name, err)
+	}
+	return createResponse.ID, nil
+}
+
+func (pc proxyContainer) pullImage(ctx context.Context, imageRef string) error {
+	reader, err := pc.cli.ImagePull(ctx, imageRef, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", imageRef, err)
+	}
+	defer reader.Close()
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", imageRef, err)
+	}
+	return nil
+}
+
+// proxyPortBindings publishes the ports of the proxy config like haloyadm does. The slirp4netns port
+// driver of rootless Docker only forwards IPv4, so ports are then bound to 0.0.0.0 instead of all addresses.
+func proxyPortBindings(ctx context.Context, cli *client.Client, proxyConfig config.ProxyConfig) (nat.PortSet, nat.PortMap, error) {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get Docker daemon info: %w", err)
+	}
+	publishAddress := ""
+	if slices.ContainsFunc(info.SecurityOptions, func(option string) bool { return strings.Contains(option, "name=rootless") }) {
+		publishAddress = "0.0.0.0"
+	}
+
+	exposedPorts := nat.PortSet{}
+	portBindings := nat.PortMap{}
+	publish := func(address string, port int) {
+		if address == "" {
+			address = publishAddress
+		}
+		containerPort := nat.Port(strconv.Itoa(port) + "/tcp")
+		exposedPorts[containerPort] = struct{}{}
+		portBindings[containerPort] = append(portBindings[containerPort], nat.PortBinding{HostIP: address, HostPort: strconv.Itoa(port)})
+	}
+	publish("", proxyConfig.HTTPPort)
+	publish("", proxyConfig.HTTPSPort)
+	for _, frontend := range proxyConfig.Frontends {
+		publish(frontend.Address, frontend.Port)
+	}
+	return exposedPorts, portBindings, nil
+}
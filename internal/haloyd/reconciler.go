@@ -0,0 +1,253 @@
+package haloyd
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	haloyevents "github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Containers that don't stay up after this many restarts are left stopped.
+const maxRestartAttempts = 3
+
+// Corrections reported in the data of reconcile.fixed events.
+const (
+	reconcileActionContainerRestarted = "container.restarted"
+	reconcileActionContainerRemoved   = "container.removed"
+	reconcileActionSidecarRemoved     = "sidecar.removed"
+	reconcileActionReplicaRestored    = "replica.restored"
+	reconcileActionHAProxyRepaired    = "haproxy.repaired"
+	reconcileActionHAProxyRestarted   = "haproxy.restarted"
+)
+
+// Reconciler compares the containers in Docker to the stored deployment specs and corrects drift:
+// stopped or missing replicas of the current deployment are brought back, containers left over from
+// other deployments are removed, and the proxy container and its config on disk are restored.
+//
+// The current deployment of an app is the one the proxy routes to. Apps with no running container in their
+// current deployment are considered stopped and left alone, as are paused apps and apps with a deployment in progress.
+type Reconciler struct {
+	cli    *client.Client
+	proxy  ProxyBackend
+	events *haloyevents.Broker
+
+	running         sync.Mutex     // Prevents passes from overlapping
+	restartAttempts map[string]int // Restarts per container ID, so failing containers aren't restarted forever
+}
+
+func NewReconciler(cli *client.Client, proxy ProxyBackend, eventBroker *haloyevents.Broker) *Reconciler {
+	return &Reconciler{
+		cli:             cli,
+		proxy:           proxy,
+		events:          eventBroker,
+		restartAttempts: make(map[string]int),
+	}
+}
+
+// Reconcile runs a single reconciliation pass. It returns immediately if another pass is still running.
+func (r *Reconciler) Reconcile(ctx context.Context, logger *slog.Logger) {
+	if !r.running.TryLock() {
+		return
+	}
+	defer r.running.Unlock()
+
+	containerList, err := docker.GetAppContainers(ctx, r.cli, true, "")
+	if err != nil {
+		logger.Error("Reconcile: failed to list containers", "error", err)
+		return
+	}
+
+	// Loaded after listing the containers, deployments save their checkpoint before creating any container.
+	deployingApps, err := appsWithCheckpoint()
+	if err != nil {
+		logger.Error("Reconcile: failed to load deployments in progress", "error", err)
+		return
+	}
+
+	// Paused apps are stopped on purpose and left alone until they're resumed.
+	pausedApps, err := deploy.PausedApps()
+	if err != nil {
+		logger.Error("Reconcile: failed to load paused apps", "error", err)
+		return
+	}
+
+	appContainers := make(map[string][]container.Summary)
+	for _, c := range containerList {
+		appName := c.Labels[config.LabelAppName]
+		appContainers[appName] = append(appContainers[appName], c)
+	}
+
+	seen := make(map[string]struct{})
+	for _, appName := range slices.Sorted(maps.Keys(appContainers)) {
+		for _, c := range appContainers[appName] {
+			seen[c.ID] = struct{}{}
+		}
+		if _, deploying := deployingApps[appName]; appName == "" || deploying {
+			continue
+		}
+		if _, paused := pausedApps[appName]; paused {
+			continue
+		}
+		r.reconcileApp(ctx, logger, appName, appContainers[appName])
+	}
+	for id := range r.restartAttempts {
+		if _, ok := seen[id]; !ok {
+			delete(r.restartAttempts, id)
+		}
+	}
+
+	proxyID, restarted, err := r.proxy.EnsureContainer(ctx, logger)
+	if err != nil {
+		logger.Error("Reconcile: failed to restore the proxy container", "error", err)
+	} else if restarted {
+		r.publish("", "", reconcileActionHAProxyRestarted, proxyID)
+	}
+
+	repaired, err := r.proxy.RepairConfig(ctx, logger)
+	if err != nil {
+		logger.Warn("Reconcile: failed to repair proxy config", "error", err)
+	} else if repaired {
+		r.publish("", "", reconcileActionHAProxyRepaired, "")
+	}
+}
+
+func (r *Reconciler) reconcileApp(ctx context.Context, logger *slog.Logger, appName string, containers []container.Summary) {
+	// The deployment the proxy routes to is the current one. A failed deployment can leave newer containers
+	// running, they are removed while the previous deployment keeps serving traffic.
+	currentDeploymentID, ok := r.proxy.AppliedDeploymentID(appName)
+	if !ok {
+		return
+	}
+
+	var current []container.Summary
+	running := false
+	for _, c := range containers {
+		if c.Labels[config.LabelDeploymentID] == currentDeploymentID {
+			current = append(current, c)
+			running = running || c.State == "running"
+		}
+	}
+	if !running {
+		return
+	}
+
+	for _, c := range containers {
+		deploymentID := c.Labels[config.LabelDeploymentID]
+		if deploymentID == currentDeploymentID {
+			continue
+		}
+		if err := r.cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Warn("Reconcile: failed to remove container", "app", appName, "container_id", helpers.SafeIDPrefix(c.ID), "error", err)
+			continue
+		}
+		logger.Info("Reconcile: removed container of another deployment",
+			"app", appName, "deployment_id", deploymentID, "container_id", helpers.SafeIDPrefix(c.ID))
+		r.publish(appName, deploymentID, reconcileActionContainerRemoved, c.ID)
+	}
+
+	removedSidecars, err := docker.RemoveSidecars(ctx, r.cli, logger, appName, currentDeploymentID)
+	if err != nil {
+		logger.Warn("Reconcile: failed to remove sidecars", "app", appName, "error", err)
+	}
+	for _, id := range removedSidecars {
+		logger.Info("Reconcile: removed sidecar of another deployment", "app", appName, "container_id", helpers.SafeIDPrefix(id))
+		r.publish(appName, "", reconcileActionSidecarRemoved, id)
+	}
+
+	var source container.Summary
+	replicas := make(map[int]struct{})
+	for _, c := range current {
+		replicas[docker.ReplicaID(c)] = struct{}{}
+		switch c.State {
+		case "running":
+			source = c
+		case "exited", "created":
+			r.restartContainer(ctx, logger, appName, currentDeploymentID, c)
+		}
+	}
+
+	spec, err := deploy.LoadSpec(currentDeploymentID)
+	if err != nil {
+		logger.Warn("Reconcile: failed to load deployment spec", "app", appName, "error", err)
+		return
+	}
+	// Deployments made before specs were stored can't be checked for missing replicas.
+	if spec == nil || spec.Replicas == nil || len(replicas) >= *spec.Replicas {
+		return
+	}
+	desired := *spec.Replicas
+	sourceInfo, err := r.cli.ContainerInspect(ctx, source.ID)
+	if err != nil {
+		logger.Warn("Reconcile: failed to inspect container", "app", appName, "container_id", helpers.SafeIDPrefix(source.ID), "error", err)
+		return
+	}
+	for replica := 1; replica <= desired; replica++ {
+		if _, ok := replicas[replica]; ok {
+			continue
+		}
+		id, err := docker.CloneReplica(ctx, r.cli, sourceInfo, replica)
+		if err != nil {
+			logger.Warn("Reconcile: failed to restore replica", "app", appName, "replica", replica, "error", err)
+			continue
+		}
+		logger.Info("Reconcile: restored missing replica", "app", appName, "replica", replica, "container_id", helpers.SafeIDPrefix(id))
+		r.publish(appName, currentDeploymentID, reconcileActionReplicaRestored, id)
+	}
+}
+
+func (r *Reconciler) restartContainer(ctx context.Context, logger *slog.Logger, appName, deploymentID string, c container.Summary) {
+	if r.restartAttempts[c.ID] >= maxRestartAttempts {
+		return
+	}
+	r.restartAttempts[c.ID]++
+
+	if err := r.cli.ContainerStart(ctx, c.ID, container.StartOptions{}); err != nil {
+		logger.Warn("Reconcile: failed to restart container", "app", appName, "container_id", helpers.SafeIDPrefix(c.ID), "error", err)
+		return
+	}
+	logger.Info("Reconcile: restarted stopped container", "app", appName, "container_id", helpers.SafeIDPrefix(c.ID))
+	r.publish(appName, deploymentID, reconcileActionContainerRestarted, c.ID)
+}
+
+func (r *Reconciler) publish(appName, deploymentID, action, containerID string) {
+	data := map[string]any{"action": action}
+	if containerID != "" {
+		data["containerID"] = containerID
+	}
+	r.events.Publish(haloyevents.Event{
+		Type:         haloyevents.TypeReconcileFixed,
+		AppName:      appName,
+		DeploymentID: deploymentID,
+		Data:         data,
+	})
+}
+
+// appsWithCheckpoint returns the apps that have a deployment in progress.
+func appsWithCheckpoint() (map[string]struct{}, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	checkpoints, err := db.GetCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make(map[string]struct{}, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		apps[checkpoint.AppName] = struct{}{}
+	}
+	return apps, nil
+}
@@ -0,0 +1,168 @@
+package haloyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/deploy"
+	"github.com/ameistad/haloy/internal/docker"
+	haloyevents "github.com/ameistad/haloy/internal/events"
+	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/storage"
+	"github.com/ameistad/haloy/internal/tracing"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Deployments interrupted longer ago than this are not restarted, only rolled back.
+const deploymentResumeWindow = time.Hour
+
+// recoverDeployments handles the deployments that were in progress when haloyd stopped. Deployments that
+// already created their containers are handed to the coalescer to switch traffic, the rest are rolled back
+// and deployed again from their checkpoint.
+func recoverDeployments(
+	ctx context.Context,
+	cli *client.Client,
+	coalescer *updateCoalescer,
+	eventBroker *haloyevents.Broker,
+	logLevel slog.Level,
+	logBroker logging.StreamPublisher,
+	logger *slog.Logger,
+) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Error("Failed to load deployment checkpoints", "error", err)
+		return
+	}
+	checkpoints, err := db.GetCheckpoints()
+	db.Close()
+	if err != nil {
+		logger.Error("Failed to load deployment checkpoints", "error", err)
+		return
+	}
+
+	for _, checkpoint := range checkpoints {
+		deploymentLogger := logging.NewDeploymentLogger(checkpoint.DeploymentID, logLevel, logBroker)
+		logger.Info("Recovering interrupted deployment",
+			"app", checkpoint.AppName,
+			"deploymentID", checkpoint.DeploymentID,
+			"step", checkpoint.Step)
+
+		containers, err := deploymentContainers(ctx, cli, checkpoint.AppName, checkpoint.DeploymentID)
+		if err != nil {
+			failRecoveredDeployment(checkpoint, err, eventBroker, deploymentLogger)
+			continue
+		}
+
+		if checkpoint.Step == logging.StepTraffic {
+			if de, ok := recoveredAppEvent(ctx, cli, containers); ok {
+				coalescer.add(de)
+				continue
+			}
+		}
+
+		for _, c := range containers {
+			if err := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}); err != nil {
+				logger.Warn("Failed to remove container of interrupted deployment",
+					"containerID", helpers.SafeIDPrefix(c.ID), "error", err)
+			}
+		}
+		docker.RemoveDeploymentSidecars(ctx, cli, logger, checkpoint.AppName, checkpoint.DeploymentID)
+
+		if time.Since(checkpoint.UpdatedAt) > deploymentResumeWindow {
+			failRecoveredDeployment(checkpoint, fmt.Errorf("deployment was interrupted at step %q", checkpoint.Step), eventBroker, deploymentLogger)
+			continue
+		}
+
+		var targetConfig config.TargetConfig
+		var rawAppConfig config.AppConfig
+		if err := json.Unmarshal(checkpoint.TargetConfig, &targetConfig); err != nil {
+			failRecoveredDeployment(checkpoint, fmt.Errorf("failed to parse checkpoint: %w", err), eventBroker, deploymentLogger)
+			continue
+		}
+		if err := json.Unmarshal(checkpoint.RawAppConfig, &rawAppConfig); err != nil {
+			failRecoveredDeployment(checkpoint, fmt.Errorf("failed to parse checkpoint: %w", err), eventBroker, deploymentLogger)
+			continue
+		}
+
+		go func() {
+			deploymentCtx, cancel := context.WithTimeout(ctx, updateTimeout)
+			defer cancel()
+
+			deploymentLogger.Info("Restarting deployment interrupted by haloyd restart")
+			if err := deploy.DeployApp(deploymentCtx, cli, checkpoint.DeploymentID, targetConfig, rawAppConfig, deploymentLogger); err != nil {
+				logging.LogDeploymentFailed(deploymentLogger, checkpoint.DeploymentID, checkpoint.AppName, "Deployment failed", err)
+				tracing.EndDeployment(checkpoint.DeploymentID, err)
+				eventBroker.Publish(haloyevents.Event{
+					Type:         haloyevents.TypeDeploymentFailed,
+					AppName:      checkpoint.AppName,
+					DeploymentID: checkpoint.DeploymentID,
+					Data:         map[string]any{"error": err.Error()},
+				})
+			}
+		}()
+	}
+}
+
+// deploymentContainers returns all app containers belonging to a single deployment, including stopped ones.
+func deploymentContainers(ctx context.Context, cli *client.Client, appName, deploymentID string) ([]container.Summary, error) {
+	containerList, err := docker.GetAppContainers(ctx, cli, true, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []container.Summary
+	for _, c := range containerList {
+		if c.Labels[config.LabelDeploymentID] == deploymentID {
+			containers = append(containers, c)
+		}
+	}
+	return containers, nil
+}
+
+// recoveredAppEvent builds the app event for a deployment whose containers are all running, as if
+// their start event had just been received.
+func recoveredAppEvent(ctx context.Context, cli *client.Client, containers []container.Summary) (debouncedAppEvent, bool) {
+	if len(containers) == 0 {
+		return debouncedAppEvent{}, false
+	}
+	for _, c := range containers {
+		if c.State != "running" {
+			return debouncedAppEvent{}, false
+		}
+	}
+
+	inspect, err := cli.ContainerInspect(ctx, containers[0].ID)
+	if err != nil {
+		return debouncedAppEvent{}, false
+	}
+	labels, err := config.ParseContainerLabels(inspect.Config.Labels)
+	if err != nil {
+		return debouncedAppEvent{}, false
+	}
+
+	return debouncedAppEvent{
+		AppName:            labels.AppName,
+		DeploymentID:       labels.DeploymentID,
+		Domains:            labels.Domains,
+		EventAction:        "start",
+		CapturedStartEvent: true,
+		IsOnNetwork:        isOnNetwork(inspect),
+	}, true
+}
+
+func failRecoveredDeployment(checkpoint storage.DeploymentCheckpoint, err error, eventBroker *haloyevents.Broker, deploymentLogger *slog.Logger) {
+	logging.LogDeploymentFailed(deploymentLogger, checkpoint.DeploymentID, checkpoint.AppName, "Deployment interrupted by haloyd restart", err)
+	deploy.ClearCheckpoint(checkpoint.DeploymentID, deploymentLogger)
+	eventBroker.Publish(haloyevents.Event{
+		Type:         haloyevents.TypeDeploymentFailed,
+		AppName:      checkpoint.AppName,
+		DeploymentID: checkpoint.DeploymentID,
+		Data:         map[string]any{"error": err.Error()},
+	})
+}
@@ -0,0 +1,154 @@
+package haloyd
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ameistad/haloy/internal/apitypes"
+	"github.com/ameistad/haloy/internal/config"
+)
+
+const (
+	// SystemDomainRoleAPI is the domain of the haloyd API, set with api.domain in the haloyd config.
+	SystemDomainRoleAPI = "api"
+
+	SystemDomainStatusPending = "pending"
+	SystemDomainStatusValid   = "valid"
+	SystemDomainStatusFailed  = "failed"
+
+	systemRefreshDebounceKey = "system_domains_refresh"
+	// Failed system domains are retried at most this often, so updates don't hit the CA rate limits.
+	systemDomainRetryInterval = 10 * time.Minute
+)
+
+// SystemDomain is a domain served by haloyd itself rather than by a deployed app. Its certificate is
+// managed separately from the app domains, so a failing app domain never holds it back and the other way round.
+type SystemDomain struct {
+	Role string
+	CertificatesDomain
+}
+
+// systemDomains returns the system domains set in the haloyd config.
+func systemDomains(haloydConfig *config.HaloydConfig) []SystemDomain {
+	if haloydConfig == nil || haloydConfig.Certificates.AcmeEmail == "" {
+		return nil
+	}
+
+	var domains []SystemDomain
+	if haloydConfig.API.Domain != "" {
+		domains = append(domains, SystemDomain{
+			Role: SystemDomainRoleAPI,
+			CertificatesDomain: CertificatesDomain{
+				Canonical: haloydConfig.API.Domain,
+				Aliases:   []string{},
+				Email:     haloydConfig.Certificates.AcmeEmail,
+				Staging:   haloydConfig.Certificates.Staging,
+				KeyType:   haloydConfig.Certificates.KeyType,
+			},
+		})
+	}
+	return domains
+}
+
+// systemDomainState is the renewal state of a system domain, by role.
+type systemDomainState struct {
+	domain      SystemDomain
+	status      string
+	lastAttempt time.Time
+	lastError   string
+}
+
+// RefreshSystemDomains obtains or renews the certificates of the system domains, each on its own so one
+// failure doesn't hold back the others. Failures are logged as errors and reported by SystemDomainStatuses.
+// It reports whether a certificate was obtained.
+func (cm *CertificatesManager) RefreshSystemDomains(logger *slog.Logger, domains []SystemDomain) (renewed bool) {
+	cm.systemMutex.Lock()
+	configured := make(map[string]bool, len(domains))
+	var due []SystemDomain
+	for _, domain := range domains {
+		configured[domain.Role] = true
+		state, ok := cm.systemDomains[domain.Role]
+		if !ok || state.domain.Canonical != domain.Canonical {
+			state = &systemDomainState{domain: domain, status: SystemDomainStatusPending}
+			cm.systemDomains[domain.Role] = state
+		}
+		state.domain = domain
+		if state.status == SystemDomainStatusFailed && time.Since(state.lastAttempt) < systemDomainRetryInterval {
+			continue
+		}
+		due = append(due, domain)
+	}
+	for role := range cm.systemDomains {
+		if !configured[role] {
+			delete(cm.systemDomains, role)
+		}
+	}
+	cm.systemMutex.Unlock()
+
+	for _, domain := range due {
+		renewedDomains, err := cm.checkRenewals(logger, []CertificatesDomain{domain.CertificatesDomain})
+
+		cm.systemMutex.Lock()
+		if state, ok := cm.systemDomains[domain.Role]; ok && state.domain.Canonical == domain.Canonical {
+			state.lastAttempt = time.Now()
+			if err != nil {
+				state.status = SystemDomainStatusFailed
+				state.lastError = err.Error()
+			} else {
+				state.status = SystemDomainStatusValid
+				state.lastError = ""
+			}
+		}
+		cm.systemMutex.Unlock()
+
+		if err != nil {
+			logger.Error("Failed to obtain certificate for system domain, it's served without a valid certificate until this is fixed",
+				"role", domain.Role,
+				"domain", domain.Canonical,
+				"retryIn", systemDomainRetryInterval,
+				"error", err)
+			continue
+		}
+		renewed = renewed || len(renewedDomains) > 0
+	}
+	return renewed
+}
+
+// RefreshSystemDomainsAsync refreshes the system domains in the background and signals the update channel
+// when a certificate was obtained, so HAProxy is reloaded with it.
+func (cm *CertificatesManager) RefreshSystemDomainsAsync(logger *slog.Logger, domains []SystemDomain) {
+	cm.debouncer.Debounce(systemRefreshDebounceKey, func() {
+		if cm.RefreshSystemDomains(logger, domains) && cm.updateSignal != nil {
+			cm.updateSignal <- "system_domains_renewed"
+		}
+	})
+}
+
+// SystemDomainStatuses returns the certificate state of the system domains, sorted by role.
+func (cm *CertificatesManager) SystemDomainStatuses() []apitypes.SystemDomainStatus {
+	cm.systemMutex.Lock()
+	defer cm.systemMutex.Unlock()
+
+	statuses := make([]apitypes.SystemDomainStatus, 0, len(cm.systemDomains))
+	for role, state := range cm.systemDomains {
+		status := apitypes.SystemDomainStatus{
+			Role:   role,
+			Domain: state.domain.Canonical,
+			Status: state.status,
+			Error:  state.lastError,
+		}
+		if !state.lastAttempt.IsZero() {
+			lastAttempt := state.lastAttempt
+			status.LastAttempt = &lastAttempt
+		}
+		if notAfter, err := cm.certificateExpiry(state.domain.Canonical); err == nil {
+			status.NotAfter = &notAfter
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Role < statuses[j].Role
+	})
+	return statuses
+}
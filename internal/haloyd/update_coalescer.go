@@ -0,0 +1,54 @@
+package haloyd
+
+import (
+	"sync"
+	"time"
+)
+
+// updateCoalescer batches debounced app events so apps deploying at the same time are handled by
+// a single update, i.e. one BuildDeployments pass and one HAProxy reload. Events arriving while
+// an update runs are collected for the next one.
+type updateCoalescer struct {
+	mu      sync.Mutex
+	pending []debouncedAppEvent
+	running bool
+	window  time.Duration
+	run     func(batch []debouncedAppEvent)
+}
+
+func newUpdateCoalescer(window time.Duration, run func(batch []debouncedAppEvent)) *updateCoalescer {
+	return &updateCoalescer{
+		window: window,
+		run:    run,
+	}
+}
+
+func (c *updateCoalescer) add(event debouncedAppEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(c.pending, event)
+	if !c.running {
+		c.running = true
+		go c.loop()
+	}
+}
+
+func (c *updateCoalescer) loop() {
+	for {
+		// Wait briefly so events of apps deployed together end up in the same batch.
+		time.Sleep(c.window)
+
+		c.mu.Lock()
+		batch := c.pending
+		c.pending = nil
+		if len(batch) == 0 {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		c.run(batch)
+	}
+}
@@ -2,31 +2,49 @@ package haloyd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ameistad/haloy/internal/config"
 	"github.com/ameistad/haloy/internal/docker"
+	haloyevents "github.com/ameistad/haloy/internal/events"
 	"github.com/ameistad/haloy/internal/helpers"
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/ameistad/haloy/internal/tracing"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ErrDockerUnavailable is returned by Update when the Docker daemon can't be reached, e.g. while it restarts.
+// The deployments are resynced once the daemon is back.
+var ErrDockerUnavailable = errors.New("docker daemon unavailable")
+
 type Updater struct {
 	cli               *client.Client
 	deploymentManager *DeploymentManager
 	certManager       *CertificatesManager
-	haproxyManager    *HAProxyManager
+	proxy             ProxyBackend
+	externalLB        *ExternalLB // nil when no external load balancer is configured
+	events            *haloyevents.Broker
+	updateMutex       sync.Mutex // Serializes updates so each one sees the changes of the previous one
+	// Set once the initial update has finished, see ProxyConfigApplied.
+	initialized atomic.Bool
 }
 
 type UpdaterConfig struct {
 	Cli               *client.Client
 	DeploymentManager *DeploymentManager
 	CertManager       *CertificatesManager
-	HAProxyManager    *HAProxyManager
+	Proxy             ProxyBackend
+	ExternalLB        *ExternalLB
+	Events            *haloyevents.Broker
 }
 
 func NewUpdater(config UpdaterConfig) *Updater {
@@ -34,7 +52,9 @@ func NewUpdater(config UpdaterConfig) *Updater {
 		cli:               config.Cli,
 		deploymentManager: config.DeploymentManager,
 		certManager:       config.CertManager,
-		haproxyManager:    config.HAProxyManager,
+		proxy:             config.Proxy,
+		externalLB:        config.ExternalLB,
+		events:            config.Events,
 	}
 }
 
@@ -43,6 +63,14 @@ type TriggeredByApp struct {
 	domains           []config.Domain
 	deploymentID      string
 	dockerEventAction events.Action // Action that triggered the update (e.g., "start", "stop", etc.)
+	logger            *slog.Logger  // Deployment logger streaming to the client, falls back to the update logger
+}
+
+func (tba *TriggeredByApp) log(fallback *slog.Logger) *slog.Logger {
+	if tba.logger != nil {
+		return tba.logger
+	}
+	return fallback
 }
 
 func (tba *TriggeredByApp) Validate() error {
@@ -69,9 +97,12 @@ func (tba *TriggeredByApp) Validate() error {
 type TriggerReason int
 
 const (
-	TriggerReasonInitial    TriggerReason = iota // Initial update at startup
-	TriggerReasonAppUpdated                      // An app container was stopped, killed or removed
-	TriggerPeriodicRefresh                       // Periodic refresh (e.g., every 5 minutes)
+	TriggerReasonInitial     TriggerReason = iota // Initial update at startup
+	TriggerReasonAppUpdated                       // An app container was stopped, killed or removed
+	TriggerPeriodicRefresh                        // Periodic refresh (e.g., every 5 minutes)
+	TriggerConfigReloaded                         // The haloyd config file changed
+	TriggerRoutingChanged                         // Routing state changed through the API, e.g. an A/B test started
+	TriggerDockerReconnected                      // The Docker daemon is reachable again after a restart
 )
 
 func (r TriggerReason) String() string {
@@ -82,15 +113,33 @@ func (r TriggerReason) String() string {
 		return "app updated"
 	case TriggerPeriodicRefresh:
 		return "periodic refresh"
+	case TriggerConfigReloaded:
+		return "config reloaded"
+	case TriggerRoutingChanged:
+		return "routing changed"
+	case TriggerDockerReconnected:
+		return "docker reconnected"
 	default:
 		return "unknown"
 	}
 }
 
-func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason TriggerReason, app *TriggeredByApp) error {
+// Update rebuilds the deployments and applies them to the proxy. Apps whose events triggered the
+// update are passed in apps, so several apps deploying at the same time share a single pass.
+// Old containers of the apps are removed once the new configuration is applied.
+func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason TriggerReason, apps []*TriggeredByApp) error {
+	u.updateMutex.Lock()
+	defer u.updateMutex.Unlock()
+	if reason == TriggerReasonInitial {
+		defer u.initialized.Store(true)
+	}
+
 	// Build Deployments and check if anything has changed (Thread-safe)
 	deploymentsHasChanged, failedContainers, err := u.deploymentManager.BuildDeployments(ctx, logger)
 	if err != nil {
+		if client.IsErrConnectionFailed(err) {
+			return fmt.Errorf("failed to build deployments: %w: %w", ErrDockerUnavailable, err)
+		}
 		return fmt.Errorf("failed to build deployments: %w", err)
 	}
 
@@ -121,37 +170,121 @@ func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason Trigge
 		}
 	}
 
+	// The proxy has to be reloaded to serve certificates obtained synchronously, even if the config is unchanged.
+	var certificatesRenewed bool
+
+	// System domains don't depend on the deployments, so they're refreshed on every update. At startup they're
+	// bootstrapped synchronously, so the result is logged and served before the apps are routed.
+	// Proxies that obtain their own certificates also do so for the system domains.
+	systemDomains := u.deploymentManager.SystemDomains()
+	if !u.proxy.ManagesCertificates() {
+		if reason == TriggerReasonInitial {
+			certificatesRenewed = u.certManager.RefreshSystemDomains(logger, systemDomains)
+		} else {
+			u.certManager.RefreshSystemDomainsAsync(logger, systemDomains)
+		}
+	}
+
 	// Skip further processing if no changes were detected and the reason is not an initial update.
-	// We'll still want to continue on the initial update to ensure the API domain is set up correctly.
-	if !deploymentsHasChanged && reason != TriggerReasonInitial {
+	// We'll still want to continue on the initial update and config reloads to ensure the API domain is routed correctly,
+	// and after a Docker restart, where the proxy may have been restarted with the daemon.
+	if !deploymentsHasChanged && reason != TriggerReasonInitial && reason != TriggerConfigReloaded && reason != TriggerDockerReconnected {
 		logger.Debug("Updater: No changes detected in deployments, skipping further processing")
+		if u.externalLB != nil {
+			u.externalLB.Sync(ctx, logger, u.deploymentManager.Deployments(), nil)
+		}
 		return nil
 	}
 
-	checkedDeployments, failedContainerIDs := u.deploymentManager.HealthCheckNewContainers(ctx, logger)
+	for _, app := range apps {
+		logging.LogStep(app.log(logger), logging.StepHealthCheck, "Running health checks")
+	}
+	healthCtx, healthSpan := tracing.Start(ctx, "healthcheck")
+	checkedDeployments, failedContainerIDs := u.deploymentManager.HealthCheckNewContainers(healthCtx, logger)
+	healthSpan.SetAttributes(attribute.Int("haloy.failed_containers", len(failedContainerIDs)))
+	healthSpan.End()
 	if len(failedContainerIDs) > 0 {
+		if len(apps) == 0 {
+			u.events.Publish(haloyevents.Event{
+				Type: haloyevents.TypeContainerUnhealthy,
+				Data: map[string]any{"containerIDs": failedContainerIDs},
+			})
+		}
+		for _, app := range apps {
+			u.events.Publish(haloyevents.Event{
+				Type:         haloyevents.TypeContainerUnhealthy,
+				AppName:      app.appName,
+				DeploymentID: app.deploymentID,
+				Data:         map[string]any{"containerIDs": failedContainerIDs},
+			})
+		}
 		return fmt.Errorf("deployment aborted: failed to perform health check on containers (%s)", strings.Join(failedContainerIDs, ", "))
 	} else {
-		apps := make([]string, 0, len(checkedDeployments))
+		checkedApps := make([]string, 0, len(checkedDeployments))
 		for _, dep := range checkedDeployments {
-			apps = append(apps, dep.Labels.AppName)
+			checkedApps = append(checkedApps, dep.Labels.AppName)
+		}
+		logger.Info("Health check completed", "apps", strings.Join(checkedApps, ", "))
+	}
+
+	for _, app := range apps {
+		logging.LogStep(app.log(logger), logging.StepTraffic, "Switching traffic")
+	}
+
+	if !u.proxy.ManagesCertificates() {
+		renewed, err := u.refreshCertificates(ctx, logger, reason, apps, systemDomains)
+		if err != nil {
+			return err
+		}
+		certificatesRenewed = certificatesRenewed || renewed
+	}
+
+	deployments := u.deploymentManager.Deployments()
+
+	// Apply the proxy configuration
+	proxyCtx, proxySpan := tracing.Start(ctx, u.proxy.Name()+".apply")
+	err = u.proxy.Apply(proxyCtx, logger, deployments, certificatesRenewed)
+	tracing.End(proxySpan, err)
+	if err != nil {
+		return fmt.Errorf("failed to apply %s config for app: %w", u.proxy.Name(), err)
+	} else {
+		logger.Info("Proxy configuration applied successfully", "backend", u.proxy.Name())
+	}
+
+	// The server is only registered once the proxy routes the app, so the load balancer doesn't send traffic too early.
+	if u.externalLB != nil {
+		u.externalLB.Sync(ctx, logger, deployments, apps)
+	}
+
+	var cleanupErrs []error
+	for _, app := range apps {
+		if err := u.cleanupApp(ctx, app.log(logger), app); err != nil {
+			cleanupErrs = append(cleanupErrs, fmt.Errorf("%s: %w", app.appName, err))
 		}
-		logger.Info("Health check completed", "apps", strings.Join(apps, ", "))
 	}
+	return errors.Join(cleanupErrs...)
+}
 
-	// Certificates refresh logic based on trigger reason.
+// refreshCertificates obtains and renews the certificates of the app domains, based on the trigger reason.
+// It reports whether certificates were obtained synchronously, the proxy then has to be reloaded.
+func (u *Updater) refreshCertificates(ctx context.Context, logger *slog.Logger, reason TriggerReason, apps []*TriggeredByApp, systemDomains []SystemDomain) (bool, error) {
+	var certificatesRenewed bool
 	certDomains, err := u.deploymentManager.GetCertificateDomains()
 	if err != nil {
-		return fmt.Errorf("failed to get certificate domains: %w", err)
+		return false, fmt.Errorf("failed to get certificate domains: %w", err)
 	}
 
-	// If an app is provided we refresh the certs synchronously so we can log the result.
+	// If apps are provided we refresh the certs synchronously so we can log the result.
 	// Otherwise, we refresh them asynchronously to avoid blocking the main update process.
-	// We also refresh the certs for that app only.
-	if app != nil && len(app.domains) > 0 {
-		appCanonicalDomains := make(map[string]struct{}, len(app.domains))
-		for _, domain := range app.domains {
-			appCanonicalDomains[domain.Canonical] = struct{}{}
+	// We also refresh the certs for those apps only.
+	if len(apps) > 0 {
+		appCanonicalDomains := make(map[string]struct{})
+		appNames := make([]string, len(apps))
+		for i, app := range apps {
+			appNames[i] = app.appName
+			for _, domain := range app.domains {
+				appCanonicalDomains[domain.Canonical] = struct{}{}
+			}
 		}
 
 		var appCertDomains []CertificatesDomain
@@ -160,45 +293,65 @@ func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason Trigge
 				appCertDomains = append(appCertDomains, certDomain)
 			}
 		}
-		if err := u.certManager.RefreshSync(logger, appCertDomains); err != nil {
-			return fmt.Errorf("failed to refresh certificates for app %s: %w", app.appName, err)
+		_, certSpan := tracing.Start(ctx, "certificates.refresh")
+		renewedDomains, err := u.certManager.RefreshSync(logger, appCertDomains)
+		tracing.End(certSpan, err)
+		if err != nil {
+			return false, fmt.Errorf("failed to refresh certificates for %s: %w", strings.Join(appNames, ", "), err)
 		}
-	} else if reason == TriggerReasonInitial { // Refresh syncronously on initial update so we can log api domain setup.
-		if err := u.certManager.RefreshSync(logger, certDomains); err != nil {
-			return err
+		certificatesRenewed = len(renewedDomains) > 0
+	} else if reason == TriggerReasonInitial { // Refresh syncronously on initial update so we can log the certificate setup.
+		renewedDomains, err := u.certManager.RefreshSync(logger, certDomains)
+		if err != nil {
+			return false, err
 		}
+		certificatesRenewed = len(renewedDomains) > 0
 	} else {
 		u.certManager.Refresh(logger, certDomains)
 	}
 
 	if reason == TriggerPeriodicRefresh {
-		u.certManager.CleanupExpiredCertificates(logger, certDomains)
+		managedDomains := certDomains
+		for _, domain := range systemDomains {
+			managedDomains = append(managedDomains, domain.CertificatesDomain)
+		}
+		u.certManager.CleanupExpiredCertificates(logger, managedDomains)
 	}
 
-	deployments := u.deploymentManager.Deployments()
+	return certificatesRenewed, nil
+}
 
-	// Apply the HAProxy configuration
-	if err := u.haproxyManager.ApplyConfig(ctx, logger, deployments); err != nil {
-		return fmt.Errorf("failed to apply HAProxy config for app: %w", err)
-	} else {
-		logger.Info("HAProxy configuration applied successfully")
+// cleanupApp stops and removes the containers and sidecars of the app's previous deployments.
+func (u *Updater) cleanupApp(ctx context.Context, logger *slog.Logger, app *TriggeredByApp) error {
+	logging.LogStep(logger, logging.StepCleanup, "Removing old containers")
+	stopCtx, cancelStop := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancelStop()
+	_, err := docker.StopContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to stop old containers: %w", err)
+	}
+	_, err = docker.RemoveContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to remove old containers: %w", err)
 	}
 
-	// If an app is provided:
-	// - stop old containers, remove and log the result.
-	// - log successful deployment for app.
-	if app != nil {
-		stopCtx, cancelStop := context.WithTimeout(ctx, 10*time.Minute)
-		defer cancelStop()
-		_, err := docker.StopContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
-		if err != nil {
-			return fmt.Errorf("failed to stop old containers: %w", err)
-		}
-		_, err = docker.RemoveContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
-		if err != nil {
-			return fmt.Errorf("failed to remove old containers: %w", err)
-		}
+	// Sidecars of the previous deployments are replaced together with the app containers.
+	if _, err := docker.StopSidecars(stopCtx, u.cli, logger, app.appName, app.deploymentID); err != nil {
+		return fmt.Errorf("failed to stop old sidecars: %w", err)
+	}
+	if _, err := docker.RemoveSidecars(stopCtx, u.cli, logger, app.appName, app.deploymentID); err != nil {
+		return fmt.Errorf("failed to remove old sidecars: %w", err)
 	}
 
 	return nil
 }
+
+// ProxyConfigApplied returns an error until the initial update has applied the proxy config for the running
+// apps, haloyd isn't ready for deployments before. A failed initial update doesn't keep haloyd from being ready,
+// a new deployment of the failing app is what fixes it.
+func (u *Updater) ProxyConfigApplied(ctx context.Context) error {
+	if !u.initialized.Load() {
+		return fmt.Errorf("the initial %s config hasn't been applied yet", u.proxy.Name())
+	}
+	return nil
+}
@@ -3,20 +3,8 @@ package helpers
 import (
 	"fmt"
 	"time"
-
-	"github.com/oklog/ulid"
 )
 
-// GetTimestampFromDeploymentID extracts time.Time from an ULID
-func GetTimestampFromDeploymentID(deploymentID string) (time.Time, error) {
-	parsedULID, err := ulid.Parse(deploymentID)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("invalid deployment ID: %v", err)
-	}
-
-	return ulid.Time(parsedULID.Time()), nil
-}
-
 // FormatTime formats a time.Time in a simple, CLI-friendly format
 // similar to Docker and Kubernetes tools (e.g., "2 minutes ago", "3 hours ago", "2 days ago")
 func FormatTime(t time.Time) string {
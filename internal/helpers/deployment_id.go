@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// DeploymentID identifies a deployment. It's a lowercase ULID, a millisecond timestamp followed
+// by 80 random bits, so deployment IDs sort by the time they were created.
+type DeploymentID string
+
+var (
+	deploymentIDMutex   sync.Mutex
+	deploymentIDEntropy = ulid.Monotonic(rand.Reader, 0)
+	lastDeploymentTime  uint64
+)
+
+// NewDeploymentID returns a new deployment ID. IDs created by the same process always increase,
+// also within the same millisecond and when the clock is set back.
+func NewDeploymentID() DeploymentID {
+	deploymentIDMutex.Lock()
+	defer deploymentIDMutex.Unlock()
+
+	lastDeploymentTime = max(lastDeploymentTime, ulid.Timestamp(time.Now()))
+	id := ulid.MustNew(lastDeploymentTime, deploymentIDEntropy)
+	return DeploymentID(strings.ToLower(id.String()))
+}
+
+// ParseDeploymentID checks that s is a valid deployment ID and returns it in its canonical
+// lowercase form.
+func ParseDeploymentID(s string) (DeploymentID, error) {
+	id, err := ulid.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid deployment ID '%s': %v", s, err)
+	}
+	return DeploymentID(strings.ToLower(id.String())), nil
+}
+
+func (id DeploymentID) String() string {
+	return string(id)
+}
+
+// Time returns the time the deployment ID was created.
+func (id DeploymentID) Time() time.Time {
+	parsed, err := ulid.Parse(string(id))
+	if err != nil {
+		return time.Time{}
+	}
+	return ulid.Time(parsed.Time())
+}
+
+// CompareDeploymentIDs orders deployment IDs by the time they were created, and returns -1, 0 or 1
+// like strings.Compare. IDs are compared regardless of case, and IDs that aren't valid, including
+// the empty string, sort before valid ones.
+func CompareDeploymentIDs(a, b string) int {
+	idA, errA := ulid.Parse(a)
+	idB, errB := ulid.Parse(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return idA.Compare(idB)
+}
+
+// NewestDeploymentID returns the newest of the deployment IDs, or an empty string for none.
+func NewestDeploymentID(ids ...string) string {
+	newest := ""
+	for _, id := range ids {
+		if newest == "" || CompareDeploymentIDs(id, newest) > 0 {
+			newest = id
+		}
+	}
+	return newest
+}
+
+// GetTimestampFromDeploymentID extracts time.Time from an ULID
+func GetTimestampFromDeploymentID(deploymentID string) (time.Time, error) {
+	id, err := ParseDeploymentID(deploymentID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return id.Time(), nil
+}
@@ -0,0 +1,83 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewDeploymentID(t *testing.T) {
+	prev := NewDeploymentID()
+	for range 1000 {
+		id := NewDeploymentID()
+		if id.String() != strings.ToLower(id.String()) {
+			t.Fatalf("NewDeploymentID() = %q, want lowercase", id)
+		}
+		if _, err := ParseDeploymentID(id.String()); err != nil {
+			t.Fatalf("ParseDeploymentID(%q) failed: %v", id, err)
+		}
+		if CompareDeploymentIDs(id.String(), prev.String()) <= 0 {
+			t.Fatalf("NewDeploymentID() = %q, want it to sort after %q", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestParseDeploymentID(t *testing.T) {
+	id := NewDeploymentID()
+
+	got, err := ParseDeploymentID(strings.ToUpper(id.String()))
+	if err != nil {
+		t.Fatalf("ParseDeploymentID() unexpected error: %v", err)
+	}
+	if got != id {
+		t.Errorf("ParseDeploymentID() = %q, want %q", got, id)
+	}
+
+	for _, invalid := range []string{"", "20250615214304", "not-a-deployment-id"} {
+		if _, err := ParseDeploymentID(invalid); err == nil {
+			t.Errorf("ParseDeploymentID(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestCompareDeploymentIDs(t *testing.T) {
+	older := NewDeploymentID().String()
+	newer := NewDeploymentID().String()
+
+	tests := []struct {
+		name string
+		a, b string
+		want int
+	}{
+		{"older first", older, newer, -1},
+		{"newer first", newer, older, 1},
+		{"equal", older, older, 0},
+		{"case insensitive", strings.ToUpper(older), older, 0},
+		{"invalid before valid", "invalid", older, -1},
+		{"valid after empty", older, "", 1},
+		{"both invalid", "a", "b", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompareDeploymentIDs(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareDeploymentIDs(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewestDeploymentID(t *testing.T) {
+	first := NewDeploymentID().String()
+	second := NewDeploymentID().String()
+	third := NewDeploymentID().String()
+
+	if got := NewestDeploymentID(second, third, first); got != third {
+		t.Errorf("NewestDeploymentID() = %q, want %q", got, third)
+	}
+	if got := NewestDeploymentID("invalid", first); got != first {
+		t.Errorf("NewestDeploymentID() = %q, want %q", got, first)
+	}
+	if got := NewestDeploymentID(); got != "" {
+		t.Errorf("NewestDeploymentID() = %q, want empty", got)
+	}
+}
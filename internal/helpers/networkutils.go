@@ -1,11 +1,13 @@
 package helpers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // GetARecord returns the first A record (IPv4 address) for the provided host.
@@ -23,10 +25,36 @@ func GetARecord(host string) (net.IP, error) {
 	return nil, fmt.Errorf("no A record found for host: %s", host)
 }
 
+var externalIPClient = &http.Client{Timeout: 5 * time.Second}
+
 // GetExternalIP queries a public service for this machine's external IPv4.
 // It returns the IP or an error.
 func GetExternalIP() (net.IP, error) {
-	resp, err := http.Get("https://api.ipify.org?format=text")
+	ip, err := getExternalIP("https://api.ipify.org?format=text")
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("invalid IPv4 address returned: %s", ip)
+	}
+	return ip.To4(), nil
+}
+
+// GetExternalIPv6 queries a public service for this machine's external IPv6.
+// It returns an error if the machine has no public IPv6 connectivity.
+func GetExternalIPv6() (net.IP, error) {
+	ip, err := getExternalIP("https://api6.ipify.org?format=text")
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() != nil {
+		return nil, fmt.Errorf("invalid IPv6 address returned: %s", ip)
+	}
+	return ip, nil
+}
+
+func getExternalIP(url string) (net.IP, error) {
+	resp, err := externalIPClient.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query external IP service: %w", err)
 	}
@@ -38,9 +66,41 @@ func GetExternalIP() (net.IP, error) {
 	}
 
 	ipStr := strings.TrimSpace(string(body))
-	ip := net.ParseIP(ipStr).To4()
+	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		return nil, fmt.Errorf("invalid IPv4 address returned: %s", ipStr)
+		return nil, fmt.Errorf("invalid IP address returned: %s", ipStr)
 	}
 	return ip, nil
 }
+
+// DescribeDNSError turns a failed lookup of a domain into guidance for fixing its DNS records.
+func DescribeDNSError(domain string, err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return fmt.Sprintf("Domain %s not found. Check if domain exists and DNS A record is configured.", domain)
+		case dnsErr.IsTimeout:
+			return fmt.Sprintf("DNS timeout for %s. Check network connectivity or try different DNS server.", domain)
+		}
+	}
+
+	errorStr := err.Error()
+	if strings.Contains(errorStr, "NXDOMAIN") || strings.Contains(errorStr, "no such host") {
+		return fmt.Sprintf("Domain %s not found. Check if domain exists and DNS A record is configured.", domain)
+	}
+	if strings.Contains(errorStr, "timeout") {
+		return fmt.Sprintf("DNS timeout for %s. Check network connectivity or try different DNS server.", domain)
+	}
+
+	return fmt.Sprintf("DNS resolution failed for %s. Verify domain exists and has proper DNS records.", domain)
+}
+
+// MissingRecordsGuidance describes the records to add for a domain that resolves to no addresses.
+func MissingRecordsGuidance(domain string) string {
+	return fmt.Sprintf(`domain %s has no IP addresses assigned
+
+Please add DNS records:
+- A record: %s → YOUR_SERVER_IP
+- Test with: dig A %s`, domain, domain, domain)
+}
@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestDescribeDNSError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"not found", &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}, "not found"},
+		{"wrapped not found", fmt.Errorf("lookup: %w", &net.DNSError{Err: "no such host", IsNotFound: true}), "not found"},
+		{"timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, "DNS timeout"},
+		{"nxdomain text", errors.New("NXDOMAIN"), "not found"},
+		{"other", errors.New("server misbehaving"), "DNS resolution failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DescribeDNSError("example.com", tt.err)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("DescribeDNSError() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"slices"
+	"strings"
+)
+
+// ClosestMatch returns the candidate closest to s by edit distance, ignoring case and
+// underscores, e.g. to suggest a field name for a typo. Candidates that need more edits
+// than a third of the length of s aren't considered close.
+func ClosestMatch(s string, candidates []string) (string, bool) {
+	normalized := normalizeForMatch(s)
+	maxDistance := max(1, len(normalized)/3)
+
+	// Sorted, so ties resolve the same way every time.
+	sorted := slices.Sorted(slices.Values(candidates))
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range sorted {
+		distance := levenshtein(normalized, normalizeForMatch(candidate))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best, best != ""
+}
+
+func normalizeForMatch(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), "_", "")
+}
+
+// levenshtein returns the number of single character insertions, deletions and
+// substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,49 @@
+package helpers
+
+import "testing"
+
+func TestClosestMatch(t *testing.T) {
+	jsonFields := []string{"healthCheckPath", "healthCheck", "server", "domains"}
+	yamlFields := []string{"health_check_path", "health_check", "server", "domains"}
+
+	tests := []struct {
+		name       string
+		input      string
+		candidates []string
+		want       string
+		wantOk     bool
+	}{
+		{"missing letter", "heathCheckPath", jsonFields, "healthCheckPath", true},
+		{"snake case", "helth_check_path", yamlFields, "health_check_path", true},
+		{"case", "Server", jsonFields, "server", true},
+		{"swapped letters", "sevrer", yamlFields, "server", true},
+		{"singular", "domain", jsonFields, "domains", true},
+		{"unrelated", "replicas", jsonFields, "", false},
+		{"empty", "", yamlFields, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ClosestMatch(tt.input, tt.candidates)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("ClosestMatch(%q) = %q, %v, want %q, %v", tt.input, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"server", "server", 0},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,10 @@ func IntPtr(i int) *int {
 	return &i
 }
 
+func Float64Ptr(f float64) *float64 {
+	return &f
+}
+
 func Contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || containsSubstring(s, substr)))
 }
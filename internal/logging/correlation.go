@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"sync"
+)
+
+// maxCorrelationIDs limits the deployments whose correlation ID is remembered.
+const maxCorrelationIDs = 1000
+
+// Correlation IDs end up in log lines, so IDs sent by clients are limited to safe characters.
+var correlationIDRegex = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type correlationIDKey struct{}
+
+// NewCorrelationID returns a random correlation ID.
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IsValidCorrelationID reports whether a correlation ID sent by a client can be used.
+func IsValidCorrelationID(correlationID string) bool {
+	return correlationIDRegex.MatchString(correlationID)
+}
+
+var correlationIDs = struct {
+	sync.Mutex
+	byDeployment map[string]string
+	order        []string
+}{byDeployment: make(map[string]string)}
+
+// WithCorrelationID returns a context that carries the correlation ID of a request.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID of the request, or "" when there is none.
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+// SetCorrelationID remembers the correlation ID of the request that started a deployment. Deployment
+// loggers created afterwards, also those of the manager that reacts to the new containers, log it.
+func SetCorrelationID(deploymentID, correlationID string) {
+	if deploymentID == "" || correlationID == "" {
+		return
+	}
+
+	correlationIDs.Lock()
+	defer correlationIDs.Unlock()
+
+	if _, exists := correlationIDs.byDeployment[deploymentID]; !exists {
+		correlationIDs.order = append(correlationIDs.order, deploymentID)
+		if len(correlationIDs.order) > maxCorrelationIDs {
+			delete(correlationIDs.byDeployment, correlationIDs.order[0])
+			correlationIDs.order = correlationIDs.order[1:]
+		}
+	}
+	correlationIDs.byDeployment[deploymentID] = correlationID
+}
+
+// CorrelationID returns the correlation ID of a deployment, or "" when it isn't known.
+func CorrelationID(deploymentID string) string {
+	correlationIDs.Lock()
+	defer correlationIDs.Unlock()
+
+	return correlationIDs.byDeployment[deploymentID]
+}
@@ -1,8 +1,10 @@
 package logging
 
 import (
+	"io"
 	"log/slog"
 	"os"
+	"sync"
 )
 
 // Log attribute keys used for structured logging and streaming
@@ -21,15 +23,53 @@ const (
 	AttrApp     = "app"
 	AttrDomains = "domains"
 
+	// Step of the deployment a log entry belongs to, used by the CLI to render progress.
+	AttrStep = "step"
+
 	// General attributes
 	AttrError = "error"
+	// AttrCorrelationID ties the logs and events of a request together across the CLI and haloyd.
+	AttrCorrelationID = "correlationID"
+)
+
+// Deployment steps in the order they run. The resolve, secrets and push steps run in the CLI.
+const (
+	StepResolve     = "resolve"
+	StepSecrets     = "secrets"
+	StepPush        = "push"
+	StepPull        = "pull"
+	StepCreate      = "create"
+	StepHealthCheck = "healthcheck"
+	StepTraffic     = "traffic"
+	StepCleanup     = "cleanup"
+)
+
+var (
+	outputMutex sync.RWMutex
+	output      io.Writer = os.Stdout
+	jsonOutput  bool
 )
 
+// SetOutput sets where loggers created by NewLogger write and whether they write JSON instead of text.
+func SetOutput(w io.Writer, json bool) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	output = w
+	jsonOutput = json
+}
+
 // NewLogger creates a new slog.Logger with optional streaming
 func NewLogger(level slog.Level, publisher StreamPublisher) *slog.Logger {
+	outputMutex.RLock()
+	w, json := output, jsonOutput
+	outputMutex.RUnlock()
+
 	// Create base handler (console output)
 	opts := &slog.HandlerOptions{Level: level}
-	baseHandler := slog.NewTextHandler(os.Stdout, opts)
+	var baseHandler slog.Handler = slog.NewTextHandler(w, opts)
+	if json {
+		baseHandler = slog.NewJSONHandler(w, opts)
+	}
 
 	if publisher != nil {
 		handler := NewStreamHandler(publisher, baseHandler)
@@ -43,7 +83,10 @@ func NewLogger(level slog.Level, publisher StreamPublisher) *slog.Logger {
 func NewDeploymentLogger(deploymentID string, level slog.Level, publisher StreamPublisher) *slog.Logger {
 	logger := NewLogger(level, publisher)
 	if deploymentID != "" {
-		return logger.With("deploymentID", deploymentID)
+		logger = logger.With("deploymentID", deploymentID)
+		if correlationID := CorrelationID(deploymentID); correlationID != "" {
+			logger = logger.With(AttrCorrelationID, correlationID)
+		}
 	}
 	return logger
 }
@@ -54,6 +97,11 @@ func LogFatal(logger *slog.Logger, message string, args ...any) {
 	os.Exit(1)
 }
 
+// LogStep marks the start of a deployment step.
+func LogStep(logger *slog.Logger, step, message string) {
+	logger.Info(message, AttrStep, step)
+}
+
 // LogDeploymentComplete marks a deployment as successfully completed
 // This sends the completion signal that tells CLI clients to stop streaming
 func LogDeploymentComplete(logger *slog.Logger, domains []string, deploymentID, appName, message string) {
@@ -4,16 +4,23 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // LogEntry represents a structured log entry for streaming logs
 type LogEntry struct {
+	// Seq orders the entries of the broker, it's sent as the SSE event ID so clients can resume a stream.
+	Seq                  uint64         `json:"seq,omitempty"`
 	Level                string         `json:"level"`
 	Message              string         `json:"message"`
 	Timestamp            time.Time      `json:"timestamp"`
 	DeploymentID         string         `json:"deploymentID,omitempty"`
+	Step                 string         `json:"step,omitempty"`
 	AppName              string         `json:"appName,omitempty"`
 	Domains              []string       `json:"domains,omitempty"`
 	Fields               map[string]any `json:"fields,omitempty"`
@@ -23,42 +30,99 @@ type LogEntry struct {
 	IsHaloydInitComplete bool           `json:"isHaloydInitComplete,omitempty"`
 }
 
+// String formats the entry as a plain text log line, e.g. for log files attached to tickets.
+func (e LogEntry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-5s %s", e.Timestamp.UTC().Format(time.RFC3339), e.Level, e.Message)
+	if e.Step != "" {
+		fmt.Fprintf(&b, " step=%s", e.Step)
+	}
+	if len(e.Domains) > 0 {
+		fmt.Fprintf(&b, " domains=%s", strings.Join(e.Domains, ","))
+	}
+	for _, key := range slices.Sorted(maps.Keys(e.Fields)) {
+		fmt.Fprintf(&b, " %s=%v", key, e.Fields[key])
+	}
+	return b.String()
+}
+
 // StreamPublisher defines the interface for publishing log entries to streams
 type StreamPublisher interface {
+	// Publish never blocks on subscribers, entries are dropped for subscribers that fall behind.
 	Publish(entry LogEntry)
 
-	SubscribeGeneral() (<-chan LogEntry, string)
+	// SubscribeGeneral and SubscribeDeployment replay the buffered entries with a Seq above afterSeq.
+	SubscribeGeneral(afterSeq uint64) (<-chan LogEntry, string)
 	UnsubscribeGeneral(subscriberID string)
 
-	SubscribeDeployment(deploymentID string) <-chan LogEntry
-	UnsubscribeDeployment(deploymentID string)
+	SubscribeDeployment(deploymentID string, afterSeq uint64) (<-chan LogEntry, string)
+	UnsubscribeDeployment(deploymentID, subscriberID string)
+	// DeploymentLogs returns the buffered entries of a deployment.
+	DeploymentLogs(deploymentID string) []LogEntry
+
+	// PersistDeploymentLogs saves the entries of deployments to store, so they can be read after the
+	// deployment. Store errors are logged to logger.
+	PersistDeploymentLogs(store DeploymentLogStore, logger *slog.Logger)
+
+	// Stats returns the number of subscribers and the entries dropped for slow subscribers.
+	Stats() StreamStats
 
 	Close()
 }
 
-// LogBroker manages log streams for different deployment IDs
-type LogBroker struct {
-	streams map[string]chan LogEntry // subscriberID -> channel
-	buffer  []LogEntry               // Buffer for historical logs
+// StreamStats are the counters of the log streams of a broker.
+type StreamStats struct {
+	Subscribers int
+	// DroppedEntries is the number of entries dropped for subscribers that fell behind, since haloyd started.
+	DroppedEntries uint64
+}
+
+// DeploymentLogStore persists the log entries of deployments.
+type DeploymentLogStore interface {
+	SaveDeploymentLogs(entries []LogEntry) error
+}
 
-	deploymentStreams map[string]chan LogEntry // One channel per deployment ID
-	deploymentBuffer  map[string][]LogEntry
+// persistQueueSize is the number of deployment log entries waiting to be saved. Entries are dropped
+// when the store falls this far behind, so logging never blocks on the database.
+const persistQueueSize = 1000
 
-	maxBuffer        int // Maximum buffered logs
-	subscriberIDSeed int
-	mutex            sync.RWMutex
-	closed           bool
+// subscriberBufferSize is the number of entries queued for a subscriber that reads slower than entries
+// are published. The oldest entries are dropped beyond it, so a slow client never blocks a deployment.
+const subscriberBufferSize = 512
+
+// LogBroker manages log streams for different deployment IDs
+type LogBroker struct {
+	streams map[string]*logSubscriber // subscriberID -> subscriber
+	buffer  *logRing                  // Buffer for historical logs
+
+	deploymentStreams map[string]map[string]*logSubscriber // deploymentID -> subscriberID -> subscriber
+	deploymentBuffer  map[string]*logRing
+	// Deployment IDs by first log entry, the oldest buffers are dropped beyond maxDeploymentBuffers.
+	deploymentOrder []string
+
+	maxBuffer            int // Maximum buffered logs
+	maxDeploymentBuffers int
+	subscriberIDSeed     int
+	seq                  uint64
+	dropped              atomic.Uint64
+	persist              chan LogEntry
+	mutex                sync.RWMutex
+	closed               bool
 }
 
 // NewLogBroker creates a new log broker
 func NewLogBroker() StreamPublisher {
 	return &LogBroker{
-		streams:           make(map[string]chan LogEntry),
-		buffer:            make([]LogEntry, 0),
-		deploymentStreams: make(map[string]chan LogEntry),
-		deploymentBuffer:  make(map[string][]LogEntry),
-		maxBuffer:         100,
-		subscriberIDSeed:  1,
+		streams:              make(map[string]*logSubscriber),
+		buffer:               newLogRing(100),
+		deploymentStreams:    make(map[string]map[string]*logSubscriber),
+		deploymentBuffer:     make(map[string]*logRing),
+		maxBuffer:            100,
+		maxDeploymentBuffers: 50,
+		subscriberIDSeed:     1,
+		// Start from the clock so sequence numbers keep increasing across haloyd restarts, a client
+		// resuming with an ID of the previous process then gets all new entries.
+		seq: uint64(time.Now().UnixNano()),
 	}
 }
 
@@ -71,97 +135,114 @@ func (lb *LogBroker) Publish(entry LogEntry) {
 		return
 	}
 
-	lb.buffer = append(lb.buffer, entry)
-	if len(lb.buffer) > lb.maxBuffer {
-		lb.buffer = lb.buffer[len(lb.buffer)-lb.maxBuffer:]
-	}
+	lb.seq++
+	entry.Seq = lb.seq
 
-	// Send to all general subscribers
-	for subscriberID, ch := range lb.streams {
-		select {
-		case ch <- entry:
-		default:
-			// Channel full, close slow subscriber
-			close(ch)
-			delete(lb.streams, subscriberID)
+	lb.buffer.push(entry)
+
+	// Queue for all general subscribers
+	for _, sub := range lb.streams {
+		if sub.offer(entry) {
+			lb.dropped.Add(1)
 		}
 	}
 
 	if entry.DeploymentID != "" {
 		lb.publishToDeployment(entry.DeploymentID, entry)
+
+		if lb.persist != nil {
+			select {
+			case lb.persist <- entry:
+			default:
+			}
+		}
 	}
 }
 
+// PersistDeploymentLogs starts saving the log entries of deployments to store in batches.
+func (lb *LogBroker) PersistDeploymentLogs(store DeploymentLogStore, logger *slog.Logger) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if lb.closed || lb.persist != nil {
+		return
+	}
+	lb.persist = make(chan LogEntry, persistQueueSize)
+
+	go func(queue <-chan LogEntry) {
+		for entry := range queue {
+			batch := []LogEntry{entry}
+		drain:
+			for len(batch) < persistQueueSize {
+				select {
+				case next, ok := <-queue:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, next)
+				default:
+					break drain
+				}
+			}
+			if err := store.SaveDeploymentLogs(batch); err != nil {
+				// Logged without a deployment ID, so the error isn't persisted itself.
+				logger.Warn("Failed to save deployment logs", "entries", len(batch), "error", err)
+			}
+		}
+	}(lb.persist)
+}
+
 // publishToDeployment is a private helper for deployment-specific publishing
 func (lb *LogBroker) publishToDeployment(deploymentID string, entry LogEntry) {
-	buffer := lb.deploymentBuffer[deploymentID]
-	buffer = append(buffer, entry)
-	if len(buffer) > lb.maxBuffer {
-		buffer = buffer[len(buffer)-lb.maxBuffer:]
+	buffer, exists := lb.deploymentBuffer[deploymentID]
+	if !exists {
+		lb.deploymentOrder = append(lb.deploymentOrder, deploymentID)
+		if len(lb.deploymentOrder) > lb.maxDeploymentBuffers {
+			delete(lb.deploymentBuffer, lb.deploymentOrder[0])
+			lb.deploymentOrder = lb.deploymentOrder[1:]
+		}
+		buffer = newLogRing(lb.maxBuffer)
+		lb.deploymentBuffer[deploymentID] = buffer
 	}
-	lb.deploymentBuffer[deploymentID] = buffer
+	buffer.push(entry)
 
-	// Send to deployment subscriber if exists
-	if ch, exists := lb.deploymentStreams[deploymentID]; exists {
-		select {
-		case ch <- entry:
-		default:
-			// Channel full, close slow subscriber
-			close(ch)
-			delete(lb.deploymentStreams, deploymentID)
-			delete(lb.deploymentBuffer, deploymentID)
+	// Queue for the deployment subscribers. The buffer is kept after they leave, so a client that
+	// lost its connection can resume the stream.
+	for _, sub := range lb.deploymentStreams[deploymentID] {
+		if sub.offer(entry) {
+			lb.dropped.Add(1)
 		}
 	}
 }
 
+func (lb *LogBroker) removeDeploymentSubscriber(deploymentID, subscriberID string) {
+	delete(lb.deploymentStreams[deploymentID], subscriberID)
+	if len(lb.deploymentStreams[deploymentID]) == 0 {
+		delete(lb.deploymentStreams, deploymentID)
+	}
+}
+
+// closedStream returns a closed channel for subscriptions to a closed broker.
+func closedStream() <-chan LogEntry {
+	ch := make(chan LogEntry)
+	close(ch)
+	return ch
+}
+
 // SubscribeGeneral creates a subscription for all logs and returns the channel and subscriber ID
-func (lb *LogBroker) SubscribeGeneral() (<-chan LogEntry, string) {
+func (lb *LogBroker) SubscribeGeneral(afterSeq uint64) (<-chan LogEntry, string) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
 	if lb.closed {
-		ch := make(chan LogEntry)
-		close(ch)
-		return ch, ""
+		return closedStream(), ""
 	}
 
-	// Generate unique subscriber ID
 	subscriberID := lb.generateSubscriberID()
+	sub := newLogSubscriber("", lb.buffer.after(afterSeq))
+	lb.streams[subscriberID] = sub
 
-	// Create new general subscription
-	ch := make(chan LogEntry, 100)
-
-	// Copy buffered general logs
-	var bufferCopy []LogEntry
-	if len(lb.buffer) > 0 {
-		bufferCopy = make([]LogEntry, len(lb.buffer))
-		copy(bufferCopy, lb.buffer)
-	}
-
-	// Store the channel
-	lb.streams[subscriberID] = ch
-
-	// Send buffered logs in a separate goroutine
-	if len(bufferCopy) > 0 {
-		go func() {
-			for _, entry := range bufferCopy {
-				select {
-				case ch <- entry:
-				case <-time.After(2 * time.Second):
-					// Timeout, subscriber is too slow
-					lb.mutex.Lock()
-					if existingCh, exists := lb.streams[subscriberID]; exists && existingCh == ch {
-						close(ch)
-						delete(lb.streams, subscriberID)
-					}
-					lb.mutex.Unlock()
-					return
-				}
-			}
-		}()
-	}
-
-	return ch, subscriberID
+	return sub.ch, subscriberID
 }
 
 // UnsubscribeGeneral removes a specific general subscriber
@@ -169,75 +250,74 @@ func (lb *LogBroker) UnsubscribeGeneral(subscriberID string) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
-	if ch, exists := lb.streams[subscriberID]; exists {
-		close(ch)
+	if sub, exists := lb.streams[subscriberID]; exists {
+		sub.close()
 		delete(lb.streams, subscriberID)
 	}
 }
 
-// SubscribeDeployment creates a new subscription for a deployment ID
-func (lb *LogBroker) SubscribeDeployment(deploymentID string) <-chan LogEntry {
+// SubscribeDeployment creates a new subscription for a deployment ID and returns the channel and subscriber ID
+func (lb *LogBroker) SubscribeDeployment(deploymentID string, afterSeq uint64) (<-chan LogEntry, string) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
 	if lb.closed {
-		ch := make(chan LogEntry)
-		close(ch)
-		return ch
+		return closedStream(), ""
 	}
 
-	// Check if already subscribed
-	if existingCh, exists := lb.deploymentStreams[deploymentID]; exists {
-		return existingCh
-	}
-
-	// Create new subscription
-	ch := make(chan LogEntry, 100)
+	subscriberID := lb.generateSubscriberID()
 
-	// Copy buffered logs
-	var bufferCopy []LogEntry
-	if buffer, exists := lb.deploymentBuffer[deploymentID]; exists && len(buffer) > 0 {
-		bufferCopy = make([]LogEntry, len(buffer))
-		copy(bufferCopy, buffer)
+	var replay []LogEntry
+	if buffer, exists := lb.deploymentBuffer[deploymentID]; exists {
+		replay = buffer.after(afterSeq)
 	}
+	sub := newLogSubscriber(deploymentID, replay)
 
-	// Store the channel
-	lb.deploymentStreams[deploymentID] = ch
-
-	// Send buffered logs in a separate goroutine
-	if len(bufferCopy) > 0 {
-		go func() {
-			for _, entry := range bufferCopy {
-				select {
-				case ch <- entry:
-				case <-time.After(2 * time.Second):
-					// Timeout, close the channel
-					lb.mutex.Lock()
-					if existingCh, exists := lb.deploymentStreams[deploymentID]; exists && existingCh == ch {
-						close(ch)
-						delete(lb.deploymentStreams, deploymentID)
-						delete(lb.deploymentBuffer, deploymentID)
-					}
-					lb.mutex.Unlock()
-					return
-				}
-			}
-		}()
+	if lb.deploymentStreams[deploymentID] == nil {
+		lb.deploymentStreams[deploymentID] = make(map[string]*logSubscriber)
 	}
+	lb.deploymentStreams[deploymentID][subscriberID] = sub
 
-	return ch
+	return sub.ch, subscriberID
 }
 
-// UnsubscribeDeployment removes a deployment subscriber
-func (lb *LogBroker) UnsubscribeDeployment(deploymentID string) {
+// UnsubscribeDeployment removes a deployment subscriber. The buffered logs of the deployment are kept
+// for clients that resume the stream.
+func (lb *LogBroker) UnsubscribeDeployment(deploymentID, subscriberID string) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
-	if ch, exists := lb.deploymentStreams[deploymentID]; exists {
-		close(ch)
-		delete(lb.deploymentStreams, deploymentID)
+	if sub, exists := lb.deploymentStreams[deploymentID][subscriberID]; exists {
+		sub.close()
+		lb.removeDeploymentSubscriber(deploymentID, subscriberID)
+	}
+}
+
+// DeploymentLogs returns a copy of the buffered entries of a deployment.
+func (lb *LogBroker) DeploymentLogs(deploymentID string) []LogEntry {
+	lb.mutex.RLock()
+	defer lb.mutex.RUnlock()
+
+	buffer, exists := lb.deploymentBuffer[deploymentID]
+	if !exists {
+		return nil
+	}
+	return buffer.after(0)
+}
+
+// Stats returns the current number of subscribers and the entries dropped since the broker was created.
+func (lb *LogBroker) Stats() StreamStats {
+	lb.mutex.RLock()
+	defer lb.mutex.RUnlock()
+
+	subscribers := len(lb.streams)
+	for _, deploymentSubscribers := range lb.deploymentStreams {
+		subscribers += len(deploymentSubscribers)
+	}
+	return StreamStats{
+		Subscribers:    subscribers,
+		DroppedEntries: lb.dropped.Load(),
 	}
-	delete(lb.deploymentBuffer, deploymentID)
 }
 
 // Close shuts down the log broker and closes all channels
@@ -251,15 +331,22 @@ func (lb *LogBroker) Close() {
 
 	lb.closed = true
 
+	// The persist goroutine saves the queued entries and stops.
+	if lb.persist != nil {
+		close(lb.persist)
+	}
+
 	// Close all general streams
-	for subscriberID, ch := range lb.streams {
-		close(ch)
+	for subscriberID, sub := range lb.streams {
+		sub.close()
 		delete(lb.streams, subscriberID)
 	}
 
 	// Close all deployment streams
-	for deploymentID, ch := range lb.deploymentStreams {
-		close(ch)
+	for deploymentID, subscribers := range lb.deploymentStreams {
+		for _, sub := range subscribers {
+			sub.close()
+		}
 		delete(lb.deploymentStreams, deploymentID)
 	}
 
@@ -272,7 +359,157 @@ func (lb *LogBroker) Close() {
 func (lb *LogBroker) generateSubscriberID() string {
 	id := lb.subscriberIDSeed
 	lb.subscriberIDSeed++
-	return fmt.Sprintf("general_%d", id)
+	return fmt.Sprintf("subscriber_%d", id)
+}
+
+// logSubscriber queues the entries of a stream subscriber in a ring buffer. Publishing only adds to the
+// queue, a goroutine per subscriber sends the queued entries to the channel the client reads.
+type logSubscriber struct {
+	ch           chan LogEntry
+	deploymentID string
+	notify       chan struct{} // Signals the pump that entries were queued
+	done         chan struct{}
+	closeOnce    sync.Once
+
+	mutex   sync.Mutex
+	pending *logRing
+	// Entries dropped since the last drop notice was sent, and the Seq of the last one dropped.
+	dropped        uint64
+	lastDroppedSeq uint64
+}
+
+// newLogSubscriber creates a subscriber with the replay entries queued and starts sending them.
+func newLogSubscriber(deploymentID string, replay []LogEntry) *logSubscriber {
+	sub := &logSubscriber{
+		ch:           make(chan LogEntry),
+		deploymentID: deploymentID,
+		notify:       make(chan struct{}, 1),
+		done:         make(chan struct{}),
+		pending:      newLogRing(subscriberBufferSize),
+	}
+	for _, entry := range replay {
+		sub.pending.push(entry)
+	}
+	go sub.pump()
+	return sub
+}
+
+// offer queues entry without blocking and reports whether the oldest queued entry was dropped for it.
+func (s *logSubscriber) offer(entry LogEntry) bool {
+	s.mutex.Lock()
+	dropped := false
+	if s.pending.full() {
+		oldest, _ := s.pending.pop()
+		s.dropped++
+		s.lastDroppedSeq = oldest.Seq
+		dropped = true
+	}
+	s.pending.push(entry)
+	s.mutex.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// next returns a notice when entries were dropped since the last call, otherwise the oldest queued entry.
+func (s *logSubscriber) next() (LogEntry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.dropped > 0 {
+		// The notice takes the Seq of the last dropped entry, a client resuming after it continues with
+		// the entries that were still queued.
+		notice := LogEntry{
+			Seq:          s.lastDroppedSeq,
+			Level:        slog.LevelWarn.String(),
+			Message:      fmt.Sprintf("Dropped %d log entries, the client is reading slower than logs are written", s.dropped),
+			Timestamp:    time.Now(),
+			DeploymentID: s.deploymentID,
+			Fields:       map[string]any{"dropped": s.dropped},
+		}
+		s.dropped = 0
+		return notice, true
+	}
+	return s.pending.pop()
+}
+
+// pump sends the queued entries to the subscriber channel until the subscriber is closed.
+func (s *logSubscriber) pump() {
+	defer close(s.ch)
+	for {
+		entry, ok := s.next()
+		if !ok {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case s.ch <- entry:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// close stops the pump, which then closes the subscriber channel.
+func (s *logSubscriber) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// logRing is a fixed-capacity ring buffer of log entries. Its storage is allocated once, so adding
+// entries doesn't allocate, and the oldest entry is overwritten when it's full.
+type logRing struct {
+	entries []LogEntry
+	start   int // Index of the oldest entry
+	size    int
+}
+
+func newLogRing(capacity int) *logRing {
+	return &logRing{entries: make([]LogEntry, capacity)}
+}
+
+func (r *logRing) full() bool {
+	return r.size == len(r.entries)
+}
+
+// push adds entry, overwriting the oldest entry when the ring is full.
+func (r *logRing) push(entry LogEntry) {
+	if r.full() {
+		r.entries[r.start] = entry
+		r.start = (r.start + 1) % len(r.entries)
+		return
+	}
+	r.entries[(r.start+r.size)%len(r.entries)] = entry
+	r.size++
+}
+
+// pop removes and returns the oldest entry.
+func (r *logRing) pop() (LogEntry, bool) {
+	if r.size == 0 {
+		return LogEntry{}, false
+	}
+	entry := r.entries[r.start]
+	r.entries[r.start] = LogEntry{} // Don't keep the fields of sent entries alive
+	r.start = (r.start + 1) % len(r.entries)
+	r.size--
+	return entry, true
+}
+
+// after returns a copy of the entries with a Seq above afterSeq, oldest first.
+func (r *logRing) after(afterSeq uint64) []LogEntry {
+	var entries []LogEntry
+	for i := range r.size {
+		if entry := r.entries[(r.start+i)%len(r.entries)]; entry.Seq > afterSeq {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
 }
 
 // StreamHandler wraps another slog.Handler and publishes logs to streams
@@ -294,7 +531,7 @@ func NewStreamHandler(publisher StreamPublisher, next slog.Handler) slog.Handler
 // Handle processes log records and publishes them to streams
 func (sh *StreamHandler) Handle(ctx context.Context, rec slog.Record) error {
 	// Extract deployment ID and other fields
-	var deploymentID, appName string
+	var deploymentID, appName, step string
 	var isDeploymentComplete, isDeploymentFailed, isDeploymentSuccess, isHaloydInitComplete bool
 	var domains []string
 	fields := make(map[string]any)
@@ -304,6 +541,8 @@ func (sh *StreamHandler) Handle(ctx context.Context, rec slog.Record) error {
 		switch attr.Key {
 		case AttrDeploymentID:
 			deploymentID = attr.Value.String()
+		case AttrStep:
+			step = attr.Value.String()
 		case AttrDeploymentComplete:
 			isDeploymentComplete = attr.Value.Bool()
 		case AttrDeploymentFailed:
@@ -334,6 +573,8 @@ func (sh *StreamHandler) Handle(ctx context.Context, rec slog.Record) error {
 		switch a.Key {
 		case AttrDeploymentID:
 			deploymentID = a.Value.String()
+		case AttrStep:
+			step = a.Value.String()
 		case AttrDeploymentComplete:
 			isDeploymentComplete = a.Value.Bool()
 		case AttrDeploymentFailed:
@@ -366,6 +607,7 @@ func (sh *StreamHandler) Handle(ctx context.Context, rec slog.Record) error {
 		Message:              rec.Message,
 		Timestamp:            rec.Time,
 		DeploymentID:         deploymentID,
+		Step:                 step,
 		AppName:              appName,
 		Domains:              domains,
 		Fields:               fields,
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogBroker_SlowSubscriberDoesNotBlockPublish(t *testing.T) {
+	lb := NewLogBroker()
+	defer lb.Close()
+
+	// The subscriber doesn't read until everything is published.
+	ch, _ := lb.SubscribeDeployment("deployment-1", 0)
+
+	const published = subscriberBufferSize * 4
+	done := make(chan struct{})
+	go func() {
+		for i := range published {
+			lb.Publish(LogEntry{Level: "INFO", Message: "step", DeploymentID: "deployment-1", Fields: map[string]any{"i": i}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish() blocked on a subscriber that doesn't read")
+	}
+
+	dropped := lb.Stats().DroppedEntries
+	if dropped == 0 {
+		t.Fatal("Stats() DroppedEntries = 0, expected entries dropped for the slow subscriber")
+	}
+
+	// The subscriber gets a drop notice followed by the newest entries.
+	notice := <-ch
+	if notice.Level != "WARN" || notice.Fields["dropped"] != dropped {
+		t.Errorf("first entry = %+v, expected a notice of %d dropped entries", notice, dropped)
+	}
+	var received int
+	var last LogEntry
+	for received < published-int(dropped) {
+		select {
+		case last = <-ch:
+			received++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d entries after the notice, expected %d", received, published-int(dropped))
+		}
+	}
+	if last.Fields["i"] != published-1 {
+		t.Errorf("last entry i = %v, expected %d", last.Fields["i"], published-1)
+	}
+}
+
+func TestLogBroker_ReplayAndUnsubscribe(t *testing.T) {
+	lb := NewLogBroker()
+	defer lb.Close()
+
+	for _, message := range []string{"first", "second", "third"} {
+		lb.Publish(LogEntry{Level: "INFO", Message: message})
+	}
+	ch, _ := lb.SubscribeGeneral(0)
+	first := <-ch
+	if first.Message != "first" {
+		t.Fatalf("first replayed entry = %q, expected %q", first.Message, "first")
+	}
+
+	// Resuming after the first entry replays the rest.
+	resumed, subscriberID := lb.SubscribeGeneral(first.Seq)
+	if entry := <-resumed; entry.Message != "second" {
+		t.Errorf("first resumed entry = %q, expected %q", entry.Message, "second")
+	}
+	if got := lb.Stats().Subscribers; got != 2 {
+		t.Errorf("Stats() Subscribers = %d, expected 2", got)
+	}
+
+	lb.UnsubscribeGeneral(subscriberID)
+	select {
+	case _, ok := <-resumed:
+		if !ok {
+			break
+		}
+		// A queued entry may still be delivered before the channel is closed.
+		if _, ok := <-resumed; ok {
+			t.Error("channel is open after UnsubscribeGeneral()")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("channel is open after UnsubscribeGeneral()")
+	}
+}
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+const rotatedTimeFormat = "20060102-150405"
+
+// RotatingFile is an io.Writer that writes to a file and rotates it once it reaches maxSize.
+// Rotated files are renamed with a timestamp suffix and removed once they are older than maxAge.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens the file at path for appending, creating its directory if needed.
+// maxSizeMB is the rotation size in megabytes and maxAgeDays the retention of rotated files in days.
+func NewRotatingFile(path string, maxSizeMB, maxAgeDays int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), constants.ModeDirPrivate); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	rf := &RotatingFile{
+		path:    path,
+		maxSize: int64(maxSizeMB) << 20,
+		maxAge:  time.Duration(maxAgeDays) * 24 * time.Hour,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	rf.removeExpired()
+	return rf, nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, constants.ModeFileDefault)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file and opens a new one. The caller must hold the lock.
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	rf.file = nil
+
+	ext := filepath.Ext(rf.path)
+	rotatedPath := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(rf.path, ext), time.Now().UTC().Format(rotatedTimeFormat), ext)
+	if err := os.Rename(rf.path, rotatedPath); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+	go rf.removeExpired()
+	return nil
+}
+
+// removeExpired deletes rotated files older than maxAge.
+func (rf *RotatingFile) removeExpired() {
+	if rf.maxAge <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(rf.path)
+	pattern := fmt.Sprintf("%s-*%s", strings.TrimSuffix(rf.path, ext), ext)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-rf.maxAge)
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.Remove(match)
+	}
+}
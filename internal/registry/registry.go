@@ -0,0 +1,515 @@
+package registry
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+const (
+	// maxManifestSize limits the size of pushed manifests.
+	maxManifestSize = 4 << 20
+	// defaultManifestType is used for manifests pushed without a Content-Type.
+	defaultManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+var (
+	repositoryNameRegex = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`)
+	tagRegex            = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// Registry is a minimal OCI distribution registry that stores images on the local filesystem.
+// It implements what docker push and docker pull need: blob uploads, blob and manifest reads,
+// manifest writes and tag listing. Repositories are created on first push.
+//
+// Blobs are stored once in blobs/sha256/<hex> and shared by all repositories. Each repository
+// keeps its tags in repositories/<name>/tags/<tag>, holding the manifest digest, and the media
+// type of its manifests in repositories/<name>/manifests/<hex>.
+type Registry struct {
+	root   string
+	token  string
+	logger *slog.Logger
+	// authFailed is called for requests with invalid credentials, e.g. to lock out the client.
+	authFailed func(r *http.Request)
+}
+
+// New creates a registry storing its data in root. Clients authenticate with the API token, as
+// the password of docker login or as a bearer token. authFailed is called for each request with
+// invalid credentials, it may be nil.
+func New(root, token string, authFailed func(r *http.Request), logger *slog.Logger) (*Registry, error) {
+	for _, dir := range []string{"blobs/sha256", "uploads", "repositories"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), constants.ModeDirPrivate); err != nil {
+			return nil, fmt.Errorf("failed to create registry directory: %w", err)
+		}
+	}
+	return &Registry{root: root, token: token, logger: logger, authFailed: authFailed}, nil
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if token, ok := requestToken(r); !ok || subtle.ConstantTimeCompare([]byte(token), []byte(reg.token)) != 1 {
+		// Clients send a first request without credentials to get the challenge, that's no failure.
+		if ok && reg.authFailed != nil {
+			reg.authFailed(r)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="haloy"`)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if name, uploadID, ok := cutRoute(path, "/blobs/uploads"); ok {
+		reg.handleUpload(w, r, name, strings.TrimPrefix(uploadID, "/"))
+		return
+	}
+	if name, digest, ok := cutRoute(path, "/blobs/"); ok {
+		reg.handleBlob(w, r, name, digest)
+		return
+	}
+	if name, reference, ok := cutRoute(path, "/manifests/"); ok {
+		reg.handleManifest(w, r, name, reference)
+		return
+	}
+	if name, ok := strings.CutSuffix(path, "/tags/list"); ok && repositoryNameRegex.MatchString(name) {
+		reg.handleTags(w, r, name)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown endpoint")
+}
+
+// requestToken returns the token of the basic auth password or the bearer token of the request.
+func requestToken(r *http.Request) (string, bool) {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password, password != ""
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return bearer, bearer != ""
+	}
+	return "", false
+}
+
+// cutRoute splits path at the last occurrence of sep, as repository names can contain slashes.
+func cutRoute(path, sep string) (name, rest string, ok bool) {
+	i := strings.LastIndex(path, sep)
+	if i <= 0 {
+		return "", "", false
+	}
+	name = path[:i]
+	if !repositoryNameRegex.MatchString(name) {
+		return "", "", false
+	}
+	return name, path[i+len(sep):], true
+}
+
+func (reg *Registry) handleUpload(w http.ResponseWriter, r *http.Request, name, uploadID string) {
+	if uploadID == "" {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+			return
+		}
+		reg.startUpload(w, r, name)
+		return
+	}
+
+	if !isUploadID(uploadID) {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "unknown upload")
+		return
+	}
+	uploadPath := filepath.Join(reg.root, "uploads", uploadID)
+	if _, err := os.Stat(uploadPath); err != nil {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "unknown upload")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		reg.writeUploadStatus(w, name, uploadID, http.StatusNoContent)
+	case http.MethodPatch:
+		if err := appendToUpload(uploadPath, r.Body); err != nil {
+			writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		reg.writeUploadStatus(w, name, uploadID, http.StatusAccepted)
+	case http.MethodPut:
+		if err := appendToUpload(uploadPath, r.Body); err != nil {
+			writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		reg.finishUpload(w, name, uploadPath, r.URL.Query().Get("digest"))
+	case http.MethodDelete:
+		os.Remove(uploadPath)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (reg *Registry) startUpload(w http.ResponseWriter, r *http.Request, name string) {
+	// Blobs are shared by all repositories, so mounting from another repository only needs the blob to exist.
+	if mount := r.URL.Query().Get("mount"); mount != "" {
+		if hexDigest, ok := parseDigest(mount); ok && reg.blobExists(hexDigest) {
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, mount))
+			w.Header().Set("Docker-Content-Digest", mount)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+	uploadPath := filepath.Join(reg.root, "uploads", uploadID)
+	if err := os.WriteFile(uploadPath, nil, constants.ModeFileDefault); err != nil {
+		writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+
+	// Monolithic upload: the whole blob is sent with the POST request.
+	if digest := r.URL.Query().Get("digest"); digest != "" {
+		if err := appendToUpload(uploadPath, r.Body); err != nil {
+			os.Remove(uploadPath)
+			writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		reg.finishUpload(w, name, uploadPath, digest)
+		return
+	}
+
+	reg.writeUploadStatus(w, name, uploadID, http.StatusAccepted)
+}
+
+func (reg *Registry) writeUploadStatus(w http.ResponseWriter, name, uploadID string, status int) {
+	var size int64
+	if info, err := os.Stat(filepath.Join(reg.root, "uploads", uploadID)); err == nil {
+		size = info.Size()
+	}
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", name, uploadID))
+	w.Header().Set("Docker-Upload-UUID", uploadID)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", max(size-1, 0)))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+}
+
+// finishUpload verifies the digest of an upload and moves it into the blob store.
+func (reg *Registry) finishUpload(w http.ResponseWriter, name, uploadPath, digest string) {
+	hexDigest, ok := parseDigest(digest)
+	if !ok {
+		os.Remove(uploadPath)
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest must be a sha256 digest")
+		return
+	}
+
+	actual, err := fileDigest(uploadPath)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+	if actual != hexDigest {
+		os.Remove(uploadPath)
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("digest mismatch: got sha256:%s", actual))
+		return
+	}
+
+	if err := os.Rename(uploadPath, reg.blobPath(hexDigest)); err != nil {
+		writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, digest))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (reg *Registry) handleBlob(w http.ResponseWriter, r *http.Request, name, digest string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+
+	hexDigest, ok := parseDigest(digest)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest must be a sha256 digest")
+		return
+	}
+	file, err := os.Open(reg.blobPath(hexDigest))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", fmt.Sprintf("blob %s not found in %s", digest, name))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func (reg *Registry) handleManifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		reg.getManifest(w, r, name, reference)
+	case http.MethodPut:
+		reg.putManifest(w, r, name, reference)
+	case http.MethodDelete:
+		reg.deleteManifest(w, name, reference)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (reg *Registry) getManifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	hexDigest, ok := reg.resolveReference(name, reference)
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s not found in %s", reference, name))
+		return
+	}
+	mediaType, err := os.ReadFile(filepath.Join(reg.repositoryPath(name), "manifests", hexDigest))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s not found in %s", reference, name))
+		return
+	}
+	manifest, err := os.ReadFile(reg.blobPath(hexDigest))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s not found in %s", reference, name))
+		return
+	}
+
+	w.Header().Set("Content-Type", string(mediaType))
+	w.Header().Set("Docker-Content-Digest", "sha256:"+hexDigest)
+	w.Header().Set("Content-Length", fmt.Sprint(len(manifest)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(manifest)
+	}
+}
+
+func (reg *Registry) putManifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	manifest, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+	if len(manifest) > maxManifestSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "MANIFEST_INVALID", "manifest is too large")
+		return
+	}
+
+	sum := sha256.Sum256(manifest)
+	hexDigest := hex.EncodeToString(sum[:])
+	digest := "sha256:" + hexDigest
+
+	isDigest := strings.HasPrefix(reference, "sha256:")
+	if isDigest && reference != digest {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("manifest digest is %s", digest))
+		return
+	}
+	if !isDigest && !tagRegex.MatchString(reference) {
+		writeError(w, http.StatusBadRequest, "TAG_INVALID", "invalid tag")
+		return
+	}
+
+	mediaType := r.Header.Get("Content-Type")
+	if mediaType == "" {
+		mediaType = defaultManifestType
+	}
+
+	if err := writeFileAtomic(reg.blobPath(hexDigest), manifest); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(reg.repositoryPath(name), "manifests", hexDigest), []byte(mediaType)); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	if !isDigest {
+		if err := writeFileAtomic(filepath.Join(reg.repositoryPath(name), "tags", reference), []byte(hexDigest)); err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+		reg.logger.Info("Image pushed to registry", "image", name+":"+reference, "digest", digest)
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", name, digest))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (reg *Registry) deleteManifest(w http.ResponseWriter, name, reference string) {
+	var path string
+	if hexDigest, ok := parseDigest(reference); ok {
+		path = filepath.Join(reg.repositoryPath(name), "manifests", hexDigest)
+	} else if tagRegex.MatchString(reference) {
+		path = filepath.Join(reg.repositoryPath(name), "tags", reference)
+	}
+	if path == "" || os.Remove(path) != nil {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", fmt.Sprintf("manifest %s not found in %s", reference, name))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (reg *Registry) handleTags(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+
+	entries, err := os.ReadDir(filepath.Join(reg.repositoryPath(name), "tags"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository %s not found", name))
+		return
+	}
+	tags := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			tags = append(tags, entry.Name())
+		}
+	}
+	slices.Sort(tags)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}{Name: name, Tags: tags})
+}
+
+// resolveReference returns the hex digest of the manifest a tag or digest refers to.
+func (reg *Registry) resolveReference(name, reference string) (string, bool) {
+	if hexDigest, ok := parseDigest(reference); ok {
+		return hexDigest, true
+	}
+	if !tagRegex.MatchString(reference) {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(reg.repositoryPath(name), "tags", reference))
+	if err != nil {
+		return "", false
+	}
+	return parseDigest("sha256:" + strings.TrimSpace(string(data)))
+}
+
+func (reg *Registry) repositoryPath(name string) string {
+	return filepath.Join(reg.root, "repositories", filepath.FromSlash(name))
+}
+
+func (reg *Registry) blobPath(hexDigest string) string {
+	return filepath.Join(reg.root, "blobs", "sha256", hexDigest)
+}
+
+func (reg *Registry) blobExists(hexDigest string) bool {
+	_, err := os.Stat(reg.blobPath(hexDigest))
+	return err == nil
+}
+
+// parseDigest returns the hex part of a sha256 digest, e.g. sha256:<hex>.
+func parseDigest(digest string) (string, bool) {
+	hexDigest, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok || len(hexDigest) != sha256.Size*2 || strings.ToLower(hexDigest) != hexDigest {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hexDigest); err != nil {
+		return "", false
+	}
+	return hexDigest, true
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func isUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func appendToUpload(path string, body io.Reader) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, constants.ModeFileDefault)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, body); err != nil {
+		return fmt.Errorf("failed to write upload: %w", err)
+	}
+	return nil
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), constants.ModeDirPrivate); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
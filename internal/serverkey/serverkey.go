@@ -0,0 +1,163 @@
+// Package serverkey holds the age identity of haloyd. The resolved configs of deployments are encrypted to it
+// before they're stored in the database, and clients encrypt secrets imported to the server to its recipient.
+// The key file lives in the data directory, outside the database directory, so copies and backups of the
+// database don't reveal the secret values.
+package serverkey
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+var (
+	mu sync.Mutex
+	// identities caches the loaded identities by key file path.
+	identities = make(map[string]*age.X25519Identity)
+)
+
+// Identity returns the identity of the server, which is generated on first use.
+func Identity() (*age.X25519Identity, error) {
+	dataDir, err := config.DataDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dataDir, constants.ServerKeyFileName)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if identity, ok := identities[path]; ok {
+		return identity, nil
+	}
+
+	identity, err := loadIdentity(path)
+	if errors.Is(err, os.ErrNotExist) {
+		identity, err = generateIdentity(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	identities[path] = identity
+	return identity, nil
+}
+
+func loadIdentity(path string) (*age.X25519Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.ParseX25519Identity(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server key %s: %w", path, err)
+	}
+	return identity, nil
+}
+
+// generateIdentity writes a new identity to path. If another process created the file first, its identity is used.
+func generateIdentity(path string) (*age.X25519Identity, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate server key: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, constants.ModeFileSecret)
+	if errors.Is(err, os.ErrExist) {
+		return loadIdentity(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server key: %w", err)
+	}
+	if _, err := fmt.Fprintln(file, identity.String()); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write server key: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write server key: %w", err)
+	}
+	return identity, nil
+}
+
+// Seal encrypts data to the server key.
+func Seal(data []byte) ([]byte, error) {
+	identity, err := Identity()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, identity.Recipient())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Open decrypts data sealed with Seal.
+func Open(data []byte) ([]byte, error) {
+	identity, err := Identity()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// EncryptTo encrypts value to the age recipient of another server. The result is armored, so it can be sent in JSON.
+func EncryptTo(recipient, value string) (string, error) {
+	parsed, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return "", fmt.Errorf("invalid recipient '%s': %w", recipient, err)
+	}
+
+	var buf bytes.Buffer
+	armorWriter := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armorWriter, parsed)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := io.WriteString(w, value); err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := armorWriter.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Dearmor returns the binary form of a value encrypted with EncryptTo, which Open decrypts.
+func Dearmor(value string) ([]byte, error) {
+	data, err := io.ReadAll(armor.NewReader(strings.NewReader(value)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	return data, nil
+}
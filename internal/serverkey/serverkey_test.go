@@ -0,0 +1,50 @@
+package serverkey
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+func TestSealOpen(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv(constants.EnvVarDataDir, dataDir)
+
+	plaintext := []byte(`{"env":[{"name":"DB_PASSWORD","value":"hunter2"}]}`)
+	sealed, err := Seal(plaintext)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if bytes.Contains(sealed, []byte("hunter2")) {
+		t.Fatalf("Seal() output contains the plaintext")
+	}
+
+	info, err := os.Stat(filepath.Join(dataDir, constants.ServerKeyFileName))
+	if err != nil {
+		t.Fatalf("server key not created: %v", err)
+	}
+	if info.Mode().Perm() != constants.ModeFileSecret {
+		t.Errorf("server key mode = %v, want %v", info.Mode().Perm(), constants.ModeFileSecret)
+	}
+
+	// A new process loads the key from the file.
+	mu.Lock()
+	clear(identities)
+	mu.Unlock()
+
+	opened, err := Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open() = %s, want %s", opened, plaintext)
+	}
+
+	t.Setenv(constants.EnvVarDataDir, t.TempDir())
+	if _, err := Open(sealed); err == nil {
+		t.Errorf("Open() with another server key succeeded")
+	}
+}
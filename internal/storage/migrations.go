@@ -1,9 +1,223 @@
 package storage
 
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+)
+
+// migration is one schema version. Up must be safe to run on databases created before
+// schema versions were tracked, so it uses CREATE ... IF NOT EXISTS.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(db *DB) error
+	Down    string
+	// Revert is used instead of Down for data migrations that can't be reverted in SQL.
+	Revert func(tx *sql.Tx) error
+}
+
+// migrations are applied in order, new schema changes are appended with the next version.
+var migrations = []migration{
+	{Version: 1, Name: "create deployments", Up: createDeploymentsTable, Down: "DROP TABLE IF EXISTS deployments"},
+	{Version: 2, Name: "create deployment checkpoints", Up: createDeploymentCheckpointsTable, Down: "DROP TABLE IF EXISTS deployment_checkpoints"},
+	{Version: 3, Name: "create deployment specs", Up: createDeploymentSpecsTable, Down: "DROP TABLE IF EXISTS deployment_specs"},
+	{Version: 4, Name: "create paused apps", Up: createPausedAppsTable, Down: "DROP TABLE IF EXISTS paused_apps"},
+	{Version: 5, Name: "create ab tests", Up: createABTestsTable, Down: "DROP TABLE IF EXISTS ab_tests"},
+	{Version: 6, Name: "create deployment logs", Up: createDeploymentLogsTable, Down: "DROP TABLE IF EXISTS deployment_logs"},
+	{Version: 7, Name: "create certificates", Up: createCertificatesTable, Down: "DROP TABLE IF EXISTS certificates"},
+	{Version: 8, Name: "create pending actions", Up: createPendingActionsTable, Down: "DROP TABLE IF EXISTS pending_actions"},
+	{Version: 9, Name: "encrypt deployment configs", Up: encryptDeploymentConfigs, Revert: decryptDeploymentConfigs},
+	{Version: 10, Name: "create secrets", Up: createSecretsTable, Down: "DROP TABLE IF EXISTS secrets"},
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// LatestSchemaVersion is the schema version this build of haloy expects.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func createSchemaMigrationsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+);
+`
+	if _, err := db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest applied migration, 0 for a new database.
+func (db *DB) SchemaVersion() (int, error) {
+	if err := createSchemaMigrationsTable(db); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// Migrations returns all known migrations and when they were applied.
+func (db *DB) Migrations() ([]MigrationStatus, error) {
+	if err := createSchemaMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get schema migrations: %w", err)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Migrate applies all pending migrations.
 func (db *DB) Migrate() error {
-	if err := createDeploymentsTable(db); err != nil {
+	return db.MigrateTo(LatestSchemaVersion())
+}
+
+// MigrateTo applies pending migrations up to and including version.
+func (db *DB) MigrateTo(version int) error {
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("schema version %d is unknown, latest is %d", version, LatestSchemaVersion())
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than %d supported by this version of haloy", current, LatestSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > version {
+			continue
+		}
+		if err := m.Up(db); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		if _, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now()); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// Rollback reverts the last steps applied migrations. The tables they created are dropped with their data,
+// encrypted configs are decrypted again.
+func (db *DB) Rollback(steps int) error {
+	if steps < 1 {
+		return errors.New("rollback steps must be at least 1")
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
 		return err
 	}
 
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if m.Version > current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if m.Revert != nil {
+			err = m.Revert(tx)
+		} else {
+			_, err = tx.Exec(m.Down)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("rollback of migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to remove migration %d: %w", m.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit rollback of migration %d: %w", m.Version, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+// BackupBeforeMigrate backs up the database to the db-backups directory in the data dir
+// and returns the path of the backup.
+func (db *DB) BackupBeforeMigrate() (string, error) {
+	dataDir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	backupDir := filepath.Join(dataDir, constants.DBBackupsDir)
+	if err := os.MkdirAll(backupDir, constants.ModeDirPrivate); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("haloy-v%d-%s.db", version, time.Now().UTC().Format("20060102T150405Z"))
+	path := filepath.Join(backupDir, name)
+	if err := db.Backup(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Backup writes a consistent copy of the database to path, which must not exist.
+func (db *DB) Backup(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %s already exists", path)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
 	return nil
 }
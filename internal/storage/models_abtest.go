@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ABTest routes the requests of an app that match a header, a cookie or a percentage to a variant deployment of
+// the app, e.g. one of a beta image tag. Started with 'haloy ab start' and removed with 'haloy ab stop'.
+type ABTest struct {
+	AppName             string    `db:"app_name" json:"appName"`
+	VariantDeploymentID string    `db:"variant_deployment_id" json:"variantDeploymentId"`
+	VariantImage        string    `db:"variant_image" json:"variantImage"`
+	HeaderName          string    `db:"header_name" json:"headerName,omitempty"`
+	HeaderValue         string    `db:"header_value" json:"headerValue,omitempty"`
+	CookieName          string    `db:"cookie_name" json:"cookieName,omitempty"`
+	CookieValue         string    `db:"cookie_value" json:"cookieValue,omitempty"`
+	Percentage          int       `db:"percentage" json:"percentage,omitempty"` // Share of the other requests, 0 for none
+	StartedAt           time.Time `db:"started_at" json:"startedAt"`
+}
+
+func createABTestsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS ab_tests (
+    app_name TEXT PRIMARY KEY,
+    variant_deployment_id TEXT NOT NULL,
+    variant_image TEXT NOT NULL,
+    header_name TEXT NOT NULL DEFAULT '',
+    header_value TEXT NOT NULL DEFAULT '',
+    cookie_name TEXT NOT NULL DEFAULT '',
+    cookie_value TEXT NOT NULL DEFAULT '',
+    percentage INTEGER NOT NULL DEFAULT 0,
+    started_at DATETIME NOT NULL
+);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create ab_tests table: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) SaveABTest(test ABTest) error {
+	query := `INSERT OR REPLACE INTO ab_tests (app_name, variant_deployment_id, variant_image, header_name, header_value, cookie_name, cookie_value, percentage, started_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, test.AppName, test.VariantDeploymentID, test.VariantImage, test.HeaderName, test.HeaderValue,
+		test.CookieName, test.CookieValue, test.Percentage, test.StartedAt.UTC())
+	return err
+}
+
+func (db *DB) DeleteABTest(appName string) error {
+	_, err := db.Exec(`DELETE FROM ab_tests WHERE app_name = ?`, appName)
+	return err
+}
+
+// GetABTest returns the A/B test of an app, or nil if it has none.
+func (db *DB) GetABTest(appName string) (*ABTest, error) {
+	var test ABTest
+	query := `SELECT app_name, variant_deployment_id, variant_image, header_name, header_value, cookie_name, cookie_value, percentage, started_at
+              FROM ab_tests WHERE app_name = ?`
+
+	err := db.QueryRow(query, appName).Scan(&test.AppName, &test.VariantDeploymentID, &test.VariantImage, &test.HeaderName, &test.HeaderValue,
+		&test.CookieName, &test.CookieValue, &test.Percentage, &test.StartedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get A/B test: %w", err)
+	}
+
+	return &test, nil
+}
+
+func (db *DB) GetABTests() ([]ABTest, error) {
+	query := `SELECT app_name, variant_deployment_id, variant_image, header_name, header_value, cookie_name, cookie_value, percentage, started_at
+              FROM ab_tests ORDER BY app_name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query A/B tests: %w", err)
+	}
+	defer rows.Close()
+
+	var tests []ABTest
+	for rows.Next() {
+		var test ABTest
+		if err := rows.Scan(&test.AppName, &test.VariantDeploymentID, &test.VariantImage, &test.HeaderName, &test.HeaderValue,
+			&test.CookieName, &test.CookieValue, &test.Percentage, &test.StartedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan A/B test: %w", err)
+		}
+		tests = append(tests, test)
+	}
+
+	return tests, rows.Err()
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func createCertificatesTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS certificates (
+    name TEXT PRIMARY KEY,                  -- File name in the certificate directory, e.g. example.com.pem
+    data BLOB NOT NULL,                     -- Private key and certificate chain, PEM encoded
+    updated_at DATETIME NOT NULL
+);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create certificates table: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) SaveCertificate(name string, data []byte) error {
+	query := `INSERT OR REPLACE INTO certificates (name, data, updated_at) VALUES (?, ?, ?)`
+	_, err := db.Exec(query, name, data, time.Now().UTC())
+	return err
+}
+
+func (db *DB) DeleteCertificate(name string) error {
+	_, err := db.Exec(`DELETE FROM certificates WHERE name = ?`, name)
+	return err
+}
+
+// GetCertificate returns the PEM data of a certificate, or nil if it isn't stored.
+func (db *DB) GetCertificate(name string) ([]byte, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM certificates WHERE name = ?`, name).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get certificate: %w", err)
+	}
+	return data, nil
+}
+
+// GetCertificateNames returns the names of all stored certificates, sorted by name.
+func (db *DB) GetCertificateNames() ([]string, error) {
+	rows, err := db.Query(`SELECT name FROM certificates ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificates: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan certificate: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DeploymentCheckpoint records an unfinished deployment so haloyd can resume or roll it back after a restart.
+type DeploymentCheckpoint struct {
+	DeploymentID string          `db:"deployment_id" json:"deploymentId"`
+	AppName      string          `db:"app_name" json:"appName"`
+	Step         string          `db:"step" json:"step"`                   // Last step started, see logging.Step*
+	TargetConfig json.RawMessage `db:"target_config" json:"targetConfig"`  // Resolved config.TargetConfig, encrypted in the database
+	RawAppConfig json.RawMessage `db:"raw_app_config" json:"rawAppConfig"` // config.AppConfig without resolved secrets
+	UpdatedAt    time.Time       `db:"updated_at" json:"updatedAt"`
+}
+
+func createDeploymentCheckpointsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS deployment_checkpoints (
+    deployment_id TEXT PRIMARY KEY,
+    app_name TEXT NOT NULL,
+    step TEXT NOT NULL,
+    target_config JSON NOT NULL,            -- config.TargetConfig with resolved secrets, removed when the deployment finishes. Encrypted since migration 9
+    raw_app_config JSON NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment_checkpoints table: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) SaveCheckpoint(checkpoint DeploymentCheckpoint) error {
+	targetConfig, err := sealConfig(checkpoint.TargetConfig)
+	if err != nil {
+		return err
+	}
+	query := `INSERT OR REPLACE INTO deployment_checkpoints (deployment_id, app_name, step, target_config, raw_app_config, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(query, checkpoint.DeploymentID, checkpoint.AppName, checkpoint.Step,
+		targetConfig, checkpoint.RawAppConfig, checkpoint.UpdatedAt.UTC())
+	return err
+}
+
+func (db *DB) UpdateCheckpointStep(deploymentID, step string) error {
+	query := `UPDATE deployment_checkpoints SET step = ?, updated_at = ? WHERE deployment_id = ?`
+	_, err := db.Exec(query, step, time.Now().UTC(), deploymentID)
+	return err
+}
+
+func (db *DB) DeleteCheckpoint(deploymentID string) error {
+	_, err := db.Exec(`DELETE FROM deployment_checkpoints WHERE deployment_id = ?`, deploymentID)
+	return err
+}
+
+func (db *DB) GetCheckpoints() ([]DeploymentCheckpoint, error) {
+	query := `SELECT deployment_id, app_name, step, target_config, raw_app_config, updated_at
+              FROM deployment_checkpoints
+              ORDER BY deployment_id`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []DeploymentCheckpoint
+	for rows.Next() {
+		var checkpoint DeploymentCheckpoint
+		if err := rows.Scan(&checkpoint.DeploymentID, &checkpoint.AppName, &checkpoint.Step,
+			&checkpoint.TargetConfig, &checkpoint.RawAppConfig, &checkpoint.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment checkpoint: %w", err)
+		}
+		if checkpoint.TargetConfig, err = openConfig(checkpoint.TargetConfig); err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint of deployment %s: %w", checkpoint.DeploymentID, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, rows.Err()
+}
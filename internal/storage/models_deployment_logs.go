@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ameistad/haloy/internal/logging"
+)
+
+func createDeploymentLogsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS deployment_logs (
+    deployment_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    entry JSON NOT NULL,                    -- logging.LogEntry
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (deployment_id, seq)
+);
+CREATE INDEX IF NOT EXISTS idx_deployment_logs_created_at ON deployment_logs(created_at);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment_logs table: %w", err)
+	}
+	return nil
+}
+
+// SaveDeploymentLogs stores log entries of deployments, entries without a deployment ID are skipped.
+func (db *DB) SaveDeploymentLogs(entries []logging.LogEntry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO deployment_logs (deployment_id, seq, entry, created_at) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare deployment log insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		if entry.DeploymentID == "" {
+			continue
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode log entry: %w", err)
+		}
+		if _, err := stmt.Exec(entry.DeploymentID, entry.Seq, data, entry.Timestamp.UTC()); err != nil {
+			return fmt.Errorf("failed to save log entry: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDeploymentLogs returns the stored log entries of a deployment in the order they were logged.
+func (db *DB) GetDeploymentLogs(deploymentID string) ([]logging.LogEntry, error) {
+	rows, err := db.Query(`SELECT entry FROM deployment_logs WHERE deployment_id = ? ORDER BY seq`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment logs: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []logging.LogEntry
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment log: %w", err)
+		}
+		var entry logging.LogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode deployment log: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// PruneDeploymentLogs deletes the log entries logged before cutoff and returns how many were deleted.
+func (db *DB) PruneDeploymentLogs(cutoff time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM deployment_logs WHERE created_at < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune deployment logs: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -92,9 +92,36 @@ func (db *DB) GetDeploymentHistory(appName string, limit int) ([]Deployment, err
 	return deployments, nil
 }
 
+// GetAllDeployments returns the deployments in the history of all apps, oldest first.
+func (db *DB) GetAllDeployments() ([]Deployment, error) {
+	var deployments []Deployment
+	query := `SELECT id, app_name, raw_app_config, deployed_image, rolled_back_from
+              FROM deployments
+              ORDER BY id ASC`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deployment Deployment
+		err := rows.Scan(&deployment.ID, &deployment.AppName, &deployment.RawAppConfig,
+			&deployment.DeployedImage, &deployment.RolledBackFrom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, deployment)
+	}
+
+	return deployments, nil
+}
+
 func (db *DB) PruneOldDeployments(appName string, deploymentsToKeep int) error {
 	// Keep the N most recent deployments for this app, delete the rest
-	// Since ID is in YYYYMMDDHHMMSS format, we can sort by ID directly
+	// Deployment IDs are lowercase ULIDs (helpers.DeploymentID), haloyd normalizes them before they're
+	// stored, so ordering by ID orders by the time the deployments were created.
 	query := `
         DELETE FROM deployments
         WHERE app_name = ?
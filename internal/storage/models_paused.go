@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PausedApp records an app stopped with 'haloy pause'. Its domains keep their certificates and are routed to
+// a maintenance page until the app is resumed or deployed again.
+type PausedApp struct {
+	AppName      string          `db:"app_name" json:"appName"`
+	DeploymentID string          `db:"deployment_id" json:"deploymentId"`
+	Labels       json.RawMessage `db:"labels" json:"labels"` // Container labels of the paused deployment
+	PausedAt     time.Time       `db:"paused_at" json:"pausedAt"`
+}
+
+func createPausedAppsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS paused_apps (
+    app_name TEXT PRIMARY KEY,
+    deployment_id TEXT NOT NULL,
+    labels JSON NOT NULL,
+    paused_at DATETIME NOT NULL
+);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create paused_apps table: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) SavePausedApp(app PausedApp) error {
+	query := `INSERT OR REPLACE INTO paused_apps (app_name, deployment_id, labels, paused_at)
+              VALUES (?, ?, ?, ?)`
+	_, err := db.Exec(query, app.AppName, app.DeploymentID, app.Labels, app.PausedAt.UTC())
+	return err
+}
+
+func (db *DB) DeletePausedApp(appName string) error {
+	_, err := db.Exec(`DELETE FROM paused_apps WHERE app_name = ?`, appName)
+	return err
+}
+
+// GetPausedApp returns the paused state of an app, or nil if it isn't paused.
+func (db *DB) GetPausedApp(appName string) (*PausedApp, error) {
+	var app PausedApp
+	query := `SELECT app_name, deployment_id, labels, paused_at FROM paused_apps WHERE app_name = ?`
+
+	err := db.QueryRow(query, appName).Scan(&app.AppName, &app.DeploymentID, &app.Labels, &app.PausedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get paused app: %w", err)
+	}
+
+	return &app, nil
+}
+
+func (db *DB) GetPausedApps() ([]PausedApp, error) {
+	query := `SELECT app_name, deployment_id, labels, paused_at FROM paused_apps ORDER BY app_name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query paused apps: %w", err)
+	}
+	defer rows.Close()
+
+	var apps []PausedApp
+	for rows.Next() {
+		var app PausedApp
+		if err := rows.Scan(&app.AppName, &app.DeploymentID, &app.Labels, &app.PausedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan paused app: %w", err)
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, rows.Err()
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PendingAction is a destructive operation on a protected app that waits for the confirmation of a second
+// token with 'haloy confirm'. Expired actions are never run.
+type PendingAction struct {
+	ID      string          `db:"id" json:"id"`
+	Action  string          `db:"action" json:"action"`
+	AppName string          `db:"app_name" json:"appName"`
+	Request json.RawMessage `db:"request" json:"request"` // Parameters of the operation
+	// RequestedBy identifies the token that requested the operation, it can't confirm it. Not the token itself.
+	RequestedBy string    `db:"requested_by" json:"requestedBy"`
+	RequestedAt time.Time `db:"requested_at" json:"requestedAt"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expiresAt"`
+}
+
+func createPendingActionsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS pending_actions (
+    id TEXT PRIMARY KEY,
+    action TEXT NOT NULL,
+    app_name TEXT NOT NULL,
+    request JSON NOT NULL,
+    requested_by TEXT NOT NULL,
+    requested_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_pending_actions_expires_at ON pending_actions(expires_at);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create pending_actions table: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) SavePendingAction(action PendingAction) error {
+	query := `INSERT INTO pending_actions (id, action, app_name, request, requested_by, requested_at, expires_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, action.ID, action.Action, action.AppName, action.Request, action.RequestedBy,
+		action.RequestedAt.UTC(), action.ExpiresAt.UTC())
+	return err
+}
+
+// GetPendingAction returns a pending action, or nil if there is none with the ID.
+func (db *DB) GetPendingAction(id string) (*PendingAction, error) {
+	var action PendingAction
+	query := `SELECT id, action, app_name, request, requested_by, requested_at, expires_at
+              FROM pending_actions WHERE id = ?`
+
+	err := db.QueryRow(query, id).Scan(&action.ID, &action.Action, &action.AppName, &action.Request,
+		&action.RequestedBy, &action.RequestedAt, &action.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get pending action: %w", err)
+	}
+
+	return &action, nil
+}
+
+// DeletePendingAction removes a pending action and reports whether it existed, so concurrent confirmations
+// of the same action only run it once.
+func (db *DB) DeletePendingAction(id string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM pending_actions WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// DeleteExpiredPendingActions removes the actions that expired before now.
+func (db *DB) DeleteExpiredPendingActions(now time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM pending_actions WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired pending actions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetPendingActions returns the actions that haven't expired at now, oldest first.
+func (db *DB) GetPendingActions(now time.Time) ([]PendingAction, error) {
+	query := `SELECT id, action, app_name, request, requested_by, requested_at, expires_at
+              FROM pending_actions WHERE expires_at > ? ORDER BY requested_at`
+
+	rows, err := db.Query(query, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []PendingAction
+	for rows.Next() {
+		var action PendingAction
+		if err := rows.Scan(&action.ID, &action.Action, &action.AppName, &action.Request,
+			&action.RequestedBy, &action.RequestedAt, &action.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pending action: %w", err)
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
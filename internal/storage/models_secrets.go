@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Secret is the value of a secret provider reference imported with 'haloy secrets import'. Deployments that
+// leave the reference unresolved get the value from the server.
+type Secret struct {
+	Name  string `db:"name" json:"name"` // Secret provider reference, e.g. onepassword:prod.db-password
+	Value []byte `db:"value" json:"value"`
+	// Apps that used the secret on the server it was exported from. App tokens can only deploy it to them.
+	Apps       json.RawMessage `db:"apps" json:"apps"`
+	ImportedAt time.Time       `db:"imported_at" json:"importedAt"`
+}
+
+func createSecretsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS secrets (
+    name TEXT PRIMARY KEY,
+    value BLOB NOT NULL,                    -- age encrypted to the server key by the client
+    apps JSON NOT NULL,
+    imported_at DATETIME NOT NULL
+);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create secrets table: %w", err)
+	}
+	return nil
+}
+
+// SaveSecrets stores imported secrets, replacing secrets with the same names.
+func (db *DB) SaveSecrets(secrets []Secret) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT OR REPLACE INTO secrets (name, value, apps, imported_at) VALUES (?, ?, ?, ?)`
+	for _, secret := range secrets {
+		if _, err := tx.Exec(query, secret.Name, secret.Value, secret.Apps, secret.ImportedAt.UTC()); err != nil {
+			return fmt.Errorf("failed to save secret %s: %w", secret.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) GetSecrets() ([]Secret, error) {
+	query := `SELECT name, value, apps, imported_at FROM secrets ORDER BY name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secrets: %w", err)
+	}
+	defer rows.Close()
+
+	var secrets []Secret
+	for rows.Next() {
+		var secret Secret
+		if err := rows.Scan(&secret.Name, &secret.Value, &secret.Apps, &secret.ImportedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan secret: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, rows.Err()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DeploymentSpec is the resolved target config of a successful deployment. It's the desired state of the
+// app used by reconciliation and rollbacks, container labels only hold what routing needs.
+type DeploymentSpec struct {
+	DeploymentID string          `db:"deployment_id" json:"deploymentId"`
+	AppName      string          `db:"app_name" json:"appName"`
+	TargetConfig json.RawMessage `db:"target_config" json:"targetConfig"` // Resolved config.TargetConfig, encrypted in the database
+	CreatedAt    time.Time       `db:"created_at" json:"createdAt"`
+}
+
+func createDeploymentSpecsTable(db *DB) error {
+	schema := `
+CREATE TABLE IF NOT EXISTS deployment_specs (
+    deployment_id TEXT PRIMARY KEY,
+    app_name TEXT NOT NULL,
+    target_config JSON NOT NULL,            -- config.TargetConfig with resolved secrets. Encrypted since migration 9
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployment_specs_app_name ON deployment_specs(app_name);
+`
+
+	_, err := db.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment_specs table: %w", err)
+	}
+	return nil
+}
+
+// CompleteCheckpoint stores the target config of a checkpoint as the spec of a successful deployment
+// and removes the checkpoint.
+func (db *DB) CompleteCheckpoint(deploymentID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT OR REPLACE INTO deployment_specs (deployment_id, app_name, target_config, created_at)
+              SELECT deployment_id, app_name, target_config, ? FROM deployment_checkpoints WHERE deployment_id = ?`
+	if _, err := tx.Exec(query, time.Now().UTC(), deploymentID); err != nil {
+		return fmt.Errorf("failed to save deployment spec: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM deployment_checkpoints WHERE deployment_id = ?`, deploymentID); err != nil {
+		return fmt.Errorf("failed to remove deployment checkpoint: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetDeploymentSpec returns the spec of a deployment, or nil if none is stored.
+func (db *DB) GetDeploymentSpec(deploymentID string) (*DeploymentSpec, error) {
+	var spec DeploymentSpec
+	query := `SELECT deployment_id, app_name, target_config, created_at
+              FROM deployment_specs WHERE deployment_id = ?`
+
+	err := db.QueryRow(query, deploymentID).Scan(&spec.DeploymentID, &spec.AppName, &spec.TargetConfig, &spec.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get deployment spec: %w", err)
+	}
+	if spec.TargetConfig, err = openConfig(spec.TargetConfig); err != nil {
+		return nil, fmt.Errorf("failed to read spec of deployment %s: %w", deploymentID, err)
+	}
+
+	return &spec, nil
+}
+
+// UpdateDeploymentSpec replaces the target config stored for a deployment, e.g. when its replicas are scaled.
+func (db *DB) UpdateDeploymentSpec(deploymentID string, targetConfig json.RawMessage) error {
+	sealed, err := sealConfig(targetConfig)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE deployment_specs SET target_config = ? WHERE deployment_id = ?`, sealed, deploymentID)
+	return err
+}
+
+// PruneDeploymentSpecs removes the specs of an app that are no longer needed: the latest spec is kept for
+// reconciliation and older ones only while their deployment is in the rollback history.
+func (db *DB) PruneDeploymentSpecs(appName string) error {
+	query := `
+        DELETE FROM deployment_specs
+        WHERE app_name = ?
+        AND deployment_id NOT IN (SELECT id FROM deployments WHERE app_name = ?)
+        AND deployment_id NOT IN (
+            SELECT deployment_id FROM deployment_specs
+            WHERE app_name = ?
+            ORDER BY deployment_id DESC
+            LIMIT 1
+        )
+    `
+
+	if _, err := db.Exec(query, appName, appName, appName); err != nil {
+		return fmt.Errorf("failed to prune deployment specs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ameistad/haloy/internal/serverkey"
+)
+
+// The resolved target configs of checkpoints and specs hold secret values, so they're encrypted to the
+// server key before they're stored. Configs stored by earlier versions are plain JSON until migration 9
+// encrypts them.
+
+// sealedConfigTables are the tables with a target_config column, both are keyed by deployment_id.
+var sealedConfigTables = []string{"deployment_checkpoints", "deployment_specs"}
+
+func sealConfig(targetConfig json.RawMessage) ([]byte, error) {
+	sealed, err := serverkey.Seal(targetConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt target config: %w", err)
+	}
+	return sealed, nil
+}
+
+func openConfig(stored []byte) (json.RawMessage, error) {
+	if plainConfig(stored) {
+		return stored, nil
+	}
+	targetConfig, err := serverkey.Open(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt target config: %w", err)
+	}
+	return targetConfig, nil
+}
+
+func plainConfig(stored []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(stored), []byte("{"))
+}
+
+func encryptDeploymentConfigs(db *DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = rewriteConfigs(tx, func(stored []byte) ([]byte, error) {
+		if !plainConfig(stored) {
+			return nil, nil
+		}
+		return sealConfig(stored)
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func decryptDeploymentConfigs(tx *sql.Tx) error {
+	return rewriteConfigs(tx, func(stored []byte) ([]byte, error) {
+		if plainConfig(stored) {
+			return nil, nil
+		}
+		return openConfig(stored)
+	})
+}
+
+// rewriteConfigs replaces the target configs of all rows with the result of rewrite, rows are left as they
+// are when it returns nil.
+func rewriteConfigs(tx *sql.Tx, rewrite func(stored []byte) ([]byte, error)) error {
+	for _, table := range sealedConfigTables {
+		rows, err := tx.Query(fmt.Sprintf("SELECT deployment_id, target_config FROM %s", table))
+		if err != nil {
+			return fmt.Errorf("failed to query %s: %w", table, err)
+		}
+		stored := make(map[string][]byte)
+		for rows.Next() {
+			var key string
+			var targetConfig []byte
+			if err := rows.Scan(&key, &targetConfig); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan %s: %w", table, err)
+			}
+			stored[key] = targetConfig
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to query %s: %w", table, err)
+		}
+
+		for key, targetConfig := range stored {
+			rewritten, err := rewrite(targetConfig)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite %s of %s: %w", table, key, err)
+			}
+			if rewritten == nil {
+				continue
+			}
+			query := fmt.Sprintf("UPDATE %s SET target_config = ? WHERE deployment_id = ?", table)
+			if _, err := tx.Exec(query, rewritten, key); err != nil {
+				return fmt.Errorf("failed to update %s of %s: %w", table, key, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/config"
+	"github.com/ameistad/haloy/internal/constants"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/ameistad/haloy"
+
+	// deploymentSpanTimeout ends deployment spans that never receive a result, e.g. when haloyd misses the container event.
+	deploymentSpanTimeout = 30 * time.Minute
+)
+
+// Setup exports spans to the configured OTLP/HTTP endpoint. Without an endpoint the global no-op
+// tracer is kept, so instrumented code paths cost next to nothing. The returned function flushes
+// and stops the exporter.
+func Setup(ctx context.Context, tracingConfig config.HaloydTracing) (func(context.Context) error, error) {
+	if tracingConfig.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(tracingConfig.Endpoint)}
+	if len(tracingConfig.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(tracingConfig.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	sampleRatio := 1.0
+	if tracingConfig.SampleRatio != nil {
+		sampleRatio = *tracingConfig.SampleRatio
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "haloyd"),
+			attribute.String("service.version", constants.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// A deployment starts in the API handler and continues in the updater when Docker reports the new
+// containers, so the root span of each deployment is kept until the deployment has a result.
+var (
+	deploymentsMutex sync.Mutex
+	deployments      = make(map[string]deploymentSpan)
+)
+
+type deploymentSpan struct {
+	span  trace.Span
+	timer *time.Timer
+}
+
+// StartDeployment starts the root span of a deployment. A trace context sent by the client, e.g.
+// from a CI pipeline, becomes the parent so the deployment shows up in the same trace.
+func StartDeployment(r *http.Request, deploymentID, appName string, attrs ...attribute.KeyValue) context.Context {
+	ctx := otel.GetTextMapPropagator().Extract(context.WithoutCancel(r.Context()), propagation.HeaderCarrier(r.Header))
+	attrs = append(attrs,
+		attribute.String("haloy.app", appName),
+		attribute.String("haloy.deployment_id", deploymentID),
+	)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "deployment", trace.WithAttributes(attrs...))
+
+	deploymentsMutex.Lock()
+	defer deploymentsMutex.Unlock()
+	deployments[deploymentID] = deploymentSpan{
+		span: span,
+		timer: time.AfterFunc(deploymentSpanTimeout, func() {
+			EndDeployment(deploymentID, errors.New("deployment did not finish in time"))
+		}),
+	}
+	return ctx
+}
+
+// WithDeployment returns ctx with the root span of the deployment, if it is still running.
+func WithDeployment(ctx context.Context, deploymentID string) context.Context {
+	deploymentsMutex.Lock()
+	defer deploymentsMutex.Unlock()
+	if d, ok := deployments[deploymentID]; ok {
+		return trace.ContextWithSpan(ctx, d.span)
+	}
+	return ctx
+}
+
+// EndDeployment ends the root span of the deployment with its result.
+func EndDeployment(deploymentID string, err error) {
+	deploymentsMutex.Lock()
+	d, ok := deployments[deploymentID]
+	delete(deployments, deploymentID)
+	deploymentsMutex.Unlock()
+
+	if !ok {
+		return
+	}
+	d.timer.Stop()
+	End(d.span, err)
+}
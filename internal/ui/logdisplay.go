@@ -33,7 +33,12 @@ func DisplayLogEntry(logEntry logging.LogEntry, prefix string) {
 			if len(domains) > 0 {
 				urls := make([]string, len(domains))
 				for i, domain := range domains {
-					urls[i] = fmt.Sprintf("https://%s", domain)
+					// Domains served over plain HTTP are logged with their scheme.
+					if strings.Contains(domain, "://") {
+						urls[i] = domain
+					} else {
+						urls[i] = fmt.Sprintf("https://%s", domain)
+					}
 				}
 				message = fmt.Sprintf("%s → %s", message, strings.Join(urls, ", "))
 			}
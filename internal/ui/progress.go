@@ -0,0 +1,227 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ameistad/haloy/internal/logging"
+	"github.com/charmbracelet/x/term"
+)
+
+var stepTitles = map[string]string{
+	logging.StepResolve:     "Resolve config",
+	logging.StepSecrets:     "Fetch secrets",
+	logging.StepPush:        "Build and push image",
+	logging.StepPull:        "Pull image",
+	logging.StepCreate:      "Create containers",
+	logging.StepHealthCheck: "Health check",
+	logging.StepTraffic:     "Switch traffic",
+	logging.StepCleanup:     "Clean up",
+}
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// IsInteractive reports whether stdout is a terminal that can render spinners. CI environments
+// always get the compact output.
+func IsInteractive() bool {
+	return term.IsTerminal(os.Stdout.Fd()) && os.Getenv("CI") == ""
+}
+
+// StepProgress renders the steps of a deployment. In interactive mode the running step is shown
+// with a spinner and elapsed time. Otherwise a single line is printed when each step finishes,
+// which keeps CI logs compact.
+type StepProgress struct {
+	prefix      string
+	interactive bool
+
+	mu      sync.Mutex
+	step    string
+	detail  string
+	started time.Time
+	frame   int
+	stop    chan struct{}
+	done    chan struct{}
+	timings []StepTiming
+}
+
+// StepTiming is the duration of a finished deployment step.
+type StepTiming struct {
+	Step     string
+	Duration time.Duration
+}
+
+func NewStepProgress(prefix string, interactive bool) *StepProgress {
+	return &StepProgress{prefix: prefix, interactive: interactive}
+}
+
+// Start finishes the running step, if any, and starts the given step.
+func (p *StepProgress) Start(step string) {
+	p.mu.Lock()
+	if step == p.step {
+		p.mu.Unlock()
+		return
+	}
+	running := p.step != ""
+	p.mu.Unlock()
+
+	if running {
+		p.Finish(nil)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.step = step
+	p.detail = ""
+	p.started = time.Now()
+	p.frame = 0
+	if p.interactive {
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		p.draw()
+		go p.spin(p.stop, p.done)
+	}
+}
+
+// Finish completes the running step, marking it failed if err is not nil.
+func (p *StepProgress) Finish(err error) {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.step == "" {
+		return
+	}
+
+	elapsed := time.Since(p.started)
+	p.timings = append(p.timings, StepTiming{Step: p.step, Duration: elapsed})
+
+	icon := s.Foreground(Green).Render("✓")
+	if err != nil {
+		icon = s.Foreground(Red).Render("✖")
+	}
+	duration := s.Foreground(Gray).Render(formatStepDuration(elapsed))
+	if p.interactive {
+		fmt.Print("\r\x1b[K")
+	}
+	fmt.Printf("%s %s%s %s\n", icon, p.prefix, s.Foreground(White).Render(stepTitle(p.step)), duration)
+	p.step = ""
+}
+
+// Timings returns the durations of the finished steps.
+func (p *StepProgress) Timings() []StepTiming {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]StepTiming(nil), p.timings...)
+}
+
+// PrintStepTimings prints a breakdown of where a deployment spent its time. Timings of each
+// target are listed under the target name when there are several targets.
+func PrintStepTimings(local []StepTiming, targets map[string][]StepTiming) {
+	var lines []string
+	var total time.Duration
+	addLines := func(indent string, timings []StepTiming) time.Duration {
+		var sum time.Duration
+		for _, timing := range timings {
+			lines = append(lines, fmt.Sprintf("%s%-*s %s", indent, 22-len(indent), stepTitle(timing.Step), formatStepDuration(timing.Duration)))
+			sum += timing.Duration
+		}
+		return sum
+	}
+
+	total += addLines("", local)
+
+	names := slices.Sorted(maps.Keys(targets))
+	var slowest time.Duration
+	for _, name := range names {
+		indent := ""
+		if len(names) > 1 {
+			lines = append(lines, name)
+			indent = "  "
+		}
+		// Servers are deployed to concurrently, so the total only counts the slowest target.
+		slowest = max(slowest, addLines(indent, targets[name]))
+	}
+	total += slowest
+
+	if len(lines) == 0 {
+		return
+	}
+	lines = append(lines, fmt.Sprintf("%-22s %s", "Total", formatStepDuration(total)))
+	Section("Deployment timing", lines)
+}
+
+// SetDetail shows detail, e.g. upload progress, next to the running step. It is only shown in interactive mode.
+func (p *StepProgress) SetDetail(detail string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.detail = detail
+}
+
+// Print runs fn, which writes regular output, without it being overwritten by the spinner.
+func (p *StepProgress) Print(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	spinning := p.interactive && p.step != ""
+	if spinning {
+		fmt.Print("\r\x1b[K")
+	}
+	fn()
+	if spinning {
+		p.draw()
+	}
+}
+
+func (p *StepProgress) spin(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// draw renders the running step. The caller must hold the lock.
+func (p *StepProgress) draw() {
+	spinner := s.Foreground(Amber).Render(spinnerFrames[p.frame%len(spinnerFrames)])
+	duration := s.Foreground(Gray).Render(formatStepDuration(time.Since(p.started)))
+	detail := ""
+	if p.detail != "" {
+		detail = " " + s.Foreground(Gray).Render(p.detail)
+	}
+	fmt.Printf("\r\x1b[K%s %s%s %s%s", spinner, p.prefix, s.Foreground(White).Render(stepTitle(p.step)), duration, detail)
+}
+
+func stepTitle(step string) string {
+	if title, ok := stepTitles[step]; ok {
+		return title
+	}
+	return step
+}
+
+func formatStepDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
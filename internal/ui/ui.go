@@ -121,3 +121,11 @@ func (p *PrefixedUI) Success(format string, a ...any) {
 	}
 	Success(format, a...)
 }
+
+func (p *PrefixedUI) Warn(format string, a ...any) {
+	if p.Prefix != "" {
+		format = "%s" + format
+		a = append([]any{p.Prefix}, a...)
+	}
+	Warn(format, a...)
+}